@@ -0,0 +1,158 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client provides a client for the CoreRAD HTTP debug API.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// A Client is a client for the CoreRAD HTTP debug API. Its methods return the
+// same types which the debug API uses to produce its JSON responses.
+type Client struct {
+	// Token, if set, is sent as a bearer token in the Authorization header
+	// of each request.
+	Token string
+
+	base *url.URL
+	c    *http.Client
+}
+
+// New creates a Client which communicates with the debug API at the
+// base URL addr, such as "http://localhost:9430". If c is nil, a default
+// http.Client with a timeout is used.
+func New(addr string, c *http.Client) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %v", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("client: base URL %q must use http or https scheme", addr)
+	}
+
+	if c == nil {
+		c = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Client{
+		base: u,
+		c:    c,
+	}, nil
+}
+
+// Interfaces fetches the state of all of the interfaces configured on the
+// CoreRAD server.
+func (c *Client) Interfaces(ctx context.Context) ([]InterfaceBody, error) {
+	var body InterfacesBody
+	if err := c.get(ctx, "/api/interfaces", &body); err != nil {
+		return nil, err
+	}
+
+	return body.Interfaces, nil
+}
+
+// Interface fetches the state of the interface specified by name. If the
+// interface is not configured on the CoreRAD server, it returns an error
+// which can be checked using errors.Is(err, os.ErrNotExist).
+func (c *Client) Interface(ctx context.Context, name string) (*InterfaceBody, error) {
+	ifis, err := c.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ifi := range ifis {
+		if ifi.Interface == name {
+			return &ifi, nil
+		}
+	}
+
+	return nil, fmt.Errorf("client: interface %q not found: %w", name, os.ErrNotExist)
+}
+
+// Conflicts fetches the recent inconsistencies detected between the
+// interfaces configured on the CoreRAD server and other routers. The server
+// must have a debug token configured, and the Client's Token must match it.
+func (c *Client) Conflicts(ctx context.Context) ([]ConflictBody, error) {
+	var body ConflictsBody
+	if err := c.get(ctx, "/api/conflicts", &body); err != nil {
+		return nil, err
+	}
+
+	return body.Conflicts, nil
+}
+
+// Sockets fetches the NDP socket setup of each interface configured on the
+// CoreRAD server. The server must have a debug token configured, and the
+// Client's Token must match it.
+func (c *Client) Sockets(ctx context.Context) ([]SocketBody, error) {
+	var body SocketsBody
+	if err := c.get(ctx, "/api/sockets", &body); err != nil {
+		return nil, err
+	}
+
+	return body.Sockets, nil
+}
+
+// get performs an HTTP GET request on path and unmarshals the JSON response
+// body into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("client: failed to create request: %v", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.c.Do(req)
+	if err != nil {
+		return fmt.Errorf("client: failed to perform request: %w", err)
+	}
+	defer res.Body.Close()
+
+	// Don't consume a stream larger than a sane upper bound.
+	const mb = 1 << 20
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, 2*mb))
+	if err != nil {
+		return fmt.Errorf("client: failed to read response body: %v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("client: unexpected HTTP status %d for %q: %s",
+			res.StatusCode, path, strings.TrimSpace(string(b)))
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("client: failed to unmarshal JSON response: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/client"
+	"github.com/mdlayher/corerad/internal/config"
+	"github.com/mdlayher/corerad/internal/crhttp"
+	"github.com/mdlayher/corerad/internal/system"
+)
+
+func TestClientInterfaces(t *testing.T) {
+	srv := httptest.NewServer(
+		crhttp.NewHandler(
+			log.New(ioutil.Discard, "", 0),
+			system.TestState{Forwarding: true},
+			config.Config{
+				Interfaces: []config.Interface{
+					{
+						Name:            "eth0",
+						Advertise:       true,
+						HopLimit:        64,
+						DefaultLifetime: 30 * time.Minute,
+					},
+					{
+						Name:      "eth1",
+						Advertise: false,
+					},
+				},
+			},
+			nil,
+			nil,
+			nil,
+		),
+	)
+	defer srv.Close()
+
+	c, err := client.New(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+
+	ifis, err := c.Interfaces(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch interfaces: %v", err)
+	}
+
+	eth0 := client.InterfaceBody{
+		Interface:   "eth0",
+		Advertising: true,
+		Advertisement: &client.RouterAdvertisement{
+			CurrentHopLimit:           64,
+			RouterSelectionPreference: "medium",
+			ReachableTime:             "0s",
+			RetransmitTimer:           "0s",
+			RouterLifetimeSeconds:     60 * 30,
+			Options: client.Options{
+				DNSSL:    []client.DNSSL{},
+				Prefixes: []client.Prefix{},
+				RDNSS:    []client.RDNSS{},
+				Routes:   []client.Route{},
+			},
+		},
+	}
+
+	want := []client.InterfaceBody{eth0, {Interface: "eth1"}}
+	if diff := cmp.Diff(want, ifis); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+
+	ifi, err := c.Interface(ctx, "eth0")
+	if err != nil {
+		t.Fatalf("failed to fetch interface: %v", err)
+	}
+
+	if diff := cmp.Diff(&eth0, ifi); diff != "" {
+		t.Fatalf("unexpected interface (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Interface(ctx, "eth2"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist error, but got: %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	const token = "secret"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = w.Write([]byte("xxx"))
+	}))
+	defer srv.Close()
+
+	if _, err := client.New("localhost:9430", nil); err == nil {
+		t.Fatal("expected an invalid URL scheme error, but none occurred")
+	}
+
+	c, err := client.New(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := c.Interfaces(ctx); err == nil {
+		t.Fatal("expected an unauthorized error, but none occurred")
+	}
+
+	// Authorized, but the server returns garbage.
+	c.Token = token
+	if _, err := c.Interfaces(ctx); err == nil {
+		t.Fatal("expected a JSON error, but none occurred")
+	}
+}
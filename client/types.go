@@ -0,0 +1,291 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "time"
+
+// An InterfacesBody is the top-level structure returned by the debug API's
+// interfaces route.
+type InterfacesBody struct {
+	// The number of advertising interfaces and the limit on advertising
+	// interfaces.
+	Advertisers    int `json:"advertisers"`
+	MaxAdvertisers int `json:"max_advertisers"`
+
+	Interfaces []InterfaceBody `json:"interfaces"`
+}
+
+// An InterfaceBody represents an individual advertising interface.
+type InterfaceBody struct {
+	Interface   string `json:"interface"`
+	Advertising bool   `json:"advertise"`
+
+	// Shadow indicates router advertisements are logged but never sent.
+	Shadow bool `json:"shadow"`
+
+	// Nil unless the interface is a VLAN sub-interface of a trunk interface.
+	VLAN *VLANBody `json:"vlan,omitempty"`
+
+	// Rejected indicates the interface was configured to advertise, but was
+	// not started due to the limit on advertising interfaces.
+	Rejected bool `json:"rejected,omitempty"`
+
+	// Withdrawn indicates the interface advertises a router lifetime of zero
+	// and no prefixes, Cordoned indicates the interface advertises a router
+	// lifetime of zero but retains its prefixes, Ready indicates the interface
+	// has been initialized, and Waiting indicates the advertiser is waiting
+	// for the interface to be created. All are false if advertiser status is
+	// unavailable.
+	Withdrawn bool `json:"withdrawn"`
+	Cordoned  bool `json:"cordoned"`
+	Ready     bool `json:"ready"`
+	Waiting   bool `json:"waiting"`
+
+	// LinkState is the operational state of the interface's link, such as
+	// "up" or "down", if the advertiser tracks link state.
+	LinkState string `json:"link_state,omitempty"`
+
+	// Nil if Advertising is false.
+	Advertisement *RouterAdvertisement `json:"advertisement"`
+
+	// Nil unless solicited and unsolicited router advertisements are built
+	// from separate plugin sets, in which case Advertisement is unsolicited
+	// and SolicitedAdvertisement is solicited.
+	SolicitedAdvertisement *RouterAdvertisement `json:"solicited_advertisement,omitempty"`
+
+	// Nil unless the reachable time or retransmit timer is chosen randomly
+	// for each router advertisement, in which case it is the configured
+	// range. Advertisement contains the values chosen when it was built.
+	ReachableTimeRange   *TimerRangeBody `json:"reachable_time_range,omitempty"`
+	RetransmitTimerRange *TimerRangeBody `json:"retransmit_timer_range,omitempty"`
+
+	// Nil unless the interface adopts the hop limit of other routers, in
+	// which case it is the hop limit currently advertised.
+	EffectiveHopLimit *int `json:"effective_hop_limit,omitempty"`
+
+	// Nil unless the interface's router lifetime is ramping up after it was
+	// initialized or promoted, in which case it is the router lifetime
+	// currently advertised. Advertisement contains the same value.
+	RampingRouterLifetimeSeconds *int `json:"ramping_router_lifetime_seconds,omitempty"`
+
+	// Empty unless the source link-layer address advertised by the interface
+	// is overridden, in which case it is the advertised address.
+	SourceLLAOverride string `json:"source_lla_override,omitempty"`
+
+	// Nil if upstream health checking is not configured.
+	UpstreamHealthy *bool `json:"upstream_healthy,omitempty"`
+
+	// Empty if VRRP mode is not configured, otherwise "master" or "backup".
+	VRRPRole string `json:"vrrp_role,omitempty"`
+
+	// The progress of any configured renumbering plans.
+	Renumber []RenumberBody `json:"renumber,omitempty"`
+
+	// The names of any plugins dropped to fit the configured router
+	// advertisement size budget.
+	DroppedPlugins []string `json:"dropped_plugins,omitempty"`
+}
+
+// A VLANBody represents the trunk interface and VLAN ID of a VLAN
+// sub-interface.
+type VLANBody struct {
+	Trunk string `json:"trunk"`
+	ID    int    `json:"id"`
+}
+
+// A TimerRangeBody represents the range of a randomized router advertisement
+// timer.
+type TimerRangeBody struct {
+	MinMilliseconds int `json:"min_milliseconds"`
+	MaxMilliseconds int `json:"max_milliseconds"`
+}
+
+// A RenumberBody represents the progress of a renumbering plan.
+type RenumberBody struct {
+	OldPrefix string    `json:"old_prefix"`
+	NewPrefix string    `json:"new_prefix"`
+	Phase     string    `json:"phase"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Progress  float64   `json:"progress"`
+}
+
+// A ConflictsBody is the top-level structure returned by the debug API's
+// conflicts route.
+type ConflictsBody struct {
+	Conflicts []ConflictBody `json:"conflicts"`
+}
+
+// A ConflictBody represents a recent inconsistency between the router
+// advertisements of an interface and those of another router.
+type ConflictBody struct {
+	Interface  string    `json:"interface"`
+	Router     string    `json:"router"`
+	Field      string    `json:"field"`
+	Details    string    `json:"details"`
+	Message    string    `json:"message"`
+	Ours       string    `json:"ours"`
+	Theirs     string    `json:"theirs"`
+	Persistent bool      `json:"persistent"`
+	Duplicates int       `json:"duplicates"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// An EventsBody is the top-level structure returned by the debug API's events
+// route.
+type EventsBody struct {
+	Events []EventBody `json:"events"`
+}
+
+// An EventBody represents a notable event, such as an interface going down or
+// a configuration reload. Interface is empty if the event does not apply to a
+// single interface.
+type EventBody struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Interface string    `json:"interface,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// A ReloadBody is the structure returned by the debug API's reload route.
+type ReloadBody struct {
+	OK bool `json:"ok"`
+
+	// Changes summarizes the differences from the running configuration if
+	// OK is true, and is empty if nothing changed. Error reports why the
+	// configuration is invalid if OK is false.
+	Changes []string `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// A DecodeBody is the structure returned by the debug API's decode route.
+type DecodeBody struct {
+	OK bool `json:"ok"`
+
+	// RouterAdvertisement is the decoded router advertisement if OK is true.
+	// Error reports why the input could not be decoded if OK is false.
+	RouterAdvertisement *RouterAdvertisement `json:"router_advertisement,omitempty"`
+	Error               string               `json:"error,omitempty"`
+}
+
+// A SocketsBody is the top-level structure returned by the debug API's
+// sockets route.
+type SocketsBody struct {
+	Sockets []SocketBody `json:"sockets"`
+}
+
+// A SocketBody represents the setup of an interface's NDP socket.
+type SocketBody struct {
+	Interface string `json:"interface"`
+
+	// Empty if the interface has no active socket.
+	Address         string   `json:"address,omitempty"`
+	MulticastGroups []string `json:"multicast_groups"`
+	ICMPFilter      []string `json:"icmp_filter"`
+}
+
+// A PluginsBody is the top-level structure returned by the debug API's plugins
+// route.
+type PluginsBody struct {
+	Plugins []PluginBody `json:"plugins"`
+}
+
+// A PluginBody describes the configuration of a plugin supported by this build
+// of CoreRAD.
+type PluginBody struct {
+	Name string `json:"name"`
+
+	// Empty if the plugin is configured by keys within [[interfaces]].
+	Table   string      `json:"table,omitempty"`
+	Array   bool        `json:"array"`
+	Options []string    `json:"options"`
+	Fields  []FieldBody `json:"fields"`
+}
+
+// A FieldBody describes a configurable field of a plugin.
+type FieldBody struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+
+	// Only set for tables.
+	Fields []FieldBody `json:"fields,omitempty"`
+}
+
+// A RouterAdvertisement represents an unpacked NDP router advertisement.
+type RouterAdvertisement struct {
+	CurrentHopLimit             int     `json:"current_hop_limit"`
+	ManagedConfiguration        bool    `json:"managed_configuration"`
+	OtherConfiguration          bool    `json:"other_configuration"`
+	MobileIPv6HomeAgent         bool    `json:"mobile_ipv6_home_agent"`
+	RouterSelectionPreference   string  `json:"router_selection_preference"`
+	NeighborDiscoveryProxy      bool    `json:"neighbor_discovery_proxy"`
+	RouterLifetimeSeconds       int     `json:"router_lifetime_seconds"`
+	ReachableTimeMilliseconds   int     `json:"reachable_time_milliseconds"`
+	ReachableTime               string  `json:"reachable_time"`
+	RetransmitTimerMilliseconds int     `json:"retransmit_timer_milliseconds"`
+	RetransmitTimer             string  `json:"retransmit_timer"`
+	Options                     Options `json:"options"`
+}
+
+// Options represents the options unpacked from an NDP router advertisement.
+type Options struct {
+	CaptivePortal          string      `json:"captive_portal"`
+	DNSSL                  []DNSSL     `json:"dnssl"`
+	MTU                    int         `json:"mtu"`
+	Nonce                  string      `json:"nonce"`
+	Prefixes               []Prefix    `json:"prefixes"`
+	RawOptions             []RawOption `json:"raw_options"`
+	RDNSS                  []RDNSS     `json:"rdnss"`
+	Routes                 []Route     `json:"routes"`
+	SourceLinkLayerAddress string      `json:"source_link_layer_address"`
+}
+
+// A RawOption represents an NDP option which is not otherwise modeled, with
+// its value encoded as hexadecimal.
+type RawOption struct {
+	Type  int    `json:"type"`
+	Value string `json:"value"`
+}
+
+// A DNSSL represents an NDP DNS Search List option.
+type DNSSL struct {
+	LifetimeSeconds int      `json:"lifetime_seconds"`
+	DomainNames     []string `json:"domain_names"`
+}
+
+// A Prefix represents an NDP Prefix Information option. If RouterAddress is
+// set, Prefix carries the router's full address rather than the prefix's
+// network address.
+type Prefix struct {
+	Prefix                             string `json:"prefix"`
+	OnLink                             bool   `json:"on_link"`
+	AutonomousAddressAutoconfiguration bool   `json:"autonomous_address_autoconfiguration"`
+	RouterAddress                      bool   `json:"router_address"`
+	ValidLifetimeSeconds               int    `json:"valid_lifetime_seconds"`
+	PreferredLifetimeSeconds           int    `json:"preferred_lifetime_seconds"`
+}
+
+// A RDNSS represents an NDP Recursive DNS Servers option.
+type RDNSS struct {
+	LifetimeSeconds int      `json:"lifetime_seconds"`
+	Servers         []string `json:"servers"`
+}
+
+// A Route represents an NDP Route Information option.
+type Route struct {
+	Prefix               string `json:"prefix"`
+	Preference           string `json:"preference"`
+	RouteLifetimeSeconds int    `json:"route_lifetime_seconds"`
+}
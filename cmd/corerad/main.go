@@ -16,11 +16,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"time"
@@ -33,16 +37,26 @@ import (
 	"github.com/mdlayher/metricslite"
 	"github.com/mdlayher/sdnotify"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const cfgFile = "corerad.toml"
 
 func main() {
 	var (
-		cfgFlag  = flag.String("c", cfgFile, "path to configuration file")
+		cfgFlag  = flag.String("c", cfgFile, "path to configuration file, or an http or https URL to fetch it from")
 		initFlag = flag.Bool("init", false,
 			fmt.Sprintf("write out a default configuration file to %q and exit", cfgFile))
+
+		cacheFlag = flag.String("cache", "",
+			"path to a local cache of a remote configuration file, used if fetching the configuration fails")
+		timeoutFlag = flag.Duration("fetch-timeout", 10*time.Second,
+			"timeout for fetching a remote configuration file")
+		conformFlag = flag.String("conform", "",
+			"path to a JSON file of expected router advertisements to check the configuration against, then exit")
+		lintFlag = flag.String("lint", "",
+			"path to a configuration file to check for likely mistakes, then exit")
+		supervisedFlag = flag.Bool("supervised", false,
+			"indicates that a process supervisor restarts CoreRAD whenever it exits, which enables configuration reloads using the debug API")
 	)
 
 	flag.Usage = func() {
@@ -70,6 +84,14 @@ func main() {
 		return
 	}
 
+	if *lintFlag != "" {
+		if !lint(ll, *lintFlag, *timeoutFlag) {
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	// Enable systemd notifications if running under systemd Type=notify.
 	n, err := sdnotify.New()
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -80,18 +102,37 @@ func main() {
 	ll.Print(msg)
 	_ = n.Notify(sdnotify.Statusf(msg))
 
-	f, err := os.Open(*cfgFlag)
+	b, err := readConfig(ll, *cfgFlag, *cacheFlag, *timeoutFlag)
 	if err != nil {
-		ll.Fatalf("failed to open configuration file: %v", err)
+		ll.Fatal(err)
 	}
 
 	// Parse the config with this startup time as the CoreRAD epoch, which is
 	// used to control the deprecation of various RA parameters.
-	cfg, err := config.Parse(f, time.Now())
+	cfg, err := config.Parse(bytes.NewReader(b), time.Now())
 	if err != nil {
-		ll.Fatalf("failed to parse %q: %v", f.Name(), err)
+		ll.Fatalf("failed to parse %q: %v", *cfgFlag, err)
+	}
+
+	if *conformFlag != "" {
+		if !conform(ll, *cfg, *conformFlag) {
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	// Network namespaces are only verified on the machine which advertises
+	// within them.
+	for _, ifi := range cfg.Interfaces {
+		if ifi.Netns == "" {
+			continue
+		}
+
+		if err := system.CheckNetns(ifi.Netns); err != nil {
+			ll.Fatalf("%s: invalid network namespace: %v", ifi.Name, err)
+		}
 	}
-	_ = f.Close()
 
 	// Wait for signals (configurable per-platform) to shut down the server.
 	sigC := make(chan os.Signal, 1)
@@ -104,20 +145,180 @@ func main() {
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 	)
 
+	// Each interface's metrics are also registered to a separate registry so
+	// they may be served independently.
+	var (
+		ifaceMetrics = make(map[string]metricslite.Interface, len(cfg.Interfaces))
+		ifaceProm    = make(map[string]http.Handler, len(cfg.Interfaces))
+	)
+	for _, ifi := range cfg.Interfaces {
+		ireg := prometheus.NewPedanticRegistry()
+		ifaceMetrics[ifi.Name] = metricslite.NewPrometheus(ireg)
+		ifaceProm[ifi.Name] = crhttp.NewMetricsHandler(ireg, cfg.Debug.OpenMetrics)
+	}
+
 	var (
 		// Construct the types to produce a Context for the Server.
 		state = system.NewState()
-		mm    = corerad.NewMetrics(metricslite.NewPrometheus(reg), state, cfg.Interfaces)
+		mm    = corerad.NewMetrics(
+			corerad.PartitionMetrics(metricslite.NewPrometheus(reg), ifaceMetrics),
+			state,
+			cfg.Interfaces,
+		)
 
 		// Construct a Context and plumb it throughout the HTTP handler and
 		// Server.
 		cctx = corerad.NewContext(ll, mm, state)
 
-		h = crhttp.NewHandler(ll, state, *cfg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
 		s = corerad.NewServer(cctx)
+		h = crhttp.NewHandler(
+			ll,
+			state,
+			*cfg,
+			crhttp.NewMetricsHandler(reg, cfg.Debug.OpenMetrics),
+			ifaceProm,
+			s,
+		)
 	)
 
+	// Use any sockets passed by systemd socket activation in place of creating
+	// new ones.
+	files, err := system.ListenFiles()
+	if err != nil {
+		ll.Fatalf("failed to use socket activation files: %v", err)
+	}
+	s.Files = files
+
+	// Allow the debug API to validate a new configuration before triggering a
+	// reload. CoreRAD reloads by shutting down so that it is restarted with
+	// the new configuration, so this is only enabled when a process supervisor
+	// will restart it: otherwise, a reload would stop advertising entirely.
+	if *supervisedFlag {
+		s.Load = func() (*config.Config, error) {
+			b, err := readConfig(ll, *cfgFlag, *cacheFlag, *timeoutFlag)
+			if err != nil {
+				return nil, err
+			}
+
+			cfg, err := config.Parse(bytes.NewReader(b), time.Now())
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %q: %v", *cfgFlag, err)
+			}
+
+			return cfg, nil
+		}
+	}
+
 	if err := s.Serve(sigC, n, s.BuildTasks(*cfg, h)); err != nil {
 		ll.Fatalf("failed to run: %v", err)
 	}
 }
+
+// conform checks the router advertisements built from cfg against the
+// expectations file at path, and reports whether all assertions passed.
+func conform(ll *log.Logger, cfg config.Config, path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		ll.Fatalf("failed to open expectations file: %v", err)
+	}
+	defer f.Close()
+
+	for _, iface := range cfg.Interfaces {
+		if !iface.Advertise {
+			continue
+		}
+
+		// Interfaces need not exist on the machine performing the check, but
+		// plugins which depend on interface state will then build incomplete
+		// options.
+		ifi, err := net.InterfaceByName(iface.Name)
+		if err != nil {
+			ll.Printf("%s: interface not found, plugins will be prepared without its state: %v",
+				iface.Name, err)
+			ifi = &net.Interface{Name: iface.Name}
+		}
+
+		for _, p := range iface.AllPlugins() {
+			if err := p.Prepare(ifi); err != nil {
+				ll.Fatalf("%s: failed to prepare plugin %q: %v", iface.Name, p.Name(), err)
+			}
+		}
+	}
+
+	as, err := crhttp.Conform(f, cfg.Interfaces)
+	if err != nil {
+		ll.Fatalf("failed to check conformance: %v", err)
+	}
+
+	ok := true
+	for _, a := range as {
+		fmt.Println(a)
+		ok = ok && a.OK
+	}
+
+	return ok
+}
+
+// lint reports any findings for the configuration file at path, and reports
+// whether the configuration is free of errors.
+func lint(ll *log.Logger, path string, timeout time.Duration) bool {
+	b, err := readConfig(ll, path, "", timeout)
+	if err != nil {
+		ll.Fatal(err)
+	}
+
+	ok := true
+	for _, f := range config.Lint(bytes.NewReader(b), time.Now()) {
+		fmt.Println(f)
+		ok = ok && f.Severity != config.Error
+	}
+
+	return ok
+}
+
+// readConfig reads the configuration file at path. If path is a URL, the
+// configuration is fetched within timeout and written to cache if set, or
+// read from cache if the fetch fails.
+func readConfig(ll *log.Logger, path, cache string, timeout time.Duration) ([]byte, error) {
+	if !config.IsRemote(path) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open configuration file: %v", err)
+		}
+
+		return b, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	b, ferr := config.Fetch(ctx, nil, path)
+	if ferr == nil {
+		if cache != "" {
+			if err := config.WriteCache(cache, b); err != nil {
+				// The fetched configuration is still usable.
+				ll.Printf("failed to cache configuration file: %v", err)
+			}
+		}
+
+		return b, nil
+	}
+
+	if cache == "" {
+		return nil, fmt.Errorf("failed to fetch configuration file: %v", ferr)
+	}
+
+	fi, err := os.Stat(cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch configuration file: %v, and no cache is available: %v", ferr, err)
+	}
+
+	b, err = ioutil.ReadFile(cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch configuration file: %v, and failed to read cache: %v", ferr, err)
+	}
+
+	ll.Printf("WARNING: failed to fetch configuration file: %v, starting with cached configuration %q last updated %s ago",
+		ferr, cache, time.Since(fi.ModTime()).Round(time.Second))
+	return b, nil
+}
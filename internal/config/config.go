@@ -17,62 +17,183 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/mdlayher/corerad/internal/plugin"
+	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
+	"inet.af/netaddr"
 )
 
 //go:generate embed file -var Default --source default.toml
 
 // Default is the toml representation of the default configuration.
-var Default = "# %s configuration file\n\n# All duration values are specified in Go time.ParseDuration format:\n# https://golang.org/pkg/time/#ParseDuration.\n\n# Interfaces which will be used to serve IPv6 NDP router advertisements.\n[[interfaces]]\nname = \"eth0\"\n\n# Indicates whether or not this interface will be used exclusively for\n# monitoring incoming NDP traffic. monitor provides limited functionality in\n# comparison to advertise and is mostly useful for verifying the status and\n# health of upstream network links where it would not be appropriate to send\n# router advertisements.\n#\n# This option is mutually exclusive with advertise, and both must not be set to\n# true on the same interface.\nmonitor = false\n\n# AdvSendAdvertisements: indicates whether or not this interface will send\n# periodic router advertisements and respond to router solicitations.\n#\n# Must be set to true to enable serving on this interface. This option is\n# mutually exclusive with monitor, and both must not be set to true on the same\n# interface.\nadvertise = false\n\n# All other interface parameters in this section can be removed to simplify\n# configuration with sane defaults.\n\n# Indicates whether or not this interface will have verbose logging mode enabled.\n# By default, CoreRAD prefers to use metrics to communicate non-error conditions,\n# while errors are communicated with both metrics and logs. Setting this to true\n# will enable more informational logging output.\nverbose = false\n\n# MaxRtrAdvInterval: the maximum time between sending unsolicited multicast\n# router advertisements. Must be between 4 and 1800 seconds.\nmax_interval = \"600s\"\n\n# MinRtrAdvInterval: the minimum time between sending unsolicited multicast\n# router advertisements. Must be between 3 and (.75 * max_interval) seconds.\n# An empty string or the value \"auto\" will compute a sane default.\nmin_interval = \"auto\"\n\n# AdvManagedFlag: indicates if hosts should request address configuration from a\n# DHCPv6 server.\nmanaged = false\n\n# AdvOtherConfigFlag: indicates if additional configuration options are\n# available from a DHCPv6 server.\nother_config = false\n\n# AdvReachableTime: indicates how long a node should treat a neighbor as\n# reachable. 0 or empty string mean this value is unspecified by this router.\nreachable_time = \"0s\"\n\n# AdvRetransTimer: indicates how long a node should wait before retransmitting\n# neighbor solicitations. 0 or empty string mean this value is unspecified by\n# this router.\nretransmit_timer = \"0s\"\n\n# AdvCurHopLimit: indicates the value that should be placed in the Hop Limit\n# field in the IPv6 header. Must be between 0 and 255. 0 means this value\n# is unspecified by this router.\nhop_limit = 64\n\n# AdvDefaultLifetime: the value sent in the router lifetime field. Must be\n# 0 or between max_interval and 9000 seconds. An empty string is treated as 0,\n# or the value \"auto\" will compute a sane default.\ndefault_lifetime = \"auto\"\n\n# AdvLinkMTU: attaches a NDP MTU option to the router advertisement, so clients\n# can set their link MTU as recommended by the router. 0 means this value is\n# unspecified by this router.\nmtu = 0\n\n# AdvSourceLLAddress: attaches a NDP source link-layer address option to the\n# router advertisement. Defaults to true when omitted.\nsource_lla = true\n\n# Indicates whether or not CoreRAD will issue multicast router advertisements.\n# In this mode, machines on this interface's LAN must issue individual router\n# solicitations in order to receive router advertisements.\nunicast_only = false\n\n# Indicates the preference of this router over other default routers. Only the\n# values \"low\", \"medium\", and \"high\" are allowed. An empty string is treated as\n# \"medium\".\npreference = \"medium\"\n\n  # Prefix: attaches a NDP Prefix Information option to the router advertisement.\n  [[interfaces.prefix]]\n  # Serve Prefix Information options for each IPv6 prefix on this interface\n  # configured with a /64 CIDR mask. Only /64 is allowed for this special case.\n  prefix = \"::/64\"\n\n  # Specifies on-link and autonomous address autoconfiguration (SLAAC) flags\n  # for this prefix. Both default to true.\n  on_link = true\n  autonomous = true\n\n  # Specifies the preferred and valid lifetimes for this prefix. The preferred\n  # lifetime must not exceed the valid lifetime. By default, the preferred\n  # lifetime is 4 hours and the valid lifetime is 24 hours. \"auto\" uses the\n  # defaults. \"infinite\" means this prefix should be used forever.\n  preferred_lifetime = \"auto\"\n  valid_lifetime = \"auto\"\n\n  # Specifies whether this prefix should be deprecated. When true, the preferred\n  # and valid lifetime values will be interpreted as deadlines (added to the\n  # current time) for clients using this prefix. The preferred and valid\n  # lifetime values will count down to zero until CoreRAD is restarted,\n  # at which point the deprecated prefix can be completely removed from its\n  # configuration. Defaults to false.\n  deprecated = false\n\n  # Alternatively, serve an explicit IPv6 prefix.\n  [[interfaces.prefix]]\n  prefix = \"2001:db8::/64\"\n\n  # Route: attaches a NDP Route Information option to the router advertisement.\n  [[interfaces.route]]\n  prefix = \"2001:db8:ffff::/64\"\n\n  # Indicates the preference of this route over other routes advertised by\n  # other routers. Only the values \"low\", \"medium\", and \"high\" are allowed. An\n  # empty string is treated as \"medium\".\n  preference = \"medium\"\n\n  # Specifies the lifetime of this prefix. By default, the lifetime is 24 hours.\n  # \"auto\" uses the defaults. \"infinite\" means this route should be used forever.\n  lifetime = \"auto\"\n\n  # RDNSS: attaches a NDP Recursive DNS Servers option to the router advertisement.\n  [[interfaces.rdnss]]\n  # The maximum time these RDNSS addresses may be used for name resolution.\n  # An empty string or 0 means these servers should no longer be used.\n  # \"auto\" will compute a sane default. \"infinite\" means these servers should\n  # be used forever.\n  lifetime = \"auto\"\n  servers = [\"2001:db8::1\", \"2001:db8::2\"]\n\n  # DNSSL: attaches a NDP DNS Search List option to the router advertisement.\n  [[interfaces.dnssl]]\n  # The maximum time these DNSSL domain names may be used for name resolution.\n  # An empty string or 0 means these search domains should no longer be used.\n  # \"auto\" will compute a sane default. \"infinite\" means these search domains\n  # should be used forever.\n  lifetime = \"auto\"\n  domain_names = [\"foo.example.com\"]\n\n# Enable or disable the debug HTTP server for facilities such as Prometheus\n# metrics and pprof support.\n#\n# Warning: do not expose pprof on an untrusted network!\n[debug]\naddress = \"localhost:9430\"\nprometheus = false\npprof = false\n"
+var Default = "# %s configuration file\n\n# All duration values are specified in Go time.ParseDuration format:\n# https://golang.org/pkg/time/#ParseDuration.\n\n# The maximum number of interfaces which may advertise. Advertising interfaces\n# beyond this limit, in configuration order, are not started: they are logged,\n# counted in metrics, and reported as rejected by the debug API. This guards\n# against resource exhaustion from a runaway configuration. 0 uses the default.\nmax_advertisers = 1024\n\n# Indicates whether or not unsolicited multicast router advertisements are paced\n# across all advertising interfaces. By default, each interface independently\n# randomizes its advertising interval, but interfaces which were started at the\n# same time can still send in bursts. When true, the initial router\n# advertisements are sent as usual, and then later router advertisements are\n# delayed as needed so that they are spread evenly over the smallest\n# min_interval of all interfaces, without exceeding any interface's\n# max_interval. The delay and the resulting send times are reported in metrics.\npace_multicast = false\n\n# The maximum lifetime which may be advertised by any router advertisement\n# field or option: the router lifetime, prefix valid and preferred lifetimes,\n# and route, RDNSS, and DNSSL lifetimes. Larger lifetimes, including \"infinite\",\n# are clamped to this value as each router advertisement is built, and each\n# clamped lifetime is logged and counted in metrics. This guards against a typo\n# such as \"99999h\" producing a lifetime which is difficult to revoke from hosts.\n# An empty string disables the clamp.\nmax_lifetime = \"\"\n\n# Indicates whether or not any configured lifetime may be \"infinite\". When true,\n# configurations which specify an infinite lifetime are rejected.\nforbid_infinite_lifetimes = false\n\n# Indicates whether or not autonomous prefixes must have a /64 length. Hosts\n# only use SLAAC to configure addresses from /64 prefixes, per RFC 4862, so an\n# autonomous prefix of any other length is usually a mistake. By default, such\n# prefixes are logged as warnings. When true, configurations which specify an\n# autonomous prefix which is not /64 are rejected. Prefixes which are not\n# autonomous may have any length.\nstrict_autonomous_prefixes = false\n\n# Interfaces which will be used to serve IPv6 NDP router advertisements.\n[[interfaces]]\nname = \"eth0\"\n\n# Alternatively, names may list several interfaces which share this block's\n# configuration, such as for redundant links which should carry the same router\n# advertisements. Each interface is served independently with its own source\n# address, metrics, and ::/N prefix expansion. Mutually exclusive with name.\n# names = [\"eth0\", \"eth1\"]\n\n# Indicates whether or not this interface will be used exclusively for\n# monitoring incoming NDP traffic. monitor provides limited functionality in\n# comparison to advertise and is mostly useful for verifying the status and\n# health of upstream network links where it would not be appropriate to send\n# router advertisements.\n#\n# This option is mutually exclusive with advertise, and both must not be set to\n# true on the same interface.\nmonitor = false\n\n# AdvSendAdvertisements: indicates whether or not this interface will send\n# periodic router advertisements and respond to router solicitations.\n#\n# Must be set to true to enable serving on this interface. This option is\n# mutually exclusive with monitor, and both must not be set to true on the same\n# interface.\nadvertise = false\n\n# All other interface parameters in this section can be removed to simplify\n# configuration with sane defaults.\n\n# Indicates whether or not this interface will have verbose logging mode enabled.\n# By default, CoreRAD prefers to use metrics to communicate non-error conditions,\n# while errors are communicated with both metrics and logs. Setting this to true\n# will enable more informational logging output.\nverbose = false\n\n# Indicates whether or not NDP messages received with an IPv6 hop limit other\n# than 255 will be processed. RFC 4861 requires that such messages be dropped\n# to prevent off-link spoofing, so this should only be enabled for debugging\n# in unusual environments.\nlenient_hop_limit = false\n\n# Indicates whether or not CoreRAD will bind its NDP socket to this interface\n# using SO_BINDTODEVICE, and verify the binding, before sending or receiving\n# traffic. This is useful on multi-homed hosts to ensure router advertisements\n# never egress an unintended interface. Where SO_BINDTODEVICE is not supported,\n# traffic is only scoped to the interface by the link-local source address,\n# which is logged. Whether the socket is bound is reported in metrics. Defaults\n# to false.\nbind_to_device = false\n\n# The absolute path to a network namespace, such as one created by \"ip netns\",\n# which contains this interface. CoreRAD enters the namespace to look up the\n# interface, create its NDP socket, and inspect its addresses and sysctls, so\n# a single daemon can advertise on interfaces in several containers. Any\n# interfaces referenced by this interface's plugins must also exist within the\n# namespace. Linux only. Defaults to the namespace CoreRAD runs in.\n# netns = \"/var/run/netns/blue\"\n\n# Optional: this interface is a VLAN sub-interface of a trunk interface, so that\n# a single physical interface can serve many segments, each with its own\n# interface block and router advertisements. The VLAN ID must be between 1 and\n# 4094. Unless name is also set, the sub-interface is named after the trunk\n# and VLAN ID, such as \"eth0.10\". Each time the sub-interface is initialized,\n# CoreRAD verifies that it is a VLAN sub-interface of the trunk with that VLAN\n# ID (Linux only), and router advertisements are sent from the sub-interface\n# using its own MAC address. The sub-interfaces must be created separately,\n# such as with \"ip link add link eth0 name eth0.10 type vlan id 10\";\n# wait_for_interface can be used if they are created after CoreRAD starts. The\n# VLAN mapping is reported by the debug API's /api/interfaces route.\n# trunk = \"eth0\"\n# vlan = 10\n\n# Indicates whether or not CoreRAD will wait for this interface to be created\n# if it does not exist, such as a VPN tunnel which is created after CoreRAD\n# starts, rather than failing shortly after startup. While waiting, the\n# interface is reported as waiting by the HTTP API and metrics, and CoreRAD\n# begins serving the interface once it appears. If the interface is later\n# removed, CoreRAD waits for it to be created again. Defaults to false.\nwait_for_interface = false\n\n# Indicates whether or not CoreRAD will track the operational state of this\n# interface so that prefixes are never advertised on a dead link. When the link\n# goes down, CoreRAD immediately stops advertising and waits for the link to\n# come back up, rather than eventually giving up. Once the link has stayed up\n# for link_hysteresis (an empty string computes a default of 2s), CoreRAD\n# reinitializes the interface and resumes with the initial sequence of fast\n# router advertisements, so that rapid flapping does not cause bursts of\n# router advertisements. The link state is reported by the HTTP API and its\n# transitions are counted in metrics. The hysteresis must be between 100ms and\n# 1m. Defaults to false.\ntrack_link_state = false\nlink_hysteresis = \"\"\n\n# The grace period during which temporary errors receiving NDP messages on this\n# interface are tolerated. By default, a few temporary errors are retried before\n# the interface fails and is reinitialized. When set, temporary errors are\n# retried indefinitely within the grace period, and only once they persist\n# beyond it is the interface marked as degraded: this is logged, reported in\n# metrics, and the interface is reported as not ready by the HTTP API until a\n# message is received again. Errors which persist beyond the grace period are\n# then retried a few times before the interface is reinitialized. The grace\n# period must be between 100ms and 5m.\nreceive_grace_period = \"\"\n\n# Specifies how the NDP socket's link-local source address is selected when\n# this interface has several, such as a manually added address alongside the\n# EUI-64 address. \"auto\" uses the first address reported by the operating\n# system, \"lowest\" and \"highest\" select the numerically lowest or highest\n# address, and a literal IPv6 link-local address (such as \"fe80::1\") selects\n# that address, waiting for it to be assigned if necessary. Unless \"auto\" finds\n# a single address, the candidates and the chosen address are logged each time\n# the interface is initialized.\nsource_address = \"auto\"\n\n# Indicates whether or not this interface will run in shadow mode. In shadow\n# mode, CoreRAD runs all of its timers and answers router solicitations as if\n# advertise were enabled, but each router advertisement is logged and counted\n# in metrics rather than being sent, and IPv6 autoconfiguration is left\n# unchanged on the interface. This is useful for validating a configuration\n# against live traffic on a production link. Requires advertise = true.\nshadow = false\n\n# Indicates whether or not this interface starts withdrawn, such as for a staged\n# rollout. A withdrawn interface is initialized and sends router advertisements,\n# but with a router lifetime of zero and no prefixes, so hosts will not use this\n# router. The interface can be promoted to full advertising, or withdrawn again,\n# using the debug API's POST /api/interfaces/{name}/promote and\n# /api/interfaces/{name}/withdraw routes, which require a debug token.\n# Requires advertise = true.\nstart_withdrawn = false\n\n# Indicates whether or not this interface is expected to be IPv6-only. When\n# true, CoreRAD checks the interface for IPv4 addresses each time it is\n# initialized, and logs a warning and reports the number of IPv4 addresses in\n# metrics if any are found. On a dual-stack link, hosts may also be configured\n# by DHCPv4, so the managed and other_config flags should be checked for\n# consistency with it. This check is advisory only. Defaults to false so that\n# intentionally dual-stack deployments are not warned.\nipv6_only = false\n\n# MaxRtrAdvInterval: the maximum time between sending unsolicited multicast\n# router advertisements. Must be between 4 and 1800 seconds.\nmax_interval = \"600s\"\n\n# MinRtrAdvInterval: the minimum time between sending unsolicited multicast\n# router advertisements. Must be between 3 and (.75 * max_interval) seconds.\n# An empty string or the value \"auto\" will compute a sane default.\nmin_interval = \"auto\"\n\n# MAX_INITIAL_RTR_ADVERT_INTERVAL and MAX_INITIAL_RTR_ADVERTISEMENTS: when an\n# interface starts advertising, and when it is promoted after being withdrawn,\n# the delays after its first initial_count unsolicited multicast router\n# advertisements are capped at initial_interval so that hosts discover the\n# router quickly. Afterward, the steady-state min_interval and max_interval\n# apply. Lower values help hosts on a lossy or constrained link converge\n# faster, and higher values reduce the initial burst. initial_interval must be\n# between 3 seconds and max_interval, and initial_count must be between 1 and\n# 10.\ninitial_interval = \"16s\"\ninitial_count = 3\n\n# AdvManagedFlag: indicates if hosts should request address configuration from a\n# DHCPv6 server.\nmanaged = false\n\n# Optional: instead of a static managed flag, only set the managed flag while\n# an address within this IPv6 prefix is configured on the interface, and clear\n# it otherwise. This keeps router advertisements accurate in mixed SLAAC and\n# DHCPv6 networks while a managed prefix comes and goes, such as during WAN\n# transitions. Mutually exclusive with managed = true. Unset by default.\n# managed_prefix = \"2001:db8::/48\"\n\n# AdvOtherConfigFlag: indicates if additional configuration options are\n# available from a DHCPv6 server.\nother_config = false\n\n# Proxy: sets the neighbor discovery proxy (P) flag, per RFC 4389, for a router\n# which proxies neighbor discovery between this interface and another link,\n# such as to extend a single /64 across links without a routed prefix. CoreRAD\n# only sets the flag: the proxying itself must be performed by the kernel (the\n# proxy_ndp sysctl) or a separate neighbor discovery proxy daemon. Each time the\n# interface is initialized, CoreRAD logs a warning if the interface is not\n# forwarding IPv6, or if neither proxy_ndp nor promiscuous or all-multicast mode\n# is enabled (Linux only). Defaults to false.\nproxy = false\n\n# EXPERIMENTAL: sets the Mobile IPv6 home agent (H) flag, per RFC 6275, for a\n# router which also acts as a Mobile IPv6 home agent on this link. CoreRAD only\n# sets the flag: the home agent itself must be provided by a separate daemon.\n# Required by prefix router_address. Defaults to false.\nhome_agent = false\n\n# AdvReachableTime: indicates how long a node should treat a neighbor as\n# reachable. 0 or empty string mean this value is unspecified by this router.\nreachable_time = \"0s\"\n# Optional: instead of a fixed reachable_time, choose a random value between\n# these bounds for each router advertisement.\n# reachable_time_min = \"20s\"\n# reachable_time_max = \"40s\"\n\n# AdvRetransTimer: indicates how long a node should wait before retransmitting\n# neighbor solicitations. 0 or empty string mean this value is unspecified by\n# this router.\nretransmit_timer = \"0s\"\n# Optional: instead of a fixed retransmit_timer, choose a random value between\n# these bounds for each router advertisement.\n# retransmit_timer_min = \"1s\"\n# retransmit_timer_max = \"2s\"\n\n# AdvCurHopLimit: indicates the value that should be placed in the Hop Limit\n# field in the IPv6 header. Must be between 0 and 255. 0 means this value\n# is unspecified by this router.\nhop_limit = 64\n\n# Indicates whether or not CoreRAD will raise its advertised hop limit to match\n# the highest hop limit observed in router advertisements from other routers\n# on this link, as RFC 4861 recommends using the larger value when routers\n# disagree. Each router's hop limit is adopted until its router lifetime\n# expires without a new router advertisement, or it advertises a router\n# lifetime of zero, after which hop_limit is advertised again. Each change is\n# logged. Off by default since it changes the advertised value.\nadopt_neighbor_hop_limit = false\n\n# AdvDefaultLifetime: the value sent in the router lifetime field. Must be\n# 0 or between max_interval and 9000 seconds. An empty string is treated as 0,\n# or the value \"auto\" will compute a sane default.\ndefault_lifetime = \"auto\"\n\n# An optional router lifetime which is advertised instead of default_lifetime\n# when the interface starts advertising or is promoted after withdrawal, so\n# that hosts do not immediately rely on a router whose upstream may still be\n# stabilizing. The router lifetime ramps up linearly from this value to\n# default_lifetime over the first initial_count unsolicited multicast router\n# advertisements, and solicited router advertisements carry the current value.\n# Must be at least 1 second and less than a non-zero default_lifetime, and\n# cannot be used in unicast-only mode. Empty by default, which disables the\n# ramp.\ninitial_default_lifetime = \"\"\n\n# AdvLinkMTU: attaches a NDP MTU option to the router advertisement, so clients\n# can set their link MTU as recommended by the router. Must be 0 or between 1280\n# and 65536. 0 means this value is unspecified by this router, and the MTU option\n# is omitted rather than advertising an MTU of 0. Hosts may continue to use an\n# MTU learned from an earlier router advertisement, or from other routers on\n# the link which still advertise one.\nmtu = 0\n\n# Optional: instead of a fixed mtu, advertise the interface's MTU less a fixed\n# number of bytes of encapsulation overhead, such as for tunnel interfaces. The\n# interface MTU is re-read each time the interface is (re)initialized. If the\n# result is less than the IPv6 minimum MTU of 1280, such as when a misbehaving\n# tool shrinks the interface MTU, 1280 is advertised instead and the clamp is\n# logged and counted in metrics. Mutually exclusive with mtu. Unset by default.\n# mtu_overhead = 80\n\n# Optional: seed hop_limit, mtu, reachable_time, and retransmit_timer from the\n# values used by the kernel's own IPv6 stack for this interface, so advertised\n# values remain consistent with the router. On Linux, these are read from the\n# net.ipv6.conf.<interface>.{hop_limit,mtu} and\n# net.ipv6.neigh.<interface>.{base_reachable_time_ms,retrans_time_ms} sysctls\n# each time the interface is (re)initialized, and logged. Parameters which are\n# explicitly set, including by a nonzero mtu or mtu_overhead, are not seeded,\n# so remove them from this file to use the kernel's values. As with\n# mtu_overhead, an MTU less than 1280 is clamped to 1280. Has no effect on\n# other operating systems. Unset by default.\n# sysctl_defaults = true\n\n# AdvSourceLLAddress: attaches a NDP source link-layer address option to the\n# router advertisement. Defaults to true when omitted.\nsource_lla = true\n\n# When source_lla is true, indicates whether the source link-layer address\n# option is also attached to unsolicited multicast router advertisements. When\n# false, the option is only attached to solicited router advertisements, which\n# keeps periodic multicast router advertisements lean while still allowing a\n# soliciting host to populate its neighbor cache immediately, without first\n# performing neighbor discovery for this router. Defaults to true when omitted.\nsource_lla_unsolicited = true\n\n# Advanced: when source_lla is true, overrides the link-layer address in the\n# source link-layer address option with this unicast MAC address, for bridged,\n# virtualized, or L2 overlay setups where hosts must not resolve this router to\n# the interface's own hardware address. An empty string uses the interface's\n# hardware address.\nsource_lla_override = \"\"\n\n# Experimental: attaches a NDP Nonce option (RFC 3971) with a random value to\n# unsolicited router advertisements, and echoes the nonce from a router\n# solicitation in solicited router advertisements. Defaults to false.\nnonce = false\n\n# Indicates whether or not CoreRAD will issue multicast router advertisements.\n# In this mode, machines on this interface's LAN must issue individual router\n# solicitations in order to receive router advertisements.\nunicast_only = false\n\n# Experimental: when set, unsolicited multicast router advertisements are only\n# sent while at least one router solicitation has been received within this\n# window. Otherwise the interface goes quiet but still responds to router\n# solicitations, reducing multicast traffic on idle links. This deviates from\n# the periodic advertising required by RFC 4861, so hosts which never solicit\n# may not learn of changes to this router's configuration. Must be at least\n# max_interval, and cannot be used with unicast_only. An empty string disables\n# on-demand mode.\non_demand_window = \"\"\n\n# Router solicitations sent from the IPv6 unspecified address (::) must be\n# answered with a multicast router advertisement. By default, these solicited\n# multicast router advertisements share rate limiting with unsolicited multicast\n# router advertisements. When true, solicited multicast router advertisements\n# are rate limited separately so hosts performing address configuration are not\n# delayed by the unsolicited schedule.\nseparate_solicited_multicast = false\n\n# The number of router advertisements sent in response to each router\n# solicitation answered with a unicast router advertisement, such as to improve\n# delivery on lossy wireless links. Additional responses are spaced apart by\n# solicited_send_interval (an empty string computes a default of 100ms), and\n# are counted in metrics. Solicited multicast router advertisements are always\n# sent once, so the minimum delay between multicast router advertisements is\n# still respected. Must be between 1 and 5, and the interval must be between\n# 10ms and 1s.\nsolicited_sends = 1\nsolicited_send_interval = \"\"\n\n# The number of times a failed router advertisement transmission is retried,\n# with backoff, before CoreRAD gives up and reinitializes the interface.\n# Failures which are retried are logged and counted in metrics. Must be between\n# 0 and 100. 0 means the first failure is fatal.\ntransmit_retries = 3\n\n# Router advertisements from other routers on this link which disagree with\n# ours are logged and counted in metrics as soon as they are received. When a\n# router continues to disagree on the same field for at least this window, the\n# conflict is considered persistent: it is reported separately in logs and\n# metrics. Both recent and persistent conflicts are listed by the debug API's\n# /api/conflicts route, which requires a debug token. A router which quickly\n# corrects itself is never reported as persistent. An empty string computes a\n# default of 3 * max_interval.\nconflict_window = \"\"\n\n# When verbose is true, the options of each router advertisement sent on this\n# interface are logged, including prefixes expanded from ::/N. Changes to the\n# options are logged immediately, but unchanged options are logged at most once\n# per this interval to avoid flooding logs. An empty string computes a default\n# of 1 minute.\ndebug_log_interval = \"\"\n\n# The maximum size in bytes of router advertisements sent on this interface,\n# including the ICMPv6 header but excluding the IPv6 header, such as for links\n# where fragmented router advertisements would be dropped. Options are added in\n# priority order (prefixes, routes, RDNSS, DNSSL, MTU, nonce, captive portal, and\n# source link-layer address) until the next would exceed the budget; it and any\n# later options are dropped, and the dropped plugins are logged, counted in\n# metrics, and listed by the debug API. Must be 0 or between 16 and 65535. 0\n# means no limit.\nmax_size = 0\n\n# The sizes in bytes of the receive and send buffers of this interface's NDP\n# socket, such as to avoid dropping router solicitations on links where many\n# hosts solicit at once. The sizes are applied as the socket is created and the\n# effective sizes are logged; the operating system may cap them, such as at the\n# net.core.rmem_max and net.core.wmem_max sysctls on Linux. Where available,\n# packets dropped by the socket's receive buffer are counted in metrics. Must be\n# 0 or between 4096 and 67108864. 0 uses the operating system's default.\nreceive_buffer = 0\nsend_buffer = 0\n\n# Indicates the preference of this router over other default routers. Only the\n# values \"low\", \"medium\", and \"high\" are allowed. An empty string is treated as\n# \"medium\".\npreference = \"medium\"\n\n  # Optional: checks for upstream connectivity by watching for an IPv6 default\n  # route in the main routing table. While the upstream is unavailable, router\n  # advertisements are sent with a router lifetime of 0 so that hosts fail over\n  # to other default routers, but all other options such as prefixes are still\n  # advertised. The upstream is checked every interval (default \"5s\"), and the\n  # health state changes only after hysteresis (default 3) consecutive checks\n  # disagree with the current state. Detecting default routes relies on route\n  # netlink, and is only supported on Linux. Unset by default.\n  # [interfaces.upstream]\n  # interval = \"5s\"\n  # hysteresis = 3\n\n  # Optional: only advertises this router as a default router while it is the\n  # VRRP master, so that both routers of a VRRP pair do not advertise\n  # themselves simultaneously. While this router is the VRRP backup, router\n  # advertisements are sent with a router lifetime of 0, but all other options\n  # are still advertised. Specify exactly one of address, the VRRP virtual IP\n  # address which is assigned to the interface while this router is the master,\n  # or state_file, a file containing \"MASTER\" while this router is the master,\n  # such as one written by a keepalived notify script. The state is checked\n  # every interval (default \"1s\"), and the role changes only after hysteresis\n  # (default 2) consecutive checks disagree with the current role. Unset by\n  # default.\n  # [interfaces.vrrp]\n  # address = \"fe80::1\"\n  # Or: state_file = \"/run/keepalived/eth0.state\"\n  # interval = \"1s\"\n  # hysteresis = 2\n\n  # Optional: attaches a NDP Captive-Portal option (RFC 8910) to the router\n  # advertisement. Per RFC 8910, api is the URL of the captive portal API\n  # (RFC 8908) which returns JSON describing the portal, rather than the\n  # user-facing web page as in the obsoleted RFC 7710. Some clients require\n  # HTTPS and ignore plaintext URLs, so strict (default false) rejects any URL\n  # which does not use HTTPS. Unset by default.\n  # [interfaces.captive_portal]\n  # api = \"https://portal.example.com/api\"\n  # strict = true\n\n  # EXPERIMENTAL: attaches an arbitrary NDP option with the specified numeric\n  # type to the router advertisement. The value is set with either hex or\n  # base64, and must pad the option to a multiple of 8 octets including the\n  # 2 octet type and length header. Beyond this framing, CoreRAD does not\n  # validate the contents of the option, so clients may reject or misinterpret\n  # it. Types handled by other configuration are not allowed. Unset by default.\n  # [[interfaces.raw_option]]\n  # type = 253\n  # hex = \"000102030405\"\n\n  # Prefix: attaches a NDP Prefix Information option to the router advertisement.\n  [[interfaces.prefix]]\n  # Serve Prefix Information options for each IPv6 prefix on this interface\n  # configured with a /64 CIDR mask. Only /64 is allowed for this special case.\n  prefix = \"::/64\"\n\n  # Specifies on-link and autonomous address autoconfiguration (SLAAC) flags\n  # for this prefix. Both default to true.\n  on_link = true\n  autonomous = true\n\n  # A preset for networks where hosts acquire addresses using DHCPv6: the\n  # prefix is advertised as on-link but not autonomous, so hosts can reach the\n  # subnet directly but do not configure SLAAC addresses. Mutually exclusive\n  # with on_link and autonomous. Typically used with managed = true.\n  # dhcpv6 = true\n\n  # EXPERIMENTAL: for Mobile IPv6 home agents, sets the router address (R) flag\n  # (RFC 6275) and advertises the full address of this interface within the\n  # prefix instead of the prefix itself. If the interface has several addresses\n  # within the prefix, the numerically lowest stable address is advertised, and\n  # temporary addresses are skipped where they can be detected. Requires the\n  # interface's home_agent option. Defaults to false.\n  # router_address = true\n\n  # Indicates whether or not CoreRAD will verify that combining this autonomous\n  # prefix with the EUI-64 interface identifier of this interface produces a\n  # usable address, such as one which does not conflict with a manually\n  # configured address with a different prefix length. For ::/64, each prefix\n  # it expands to is verified. Any problems are logged as warnings when the\n  # interface is initialized and never prevent advertising. Only permitted for\n  # autonomous prefixes. Defaults to false.\n  # verify_eui64 = true\n\n  # Specifies the preferred and valid lifetimes for this prefix. The preferred\n  # lifetime must not exceed the valid lifetime. By default, the preferred\n  # lifetime is 4 hours and the valid lifetime is 24 hours. \"auto\" uses the\n  # defaults. \"infinite\" means this prefix should be used forever.\n  preferred_lifetime = \"auto\"\n  valid_lifetime = \"auto\"\n\n  # Optional: specifies alternate preferred and valid lifetimes for prefixes\n  # inferred from ::/64 when every interface address within that prefix is a\n  # temporary address (such as an RFC 4941 privacy address), so that stable\n  # prefixes can use longer lifetimes. Both must be set together, and neither\n  # may be \"auto\". Detecting temporary addresses relies on route netlink, and\n  # is only supported on Linux. Unset by default.\n  # temporary_preferred_lifetime = \"30m\"\n  # temporary_valid_lifetime = \"1h\"\n\n  # Specifies the number of consecutive failures to fetch interface addresses\n  # which will be tolerated while inferring prefixes from ::/64. Tolerated\n  # failures are logged, and the prefixes from the last successful fetch are\n  # advertised instead. 0 means any failure will reinitialize the advertiser.\n  # Only valid for ::/64. Defaults to 0.\n  max_address_failures = 0\n\n  # Optional: prefixes which are never advertised while inferring prefixes from\n  # ::/64, such as a management prefix. Any inferred prefix contained within one\n  # of these prefixes is skipped, and in verbose mode, each skipped prefix is\n  # logged. Only valid for ::/64. Unset by default.\n  # exclude_prefixes = [\"2001:db8:ffff::/48\"]\n\n  # Specifies whether this prefix should be deprecated. When true, the preferred\n  # and valid lifetime values will be interpreted as deadlines (added to the\n  # current time) for clients using this prefix. The preferred and valid\n  # lifetime values will count down to zero until CoreRAD is restarted,\n  # at which point the deprecated prefix can be completely removed from its\n  # configuration. Defaults to false.\n  deprecated = false\n\n  # Alternatively, serve an explicit IPv6 prefix.\n  [[interfaces.prefix]]\n  prefix = \"2001:db8::/64\"\n\n  # Alternatively, serve a ::/64 prefix derived from the IPv6 prefixes on\n  # another interface, such as a prefix delegated to a WAN interface using\n  # DHCPv6-PD. subnet selects which /64 within each upstream prefix is\n  # advertised (default: 0). The advertisement is updated immediately when the\n  # upstream interface's addresses change. When an upstream prefix is no longer\n  # available, its derived prefix is advertised with zero lifetimes so hosts\n  # stop using it. This prefix accepts the same options as ::/64, except\n  # deprecated, temporary lifetimes, and max_address_failures. Unset by default.\n  # [[interfaces.prefix]]\n  # prefix = \"::/64\"\n  # interface = \"eth0\"\n  # subnet = 1\n\n  # Optional: a renumbering plan which gracefully moves hosts from an old\n  # prefix to a new prefix (RFC 4192). Before start (an RFC 3339 timestamp),\n  # only the old prefix is advertised. From start onward, the new prefix is\n  # advertised and the old prefix is deprecated: its lifetimes count down so\n  # that it is no longer preferred and then no longer valid by the end of\n  # window (default: the old prefix's valid lifetime). The old and new tables\n  # accept the same options as an explicit prefix, except deprecated. The\n  # progress of each plan is reported by the debug API. Unset by default.\n  # [[interfaces.renumber]]\n  # start = \"2020-01-01T00:00:00Z\"\n  # window = \"24h\"\n  #   [interfaces.renumber.old]\n  #   prefix = \"2001:db8:1::/64\"\n  #   [interfaces.renumber.new]\n  #   prefix = \"2001:db8:2::/64\"\n\n  # Route: attaches a NDP Route Information option to the router advertisement.\n  #\n  # The prefix \"::/0\" advertises a default route (RFC 4191). Hosts which support\n  # Route Information options use its preference and lifetime for this router's\n  # default route instead of preference and default_lifetime, while other hosts\n  # ignore it, so a warning is logged if they disagree.\n  [[interfaces.route]]\n  prefix = \"2001:db8:ffff::/64\"\n\n  # Indicates the preference of this route over other routes advertised by\n  # other routers. Only the values \"low\", \"medium\", and \"high\" are allowed. An\n  # empty string is treated as \"medium\".\n  preference = \"medium\"\n\n  # Specifies the lifetime of this prefix. By default, the lifetime is 24 hours.\n  # \"auto\" uses the defaults. \"infinite\" means this route should be used forever.\n  lifetime = \"auto\"\n\n  # Optional: attaches NDP Route Information options for the routes in the\n  # kernel's IPv6 routing tables which match a filter, so that routes installed\n  # by other software, such as a routing daemon, are redistributed to hosts.\n  # Routes match if they are in table (default 254, the main table), and if\n  # set, were installed by protocol, have metric, and use the output interface\n  # named interface. protocol is a number or one of \"kernel\", \"boot\", \"static\",\n  # \"ra\", \"zebra\", \"bird\", \"dhcp\", \"babel\", \"bgp\", \"isis\", \"ospf\", or \"rip\".\n  # Link-local and multicast routes and routes via this interface are never\n  # advertised.\n  #\n  # The routing tables are read whenever a router advertisement is sent, and\n  # are checked for changes every interval (default \"10s\") so that changes are\n  # advertised promptly. A route which disappears is advertised with a lifetime\n  # of zero until its lifetime would have elapsed, so lifetime must not be\n  # \"infinite\". \"auto\" computes a lifetime of 3 times max_interval. Reading the\n  # routing tables relies on route netlink, and is only supported on Linux.\n  # Unset by default.\n  # [interfaces.kernel_routes]\n  # table = 254\n  # protocol = \"bird\"\n  # metric = 0\n  # interface = \"wg0\"\n  # preference = \"medium\"\n  # lifetime = \"auto\"\n  # interval = \"10s\"\n\n  # RDNSS: attaches a NDP Recursive DNS Servers option to the router advertisement.\n  [[interfaces.rdnss]]\n  # The maximum time these RDNSS addresses may be used for name resolution.\n  # An empty string or 0 means these servers should no longer be used: they are\n  # still advertised, but with a lifetime of zero, so that hosts explicitly\n  # withdraw them, such as after a resolver is decommissioned. \"auto\" will\n  # compute a sane default. \"infinite\" means these servers should be used\n  # forever.\n  lifetime = \"auto\"\n  # \"interface\" may be used in place of an address to advertise this\n  # interface's own global addresses, such as for a router which runs a local\n  # resolver. Link-local and temporary addresses are skipped, and if no\n  # addresses remain, the option is omitted until one is added.\n  servers = [\"2001:db8::1\", \"2001:db8::2\"]\n  # servers = [\"interface\"]\n  # Which of this interface's stable global addresses are advertised when\n  # servers includes \"interface\". \"stable\" advertises all of them, in the order\n  # reported by the operating system. \"lowest_stable\" advertises only the\n  # numerically lowest one, so that the advertised resolver address is chosen\n  # deterministically and does not rotate as other addresses come and go.\n  # Temporary addresses are detected using route netlink on Linux; on other\n  # platforms, all global addresses are considered stable.\n  interface_addresses = \"stable\"\n  # The number of servers hosts are expected to accept. A warning is logged if\n  # more servers are configured. If truncate is true, only the first max_servers\n  # servers are advertised. 0 disables the limit.\n  max_servers = 3\n  truncate = false\n\n  # DNSSL: attaches a NDP DNS Search List option to the router advertisement.\n  [[interfaces.dnssl]]\n  # The maximum time these DNSSL domain names may be used for name resolution.\n  # An empty string or 0 means these search domains should no longer be used.\n  # \"auto\" will compute a sane default. \"infinite\" means these search domains\n  # should be used forever.\n  lifetime = \"auto\"\n  domain_names = [\"foo.example.com\"]\n  # The number of domain names hosts are expected to accept. A warning is logged\n  # if more domain names are configured. If truncate is true, only the first\n  # max_domain_names domain names are advertised. 0 disables the limit.\n  max_domain_names = 3\n  truncate = false\n\n  # Optional: separate plugin sets for solicited unicast and unsolicited\n  # multicast router advertisements, such as to periodically multicast lean\n  # router advertisements while giving detailed router advertisements to hosts\n  # which ask for them. A plugin set may configure prefix, route, rdnss, dnssl,\n  # mtu, mtu_overhead, and raw_option using the same keys as above, and replaces\n  # all of those configured for the interface. Other plugins, such as\n  # source_lla, are shared by both sets. By default, both use the interface's\n  # configuration. If both sets are configured, the interface must not configure\n  # those options itself.\n  #\n  # Advanced: this also allows advertising a different MTU to each kind of\n  # router advertisement, such as a conservative MTU in unsolicited router\n  # advertisements on a link where some hosts are behind a lower-MTU path. Note\n  # that a set without mtu or mtu_overhead advertises no MTU option at all, even\n  # if the interface configures one, and that a set with its own MTU replaces\n  # the MTU seeded by sysctl_defaults. A set's options are added before shared\n  # options, which matters when max_size drops options.\n  # [interfaces.solicited]\n  # mtu = 1500\n  #   [[interfaces.solicited.prefix]]\n  #   prefix = \"::/64\"\n  #   [[interfaces.solicited.rdnss]]\n  #   servers = [\"interface\"]\n  #\n  # [interfaces.unsolicited]\n  #   [[interfaces.unsolicited.prefix]]\n  #   prefix = \"::/64\"\n\n# Enable or disable the debug HTTP server for facilities such as Prometheus\n# metrics and pprof support. When prometheus is enabled, /metrics serves metrics\n# for all interfaces, and /metrics/{interface} (such as /metrics/eth0) serves\n# only the metrics for a single interface. If a TCP listener named \"http\" is\n# passed by systemd socket activation, it is used instead of binding address.\n#\n# Warning: do not expose pprof on an untrusted network!\n[debug]\naddress = \"localhost:9430\"\nprometheus = false\npprof = false\n\n# Indicates whether or not the Prometheus metrics routes may also serve metrics\n# in the OpenMetrics format. When true, the OpenMetrics format is served to\n# scrapers which request it using the HTTP Accept header, and the classic\n# Prometheus text format is served otherwise. Requires prometheus.\nopenmetrics = false\n\n# Enable or disable diagnostic mode for advertising interfaces, which also\n# receives and counts NDP neighbor solicitation and advertisement messages by\n# type. Interfaces in verbose mode also log at most one such message per\n# debug_log_interval. These messages are purely observed and never acted upon.\n# This increases the load on each socket and should only be used for\n# troubleshooting.\nndp_diagnostics = false\n\n# An optional bearer token which enables endpoints which are only served to\n# clients which present the token in an \"Authorization: Bearer\" header:\n#   - GET /api/sockets exposes the low-level setup of each NDP socket, such as\n#     joined multicast groups and ICMPv6 filters.\n#   - GET /api/plugins describes the plugins supported by this build, including\n#     the NDP options each may advertise and its configurable fields, for use\n#     by configuration generation tools.\n#   - GET /api/config renders the plugin configuration of each interface, such\n#     as its prefixes, routes, and RDNSS servers, as [[interfaces]] tables in\n#     this configuration format, so the running configuration can be compared\n#     against or used to regenerate a configuration file. Defaults and values\n#     computed from other options are rendered explicitly, and interface\n#     options which do not configure a plugin are omitted.\n#   - GET /api/conflicts lists recent conflicts with the router advertisements\n#     of other routers, including each router's address, the values advertised\n#     by both routers, and how often the conflict was observed again.\n#   - GET /api/events lists recent events, oldest first, such as interfaces\n#     going up or down, configuration reloads, persistent conflicts, send\n#     errors, and withdrawals, each with its time, type, interface (if any),\n#     and a message.\n#   - POST /api/interfaces/{name}/advertise sends an unsolicited multicast\n#     router advertisement on an advertising interface immediately. Requests\n#     which would violate the minimum delay between multicast router\n#     advertisements are rejected with HTTP 429 and a Retry-After header.\n#   - POST /api/interfaces/{name}/withdraw and /api/interfaces/{name}/promote\n#     withdraw an advertising interface, advertising a router lifetime of zero\n#     and no prefixes, or promote it to full advertising again.\n#   - POST /api/interfaces/{name}/cordon and /api/interfaces/{name}/uncordon\n#     cordon an advertising interface for maintenance, advertising a router\n#     lifetime of zero so that hosts fail over to another default router while\n#     keeping its prefixes so that hosts' addresses remain valid, or uncordon it\n#     again. Changes within 10 seconds of the previous change are rejected with\n#     HTTP 429 and a Retry-After header.\n#   - POST /api/reload verifies the configuration file and, if it is valid,\n#     shuts down for a restart by the process supervisor as if by SIGHUP. The\n#     response summarizes the changes from the running configuration, or\n#     reports why the configuration is invalid with HTTP 400. CoreRAD does not\n#     reload in place, so this is only enabled when CoreRAD is started with\n#     the -supervised flag, indicating that a process supervisor such as\n#     systemd with Restart=always restarts it whenever it exits. Otherwise,\n#     requests are rejected with HTTP 404 rather than stopping advertising.\n#   - POST /api/decode decodes a hex dump of a router advertisement captured\n#     elsewhere, beginning with its ICMPv6 header, into the same JSON structure\n#     used by /api/interfaces. Whitespace and colon or hyphen separators are\n#     ignored. Dumps larger than 64KiB are rejected with HTTP 413, and invalid\n#     input is rejected with HTTP 400 and an error describing the problem.\n#   - GET /api/profile?type={cpu,goroutine}&seconds={1-30} captures a single\n#     CPU (by default, for 5 seconds) or goroutine profile and returns it as a\n#     pprof file, without enabling the pprof endpoints. Advertiser goroutines\n#     are labeled with their interface, so a profile can be scoped to one\n#     interface using \"go tool pprof -tagfocus interface=eth0\". Only one\n#     profile may be captured per minute, and other requests are rejected with\n#     HTTP 429 and a Retry-After header.\n# An empty string disables these endpoints.\ntoken = \"\"\n\n# An optional single line of text appended to the CoreRAD banner served at /,\n# such as to identify a machine and its operators within a fleet.\nbanner = \"\"\n\n# The maximum number of recent events retained for the /api/events endpoint.\n# Once the limit is reached, the oldest event is discarded to make room for\n# each new one. 0 uses the default.\nmax_events = 256\n\n# Advertising continues when the debug HTTP listener cannot bind its address,\n# such as when the port is in use: the failure is logged and counted in\n# metrics, and the bind is retried with backoff. When strict_http is true, the\n# bind is retried for a limited time, after which CoreRAD exits with an error.\nstrict_http = false\n\n# EXPERIMENTAL: router advertisement flags which are set on every advertising\n# interface, for testing that downstream hosts ignore flags they do not\n# implement, as required by the RFCs. \"home_agent\" sets the Mobile IPv6 home\n# agent (H) flag and \"proxy\" sets the neighbor discovery proxy (P) flag; to\n# actually act as a home agent or proxy neighbor discovery, use an interface's\n# home_agent or proxy option instead. These router advertisements are\n# technically non-standard, so this must never be enabled outside of\n# interoperability testing. Each advertising interface logs the flags when it is\n# initialized. The flags are applied even when the debug HTTP server is\n# disabled. Defaults to no flags.\n# experimental_ra_flags = [\"home_agent\", \"proxy\"]\n\n# EXPERIMENTAL: a multicast group with a scope wider than link-local, such as\n# the site-local all nodes group \"ff05::1\", to which multicast router\n# advertisements are sent instead of the link-local all nodes group, with the\n# specified IPv6 hop limit (1-255, default 64) instead of 255. This is useful\n# only to exercise the routing and forwarding of router advertisement-like\n# traffic in a lab: it is not compliant with the RFCs, which require router\n# advertisements to be link-local with a hop limit of 255, so hosts will ignore\n# them. It must never be enabled outside of testing. A warning is logged at\n# startup and as each advertising interface is initialized, and each router\n# advertisement sent this way is counted in metrics. The group is used even when\n# the debug HTTP server is disabled.\n# experimental_multicast_group = \"ff05::1\"\n# experimental_multicast_hop_limit = 64\n"
 
 // A file is the raw top-level configuration file representation.
 type file struct {
-	Interfaces []rawInterface `toml:"interfaces"`
-	Debug      Debug          `toml:"debug"`
+	MaxAdvertisers   int            `toml:"max_advertisers"`
+	PaceMulticast    bool           `toml:"pace_multicast"`
+	MaxLifetime      string         `toml:"max_lifetime"`
+	ForbidInfinite   bool           `toml:"forbid_infinite_lifetimes"`
+	StrictAutonomous bool           `toml:"strict_autonomous_prefixes"`
+	Interfaces       []rawInterface `toml:"interfaces"`
+	Debug            Debug          `toml:"debug"`
 }
 
 // A rawInterface is the raw configuration file representation of an Interface.
 type rawInterface struct {
 	// Base interface configuration.
-	Name            string  `toml:"name"`
-	Monitor         bool    `toml:"monitor"`
-	Advertise       bool    `toml:"advertise"`
-	Verbose         bool    `toml:"verbose"`
-	MaxInterval     string  `toml:"max_interval"`
-	MinInterval     string  `toml:"min_interval"`
-	Managed         bool    `toml:"managed"`
-	OtherConfig     bool    `toml:"other_config"`
-	ReachableTime   string  `toml:"reachable_time"`
-	RetransmitTimer string  `toml:"retransmit_timer"`
-	HopLimit        *int    `toml:"hop_limit"`
-	DefaultLifetime *string `toml:"default_lifetime"`
-	UnicastOnly     bool    `toml:"unicast_only"`
-	Preference      string  `toml:"preference"`
+	Name                       string   `toml:"name"`
+	Names                      []string `toml:"names"`
+	Monitor                    bool     `toml:"monitor"`
+	Advertise                  bool     `toml:"advertise"`
+	Verbose                    bool     `toml:"verbose"`
+	LenientHopLimit            bool     `toml:"lenient_hop_limit"`
+	BindToDevice               bool     `toml:"bind_to_device"`
+	Netns                      string   `toml:"netns"`
+	Trunk                      string   `toml:"trunk"`
+	VLAN                       int      `toml:"vlan"`
+	WaitForInterface           bool     `toml:"wait_for_interface"`
+	TrackLinkState             bool     `toml:"track_link_state"`
+	LinkHysteresis             string   `toml:"link_hysteresis"`
+	ReceiveGracePeriod         string   `toml:"receive_grace_period"`
+	Shadow                     bool     `toml:"shadow"`
+	SourceAddress              string   `toml:"source_address"`
+	StartWithdrawn             bool     `toml:"start_withdrawn"`
+	IPv6Only                   bool     `toml:"ipv6_only"`
+	MaxInterval                string   `toml:"max_interval"`
+	MinInterval                string   `toml:"min_interval"`
+	InitialInterval            string   `toml:"initial_interval"`
+	InitialCount               *int     `toml:"initial_count"`
+	Managed                    bool     `toml:"managed"`
+	ManagedPrefix              string   `toml:"managed_prefix"`
+	OtherConfig                bool     `toml:"other_config"`
+	Proxy                      bool     `toml:"proxy"`
+	HomeAgent                  bool     `toml:"home_agent"`
+	ReachableTime              string   `toml:"reachable_time"`
+	RetransmitTimer            string   `toml:"retransmit_timer"`
+	ReachableTimeMin           string   `toml:"reachable_time_min"`
+	ReachableTimeMax           string   `toml:"reachable_time_max"`
+	RetransmitTimerMin         string   `toml:"retransmit_timer_min"`
+	RetransmitTimerMax         string   `toml:"retransmit_timer_max"`
+	HopLimit                   *int     `toml:"hop_limit"`
+	AdoptNeighborHopLimit      bool     `toml:"adopt_neighbor_hop_limit"`
+	DefaultLifetime            *string  `toml:"default_lifetime"`
+	InitialDefaultLifetime     string   `toml:"initial_default_lifetime"`
+	UnicastOnly                bool     `toml:"unicast_only"`
+	OnDemandWindow             string   `toml:"on_demand_window"`
+	SeparateSolicitedMulticast bool     `toml:"separate_solicited_multicast"`
+	SolicitedSends             *int     `toml:"solicited_sends"`
+	SolicitedSendInterval      string   `toml:"solicited_send_interval"`
+	TransmitRetries            *int     `toml:"transmit_retries"`
+	ConflictWindow             string   `toml:"conflict_window"`
+	DebugLogInterval           string   `toml:"debug_log_interval"`
+	MaxSize                    int      `toml:"max_size"`
+	ReceiveBuffer              int      `toml:"receive_buffer"`
+	SendBuffer                 int      `toml:"send_buffer"`
+	SysctlDefaults             bool     `toml:"sysctl_defaults"`
+	Preference                 string   `toml:"preference"`
 
 	// Plugins.
 	//
 	// TOML tags for slices are explicitly singular.
-	Prefixes  []rawPrefix `toml:"prefix"`
-	Routes    []rawRoute  `toml:"route"`
-	RDNSS     []rawRDNSS  `toml:"rdnss"`
-	DNSSL     []rawDNSSL  `toml:"dnssl"`
-	MTU       int         `toml:"mtu"`
-	SourceLLA *bool       `toml:"source_lla"`
+	Prefixes       []rawPrefix       `toml:"prefix"`
+	Routes         []rawRoute        `toml:"route"`
+	KernelRoutes   *rawKernelRoutes  `toml:"kernel_routes"`
+	RDNSS          []rawRDNSS        `toml:"rdnss"`
+	DNSSL          []rawDNSSL        `toml:"dnssl"`
+	MTU            int               `toml:"mtu"`
+	MTUOverhead    *int              `toml:"mtu_overhead"`
+	SourceLLA      *bool             `toml:"source_lla"`
+	UnsolicitedLLA *bool             `toml:"source_lla_unsolicited"`
+	LLAOverride    string            `toml:"source_lla_override"`
+	Nonce          bool              `toml:"nonce"`
+	Renumber       []rawRenumber     `toml:"renumber"`
+	Upstream       *rawUpstream      `toml:"upstream"`
+	VRRP           *rawVRRP          `toml:"vrrp"`
+	CaptivePortal  *rawCaptivePortal `toml:"captive_portal"`
+	RawOptions     []rawRawOption    `toml:"raw_option"`
+
+	// Optional plugin sets which replace the options above for solicited or
+	// unsolicited router advertisements.
+	Solicited   *rawPluginSet `toml:"solicited"`
+	Unsolicited *rawPluginSet `toml:"unsolicited"`
+}
+
+// A rawPluginSet is the raw configuration file representation of the plugins
+// which add options to one kind of router advertisement.
+type rawPluginSet struct {
+	Prefixes    []rawPrefix    `toml:"prefix,omitempty"`
+	Routes      []rawRoute     `toml:"route,omitempty"`
+	RDNSS       []rawRDNSS     `toml:"rdnss,omitempty"`
+	DNSSL       []rawDNSSL     `toml:"dnssl,omitempty"`
+	MTU         int            `toml:"mtu,omitzero"`
+	MTUOverhead *int           `toml:"mtu_overhead"`
+	RawOptions  []rawRawOption `toml:"raw_option,omitempty"`
 }
 
 // A rawPrefix is the raw configuration file representation of a Prefix plugin.
 type rawPrefix struct {
-	Prefix            string  `toml:"prefix"`
-	OnLink            *bool   `toml:"on_link"`
-	Autonomous        *bool   `toml:"autonomous"`
-	ValidLifetime     *string `toml:"valid_lifetime"`
-	PreferredLifetime *string `toml:"preferred_lifetime"`
-	Deprecated        bool    `toml:"deprecated"`
+	Prefix                     string   `toml:"prefix"`
+	OnLink                     *bool    `toml:"on_link"`
+	Autonomous                 *bool    `toml:"autonomous"`
+	ValidLifetime              *string  `toml:"valid_lifetime"`
+	PreferredLifetime          *string  `toml:"preferred_lifetime"`
+	TemporaryValidLifetime     *string  `toml:"temporary_valid_lifetime"`
+	TemporaryPreferredLifetime *string  `toml:"temporary_preferred_lifetime"`
+	MaxAddressFailures         int      `toml:"max_address_failures,omitzero"`
+	ExcludePrefixes            []string `toml:"exclude_prefixes,omitempty"`
+	Deprecated                 bool     `toml:"deprecated,omitempty"`
+	DHCPv6                     bool     `toml:"dhcpv6,omitempty"`
+	RouterAddress              bool     `toml:"router_address,omitempty"`
+	VerifyEUI64                bool     `toml:"verify_eui64,omitempty"`
+	Interface                  string   `toml:"interface,omitempty"`
+	Subnet                     *int     `toml:"subnet"`
+}
+
+// A rawRenumber is the raw configuration file representation of a Renumber
+// plugin.
+type rawRenumber struct {
+	Start  string    `toml:"start"`
+	Window string    `toml:"window"`
+	Old    rawPrefix `toml:"old"`
+	New    rawPrefix `toml:"new"`
+}
+
+// A rawUpstream is the raw configuration file representation of an Upstream
+// plugin.
+type rawUpstream struct {
+	Interval   string `toml:"interval"`
+	Hysteresis *int   `toml:"hysteresis"`
+}
+
+// A rawVRRP is the raw configuration file representation of a VRRP plugin.
+type rawVRRP struct {
+	Address    string `toml:"address,omitempty"`
+	StateFile  string `toml:"state_file,omitempty"`
+	Interval   string `toml:"interval"`
+	Hysteresis *int   `toml:"hysteresis"`
+}
+
+// A rawCaptivePortal is the raw configuration file representation of a
+// CaptivePortal plugin.
+type rawCaptivePortal struct {
+	API    string `toml:"api"`
+	Strict bool   `toml:"strict,omitempty"`
+}
+
+// A rawRawOption is the raw configuration file representation of a Raw
+// plugin.
+type rawRawOption struct {
+	Type   int    `toml:"type"`
+	Hex    string `toml:"hex,omitempty"`
+	Base64 string `toml:"base64,omitempty"`
 }
 
 // A rawRoute is the raw configuration file representation of a Route plugin.
@@ -82,59 +203,319 @@ type rawRoute struct {
 	Lifetime   *string `toml:"lifetime"`
 }
 
+// A rawKernelRoutes is the raw configuration file representation of a
+// KernelRoutes plugin.
+type rawKernelRoutes struct {
+	Table      *int    `toml:"table"`
+	Protocol   string  `toml:"protocol,omitempty"`
+	Metric     int     `toml:"metric,omitzero"`
+	Interface  string  `toml:"interface,omitempty"`
+	Preference string  `toml:"preference"`
+	Lifetime   *string `toml:"lifetime"`
+	Interval   string  `toml:"interval"`
+}
+
 // A rawDNSSL is the raw configuration file representation of a DNSSL plugin.
 type rawDNSSL struct {
-	Lifetime    *string  `toml:"lifetime"`
-	DomainNames []string `toml:"domain_names"`
+	Lifetime       *string  `toml:"lifetime"`
+	DomainNames    []string `toml:"domain_names"`
+	MaxDomainNames *int     `toml:"max_domain_names"`
+	Truncate       bool     `toml:"truncate,omitempty"`
 }
 
 // A rawRDNSS is the raw configuration file representation of a RDNSS plugin.
 type rawRDNSS struct {
-	Lifetime *string  `toml:"lifetime"`
-	Servers  []string `toml:"servers"`
+	Lifetime           *string  `toml:"lifetime"`
+	Servers            []string `toml:"servers"`
+	InterfaceAddresses string   `toml:"interface_addresses,omitempty"`
+	MaxServers         *int     `toml:"max_servers"`
+	Truncate           bool     `toml:"truncate,omitempty"`
 }
 
 // Config specifies the configuration for CoreRAD.
 type Config struct {
 	// User-specified.
-	Interfaces []Interface
-	Debug      Debug
+	MaxAdvertisers   int
+	PaceMulticast    bool
+	MaxLifetime      time.Duration
+	ForbidInfinite   bool
+	StrictAutonomous bool
+	Interfaces       []Interface
+	Debug            Debug
 }
 
 // An Interface provides configuration for an individual interface.
 type Interface struct {
 	Name                           string
 	Monitor, Advertise, Verbose    bool
+	LenientHopLimit, BindToDevice  bool
+	Netns                          string
+	Trunk                          string
+	VLAN                           int
+	WaitForInterface               bool
+	TrackLinkState                 bool
+	LinkHysteresis                 time.Duration
+	ReceiveGracePeriod             time.Duration
+	Shadow, Rejected               bool
+	StartWithdrawn                 bool
+	IPv6Only                       bool
+	SourcePolicy                   system.SourcePolicy
+	SourceAddress                  netaddr.IP
 	MinInterval, MaxInterval       time.Duration
+	InitialInterval                time.Duration
+	InitialCount                   int
 	Managed, OtherConfig           bool
+	Proxy, HomeAgent               bool
 	ReachableTime, RetransmitTimer time.Duration
+	ReachableTimeMax               time.Duration
+	RetransmitTimerMax             time.Duration
 	HopLimit                       uint8
+	AdoptNeighborHopLimit          bool
 	DefaultLifetime                time.Duration
+	InitialDefaultLifetime         time.Duration
+	MaxLifetime                    time.Duration
 	UnicastOnly                    bool
+	SeparateSolicitedMulticast     bool
+	SolicitedOnlyLLA               bool
+	SourceLLAOverride              net.HardwareAddr
+	SolicitedSends                 int
+	SolicitedSendInterval          time.Duration
+	TransmitRetries                int
+	ConflictWindow                 time.Duration
+	DebugLogInterval               time.Duration
+	OnDemandWindow                 time.Duration
+	MaxSize                        int
+	ReceiveBuffer, SendBuffer      int
 	Preference                     ndp.Preference
 	Plugins                        []plugin.Plugin
+
+	// SolicitedPlugins and UnsolicitedPlugins, if not nil, replace Plugins
+	// when building solicited and unsolicited router advertisements. Plugins
+	// which cannot be configured in a plugin set, such as lla, are shared with
+	// Plugins.
+	SolicitedPlugins   []plugin.Plugin
+	UnsolicitedPlugins []plugin.Plugin
+
+	// OnLifetimeClamp, if set, is invoked by Build with a description of each
+	// lifetime which exceeded MaxLifetime and was clamped.
+	OnLifetimeClamp func(lifetime string, d time.Duration)
+}
+
+// A PluginSet selects the plugins used to build a router advertisement.
+type PluginSet int
+
+// Possible PluginSet values.
+const (
+	UnsolicitedSet PluginSet = iota
+	SolicitedSet
+)
+
+// String returns the string representation of a PluginSet.
+func (s PluginSet) String() string {
+	switch s {
+	case UnsolicitedSet:
+		return "unsolicited"
+	case SolicitedSet:
+		return "solicited"
+	default:
+		return fmt.Sprintf("PluginSet(%d)", int(s))
+	}
+}
+
+// PluginsFor returns the plugins used to build router advertisements for the
+// specified PluginSet.
+func (ifi Interface) PluginsFor(set PluginSet) []plugin.Plugin {
+	switch {
+	case set == SolicitedSet && ifi.SolicitedPlugins != nil:
+		return ifi.SolicitedPlugins
+	case set == UnsolicitedSet && ifi.UnsolicitedPlugins != nil:
+		return ifi.UnsolicitedPlugins
+	default:
+		return ifi.Plugins
+	}
+}
+
+// SeparatePluginSets reports whether solicited and unsolicited router
+// advertisements are built from different plugins.
+func (ifi Interface) SeparatePluginSets() bool {
+	return ifi.SolicitedPlugins != nil || ifi.UnsolicitedPlugins != nil
+}
+
+// AllPlugins returns each distinct plugin in Plugins and any plugin sets, so
+// that every plugin can be prepared or inspected once.
+func (ifi Interface) AllPlugins() []plugin.Plugin {
+	if !ifi.SeparatePluginSets() {
+		return ifi.Plugins
+	}
+
+	var (
+		all  []plugin.Plugin
+		seen = make(map[plugin.Plugin]bool)
+	)
+
+	for _, ps := range [][]plugin.Plugin{ifi.Plugins, ifi.SolicitedPlugins, ifi.UnsolicitedPlugins} {
+		for _, p := range ps {
+			if !seen[p] {
+				seen[p] = true
+				all = append(all, p)
+			}
+		}
+	}
+
+	return all
+}
+
+// Warnings reports configuration which is valid but likely to be a mistake,
+// such as a prefix which hosts cannot acquire addresses from.
+func (ifi Interface) Warnings() []string {
+	var warnings []string
+	for _, p := range ifi.AllPlugins() {
+		warnings = append(warnings, ifi.pluginWarnings(p)...)
+	}
+
+	return warnings
+}
+
+// pluginWarnings produces the Warnings for an individual plugin p.
+func (ifi Interface) pluginWarnings(p plugin.Plugin) []string {
+	var warnings []string
+	if err := checkAutonomous(p); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	switch p := p.(type) {
+	case *plugin.Prefix:
+		if p.Autonomous || ifi.Managed {
+			break
+		}
+
+		// Hosts can only acquire addresses from a non-autonomous prefix
+		// using DHCPv6, which the managed flag advertises. The other flag
+		// only offers stateless DHCPv6 information such as DNS servers.
+		warnings = append(warnings, fmt.Sprintf(
+			"prefix %s is not autonomous but managed is false, hosts may not acquire addresses from it",
+			p.Prefix))
+	case *plugin.RDNSS:
+		if w := maxEntriesWarning("rdnss", "servers", len(p.Servers), p.MaxServers, p.Truncate); w != "" {
+			warnings = append(warnings, w)
+		}
+	case *plugin.DNSSL:
+		if w := maxEntriesWarning("dnssl", "domain names", len(p.DomainNames), p.MaxDomainNames, p.Truncate); w != "" {
+			warnings = append(warnings, w)
+		}
+	case *plugin.Route:
+		warnings = append(warnings, ifi.defaultRouteWarnings(p)...)
+	}
+
+	return warnings
+}
+
+// defaultRouteWarnings produces warnings if a Route for ::/0 disagrees with the
+// router lifetime or preference of the router advertisement. Hosts which
+// support Route Information options use the route, while other hosts use the
+// router advertisement's parameters.
+func (ifi Interface) defaultRouteWarnings(r *plugin.Route) []string {
+	if r.Prefix.IP != netaddr.IPv6Unspecified() || r.Prefix.Bits != 0 {
+		return nil
+	}
+
+	var warnings []string
+	if ifi.DefaultLifetime == 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"route %s has a lifetime of %s but default_lifetime is 0, only some hosts will use this router as a default router",
+			r.Prefix, plugin.DurationString(r.Lifetime)))
+	}
+
+	if r.Preference != ifi.Preference {
+		warnings = append(warnings, fmt.Sprintf(
+			"route %s has preference %s but the router preference is %s, hosts may disagree on this router's preference",
+			r.Prefix, r.Preference, ifi.Preference))
+	}
+
+	return warnings
+}
+
+// maxEntriesWarning produces a warning if a RDNSS or DNSSL plugin has more than
+// max entries configured.
+func maxEntriesWarning(name, entries string, n, max int, truncate bool) string {
+	if max == 0 || n <= max {
+		return ""
+	}
+
+	if truncate {
+		return fmt.Sprintf("%s has %d %s, truncating to the first %d", name, n, entries, max)
+	}
+
+	return fmt.Sprintf("%s has %d %s, but hosts may only use the first %d", name, n, entries, max)
 }
 
-// RouterAdvertisement generates an IPv6 NDP router advertisement for this
-// interface. Input parameters are used to tune parts of the RA, per the
-// NDP RFCs.
+// RouterAdvertisement generates an unsolicited IPv6 NDP router advertisement
+// for this interface. Input parameters are used to tune parts of the RA, per
+// the NDP RFCs.
 func (ifi Interface) RouterAdvertisement(forwarding bool) (*ndp.RouterAdvertisement, error) {
+	ra, _, err := ifi.Build(forwarding, UnsolicitedSet)
+	return ra, err
+}
+
+// Build is like RouterAdvertisement, but builds the router advertisement using
+// the plugins for the specified PluginSet, and also returns any plugins which
+// were dropped to keep the router advertisement within MaxSize bytes.
+//
+// Plugins are applied in priority order, as they appear in the PluginSet. Once
+// a plugin would cause the router advertisement to exceed MaxSize, it and any
+// later plugins which add options are dropped, although later plugins which
+// only modify the router advertisement's header are still applied.
+func (ifi Interface) Build(forwarding bool, set PluginSet) (*ndp.RouterAdvertisement, []plugin.Plugin, error) {
 	ra := &ndp.RouterAdvertisement{
 		CurrentHopLimit:           ifi.HopLimit,
 		ManagedConfiguration:      ifi.Managed,
 		OtherConfiguration:        ifi.OtherConfig,
+		NeighborDiscoveryProxy:    ifi.Proxy,
+		MobileIPv6HomeAgent:       ifi.HomeAgent,
 		RouterSelectionPreference: ifi.Preference,
 		RouterLifetime:            ifi.DefaultLifetime,
-		ReachableTime:             ifi.ReachableTime,
-		RetransmitTimer:           ifi.RetransmitTimer,
+		ReachableTime:             randomTimer(ifi.ReachableTime, ifi.ReachableTimeMax),
+		RetransmitTimer:           randomTimer(ifi.RetransmitTimer, ifi.RetransmitTimerMax),
 	}
 
-	for _, p := range ifi.Plugins {
+	var (
+		dropped   []plugin.Plugin
+		exhausted bool
+	)
+
+	for _, p := range ifi.PluginsFor(set) {
+		// Keep a copy of the RA in case this plugin must be dropped.
+		prev := *ra
+		prev.Options = append([]ndp.Option(nil), ra.Options...)
+
 		if err := p.Apply(ra); err != nil {
-			return nil, fmt.Errorf("failed to apply plugin %q: %v", p.Name(), err)
+			return nil, nil, fmt.Errorf("failed to apply plugin %q: %v", p.Name(), err)
+		}
+
+		if ifi.MaxSize == 0 {
+			// No budget.
+			continue
+		}
+
+		// Plugins which add no options never affect the budget.
+		if exhausted && len(ra.Options) == len(prev.Options) {
+			continue
+		}
+
+		size, err := raSize(ra)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to apply plugin %q: %v", p.Name(), err)
+		}
+
+		if exhausted || size > ifi.MaxSize {
+			exhausted = true
+			dropped = append(dropped, p)
+			*ra = prev
 		}
 	}
 
+	ifi.clampLifetimes(ra)
+
 	// Apply any necessary changes due to modification in system state.
 
 	// If the interface is not forwarding packets, we must set the router
@@ -144,19 +525,131 @@ func (ifi Interface) RouterAdvertisement(forwarding bool) (*ndp.RouterAdvertisem
 		ra.RouterLifetime = 0
 	}
 
-	return ra, nil
+	return ra, dropped, nil
+}
+
+// prng chooses randomized router advertisement timers.
+var (
+	prngMu sync.Mutex
+	prng   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randomTimer returns min if max is not greater than min, or otherwise a
+// random value between min and max with millisecond precision, as encoded in
+// router advertisements.
+func randomTimer(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+
+	prngMu.Lock()
+	defer prngMu.Unlock()
+
+	ms := int64((max - min) / time.Millisecond)
+	return min + time.Duration(prng.Int63n(ms+1))*time.Millisecond
+}
+
+// clampLifetimes clamps the router lifetime and the lifetimes of any options
+// in ra to MaxLifetime, if set.
+func (ifi Interface) clampLifetimes(ra *ndp.RouterAdvertisement) {
+	if ifi.MaxLifetime == 0 {
+		return
+	}
+
+	clamp := func(d *time.Duration, format string, v ...interface{}) {
+		if *d <= ifi.MaxLifetime {
+			return
+		}
+
+		if ifi.OnLifetimeClamp != nil {
+			ifi.OnLifetimeClamp(fmt.Sprintf(format, v...), *d)
+		}
+		*d = ifi.MaxLifetime
+	}
+
+	clamp(&ra.RouterLifetime, "router lifetime")
+
+	for i, o := range ra.Options {
+		if pi, routerAddress, ok := plugin.PrefixInformation(o); ok {
+			pfx := fmt.Sprintf("%s/%d", pi.Prefix, pi.PrefixLength)
+			clamp(&pi.ValidLifetime, "prefix %s valid lifetime", pfx)
+			clamp(&pi.PreferredLifetime, "prefix %s preferred lifetime", pfx)
+
+			if routerAddress {
+				// Router addresses are packed as raw options, and must be
+				// packed again with the clamped lifetimes.
+				ra.Options[i] = plugin.RouterAddressOption(pi)
+			}
+			continue
+		}
+
+		switch o := o.(type) {
+		case *ndp.RouteInformation:
+			clamp(&o.RouteLifetime, "route %s/%d lifetime", o.Prefix, o.PrefixLength)
+		case *ndp.RecursiveDNSServer:
+			clamp(&o.Lifetime, "rdnss lifetime")
+		case *ndp.DNSSearchList:
+			clamp(&o.Lifetime, "dnssl lifetime")
+		}
+	}
+}
+
+// raSize returns the size in bytes of ra on the wire, excluding the IPv6
+// header.
+func raSize(ra *ndp.RouterAdvertisement) (int, error) {
+	b, err := ndp.MarshalMessage(ra)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal router advertisement: %v", err)
+	}
+
+	return len(b), nil
 }
 
 // Debug provides configuration for debugging and observability.
 type Debug struct {
-	Address    string `toml:"address"`
-	Prometheus bool   `toml:"prometheus"`
-	PProf      bool   `toml:"pprof"`
+	Address        string `toml:"address"`
+	Prometheus     bool   `toml:"prometheus"`
+	OpenMetrics    bool   `toml:"openmetrics"`
+	PProf          bool   `toml:"pprof"`
+	NDPDiagnostics bool   `toml:"ndp_diagnostics"`
+	Token          string `toml:"token"`
+	Banner         string `toml:"banner"`
+	StrictHTTP     bool   `toml:"strict_http"`
+	MaxEvents      int    `toml:"max_events"`
+
+	// Experimental, off by default.
+	ExperimentalRAFlags           []string `toml:"experimental_ra_flags"`
+	ExperimentalMulticastGroup    string   `toml:"experimental_multicast_group"`
+	ExperimentalMulticastHopLimit int      `toml:"experimental_multicast_hop_limit"`
 }
 
+// An InterfaceError is an error in the configuration of a single interface,
+// which is returned by Parse.
+type InterfaceError struct {
+	// Index is the position of the interface in the configuration file, and
+	// Interface is its name.
+	Index     int
+	Interface string
+
+	// Plugin identifies the plugin the error applies to in the same form as
+	// a Finding, and is empty if it applies to the interface as a whole.
+	Plugin string
+
+	Err error
+}
+
+// Error implements error.
+func (e *InterfaceError) Error() string {
+	return fmt.Sprintf("interface %d/%q: %v", e.Index, e.Interface, e.Err)
+}
+
+// Unwrap implements errors unwrapping.
+func (e *InterfaceError) Unwrap() error { return e.Err }
+
 // Parse parses a Config in TOML format from an io.Reader and verifies that
 // the configuration is valid. If the epoch is not zero, it is used to calculate
-// deprecation times for certain parameters.
+// deprecation times for certain parameters. Errors in the configuration of an
+// interface are reported as an *InterfaceError.
 func Parse(r io.Reader, epoch time.Time) (*Config, error) {
 	var f file
 	md, err := toml.DecodeReader(r, &f)
@@ -172,8 +665,37 @@ func Parse(r io.Reader, epoch time.Time) (*Config, error) {
 		return nil, errors.New("no configured interfaces")
 	}
 
+	maxAdvertisers := defaultMaxAdvertisers
+	switch {
+	case f.MaxAdvertisers < 0:
+		return nil, fmt.Errorf("max advertisers (%d) must not be negative", f.MaxAdvertisers)
+	case f.MaxAdvertisers > 0:
+		maxAdvertisers = f.MaxAdvertisers
+	}
+
+	var maxLifetime time.Duration
+	if f.MaxLifetime != "" {
+		d, err := parseDuration(&f.MaxLifetime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max lifetime: %v", err)
+		}
+		if d < 1*time.Second {
+			return nil, fmt.Errorf("max lifetime (%s) must be at least 1s", d)
+		}
+
+		// An infinite maximum is equivalent to no maximum.
+		if d != ndp.Infinity {
+			maxLifetime = d
+		}
+	}
+
 	c := &Config{
-		Interfaces: make([]Interface, 0, len(f.Interfaces)),
+		MaxAdvertisers:   maxAdvertisers,
+		PaceMulticast:    f.PaceMulticast,
+		MaxLifetime:      maxLifetime,
+		ForbidInfinite:   f.ForbidInfinite,
+		StrictAutonomous: f.StrictAutonomous,
+		Interfaces:       make([]Interface, 0, len(f.Interfaces)),
 	}
 
 	// Validate debug configuration if set.
@@ -181,28 +703,283 @@ func Parse(r io.Reader, epoch time.Time) (*Config, error) {
 		if _, err := net.ResolveTCPAddr("tcp", f.Debug.Address); err != nil {
 			return nil, fmt.Errorf("bad debug address: %v", err)
 		}
+		if f.Debug.OpenMetrics && !f.Debug.Prometheus {
+			return nil, errors.New("debug openmetrics requires prometheus")
+		}
+		if strings.ContainsAny(f.Debug.Banner, "\r\n") {
+			return nil, errors.New("debug banner must be a single line")
+		}
+		switch {
+		case f.Debug.MaxEvents < 0:
+			return nil, fmt.Errorf("debug max events (%d) must not be negative", f.Debug.MaxEvents)
+		case f.Debug.MaxEvents == 0:
+			f.Debug.MaxEvents = defaultMaxEvents
+		}
 		c.Debug = f.Debug
 	}
 
+	// Experimental router advertisement flags and the multicast group are
+	// applied by each advertiser whether or not the debug HTTP server is
+	// enabled.
+	for _, flag := range f.Debug.ExperimentalRAFlags {
+		switch flag {
+		case "home_agent", "proxy":
+		default:
+			return nil, fmt.Errorf("unsupported experimental debug RA flag %q", flag)
+		}
+	}
+	if err := checkMulticastGroup(&f.Debug); err != nil {
+		return nil, err
+	}
+	c.Debug.ExperimentalRAFlags = f.Debug.ExperimentalRAFlags
+	c.Debug.ExperimentalMulticastGroup = f.Debug.ExperimentalMulticastGroup
+	c.Debug.ExperimentalMulticastHopLimit = f.Debug.ExperimentalMulticastHopLimit
+
 	// Don't bother to check for valid interface names; that is more easily
-	// done when trying to create server listeners.
+	// done when trying to create server listeners. Each interface may only be
+	// configured once, so that no configuration is silently dropped.
+	seen := make(map[string]int)
 	for i, ifi := range f.Interfaces {
-		if ifi.Name == "" {
+		// A VLAN sub-interface of a trunk interface is named after the trunk
+		// and VLAN ID unless it is named explicitly.
+		if ifi.Trunk != "" || ifi.VLAN != 0 {
+			switch {
+			case ifi.Trunk == "":
+				return nil, fmt.Errorf("interface %d: vlan requires trunk", i)
+			case ifi.VLAN < 1 || ifi.VLAN > 4094:
+				return nil, fmt.Errorf("interface %d: vlan (%d) must be between 1 and 4094", i, ifi.VLAN)
+			case len(ifi.Names) > 0:
+				return nil, fmt.Errorf("interface %d: trunk and names are mutually exclusive", i)
+			}
+
+			if ifi.Name == "" {
+				ifi.Name = fmt.Sprintf("%s.%d", ifi.Trunk, ifi.VLAN)
+			}
+
+			// Operating systems limit interface names to IFNAMSIZ (16)
+			// bytes, including a trailing NUL.
+			if len(ifi.Name) > 15 {
+				return nil, fmt.Errorf("interface %d: VLAN sub-interface name %q is too long, set name explicitly", i, ifi.Name)
+			}
+
+			vlan := fmt.Sprintf("%s/%d", ifi.Trunk, ifi.VLAN)
+			if j, ok := seen[vlan]; ok {
+				return nil, fmt.Errorf("interface %d: duplicate VLAN %d on trunk %q, already configured by interface %d",
+					i, ifi.VLAN, ifi.Trunk, j)
+			}
+			seen[vlan] = i
+		}
+
+		names := ifi.Names
+		switch {
+		case ifi.Name != "" && len(names) > 0:
+			return nil, fmt.Errorf("interface %d: name and names are mutually exclusive", i)
+		case ifi.Name != "":
+			names = []string{ifi.Name}
+		case len(names) == 0:
 			return nil, fmt.Errorf("interface %d: empty interface name", i)
 		}
 
-		iface, err := parseInterface(ifi, epoch)
-		if err != nil {
-			// Narrow down the location of a configuration error.
-			return nil, fmt.Errorf("interface %d/%q: %v", i, ifi.Name, err)
+		// A single block may configure several interfaces which share
+		// configuration. Each is parsed individually so that every interface
+		// has its own plugin state, such as for ::/N prefix expansion.
+		for _, name := range names {
+			if name == "" {
+				return nil, fmt.Errorf("interface %d: empty interface name", i)
+			}
+			if j, ok := seen[name]; ok {
+				return nil, fmt.Errorf("interface %d: duplicate interface %q, already configured by interface %d", i, name, j)
+			}
+			seen[name] = i
+
+			ifi := ifi
+			ifi.Name = name
+			ifi.Names = nil
+
+			iface, err := parseInterface(ifi, epoch)
+			if err != nil {
+				// Narrow down the location of a configuration error.
+				ierr := &InterfaceError{Index: i, Interface: ifi.Name, Err: err}
+
+				var perr *pluginError
+				if errors.As(err, &perr) {
+					ierr.Plugin = perr.id
+				}
+
+				return nil, ierr
+			}
+
+			// Router addresses are only meaningful to Mobile IPv6 hosts, and
+			// only when this router advertises itself as a home agent.
+			for _, p := range iface.AllPlugins() {
+				if pfx, ok := p.(*plugin.Prefix); ok && pfx.RouterAddress && !iface.HomeAgent {
+					return nil, &InterfaceError{
+						Index:     i,
+						Interface: ifi.Name,
+						Plugin:    pluginID(p),
+						Err:       fmt.Errorf("prefix %s router_address requires home_agent", pfx.Prefix),
+					}
+				}
+			}
+
+			if f.ForbidInfinite {
+				for _, p := range iface.AllPlugins() {
+					if infiniteLifetime(p) {
+						return nil, &InterfaceError{
+							Index:     i,
+							Interface: ifi.Name,
+							Plugin:    pluginID(p),
+							Err:       fmt.Errorf("%q plugin has an infinite lifetime, but infinite lifetimes are forbidden", p.Name()),
+						}
+					}
+				}
+			}
+
+			// Autonomous prefixes which are not /64 are otherwise only
+			// reported by Warnings.
+			if f.StrictAutonomous {
+				for _, p := range iface.AllPlugins() {
+					if err := checkAutonomous(p); err != nil {
+						return nil, &InterfaceError{
+							Index:     i,
+							Interface: ifi.Name,
+							Plugin:    pluginID(p),
+							Err:       err,
+						}
+					}
+				}
+			}
+
+			iface.MaxLifetime = maxLifetime
+			c.Interfaces = append(c.Interfaces, *iface)
 		}
+	}
 
-		c.Interfaces = append(c.Interfaces, *iface)
+	// Refuse to advertise on interfaces beyond the limit, in configuration
+	// order, so that a runaway configuration cannot exhaust resources.
+	var advertisers int
+	for i := range c.Interfaces {
+		if !c.Interfaces[i].Advertise {
+			continue
+		}
+
+		if advertisers < c.MaxAdvertisers {
+			advertisers++
+			continue
+		}
+
+		c.Interfaces[i].Advertise = false
+		c.Interfaces[i].Rejected = true
 	}
 
 	return c, nil
 }
 
+// infiniteLifetime reports whether p is configured with an infinite lifetime.
+func infiniteLifetime(p plugin.Plugin) bool {
+	// Prefixes carry several lifetimes, including those of the temporary
+	// addresses hosts form within them.
+	prefix := func(p *plugin.Prefix) []time.Duration {
+		return []time.Duration{
+			p.ValidLifetime, p.PreferredLifetime,
+			p.TemporaryValidLifetime, p.TemporaryPreferredLifetime,
+		}
+	}
+
+	var ds []time.Duration
+	switch p := p.(type) {
+	case *plugin.Prefix:
+		ds = prefix(p)
+	case *plugin.DelegatedPrefix:
+		ds = prefix(p.Prefix)
+	case *plugin.Renumber:
+		ds = append(prefix(p.Old), prefix(p.New)...)
+	case *plugin.Route:
+		ds = []time.Duration{p.Lifetime}
+	case *plugin.KernelRoutes:
+		ds = []time.Duration{p.Lifetime}
+	case *plugin.RDNSS:
+		ds = []time.Duration{p.Lifetime}
+	case *plugin.DNSSL:
+		ds = []time.Duration{p.Lifetime}
+	}
+
+	for _, d := range ds {
+		if d == ndp.Infinity {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkAutonomous verifies the prefix length of any autonomous prefixes
+// configured by p, including the ::/N templates of derived prefixes.
+func checkAutonomous(p plugin.Plugin) error {
+	var pfxs []*plugin.Prefix
+	switch p := p.(type) {
+	case *plugin.Prefix:
+		pfxs = []*plugin.Prefix{p}
+	case *plugin.DelegatedPrefix:
+		pfxs = []*plugin.Prefix{p.Prefix}
+	case *plugin.Renumber:
+		pfxs = []*plugin.Prefix{p.Old, p.New}
+	}
+
+	for _, pfx := range pfxs {
+		if err := plugin.CheckAutonomous(pfx.Prefix, pfx.Autonomous); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// defaultMulticastHopLimit is the default hop limit for router advertisements
+// sent to an experimental multicast group.
+const defaultMulticastHopLimit = 64
+
+// checkMulticastGroup validates the experimental multicast group and hop limit
+// in d, and sets the default hop limit if needed.
+func checkMulticastGroup(d *Debug) error {
+	if d.ExperimentalMulticastGroup == "" {
+		if d.ExperimentalMulticastHopLimit != 0 {
+			return errors.New("debug experimental multicast hop limit requires experimental multicast group")
+		}
+
+		return nil
+	}
+
+	ip, err := netaddr.ParseIP(d.ExperimentalMulticastGroup)
+	if err != nil {
+		return fmt.Errorf("invalid debug experimental multicast group: %v", err)
+	}
+
+	// The scope is the low 4 bits of the second byte of the address. Router
+	// advertisements are always link-local, so the group must be wider than
+	// that to have any effect.
+	if !ip.Is6() || !ip.IsMulticast() || ip.IPAddr().IP[1]&0x0f <= 0x02 {
+		return fmt.Errorf("debug experimental multicast group %s must be an IPv6 multicast group with a scope wider than link-local", ip)
+	}
+
+	switch hl := d.ExperimentalMulticastHopLimit; {
+	case hl == 0:
+		d.ExperimentalMulticastHopLimit = defaultMulticastHopLimit
+	case hl < 1 || hl > 255:
+		return fmt.Errorf("debug experimental multicast hop limit (%d) must be between 1 and 255", hl)
+	}
+
+	return nil
+}
+
+// defaultMaxAdvertisers is the default limit on the number of advertising
+// interfaces.
+const defaultMaxAdvertisers = 1024
+
+// defaultMaxEvents is the default number of events retained for the debug
+// API.
+const defaultMaxEvents = 256
+
 // durationAuto implies that a value should be automatically computed.
 const durationAuto = -1 * time.Second
 
@@ -14,14 +14,17 @@
 package config_test
 
 import (
+	"net"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/mdlayher/corerad/internal/config"
 	"github.com/mdlayher/corerad/internal/crtest"
 	"github.com/mdlayher/corerad/internal/plugin"
+	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
 	"inet.af/netaddr"
 )
@@ -57,6 +60,153 @@ func TestParse(t *testing.T) {
 			name = ""
 			`,
 		},
+		{
+			name: "bad max advertisers",
+			s: `
+			max_advertisers = -1
+
+			[[interfaces]]
+			name = "eth0"
+			`,
+		},
+		{
+			name: "bad max lifetime",
+			s: `
+			max_lifetime = "0s"
+
+			[[interfaces]]
+			name = "eth0"
+			`,
+		},
+		{
+			name: "bad forbidden infinite lifetime",
+			s: `
+			forbid_infinite_lifetimes = true
+
+			[[interfaces]]
+			name = "eth0"
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  valid_lifetime = "infinite"
+			`,
+		},
+		{
+			name: "bad forbidden infinite lifetime renumber",
+			s: `
+			forbid_infinite_lifetimes = true
+
+			[[interfaces]]
+			name = "eth0"
+
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			  window = "1h"
+			  old = { prefix = "2001:db8::/64" }
+			  new = { prefix = "2001:db8:ffff::/64", valid_lifetime = "infinite" }
+			`,
+		},
+		{
+			name: "bad forbidden infinite lifetime kernel routes",
+			s: `
+			forbid_infinite_lifetimes = true
+
+			[[interfaces]]
+			name = "eth0"
+
+			  [interfaces.kernel_routes]
+			  lifetime = "infinite"
+			`,
+		},
+		{
+			name: "bad strict autonomous",
+			s: `
+			strict_autonomous_prefixes = true
+
+			[[interfaces]]
+			name = "eth0"
+
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8:ffff::/48"
+			`,
+		},
+		{
+			name: "bad strict autonomous renumber",
+			s: `
+			strict_autonomous_prefixes = true
+
+			[[interfaces]]
+			name = "eth0"
+
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			  old = { prefix = "2001:db8::/64" }
+			  new = { prefix = "2001:db8:ffff::/48" }
+			`,
+		},
+		{
+			name: "bad VLAN no trunk",
+			s: `
+			[[interfaces]]
+			vlan = 10
+			`,
+		},
+		{
+			name: "bad VLAN ID",
+			s: `
+			[[interfaces]]
+			trunk = "eth0"
+			vlan = 4095
+			`,
+		},
+		{
+			name: "bad VLAN names",
+			s: `
+			[[interfaces]]
+			names = ["eth1"]
+			trunk = "eth0"
+			vlan = 10
+			`,
+		},
+		{
+			name: "bad VLAN name too long",
+			s: `
+			[[interfaces]]
+			trunk = "enp0s31f6"
+			vlan = 1000
+			`,
+		},
+		{
+			name: "bad duplicate VLAN",
+			s: `
+			[[interfaces]]
+			trunk = "eth0"
+			vlan = 10
+
+			[[interfaces]]
+			name = "vlan10"
+			trunk = "eth0"
+			vlan = 10
+			`,
+		},
+		{
+			name: "bad name and names",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			names = ["eth1"]
+			`,
+		},
+		{
+			name: "bad empty names",
+			s: `
+			[[interfaces]]
+			names = ["eth0", ""]
+			`,
+		},
 		{
 			name: "bad interface",
 			s: `
@@ -65,6 +215,41 @@ func TestParse(t *testing.T) {
 			default_lifetime = "yes"
 			`,
 		},
+		{
+			name: "bad netns",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			netns = "blue"
+			`,
+		},
+		{
+			name: "bad duplicate interface",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+
+			[[interfaces]]
+			name = "eth0"
+			`,
+		},
+		{
+			name: "bad duplicate interface names",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+
+			[[interfaces]]
+			names = ["eth1", "eth0"]
+			`,
+		},
+		{
+			name: "bad duplicate names",
+			s: `
+			[[interfaces]]
+			names = ["eth0", "eth0"]
+			`,
+		},
 		{
 			name: "bad debug address",
 			s: `
@@ -74,6 +259,128 @@ func TestParse(t *testing.T) {
 			address = "xxx"
 			`,
 		},
+		{
+			name: "bad debug banner",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			banner = "site-nyc-edge1\ncontact netops"
+			`,
+		},
+		{
+			name: "bad debug openmetrics",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			openmetrics = true
+			`,
+		},
+		{
+			name: "bad debug max events",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			max_events = -1
+			`,
+		},
+		{
+			name: "bad debug RA flag",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			experimental_ra_flags = ["reserved"]
+			`,
+		},
+		{
+			name: "bad debug RA flag without address",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			experimental_ra_flags = ["reserved"]
+			`,
+		},
+		{
+			name: "bad debug multicast group",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			experimental_multicast_group = "ff05::1::"
+			`,
+		},
+		{
+			name: "bad debug multicast group without address",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			experimental_multicast_group = "ff02::1"
+			`,
+		},
+		{
+			name: "bad debug multicast group scope",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			experimental_multicast_group = "ff02::1"
+			`,
+		},
+		{
+			name: "bad debug multicast group unicast",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			experimental_multicast_group = "2001:db8::1"
+			`,
+		},
+		{
+			name: "bad debug multicast hop limit",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			experimental_multicast_group = "ff05::1"
+			experimental_multicast_hop_limit = 256
+			`,
+		},
+		{
+			name: "bad debug multicast hop limit without group",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			[debug]
+			address = "localhost:9430"
+			experimental_multicast_hop_limit = 8
+			`,
+		},
+		{
+			name: "router address without home agent",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  router_address = true
+			[debug]
+			address = "localhost:9430"
+			experimental_ra_flags = ["home_agent"]
+			`,
+		},
 		{
 			name: "OK minimal defaults",
 			s: `
@@ -81,24 +388,246 @@ func TestParse(t *testing.T) {
 			name = "eth0"
 			`,
 			c: &config.Config{
+				MaxAdvertisers: 1024,
 				Interfaces: []config.Interface{{
 					Name:            "eth0",
 					Monitor:         false,
 					Advertise:       false,
 					MinInterval:     3*time.Minute + 18*time.Second,
 					MaxInterval:     10 * time.Minute,
+					InitialInterval: 16 * time.Second,
+					InitialCount:    3,
 					HopLimit:        64,
 					DefaultLifetime: 30 * time.Minute,
 					UnicastOnly:     false,
 					Preference:      ndp.Medium,
+					SolicitedSends:  1,
+					TransmitRetries: 3,
 					Plugins:         []plugin.Plugin{&plugin.LLA{}},
 				}},
 			},
 			ok: true,
 		},
+		{
+			name: "OK names",
+			s: `
+			[[interfaces]]
+			names = ["eth0", "eth1"]
+			advertise = true
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1024,
+				Interfaces: []config.Interface{
+					namesInterface("eth0"),
+					namesInterface("eth1"),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK max advertisers",
+			s: `
+			max_advertisers = 1
+
+			[[interfaces]]
+			names = ["eth0", "eth1"]
+			advertise = true
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1,
+				Interfaces: []config.Interface{
+					namesInterface("eth0"),
+					func() config.Interface {
+						ifi := namesInterface("eth1")
+						ifi.Advertise = false
+						ifi.Rejected = true
+						return ifi
+					}(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK VLANs",
+			s: `
+			[[interfaces]]
+			trunk = "eth0"
+			vlan = 10
+			monitor = true
+
+			[[interfaces]]
+			name = "vlan20"
+			trunk = "eth0"
+			vlan = 20
+			monitor = true
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1024,
+				Interfaces: []config.Interface{
+					{
+						Name:    "eth0.10",
+						Monitor: true,
+						Trunk:   "eth0",
+						VLAN:    10,
+					},
+					{
+						Name:    "vlan20",
+						Monitor: true,
+						Trunk:   "eth0",
+						VLAN:    20,
+					},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "bad plugin set",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			  [interfaces.solicited]
+			  mtu = 1
+			`,
+		},
+		{
+			name: "bad unused options with plugin sets",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  [interfaces.solicited]
+			  mtu = 1500
+			  [interfaces.unsolicited]
+			  mtu = 1280
+			`,
+		},
+		{
+			name: "OK plugin sets",
+			s: `
+			[[interfaces]]
+			names = ["eth0"]
+			advertise = true
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+
+			  [interfaces.solicited]
+			  mtu = 1500
+			    [[interfaces.solicited.prefix]]
+			    prefix = "::/64"
+
+			  [interfaces.unsolicited]
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1024,
+				Interfaces: []config.Interface{
+					func() config.Interface {
+						ifi := namesInterface("eth0")
+						ifi.SolicitedPlugins = []plugin.Plugin{
+							&plugin.Prefix{
+								Prefix:            crtest.MustIPPrefix("::/64"),
+								OnLink:            true,
+								Autonomous:        true,
+								ValidLifetime:     24 * time.Hour,
+								PreferredLifetime: 4 * time.Hour,
+							},
+							plugin.NewMTU(1500),
+							&plugin.LLA{},
+						}
+						ifi.UnsolicitedPlugins = []plugin.Plugin{&plugin.LLA{}}
+						return ifi
+					}(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK max lifetime",
+			s: `
+			max_lifetime = "1h"
+			forbid_infinite_lifetimes = true
+
+			[[interfaces]]
+			names = ["eth0"]
+			advertise = true
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1024,
+				MaxLifetime:    1 * time.Hour,
+				ForbidInfinite: true,
+				Interfaces: []config.Interface{
+					func() config.Interface {
+						ifi := namesInterface("eth0")
+						ifi.MaxLifetime = 1 * time.Hour
+						return ifi
+					}(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK debug RA flags without address",
+			s: `
+			[[interfaces]]
+			names = ["eth0"]
+			advertise = true
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+
+			[debug]
+			experimental_ra_flags = ["proxy"]
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1024,
+				Interfaces:     []config.Interface{namesInterface("eth0")},
+				Debug: config.Debug{
+					ExperimentalRAFlags: []string{"proxy"},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK debug multicast group without address",
+			s: `
+			[[interfaces]]
+			names = ["eth0"]
+			advertise = true
+
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+
+			[debug]
+			experimental_multicast_group = "ff05::1"
+			`,
+			c: &config.Config{
+				MaxAdvertisers: 1024,
+				Interfaces:     []config.Interface{namesInterface("eth0")},
+				Debug: config.Debug{
+					ExperimentalMulticastGroup:    "ff05::1",
+					ExperimentalMulticastHopLimit: 64,
+				},
+			},
+			ok: true,
+		},
 		{
 			name: "OK all",
 			s: `
+			max_advertisers = 8
+			pace_multicast = true
+
 			[[interfaces]]
 			name = "eth0"
 			advertise = true
@@ -108,6 +637,13 @@ func TestParse(t *testing.T) {
 			default_lifetime = "auto"
 			mtu = 1500
 			preference = "medium"
+			bind_to_device = true
+			wait_for_interface = true
+			shadow = true
+			start_withdrawn = true
+			on_demand_window = "1h"
+			source_address = "fe80::1"
+			home_agent = true
 
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
@@ -116,6 +652,7 @@ func TestParse(t *testing.T) {
 			  prefix = "2001:db8::/64"
 			  autonomous = false
 			  deprecated = true
+			  router_address = true
 
 			  [[interfaces.route]]
 			  prefix = "2001:db8:ffff::/64"
@@ -132,20 +669,40 @@ func TestParse(t *testing.T) {
 			name = "eth1"
 			min_interval = "auto"
 			max_interval = "4s"
+			initial_interval = "3s"
+			initial_count = 5
 			# default hop_limit.
+			adopt_neighbor_hop_limit = true
+			ipv6_only = true
 			default_lifetime = "8s"
+			initial_default_lifetime = "2s"
 			managed = true
 			other_config = true
+			proxy = true
 			reachable_time = "30s"
 			retransmit_timer = "5s"
 			source_lla = true
+			source_lla_unsolicited = false
+			source_lla_override = "02:00:5e:00:53:01"
+			nonce = true
 			preference = "low"
+			transmit_retries = 0
+			conflict_window = "30m"
+			max_size = 1240
 
 			[[interfaces]]
 			name = "eth2"
 			verbose = true
+			debug_log_interval = "10s"
+			lenient_hop_limit = true
 			hop_limit = 0
 			unicast_only = true
+			separate_solicited_multicast = true
+			solicited_sends = 3
+			solicited_send_interval = "50ms"
+			track_link_state = true
+			link_hysteresis = "5s"
+			receive_grace_period = "10s"
 			source_lla = false
 			preference = "high"
 
@@ -153,28 +710,61 @@ func TestParse(t *testing.T) {
 			name = "eth3"
 			monitor = true
 			verbose = true
+			lenient_hop_limit = true
+			source_address = "lowest"
+			netns = "/var/run/netns/blue"
 
 			[[interfaces]]
 			name = "eth4"
 			advertise = true
 			default_lifetime = ""
+			reachable_time_min = "20s"
+			reachable_time_max = "40s"
+			retransmit_timer_min = "1s"
+			retransmit_timer_max = "1500ms"
+
+			  [interfaces.upstream]
+			  interval = "10s"
+
+			  [interfaces.vrrp]
+			  address = "fe80::1"
 
 			[debug]
 			address = "localhost:9430"
 			prometheus = true
 			pprof = true
+			ndp_diagnostics = true
+			token = "secret"
+			banner = "site-nyc-edge1"
+			strict_http = true
+			experimental_ra_flags = ["home_agent", "proxy"]
+			experimental_multicast_group = "ff05::1"
 			`,
 			c: &config.Config{
+				MaxAdvertisers: 8,
+				PaceMulticast:  true,
 				Interfaces: []config.Interface{
 					{
-						Name:            "eth0",
-						Advertise:       true,
-						MinInterval:     6 * time.Minute,
-						MaxInterval:     10 * time.Minute,
-						HopLimit:        64,
-						DefaultLifetime: 30 * time.Minute,
-						Preference:      ndp.Medium,
-						UnicastOnly:     false,
+						Name:             "eth0",
+						Advertise:        true,
+						Shadow:           true,
+						StartWithdrawn:   true,
+						SourcePolicy:     system.SourceExact,
+						SourceAddress:    crtest.MustIP("fe80::1"),
+						MinInterval:      6 * time.Minute,
+						MaxInterval:      10 * time.Minute,
+						InitialInterval:  16 * time.Second,
+						InitialCount:     3,
+						HopLimit:         64,
+						DefaultLifetime:  30 * time.Minute,
+						Preference:       ndp.Medium,
+						HomeAgent:        true,
+						UnicastOnly:      false,
+						BindToDevice:     true,
+						WaitForInterface: true,
+						SolicitedSends:   1,
+						TransmitRetries:  3,
+						OnDemandWindow:   1 * time.Hour,
 						Plugins: []plugin.Plugin{
 							&plugin.Prefix{
 								Prefix:            crtest.MustIPPrefix("::/64"),
@@ -190,6 +780,7 @@ func TestParse(t *testing.T) {
 								ValidLifetime:     24 * time.Hour,
 								PreferredLifetime: 4 * time.Hour,
 								Deprecated:        true,
+								RouterAddress:     true,
 							},
 							&plugin.Route{
 								Prefix:     crtest.MustIPPrefix("2001:db8:ffff::/64"),
@@ -197,12 +788,14 @@ func TestParse(t *testing.T) {
 								Lifetime:   24 * time.Hour,
 							},
 							&plugin.RDNSS{
-								Lifetime: 20 * time.Minute,
-								Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+								Lifetime:   20 * time.Minute,
+								Servers:    []netaddr.IP{crtest.MustIP("2001:db8::1")},
+								MaxServers: 3,
 							},
 							&plugin.DNSSL{
-								Lifetime:    20 * time.Minute,
-								DomainNames: []string{"lan.example.com"},
+								Lifetime:       20 * time.Minute,
+								DomainNames:    []string{"lan.example.com"},
+								MaxDomainNames: 3,
 							},
 							plugin.NewMTU(1500),
 							&plugin.LLA{},
@@ -213,45 +806,101 @@ func TestParse(t *testing.T) {
 						Advertise:       false,
 						MinInterval:     4 * time.Second,
 						MaxInterval:     4 * time.Second,
+						InitialInterval: 3 * time.Second,
+						InitialCount:    5,
 						HopLimit:        64,
 						Managed:         true,
 						OtherConfig:     true,
+						Proxy:           true,
 						ReachableTime:   30 * time.Second,
 						RetransmitTimer: 5 * time.Second,
 						DefaultLifetime: 8 * time.Second,
 						Preference:      ndp.Low,
-						Plugins:         []plugin.Plugin{&plugin.LLA{}},
+						ConflictWindow:  30 * time.Minute,
+						MaxSize:         1240,
+						IPv6Only:        true,
+
+						AdoptNeighborHopLimit:  true,
+						InitialDefaultLifetime: 2 * time.Second,
+						SolicitedOnlyLLA:       true,
+						SourceLLAOverride:      net.HardwareAddr{0x02, 0x00, 0x5e, 0x00, 0x53, 0x01},
+						SolicitedSends:         1,
+						Plugins:                []plugin.Plugin{&plugin.Nonce{}, &plugin.LLA{}},
 					},
 					{
 						Name:            "eth2",
 						Advertise:       false,
 						Verbose:         true,
+						LenientHopLimit: true,
 						MinInterval:     3*time.Minute + 18*time.Second,
 						MaxInterval:     10 * time.Minute,
+						InitialInterval: 16 * time.Second,
+						InitialCount:    3,
 						HopLimit:        0,
 						DefaultLifetime: 30 * time.Minute,
 						UnicastOnly:     true,
 						Preference:      ndp.High,
 						Plugins:         []plugin.Plugin{},
+
+						SeparateSolicitedMulticast: true,
+						SolicitedSends:             3,
+						SolicitedSendInterval:      50 * time.Millisecond,
+						TransmitRetries:            3,
+						DebugLogInterval:           10 * time.Second,
+						TrackLinkState:             true,
+						LinkHysteresis:             5 * time.Second,
+						ReceiveGracePeriod:         10 * time.Second,
 					},
 					{
-						Name:    "eth3",
-						Monitor: true,
-						Verbose: true,
+						Name:            "eth3",
+						Monitor:         true,
+						Verbose:         true,
+						LenientHopLimit: true,
+						Netns:           "/var/run/netns/blue",
+						SourcePolicy:    system.SourceLowest,
 					},
 					{
-						Name:        "eth4",
-						Advertise:   true,
-						MinInterval: 3*time.Minute + 18*time.Second,
-						MaxInterval: 10 * time.Minute,
-						HopLimit:    64,
-						Plugins:     []plugin.Plugin{&plugin.LLA{}},
+						Name:            "eth4",
+						Advertise:       true,
+						MinInterval:     3*time.Minute + 18*time.Second,
+						MaxInterval:     10 * time.Minute,
+						InitialInterval: 16 * time.Second,
+						InitialCount:    3,
+						HopLimit:        64,
+						ReachableTime:   20 * time.Second,
+						RetransmitTimer: 1 * time.Second,
+						SolicitedSends:  1,
+						TransmitRetries: 3,
+						Plugins: []plugin.Plugin{
+							&plugin.Upstream{
+								Interval:   10 * time.Second,
+								Hysteresis: 3,
+							},
+							&plugin.VRRP{
+								Interval:   1 * time.Second,
+								Hysteresis: 2,
+								Address:    crtest.MustIP("fe80::1"),
+							},
+							&plugin.LLA{},
+						},
+
+						ReachableTimeMax:   40 * time.Second,
+						RetransmitTimerMax: 1500 * time.Millisecond,
 					},
 				},
 				Debug: config.Debug{
-					Address:    "localhost:9430",
-					Prometheus: true,
-					PProf:      true,
+					Address:        "localhost:9430",
+					Prometheus:     true,
+					PProf:          true,
+					NDPDiagnostics: true,
+					Token:          "secret",
+					Banner:         "site-nyc-edge1",
+					StrictHTTP:     true,
+					MaxEvents:      256,
+
+					ExperimentalRAFlags:           []string{"home_agent", "proxy"},
+					ExperimentalMulticastGroup:    "ff05::1",
+					ExperimentalMulticastHopLimit: 64,
 				},
 			},
 			ok: true,
@@ -272,13 +921,44 @@ func TestParse(t *testing.T) {
 				return
 			}
 
-			if diff := cmp.Diff(tt.c, c, cmp.Comparer(compareNetaddrIP)); diff != "" {
+			opts := []cmp.Option{
+				cmp.Comparer(compareNetaddrIP),
+				cmpopts.IgnoreUnexported(plugin.DelegatedPrefix{}, plugin.RDNSS{}, plugin.Upstream{}, plugin.VRRP{}),
+			}
+
+			if diff := cmp.Diff(tt.c, c, opts...); diff != "" {
 				t.Fatalf("unexpected Config (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
+func TestParseDuplicateInterface(t *testing.T) {
+	t.Parallel()
+
+	const s = `
+	[[interfaces]]
+	name = "eth0"
+
+	[[interfaces]]
+	name = "eth1"
+
+	[[interfaces]]
+	names = ["eth2", "eth0"]
+	`
+
+	_, err := config.Parse(strings.NewReader(s), time.Time{})
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	// The error must name the duplicate and both of its locations.
+	const want = `interface 2: duplicate interface "eth0", already configured by interface 0`
+	if diff := cmp.Diff(want, err.Error()); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+}
+
 func TestParseDefaults(t *testing.T) {
 	t.Parallel()
 
@@ -356,6 +1036,34 @@ func TestInterfaceRouterAdvertisement(t *testing.T) {
 				RouterLifetime:  30 * time.Minute,
 			},
 		},
+		{
+			name: "proxy",
+			ifi: config.Interface{
+				HopLimit:        64,
+				DefaultLifetime: 30 * time.Minute,
+				Proxy:           true,
+			},
+			forwarding: true,
+			ra: &ndp.RouterAdvertisement{
+				CurrentHopLimit:        64,
+				NeighborDiscoveryProxy: true,
+				RouterLifetime:         30 * time.Minute,
+			},
+		},
+		{
+			name: "home agent",
+			ifi: config.Interface{
+				HopLimit:        64,
+				DefaultLifetime: 30 * time.Minute,
+				HomeAgent:       true,
+			},
+			forwarding: true,
+			ra: &ndp.RouterAdvertisement{
+				CurrentHopLimit:     64,
+				MobileIPv6HomeAgent: true,
+				RouterLifetime:      30 * time.Minute,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -373,4 +1081,525 @@ func TestInterfaceRouterAdvertisement(t *testing.T) {
 	}
 }
 
+func TestInterfaceBuildRandomTimers(t *testing.T) {
+	ifi := config.Interface{
+		HopLimit:           64,
+		ReachableTime:      20 * time.Second,
+		ReachableTimeMax:   40 * time.Second,
+		RetransmitTimer:    1 * time.Second,
+		RetransmitTimerMax: 1001 * time.Millisecond,
+	}
+
+	// Each router advertisement chooses its own timers, which must always
+	// stay within the configured ranges.
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		ra, _, err := ifi.Build(true, config.UnsolicitedSet)
+		if err != nil {
+			t.Fatalf("failed to build router advertisement: %v", err)
+		}
+
+		if d := ra.ReachableTime; d < ifi.ReachableTime || d > ifi.ReachableTimeMax {
+			t.Fatalf("reachable time %s is outside of the configured range", d)
+		}
+		if d := ra.RetransmitTimer; d < ifi.RetransmitTimer || d > ifi.RetransmitTimerMax {
+			t.Fatalf("retransmit timer %s is outside of the configured range", d)
+		}
+		if ra.ReachableTime%time.Millisecond != 0 {
+			t.Fatalf("reachable time %s is not a whole number of milliseconds", ra.ReachableTime)
+		}
+
+		seen[ra.ReachableTime] = true
+	}
+
+	if len(seen) < 2 {
+		t.Fatalf("expected varying reachable times, but got: %v", seen)
+	}
+}
+
+func TestInterfaceBuildMaxSize(t *testing.T) {
+	ifi := config.Interface{
+		HopLimit: 64,
+		// Room for exactly one MTU option.
+		MaxSize: 16 + 8,
+		Plugins: []plugin.Plugin{
+			plugin.NewMTU(1500),
+			&plugin.DNSSL{
+				Lifetime:    10 * time.Second,
+				DomainNames: []string{"foo.example.com"},
+			},
+			// Adds no options and is always applied.
+			&plugin.ManagedPrefix{
+				Prefix: crtest.MustIPPrefix("2001:db8::/32"),
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{&net.IPNet{
+						IP:   net.ParseIP("2001:db8::1"),
+						Mask: net.CIDRMask(64, 128),
+					}}, nil
+				},
+			},
+			// Would fit, but is lower priority than the dropped DNSSL.
+			plugin.NewMTU(9000),
+		},
+	}
+
+	ra, dropped, err := ifi.Build(true, config.UnsolicitedSet)
+	if err != nil {
+		t.Fatalf("failed to build router advertisement: %v", err)
+	}
+
+	want := &ndp.RouterAdvertisement{
+		CurrentHopLimit:      64,
+		ManagedConfiguration: true,
+		Options:              []ndp.Option{ndp.NewMTU(1500)},
+	}
+
+	if diff := cmp.Diff(want, ra); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+
+	var names []string
+	for _, p := range dropped {
+		names = append(names, p.Name())
+	}
+
+	if diff := cmp.Diff([]string{"dnssl", "mtu"}, names); diff != "" {
+		t.Fatalf("unexpected dropped plugins (-want +got):\n%s", diff)
+	}
+}
+
+func TestInterfaceBuildPluginSets(t *testing.T) {
+	ifi := config.Interface{
+		HopLimit:         64,
+		Plugins:          []plugin.Plugin{plugin.NewMTU(1500)},
+		SolicitedPlugins: []plugin.Plugin{plugin.NewMTU(9000)},
+	}
+
+	tests := []struct {
+		set config.PluginSet
+		mtu int
+	}{
+		{set: config.UnsolicitedSet, mtu: 1500},
+		{set: config.SolicitedSet, mtu: 9000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.set.String(), func(t *testing.T) {
+			ra, _, err := ifi.Build(true, tt.set)
+			if err != nil {
+				t.Fatalf("failed to build router advertisement: %v", err)
+			}
+
+			want := &ndp.RouterAdvertisement{
+				CurrentHopLimit: 64,
+				Options:         []ndp.Option{ndp.NewMTU(uint32(tt.mtu))},
+			}
+
+			if diff := cmp.Diff(want, ra); diff != "" {
+				t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInterfaceBuildPluginSetMTU(t *testing.T) {
+	tests := []struct {
+		name                   string
+		s                      string
+		solicited, unsolicited []ndp.Option
+	}{
+		{
+			name: "solicited only",
+			s: `
+			[interfaces.solicited]
+			mtu = 9000
+			`,
+			solicited: []ndp.Option{ndp.NewMTU(9000)},
+		},
+		{
+			name: "unsolicited only",
+			s: `
+			[interfaces.unsolicited]
+			mtu = 1280
+			`,
+			unsolicited: []ndp.Option{ndp.NewMTU(1280)},
+		},
+		{
+			name: "conservative unsolicited",
+			s: `
+			mtu = 9000
+			[interfaces.unsolicited]
+			mtu = 1280
+			`,
+			solicited:   []ndp.Option{ndp.NewMTU(9000)},
+			unsolicited: []ndp.Option{ndp.NewMTU(1280)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := config.Parse(strings.NewReader(`
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			source_lla = false
+			`+tt.s), time.Time{})
+			if err != nil {
+				t.Fatalf("failed to parse config: %v", err)
+			}
+
+			ifi := c.Interfaces[0]
+			for _, set := range []struct {
+				set  config.PluginSet
+				want []ndp.Option
+			}{
+				{set: config.SolicitedSet, want: tt.solicited},
+				{set: config.UnsolicitedSet, want: tt.unsolicited},
+			} {
+				ra, _, err := ifi.Build(true, set.set)
+				if err != nil {
+					t.Fatalf("failed to build %s router advertisement: %v", set.set, err)
+				}
+
+				if diff := cmp.Diff(set.want, ra.Options, cmpopts.EquateEmpty()); diff != "" {
+					t.Fatalf("unexpected %s options (-want +got):\n%s", set.set, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestInterfaceBuildMaxLifetime(t *testing.T) {
+	var clamped []string
+	ifi := config.Interface{
+		DefaultLifetime: 30 * time.Minute,
+		MaxLifetime:     1 * time.Hour,
+		OnLifetimeClamp: func(lifetime string, _ time.Duration) {
+			clamped = append(clamped, lifetime)
+		},
+		Plugins: []plugin.Plugin{
+			&plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     ndp.Infinity,
+			},
+			&plugin.Route{
+				Prefix:   crtest.MustIPPrefix("2001:db8:ffff::/64"),
+				Lifetime: 99999 * time.Hour,
+			},
+			&plugin.RDNSS{
+				Lifetime: 2 * time.Hour,
+				Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+			},
+			&plugin.DNSSL{
+				Lifetime:    ndp.Infinity,
+				DomainNames: []string{"foo.example.com"},
+			},
+			// Within the maximum.
+			&plugin.Route{
+				Prefix:   crtest.MustIPPrefix("2001:db8:eeee::/64"),
+				Lifetime: 1 * time.Hour,
+			},
+		},
+	}
+
+	ra, _, err := ifi.Build(true, config.UnsolicitedSet)
+	if err != nil {
+		t.Fatalf("failed to build router advertisement: %v", err)
+	}
+
+	if ra.RouterLifetime != 30*time.Minute {
+		t.Fatalf("unexpected router lifetime: %s", ra.RouterLifetime)
+	}
+
+	for _, o := range ra.Options {
+		var ds []time.Duration
+		switch o := o.(type) {
+		case *ndp.PrefixInformation:
+			ds = []time.Duration{o.ValidLifetime, o.PreferredLifetime}
+		case *ndp.RouteInformation:
+			ds = []time.Duration{o.RouteLifetime}
+		case *ndp.RecursiveDNSServer:
+			ds = []time.Duration{o.Lifetime}
+		case *ndp.DNSSearchList:
+			ds = []time.Duration{o.Lifetime}
+		default:
+			t.Fatalf("unexpected option: %#v", o)
+		}
+
+		for _, d := range ds {
+			if d != 1*time.Hour {
+				t.Fatalf("lifetime was not clamped to 1h: %s", d)
+			}
+		}
+	}
+
+	want := []string{
+		"prefix 2001:db8::/64 valid lifetime",
+		"prefix 2001:db8::/64 preferred lifetime",
+		"route 2001:db8:ffff::/64 lifetime",
+		"rdnss lifetime",
+		"dnssl lifetime",
+	}
+
+	if diff := cmp.Diff(want, clamped); diff != "" {
+		t.Fatalf("unexpected clamped lifetimes (-want +got):\n%s", diff)
+	}
+
+	// The router lifetime is also clamped.
+	clamped = nil
+	ifi.DefaultLifetime = 2 * time.Hour
+	ifi.Plugins = nil
+
+	ra, _, err = ifi.Build(true, config.UnsolicitedSet)
+	if err != nil {
+		t.Fatalf("failed to build router advertisement: %v", err)
+	}
+
+	if ra.RouterLifetime != 1*time.Hour {
+		t.Fatalf("router lifetime was not clamped to 1h: %s", ra.RouterLifetime)
+	}
+	if diff := cmp.Diff([]string{"router lifetime"}, clamped); diff != "" {
+		t.Fatalf("unexpected clamped lifetimes (-want +got):\n%s", diff)
+	}
+}
+
+func TestInterfaceBuildMaxLifetimeRouterAddress(t *testing.T) {
+	var clamped []string
+	ifi := config.Interface{
+		MaxLifetime: 1 * time.Hour,
+		HomeAgent:   true,
+		OnLifetimeClamp: func(lifetime string, _ time.Duration) {
+			clamped = append(clamped, lifetime)
+		},
+		Plugins: []plugin.Plugin{
+			&plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				OnLink:            true,
+				RouterAddress:     true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     ndp.Infinity,
+
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{&net.IPNet{
+						IP:   net.ParseIP("2001:db8::1"),
+						Mask: net.CIDRMask(64, 128),
+					}}, nil
+				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) { return nil, nil },
+			},
+		},
+	}
+
+	ra, _, err := ifi.Build(true, config.UnsolicitedSet)
+	if err != nil {
+		t.Fatalf("failed to build router advertisement: %v", err)
+	}
+
+	// The router address must still be advertised with the router address
+	// flag, but with clamped lifetimes.
+	want := []ndp.Option{
+		plugin.RouterAddressOption(&ndp.PrefixInformation{
+			PrefixLength:      64,
+			OnLink:            true,
+			ValidLifetime:     1 * time.Hour,
+			PreferredLifetime: 1 * time.Hour,
+			Prefix:            net.ParseIP("2001:db8::1"),
+		}),
+	}
+
+	if diff := cmp.Diff(want, ra.Options); diff != "" {
+		t.Fatalf("unexpected options (-want +got):\n%s", diff)
+	}
+
+	wantClamped := []string{
+		"prefix 2001:db8::1/64 valid lifetime",
+		"prefix 2001:db8::1/64 preferred lifetime",
+	}
+
+	if diff := cmp.Diff(wantClamped, clamped); diff != "" {
+		t.Fatalf("unexpected clamped lifetimes (-want +got):\n%s", diff)
+	}
+}
+
+func TestInterfaceWarnings(t *testing.T) {
+	var (
+		slaac = &plugin.Prefix{
+			Prefix:     crtest.MustIPPrefix("2001:db8::/64"),
+			OnLink:     true,
+			Autonomous: true,
+		}
+
+		dhcpv6 = &plugin.Prefix{
+			Prefix: crtest.MustIPPrefix("2001:db8:ffff::/64"),
+			OnLink: true,
+		}
+
+		servers = []netaddr.IP{
+			crtest.MustIP("2001:db8::1"),
+			crtest.MustIP("2001:db8::2"),
+		}
+
+		domains = []string{"foo.example.com", "bar.example.com"}
+	)
+
+	tests := []struct {
+		name     string
+		ifi      config.Interface
+		warnings []string
+	}{
+		{
+			name: "autonomous",
+			ifi:  config.Interface{Plugins: []plugin.Plugin{slaac}},
+		},
+		{
+			name: "not autonomous managed",
+			ifi: config.Interface{
+				Managed: true,
+				Plugins: []plugin.Plugin{slaac, dhcpv6},
+			},
+		},
+		{
+			name: "not autonomous other config",
+			ifi: config.Interface{
+				OtherConfig: true,
+				Plugins:     []plugin.Plugin{slaac, dhcpv6},
+			},
+			warnings: []string{
+				"prefix 2001:db8:ffff::/64 is not autonomous but managed is false, hosts may not acquire addresses from it",
+			},
+		},
+		{
+			name: "autonomous /48",
+			ifi: config.Interface{
+				Plugins: []plugin.Plugin{&plugin.Prefix{
+					Prefix:     crtest.MustIPPrefix("2001:db8::/48"),
+					OnLink:     true,
+					Autonomous: true,
+				}},
+			},
+			warnings: []string{
+				"autonomous prefix 2001:db8::/48 must have a /64 length for hosts to use SLAAC",
+			},
+		},
+		{
+			name: "on-link /48",
+			ifi: config.Interface{
+				Managed: true,
+				Plugins: []plugin.Plugin{&plugin.Prefix{
+					Prefix: crtest.MustIPPrefix("2001:db8::/48"),
+					OnLink: true,
+				}},
+			},
+		},
+		{
+			name: "default route consistent",
+			ifi: config.Interface{
+				DefaultLifetime: 30 * time.Minute,
+				Preference:      ndp.Low,
+				Plugins: []plugin.Plugin{
+					&plugin.Route{
+						Prefix:     crtest.MustIPPrefix("::/0"),
+						Preference: ndp.Low,
+						Lifetime:   30 * time.Minute,
+					},
+					&plugin.Route{
+						Prefix:     crtest.MustIPPrefix("2001:db8::/32"),
+						Preference: ndp.High,
+						Lifetime:   30 * time.Minute,
+					},
+				},
+			},
+		},
+		{
+			name: "default route inconsistent",
+			ifi: config.Interface{
+				Preference: ndp.Medium,
+				Plugins: []plugin.Plugin{
+					&plugin.Route{
+						Prefix:     crtest.MustIPPrefix("::/0"),
+						Preference: ndp.Low,
+						Lifetime:   30 * time.Minute,
+					},
+				},
+			},
+			warnings: []string{
+				"route ::/0 has a lifetime of 30m0s but default_lifetime is 0, only some hosts will use this router as a default router",
+				"route ::/0 has preference low but the router preference is medium, hosts may disagree on this router's preference",
+			},
+		},
+		{
+			name: "DNS within limits",
+			ifi: config.Interface{
+				Plugins: []plugin.Plugin{
+					&plugin.RDNSS{Servers: servers, MaxServers: 2},
+					&plugin.DNSSL{DomainNames: domains},
+				},
+			},
+		},
+		{
+			name: "DNS warn",
+			ifi: config.Interface{
+				Plugins: []plugin.Plugin{
+					&plugin.RDNSS{Servers: servers, MaxServers: 1},
+					&plugin.DNSSL{DomainNames: domains, MaxDomainNames: 1},
+				},
+			},
+			warnings: []string{
+				"rdnss has 2 servers, but hosts may only use the first 1",
+				"dnssl has 2 domain names, but hosts may only use the first 1",
+			},
+		},
+		{
+			name: "DNS truncate",
+			ifi: config.Interface{
+				Plugins: []plugin.Plugin{
+					&plugin.RDNSS{Servers: servers, MaxServers: 1, Truncate: true},
+					&plugin.DNSSL{DomainNames: domains, MaxDomainNames: 1, Truncate: true},
+				},
+			},
+			warnings: []string{
+				"rdnss has 2 servers, truncating to the first 1",
+				"dnssl has 2 domain names, truncating to the first 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.warnings, tt.ifi.Warnings()); diff != "" {
+				t.Fatalf("unexpected warnings (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// namesInterface produces the expected Interface for name in the "OK names"
+// test case.
+func namesInterface(name string) config.Interface {
+	return config.Interface{
+		Name:            name,
+		Advertise:       true,
+		MinInterval:     3*time.Minute + 18*time.Second,
+		MaxInterval:     10 * time.Minute,
+		InitialInterval: 16 * time.Second,
+		InitialCount:    3,
+		HopLimit:        64,
+		DefaultLifetime: 30 * time.Minute,
+		Preference:      ndp.Medium,
+		SolicitedSends:  1,
+		TransmitRetries: 3,
+		Plugins: []plugin.Plugin{
+			&plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				ValidLifetime:     24 * time.Hour,
+				PreferredLifetime: 4 * time.Hour,
+			},
+			&plugin.LLA{},
+		},
+	}
+}
+
 func compareNetaddrIP(x, y netaddr.IP) bool { return x == y }
@@ -0,0 +1,117 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mdlayher/corerad/internal/plugin"
+)
+
+// Diff summarizes the differences between the configurations prev and next as
+// human-readable strings. Plugins are compared using their names and string
+// representations, so plugins which report runtime state in their string
+// representations may also appear to have changed.
+func Diff(prev, next Config) []string {
+	var changes []string
+	if prev.MaxAdvertisers != next.MaxAdvertisers {
+		changes = append(changes, fmt.Sprintf("max_advertisers changed from %d to %d",
+			prev.MaxAdvertisers, next.MaxAdvertisers))
+	}
+
+	if prev.PaceMulticast != next.PaceMulticast {
+		changes = append(changes, fmt.Sprintf("pace_multicast changed from %t to %t",
+			prev.PaceMulticast, next.PaceMulticast))
+	}
+
+	if prev.MaxLifetime != next.MaxLifetime {
+		changes = append(changes, fmt.Sprintf("max_lifetime changed from %s to %s",
+			prev.MaxLifetime, next.MaxLifetime))
+	}
+
+	if prev.ForbidInfinite != next.ForbidInfinite {
+		changes = append(changes, fmt.Sprintf("forbid_infinite_lifetimes changed from %t to %t",
+			prev.ForbidInfinite, next.ForbidInfinite))
+	}
+
+	if prev.StrictAutonomous != next.StrictAutonomous {
+		changes = append(changes, fmt.Sprintf("strict_autonomous_prefixes changed from %t to %t",
+			prev.StrictAutonomous, next.StrictAutonomous))
+	}
+
+	if !reflect.DeepEqual(prev.Debug, next.Debug) {
+		changes = append(changes, "debug configuration changed")
+	}
+
+	prevs := make(map[string]Interface, len(prev.Interfaces))
+	for _, ifi := range prev.Interfaces {
+		prevs[ifi.Name] = ifi
+	}
+
+	nexts := make(map[string]struct{}, len(next.Interfaces))
+	for _, ifi := range next.Interfaces {
+		nexts[ifi.Name] = struct{}{}
+
+		p, ok := prevs[ifi.Name]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("interface %q added", ifi.Name))
+		case !interfacesEqual(p, ifi):
+			changes = append(changes, fmt.Sprintf("interface %q changed", ifi.Name))
+		}
+	}
+
+	for _, ifi := range prev.Interfaces {
+		if _, ok := nexts[ifi.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("interface %q removed", ifi.Name))
+		}
+	}
+
+	return changes
+}
+
+// interfacesEqual reports whether the configurations of a and b are equal.
+func interfacesEqual(a, b Interface) bool {
+	if !pluginsEqual(a.Plugins, b.Plugins) ||
+		!pluginsEqual(a.SolicitedPlugins, b.SolicitedPlugins) ||
+		!pluginsEqual(a.UnsolicitedPlugins, b.UnsolicitedPlugins) {
+		return false
+	}
+
+	// Plugins hold functions and runtime state, so they are compared
+	// separately. Hooks are never equal.
+	a.Plugins, b.Plugins = nil, nil
+	a.SolicitedPlugins, b.SolicitedPlugins = nil, nil
+	a.UnsolicitedPlugins, b.UnsolicitedPlugins = nil, nil
+	a.OnLifetimeClamp, b.OnLifetimeClamp = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// pluginsEqual reports whether the plugins in a and b are equal. A nil plugin
+// set is never equal to a non-nil one, as the latter replaces Plugins.
+func pluginsEqual(a, b []plugin.Plugin) bool {
+	if len(a) != len(b) || (a == nil) != (b == nil) {
+		return false
+	}
+
+	for i := range a {
+		pa, pb := a[i], b[i]
+		if pa.Name() != pb.Name() || pa.String() != pb.String() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/plugin"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	base := Config{
+		MaxAdvertisers: 1,
+		Interfaces: []Interface{
+			{
+				Name:      "eth0",
+				Advertise: true,
+				Plugins:   []plugin.Plugin{plugin.NewMTU(1500)},
+			},
+			{
+				Name:    "eth1",
+				Monitor: true,
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		next    func(c Config) Config
+		changes []string
+	}{
+		{
+			name: "unchanged",
+			next: func(c Config) Config { return c },
+		},
+		{
+			name: "global",
+			next: func(c Config) Config {
+				c.MaxAdvertisers = 2
+				c.PaceMulticast = true
+				c.MaxLifetime = 1 * time.Hour
+				c.ForbidInfinite = true
+				c.StrictAutonomous = true
+				c.Debug.Address = "localhost:9430"
+				return c
+			},
+			changes: []string{
+				"max_advertisers changed from 1 to 2",
+				"pace_multicast changed from false to true",
+				"max_lifetime changed from 0s to 1h0m0s",
+				"forbid_infinite_lifetimes changed from false to true",
+				"strict_autonomous_prefixes changed from false to true",
+				"debug configuration changed",
+			},
+		},
+		{
+			name: "interfaces",
+			next: func(c Config) Config {
+				c.Interfaces = []Interface{
+					{
+						Name:        "eth0",
+						Advertise:   true,
+						MaxInterval: 10 * time.Minute,
+						Plugins:     []plugin.Plugin{plugin.NewMTU(1500)},
+					},
+					{
+						Name:    "eth2",
+						Monitor: true,
+					},
+				}
+				return c
+			},
+			changes: []string{
+				`interface "eth0" changed`,
+				`interface "eth2" added`,
+				`interface "eth1" removed`,
+			},
+		},
+		{
+			name: "plugin",
+			next: func(c Config) Config {
+				c.Interfaces = []Interface{
+					{
+						Name:      "eth0",
+						Advertise: true,
+						Plugins:   []plugin.Plugin{plugin.NewMTU(9000)},
+					},
+					c.Interfaces[1],
+				}
+				return c
+			},
+			changes: []string{`interface "eth0" changed`},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.changes, Diff(base, tt.next(base))); diff != "" {
+				t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IsRemote reports whether path refers to a remote configuration file which
+// must be retrieved using Fetch, rather than a local file.
+func IsRemote(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// Fetch fetches a configuration file from addr using c. The configuration
+// is verified using Parse so that an invalid configuration is never returned
+// or cached. If c is nil, a default http.Client is used.
+func Fetch(ctx context.Context, c *http.Client, addr string) ([]byte, error) {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", res.Status)
+	}
+
+	// Don't consume a stream larger than a sane upper bound. A truncated
+	// configuration may still parse, so a larger body is an error rather than
+	// being silently cut off.
+	const mb = 1 << 20
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, mb+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if len(b) > mb {
+		return nil, fmt.Errorf("configuration exceeds the maximum size of %d bytes", mb)
+	}
+
+	if _, err := Parse(bytes.NewReader(b), time.Time{}); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	return b, nil
+}
+
+// WriteCache atomically writes the configuration file b to path, so that a
+// failed write never leaves a partial configuration file in place. The file
+// is only readable by its owner, as the configuration may contain secrets.
+func WriteCache(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary cache file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close cache file: %v", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace cache file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/config"
+)
+
+func TestIsRemote(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{path: "corerad.toml"},
+		{path: "/etc/corerad/config.toml"},
+		{path: "file:///etc/corerad/config.toml"},
+		{path: "http://config.example.com/corerad.toml", ok: true},
+		{path: "https://config.example.com/corerad.toml", ok: true},
+	}
+
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.ok, config.IsRemote(tt.path)); diff != "" {
+			t.Fatalf("unexpected remote result for %q (-want +got):\n%s", tt.path, diff)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	const valid = `
+[[interfaces]]
+name = "eth0"
+advertise = true
+`
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		ok     bool
+	}{
+		{
+			name:   "not found",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "invalid configuration",
+			status: http.StatusOK,
+			body:   `[[interfaces]]`,
+		},
+		{
+			// Truncating the comment would produce a valid configuration.
+			name:   "too large",
+			status: http.StatusOK,
+			body:   valid + "# " + strings.Repeat("x", 1<<20) + "\n",
+		},
+		{
+			name:   "OK",
+			status: http.StatusOK,
+			body:   valid,
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			b, err := config.Fetch(context.Background(), srv.Client(), srv.URL)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to fetch: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.body, string(b)); diff != "" {
+				t.Fatalf("unexpected configuration (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteCache(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "corerad-config-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "corerad.toml")
+
+	// Each write replaces the previous cache without leaving temporary files.
+	for _, s := range []string{"first", "second"} {
+		if err := config.WriteCache(path, []byte(s)); err != nil {
+			t.Fatalf("failed to write cache: %v", err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read cache: %v", err)
+		}
+
+		if diff := cmp.Diff(s, string(b)); diff != "" {
+			t.Fatalf("unexpected cache contents (-want +got):\n%s", diff)
+		}
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(fis)); diff != "" {
+		t.Fatalf("unexpected number of files (-want +got):\n%s", diff)
+	}
+}
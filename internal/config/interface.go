@@ -16,9 +16,13 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"time"
 
+	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
+	"inet.af/netaddr"
 )
 
 // parseInterfaces parses a rawInterface into an Interface.
@@ -28,12 +32,40 @@ func parseInterface(ifi rawInterface, epoch time.Time) (*Interface, error) {
 		return nil, errors.New("monitor and advertise mode are mutually exclusive")
 	}
 
+	// shadow only changes how advertise sends router advertisements.
+	if ifi.Shadow && !ifi.Advertise {
+		return nil, errors.New("shadow mode requires advertise mode")
+	}
+
+	if ifi.StartWithdrawn && !ifi.Advertise {
+		return nil, errors.New("start withdrawn requires advertise mode")
+	}
+
+	policy, source, err := parseSourceAddress(ifi.SourceAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	// The namespace itself is verified at startup, since the configuration
+	// may be checked on another machine.
+	if ifi.Netns != "" && !filepath.IsAbs(ifi.Netns) {
+		return nil, fmt.Errorf("network namespace path %q must be absolute", ifi.Netns)
+	}
+
 	// monitor short-circuits all advertising configuration.
 	if ifi.Monitor {
 		return &Interface{
-			Name:    ifi.Name,
-			Monitor: ifi.Monitor,
-			Verbose: ifi.Verbose,
+			Name:             ifi.Name,
+			Monitor:          ifi.Monitor,
+			Verbose:          ifi.Verbose,
+			LenientHopLimit:  ifi.LenientHopLimit,
+			BindToDevice:     ifi.BindToDevice,
+			Netns:            ifi.Netns,
+			Trunk:            ifi.Trunk,
+			VLAN:             ifi.VLAN,
+			WaitForInterface: ifi.WaitForInterface,
+			SourcePolicy:     policy,
+			SourceAddress:    source,
 		}, nil
 	}
 
@@ -60,31 +92,41 @@ func parseInterface(ifi rawInterface, epoch time.Time) (*Interface, error) {
 		return nil, err
 	}
 
-	var reachable time.Duration
-	if ifi.ReachableTime != "" {
-		d, err := time.ParseDuration(ifi.ReachableTime)
+	// RFC defaults for MAX_INITIAL_RTR_ADVERT_INTERVAL and
+	// MAX_INITIAL_RTR_ADVERTISEMENTS.
+	initialInterval := 16 * time.Second
+	if ifi.InitialInterval != "" {
+		d, err := time.ParseDuration(ifi.InitialInterval)
 		if err != nil {
-			return nil, fmt.Errorf("invalid reachable time: %v", err)
+			return nil, fmt.Errorf("invalid initial interval: %v", err)
+		}
+
+		if d < 3*time.Second || d > maxInterval {
+			return nil, fmt.Errorf("initial interval (%s) must be between 3s and max interval (%s)", d, maxInterval)
 		}
-		reachable = d
+		initialInterval = d
+	}
+
+	initialCount := 3
+	if ifi.InitialCount != nil {
+		// Override if specified.
+		initialCount = *ifi.InitialCount
 	}
 
-	if reachable < 0*time.Second || reachable > 1*time.Hour {
-		return nil, fmt.Errorf("reachable time (%d) must be between 0 and 3600 seconds", int(reachable.Seconds()))
+	if initialCount < 1 || initialCount > 10 {
+		return nil, fmt.Errorf("initial count (%d) must be between 1 and 10", initialCount)
 	}
 
-	var retrans time.Duration
-	if ifi.RetransmitTimer != "" {
-		d, err := time.ParseDuration(ifi.RetransmitTimer)
-		if err != nil {
-			return nil, fmt.Errorf("invalid retransmit timer: %v", err)
-		}
-		retrans = d
+	reachable, reachableMax, err := parseTimer(
+		"reachable time", ifi.ReachableTime, ifi.ReachableTimeMin, ifi.ReachableTimeMax)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: is this upper bound right?
-	if retrans < 0*time.Second || retrans > 1*time.Hour {
-		return nil, fmt.Errorf("retransmit timer (%d) must be between 0 and 3600 seconds", int(retrans.Seconds()))
+	retrans, retransMax, err := parseTimer(
+		"retransmit timer", ifi.RetransmitTimer, ifi.RetransmitTimerMin, ifi.RetransmitTimerMax)
+	if err != nil {
+		return nil, err
 	}
 
 	hopLimit := 64
@@ -97,11 +139,151 @@ func parseInterface(ifi rawInterface, epoch time.Time) (*Interface, error) {
 		return nil, fmt.Errorf("hop limit (%d) must be between 0 and 255", hopLimit)
 	}
 
+	retries := 3
+	if ifi.TransmitRetries != nil {
+		// Override if specified.
+		retries = *ifi.TransmitRetries
+	}
+
+	if retries < 0 || retries > 100 {
+		return nil, fmt.Errorf("transmit retries (%d) must be between 0 and 100", retries)
+	}
+
+	sends := 1
+	if ifi.SolicitedSends != nil {
+		// Override if specified.
+		sends = *ifi.SolicitedSends
+	}
+
+	if sends < 1 || sends > 5 {
+		return nil, fmt.Errorf("solicited sends (%d) must be between 1 and 5", sends)
+	}
+
+	var sendInterval time.Duration
+	if ifi.SolicitedSendInterval != "" {
+		d, err := time.ParseDuration(ifi.SolicitedSendInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid solicited send interval: %v", err)
+		}
+		sendInterval = d
+	}
+
+	if sendInterval != 0 && (sendInterval < 10*time.Millisecond || sendInterval > 1*time.Second) {
+		return nil, fmt.Errorf("solicited send interval (%s) must be between 10ms and 1s", sendInterval)
+	}
+
+	var hysteresis time.Duration
+	if ifi.LinkHysteresis != "" {
+		d, err := time.ParseDuration(ifi.LinkHysteresis)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link hysteresis: %v", err)
+		}
+		hysteresis = d
+	}
+
+	if hysteresis != 0 && (hysteresis < 100*time.Millisecond || hysteresis > 1*time.Minute) {
+		return nil, fmt.Errorf("link hysteresis (%s) must be between 100ms and 1m", hysteresis)
+	}
+
+	var grace time.Duration
+	if ifi.ReceiveGracePeriod != "" {
+		d, err := time.ParseDuration(ifi.ReceiveGracePeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid receive grace period: %v", err)
+		}
+		grace = d
+	}
+
+	if grace != 0 && (grace < 100*time.Millisecond || grace > 5*time.Minute) {
+		return nil, fmt.Errorf("receive grace period (%s) must be between 100ms and 5m", grace)
+	}
+
+	var lla net.HardwareAddr
+	if ifi.LLAOverride != "" {
+		mac, err := net.ParseMAC(ifi.LLAOverride)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source link-layer address override: %v", err)
+		}
+
+		switch {
+		case mac[0]&0x01 != 0:
+			return nil, fmt.Errorf("source link-layer address override (%s) must be a unicast address", ifi.LLAOverride)
+		case ifi.SourceLLA != nil && !*ifi.SourceLLA:
+			return nil, errors.New("source link-layer address override cannot be used when source_lla is false")
+		}
+
+		lla = mac
+	}
+
+	var window time.Duration
+	if ifi.ConflictWindow != "" {
+		d, err := time.ParseDuration(ifi.ConflictWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conflict window: %v", err)
+		}
+		window = d
+	}
+
+	if window < 0 || window > 24*time.Hour {
+		return nil, fmt.Errorf("conflict window (%d) must be between 0 and 86400 seconds", int(window.Seconds()))
+	}
+
+	var debugInterval time.Duration
+	if ifi.DebugLogInterval != "" {
+		d, err := time.ParseDuration(ifi.DebugLogInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid debug log interval: %v", err)
+		}
+		debugInterval = d
+	}
+
+	if debugInterval < 0 || debugInterval > 24*time.Hour {
+		return nil, fmt.Errorf("debug log interval (%d) must be between 0 and 86400 seconds", int(debugInterval.Seconds()))
+	}
+
+	var onDemand time.Duration
+	if ifi.OnDemandWindow != "" {
+		d, err := time.ParseDuration(ifi.OnDemandWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid on demand window: %v", err)
+		}
+		onDemand = d
+	}
+
+	switch {
+	case onDemand < 0 || onDemand > 24*time.Hour:
+		return nil, fmt.Errorf("on demand window (%d) must be between 0 and 86400 seconds", int(onDemand.Seconds()))
+	case onDemand > 0 && onDemand < maxInterval:
+		return nil, fmt.Errorf("on demand window (%s) must be at least max interval (%s)", onDemand, maxInterval)
+	case onDemand > 0 && ifi.UnicastOnly:
+		return nil, errors.New("on demand window cannot be used in unicast-only mode")
+	}
+
+	// An RA with no options is 16 bytes, including the ICMPv6 header.
+	if ifi.MaxSize != 0 && (ifi.MaxSize < 16 || ifi.MaxSize > 65535) {
+		return nil, fmt.Errorf("max size (%d) must be 0 or between 16 and 65535 bytes", ifi.MaxSize)
+	}
+
+	// Socket buffers are limited to sizes the kernel can reasonably allocate;
+	// the platform's own limits are checked when each socket is created.
+	const minBuffer, maxBuffer = 4096, 64 << 20
+	if ifi.ReceiveBuffer != 0 && (ifi.ReceiveBuffer < minBuffer || ifi.ReceiveBuffer > maxBuffer) {
+		return nil, fmt.Errorf("receive buffer (%d) must be 0 or between %d and %d bytes", ifi.ReceiveBuffer, minBuffer, maxBuffer)
+	}
+	if ifi.SendBuffer != 0 && (ifi.SendBuffer < minBuffer || ifi.SendBuffer > maxBuffer) {
+		return nil, fmt.Errorf("send buffer (%d) must be 0 or between %d and %d bytes", ifi.SendBuffer, minBuffer, maxBuffer)
+	}
+
 	lifetime, err := parseDefaultLifetime(ifi.DefaultLifetime, maxInterval)
 	if err != nil {
 		return nil, err
 	}
 
+	initialLifetime, err := parseInitialDefaultLifetime(ifi.InitialDefaultLifetime, lifetime, ifi.UnicastOnly)
+	if err != nil {
+		return nil, err
+	}
+
 	pref, err := parsePreference(ifi.Preference)
 	if err != nil {
 		return nil, err
@@ -113,15 +295,45 @@ func parseInterface(ifi rawInterface, epoch time.Time) (*Interface, error) {
 		return nil, err
 	}
 
+	// If both plugin sets are configured, the interface's own options would
+	// never be advertised, which is almost certainly a mistake.
+	if ifi.Solicited != nil && ifi.Unsolicited != nil && hasSetOptions(ifi) {
+		return nil, errors.New("prefix, route, rdnss, dnssl, mtu, mtu_overhead, and raw_option are unused when both solicited and unsolicited plugin sets are configured")
+	}
+
+	solicited, err := parsePluginSet(ifi, ifi.Solicited, plugins, maxInterval, epoch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse solicited plugin set: %w", err)
+	}
+
+	unsolicited, err := parsePluginSet(ifi, ifi.Unsolicited, plugins, maxInterval, epoch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse unsolicited plugin set: %w", err)
+	}
+
 	return &Interface{
 		Name:            ifi.Name,
 		Monitor:         ifi.Monitor,
 		Advertise:       ifi.Advertise,
 		Verbose:         ifi.Verbose,
+		LenientHopLimit: ifi.LenientHopLimit,
+		BindToDevice:    ifi.BindToDevice,
+		Netns:           ifi.Netns,
+		Trunk:           ifi.Trunk,
+		VLAN:            ifi.VLAN,
+		Shadow:          ifi.Shadow,
+		StartWithdrawn:  ifi.StartWithdrawn,
+		IPv6Only:        ifi.IPv6Only,
+		SourcePolicy:    policy,
+		SourceAddress:   source,
 		MinInterval:     minInterval,
 		MaxInterval:     maxInterval,
+		InitialInterval: initialInterval,
+		InitialCount:    initialCount,
 		Managed:         ifi.Managed,
 		OtherConfig:     ifi.OtherConfig,
+		Proxy:           ifi.Proxy,
+		HomeAgent:       ifi.HomeAgent,
 		ReachableTime:   reachable,
 		RetransmitTimer: retrans,
 		HopLimit:        uint8(hopLimit),
@@ -129,9 +341,84 @@ func parseInterface(ifi rawInterface, epoch time.Time) (*Interface, error) {
 		UnicastOnly:     ifi.UnicastOnly,
 		Preference:      pref,
 		Plugins:         plugins,
+
+		SolicitedPlugins:           solicited,
+		UnsolicitedPlugins:         unsolicited,
+		WaitForInterface:           ifi.WaitForInterface,
+		TrackLinkState:             ifi.TrackLinkState,
+		LinkHysteresis:             hysteresis,
+		ReceiveGracePeriod:         grace,
+		SeparateSolicitedMulticast: ifi.SeparateSolicitedMulticast,
+		SolicitedOnlyLLA:           ifi.UnsolicitedLLA != nil && !*ifi.UnsolicitedLLA,
+		SourceLLAOverride:          lla,
+		SolicitedSends:             sends,
+		SolicitedSendInterval:      sendInterval,
+		TransmitRetries:            retries,
+		ConflictWindow:             window,
+		DebugLogInterval:           debugInterval,
+		OnDemandWindow:             onDemand,
+		MaxSize:                    ifi.MaxSize,
+		ReceiveBuffer:              ifi.ReceiveBuffer,
+		SendBuffer:                 ifi.SendBuffer,
+		AdoptNeighborHopLimit:      ifi.AdoptNeighborHopLimit,
+		InitialDefaultLifetime:     initialLifetime,
+		ReachableTimeMax:           reachableMax,
+		RetransmitTimerMax:         retransMax,
 	}, nil
 }
 
+// parseTimer parses the reachable time or retransmit timer named by name from
+// either a fixed value, or a range from min to max from which a value is
+// chosen for each router advertisement. The maximum is zero for a fixed value.
+func parseTimer(name, fixed, min, max string) (time.Duration, time.Duration, error) {
+	if min == "" && max == "" {
+		d, err := parseTimerValue(name, fixed)
+		return d, 0, err
+	}
+
+	if fixed != "" {
+		return 0, 0, fmt.Errorf("%s and %s range are mutually exclusive", name, name)
+	}
+	if min == "" || max == "" {
+		return 0, 0, fmt.Errorf("%s range requires both a minimum and maximum", name)
+	}
+
+	lo, err := parseTimerValue(name+" minimum", min)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	hi, err := parseTimerValue(name+" maximum", max)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if lo >= hi {
+		return 0, 0, fmt.Errorf("%s minimum (%s) must be less than maximum (%s)", name, lo, hi)
+	}
+
+	return lo, hi, nil
+}
+
+// parseTimerValue parses a single reachable time or retransmit timer value.
+func parseTimerValue(name, s string) (time.Duration, error) {
+	var d time.Duration
+	if s != "" {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		d = v
+	}
+
+	// TODO: is this upper bound right for the retransmit timer?
+	if d < 0*time.Second || d > 1*time.Hour {
+		return 0, fmt.Errorf("%s (%d) must be between 0 and 3600 seconds", name, int(d.Seconds()))
+	}
+
+	return d, nil
+}
+
 // parseMinInterval parses a min_interval string and computes its value
 // based on user input or the relationship with max.
 func parseMinInterval(s string, max time.Duration) (time.Duration, error) {
@@ -160,6 +447,34 @@ func parseMinInterval(s string, max time.Duration) (time.Duration, error) {
 	return min, nil
 }
 
+// parseInitialDefaultLifetime parses an initial_default_lifetime string, the
+// router lifetime which ramps up to the default lifetime over the initial
+// unsolicited router advertisements.
+func parseInitialDefaultLifetime(s string, lifetime time.Duration, unicastOnly bool) (time.Duration, error) {
+	if s == "" {
+		// No ramp.
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid initial default lifetime: %v", err)
+	}
+
+	switch {
+	case lifetime == 0:
+		return 0, errors.New("initial default lifetime requires a non-zero default lifetime")
+	case unicastOnly:
+		// The ramp advances with each unsolicited router advertisement.
+		return 0, errors.New("initial default lifetime cannot be used in unicast-only mode")
+	case d < 1*time.Second || d >= lifetime:
+		return 0, fmt.Errorf("initial default lifetime (%d) must be at least 1 and less than (default_lifetime = %d) seconds",
+			int(d.Seconds()), int(lifetime.Seconds()))
+	}
+
+	return d, nil
+}
+
 // parseDefaultLifetime parses a default_lifetime string and computes its value
 // based on user input or the relationship with max.
 func parseDefaultLifetime(s *string, max time.Duration) (time.Duration, error) {
@@ -191,6 +506,29 @@ func parseDefaultLifetime(s *string, max time.Duration) (time.Duration, error) {
 	return lt, nil
 }
 
+// parseSourceAddress parses s as a link-local source address selection policy,
+// and a link-local address for system.SourceExact.
+func parseSourceAddress(s string) (system.SourcePolicy, netaddr.IP, error) {
+	switch s {
+	case "", "auto":
+		return system.SourceAuto, netaddr.IP{}, nil
+	case "lowest":
+		return system.SourceLowest, netaddr.IP{}, nil
+	case "highest":
+		return system.SourceHighest, netaddr.IP{}, nil
+	}
+
+	ip, err := netaddr.ParseIP(s)
+	if err != nil {
+		return 0, netaddr.IP{}, fmt.Errorf("invalid source address: %q", s)
+	}
+	if !ip.Is6() || !ip.IsLinkLocalUnicast() {
+		return 0, netaddr.IP{}, fmt.Errorf("source address %s must be an IPv6 link-local address", ip)
+	}
+
+	return system.SourceExact, ip, nil
+}
+
 // parsePreference parses s as a preference value.
 func parsePreference(s string) (ndp.Preference, error) {
 	switch s {
@@ -67,6 +67,72 @@ func Test_parseInterfaceErrors(t *testing.T) {
 				MaxInterval: "4s",
 			},
 		},
+		{
+			name: "initial interval duration",
+			ifi: rawInterface{
+				InitialInterval: "foo",
+			},
+		},
+		{
+			name: "initial interval too low",
+			ifi: rawInterface{
+				InitialInterval: "1s",
+			},
+		},
+		{
+			name: "initial interval above max interval",
+			ifi: rawInterface{
+				InitialInterval: "30s",
+				MaxInterval:     "20s",
+			},
+		},
+		{
+			name: "initial count too low",
+			ifi: rawInterface{
+				InitialCount: intp(0),
+			},
+		},
+		{
+			name: "initial count too high",
+			ifi: rawInterface{
+				InitialCount: intp(11),
+			},
+		},
+		{
+			name: "reachable time and range",
+			ifi: rawInterface{
+				ReachableTime:    "30s",
+				ReachableTimeMin: "20s",
+				ReachableTimeMax: "40s",
+			},
+		},
+		{
+			name: "reachable time range no maximum",
+			ifi: rawInterface{
+				ReachableTimeMin: "20s",
+			},
+		},
+		{
+			name: "reachable time range inverted",
+			ifi: rawInterface{
+				ReachableTimeMin: "40s",
+				ReachableTimeMax: "20s",
+			},
+		},
+		{
+			name: "retransmit timer range duration",
+			ifi: rawInterface{
+				RetransmitTimerMin: "1s",
+				RetransmitTimerMax: "foo",
+			},
+		},
+		{
+			name: "retransmit timer range too high",
+			ifi: rawInterface{
+				RetransmitTimerMin: "1s",
+				RetransmitTimerMax: "9000s",
+			},
+		},
 		{
 			name: "reachable time duration",
 			ifi: rawInterface{
@@ -115,6 +181,195 @@ func Test_parseInterfaceErrors(t *testing.T) {
 				HopLimit: intp(256),
 			},
 		},
+		{
+			name: "conflict window duration",
+			ifi: rawInterface{
+				ConflictWindow: "foo",
+			},
+		},
+		{
+			name: "conflict window too high",
+			ifi: rawInterface{
+				ConflictWindow: "25h",
+			},
+		},
+		{
+			name: "debug log interval duration",
+			ifi: rawInterface{
+				DebugLogInterval: "foo",
+			},
+		},
+		{
+			name: "debug log interval too high",
+			ifi: rawInterface{
+				DebugLogInterval: "25h",
+			},
+		},
+		{
+			name: "on demand window duration",
+			ifi: rawInterface{
+				OnDemandWindow: "foo",
+			},
+		},
+		{
+			name: "on demand window too low",
+			ifi: rawInterface{
+				MaxInterval:    "10m",
+				OnDemandWindow: "5m",
+			},
+		},
+		{
+			name: "on demand window unicast only",
+			ifi: rawInterface{
+				UnicastOnly:    true,
+				OnDemandWindow: "1h",
+			},
+		},
+		{
+			name: "source address invalid",
+			ifi: rawInterface{
+				SourceAddress: "foo",
+			},
+		},
+		{
+			name: "source address not link-local",
+			ifi: rawInterface{
+				SourceAddress: "2001:db8::1",
+			},
+		},
+		{
+			name: "start withdrawn without advertise",
+			ifi: rawInterface{
+				StartWithdrawn: true,
+			},
+		},
+		{
+			name: "shadow without advertise",
+			ifi: rawInterface{
+				Shadow: true,
+			},
+		},
+		{
+			name: "max size too low",
+			ifi: rawInterface{
+				MaxSize: 15,
+			},
+		},
+		{
+			name: "max size too high",
+			ifi: rawInterface{
+				MaxSize: 65536,
+			},
+		},
+		{
+			name: "receive buffer too low",
+			ifi: rawInterface{
+				ReceiveBuffer: 1024,
+			},
+		},
+		{
+			name: "send buffer too high",
+			ifi: rawInterface{
+				SendBuffer: 128 << 20,
+			},
+		},
+		{
+			name: "transmit retries too low",
+			ifi: rawInterface{
+				TransmitRetries: intp(-1),
+			},
+		},
+		{
+			name: "transmit retries too high",
+			ifi: rawInterface{
+				TransmitRetries: intp(101),
+			},
+		},
+		{
+			name: "solicited sends too low",
+			ifi: rawInterface{
+				SolicitedSends: intp(0),
+			},
+		},
+		{
+			name: "solicited sends too high",
+			ifi: rawInterface{
+				SolicitedSends: intp(6),
+			},
+		},
+		{
+			name: "solicited send interval duration",
+			ifi: rawInterface{
+				SolicitedSendInterval: "foo",
+			},
+		},
+		{
+			name: "solicited send interval too low",
+			ifi: rawInterface{
+				SolicitedSendInterval: "1ms",
+			},
+		},
+		{
+			name: "solicited send interval too high",
+			ifi: rawInterface{
+				SolicitedSendInterval: "2s",
+			},
+		},
+		{
+			name: "link hysteresis duration",
+			ifi: rawInterface{
+				LinkHysteresis: "foo",
+			},
+		},
+		{
+			name: "link hysteresis too low",
+			ifi: rawInterface{
+				LinkHysteresis: "10ms",
+			},
+		},
+		{
+			name: "link hysteresis too high",
+			ifi: rawInterface{
+				LinkHysteresis: "2m",
+			},
+		},
+		{
+			name: "receive grace period duration",
+			ifi: rawInterface{
+				ReceiveGracePeriod: "foo",
+			},
+		},
+		{
+			name: "receive grace period too low",
+			ifi: rawInterface{
+				ReceiveGracePeriod: "10ms",
+			},
+		},
+		{
+			name: "receive grace period too high",
+			ifi: rawInterface{
+				ReceiveGracePeriod: "10m",
+			},
+		},
+		{
+			name: "source LLA override MAC",
+			ifi: rawInterface{
+				LLAOverride: "foo",
+			},
+		},
+		{
+			name: "source LLA override multicast",
+			ifi: rawInterface{
+				LLAOverride: "33:33:00:00:00:01",
+			},
+		},
+		{
+			name: "source LLA override disabled",
+			ifi: rawInterface{
+				SourceLLA:   boolp(false),
+				LLAOverride: "02:00:5e:00:53:01",
+			},
+		},
 		{
 			name: "default lifetime duration",
 			ifi: rawInterface{
@@ -134,6 +389,39 @@ func Test_parseInterfaceErrors(t *testing.T) {
 				DefaultLifetime: strp("9001s"),
 			},
 		},
+		{
+			name: "initial default lifetime duration",
+			ifi: rawInterface{
+				InitialDefaultLifetime: "foo",
+			},
+		},
+		{
+			name: "initial default lifetime no default lifetime",
+			ifi: rawInterface{
+				DefaultLifetime:        strp(""),
+				InitialDefaultLifetime: "10s",
+			},
+		},
+		{
+			name: "initial default lifetime too low",
+			ifi: rawInterface{
+				InitialDefaultLifetime: "500ms",
+			},
+		},
+		{
+			name: "initial default lifetime too high",
+			ifi: rawInterface{
+				DefaultLifetime:        strp("30m"),
+				InitialDefaultLifetime: "30m",
+			},
+		},
+		{
+			name: "initial default lifetime unicast only",
+			ifi: rawInterface{
+				UnicastOnly:            true,
+				InitialDefaultLifetime: "10s",
+			},
+		},
 		{
 			name: "preference invalid",
 			ifi: rawInterface{
@@ -169,3 +457,5 @@ func Test_parseInterfaceErrors(t *testing.T) {
 func intp(i int) *int { return &i }
 
 func strp(s string) *string { return &s }
+
+func boolp(b bool) *bool { return &b }
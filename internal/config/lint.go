@@ -0,0 +1,168 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/corerad/internal/plugin"
+)
+
+// A Severity indicates the importance of a Finding.
+type Severity int
+
+// Possible Severity values.
+const (
+	// Warning indicates configuration which is valid but likely to be a
+	// mistake.
+	Warning Severity = iota
+
+	// Error indicates configuration which is invalid.
+	Error
+)
+
+// String returns the string representation of a Severity.
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// A Finding is an issue with a configuration reported by Lint.
+type Finding struct {
+	Severity Severity
+
+	// Interface and Plugin identify the interface and plugin the Finding
+	// applies to, and are empty if it applies to the configuration as a whole
+	// or to the interface as a whole, respectively.
+	Interface, Plugin string
+
+	Message string
+}
+
+// String returns the string representation of a Finding.
+func (f Finding) String() string {
+	ss := []string{f.Severity.String()}
+	for _, s := range []string{f.Interface, f.Plugin, f.Message} {
+		if s != "" {
+			ss = append(ss, s)
+		}
+	}
+
+	return strings.Join(ss, ": ")
+}
+
+// Lint parses the configuration in r like Parse and reports Findings for
+// configuration which is invalid or likely to be a mistake, such as an
+// autonomous prefix which is not a /64. If the configuration cannot be
+// parsed, Lint reports a single Error Finding, which identifies the interface
+// and plugin at fault when possible.
+func Lint(r io.Reader, epoch time.Time) []Finding {
+	c, err := Parse(r, epoch)
+	if err != nil {
+		f := Finding{Severity: Error, Message: err.Error()}
+
+		var ierr *InterfaceError
+		if errors.As(err, &ierr) {
+			f.Interface = ierr.Interface
+			f.Plugin = ierr.Plugin
+			f.Message = ierr.Err.Error()
+		}
+
+		return []Finding{f}
+	}
+
+	var fs []Finding
+	for _, ifi := range c.Interfaces {
+		if ifi.Advertise {
+			fs = append(fs, ifi.lint()...)
+		}
+	}
+
+	return fs
+}
+
+// lint produces the Findings for an advertising interface.
+func (ifi Interface) lint() []Finding {
+	var (
+		fs     []Finding
+		routes bool
+	)
+
+	for _, p := range ifi.AllPlugins() {
+		add := func(sev Severity, msg string) {
+			fs = append(fs, Finding{
+				Severity:  sev,
+				Interface: ifi.Name,
+				Plugin:    pluginID(p),
+				Message:   msg,
+			})
+		}
+
+		for _, w := range ifi.pluginWarnings(p) {
+			add(Warning, w)
+		}
+
+		switch p := p.(type) {
+		case *plugin.Route:
+			routes = true
+		case *plugin.RDNSS:
+			// Hosts may expire the servers before the next unsolicited router
+			// advertisement refreshes them.
+			if p.Lifetime != 0 && p.Lifetime < ifi.MaxInterval {
+				add(Warning, fmt.Sprintf("lifetime %s is shorter than max interval %s, hosts may stop using the servers between router advertisements",
+					plugin.DurationString(p.Lifetime), ifi.MaxInterval))
+			}
+		case *plugin.DNSSL:
+			if p.Lifetime != 0 && p.Lifetime < ifi.MaxInterval {
+				add(Warning, fmt.Sprintf("lifetime %s is shorter than max interval %s, hosts may stop using the domain names between router advertisements",
+					plugin.DurationString(p.Lifetime), ifi.MaxInterval))
+			}
+		}
+	}
+
+	if ifi.DefaultLifetime == 0 && !routes {
+		fs = append(fs, Finding{
+			Severity:  Warning,
+			Interface: ifi.Name,
+			Message:   "default lifetime is 0 and no routes are advertised, hosts will not route any traffic via this router",
+		})
+	}
+
+	return fs
+}
+
+// pluginID produces a short identifier for p, including its prefix if it has
+// one, to distinguish it from other plugins of the same type.
+func pluginID(p plugin.Plugin) string {
+	switch p := p.(type) {
+	case *plugin.Prefix:
+		return fmt.Sprintf("%s %s", p.Name(), p.Prefix)
+	case *plugin.Route:
+		return fmt.Sprintf("%s %s", p.Name(), p.Prefix)
+	case *plugin.DelegatedPrefix:
+		return fmt.Sprintf("%s %s from %s", p.Name(), p.Prefix.Prefix, p.Interface)
+	default:
+		return p.Name()
+	}
+}
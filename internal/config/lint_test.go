@@ -0,0 +1,188 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mdlayher/corerad/internal/config"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		fs   []config.Finding
+	}{
+		{
+			name: "invalid",
+			s: `
+			[[interfaces]]
+			`,
+			fs: []config.Finding{{Severity: config.Error}},
+		},
+		{
+			name: "invalid MTU",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			mtu = 1000
+			`,
+			fs: []config.Finding{{
+				Severity:  config.Error,
+				Interface: "eth0",
+				Plugin:    "mtu",
+			}},
+		},
+		{
+			name: "invalid prefix lifetimes",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  preferred_lifetime = "2h"
+			  valid_lifetime = "1h"
+			`,
+			fs: []config.Finding{{
+				Severity:  config.Error,
+				Interface: "eth0",
+				Plugin:    "prefix 2001:db8::/64",
+			}},
+		},
+		{
+			name: "OK",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1"]
+			`,
+		},
+		{
+			name: "monitor",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			monitor = true
+			default_lifetime = "0s"
+			`,
+		},
+		{
+			name: "warnings",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			default_lifetime = "0s"
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/63"
+			  [[interfaces.rdnss]]
+			  lifetime = "1m"
+			  servers = ["2001:db8::1"]
+			  [[interfaces.dnssl]]
+			  lifetime = "1m"
+			  domain_names = ["foo.example.com"]
+			`,
+			fs: []config.Finding{
+				{
+					Severity:  config.Warning,
+					Interface: "eth0",
+					Plugin:    "prefix 2001:db8::/63",
+				},
+				{
+					Severity:  config.Warning,
+					Interface: "eth0",
+					Plugin:    "rdnss",
+				},
+				{
+					Severity:  config.Warning,
+					Interface: "eth0",
+					Plugin:    "dnssl",
+				},
+				{
+					Severity:  config.Warning,
+					Interface: "eth0",
+				},
+			},
+		},
+		{
+			name: "routes",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			advertise = true
+			default_lifetime = "0s"
+			  [[interfaces.route]]
+			  prefix = "2001:db8::/48"
+			`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := config.Lint(strings.NewReader(tt.s), time.Time{})
+
+			if diff := cmp.Diff(tt.fs, fs, cmpopts.IgnoreFields(config.Finding{}, "Message")); diff != "" {
+				t.Fatalf("unexpected findings (-want +got):\n%s", diff)
+			}
+
+			for _, f := range fs {
+				if f.Message == "" {
+					t.Fatalf("finding has no message: %+v", f)
+				}
+			}
+		})
+	}
+}
+
+func TestFindingString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		f config.Finding
+		s string
+	}{
+		{
+			f: config.Finding{Severity: config.Error, Message: "bad"},
+			s: "error: bad",
+		},
+		{
+			f: config.Finding{
+				Severity:  config.Warning,
+				Interface: "eth0",
+				Plugin:    "prefix ::/63",
+				Message:   "bad",
+			},
+			s: "warning: eth0: prefix ::/63: bad",
+		},
+	}
+
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.s, tt.f.String()); diff != "" {
+			t.Fatalf("unexpected string (-want +got):\n%s", diff)
+		}
+	}
+}
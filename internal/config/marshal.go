@@ -0,0 +1,393 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mdlayher/corerad/internal/plugin"
+	"github.com/mdlayher/ndp"
+)
+
+// A marshalInterface is the configuration file representation of an
+// interface's plugins, as produced by MarshalConfig. The plugin tables reuse
+// the raw configuration types, whose unset options are omitted.
+type marshalInterface struct {
+	Name string `toml:"name"`
+
+	// Parameters which were explicitly configured, and are therefore not
+	// seeded by sysctl_defaults.
+	HopLimit           *int   `toml:"hop_limit"`
+	ReachableTime      string `toml:"reachable_time,omitempty"`
+	ReachableTimeMin   string `toml:"reachable_time_min,omitempty"`
+	ReachableTimeMax   string `toml:"reachable_time_max,omitempty"`
+	RetransmitTimer    string `toml:"retransmit_timer,omitempty"`
+	RetransmitTimerMin string `toml:"retransmit_timer_min,omitempty"`
+	RetransmitTimerMax string `toml:"retransmit_timer_max,omitempty"`
+	SysctlDefaults     bool   `toml:"sysctl_defaults,omitempty"`
+
+	// Prefix router_address requires home_agent.
+	HomeAgent bool `toml:"home_agent,omitempty"`
+
+	ManagedPrefix  string `toml:"managed_prefix,omitempty"`
+	Nonce          bool   `toml:"nonce,omitempty"`
+	SourceLLA      *bool  `toml:"source_lla"`
+	UnsolicitedLLA *bool  `toml:"source_lla_unsolicited"`
+	LLAOverride    string `toml:"source_lla_override,omitempty"`
+	MTU            int    `toml:"mtu,omitzero"`
+	MTUOverhead    *int   `toml:"mtu_overhead"`
+
+	Prefixes      []rawPrefix       `toml:"prefix,omitempty"`
+	Routes        []rawRoute        `toml:"route,omitempty"`
+	KernelRoutes  *rawKernelRoutes  `toml:"kernel_routes"`
+	RDNSS         []rawRDNSS        `toml:"rdnss,omitempty"`
+	DNSSL         []rawDNSSL        `toml:"dnssl,omitempty"`
+	Renumber      []rawRenumber     `toml:"renumber,omitempty"`
+	Upstream      *rawUpstream      `toml:"upstream"`
+	VRRP          *rawVRRP          `toml:"vrrp"`
+	CaptivePortal *rawCaptivePortal `toml:"captive_portal"`
+	RawOptions    []rawRawOption    `toml:"raw_option,omitempty"`
+	Solicited     *rawPluginSet     `toml:"solicited"`
+	Unsolicited   *rawPluginSet     `toml:"unsolicited"`
+}
+
+// MarshalConfig renders the plugin configuration of ifi in the configuration
+// file format, as an [[interfaces]] table which contains the interface's name
+// and the options which configure its plugins. Defaults are rendered as
+// explicit values, so that parsing the output produces plugins equivalent to
+// those of ifi regardless of later changes to the defaults.
+//
+// MarshalConfig does not render interface options which do not configure a
+// plugin, such as advertise or max_interval, except for home_agent, which is
+// required by prefix router_address. The RDNSS and DNSSL lifetimes computed
+// from max_interval are rendered as explicit values.
+func (ifi Interface) MarshalConfig() ([]byte, error) {
+	mi := marshalInterface{
+		Name:      ifi.Name,
+		HomeAgent: ifi.HomeAgent,
+	}
+
+	// Options which may also be configured in a plugin set are rendered into
+	// shared first, and then copied into mi.
+	var (
+		shared rawPluginSet
+		lla    bool
+	)
+
+	for _, p := range ifi.Plugins {
+		ok, err := marshalSetPlugin(p, &shared)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal plugin %q: %v", p.Name(), err)
+		}
+		if ok {
+			continue
+		}
+
+		switch p := p.(type) {
+		case *plugin.Renumber:
+			mi.Renumber = append(mi.Renumber, rawRenumber{
+				Start:  p.Start.Format(time.RFC3339),
+				Window: p.Window.String(),
+				Old:    marshalPrefix(p.Old),
+				New:    marshalPrefix(p.New),
+			})
+		case *plugin.SysctlDefaults:
+			mi.SysctlDefaults = true
+			mi.marshalSysctlParameters(ifi, p)
+		case *plugin.ManagedPrefix:
+			mi.ManagedPrefix = p.Prefix.String()
+		case *plugin.Nonce:
+			mi.Nonce = true
+		case *plugin.CaptivePortal:
+			mi.CaptivePortal = &rawCaptivePortal{
+				API:    p.API,
+				Strict: p.Strict,
+			}
+		case *plugin.KernelRoutes:
+			table := int(p.Table)
+			mi.KernelRoutes = &rawKernelRoutes{
+				Table:      &table,
+				Protocol:   formatProtocol(p.Protocol),
+				Metric:     int(p.Metric),
+				Interface:  p.Interface,
+				Preference: formatPreference(p.Preference),
+				Lifetime:   formatDuration(p.Lifetime),
+				Interval:   p.Interval.String(),
+			}
+		case *plugin.Upstream:
+			hysteresis := p.Hysteresis
+			mi.Upstream = &rawUpstream{
+				Interval:   p.Interval.String(),
+				Hysteresis: &hysteresis,
+			}
+		case *plugin.VRRP:
+			hysteresis := p.Hysteresis
+			v := &rawVRRP{
+				StateFile:  p.StateFile,
+				Interval:   p.Interval.String(),
+				Hysteresis: &hysteresis,
+			}
+			if p.StateFile == "" {
+				v.Address = p.Address.String()
+			}
+
+			mi.VRRP = v
+		case *plugin.LLA:
+			lla = true
+		default:
+			return nil, fmt.Errorf("cannot marshal unknown plugin %q", p.Name())
+		}
+	}
+
+	mi.Prefixes = shared.Prefixes
+	mi.Routes = shared.Routes
+	mi.RDNSS = shared.RDNSS
+	mi.DNSSL = shared.DNSSL
+	mi.MTU = shared.MTU
+	mi.MTUOverhead = shared.MTUOverhead
+	mi.RawOptions = shared.RawOptions
+
+	if !lla {
+		// The lla plugin is enabled unless explicitly disabled.
+		mi.SourceLLA = &lla
+	}
+	if ifi.SolicitedOnlyLLA {
+		unsolicited := false
+		mi.UnsolicitedLLA = &unsolicited
+	}
+	if ifi.SourceLLAOverride != nil {
+		mi.LLAOverride = ifi.SourceLLAOverride.String()
+	}
+
+	var err error
+	mi.Solicited, err = marshalPluginSet(ifi.SolicitedPlugins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal solicited plugin set: %v", err)
+	}
+
+	mi.Unsolicited, err = marshalPluginSet(ifi.UnsolicitedPlugins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal unsolicited plugin set: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = toml.NewEncoder(&buf).Encode(struct {
+		Interfaces []marshalInterface `toml:"interfaces"`
+	}{
+		Interfaces: []marshalInterface{mi},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode interface %q: %v", ifi.Name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// marshalSysctlParameters renders the parameters of ifi which are not seeded
+// by s, because they were explicitly configured.
+func (mi *marshalInterface) marshalSysctlParameters(ifi Interface, s *plugin.SysctlDefaults) {
+	if !s.HopLimit {
+		hopLimit := int(ifi.HopLimit)
+		mi.HopLimit = &hopLimit
+	}
+
+	// Fixed timers are always rendered, even if zero, as an empty value
+	// would be seeded by sysctl_defaults.
+	if !s.ReachableTime {
+		if ifi.ReachableTimeMax != 0 {
+			mi.ReachableTimeMin = ifi.ReachableTime.String()
+			mi.ReachableTimeMax = ifi.ReachableTimeMax.String()
+		} else {
+			mi.ReachableTime = ifi.ReachableTime.String()
+		}
+	}
+
+	if !s.RetransmitTimer {
+		if ifi.RetransmitTimerMax != 0 {
+			mi.RetransmitTimerMin = ifi.RetransmitTimer.String()
+			mi.RetransmitTimerMax = ifi.RetransmitTimerMax.String()
+		} else {
+			mi.RetransmitTimer = ifi.RetransmitTimer.String()
+		}
+	}
+}
+
+// marshalPluginSet renders the plugins of a plugin set. Plugins which cannot
+// be configured in a plugin set are shared with the interface, and are
+// rendered there instead. If plugins is nil, the set is not configured and
+// marshalPluginSet returns nil.
+func marshalPluginSet(plugins []plugin.Plugin) (*rawPluginSet, error) {
+	if plugins == nil {
+		return nil, nil
+	}
+
+	var set rawPluginSet
+	for _, p := range plugins {
+		if _, err := marshalSetPlugin(p, &set); err != nil {
+			return nil, fmt.Errorf("failed to marshal plugin %q: %v", p.Name(), err)
+		}
+	}
+
+	return &set, nil
+}
+
+// marshalSetPlugin renders p into set if p is a plugin which may be configured
+// in a plugin set, and reports whether it did so.
+func marshalSetPlugin(p plugin.Plugin, set *rawPluginSet) (bool, error) {
+	switch p := p.(type) {
+	case *plugin.Prefix:
+		set.Prefixes = append(set.Prefixes, marshalPrefix(p))
+	case *plugin.DelegatedPrefix:
+		rp := marshalPrefix(p.Prefix)
+		rp.Interface = p.Interface
+		if p.Subnet != 0 {
+			subnet := p.Subnet
+			rp.Subnet = &subnet
+		}
+
+		// Delegated prefixes are configured alongside other prefixes.
+		set.Prefixes = append(set.Prefixes, rp)
+	case *plugin.Route:
+		set.Routes = append(set.Routes, rawRoute{
+			Prefix:     p.Prefix.String(),
+			Preference: formatPreference(p.Preference),
+			Lifetime:   formatDuration(p.Lifetime),
+		})
+	case *plugin.RDNSS:
+		r, err := marshalRDNSS(p)
+		if err != nil {
+			return false, err
+		}
+
+		set.RDNSS = append(set.RDNSS, r)
+	case *plugin.DNSSL:
+		max := p.MaxDomainNames
+		set.DNSSL = append(set.DNSSL, rawDNSSL{
+			Lifetime:       formatDuration(p.Lifetime),
+			DomainNames:    p.DomainNames,
+			MaxDomainNames: &max,
+			Truncate:       p.Truncate,
+		})
+	case *plugin.MTU:
+		set.MTU = int(*p)
+	case *plugin.TunnelMTU:
+		overhead := p.Overhead
+		set.MTUOverhead = &overhead
+	case *plugin.Raw:
+		set.RawOptions = append(set.RawOptions, rawRawOption{
+			Type: int(p.Type),
+			Hex:  hex.EncodeToString(p.Value),
+		})
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// marshalPrefix renders a Prefix plugin.
+func marshalPrefix(p *plugin.Prefix) rawPrefix {
+	onLink, auto := p.OnLink, p.Autonomous
+
+	rp := rawPrefix{
+		Prefix:             p.Prefix.String(),
+		OnLink:             &onLink,
+		Autonomous:         &auto,
+		ValidLifetime:      formatDuration(p.ValidLifetime),
+		PreferredLifetime:  formatDuration(p.PreferredLifetime),
+		MaxAddressFailures: p.MaxAddrsFailures,
+		Deprecated:         p.Deprecated,
+		RouterAddress:      p.RouterAddress,
+		VerifyEUI64:        p.VerifyEUI64,
+	}
+
+	if p.TemporaryValidLifetime != 0 {
+		rp.TemporaryValidLifetime = formatDuration(p.TemporaryValidLifetime)
+		rp.TemporaryPreferredLifetime = formatDuration(p.TemporaryPreferredLifetime)
+	}
+
+	for _, e := range p.ExcludePrefixes {
+		rp.ExcludePrefixes = append(rp.ExcludePrefixes, e.String())
+	}
+
+	return rp
+}
+
+// marshalRDNSS renders a RDNSS plugin.
+func marshalRDNSS(r *plugin.RDNSS) (rawRDNSS, error) {
+	servers := make([]string, 0, len(r.Servers)+1)
+	if r.Interface {
+		// The interface's own addresses are advertised ahead of the others.
+		servers = append(servers, "interface")
+	}
+	for _, s := range r.Servers {
+		servers = append(servers, s.String())
+	}
+
+	var addrs string
+	switch r.InterfaceAddresses {
+	case plugin.StableAddresses:
+		// Default, omit.
+	case plugin.LowestStableAddress:
+		addrs = "lowest_stable"
+	default:
+		return rawRDNSS{}, fmt.Errorf("invalid interface addresses: %d", r.InterfaceAddresses)
+	}
+
+	max := r.MaxServers
+	return rawRDNSS{
+		Lifetime:           formatDuration(r.Lifetime),
+		Servers:            servers,
+		InterfaceAddresses: addrs,
+		MaxServers:         &max,
+		Truncate:           r.Truncate,
+	}, nil
+}
+
+// formatDuration formats d so that parseDuration produces d.
+func formatDuration(d time.Duration) *string {
+	s := d.String()
+	if d == ndp.Infinity {
+		s = "infinite"
+	}
+
+	return &s
+}
+
+// formatProtocol formats a route protocol number so that parseKernelRoutes
+// produces p.
+func formatProtocol(p uint8) string {
+	if p == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(int(p))
+}
+
+// formatPreference formats p so that parsePreference produces p.
+func formatPreference(p ndp.Preference) string {
+	switch p {
+	case ndp.Low:
+		return "low"
+	case ndp.High:
+		return "high"
+	default:
+		return "medium"
+	}
+}
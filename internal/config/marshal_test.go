@@ -0,0 +1,325 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mdlayher/corerad/internal/config"
+	"github.com/mdlayher/corerad/internal/plugin"
+)
+
+func TestInterfaceMarshalConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{
+			name: "none",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			source_lla = false
+			`,
+		},
+		{
+			name: "prefix",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			home_agent = true
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  valid_lifetime = "infinite"
+			  preferred_lifetime = "infinite"
+			  temporary_valid_lifetime = "2h"
+			  temporary_preferred_lifetime = "1h"
+			  max_address_failures = 3
+			  exclude_prefixes = ["2001:db8::/64"]
+			  verify_eui64 = true
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8:1::/64"
+			  on_link = false
+			  deprecated = true
+			  router_address = true
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8:2::/64"
+			  dhcpv6 = true
+			`,
+		},
+		{
+			name: "delegated prefix",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  interface = "wan0"
+			  subnet = 2
+			  autonomous = false
+			`,
+		},
+		{
+			name: "renumber",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.renumber]]
+			  start = "2020-08-01T00:00:00Z"
+			  window = "12h"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:1::/64"
+			    valid_lifetime = "48h"
+			`,
+		},
+		{
+			name: "route",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.route]]
+			  prefix = "2001:db8::/48"
+			  preference = "high"
+			  [[interfaces.route]]
+			  prefix = "2001:db8:ffff::/48"
+			  lifetime = "infinite"
+			`,
+		},
+		{
+			name: "kernel routes",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.kernel_routes]
+			  table = 100
+			  protocol = "bird"
+			  metric = 32
+			  interface = "wg0"
+			  preference = "low"
+			`,
+		},
+		{
+			name: "rdnss",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1", "interface"]
+			  interface_addresses = "lowest_stable"
+			  max_servers = 1
+			  truncate = true
+			  [[interfaces.rdnss]]
+			  lifetime = "0s"
+			  servers = ["2001:db8::2"]
+			`,
+		},
+		{
+			name: "dnssl",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.dnssl]]
+			  lifetime = "1h"
+			  domain_names = ["foo.example", "bar.example"]
+			  max_domain_names = 0
+			`,
+		},
+		{
+			name: "mtu",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			mtu = 1500
+			`,
+		},
+		{
+			name: "mtu overhead",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			mtu_overhead = 0
+			`,
+		},
+		{
+			name: "sysctl defaults",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			sysctl_defaults = true
+			hop_limit = 0
+			reachable_time_min = "10s"
+			reachable_time_max = "20s"
+			`,
+		},
+		{
+			name: "sysctl defaults explicit",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			sysctl_defaults = true
+			mtu = 1500
+			retransmit_timer = "0s"
+			`,
+		},
+		{
+			name: "managed prefix",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			managed_prefix = "2001:db8::/64"
+			`,
+		},
+		{
+			name: "nonce",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			nonce = true
+			`,
+		},
+		{
+			name: "captive portal",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.captive_portal]
+			  api = "https://portal.example/api"
+			  strict = true
+			`,
+		},
+		{
+			name: "raw option",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [[interfaces.raw_option]]
+			  type = 253
+			  hex = "000000000000"
+			  [[interfaces.raw_option]]
+			  type = 254
+			  base64 = "AAAAAAAAAAAAAAAAAAA="
+			`,
+		},
+		{
+			name: "upstream",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.upstream]
+			  interval = "10s"
+			`,
+		},
+		{
+			name: "VRRP address",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.vrrp]
+			  address = "2001:db8::1"
+			  hysteresis = 5
+			`,
+		},
+		{
+			name: "VRRP state file",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.vrrp]
+			  state_file = "/run/keepalived/state"
+			  interval = "5s"
+			`,
+		},
+		{
+			name: "lla",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			source_lla_unsolicited = false
+			source_lla_override = "02:00:00:00:00:01"
+			`,
+		},
+		{
+			name: "plugin sets",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			sysctl_defaults = true
+			nonce = true
+			  [interfaces.solicited]
+			  mtu = 1500
+			    [[interfaces.solicited.prefix]]
+			    prefix = "2001:db8::/64"
+			    [[interfaces.solicited.prefix]]
+			    prefix = "::/64"
+			    interface = "wan0"
+			    [[interfaces.solicited.raw_option]]
+			    type = 253
+			    hex = "000000000000"
+			  [interfaces.unsolicited]
+			    [[interfaces.unsolicited.route]]
+			    prefix = "2001:db8::/48"
+			`,
+		},
+		{
+			name: "plugin set shared",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			mtu_overhead = 20
+			  [[interfaces.dnssl]]
+			  domain_names = ["foo.example"]
+			  [interfaces.unsolicited]
+			`,
+		},
+	}
+
+	epoch := time.Unix(1, 0)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := config.Parse(strings.NewReader(tt.s), epoch)
+			if err != nil {
+				t.Fatalf("failed to parse config: %v", err)
+			}
+
+			b, err := want.Interfaces[0].MarshalConfig()
+			if err != nil {
+				t.Fatalf("failed to marshal config: %v", err)
+			}
+
+			got, err := config.Parse(bytes.NewReader(b), epoch)
+			if err != nil {
+				t.Fatalf("failed to parse marshaled config: %v\n%s", err, b)
+			}
+
+			opts := []cmp.Option{
+				cmp.Comparer(compareNetaddrIP),
+				cmpopts.IgnoreUnexported(plugin.DelegatedPrefix{}, plugin.KernelRoutes{}, plugin.RDNSS{}, plugin.Upstream{}, plugin.VRRP{}),
+			}
+
+			if diff := cmp.Diff(want.Interfaces, got.Interfaces, opts...); diff != "" {
+				t.Fatalf("unexpected Interfaces after round trip (-want +got):\n%s\n%s", diff, b)
+			}
+		})
+	}
+}
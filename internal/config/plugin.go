@@ -14,30 +14,82 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/mdlayher/corerad/internal/plugin"
+	"github.com/mdlayher/ndp"
 	"github.com/mikioh/ipaddr"
 	"inet.af/netaddr"
 )
 
+// A pluginError is an error in the configuration of a plugin, identified as
+// by pluginID so the error can be attributed to the plugin by Lint.
+type pluginError struct {
+	id  string
+	err error
+}
+
+func (e *pluginError) Error() string { return e.err.Error() }
+func (e *pluginError) Unwrap() error { return e.err }
+
 // parsePlugin parses raw plugin configuration into a slice of plugins.
 func parsePlugins(ifi rawInterface, maxInterval time.Duration, epoch time.Time) ([]plugin.Plugin, error) {
-	var prefixes []*plugin.Prefix
+	var (
+		prefixes  []*plugin.Prefix
+		delegated []*plugin.DelegatedPrefix
+	)
+
 	for _, p := range ifi.Prefixes {
+		if p.Interface != "" {
+			// Prefixes are derived from another interface's addresses.
+			dp, err := parseDelegatedPrefix(p, ifi.Name, epoch)
+			if err != nil {
+				return nil, &pluginError{
+					id:  fmt.Sprintf("prefix %s from %s", p.Prefix, p.Interface),
+					err: fmt.Errorf("failed to parse prefix %q from interface %q: %v", p.Prefix, p.Interface, err),
+				}
+			}
+
+			delegated = append(delegated, dp)
+			continue
+		}
+
 		pfx, err := parsePrefix(p, epoch)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse prefix %q: %v", p.Prefix, err)
+			return nil, &pluginError{
+				id:  "prefix " + p.Prefix,
+				err: fmt.Errorf("failed to parse prefix %q: %v", p.Prefix, err),
+			}
 		}
 
 		prefixes = append(prefixes, pfx)
 	}
 
-	// For sanity, configured prefixes on a given interface must not overlap.
-	for _, pfx1 := range prefixes {
-		for _, pfx2 := range prefixes {
+	var renumbers []*plugin.Renumber
+	for _, r := range ifi.Renumber {
+		rn, err := parseRenumber(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse renumber plan %q -> %q: %v", r.Old.Prefix, r.New.Prefix, err)
+		}
+
+		renumbers = append(renumbers, rn)
+	}
+
+	// For sanity, configured prefixes on a given interface must not overlap,
+	// including those which are part of renumbering plans.
+	all := append([]*plugin.Prefix(nil), prefixes...)
+	for _, rn := range renumbers {
+		all = append(all, rn.Old, rn.New)
+	}
+
+	for _, pfx1 := range all {
+		for _, pfx2 := range all {
 			var (
 				p1 = ipaddr.NewPrefix(pfx1.Prefix.IPNet())
 				p2 = ipaddr.NewPrefix(pfx2.Prefix.IPNet())
@@ -55,12 +107,21 @@ func parsePlugins(ifi rawInterface, maxInterval time.Duration, epoch time.Time)
 	for _, p := range prefixes {
 		plugins = append(plugins, p)
 	}
+	for _, d := range delegated {
+		plugins = append(plugins, d)
+	}
+	for _, r := range renumbers {
+		plugins = append(plugins, r)
+	}
 
 	var routes []*plugin.Route
 	for _, r := range ifi.Routes {
 		rt, err := parseRoute(r)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse route %q: %v", r.Prefix, err)
+			return nil, &pluginError{
+				id:  "route " + r.Prefix,
+				err: fmt.Errorf("failed to parse route %q: %v", r.Prefix, err),
+			}
 		}
 
 		routes = append(routes, rt)
@@ -85,10 +146,22 @@ func parsePlugins(ifi rawInterface, maxInterval time.Duration, epoch time.Time)
 		plugins = append(plugins, r)
 	}
 
+	if ifi.KernelRoutes != nil {
+		k, err := parseKernelRoutes(*ifi.KernelRoutes, ifi.Name, maxInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse kernel routes: %v", err)
+		}
+
+		plugins = append(plugins, k)
+	}
+
 	for _, r := range ifi.RDNSS {
 		rdnss, err := parseRDNSS(r, maxInterval)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse RDNSS: %v", err)
+			return nil, &pluginError{
+				id:  "rdnss",
+				err: fmt.Errorf("failed to parse RDNSS: %v", err),
+			}
 		}
 
 		plugins = append(plugins, rdnss)
@@ -97,21 +170,114 @@ func parsePlugins(ifi rawInterface, maxInterval time.Duration, epoch time.Time)
 	for _, d := range ifi.DNSSL {
 		dnssl, err := parseDNSSL(d, maxInterval)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse DNSSL: %v", err)
+			return nil, &pluginError{
+				id:  "dnssl",
+				err: fmt.Errorf("failed to parse DNSSL: %v", err),
+			}
 		}
 
 		plugins = append(plugins, dnssl)
 	}
 
-	// Loopback has an MTU of 65536 on Linux. Good enough?
-	if ifi.MTU < 0 || ifi.MTU > 65536 {
-		return nil, fmt.Errorf("MTU (%d) must be between 0 and 65536", ifi.MTU)
+	// Loopback has an MTU of 65536 on Linux. Good enough? An MTU of 0 omits
+	// the MTU option entirely, as advertising an MTU below the IPv6 minimum
+	// is invalid.
+	if ifi.MTU != 0 && (ifi.MTU < 1280 || ifi.MTU > 65536) {
+		return nil, &pluginError{
+			id:  "mtu",
+			err: fmt.Errorf("MTU (%d) must be 0 or between 1280 and 65536", ifi.MTU),
+		}
 	}
 	if ifi.MTU != 0 {
+		if ifi.MTUOverhead != nil {
+			return nil, errors.New("MTU and MTU overhead are mutually exclusive")
+		}
+
 		m := plugin.MTU(ifi.MTU)
 		plugins = append(plugins, &m)
 	}
 
+	if o := ifi.MTUOverhead; o != nil {
+		if *o < 0 || *o > 65536-1280 {
+			return nil, fmt.Errorf("MTU overhead (%d) must be between 0 and %d", *o, 65536-1280)
+		}
+
+		plugins = append(plugins, &plugin.TunnelMTU{Overhead: *o})
+	}
+
+	if ifi.SysctlDefaults {
+		// Only parameters which are not explicitly configured are seeded from
+		// the kernel.
+		s := &plugin.SysctlDefaults{
+			HopLimit:        ifi.HopLimit == nil,
+			MTU:             ifi.MTU == 0 && ifi.MTUOverhead == nil,
+			ReachableTime:   ifi.ReachableTime == "" && ifi.ReachableTimeMin == "" && ifi.ReachableTimeMax == "",
+			RetransmitTimer: ifi.RetransmitTimer == "" && ifi.RetransmitTimerMin == "" && ifi.RetransmitTimerMax == "",
+		}
+
+		if s.HopLimit || s.MTU || s.ReachableTime || s.RetransmitTimer {
+			plugins = append(plugins, s)
+		}
+	}
+
+	if ifi.ManagedPrefix != "" {
+		// The managed flag is either static or dynamic, but not both.
+		if ifi.Managed {
+			return nil, errors.New("managed and managed prefix are mutually exclusive")
+		}
+
+		prefix, err := parseIPPrefix(ifi.ManagedPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid managed prefix: %v", err)
+		}
+
+		plugins = append(plugins, &plugin.ManagedPrefix{Prefix: prefix})
+	}
+
+	// Experimental, off by default.
+	if ifi.Nonce {
+		plugins = append(plugins, &plugin.Nonce{})
+	}
+
+	if cp := ifi.CaptivePortal; cp != nil {
+		if cp.API == "" {
+			return nil, errors.New("captive portal API URL must not be empty")
+		}
+
+		plugins = append(plugins, &plugin.CaptivePortal{
+			API:    cp.API,
+			Strict: cp.Strict,
+		})
+	}
+
+	// Experimental, off by default.
+	for _, r := range ifi.RawOptions {
+		raw, err := parseRawOption(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse raw option: %v", err)
+		}
+
+		plugins = append(plugins, raw)
+	}
+
+	if ifi.Upstream != nil {
+		u, err := parseUpstream(*ifi.Upstream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse upstream: %v", err)
+		}
+
+		plugins = append(plugins, u)
+	}
+
+	if ifi.VRRP != nil {
+		v, err := parseVRRP(*ifi.VRRP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse VRRP: %v", err)
+		}
+
+		plugins = append(plugins, v)
+	}
+
 	// Always set unless explicitly false.
 	if ifi.SourceLLA == nil || *ifi.SourceLLA {
 		plugins = append(plugins, &plugin.LLA{})
@@ -120,6 +286,69 @@ func parsePlugins(ifi rawInterface, maxInterval time.Duration, epoch time.Time)
 	return plugins, nil
 }
 
+// parsePluginSet parses an optional plugin set for ifi. The plugin set's
+// options replace those of the same kinds in shared, and the remaining shared
+// plugins are reused as-is. If set is nil, it returns nil so that shared is
+// used instead.
+func parsePluginSet(ifi rawInterface, set *rawPluginSet, shared []plugin.Plugin, maxInterval time.Duration, epoch time.Time) ([]plugin.Plugin, error) {
+	if set == nil {
+		return nil, nil
+	}
+
+	// Parse only the plugin set's options, omitting the lla plugin which is
+	// always shared.
+	noLLA := false
+	plugins, err := parsePlugins(rawInterface{
+		Name:        ifi.Name,
+		Prefixes:    set.Prefixes,
+		Routes:      set.Routes,
+		RDNSS:       set.RDNSS,
+		DNSSL:       set.DNSSL,
+		MTU:         set.MTU,
+		MTUOverhead: set.MTUOverhead,
+		RawOptions:  set.RawOptions,
+		SourceLLA:   &noLLA,
+	}, maxInterval, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Always produce a non-nil slice so the set is used even if it is empty.
+	out := make([]plugin.Plugin, 0, len(plugins)+len(shared))
+	out = append(out, plugins...)
+	for _, p := range shared {
+		switch p := p.(type) {
+		case *plugin.Prefix, *plugin.DelegatedPrefix, *plugin.Route, *plugin.RDNSS,
+			*plugin.DNSSL, *plugin.MTU, *plugin.TunnelMTU, *plugin.Raw:
+			// Replaced by the plugin set.
+		case *plugin.SysctlDefaults:
+			// A set which configures its own MTU must not also advertise the
+			// kernel's MTU, so drop that parameter from the shared plugin.
+			if !p.MTU || (set.MTU == 0 && set.MTUOverhead == nil) {
+				out = append(out, p)
+				continue
+			}
+
+			sd := *p
+			sd.MTU = false
+			if sd.HopLimit || sd.ReachableTime || sd.RetransmitTimer {
+				out = append(out, &sd)
+			}
+		default:
+			out = append(out, p)
+		}
+	}
+
+	return out, nil
+}
+
+// hasSetOptions reports whether ifi configures any options which may also be
+// configured in a plugin set.
+func hasSetOptions(ifi rawInterface) bool {
+	return len(ifi.Prefixes) > 0 || len(ifi.Routes) > 0 || len(ifi.RDNSS) > 0 ||
+		len(ifi.DNSSL) > 0 || ifi.MTU != 0 || ifi.MTUOverhead != nil || len(ifi.RawOptions) > 0
+}
+
 // parseDNSSL parses a DNSSL plugin.
 func parseDNSSL(d rawDNSSL, maxInterval time.Duration) (*plugin.DNSSL, error) {
 	lifetime, err := parseDuration(d.Lifetime)
@@ -136,9 +365,16 @@ func parseDNSSL(d rawDNSSL, maxInterval time.Duration) (*plugin.DNSSL, error) {
 		return nil, errors.New("must specify one or more DNS search domain names")
 	}
 
+	max, err := parseMaxEntries(d.MaxDomainNames, d.Truncate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max domain names: %v", err)
+	}
+
 	return &plugin.DNSSL{
-		Lifetime:    lifetime,
-		DomainNames: d.DomainNames,
+		Lifetime:       lifetime,
+		DomainNames:    d.DomainNames,
+		MaxDomainNames: max,
+		Truncate:       d.Truncate,
 	}, nil
 }
 
@@ -155,6 +391,10 @@ func parsePrefix(p rawPrefix, epoch time.Time) (*plugin.Prefix, error) {
 		return nil, errors.New("only ::/64 is permitted for inferring prefixes from interface addresses")
 	}
 
+	if p.Subnet != nil && p.Interface == "" {
+		return nil, errors.New("subnet is only permitted along with interface")
+	}
+
 	valid, err := parseDuration(p.ValidLifetime)
 	if err != nil {
 		return nil, fmt.Errorf("invalid valid lifetime: %v", err)
@@ -181,10 +421,25 @@ func parsePrefix(p rawPrefix, epoch time.Time) (*plugin.Prefix, error) {
 		preferred = 4 * time.Hour
 	}
 
-	// See: https://tools.ietf.org/html/rfc4861#section-4.6.2.
-	if preferred > valid {
-		return nil, fmt.Errorf("preferred lifetime of %s exceeds valid lifetime of %s",
-			preferred, valid)
+	if err := plugin.CheckLifetimes(valid, preferred); err != nil {
+		return nil, err
+	}
+
+	tempValid, tempPreferred, err := parseTemporaryLifetimes(p, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.MaxAddressFailures < 0 {
+		return nil, fmt.Errorf("max address failures (%d) must not be negative", p.MaxAddressFailures)
+	}
+	if p.MaxAddressFailures > 0 && prefix.IP != netaddr.IPv6Unspecified() {
+		return nil, errors.New("max address failures is only permitted for ::/64")
+	}
+
+	exclude, err := parseExcludePrefixes(p.ExcludePrefixes, prefix)
+	if err != nil {
+		return nil, err
 	}
 
 	onLink := true
@@ -197,17 +452,220 @@ func parsePrefix(p rawPrefix, epoch time.Time) (*plugin.Prefix, error) {
 		auto = *p.Autonomous
 	}
 
+	// The DHCPv6 preset advertises an on-link prefix from which hosts must not
+	// configure addresses using SLAAC, so hosts can reach the subnet directly
+	// while acquiring their addresses using DHCPv6.
+	if p.DHCPv6 {
+		if p.OnLink != nil || p.Autonomous != nil {
+			return nil, errors.New("dhcpv6 is mutually exclusive with on_link and autonomous")
+		}
+
+		onLink, auto = true, false
+	}
+
+	if p.VerifyEUI64 && !auto {
+		return nil, errors.New("verify_eui64 is only permitted for autonomous prefixes")
+	}
+
 	return &plugin.Prefix{
-		Prefix:            prefix,
-		OnLink:            onLink,
-		Autonomous:        auto,
-		ValidLifetime:     valid,
-		PreferredLifetime: preferred,
-		Deprecated:        p.Deprecated,
-		Epoch:             epoch,
+		Prefix:                     prefix,
+		OnLink:                     onLink,
+		Autonomous:                 auto,
+		ValidLifetime:              valid,
+		PreferredLifetime:          preferred,
+		TemporaryValidLifetime:     tempValid,
+		TemporaryPreferredLifetime: tempPreferred,
+		MaxAddrsFailures:           p.MaxAddressFailures,
+		ExcludePrefixes:            exclude,
+		Deprecated:                 p.Deprecated,
+		RouterAddress:              p.RouterAddress,
+		VerifyEUI64:                p.VerifyEUI64,
+		Epoch:                      epoch,
+	}, nil
+}
+
+// parseExcludePrefixes parses the prefixes excluded from expanding prefix.
+func parseExcludePrefixes(ss []string, prefix netaddr.IPPrefix) ([]netaddr.IPPrefix, error) {
+	if len(ss) == 0 {
+		return nil, nil
+	}
+
+	if prefix.IP != netaddr.IPv6Unspecified() {
+		return nil, errors.New("exclude prefixes is only permitted for ::/64")
+	}
+
+	exclude := make([]netaddr.IPPrefix, 0, len(ss))
+	for _, s := range ss {
+		e, err := parseIPPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude prefix: %v", err)
+		}
+
+		if e.IP == netaddr.IPv6Unspecified() {
+			return nil, fmt.Errorf("exclude prefix %s would exclude all prefixes", e)
+		}
+
+		exclude = append(exclude, e)
+	}
+
+	return exclude, nil
+}
+
+// parseDelegatedPrefix parses a DelegatedPrefix plugin for the interface name.
+func parseDelegatedPrefix(p rawPrefix, name string, epoch time.Time) (*plugin.DelegatedPrefix, error) {
+	if p.Interface == name {
+		return nil, errors.New("prefixes must be derived from an interface other than the one being advertised")
+	}
+	if p.RouterAddress {
+		return nil, errors.New("router_address is not permitted for prefixes derived from another interface")
+	}
+	if p.VerifyEUI64 {
+		return nil, errors.New("verify_eui64 is not permitted for prefixes derived from another interface")
+	}
+
+	pfx, err := parsePrefix(p, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case pfx.Prefix.IP != netaddr.IPv6Unspecified():
+		return nil, errors.New("only ::/64 is permitted for deriving prefixes from another interface")
+	case pfx.Deprecated:
+		return nil, errors.New("deprecated is not permitted, derived prefixes are withdrawn automatically")
+	case pfx.TemporaryValidLifetime != 0 || pfx.MaxAddrsFailures != 0:
+		return nil, errors.New("temporary lifetimes and max address failures are not permitted for derived prefixes")
+	case len(pfx.ExcludePrefixes) > 0:
+		return nil, errors.New("exclude prefixes is not permitted for derived prefixes")
+	}
+
+	var subnet int
+	if p.Subnet != nil {
+		subnet = *p.Subnet
+	}
+	if subnet < 0 {
+		return nil, fmt.Errorf("subnet (%d) must not be negative", subnet)
+	}
+
+	return &plugin.DelegatedPrefix{
+		Prefix:    pfx,
+		Interface: p.Interface,
+		Subnet:    subnet,
+	}, nil
+}
+
+// parseRenumber parses a Renumber plugin.
+func parseRenumber(r rawRenumber) (*plugin.Renumber, error) {
+	if r.Start == "" {
+		return nil, errors.New("must specify a start time")
+	}
+
+	start, err := time.Parse(time.RFC3339, r.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time: %v", err)
+	}
+
+	oldP, err := parseRenumberPrefix(r.Old)
+	if err != nil {
+		return nil, fmt.Errorf("invalid old prefix: %v", err)
+	}
+
+	newP, err := parseRenumberPrefix(r.New)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new prefix: %v", err)
+	}
+
+	if oldP.Prefix == newP.Prefix {
+		return nil, fmt.Errorf("old and new prefixes must differ, but both are %s", oldP.Prefix)
+	}
+
+	// By default, the old prefix is no longer valid once its valid lifetime
+	// has elapsed after the start time.
+	window := oldP.ValidLifetime
+	if r.Window != "" {
+		d, err := time.ParseDuration(r.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window: %v", err)
+		}
+		window = d
+	}
+
+	if window <= 0 {
+		return nil, fmt.Errorf("window (%s) must be greater than zero", window)
+	}
+
+	return &plugin.Renumber{
+		Old:    oldP,
+		New:    newP,
+		Start:  start,
+		Window: window,
 	}, nil
 }
 
+// parseRenumberPrefix parses a Prefix which is part of a renumbering plan.
+func parseRenumberPrefix(p rawPrefix) (*plugin.Prefix, error) {
+	if p.Deprecated {
+		return nil, errors.New("prefix must not be deprecated, the renumbering plan deprecates the old prefix")
+	}
+	if p.Interface != "" {
+		return nil, errors.New("prefix must not be derived from another interface")
+	}
+	if p.RouterAddress {
+		return nil, errors.New("prefix must not set router_address")
+	}
+
+	pfx, err := parsePrefix(p, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	if pfx.Prefix.IP == netaddr.IPv6Unspecified() {
+		return nil, fmt.Errorf("prefix %s must be an exact prefix", pfx.Prefix)
+	}
+
+	return pfx, nil
+}
+
+// parseTemporaryLifetimes parses the optional lifetimes applied to prefixes
+// which are only associated with temporary addresses on an interface.
+func parseTemporaryLifetimes(p rawPrefix, prefix netaddr.IPPrefix) (valid, preferred time.Duration, err error) {
+	if p.TemporaryValidLifetime == nil && p.TemporaryPreferredLifetime == nil {
+		// Temporary lifetimes are not in use.
+		return 0, 0, nil
+	}
+
+	if p.TemporaryValidLifetime == nil || p.TemporaryPreferredLifetime == nil {
+		return 0, 0, errors.New("temporary valid and preferred lifetimes must be specified together")
+	}
+
+	if prefix.IP != netaddr.IPv6Unspecified() {
+		return 0, 0, errors.New("temporary lifetimes are only permitted for ::/64")
+	}
+
+	valid, err = parseDuration(p.TemporaryValidLifetime)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid temporary valid lifetime: %v", err)
+	}
+
+	preferred, err = parseDuration(p.TemporaryPreferredLifetime)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid temporary preferred lifetime: %v", err)
+	}
+
+	// There are no sane defaults for these values, so they must be explicit.
+	for _, d := range []time.Duration{valid, preferred} {
+		if d == 0 || d == durationAuto {
+			return 0, 0, errors.New("temporary lifetimes must be explicit non-zero values")
+		}
+	}
+
+	if err := plugin.CheckLifetimes(valid, preferred); err != nil {
+		return 0, 0, fmt.Errorf("invalid temporary lifetimes: %v", err)
+	}
+
+	return valid, preferred, nil
+}
+
 // parsePrefix parses a Prefix plugin.
 func parseRoute(r rawRoute) (*plugin.Route, error) {
 	prefix, err := parseIPPrefix(r.Prefix)
@@ -240,7 +698,106 @@ func parseRoute(r rawRoute) (*plugin.Route, error) {
 	}, nil
 }
 
-// parseDNSSL parses a DNSSL plugin.
+// routeProtocols maps the names of common routing protocols and daemons to
+// their route protocol numbers in the Linux kernel's routing tables.
+var routeProtocols = map[string]uint8{
+	"kernel": 2,
+	"boot":   3,
+	"static": 4,
+	"ra":     9,
+	"zebra":  11,
+	"bird":   12,
+	"dhcp":   16,
+	"babel":  42,
+	"bgp":    186,
+	"isis":   187,
+	"ospf":   188,
+	"rip":    189,
+}
+
+// parseKernelRoutes parses a KernelRoutes plugin for the interface name.
+func parseKernelRoutes(k rawKernelRoutes, name string, maxInterval time.Duration) (*plugin.KernelRoutes, error) {
+	// Use the main routing table by default.
+	table := 254
+	if k.Table != nil {
+		table = *k.Table
+	}
+
+	if table < 1 || int64(table) > math.MaxUint32 {
+		return nil, fmt.Errorf("table (%d) must be between 1 and %d", table, uint32(math.MaxUint32))
+	}
+
+	var protocol uint8
+	if k.Protocol != "" {
+		p, ok := routeProtocols[k.Protocol]
+		if !ok {
+			// Also permit protocols which are only known by number.
+			n, err := strconv.ParseUint(k.Protocol, 10, 8)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid protocol: %q", k.Protocol)
+			}
+
+			p = uint8(n)
+		}
+
+		protocol = p
+	}
+
+	if k.Metric < 0 || int64(k.Metric) > math.MaxUint32 {
+		return nil, fmt.Errorf("metric (%d) must be between 0 and %d", k.Metric, uint32(math.MaxUint32))
+	}
+
+	if k.Interface != "" && k.Interface == name {
+		return nil, fmt.Errorf("interface %q must not be the advertising interface", k.Interface)
+	}
+
+	pref, err := parsePreference(k.Preference)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime, err := parseDuration(k.Lifetime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lifetime: %v", err)
+	}
+
+	// Withdrawn routes are advertised until their lifetime would have
+	// elapsed, so the lifetime must be finite. If auto, compute lifetime as
+	// recommended by radvd.
+	switch lifetime {
+	case 0:
+		return nil, errors.New("lifetime must be non-zero")
+	case ndp.Infinity:
+		return nil, errors.New("lifetime must not be infinite")
+	case durationAuto:
+		lifetime = 3 * maxInterval
+	}
+
+	interval := 10 * time.Second
+	if k.Interval != "" {
+		d, err := time.ParseDuration(k.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %v", err)
+		}
+		interval = d
+	}
+
+	if interval < 1*time.Second || interval > 1*time.Hour {
+		return nil, fmt.Errorf("interval (%s) must be between 1 and 3600 seconds", interval)
+	}
+
+	return &plugin.KernelRoutes{
+		Table:      uint32(table),
+		Protocol:   protocol,
+		Metric:     uint32(k.Metric),
+		Interface:  k.Interface,
+		Preference: pref,
+		Lifetime:   lifetime,
+		Interval:   interval,
+	}, nil
+}
+
+// parseRDNSS parses a RDNSS plugin.
 func parseRDNSS(d rawRDNSS, maxInterval time.Duration) (*plugin.RDNSS, error) {
 	lifetime, err := parseDuration(d.Lifetime)
 	if err != nil {
@@ -256,9 +813,20 @@ func parseRDNSS(d rawRDNSS, maxInterval time.Duration) (*plugin.RDNSS, error) {
 		return nil, errors.New("must specify one or more DNS server IPv6 addresses")
 	}
 
-	// Parse all server addresses as IPv6 addresses.
+	// Parse all server addresses as IPv6 addresses, except for the sentinel
+	// which refers to this interface's own addresses.
+	var iface bool
 	servers := make([]netaddr.IP, 0, len(d.Servers))
 	for _, s := range d.Servers {
+		if s == "interface" {
+			if iface {
+				return nil, errors.New("interface may only be specified once in servers")
+			}
+
+			iface = true
+			continue
+		}
+
 		ip, err := netaddr.ParseIP(s)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse IP address %q: %v", s, err)
@@ -270,9 +838,183 @@ func parseRDNSS(d rawRDNSS, maxInterval time.Duration) (*plugin.RDNSS, error) {
 		servers = append(servers, ip)
 	}
 
+	var pref plugin.AddressPreference
+	switch d.InterfaceAddresses {
+	case "", "stable":
+		pref = plugin.StableAddresses
+	case "lowest_stable":
+		pref = plugin.LowestStableAddress
+	default:
+		return nil, fmt.Errorf("invalid interface addresses %q", d.InterfaceAddresses)
+	}
+
+	if pref != plugin.StableAddresses && !iface {
+		return nil, errors.New("interface addresses requires interface in servers")
+	}
+
+	max, err := parseMaxEntries(d.MaxServers, d.Truncate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max servers: %v", err)
+	}
+
 	return &plugin.RDNSS{
-		Lifetime: lifetime,
-		Servers:  servers,
+		Lifetime:           lifetime,
+		Servers:            servers,
+		MaxServers:         max,
+		Truncate:           d.Truncate,
+		Interface:          iface,
+		InterfaceAddresses: pref,
+	}, nil
+}
+
+// modeledTypes are the NDP option types which CoreRAD configures using other
+// plugins, and which hosts and CoreRAD itself would parse as those options.
+var modeledTypes = map[int]bool{
+	1:                        true, // Source link-layer address.
+	2:                        true, // Target link-layer address.
+	3:                        true, // Prefix information.
+	5:                        true, // MTU.
+	plugin.NonceType:         true,
+	24:                       true, // Route information.
+	25:                       true, // Recursive DNS servers.
+	31:                       true, // DNS search list.
+	plugin.CaptivePortalType: true,
+}
+
+// parseRawOption parses a Raw plugin.
+func parseRawOption(r rawRawOption) (*plugin.Raw, error) {
+	if r.Type < 1 || r.Type > 255 {
+		return nil, fmt.Errorf("type (%d) must be between 1 and 255", r.Type)
+	}
+	if modeledTypes[r.Type] {
+		return nil, fmt.Errorf("type %d must be configured using its own plugin", r.Type)
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+
+	switch {
+	case r.Hex != "" && r.Base64 != "":
+		return nil, errors.New("hex and base64 values are mutually exclusive")
+	case r.Hex != "":
+		b, err = hex.DecodeString(r.Hex)
+	case r.Base64 != "":
+		b, err = base64.StdEncoding.DecodeString(r.Base64)
+	default:
+		return nil, errors.New("must specify a hex or base64 value")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+
+	// Verify the value is correctly framed before it is ever advertised.
+	if _, err := plugin.NewRawOption(uint8(r.Type), b); err != nil {
+		return nil, err
+	}
+
+	return &plugin.Raw{
+		Type:  uint8(r.Type),
+		Value: b,
+	}, nil
+}
+
+// defaultMaxEntries is the default number of RDNSS servers or DNSSL domain
+// names which hosts are expected to accept, per RFC 8106, section 5.3.
+const defaultMaxEntries = 3
+
+// parseMaxEntries parses the maximum number of entries for a RDNSS or DNSSL
+// plugin. A value of 0 disables the limit.
+func parseMaxEntries(max *int, truncate bool) (int, error) {
+	n := defaultMaxEntries
+	if max != nil {
+		// Override if specified.
+		n = *max
+	}
+
+	switch {
+	case n < 0:
+		return 0, fmt.Errorf("value (%d) must not be negative", n)
+	case n == 0 && truncate:
+		return 0, errors.New("truncate requires a non-zero limit")
+	}
+
+	return n, nil
+}
+
+// parseUpstream parses an Upstream plugin.
+func parseUpstream(u rawUpstream) (*plugin.Upstream, error) {
+	interval := 5 * time.Second
+	if u.Interval != "" {
+		d, err := time.ParseDuration(u.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %v", err)
+		}
+		interval = d
+	}
+
+	if interval < 1*time.Second || interval > 1*time.Hour {
+		return nil, fmt.Errorf("interval (%s) must be between 1 and 3600 seconds", interval)
+	}
+
+	hysteresis := 3
+	if u.Hysteresis != nil {
+		hysteresis = *u.Hysteresis
+	}
+
+	if hysteresis < 1 || hysteresis > 100 {
+		return nil, fmt.Errorf("hysteresis (%d) must be between 1 and 100", hysteresis)
+	}
+
+	return &plugin.Upstream{
+		Interval:   interval,
+		Hysteresis: hysteresis,
+	}, nil
+}
+
+// parseVRRP parses a VRRP plugin.
+func parseVRRP(v rawVRRP) (*plugin.VRRP, error) {
+	if (v.Address == "") == (v.StateFile == "") {
+		return nil, errors.New("must specify exactly one of address or state file")
+	}
+
+	var ip netaddr.IP
+	if v.Address != "" {
+		addr, err := netaddr.ParseIP(v.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse address %q: %v", v.Address, err)
+		}
+		ip = addr
+	}
+
+	interval := 1 * time.Second
+	if v.Interval != "" {
+		d, err := time.ParseDuration(v.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %v", err)
+		}
+		interval = d
+	}
+
+	if interval < 1*time.Second || interval > 1*time.Hour {
+		return nil, fmt.Errorf("interval (%s) must be between 1 and 3600 seconds", interval)
+	}
+
+	hysteresis := 2
+	if v.Hysteresis != nil {
+		hysteresis = *v.Hysteresis
+	}
+
+	if hysteresis < 1 || hysteresis > 100 {
+		return nil, fmt.Errorf("hysteresis (%d) must be between 1 and 100", hysteresis)
+	}
+
+	return &plugin.VRRP{
+		Interval:   interval,
+		Hysteresis: hysteresis,
+		Address:    ip,
+		StateFile:  v.StateFile,
 	}, nil
 }
 
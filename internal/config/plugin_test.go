@@ -20,6 +20,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/mdlayher/corerad/internal/crtest"
 	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/ndp"
@@ -54,6 +55,25 @@ func Test_parseDNSSL(t *testing.T) {
 			  domain_names = []
 			`,
 		},
+		{
+			name: "bad max domain names",
+			s: `
+			[[interfaces]]
+			  [[interfaces.dnssl]]
+			  domain_names = ["foo.example.com"]
+			  max_domain_names = -1
+			`,
+		},
+		{
+			name: "bad truncate no limit",
+			s: `
+			[[interfaces]]
+			  [[interfaces.dnssl]]
+			  domain_names = ["foo.example.com"]
+			  max_domain_names = 0
+			  truncate = true
+			`,
+		},
 		{
 			name: "OK explicit",
 			s: `
@@ -63,8 +83,9 @@ func Test_parseDNSSL(t *testing.T) {
 			  lifetime = "30s"
 			`,
 			d: &plugin.DNSSL{
-				Lifetime:    30 * time.Second,
-				DomainNames: []string{"foo.example.com", "bar.example.com"},
+				Lifetime:       30 * time.Second,
+				DomainNames:    []string{"foo.example.com", "bar.example.com"},
+				MaxDomainNames: 3,
 			},
 			ok: true,
 		},
@@ -76,8 +97,9 @@ func Test_parseDNSSL(t *testing.T) {
 			  domain_names = ["foo.example.com"]
 			`,
 			d: &plugin.DNSSL{
-				Lifetime:    20 * time.Minute,
-				DomainNames: []string{"foo.example.com"},
+				Lifetime:       20 * time.Minute,
+				DomainNames:    []string{"foo.example.com"},
+				MaxDomainNames: 3,
 			},
 			ok: true,
 		},
@@ -89,12 +111,44 @@ func Test_parseDNSSL(t *testing.T) {
 			  domain_names = ["foo.example.com"]
 			  lifetime = "auto"
 			`,
+			d: &plugin.DNSSL{
+				Lifetime:       20 * time.Minute,
+				DomainNames:    []string{"foo.example.com"},
+				MaxDomainNames: 3,
+			},
+			ok: true,
+		},
+		{
+			name: "OK no limit",
+			s: `
+			[[interfaces]]
+			  [[interfaces.dnssl]]
+			  domain_names = ["foo.example.com"]
+			  max_domain_names = 0
+			`,
 			d: &plugin.DNSSL{
 				Lifetime:    20 * time.Minute,
 				DomainNames: []string{"foo.example.com"},
 			},
 			ok: true,
 		},
+		{
+			name: "OK truncate",
+			s: `
+			[[interfaces]]
+			  [[interfaces.dnssl]]
+			  domain_names = ["foo.example.com", "bar.example.com"]
+			  max_domain_names = 1
+			  truncate = true
+			`,
+			d: &plugin.DNSSL{
+				Lifetime:       20 * time.Minute,
+				DomainNames:    []string{"foo.example.com", "bar.example.com"},
+				MaxDomainNames: 1,
+				Truncate:       true,
+			},
+			ok: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -110,7 +164,7 @@ func Test_parseMTU(t *testing.T) {
 	tests := []struct {
 		name string
 		s    string
-		m    *plugin.MTU
+		m    plugin.Plugin
 		ok   bool
 	}{
 		{
@@ -127,6 +181,30 @@ func Test_parseMTU(t *testing.T) {
 			mtu = 999999
 			`,
 		},
+		{
+			name: "below IPv6 minimum",
+			s: `
+			[[interfaces]]
+			mtu = 1279
+			`,
+		},
+		{
+			name: "OK omitted",
+			s: `
+			[[interfaces]]
+			mtu = 0
+			`,
+			ok: true,
+		},
+		{
+			name: "OK IPv6 minimum",
+			s: `
+			[[interfaces]]
+			mtu = 1280
+			`,
+			m:  plugin.NewMTU(1280),
+			ok: true,
+		},
 		{
 			name: "OK",
 			s: `
@@ -136,6 +214,30 @@ func Test_parseMTU(t *testing.T) {
 			m:  plugin.NewMTU(1500),
 			ok: true,
 		},
+		{
+			name: "overhead and MTU",
+			s: `
+			[[interfaces]]
+			mtu = 1500
+			mtu_overhead = 80
+			`,
+		},
+		{
+			name: "overhead too low",
+			s: `
+			[[interfaces]]
+			mtu_overhead = -1
+			`,
+		},
+		{
+			name: "OK overhead",
+			s: `
+			[[interfaces]]
+			mtu_overhead = 80
+			`,
+			m:  &plugin.TunnelMTU{Overhead: 80},
+			ok: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -145,186 +247,1249 @@ func Test_parseMTU(t *testing.T) {
 	}
 }
 
-func Test_parsePrefix(t *testing.T) {
+func Test_parseSysctlDefaults(t *testing.T) {
 	t.Parallel()
 
-	defaults := &plugin.Prefix{
-		Prefix:            crtest.MustIPPrefix("::/64"),
-		OnLink:            true,
-		Autonomous:        true,
-		PreferredLifetime: 4 * time.Hour,
-		ValidLifetime:     24 * time.Hour,
+	tests := []struct {
+		name string
+		s    string
+		sd   *plugin.SysctlDefaults
+	}{
+		{
+			name: "all",
+			s: `
+			[[interfaces]]
+			sysctl_defaults = true
+			`,
+			sd: &plugin.SysctlDefaults{
+				HopLimit:        true,
+				MTU:             true,
+				ReachableTime:   true,
+				RetransmitTimer: true,
+			},
+		},
+		{
+			name: "explicit overrides",
+			s: `
+			[[interfaces]]
+			sysctl_defaults = true
+			hop_limit = 64
+			reachable_time = "30s"
+			retransmit_timer = "1s"
+			`,
+			sd: &plugin.SysctlDefaults{MTU: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, true, tt.sd)
+		})
+	}
+}
+
+func Test_parsePluginSetMTU(t *testing.T) {
+	t.Parallel()
+
+	sysctl := &plugin.SysctlDefaults{HopLimit: true, MTU: true}
+
+	tests := []struct {
+		name   string
+		set    rawPluginSet
+		shared []plugin.Plugin
+		want   []plugin.Plugin
+	}{
+		{
+			name:   "MTU replaces MTU",
+			set:    rawPluginSet{MTU: 9000},
+			shared: []plugin.Plugin{plugin.NewMTU(1500), &plugin.LLA{}},
+			want:   []plugin.Plugin{plugin.NewMTU(9000), &plugin.LLA{}},
+		},
+		{
+			name:   "MTU overhead replaces MTU",
+			set:    rawPluginSet{MTUOverhead: intp(80)},
+			shared: []plugin.Plugin{plugin.NewMTU(1500)},
+			want:   []plugin.Plugin{&plugin.TunnelMTU{Overhead: 80}},
+		},
+		{
+			name:   "no MTU omits MTU",
+			shared: []plugin.Plugin{&plugin.TunnelMTU{Overhead: 80}, &plugin.LLA{}},
+			want:   []plugin.Plugin{&plugin.LLA{}},
+		},
+		{
+			name:   "no MTU keeps sysctl MTU",
+			shared: []plugin.Plugin{sysctl},
+			want:   []plugin.Plugin{sysctl},
+		},
+		{
+			name:   "MTU replaces sysctl MTU",
+			set:    rawPluginSet{MTU: 9000},
+			shared: []plugin.Plugin{sysctl},
+			want: []plugin.Plugin{
+				plugin.NewMTU(9000),
+				&plugin.SysctlDefaults{HopLimit: true},
+			},
+		},
+		{
+			name:   "MTU replaces sysctl",
+			set:    rawPluginSet{MTU: 9000},
+			shared: []plugin.Plugin{&plugin.SysctlDefaults{MTU: true}},
+			want:   []plugin.Plugin{plugin.NewMTU(9000)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePluginSet(rawInterface{}, &tt.set, tt.shared, 10*time.Minute, time.Time{})
+			if err != nil {
+				t.Fatalf("failed to parse plugin set: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected plugins (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// The shared plugin must not be modified.
+	if !sysctl.MTU {
+		t.Fatal("shared sysctl defaults plugin was modified")
+	}
+}
+
+func Test_parseManagedPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		mp   *plugin.ManagedPrefix
+		ok   bool
+	}{
+		{
+			name: "bad prefix",
+			s: `
+			[[interfaces]]
+			managed_prefix = "foo"
+			`,
+		},
+		{
+			name: "managed and managed prefix",
+			s: `
+			[[interfaces]]
+			managed = true
+			managed_prefix = "2001:db8::/48"
+			`,
+		},
+		{
+			name: "OK",
+			s: `
+			[[interfaces]]
+			managed_prefix = "2001:db8::/48"
+			`,
+			mp: &plugin.ManagedPrefix{
+				Prefix: crtest.MustIPPrefix("2001:db8::/48"),
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.mp)
+		})
+	}
+}
+
+func Test_parseRenumber(t *testing.T) {
+	t.Parallel()
+
+	prefix := func(s string) *plugin.Prefix {
+		return &plugin.Prefix{
+			Prefix:            crtest.MustIPPrefix(s),
+			OnLink:            true,
+			Autonomous:        true,
+			ValidLifetime:     24 * time.Hour,
+			PreferredLifetime: 4 * time.Hour,
+		}
 	}
 
 	tests := []struct {
 		name string
 		s    string
-		p    *plugin.Prefix
+		r    *plugin.Renumber
 		ok   bool
 	}{
 		{
-			name: "no prefix",
+			name: "no start",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
+			  [[interfaces.renumber]]
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
 			`,
 		},
 		{
-			name: "bad prefix string",
+			name: "bad start",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "foo"
+			  [[interfaces.renumber]]
+			  start = "foo"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
 			`,
 		},
 		{
-			name: "bad prefix individual IP",
+			name: "bad old prefix",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "::1/64"
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "foo"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
 			`,
 		},
 		{
-			name: "bad prefix IPv4",
+			name: "inferred new prefix",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "192.0.2.0/24"
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "::/64"
 			`,
 		},
 		{
-			name: "bad prefix IPv6-mapped IPv4",
+			name: "deprecated old prefix",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "::ffff:192.0.2.0/128"
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    deprecated = true
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
 			`,
 		},
 		{
-			name: "bad prefix ::/N",
+			name: "derived old prefix",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "::/63"
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    interface = "eth0"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
 			`,
 		},
 		{
-			name: "bad valid lifetime string",
+			name: "same prefixes",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "::/64"
-			  valid_lifetime = "foo"
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:1::/64"
 			`,
 		},
 		{
-			name: "bad valid lifetime zero",
+			name: "overlapping prefix",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
-			  prefix = "::/64"
-			  valid_lifetime = ""
+			  prefix = "2001:db8::/48"
+
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8::/64"
 			`,
 		},
 		{
-			name: "bad preferred lifetime string",
+			name: "bad window",
 			s: `
 			[[interfaces]]
-			  [[interfaces.prefix]]
-			  prefix = "::/64"
-			  preferred_lifetime = "foo"
-			  valid_lifetime = "2s"
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			  window = "0s"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
+			`,
+		},
+		{
+			name: "OK default window",
+			s: `
+			[[interfaces]]
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
+			`,
+			r: &plugin.Renumber{
+				Old:    prefix("2001:db8:1::/64"),
+				New:    prefix("2001:db8:2::/64"),
+				Start:  time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Window: 24 * time.Hour,
+			},
+			ok: true,
+		},
+		{
+			name: "OK explicit window",
+			s: `
+			[[interfaces]]
+			  [[interfaces.renumber]]
+			  start = "2020-01-01T00:00:00Z"
+			  window = "2h"
+			    [interfaces.renumber.old]
+			    prefix = "2001:db8:1::/64"
+			    [interfaces.renumber.new]
+			    prefix = "2001:db8:2::/64"
+			`,
+			r: &plugin.Renumber{
+				Old:    prefix("2001:db8:1::/64"),
+				New:    prefix("2001:db8:2::/64"),
+				Start:  time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Window: 2 * time.Hour,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.r)
+		})
+	}
+}
+
+func Test_parseUpstream(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		u    *plugin.Upstream
+		ok   bool
+	}{
+		{
+			name: "bad interval",
+			s: `
+			[[interfaces]]
+			  [interfaces.upstream]
+			  interval = "foo"
+			`,
+		},
+		{
+			name: "interval too low",
+			s: `
+			[[interfaces]]
+			  [interfaces.upstream]
+			  interval = "100ms"
+			`,
+		},
+		{
+			name: "hysteresis too low",
+			s: `
+			[[interfaces]]
+			  [interfaces.upstream]
+			  hysteresis = 0
+			`,
+		},
+		{
+			name: "OK defaults",
+			s: `
+			[[interfaces]]
+			  [interfaces.upstream]
+			`,
+			u: &plugin.Upstream{
+				Interval:   5 * time.Second,
+				Hysteresis: 3,
+			},
+			ok: true,
+		},
+		{
+			name: "OK explicit",
+			s: `
+			[[interfaces]]
+			  [interfaces.upstream]
+			  interval = "30s"
+			  hysteresis = 1
+			`,
+			u: &plugin.Upstream{
+				Interval:   30 * time.Second,
+				Hysteresis: 1,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.u)
+		})
+	}
+}
+
+func Test_parseVRRP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		v    *plugin.VRRP
+		ok   bool
+	}{
+		{
+			name: "no source",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			`,
+		},
+		{
+			name: "both sources",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  address = "fe80::1"
+			  state_file = "/run/vrrp"
+			`,
+		},
+		{
+			name: "bad address",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  address = "foo"
+			`,
+		},
+		{
+			name: "bad interval",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  address = "fe80::1"
+			  interval = "foo"
+			`,
+		},
+		{
+			name: "interval too low",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  address = "fe80::1"
+			  interval = "100ms"
+			`,
+		},
+		{
+			name: "hysteresis too low",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  address = "fe80::1"
+			  hysteresis = 0
+			`,
+		},
+		{
+			name: "OK address",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  address = "fe80::1"
+			`,
+			v: &plugin.VRRP{
+				Interval:   1 * time.Second,
+				Hysteresis: 2,
+				Address:    crtest.MustIP("fe80::1"),
+			},
+			ok: true,
+		},
+		{
+			name: "OK state file",
+			s: `
+			[[interfaces]]
+			  [interfaces.vrrp]
+			  state_file = "/run/keepalived/eth0.state"
+			  interval = "5s"
+			  hysteresis = 1
+			`,
+			v: &plugin.VRRP{
+				Interval:   5 * time.Second,
+				Hysteresis: 1,
+				StateFile:  "/run/keepalived/eth0.state",
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.v)
+		})
+	}
+}
+
+func Test_parseCaptivePortal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		cp   *plugin.CaptivePortal
+		ok   bool
+	}{
+		{
+			name: "empty API",
+			s: `
+			[[interfaces]]
+			  [interfaces.captive_portal]
+			  strict = true
+			`,
+		},
+		{
+			name: "OK",
+			s: `
+			[[interfaces]]
+			  [interfaces.captive_portal]
+			  api = "https://portal.example.com/api"
+			  strict = true
+			`,
+			cp: &plugin.CaptivePortal{
+				API:    "https://portal.example.com/api",
+				Strict: true,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.cp)
+		})
+	}
+}
+
+func Test_parseRawOption(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		r    *plugin.Raw
+		ok   bool
+	}{
+		{
+			name: "bad type",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 256
+			  hex = "000102030405"
+			`,
+		},
+		{
+			name: "modeled type",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 25
+			  hex = "000102030405"
+			`,
+		},
+		{
+			name: "no value",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 253
+			`,
+		},
+		{
+			name: "hex and base64",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 253
+			  hex = "000102030405"
+			  base64 = "AAECAwQF"
+			`,
+		},
+		{
+			name: "bad hex",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 253
+			  hex = "zz"
+			`,
+		},
+		{
+			name: "bad framing",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 253
+			  hex = "00010203"
+			`,
+		},
+		{
+			name: "OK hex",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 253
+			  hex = "000102030405"
+			`,
+			r: &plugin.Raw{
+				Type:  253,
+				Value: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+			},
+			ok: true,
+		},
+		{
+			name: "OK base64",
+			s: `
+			[[interfaces]]
+			  [[interfaces.raw_option]]
+			  type = 254
+			  base64 = "AAECAwQF"
+			`,
+			r: &plugin.Raw{
+				Type:  254,
+				Value: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.r)
+		})
+	}
+}
+
+func Test_parsePrefix(t *testing.T) {
+	t.Parallel()
+
+	defaults := &plugin.Prefix{
+		Prefix:            crtest.MustIPPrefix("::/64"),
+		OnLink:            true,
+		Autonomous:        true,
+		PreferredLifetime: 4 * time.Hour,
+		ValidLifetime:     24 * time.Hour,
+	}
+
+	tests := []struct {
+		name string
+		s    string
+		p    *plugin.Prefix
+		ok   bool
+	}{
+		{
+			name: "no prefix",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			`,
+		},
+		{
+			name: "bad prefix string",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "foo"
+			`,
+		},
+		{
+			name: "bad prefix individual IP",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::1/64"
+			`,
+		},
+		{
+			name: "bad prefix IPv4",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "192.0.2.0/24"
+			`,
+		},
+		{
+			name: "bad prefix IPv6-mapped IPv4",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::ffff:192.0.2.0/128"
+			`,
+		},
+		{
+			name: "bad prefix ::/N",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/63"
+			`,
+		},
+		{
+			name: "bad valid lifetime string",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  valid_lifetime = "foo"
+			`,
+		},
+		{
+			name: "bad valid lifetime zero",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  valid_lifetime = ""
+			`,
+		},
+		{
+			name: "bad preferred lifetime string",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "foo"
+			  valid_lifetime = "2s"
+			`,
+		},
+		{
+			name: "bad preferred lifetime zero",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = ""
+			  valid_lifetime = "2s"
+			`,
+		},
+		{
+			name: "bad lifetimes",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "2s"
+			  valid_lifetime = "1s"
+			`,
+		},
+		{
+			name: "bad lifetimes infinite preferred",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "infinite"
+			  valid_lifetime = "24h"
+			`,
+		},
+		{
+			name: "bad temporary lifetimes missing preferred",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  temporary_valid_lifetime = "2h"
+			`,
+		},
+		{
+			name: "bad temporary lifetimes explicit prefix",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  temporary_preferred_lifetime = "1h"
+			  temporary_valid_lifetime = "2h"
+			`,
+		},
+		{
+			name: "bad temporary lifetimes auto",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  temporary_preferred_lifetime = "auto"
+			  temporary_valid_lifetime = "2h"
+			`,
+		},
+		{
+			name: "bad temporary lifetimes",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  temporary_preferred_lifetime = "2h"
+			  temporary_valid_lifetime = "1h"
+			`,
+		},
+		{
+			name: "bad max address failures negative",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  max_address_failures = -1
+			`,
+		},
+		{
+			name: "bad max address failures explicit prefix",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  max_address_failures = 3
+			`,
+		},
+		{
+			name: "bad exclude prefixes explicit prefix",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  exclude_prefixes = ["2001:db8::/64"]
+			`,
+		},
+		{
+			name: "bad exclude prefix",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  exclude_prefixes = ["2001:db8::1/64"]
+			`,
+		},
+		{
+			name: "bad exclude prefix unspecified",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  exclude_prefixes = ["::/48"]
+			`,
+		},
+		{
+			name: "bad dhcpv6 and autonomous",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  dhcpv6 = true
+			  autonomous = true
+			`,
+		},
+		{
+			name: "bad dhcpv6 and on-link",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  dhcpv6 = true
+			  on_link = true
+			`,
+		},
+		{
+			name: "bad verify_eui64 dhcpv6",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  dhcpv6 = true
+			  verify_eui64 = true
+			`,
+		},
+		{
+			name: "bad prefix overlap",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/96"
+			`,
+		},
+		{
+			name: "OK defaults",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			`,
+			p:  defaults,
+			ok: true,
+		},
+		{
+			name: "OK auto durations",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "auto"
+			  valid_lifetime = "auto"
+			`,
+			p:  defaults,
+			ok: true,
+		},
+		{
+			name: "OK infinite durations",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "infinite"
+			  valid_lifetime = "infinite"
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: ndp.Infinity,
+				ValidLifetime:     ndp.Infinity,
+			},
+			ok: true,
+		},
+		{
+			name: "OK infinite valid",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "4h"
+			  valid_lifetime = "infinite"
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     ndp.Infinity,
+			},
+			ok: true,
+		},
+		{
+			name: "OK equal lifetimes",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  preferred_lifetime = "1h"
+			  valid_lifetime = "1h"
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 1 * time.Hour,
+				ValidLifetime:     1 * time.Hour,
+			},
+			ok: true,
+		},
+		{
+			name: "OK explicit",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  deprecated = true
+			  autonomous = false
+			  on_link = true
+			  preferred_lifetime = "30s"
+			  valid_lifetime = "60s"
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				PreferredLifetime: 30 * time.Second,
+				ValidLifetime:     60 * time.Second,
+				Deprecated:        true,
+			},
+			ok: true,
+		},
+		{
+			name: "OK temporary lifetimes",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  temporary_preferred_lifetime = "1h"
+			  temporary_valid_lifetime = "2h"
+			`,
+			p: &plugin.Prefix{
+				Prefix:                     crtest.MustIPPrefix("::/64"),
+				OnLink:                     true,
+				Autonomous:                 true,
+				PreferredLifetime:          4 * time.Hour,
+				ValidLifetime:              24 * time.Hour,
+				TemporaryPreferredLifetime: 1 * time.Hour,
+				TemporaryValidLifetime:     2 * time.Hour,
+			},
+			ok: true,
+		},
+		{
+			name: "OK max address failures",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  max_address_failures = 3
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+				MaxAddrsFailures:  3,
+			},
+			ok: true,
+		},
+		{
+			name: "OK exclude prefixes",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  exclude_prefixes = ["fd00::/64", "2001:db8:ffff::/48"]
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+				ExcludePrefixes: []netaddr.IPPrefix{
+					crtest.MustIPPrefix("fd00::/64"),
+					crtest.MustIPPrefix("2001:db8:ffff::/48"),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK verify_eui64",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  verify_eui64 = true
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+				VerifyEUI64:       true,
+			},
+			ok: true,
+		},
+		{
+			name: "OK dhcpv6",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  dhcpv6 = true
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+			},
+			ok: true,
+		},
+		{
+			name: "OK router address",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  router_address = true
+			`,
+			p: &plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				RouterAddress:     true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.p)
+		})
+	}
+}
+
+func Test_parseDelegatedPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		d    *plugin.DelegatedPrefix
+		ok   bool
+	}{
+		{
+			name: "same interface",
+			s: `
+			[[interfaces]]
+			name = "eth1"
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  interface = "eth1"
+			`,
+		},
+		{
+			name: "exact prefix",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "2001:db8::/64"
+			  interface = "eth0"
+			`,
+		},
+		{
+			name: "router address",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  interface = "eth0"
+			  router_address = true
+			`,
+		},
+		{
+			name: "deprecated",
+			s: `
+			[[interfaces]]
+			  [[interfaces.prefix]]
+			  prefix = "::/64"
+			  interface = "eth0"
+			  deprecated = true
 			`,
 		},
 		{
-			name: "bad preferred lifetime zero",
+			name: "temporary lifetimes",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
-			  preferred_lifetime = ""
-			  valid_lifetime = "2s"
+			  interface = "eth0"
+			  temporary_valid_lifetime = "2h"
+			  temporary_preferred_lifetime = "1h"
 			`,
 		},
 		{
-			name: "bad lifetimes",
+			name: "max address failures",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
-			  preferred_lifetime = "2s"
-			  valid_lifetime = "1s"
+			  interface = "eth0"
+			  max_address_failures = 3
 			`,
 		},
 		{
-			name: "bad prefix overlap",
+			name: "exclude prefixes",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
-			  prefix = "2001:db8::/64"
-			  [[interfaces.prefix]]
-			  prefix = "2001:db8::/96"
+			  prefix = "::/64"
+			  interface = "eth0"
+			  exclude_prefixes = ["fd00::/64"]
 			`,
 		},
 		{
-			name: "OK defaults",
+			name: "negative subnet",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
+			  interface = "eth0"
+			  subnet = -1
 			`,
-			p:  defaults,
-			ok: true,
 		},
 		{
-			name: "OK auto durations",
+			name: "subnet without interface",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
-			  preferred_lifetime = "auto"
-			  valid_lifetime = "auto"
+			  subnet = 1
 			`,
-			p:  defaults,
-			ok: true,
 		},
 		{
-			name: "OK infinite durations",
+			name: "OK defaults",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
-			  preferred_lifetime = "infinite"
-			  valid_lifetime = "infinite"
+			  interface = "eth0"
 			`,
-			p: &plugin.Prefix{
-				Prefix:            crtest.MustIPPrefix("::/64"),
-				OnLink:            true,
-				Autonomous:        true,
-				PreferredLifetime: ndp.Infinity,
-				ValidLifetime:     ndp.Infinity,
+			d: &plugin.DelegatedPrefix{
+				Prefix: &plugin.Prefix{
+					Prefix:            crtest.MustIPPrefix("::/64"),
+					OnLink:            true,
+					Autonomous:        true,
+					PreferredLifetime: 4 * time.Hour,
+					ValidLifetime:     24 * time.Hour,
+				},
+				Interface: "eth0",
 			},
 			ok: true,
 		},
 		{
-			name: "OK explicit",
+			name: "OK subnet",
 			s: `
 			[[interfaces]]
 			  [[interfaces.prefix]]
 			  prefix = "::/64"
-			  deprecated = true
+			  interface = "ppp0"
+			  subnet = 1
 			  autonomous = false
-			  on_link = true
-			  preferred_lifetime = "30s"
-			  valid_lifetime = "60s"
+			  valid_lifetime = "2h"
+			  preferred_lifetime = "1h"
 			`,
-			p: &plugin.Prefix{
-				Prefix:            crtest.MustIPPrefix("::/64"),
-				OnLink:            true,
-				PreferredLifetime: 30 * time.Second,
-				ValidLifetime:     60 * time.Second,
-				Deprecated:        true,
+			d: &plugin.DelegatedPrefix{
+				Prefix: &plugin.Prefix{
+					Prefix:            crtest.MustIPPrefix("::/64"),
+					OnLink:            true,
+					PreferredLifetime: 1 * time.Hour,
+					ValidLifetime:     2 * time.Hour,
+				},
+				Interface: "ppp0",
+				Subnet:    1,
 			},
 			ok: true,
 		},
@@ -332,7 +1497,7 @@ func Test_parsePrefix(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			pluginDecode(t, tt.s, tt.ok, tt.p)
+			pluginDecode(t, tt.s, tt.ok, tt.d)
 		})
 	}
 }
@@ -490,6 +1655,144 @@ func Test_parseRoute(t *testing.T) {
 	}
 }
 
+func Test_parseKernelRoutes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		k    *plugin.KernelRoutes
+		ok   bool
+	}{
+		{
+			name: "bad table",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  table = 0
+			`,
+		},
+		{
+			name: "bad protocol",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  protocol = "foo"
+			`,
+		},
+		{
+			name: "bad metric",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  metric = -1
+			`,
+		},
+		{
+			name: "advertising interface",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.kernel_routes]
+			  interface = "eth0"
+			`,
+		},
+		{
+			name: "bad preference",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  preference = "foo"
+			`,
+		},
+		{
+			name: "zero lifetime",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  lifetime = ""
+			`,
+		},
+		{
+			name: "infinite lifetime",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  lifetime = "infinite"
+			`,
+		},
+		{
+			name: "interval too low",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  interval = "100ms"
+			`,
+		},
+		{
+			name: "OK defaults",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			`,
+			k: &plugin.KernelRoutes{
+				Table:      254,
+				Preference: ndp.Medium,
+				Lifetime:   30 * time.Minute,
+				Interval:   10 * time.Second,
+			},
+			ok: true,
+		},
+		{
+			name: "OK explicit",
+			s: `
+			[[interfaces]]
+			name = "eth0"
+			  [interfaces.kernel_routes]
+			  table = 100
+			  protocol = "bird"
+			  metric = 32
+			  interface = "wg0"
+			  preference = "high"
+			  lifetime = "5m"
+			  interval = "1m"
+			`,
+			k: &plugin.KernelRoutes{
+				Table:      100,
+				Protocol:   12,
+				Metric:     32,
+				Interface:  "wg0",
+				Preference: ndp.High,
+				Lifetime:   5 * time.Minute,
+				Interval:   1 * time.Minute,
+			},
+			ok: true,
+		},
+		{
+			name: "OK protocol number",
+			s: `
+			[[interfaces]]
+			  [interfaces.kernel_routes]
+			  protocol = "99"
+			`,
+			k: &plugin.KernelRoutes{
+				Table:      254,
+				Protocol:   99,
+				Preference: ndp.Medium,
+				Lifetime:   30 * time.Minute,
+				Interval:   10 * time.Second,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginDecode(t, tt.s, tt.ok, tt.k)
+		})
+	}
+}
+
 func Test_parseRDNSS(t *testing.T) {
 	t.Parallel()
 
@@ -531,6 +1834,51 @@ func Test_parseRDNSS(t *testing.T) {
 			  servers = ["192.0.2.1"]
 			`,
 		},
+		{
+			name: "bad servers interface twice",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["interface", "interface"]
+			`,
+		},
+		{
+			name: "bad interface addresses",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["interface"]
+			  interface_addresses = "temporary"
+			`,
+		},
+		{
+			name: "bad interface addresses no interface",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1"]
+			  interface_addresses = "lowest_stable"
+			`,
+		},
+		{
+			name: "bad max servers",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1"]
+			  max_servers = -1
+			`,
+		},
+		{
+			name: "bad truncate no limit",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1"]
+			  max_servers = 0
+			  truncate = true
+			`,
+		},
 		{
 			name: "OK explicit",
 			s: `
@@ -545,6 +1893,21 @@ func Test_parseRDNSS(t *testing.T) {
 					crtest.MustIP("2001:db8::1"),
 					crtest.MustIP("2001:db8::2"),
 				},
+				MaxServers: 3,
+			},
+			ok: true,
+		},
+		{
+			name: "OK withdraw",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1"]
+			  lifetime = "0s"
+			`,
+			r: &plugin.RDNSS{
+				Servers:    []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				MaxServers: 3,
 			},
 			ok: true,
 		},
@@ -556,8 +1919,9 @@ func Test_parseRDNSS(t *testing.T) {
 			  servers = ["2001:db8::1"]
 			`,
 			r: &plugin.RDNSS{
-				Lifetime: 20 * time.Minute,
-				Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				Lifetime:   20 * time.Minute,
+				Servers:    []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				MaxServers: 3,
 			},
 			ok: true,
 		},
@@ -569,9 +1933,62 @@ func Test_parseRDNSS(t *testing.T) {
 			  servers = ["2001:db8::1"]
 			  lifetime = "auto"
 			`,
+			r: &plugin.RDNSS{
+				Lifetime:   20 * time.Minute,
+				Servers:    []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				MaxServers: 3,
+			},
+			ok: true,
+		},
+		{
+			name: "OK truncate",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1", "2001:db8::2"]
+			  max_servers = 1
+			  truncate = true
+			`,
 			r: &plugin.RDNSS{
 				Lifetime: 20 * time.Minute,
-				Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				Servers: []netaddr.IP{
+					crtest.MustIP("2001:db8::1"),
+					crtest.MustIP("2001:db8::2"),
+				},
+				MaxServers: 1,
+				Truncate:   true,
+			},
+			ok: true,
+		},
+		{
+			name: "OK interface",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["2001:db8::1", "interface"]
+			`,
+			r: &plugin.RDNSS{
+				Lifetime:   20 * time.Minute,
+				Servers:    []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				MaxServers: 3,
+				Interface:  true,
+			},
+			ok: true,
+		},
+		{
+			name: "OK interface lowest stable address",
+			s: `
+			[[interfaces]]
+			  [[interfaces.rdnss]]
+			  servers = ["interface"]
+			  interface_addresses = "lowest_stable"
+			`,
+			r: &plugin.RDNSS{
+				Lifetime:           20 * time.Minute,
+				Servers:            []netaddr.IP{},
+				MaxServers:         3,
+				Interface:          true,
+				InterfaceAddresses: plugin.LowestStableAddress,
 			},
 			ok: true,
 		},
@@ -616,9 +2033,123 @@ func pluginDecode(t *testing.T, s string, ok bool, want plugin.Plugin) {
 		return
 	}
 
-	if diff := cmp.Diff([]plugin.Plugin{want}, got, cmp.Comparer(compareNetaddrIP)); diff != "" {
+	opts := []cmp.Option{
+		cmp.Comparer(compareNetaddrIP),
+		cmpopts.IgnoreUnexported(plugin.DelegatedPrefix{}, plugin.KernelRoutes{}, plugin.RDNSS{}, plugin.Upstream{}, plugin.VRRP{}),
+		cmpopts.EquateEmpty(),
+	}
+
+	// A nil want indicates that no plugin is expected.
+	var plugins []plugin.Plugin
+	if want != nil {
+		plugins = []plugin.Plugin{want}
+	}
+
+	if diff := cmp.Diff(plugins, got, opts...); diff != "" {
 		t.Fatalf("unexpected Plugin (-want +got):\n%s", diff)
 	}
 }
 
 func compareNetaddrIP(x, y netaddr.IP) bool { return x == y }
+
+func Test_infiniteLifetime(t *testing.T) {
+	t.Parallel()
+
+	finite := func() *plugin.Prefix {
+		return &plugin.Prefix{
+			ValidLifetime:     24 * time.Hour,
+			PreferredLifetime: 4 * time.Hour,
+		}
+	}
+
+	infinite := func() *plugin.Prefix {
+		p := finite()
+		p.ValidLifetime = ndp.Infinity
+		return p
+	}
+
+	temporary := func() *plugin.Prefix {
+		p := finite()
+		p.TemporaryPreferredLifetime = ndp.Infinity
+		return p
+	}
+
+	tests := []struct {
+		name     string
+		p        plugin.Plugin
+		infinite bool
+	}{
+		{
+			name: "prefix",
+			p:    finite(),
+		},
+		{
+			name:     "prefix infinite",
+			p:        infinite(),
+			infinite: true,
+		},
+		{
+			name:     "prefix temporary infinite",
+			p:        temporary(),
+			infinite: true,
+		},
+		{
+			name:     "delegated prefix infinite",
+			p:        &plugin.DelegatedPrefix{Prefix: infinite()},
+			infinite: true,
+		},
+		{
+			name: "renumber",
+			p:    &plugin.Renumber{Old: finite(), New: finite()},
+		},
+		{
+			name:     "renumber old infinite",
+			p:        &plugin.Renumber{Old: infinite(), New: finite()},
+			infinite: true,
+		},
+		{
+			name:     "renumber new infinite",
+			p:        &plugin.Renumber{Old: finite(), New: temporary()},
+			infinite: true,
+		},
+		{
+			name:     "route infinite",
+			p:        &plugin.Route{Lifetime: ndp.Infinity},
+			infinite: true,
+		},
+		{
+			name: "kernel routes",
+			p:    &plugin.KernelRoutes{Lifetime: 30 * time.Second},
+		},
+		{
+			name:     "kernel routes infinite",
+			p:        &plugin.KernelRoutes{Lifetime: ndp.Infinity},
+			infinite: true,
+		},
+		{
+			name:     "RDNSS infinite",
+			p:        &plugin.RDNSS{Lifetime: ndp.Infinity},
+			infinite: true,
+		},
+		{
+			name:     "DNSSL infinite",
+			p:        &plugin.DNSSL{Lifetime: ndp.Infinity},
+			infinite: true,
+		},
+		{
+			name: "MTU",
+			p:    plugin.NewMTU(1500),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.infinite, infiniteLifetime(tt.p)); diff != "" {
+				t.Fatalf("unexpected infinite lifetime (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
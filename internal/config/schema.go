@@ -0,0 +1,253 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A PluginSchema describes the configuration of a plugin supported by this
+// build of CoreRAD.
+type PluginSchema struct {
+	// Name is the name of the plugin, as reported by its Name method.
+	Name string
+
+	// Table is the name of the TOML table within [[interfaces]] which
+	// configures the plugin, and Array reports whether it is an array of
+	// tables. If Table is empty, the plugin is configured by keys within
+	// [[interfaces]] directly.
+	Table string
+	Array bool
+
+	// Options are the NDP options the plugin may attach to a router
+	// advertisement, if any.
+	Options []string
+
+	// Fields are the configurable fields of the plugin.
+	Fields []FieldSchema
+}
+
+// A FieldSchema describes a configurable field of a plugin.
+type FieldSchema struct {
+	// Key is the TOML key of the field.
+	Key string
+
+	// Type is the TOML type of the field, such as "string", "integer",
+	// "boolean", "array of strings", or "table".
+	Type string
+
+	// Fields are the fields of a table.
+	Fields []FieldSchema
+}
+
+// A schemaEntry is a registry entry used to produce a PluginSchema. raw is the
+// raw configuration for the plugin, and keys optionally selects individual
+// fields of raw.
+type schemaEntry struct {
+	name    string
+	table   string
+	array   bool
+	options []string
+	raw     interface{}
+	keys    []string
+}
+
+// schemaEntries is the registry of all supported plugins, in the order they
+// are attached to router advertisements.
+var schemaEntries = []schemaEntry{
+	{
+		name:    "prefix",
+		table:   "prefix",
+		array:   true,
+		options: []string{"prefix information"},
+		raw:     rawPrefix{},
+	},
+	{
+		// Delegated prefixes share the prefix table, and are selected by
+		// setting the interface key.
+		name:    "delegated_prefix",
+		table:   "prefix",
+		array:   true,
+		options: []string{"prefix information"},
+		raw:     rawPrefix{},
+	},
+	{
+		name:    "renumber",
+		table:   "renumber",
+		array:   true,
+		options: []string{"prefix information"},
+		raw:     rawRenumber{},
+	},
+	{
+		name:    "route",
+		table:   "route",
+		array:   true,
+		options: []string{"route information"},
+		raw:     rawRoute{},
+	},
+	{
+		name:    "kernel_routes",
+		table:   "kernel_routes",
+		options: []string{"route information"},
+		raw:     rawKernelRoutes{},
+	},
+	{
+		name:    "rdnss",
+		table:   "rdnss",
+		array:   true,
+		options: []string{"recursive DNS servers"},
+		raw:     rawRDNSS{},
+	},
+	{
+		name:    "dnssl",
+		table:   "dnssl",
+		array:   true,
+		options: []string{"DNS search list"},
+		raw:     rawDNSSL{},
+	},
+	{
+		name:    "mtu",
+		options: []string{"MTU"},
+		raw:     rawInterface{},
+		keys:    []string{"mtu", "mtu_overhead"},
+	},
+	{
+		name:    "sysctl_defaults",
+		options: []string{"MTU"},
+		raw:     rawInterface{},
+		keys:    []string{"sysctl_defaults"},
+	},
+	{
+		name: "managed_prefix",
+		raw:  rawInterface{},
+		keys: []string{"managed_prefix"},
+	},
+	{
+		name:    "nonce",
+		options: []string{"nonce"},
+		raw:     rawInterface{},
+		keys:    []string{"nonce"},
+	},
+	{
+		name:    "captive_portal",
+		table:   "captive_portal",
+		options: []string{"captive portal"},
+		raw:     rawCaptivePortal{},
+	},
+	{
+		name:    "raw_option",
+		table:   "raw_option",
+		array:   true,
+		options: []string{"raw option"},
+		raw:     rawRawOption{},
+	},
+	{
+		name:  "upstream",
+		table: "upstream",
+		raw:   rawUpstream{},
+	},
+	{
+		name:  "vrrp",
+		table: "vrrp",
+		raw:   rawVRRP{},
+	},
+	{
+		name:    "lla",
+		options: []string{"source link-layer address"},
+		raw:     rawInterface{},
+		keys:    []string{"source_lla", "source_lla_unsolicited", "source_lla_override"},
+	},
+}
+
+// Schema returns the schemas of all plugins supported by this build of
+// CoreRAD. The schemas are derived from the configuration file format, so the
+// output only changes when plugins or their fields are added or removed.
+func Schema() []PluginSchema {
+	ps := make([]PluginSchema, 0, len(schemaEntries))
+	for _, e := range schemaEntries {
+		ps = append(ps, PluginSchema{
+			Name:    e.name,
+			Table:   e.table,
+			Array:   e.array,
+			Options: e.options,
+			Fields:  schemaFields(reflect.TypeOf(e.raw), e.keys),
+		})
+	}
+
+	return ps
+}
+
+// schemaFields produces FieldSchemas for the TOML fields of struct type t. If
+// keys is not empty, only those keys are included, in the order specified.
+func schemaFields(t reflect.Type, keys []string) []FieldSchema {
+	byKey := make(map[string]FieldSchema)
+	var all []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		key := strings.Split(f.Tag.Get("toml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		fs := FieldSchema{Key: key}
+		fs.Type, fs.Fields = schemaType(f.Type)
+
+		byKey[key] = fs
+		all = append(all, key)
+	}
+
+	if len(keys) == 0 {
+		keys = all
+	}
+
+	fields := make([]FieldSchema, 0, len(keys))
+	for _, k := range keys {
+		fs, ok := byKey[k]
+		if !ok {
+			panic(fmt.Sprintf("config: schema key %q does not exist in %s", k, t))
+		}
+
+		fields = append(fields, fs)
+	}
+
+	return fields
+}
+
+// schemaType returns the TOML type name of t, and the fields of t if it is a
+// table.
+func schemaType(t reflect.Type) (string, []FieldSchema) {
+	// Optional values are still described by their underlying type.
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int:
+		return "integer", nil
+	case reflect.Slice:
+		elem, _ := schemaType(t.Elem())
+		return "array of " + elem + "s", nil
+	case reflect.Struct:
+		return "table", schemaFields(t, nil)
+	default:
+		panic(fmt.Sprintf("config: unhandled schema type: %s", t))
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/config"
+)
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	schema := config.Schema()
+
+	// Each plugin must only be described once.
+	got := make(map[string]config.PluginSchema)
+	for _, ps := range schema {
+		if _, ok := got[ps.Name]; ok {
+			t.Fatalf("duplicate plugin schema: %q", ps.Name)
+		}
+		got[ps.Name] = ps
+	}
+
+	// Spot check plugins configured by keys, arrays of tables, and nested
+	// tables.
+	want := []config.PluginSchema{
+		{
+			Name:    "mtu",
+			Options: []string{"MTU"},
+			Fields: []config.FieldSchema{
+				{Key: "mtu", Type: "integer"},
+				{Key: "mtu_overhead", Type: "integer"},
+			},
+		},
+		{
+			Name:    "rdnss",
+			Table:   "rdnss",
+			Array:   true,
+			Options: []string{"recursive DNS servers"},
+			Fields: []config.FieldSchema{
+				{Key: "lifetime", Type: "string"},
+				{Key: "servers", Type: "array of strings"},
+				{Key: "interface_addresses", Type: "string"},
+				{Key: "max_servers", Type: "integer"},
+				{Key: "truncate", Type: "boolean"},
+			},
+		},
+		{
+			Name:    "renumber",
+			Table:   "renumber",
+			Array:   true,
+			Options: []string{"prefix information"},
+			Fields: []config.FieldSchema{
+				{Key: "start", Type: "string"},
+				{Key: "window", Type: "string"},
+				{Key: "old", Type: "table", Fields: got["prefix"].Fields},
+				{Key: "new", Type: "table", Fields: got["prefix"].Fields},
+			},
+		},
+	}
+
+	for _, w := range want {
+		if diff := cmp.Diff(w, got[w.Name]); diff != "" {
+			t.Fatalf("unexpected %q schema (-want +got):\n%s", w.Name, diff)
+		}
+	}
+}
@@ -14,24 +14,77 @@
 package corerad
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"math/rand"
+	"net"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mdlayher/corerad/internal/config"
 	"github.com/mdlayher/corerad/internal/netstate"
+	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
 	"github.com/mdlayher/schedgroup"
+	"golang.org/x/net/ipv6"
 	"golang.org/x/sync/errgroup"
 	"inet.af/netaddr"
 )
 
 // An Advertiser sends NDP router advertisements.
 type Advertiser struct {
+	// Atomics must come first per sync/atomic.
+	//
+	// lastMulticast is the UNIX nanosecond timestamp of when this Advertiser
+	// last scheduled an unsolicited multicast router advertisement, or 0 if
+	// the Advertiser is not running, for use by Advertise.
+	lastMulticast *int64
+
+	// lastScheduled is the UNIX nanosecond timestamp of when this Advertiser
+	// last sent an unsolicited multicast router advertisement scheduled by
+	// its multicast loop, for use by checkDeviation.
+	lastScheduled *int64
+
+	// lastSolicitation is the UNIX nanosecond timestamp of when this
+	// Advertiser last received a router solicitation, for use by on-demand
+	// mode.
+	lastSolicitation *int64
+
+	// withdrawn is 1 if this Advertiser is withdrawn, in which case its router
+	// advertisements carry a router lifetime of zero and no prefixes.
+	withdrawn *uint32
+
+	// cordoned is 1 if this Advertiser is cordoned, in which case its router
+	// advertisements carry a router lifetime of zero but retain prefixes.
+	cordoned *uint32
+
+	// waiting is atomically set to 1 while the Advertiser waits for its
+	// interface to be created.
+	waiting *uint32
+
+	// degraded is atomically set to 1 while receive errors persist beyond
+	// the configured receive grace period.
+	degraded *uint32
+
+	// link atomically stores the linkState of the Advertiser's interface when
+	// link state tracking is enabled.
+	link *uint32
+
+	// ramped atomically counts the unsolicited multicast router
+	// advertisements sent since the Advertiser was initialized or promoted,
+	// which ramp up its router lifetime when an initial default lifetime is
+	// configured.
+	ramped *uint32
+
 	// OnInconsistentRA is an optional hook that fires when a router advertisement
 	// is received that is inconsistent with the configuration being served by
 	// this Advertiser, resulting in potential problems for clients. ours is
@@ -47,9 +100,44 @@ type Advertiser struct {
 	dialer *system.Dialer
 	watchC <-chan netstate.Change
 
-	// Readiness notification.
+	// delegatedC maps upstream interface names to channels which indicate
+	// address changes on those interfaces, for any delegated prefixes.
+	delegatedC map[string]<-chan netstate.Change
+
+	// pacer optionally spreads unsolicited multicast router advertisements
+	// across all Advertisers.
+	pacer *pacer
+
+	// debugFlags are the experimental router advertisement flags which are
+	// set for interoperability testing, if any.
+	debugFlags []string
+
+	// debugGroup and debugHopLimit replace the link-local all nodes
+	// destination and hop limit of multicast router advertisements for
+	// testing, if debugGroup is set.
+	debugGroup    netaddr.IP
+	debugHopLimit uint8
+
+	// events optionally records notable events for the debug API.
+	events *system.EventLog
+
+	// onSend is an optional hook which fires each time a router
+	// advertisement is sent, so a supervisor can detect stalls.
+	onSend func()
+
+	// Readiness notification. waitC is closed the first time the Advertiser
+	// waits for its interface to be created.
 	readyOnce sync.Once
 	readyC    chan struct{}
+	waitOnce  sync.Once
+	waitC     chan struct{}
+
+	// triggerC carries on-demand router advertisement requests from Advertise.
+	triggerC chan request
+
+	// fastStartC notifies the multicast loop to restart its initial router
+	// advertisements when the Advertiser is promoted.
+	fastStartC chan struct{}
 
 	// terminate reports whether or not the Advertiser should fully terminate on
 	// shutdown by sending a final router advertisement with a default lifetime
@@ -60,6 +148,111 @@ type Advertiser struct {
 	// Parameters which have defaults but may be explicitly overridden to speed
 	// up tests.
 	minDelayBetweenRAs time.Duration
+	conflictWindow     time.Duration
+	emptyLogInterval   time.Duration
+	debugLogInterval   time.Duration
+	sendInterval       time.Duration
+	linkHysteresis     time.Duration
+	initialInterval    time.Duration
+	initialCount       int
+	timeNow            func() time.Time
+
+	// emptyMu guards lastEmptyLog, the last time a ::/N prefix which matched
+	// no prefixes was logged. Accessed by concurrent send workers.
+	emptyMu      sync.Mutex
+	lastEmptyLog time.Time
+
+	// droppedMu guards lastDropped, the names of the plugins most recently
+	// dropped to fit the configured size budget.
+	droppedMu   sync.Mutex
+	lastDropped string
+
+	// selfMu guards selfIP and selfLLA, the source addresses of this
+	// Advertiser's router advertisements, and selfLoops and lastSelfLoopLog,
+	// the number of those router advertisements received since the last time
+	// they were logged.
+	selfMu          sync.Mutex
+	selfIP          netaddr.IP
+	selfLLA         string
+	selfLoops       int
+	lastSelfLoopLog time.Time
+
+	// cordonMu guards lastCordon, the last time the Advertiser was cordoned
+	// or uncordoned.
+	cordonMu   sync.Mutex
+	lastCordon time.Time
+
+	// hopLimitMu guards hopLimits, the hop limits advertised by neighboring
+	// routers when adoption is enabled, and hopLimit, the largest of those
+	// which is adopted, or 0 if none has been adopted.
+	hopLimitMu sync.Mutex
+	hopLimits  map[netaddr.IP]neighborHopLimit
+	hopLimit   uint8
+
+	// clampedMu guards clamped, the lifetimes which have been logged as
+	// clamped to the configured maximum lifetime.
+	clampedMu sync.Mutex
+	clamped   map[string]bool
+
+	// debugMu guards lastDebugLog and lastDebugOptions, the last time the
+	// options of a sent router advertisement were logged in verbose mode and
+	// their rendered form, and lastDiagnosticLog and diagnosticSuppressed,
+	// the last time a message observed in diagnostic mode was logged and the
+	// number observed since.
+	debugMu              sync.Mutex
+	lastDebugLog         time.Time
+	lastDebugOptions     string
+	lastDiagnosticLog    time.Time
+	diagnosticSuppressed int
+
+	// nonces tracks recently observed router solicitation nonces when the
+	// experimental nonce plugin is enabled. Only accessed by handle.
+	nonces [][]byte
+
+	// conflicts tracks inconsistencies with other routers' advertisements
+	// over time. Only accessed by handle.
+	conflicts map[conflictKey]*conflict
+}
+
+// A conflictKey identifies an inconsistent field in the router advertisements
+// sent by another router.
+type conflictKey struct {
+	Router         netaddr.IP
+	Field, Details string
+}
+
+// A conflict tracks an inconsistency with another router over time.
+type conflict struct {
+	Message, Want, Got string
+	First, Last        time.Time
+	Persistent         bool
+
+	// Duplicates counts the observations of this conflict after the first.
+	Duplicates int
+}
+
+// A request is a request to send a router advertisement to a destination IP
+// address.
+type request struct {
+	IP netaddr.IP
+
+	// Nonce is an optional nonce from a router solicitation which will be
+	// echoed in the router advertisement, if nonces are enabled.
+	Nonce []byte
+
+	// Solicited indicates the request was produced by a router solicitation.
+	Solicited bool
+
+	// Repeat indicates the request is an additional response to a router
+	// solicitation which was already answered.
+	Repeat bool
+
+	// Scheduled indicates the request was produced by the multicast loop.
+	// Interval is the time the loop chose to wait between the previous
+	// scheduled request and this one, or 0 if there is no previous request
+	// to compare against.
+	Scheduled bool
+	Interval  time.Duration
 }
 
 // NewAdvertiser creates an Advertiser for the specified interface. If ll is
@@ -71,69 +264,410 @@ func NewAdvertiser(
 	watchC <-chan netstate.Change,
 	terminate func() bool,
 ) *Advertiser {
-	return &Advertiser{
+	window := cfg.ConflictWindow
+	if window == 0 {
+		window = conflictMultiple * cfg.MaxInterval
+	}
+
+	debugInterval := cfg.DebugLogInterval
+	if debugInterval == 0 {
+		debugInterval = debugLogInterval
+	}
+
+	sendInterval := cfg.SolicitedSendInterval
+	if sendInterval == 0 {
+		sendInterval = solicitedSendInterval
+	}
+
+	hysteresis := cfg.LinkHysteresis
+	if hysteresis == 0 {
+		hysteresis = linkHysteresis
+	}
+
+	initialInterval := cfg.InitialInterval
+	if initialInterval == 0 {
+		initialInterval = maxInitialAdvInterval
+	}
+
+	initialCount := cfg.InitialCount
+	if initialCount == 0 {
+		initialCount = maxInitialAdv
+	}
+
+	withdrawn := new(uint32)
+	if cfg.StartWithdrawn {
+		*withdrawn = 1
+	}
+
+	a := &Advertiser{
+		lastMulticast:    new(int64),
+		lastScheduled:    new(int64),
+		lastSolicitation: new(int64),
+		withdrawn:        withdrawn,
+		cordoned:         new(uint32),
+		waiting:          new(uint32),
+		degraded:         new(uint32),
+		link:             new(uint32),
+		ramped:           new(uint32),
+		triggerC:         make(chan request, 1),
+		fastStartC:       make(chan struct{}, 1),
+
 		cctx:      cctx,
 		cfg:       cfg,
 		dialer:    dialer,
 		watchC:    watchC,
 		readyC:    make(chan struct{}),
+		waitC:     make(chan struct{}),
 		terminate: terminate,
 
 		// RFC defaults which can be overridden.
 		minDelayBetweenRAs: minDelayBetweenRAs,
+		conflictWindow:     window,
+		emptyLogInterval:   emptyLogInterval,
+		debugLogInterval:   debugInterval,
+		sendInterval:       sendInterval,
+		linkHysteresis:     hysteresis,
+		initialInterval:    initialInterval,
+		initialCount:       initialCount,
+		timeNow:            time.Now,
+
+		delegatedC: make(map[string]<-chan netstate.Change),
+		conflicts:  make(map[conflictKey]*conflict),
+		hopLimits:  make(map[netaddr.IP]neighborHopLimit),
+		clamped:    make(map[string]bool),
 	}
+
+	// Report lifetimes clamped while building router advertisements.
+	if cfg.MaxLifetime != 0 {
+		a.cfg.OnLifetimeClamp = a.lifetimeClamped
+	}
+
+	return a
 }
 
 // Run initializes the configured interface and begins router solicitation and
 // advertisement handling. Run will block until ctx is canceled or an error
 // occurs.
 func (a *Advertiser) Run(ctx context.Context) error {
+	// Label the Advertiser's goroutines with its interface so that profiles
+	// can be scoped to a single interface.
+	var err error
+	pprof.Do(ctx, pprof.Labels("interface", a.cfg.Name), func(ctx context.Context) {
+		err = a.run(ctx)
+	})
+
+	return err
+}
+
+// run implements Run.
+func (a *Advertiser) run(ctx context.Context) error {
 	return a.dialer.Dial(ctx, func(ctx context.Context, dctx *system.DialContext) error {
+		// In shadow mode, log router advertisements rather than sending them.
+		conn := dctx.Conn
+		if a.cfg.Shadow {
+			conn = &system.ShadowConn{
+				Conn:    dctx.Conn,
+				OnWrite: a.shadowWrite,
+			}
+		}
+
 		// We can now initialize any plugins that rely on dynamic information
-		// about the network interface.
-		for _, p := range a.cfg.Plugins {
-			if err := p.Prepare(dctx.Interface); err != nil {
+		// about the network interface. If configured, the link-layer address
+		// hosts should use for neighbor resolution replaces the interface's
+		// own hardware address.
+		ifi := dctx.Interface
+		if a.cfg.SourceLLAOverride != nil {
+			a.logf("overriding source link-layer address %s with %s",
+				ifi.HardwareAddr, a.cfg.SourceLLAOverride)
+
+			override := *ifi
+			override.HardwareAddr = a.cfg.SourceLLAOverride
+			ifi = &override
+		}
+
+		// Remember our own source addresses so that our router advertisements
+		// can be recognized if they are looped back to us.
+		a.setSelf(dctx.IP, ifi.HardwareAddr)
+
+		for _, p := range a.cfg.AllPlugins() {
+			if pfx, ok := p.(*plugin.Prefix); ok {
+				// Report any tolerated address fetch failures.
+				pfx.OnAddrsFailure = func(err error) {
+					a.logf("failed to fetch interface addresses for prefix %s, reusing last known addresses: %v", pfx.Prefix, err)
+					a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "addresses")
+				}
+
+				// Confirm excluded prefixes in verbose mode.
+				pfx.OnExclude = func(excluded netaddr.IPPrefix) {
+					a.debugf("prefix %s: excluded %s from expansion", pfx.Prefix, excluded)
+				}
+
+				// Report any advisory EUI-64 verification problems.
+				pfx.OnVerifyEUI64 = func(warning string) {
+					a.logf("prefix %s: %s", pfx.Prefix, warning)
+				}
+			}
+
+			// Report any interface MTU which is too small to advertise.
+			switch p := p.(type) {
+			case *plugin.TunnelMTU:
+				p.OnClamp = a.mtuClamped
+			case *plugin.SysctlDefaults:
+				p.OnClamp = a.mtuClamped
+			case *plugin.Raw:
+				a.logf("EXPERIMENTAL: advertising unvalidated raw NDP option, %s", p)
+			case *plugin.RDNSS:
+				p.OnEmpty = func(empty bool) {
+					if empty {
+						a.logf("rdnss: interface has no global addresses to advertise as DNS servers, omitting option")
+						return
+					}
+
+					a.logf("rdnss: interface has global addresses to advertise as DNS servers, restoring option")
+				}
+			}
+
+			// Plugins may inspect the interface, which must be done within
+			// its network namespace.
+			if err := a.dialer.InNetns(func() error { return p.Prepare(ifi) }); err != nil {
 				return fmt.Errorf("failed to prepare plugin %q: %v", p.Name(), err)
 			}
 
 			a.logf("%q: %s", p.Name(), p)
 		}
 
+		// Optionally warn about IPv4 addresses on an IPv6-only interface.
+		if a.cfg.IPv6Only {
+			var addrs []net.Addr
+			err := a.dialer.InNetns(func() error {
+				var err error
+				addrs, err = ifi.Addrs()
+				return err
+			})
+			if err != nil {
+				a.logf("failed to fetch interface addresses to check for IPv4: %v", err)
+				a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "addresses")
+			} else {
+				a.checkIPv4(addrs)
+			}
+		}
+
+		// Warn if this interface advertises the neighbor discovery proxy flag
+		// but does not appear to be able to proxy.
+		if a.cfg.Proxy {
+			var (
+				forwarding bool
+				proxy      *system.NDProxyState
+			)
+			err := a.dialer.InNetns(func() error {
+				var err error
+				forwarding, err = a.cctx.state.IPv6Forwarding(ifi.Name)
+				if err != nil {
+					return err
+				}
+
+				proxy, err = system.InterfaceNDProxy(ifi)
+				if errors.Is(err, os.ErrNotExist) {
+					// Not supported on this platform, only check forwarding.
+					return nil
+				}
+				return err
+			})
+			if err != nil {
+				a.logf("failed to check neighbor discovery proxy state: %v", err)
+			} else {
+				for _, w := range proxyWarnings(forwarding, proxy) {
+					a.logf("WARNING: %s", w)
+				}
+			}
+		}
+
+		// Optionally wait for a link which just came up to settle before
+		// advertising on it.
+		if a.cfg.TrackLinkState {
+			if err := a.settleLink(ctx); err != nil {
+				return err
+			}
+		}
+
 		// Before starting any other goroutines, verify that the interface can
 		// actually be used to send an initial router advertisement, avoiding a
 		// needless start/error/restart loop.
 		//
 		// TODO: don't do this for unicast-only mode.
-		if err := a.send(dctx.Conn, netaddr.IPv6LinkLocalAllNodes(), a.cfg); err != nil {
-			return fmt.Errorf("failed to send initial multicast router advertisement: %v", err)
+		//
+		// The initial router advertisement also begins the router lifetime
+		// ramp, if configured.
+		atomic.StoreUint32(a.ramped, 0)
+		if err := a.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, a.cfg); err != nil {
+			a.checkSource(err)
+			return fmt.Errorf("failed to send initial multicast router advertisement: %w", err)
 		}
+		a.sent()
 
-		// Note unicast-only mode in logs.
+		// Note unicast-only and shadow modes in logs.
 		var method string
 		if a.cfg.UnicastOnly {
 			method = "unicast-only "
 		}
 
+		verb := "advertising"
+		if a.cfg.Shadow {
+			verb = "shadowing (not sending)"
+		}
+		if a.Cordoned() {
+			verb = "cordoned, " + verb
+		}
+		if a.Withdrawn() {
+			verb = "withdrawn, " + verb
+		}
+
+		a.cctx.mm.AdvWithdrawn(boolFloat(a.Withdrawn()), a.cfg.Name)
+		a.cctx.mm.AdvCordoned(boolFloat(a.Cordoned()), a.cfg.Name)
+
+		// Any receive errors which degraded the previous connection no
+		// longer apply.
+		a.degrade(false)
+
 		// Note readiness on first successful init.
 		a.readyOnce.Do(func() { close(a.readyC) })
-		a.logf("initialized, advertising %sfrom %s", method, dctx.IP)
+		a.logf("initialized, %s %sfrom %s", verb, method, dctx.IP)
+		a.event(system.EventInterfaceUp, "initialized, %s %sfrom %s", verb, method, dctx.IP)
+		if len(a.debugFlags) > 0 {
+			a.logf("EXPERIMENTAL: setting non-standard router advertisement flags %v for interoperability testing",
+				a.debugFlags)
+		}
+		if !a.debugGroup.IsZero() {
+			a.logf("EXPERIMENTAL: sending non-compliant multicast router advertisements to %s with hop limit %d for testing, hosts will ignore them",
+				a.debugGroup, a.debugHopLimit)
+		}
 
 		// Advertise until an error occurs, reinitializing under certain
 		// circumstances.
-		err := a.advertise(ctx, dctx.Conn)
+		err := a.advertise(ctx, conn)
 		switch {
 		case errors.Is(err, context.Canceled):
 			// Intentional shutdown.
-			a.shutdown(dctx.Conn)
+			a.shutdown(conn)
 			return nil
 		case err == nil:
 			panic("corerad: advertise must never return nil error")
 		default:
+			if a.cfg.TrackLinkState && errors.Is(err, system.ErrLinkChange) {
+				// Stop advertising on a dead link until it comes back up.
+				a.setLink(linkDown)
+			}
+
+			a.checkSource(err)
 			return err
 		}
 	})
 }
 
+// A linkState is the operational state of an Advertiser's link when link state
+// tracking is enabled.
+type linkState uint32
+
+// Possible linkState values.
+const (
+	linkUnknown linkState = iota
+	linkDown
+	linkSettling
+	linkUp
+)
+
+// String returns the string representation of a linkState.
+func (s linkState) String() string {
+	switch s {
+	case linkUnknown:
+		return "unknown"
+	case linkDown:
+		return "down"
+	case linkSettling:
+		return "settling"
+	case linkUp:
+		return "up"
+	default:
+		return fmt.Sprintf("linkState(%d)", uint32(s))
+	}
+}
+
+// LinkState reports the operational state of the Advertiser's link, or the
+// empty string if link state tracking is disabled.
+func (a *Advertiser) LinkState() string {
+	if !a.cfg.TrackLinkState {
+		return ""
+	}
+
+	return linkState(atomic.LoadUint32(a.link)).String()
+}
+
+// setLink updates the Advertiser's linkState, noting any transitions.
+func (a *Advertiser) setLink(s linkState) {
+	if linkState(atomic.SwapUint32(a.link, uint32(s))) == s {
+		// No change.
+		return
+	}
+
+	a.cctx.mm.AdvLinkTransitionsTotal(1.0, a.cfg.Name, s.String())
+	if s == linkDown {
+		a.logf("link is down, not advertising until it comes back up")
+		a.event(system.EventInterfaceDown, "link is down")
+	}
+}
+
+// settleLink waits for the Advertiser's link to stay up for the link
+// hysteresis, so that a flapping link does not produce bursts of router
+// advertisements. It returns system.ErrLinkChange if the link goes down in
+// the meantime.
+func (a *Advertiser) settleLink(ctx context.Context) error {
+	// Any changes which occurred before the link came up are stale.
+	watchC := a.watchC
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-watchC:
+			if !ok {
+				// Watcher halted or not available on this OS.
+				watchC = nil
+			}
+		default:
+			drained = true
+		}
+	}
+
+	a.setLink(linkSettling)
+
+	t := time.NewTimer(a.linkHysteresis)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-watchC:
+			if !ok {
+				watchC = nil
+				continue
+			}
+
+			a.setLink(linkDown)
+			return system.ErrLinkChange
+		case <-t.C:
+			a.setLink(linkUp)
+			return nil
+		}
+	}
+}
+
+// checkSource notes when err indicates that the link-local source address of
+// the Advertiser's Conn is no longer available. The Dialer treats this error
+// as recoverable and re-resolves the source address by dialing again.
+func (a *Advertiser) checkSource(err error) {
+	if errors.Is(err, syscall.EADDRNOTAVAIL) {
+		a.cctx.mm.AdvSourceAddressResolutionsTotal(1.0, a.cfg.Name)
+	}
+}
+
 // Ready implements Task.
 func (a *Advertiser) Ready() <-chan struct{} { return a.readyC }
 
@@ -147,12 +681,17 @@ func (a *Advertiser) advertise(ctx context.Context, conn system.Conn) error {
 	// one of them returns an error.
 	eg, ctx := errgroup.WithContext(ctx)
 
-	ipC := make(chan netaddr.IP, 16)
+	reqC := make(chan request, 16)
+
+	// Assume that a.init sent the initial RA recently, and note that on-demand
+	// RA requests can no longer be served once the Advertiser stops.
+	atomic.StoreInt64(a.lastMulticast, time.Now().UnixNano())
+	defer atomic.StoreInt64(a.lastMulticast, 0)
 
 	// RA scheduler which consumes requests to send RAs and dispatches them
 	// at the appropriate times.
 	eg.Go(func() error {
-		if err := a.schedule(ctx, conn, ipC); err != nil {
+		if err := a.schedule(ctx, conn, reqC); err != nil {
 			return fmt.Errorf("failed to schedule router advertisements: %w", err)
 		}
 
@@ -162,27 +701,88 @@ func (a *Advertiser) advertise(ctx context.Context, conn system.Conn) error {
 	// Multicast RA generator, unless running in unicast-only mode.
 	if !a.cfg.UnicastOnly {
 		eg.Go(func() error {
-			a.multicast(ctx, ipC)
+			a.multicast(ctx, reqC)
 			return nil
 		})
 	}
 
 	// Listener which issues RAs in response to RS messages.
 	eg.Go(func() error {
-		l := newListener(a.cctx, a.cfg.Name, conn)
+		l := newListener(a.cctx, a.cfg.Name, conn, a.cfg.LenientHopLimit)
+		l.grace = a.cfg.ReceiveGracePeriod
+		l.onDegraded = a.degrade
 		return l.Listen(ctx, func(msg message) error {
-			ip, err := a.handle(msg.Message, msg.Host)
+			req, err := a.handle(msg.Message, msg.Host)
 			if err != nil {
 				return fmt.Errorf("failed to handle NDP message: %w", err)
 			}
-			if ip != nil {
-				ipC <- *ip
+			if req != nil {
+				reqC <- *req
 			}
 
 			return nil
 		})
 	})
 
+	// Upstream health checkers which pause default router advertisement when
+	// upstream connectivity is lost.
+	for _, p := range a.cfg.Plugins {
+		if u, ok := p.(*plugin.Upstream); ok {
+			eg.Go(func() error {
+				a.upstream(ctx, u, reqC)
+				return nil
+			})
+		}
+	}
+
+	// VRRP role checkers which pause default router advertisement while this
+	// router is the VRRP backup.
+	for _, p := range a.cfg.Plugins {
+		if v, ok := p.(*plugin.VRRP); ok {
+			eg.Go(func() error {
+				a.vrrp(ctx, v, reqC)
+				return nil
+			})
+		}
+	}
+
+	// Routing table checkers which promptly advertise changes to routes
+	// learned from the kernel.
+	for _, p := range a.cfg.Plugins {
+		if k, ok := p.(*plugin.KernelRoutes); ok {
+			eg.Go(func() error {
+				a.kernelRoutes(ctx, k, reqC)
+				return nil
+			})
+		}
+	}
+
+	// Address change watchers which promptly advertise changes to prefixes
+	// derived from upstream interfaces.
+	for iface, changeC := range a.delegatedC {
+		iface, changeC := iface, changeC
+		eg.Go(func() error {
+			a.delegated(ctx, iface, changeC, reqC)
+			return nil
+		})
+	}
+
+	// On-demand RA requests from Advertise.
+	eg.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case req := <-a.triggerC:
+				select {
+				case <-ctx.Done():
+					return nil
+				case reqC <- req:
+				}
+			}
+		}
+	})
+
 	eg.Go(linkStateWatcher(ctx, a.watchC))
 
 	if err := eg.Wait(); err != nil {
@@ -201,8 +801,246 @@ const (
 	maxRADelay            = 500 * time.Millisecond
 )
 
+// linkHysteresis is the default time for which a link must stay up before an
+// Advertiser which tracks link state advertises on it.
+const linkHysteresis = 2 * time.Second
+
+// conflictMultiple is the multiple of an Advertiser's maximum interval after
+// which inconsistencies with another router are considered persistent, unless
+// a conflict window is configured.
+const conflictMultiple = 3
+
+// lateDeviation is the deviation from the scheduled time of an unsolicited
+// multicast router advertisement after which it is considered late.
+const lateDeviation = time.Second
+
+// minCordonInterval is the minimum interval between changes to whether an
+// Advertiser is cordoned, so that repeated toggles do not cause hosts to
+// flap between default routers.
+const minCordonInterval = 10 * time.Second
+
+// selfLoopLogInterval is the minimum interval between logs for router
+// advertisements which were sent by an Advertiser and looped back to it.
+const selfLoopLogInterval = time.Minute
+
+// emptyLogInterval is the minimum interval between logs for ::/N prefixes which
+// matched no prefixes on an Advertiser's interface.
+const emptyLogInterval = 5 * time.Minute
+
+// debugLogInterval is the minimum interval between verbose logs of unchanged
+// router advertisement options, unless a debug log interval is configured.
+const debugLogInterval = time.Minute
+
+// solicitedWorkers is the number of workers which send unicast router
+// advertisements for an Advertiser, and solicitedQueueSize is the number of
+// unicast router advertisements which may wait for a worker before further
+// router advertisements are dropped.
+const (
+	solicitedWorkers   = 4
+	solicitedQueueSize = 64
+)
+
+// solicitedSendInterval is the interval between additional router
+// advertisements sent in response to a router solicitation, unless a solicited
+// send interval is configured.
+const solicitedSendInterval = 100 * time.Millisecond
+
+// Advertise requests that the Advertiser immediately send an unsolicited
+// multicast router advertisement. If doing so would violate the minimum delay
+// between multicast router advertisements, no router advertisement is sent,
+// and Advertise returns the duration after which the caller may try again.
+func (a *Advertiser) Advertise() (time.Duration, error) {
+	if a.cfg.UnicastOnly {
+		return 0, errors.New("advertiser does not send multicast router advertisements in unicast-only mode")
+	}
+
+	last := atomic.LoadInt64(a.lastMulticast)
+	if last == 0 {
+		return 0, errors.New("advertiser is not running")
+	}
+
+	if since := time.Since(time.Unix(0, last)); since < a.minDelayBetweenRAs {
+		return a.minDelayBetweenRAs - since, nil
+	}
+
+	select {
+	case a.triggerC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+		return 0, nil
+	default:
+		// A previous on-demand request has not yet been scheduled.
+		return a.minDelayBetweenRAs, nil
+	}
+}
+
+// Withdraw withdraws the Advertiser if withdraw is true, or promotes it to
+// full advertising if withdraw is false. A withdrawn Advertiser continues to
+// send router advertisements, but with a router lifetime of zero and no
+// prefixes, so that hosts do not use this router. If the state changes while
+// the Advertiser is running, an unsolicited multicast router advertisement is
+// sent as soon as the minimum delay between router advertisements permits.
+func (a *Advertiser) Withdraw(withdraw bool) {
+	var v uint32
+	if withdraw {
+		v = 1
+	}
+
+	if atomic.SwapUint32(a.withdrawn, v) == v {
+		// No change.
+		return
+	}
+
+	a.cctx.mm.AdvWithdrawn(boolFloat(withdraw), a.cfg.Name)
+	if withdraw {
+		a.logf("withdrawn, advertising a router lifetime of zero and no prefixes")
+		a.event(system.EventWithdraw, "withdrawn")
+	} else {
+		a.logf("promoted, advertising configured parameters")
+		a.event(system.EventWithdraw, "promoted")
+
+		// Hosts should not immediately rely on a router which was just
+		// promoted, so restart the router lifetime ramp, if configured.
+		atomic.StoreUint32(a.ramped, 0)
+	}
+
+	if a.cfg.UnicastOnly || atomic.LoadInt64(a.lastMulticast) == 0 {
+		// No multicast router advertisements to send.
+		return
+	}
+
+	// The scheduler enforces the minimum delay between multicast router
+	// advertisements.
+	select {
+	case a.triggerC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+	default:
+		// A router advertisement is already pending.
+	}
+
+	if !withdraw {
+		select {
+		case a.fastStartC <- struct{}{}:
+		default:
+			// A fast start is already pending.
+		}
+	}
+}
+
+// RouterLifetime reports the router lifetime currently advertised while the
+// Advertiser ramps up its router lifetime after it is initialized or promoted,
+// and whether the ramp is in progress. If the ramp is not in progress, the
+// configured default lifetime is advertised. A withdrawn or cordoned
+// Advertiser advertises a router lifetime of zero regardless.
+func (a *Advertiser) RouterLifetime() (time.Duration, bool) { return a.rampLifetime(a.cfg) }
+
+// rampLifetime computes the router lifetime for the current step of the
+// router lifetime ramp configured by cfg, and reports whether the ramp is in
+// progress.
+func (a *Advertiser) rampLifetime(cfg config.Interface) (time.Duration, bool) {
+	n := int(atomic.LoadUint32(a.ramped))
+	if cfg.InitialDefaultLifetime == 0 || n >= a.initialCount {
+		return cfg.DefaultLifetime, false
+	}
+
+	return lifetimeRamp(n, a.initialCount, cfg.InitialDefaultLifetime, cfg.DefaultLifetime), true
+}
+
+// Withdrawn reports whether the Advertiser is withdrawn.
+func (a *Advertiser) Withdrawn() bool { return atomic.LoadUint32(a.withdrawn) == 1 }
+
+// Cordon cordons the Advertiser if cordon is true, or uncordons it if cordon
+// is false. A cordoned Advertiser continues to advertise its prefixes so that
+// hosts' addresses remain valid, but with a router lifetime of zero so that
+// hosts stop using this router as a default router, such as for maintenance.
+// Changes are debounced: if the state changed less than minCordonInterval ago,
+// the state is not changed and Cordon returns a non-zero duration after which
+// the caller may try again. Otherwise, if the state changes while the
+// Advertiser is running, an unsolicited multicast router advertisement is sent
+// as soon as the minimum delay between router advertisements permits.
+func (a *Advertiser) Cordon(cordon bool) time.Duration {
+	var v uint32
+	if cordon {
+		v = 1
+	}
+
+	a.cordonMu.Lock()
+	if atomic.LoadUint32(a.cordoned) == v {
+		// No change.
+		a.cordonMu.Unlock()
+		return 0
+	}
+
+	now := a.timeNow()
+	if !a.lastCordon.IsZero() {
+		if next := a.lastCordon.Add(minCordonInterval); now.Before(next) {
+			a.cordonMu.Unlock()
+			return next.Sub(now)
+		}
+	}
+
+	a.lastCordon = now
+	atomic.StoreUint32(a.cordoned, v)
+	a.cordonMu.Unlock()
+
+	a.cctx.mm.AdvCordoned(boolFloat(cordon), a.cfg.Name)
+	if cordon {
+		a.logf("cordoned, advertising a router lifetime of zero and configured prefixes")
+		a.event(system.EventCordon, "cordoned")
+	} else {
+		a.logf("uncordoned, advertising configured parameters")
+		a.event(system.EventCordon, "uncordoned")
+	}
+
+	if a.cfg.UnicastOnly || atomic.LoadInt64(a.lastMulticast) == 0 {
+		// No multicast router advertisements to send.
+		return 0
+	}
+
+	select {
+	case a.triggerC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+	default:
+		// A router advertisement is already pending.
+	}
+
+	return 0
+}
+
+// Cordoned reports whether the Advertiser is cordoned.
+func (a *Advertiser) Cordoned() bool { return atomic.LoadUint32(a.cordoned) == 1 }
+
+// Waiting reports whether the Advertiser is waiting for its interface to be
+// created.
+func (a *Advertiser) Waiting() bool { return atomic.LoadUint32(a.waiting) == 1 }
+
+// Degraded reports whether the Advertiser's receive errors have persisted
+// beyond its receive grace period.
+func (a *Advertiser) Degraded() bool { return atomic.LoadUint32(a.degraded) == 1 }
+
+// degrade is invoked by the Advertiser's listener when receive errors persist
+// beyond the receive grace period, or when it recovers.
+func (a *Advertiser) degrade(degraded bool) {
+	var v uint32
+	if degraded {
+		v = 1
+	}
+
+	atomic.StoreUint32(a.degraded, v)
+	a.cctx.mm.AdvReceiveDegraded(boolFloat(degraded), a.cfg.Name)
+}
+
+// wait is invoked by the Dialer when the Advertiser begins or stops waiting
+// for its interface to be created.
+func (a *Advertiser) wait(waiting bool) {
+	var v uint32
+	if waiting {
+		v = 1
+		a.waitOnce.Do(func() { close(a.waitC) })
+	}
+
+	atomic.StoreUint32(a.waiting, v)
+	a.cctx.mm.AdvInterfaceWaiting(boolFloat(waiting), a.cfg.Name)
+}
+
 // multicast runs a multicast advertising loop until ctx is canceled.
-func (a *Advertiser) multicast(ctx context.Context, ipC chan<- netaddr.IP) {
+func (a *Advertiser) multicast(ctx context.Context, reqC chan<- request) {
 	// Initialize PRNG so we can add jitter to our unsolicited multicast RA
 	// delay times.
 	var (
@@ -211,6 +1049,22 @@ func (a *Advertiser) multicast(ctx context.Context, ipC chan<- netaddr.IP) {
 		max  = a.cfg.MaxInterval
 	)
 
+	var (
+		quiet, clamped, resumed bool
+		delay, interval         time.Duration
+
+		// No router advertisement has been scheduled yet to compare the
+		// first against.
+		baseline = true
+	)
+
+	// Discard any fast start notification left over from a previous loop,
+	// which begins with its initial advertisements regardless.
+	select {
+	case <-a.fastStartC:
+	default:
+	}
+
 	for i := 0; ; i++ {
 		// Enable cancelation before sending any messages, if necessary.
 		select {
@@ -219,22 +1073,292 @@ func (a *Advertiser) multicast(ctx context.Context, ipC chan<- netaddr.IP) {
 		default:
 		}
 
-		ipC <- netaddr.IPv6LinkLocalAllNodes()
+		// In on-demand mode, only advertise while hosts have solicited
+		// recently, but continue the schedule so advertising resumes on time.
+		switch recent := a.solicitedRecently(time.Now()); {
+		case !recent && !quiet:
+			quiet = true
+			a.logf("no router solicitations received within %s, suppressing unsolicited multicast router advertisements",
+				a.cfg.OnDemandWindow)
+		case recent && quiet:
+			quiet = false
+			a.logf("router solicitation received, resuming unsolicited multicast router advertisements")
+		}
+
+		switch {
+		case resumed:
+			// Withdraw already requested the first advertisement after
+			// promotion.
+			resumed = false
+		case !quiet:
+			// Once the initial advertisements are sent, optionally pace
+			// this advertisement with those of other Advertisers, without
+			// exceeding the maximum interval since the previous one.
+			var paced time.Duration
+			if a.pacer != nil && i >= a.initialCount {
+				d, ok := a.pace(ctx, max-delay)
+				if !ok {
+					return
+				}
+				paced = d
+			}
+
+			req := request{
+				IP:        netaddr.IPv6LinkLocalAllNodes(),
+				Scheduled: true,
+			}
+			if !baseline {
+				req.Interval = interval + paced
+			}
+
+			reqC <- req
+			baseline, interval = false, 0
+		}
+
+		// As a safety backstop, never send unsolicited multicast RAs faster
+		// than the RFC permits, regardless of configuration.
+		delay = multicastDelay(prng, i, min, max, a.initialInterval, a.initialCount)
+		if delay < a.minDelayBetweenRAs {
+			if !clamped {
+				clamped = true
+				a.logf("WARNING: configured interval of %s is below the minimum delay of %s between multicast router advertisements, sending at the minimum delay instead",
+					delay, a.minDelayBetweenRAs)
+			}
+
+			delay = a.minDelayBetweenRAs
+		}
 
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(multicastDelay(prng, i, min, max)):
+		case <-a.fastStartC:
+			// Promoted after withdrawal, so hosts should learn of this
+			// router quickly again: restart the initial advertisements,
+			// which are not compared against those before withdrawal.
+			i = -1
+			resumed = true
+			baseline = true
+			continue
+		case <-time.After(delay):
 		}
+
+		// Suppressed advertisements in on-demand mode extend the interval
+		// until the next one is sent.
+		interval += delay
 	}
 }
 
-// handle handles an incoming NDP message from a remote host.
-func (a *Advertiser) handle(m ndp.Message, host netaddr.IP) (*netaddr.IP, error) {
-	a.cctx.mm.AdvMessagesReceivedTotal(1.0, a.cfg.Name, m.Type().String())
+// checkDeviation reports how much later than its scheduled interval of want
+// an unsolicited multicast router advertisement was sent, got after the
+// previous one, which indicates scheduler jitter, CPU starvation on an
+// overloaded system, or a slow send path.
+func (a *Advertiser) checkDeviation(want, got time.Duration) {
+	dev := got - want
+	if dev < 0 {
+		dev = 0
+	}
+
+	a.cctx.mm.AdvScheduleDeviation(dev.Seconds(), a.cfg.Name)
+	if dev < lateDeviation {
+		return
+	}
+
+	a.logf("WARNING: unsolicited multicast router advertisement scheduled after %s was sent %s late, the system may be overloaded",
+		want, dev)
+	a.cctx.mm.AdvScheduleLateTotal(1.0, a.cfg.Name)
+}
+
+// pace waits until a.pacer permits sending an unsolicited multicast router
+// advertisement, up to limit, and returns the delay. It returns false if ctx
+// is canceled.
+func (a *Advertiser) pace(ctx context.Context, limit time.Duration) (time.Duration, bool) {
+	now := time.Now()
+	delay := a.pacer.reserve(now, limit)
+
+	a.cctx.mm.AdvPacingDelay(delay.Seconds(), a.cfg.Name)
+	a.cctx.mm.AdvPacingOffset(a.pacer.offset(now.Add(delay)).Seconds(), a.cfg.Name)
+
+	if delay == 0 {
+		return 0, true
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, false
+	case <-time.After(delay):
+		return delay, true
+	}
+}
+
+// solicitedRecently reports whether the Advertiser has received a router
+// solicitation within its on-demand window as of now. It always reports true
+// if on-demand mode is disabled.
+func (a *Advertiser) solicitedRecently(now time.Time) bool {
+	if a.cfg.OnDemandWindow == 0 {
+		return true
+	}
+
+	last := atomic.LoadInt64(a.lastSolicitation)
+	return last != 0 && now.Sub(time.Unix(0, last)) < a.cfg.OnDemandWindow
+}
+
+// upstream runs an upstream health checking loop until ctx is canceled. When
+// the upstream health state changes, a multicast RA is requested so hosts
+// are notified promptly.
+func (a *Advertiser) upstream(ctx context.Context, u *plugin.Upstream, reqC chan<- request) {
+	a.cctx.mm.AdvUpstreamHealthy(boolFloat(u.Healthy()), a.cfg.Name)
+
+	t := time.NewTicker(u.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		changed, err := u.Update()
+		if err != nil {
+			a.logf("failed to check upstream connectivity: %v", err)
+			a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "upstream")
+		}
+		if !changed {
+			continue
+		}
+
+		healthy := u.Healthy()
+		a.cctx.mm.AdvUpstreamHealthy(boolFloat(healthy), a.cfg.Name)
+
+		if healthy {
+			a.logf("upstream connectivity restored, resuming advertising as a default router")
+		} else {
+			a.logf("upstream connectivity lost, no longer advertising as a default router")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case reqC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+		}
+	}
+}
+
+// vrrp runs a VRRP role checking loop until ctx is canceled. When the VRRP
+// role changes, a multicast RA is requested so hosts are notified promptly.
+func (a *Advertiser) vrrp(ctx context.Context, v *plugin.VRRP, reqC chan<- request) {
+	t := time.NewTicker(v.Interval)
+	defer t.Stop()
+
+	// The initial role is determined immediately rather than waiting for the
+	// first tick.
+	for {
+		if a.updateVRRP(v) {
+			select {
+			case <-ctx.Done():
+				return
+			case reqC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// kernelRoutes runs a routing table checking loop until ctx is canceled. When
+// the routes learned from the kernel change, a multicast RA is requested so
+// hosts are notified promptly.
+func (a *Advertiser) kernelRoutes(ctx context.Context, k *plugin.KernelRoutes, reqC chan<- request) {
+	t := time.NewTicker(k.Interval)
+	defer t.Stop()
+
+	// The initial routes are recorded immediately rather than waiting for the
+	// first tick.
+	for {
+		changed, err := k.Update()
+		if err != nil {
+			a.logf("failed to check kernel routes: %v", err)
+			a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "kernel_routes")
+		}
+		if changed {
+			a.logf("kernel routes changed, updating advertised routes")
+
+			select {
+			case <-ctx.Done():
+				return
+			case reqC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// delegated requests a multicast RA whenever the addresses of the upstream
+// interface iface change, so that hosts are promptly notified of new or
+// withdrawn delegated prefixes. It runs until ctx is canceled or changeC is
+// closed.
+func (a *Advertiser) delegated(ctx context.Context, iface string, changeC <-chan netstate.Change, reqC chan<- request) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changeC:
+			if !ok {
+				// Watcher halted or not available on this OS.
+				return
+			}
+		}
+
+		a.logf("addresses changed on upstream interface %q, updating delegated prefixes", iface)
+
+		select {
+		case <-ctx.Done():
+			return
+		case reqC <- request{IP: netaddr.IPv6LinkLocalAllNodes()}:
+		}
+	}
+}
+
+// updateVRRP checks the VRRP role of v, reporting whether or not it changed.
+func (a *Advertiser) updateVRRP(v *plugin.VRRP) bool {
+	changed, err := v.Update()
+	if err != nil {
+		a.logf("failed to check VRRP state: %v", err)
+		a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "vrrp")
+	}
+
+	master := v.Master()
+	a.cctx.mm.AdvVRRPMaster(boolFloat(master), a.cfg.Name)
+	if !changed {
+		return false
+	}
+
+	if master {
+		a.logf("VRRP role is master, advertising as a default router")
+	} else {
+		a.logf("VRRP role is backup, no longer advertising as a default router")
+	}
+
+	return true
+}
+
+// handle handles an incoming NDP message from a remote host.
+func (a *Advertiser) handle(m ndp.Message, host netaddr.IP) (*request, error) {
+	a.cctx.mm.AdvMessagesReceivedTotal(1.0, a.cfg.Name, m.Type().String())
+
+	switch m := m.(type) {
+	case *ndp.RouterSolicitation:
+		atomic.StoreInt64(a.lastSolicitation, time.Now().UnixNano())
 
-	switch m := m.(type) {
-	case *ndp.RouterSolicitation:
 		// Issue a unicast RA for clients with valid addresses, or a multicast
 		// RA for any client contacting us via the IPv6 unspecified address,
 		// per https://tools.ietf.org/html/rfc4861#section-6.2.6.
@@ -242,19 +1366,51 @@ func (a *Advertiser) handle(m ndp.Message, host netaddr.IP) (*netaddr.IP, error)
 			host = netaddr.IPv6LinkLocalAllNodes()
 		}
 
+		req := &request{IP: host, Solicited: true}
+		if nonce, ok := plugin.FindNonce(m.Options); ok && a.nonceEnabled() {
+			// Echo this nonce in our response and remember it so other
+			// routers' responses can be checked against it.
+			req.Nonce = nonce
+			a.observeNonce(nonce)
+		}
+
 		// TODO: consider checking for numerous RS in succession and issuing
 		// a multicast RA in response.
-		return &host, nil
+		return req, nil
 	case *ndp.RouterAdvertisement:
+		if a.isSelf(m, host) {
+			// Our own router advertisement was looped back to us, so it is
+			// not checked for consistency.
+			a.selfLoop(host)
+			break
+		}
+
+		if nonce, ok := plugin.FindNonce(m.Options); ok && a.nonceEnabled() && !a.knownNonce(nonce) {
+			a.logf("router advertisement from router with IP %q contains a nonce which does not match any observed router solicitation", host)
+			a.cctx.mm.AdvNonceMismatchesTotal(1.0, a.cfg.Name)
+		}
+
 		// Received a router advertisement from a different router on this
 		// LAN, verify its consistency with our own.
-		want, err := a.buildRA(a.cfg)
+		want, _, err := a.buildRA(a.cfg, config.UnsolicitedSet)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build router advertisement: %w", err)
 		}
 
-		// Ensure the RAs are consistent.
+		// Randomized timers are consistent with any value in their ranges.
+		want.ReachableTime = rangeTimer(want.ReachableTime, m.ReachableTime,
+			a.cfg.ReachableTime, a.cfg.ReachableTimeMax)
+		want.RetransmitTimer = rangeTimer(want.RetransmitTimer, m.RetransmitTimer,
+			a.cfg.RetransmitTimer, a.cfg.RetransmitTimerMax)
+
+		// Ensure the RAs are consistent, and track any inconsistencies over
+		// time to detect persistent conflicts.
 		problems := verifyRAs(want, m)
+		a.trackConflicts(host, problems)
+		if a.cfg.AdoptNeighborHopLimit {
+			a.observeHopLimit(m.CurrentHopLimit, m.RouterLifetime, host)
+		}
+
 		if len(problems) == 0 {
 			break
 		}
@@ -280,6 +1436,10 @@ func (a *Advertiser) handle(m ndp.Message, host netaddr.IP) (*netaddr.IP, error)
 		if a.OnInconsistentRA != nil {
 			a.OnInconsistentRA(want, m)
 		}
+	case *ndp.NeighborSolicitation, *ndp.NeighborAdvertisement:
+		// Only accepted in diagnostic mode, and never acted upon.
+		a.cctx.mm.AdvDiagnosticMessagesReceivedTotal(1.0, a.cfg.Name, m.Type().String())
+		a.debugDiagnostic(m, host)
 	default:
 		a.logf("advertiser received NDP message of type %T from %s, ignoring", m, host)
 		a.cctx.mm.MessagesReceivedInvalidTotal(1.0, a.cfg.Name, m.Type().String())
@@ -289,9 +1449,61 @@ func (a *Advertiser) handle(m ndp.Message, host netaddr.IP) (*netaddr.IP, error)
 	return nil, nil
 }
 
+// setSelf sets the link-local source address and source link-layer address of
+// the Advertiser's router advertisements.
+func (a *Advertiser) setSelf(ip net.IP, mac net.HardwareAddr) {
+	self, _ := netaddr.FromStdIP(ip)
+
+	a.selfMu.Lock()
+	defer a.selfMu.Unlock()
+
+	a.selfIP = self
+	a.selfLLA = ""
+	if mac != nil {
+		a.selfLLA = mac.String()
+	}
+}
+
+// isSelf reports whether ra, received from host, was sent by this Advertiser,
+// as identified by its source address and, if ra carries one, its source
+// link-layer address. A link-layer address alone is not sufficient because it
+// may be shared with other routers, such as a VRRP virtual MAC or an override.
+func (a *Advertiser) isSelf(ra *ndp.RouterAdvertisement, host netaddr.IP) bool {
+	a.selfMu.Lock()
+	defer a.selfMu.Unlock()
+
+	if a.selfIP.IsZero() || host != a.selfIP {
+		return false
+	}
+
+	lla := sourceLLA(ra.Options)
+	return a.selfLLA == "" || lla == "unknown" || lla == a.selfLLA
+}
+
+// selfLoop reports that a router advertisement sent by this Advertiser was
+// received from host, which may indicate a layer 2 loop such as in a bridged
+// topology. Logs are rate limited.
+func (a *Advertiser) selfLoop(host netaddr.IP) {
+	a.cctx.mm.AdvSelfLoopsTotal(1.0, a.cfg.Name)
+
+	a.selfMu.Lock()
+	defer a.selfMu.Unlock()
+
+	a.selfLoops++
+	now := a.timeNow()
+	if !a.lastSelfLoopLog.IsZero() && now.Sub(a.lastSelfLoopLog) < selfLoopLogInterval {
+		return
+	}
+
+	a.logf("WARNING: received %d of our own router advertisement(s), most recently from %q, there may be a layer 2 loop on this link",
+		a.selfLoops, host)
+	a.selfLoops = 0
+	a.lastSelfLoopLog = now
+}
+
 // schedule consumes RA requests and schedules them with workers so they may
 // occur at the appropriate times.
-func (a *Advertiser) schedule(ctx context.Context, conn system.Conn, ipC <-chan netaddr.IP) error {
+func (a *Advertiser) schedule(ctx context.Context, conn system.Conn, reqC <-chan request) error {
 	// Enable canceling schedule's context on send RA error.
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -308,13 +1520,35 @@ func (a *Advertiser) schedule(ctx context.Context, conn system.Conn, ipC <-chan
 		prng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 		// Assume that a.init sent the initial RA recently and space out others
-		// accordingly.
+		// accordingly. If configured, solicited multicast RAs are spaced out
+		// independently.
 		lastMulticast = time.Now()
+		lastSolicited time.Time
+
+		// Unicast router advertisements are built and sent by a bounded pool
+		// of workers, so a burst of router solicitations cannot create an
+		// unbounded number of goroutines or delay multicast advertisements.
+		sendQ = make(chan request, solicitedQueueSize)
+		wg    sync.WaitGroup
 	)
 
+	wg.Add(solicitedWorkers)
+	defer func() {
+		// Stop the workers before returning.
+		cancel()
+		wg.Wait()
+	}()
+
+	for i := 0; i < solicitedWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			a.solicited(ctx, conn, sendQ, errC)
+		}()
+	}
+
 	for {
-		// New IP for each loop iteration to prevent races.
-		var ip netaddr.IP
+		// New request for each loop iteration to prevent races.
+		var req request
 
 		select {
 		case err := <-errC:
@@ -331,92 +1565,499 @@ func (a *Advertiser) schedule(ctx context.Context, conn system.Conn, ipC <-chan
 			}
 
 			return nil
-		case ip = <-ipC:
+		case req = <-reqC:
 		}
 
-		if !ip.IsMulticast() {
+		if !req.IP.IsMulticast() {
 			// This is a unicast RA. Delay it for a short period of time per
 			// the RFC and then send it.
 			delay := time.Duration(prng.Int63n(maxRADelay.Nanoseconds())) * time.Nanosecond
-			sg.Delay(delay, func() {
-				if err := a.sendWorker(conn, ip); err != nil {
-					errC <- err
-				}
-			})
+			sg.Delay(delay, func() { a.enqueue(sendQ, req) })
+
+			// Solicited unicast RAs may be repeated to improve the odds of
+			// delivery on lossy links. Multicast RAs are never repeated, so
+			// the minimum delay between multicast RAs is respected.
+			for i := 1; req.Solicited && i < a.cfg.SolicitedSends; i++ {
+				repeat := req
+				repeat.Repeat = true
+				sg.Delay(delay+time.Duration(i)*a.sendInterval, func() {
+					a.enqueue(sendQ, repeat)
+				})
+			}
 			continue
 		}
 
+		last := &lastMulticast
+		if req.Solicited && a.cfg.SeparateSolicitedMulticast {
+			last = &lastSolicited
+		}
+
 		// Ensure that we space out multicast RAs as required by the RFC.
 		var delay time.Duration
-		if time.Since(lastMulticast) < a.minDelayBetweenRAs {
+		if time.Since(*last) < a.minDelayBetweenRAs {
 			delay = a.minDelayBetweenRAs
 		}
 
-		// Ready to send this multicast RA.
-		lastMulticast = time.Now()
+		// Ready to send this multicast RA. Any spacing is part of a scheduled
+		// RA's interval.
+		if req.Interval != 0 {
+			req.Interval += delay
+		}
+		*last = time.Now()
+		if last == &lastMulticast {
+			atomic.StoreInt64(a.lastMulticast, lastMulticast.UnixNano())
+		}
 		sg.Delay(delay, func() {
-			if err := a.sendWorker(conn, ip); err != nil {
+			if err := a.sendWorker(ctx, conn, req); err != nil {
 				errC <- err
 			}
 		})
 	}
 }
 
-// sendWorker is a goroutine worker which sends a router advertisement to ip.
-func (a *Advertiser) sendWorker(conn system.Conn, ip netaddr.IP) error {
-	if err := a.send(conn, ip, a.cfg); err != nil {
-		a.logf("failed to send scheduled router advertisement to %s: %v", ip, err)
+// enqueue hands a unicast router advertisement request to the solicited
+// response workers, or drops it if the queue is full.
+func (a *Advertiser) enqueue(sendQ chan<- request, req request) {
+	select {
+	case sendQ <- req:
+		a.cctx.mm.AdvSolicitedQueueDepth(float64(len(sendQ)), a.cfg.Name)
+	default:
+		a.debugf("solicited response queue is full, dropping router advertisement to %s", req.IP)
+		a.cctx.mm.AdvSolicitedDroppedTotal(1.0, a.cfg.Name)
+	}
+}
+
+// solicited is a solicited response worker which sends unicast router
+// advertisements for requests from sendQ until ctx is canceled.
+func (a *Advertiser) solicited(ctx context.Context, conn system.Conn, sendQ <-chan request, errC chan<- error) {
+	for {
+		var req request
+		select {
+		case <-ctx.Done():
+			return
+		case req = <-sendQ:
+		}
+
+		a.cctx.mm.AdvSolicitedQueueDepth(float64(len(sendQ)), a.cfg.Name)
+
+		if err := a.sendWorker(ctx, conn, req); err != nil {
+			select {
+			case errC <- err:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// sendWorker is a goroutine worker which sends a router advertisement for req.
+func (a *Advertiser) sendWorker(ctx context.Context, conn system.Conn, req request) error {
+	if err := a.sendRetry(ctx, conn, req); err != nil {
+		if ctx.Err() != nil {
+			// Context canceled, the scheduler is no longer consuming errors.
+			return nil
+		}
+
+		a.logf("failed to send scheduled router advertisement to %s: %v", req.IP, err)
+		a.event(system.EventSendError, "failed to send router advertisement to %s: %v", req.IP, err)
 		a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "transmit")
 		return err
 	}
 
+	a.sent()
+
+	if req.Scheduled {
+		// Compare the time between consecutive scheduled router
+		// advertisements against the interval chosen between them.
+		now := time.Now()
+		last := atomic.SwapInt64(a.lastScheduled, now.UnixNano())
+		if req.Interval != 0 && last != 0 {
+			a.checkDeviation(req.Interval, now.Sub(time.Unix(0, last)))
+		}
+	}
+
 	typ := "unicast"
-	if ip.IsMulticast() {
+	if req.IP.IsMulticast() {
 		typ = "multicast"
 		a.cctx.mm.AdvLastMulticastTime(float64(time.Now().Unix()), a.cfg.Name)
 	}
 
 	a.cctx.mm.AdvRouterAdvertisementsTotal(1.0, a.cfg.Name, typ)
+	if req.Repeat {
+		a.cctx.mm.AdvSolicitedRepeatsTotal(1.0, a.cfg.Name)
+	}
+
 	return nil
 }
 
+// sent fires the onSend hook, if any, after a router advertisement is sent.
+func (a *Advertiser) sent() {
+	if a.onSend != nil {
+		a.onSend()
+	}
+}
+
+// sendRetry will attempt to send a router advertisement for req until ctx is
+// canceled or it exhausts the configured number of transmit retries.
+func (a *Advertiser) sendRetry(ctx context.Context, conn system.Conn, req request) error {
+	retries := a.cfg.TransmitRetries
+
+	var err error
+	for i := 0; i <= retries; i++ {
+		if err = a.send(conn, req, a.cfg); err == nil {
+			return nil
+		}
+
+		if cerr := ctx.Err(); cerr != nil {
+			// Context canceled.
+			return cerr
+		}
+
+		if i == retries {
+			break
+		}
+
+		// Transient failure, either back off and retry or return if the
+		// context is canceled.
+		a.logf("failed to send router advertisement to %s, retrying (%d/%d): %v", req.IP, i+1, retries, err)
+		a.cctx.mm.AdvErrorsTotal(1.0, a.cfg.Name, "transmit_retry")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i+1) * 50 * time.Millisecond):
+		}
+	}
+
+	return fmt.Errorf("exhausted %d transmit retries: %w", retries, err)
+}
+
 // send sends a single router advertisement built from cfg to the destination IP
-// address, which may be a unicast or multicast address.
-func (a *Advertiser) send(conn system.Conn, dst netaddr.IP, cfg config.Interface) error {
+// address specified by req, which may be a unicast or multicast address.
+func (a *Advertiser) send(conn system.Conn, req request, cfg config.Interface) error {
+	dst := req.IP
 	if cfg.UnicastOnly && dst.IsMulticast() {
 		// Nothing to do.
 		return nil
 	}
 
+	// Solicited router advertisements may use a separate plugin set.
+	set := config.UnsolicitedSet
+	if req.Solicited {
+		set = config.SolicitedSet
+	}
+
 	// Build a router advertisement from configuration and always append
 	// the source address option.
-	ra, err := a.buildRA(cfg)
+	ra, dropped, err := a.buildRA(cfg, set)
 	if err != nil {
 		return fmt.Errorf("failed to build router advertisement: %w", err)
 	}
 
-	if err := conn.WriteTo(ra, nil, dst.IPAddr().IP); err != nil {
+	a.checkPrefixes(ra, cfg.PluginsFor(set))
+	a.checkDropped(dropped, cfg)
+	a.checkOptions(ra)
+
+	if req.Nonce != nil {
+		// Echo the solicitation's nonce rather than a random one.
+		plugin.ReplaceNonce(ra, req.Nonce)
+	}
+
+	// Both solicited and unsolicited router advertisements carry the current
+	// router lifetime while it ramps up, but only unsolicited multicast
+	// router advertisements advance the ramp.
+	lifetime, ramping := a.rampLifetime(cfg)
+	if ramping && lifetime < ra.RouterLifetime {
+		ra.RouterLifetime = lifetime
+	}
+	unsolicited := !req.Solicited && dst == netaddr.IPv6LinkLocalAllNodes()
+
+	if a.Withdrawn() {
+		// Hosts must not use this router or its prefixes.
+		ra.RouterLifetime = 0
+		plugin.RemovePrefixes(ra)
+	}
+
+	if a.Cordoned() {
+		// Hosts must not use this router as a default router, but may
+		// continue to use its prefixes.
+		ra.RouterLifetime = 0
+	}
+
+	if !req.Solicited && cfg.SolicitedOnlyLLA {
+		// Only soliciting hosts receive our source link-layer address.
+		plugin.RemoveLLA(ra)
+	}
+
+	for _, f := range a.debugFlags {
+		switch f {
+		case "home_agent":
+			ra.MobileIPv6HomeAgent = true
+		case "proxy":
+			ra.NeighborDiscoveryProxy = true
+		}
+	}
+
+	if err := a.checkSize(ra); err != nil {
+		return err
+	}
+
+	var cm *ipv6.ControlMessage
+	debugGroup := dst == netaddr.IPv6LinkLocalAllNodes() && !a.debugGroup.IsZero()
+	if debugGroup {
+		// Non-standard: real router advertisements must be link-local.
+		dst = a.debugGroup
+		cm = &ipv6.ControlMessage{HopLimit: int(a.debugHopLimit)}
+	}
+
+	if err := conn.WriteTo(ra, cm, dst.IPAddr().IP); err != nil {
 		return fmt.Errorf("failed to send router advertisement to %s: %w", dst, err)
 	}
 
+	if len(a.debugFlags) > 0 {
+		a.cctx.mm.AdvDebugFlagsRouterAdvertisementsTotal(1.0, a.cfg.Name)
+	}
+	if debugGroup {
+		a.cctx.mm.AdvDebugMulticastRouterAdvertisementsTotal(1.0, a.cfg.Name)
+	}
+	if ramping && unsolicited && int(atomic.AddUint32(a.ramped, 1)) == a.initialCount {
+		a.logf("router lifetime ramp complete, advertising default lifetime of %s", cfg.DefaultLifetime)
+	}
+
+	a.debugOptions(ra, dst, cfg)
 	return nil
 }
 
-// buildRA builds a router advertisement from configuration.
-func (a *Advertiser) buildRA(ifi config.Interface) (*ndp.RouterAdvertisement, error) {
+// buildRA builds a router advertisement from configuration using the plugins
+// for set, also returning any plugins which were dropped to fit the router
+// advertisement size budget.
+func (a *Advertiser) buildRA(ifi config.Interface, set config.PluginSet) (*ndp.RouterAdvertisement, []plugin.Plugin, error) {
+	var (
+		ra      *ndp.RouterAdvertisement
+		dropped []plugin.Plugin
+	)
+
 	// Check for any system state changes which could impact the router
 	// advertisement, and then build it using an interface configuration.
-	forwarding, err := a.cctx.state.IPv6Forwarding(ifi.Name)
+	// Both the state and the plugins refer to the interface, so they are
+	// consulted within its network namespace.
+	err := a.dialer.InNetns(func() error {
+		forwarding, err := a.cctx.state.IPv6Forwarding(ifi.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get IPv6 forwarding state: %w", err)
+		}
+
+		ra, dropped, err = ifi.Build(forwarding, set)
+		if err != nil {
+			return fmt.Errorf("failed to generate router advertisement: %v", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get IPv6 forwarding state: %w", err)
+		return nil, nil, err
 	}
 
-	ra, err := ifi.RouterAdvertisement(forwarding)
+	if a.cfg.AdoptNeighborHopLimit {
+		// A neighboring router may advertise a larger hop limit.
+		ra.CurrentHopLimit = a.adoptHopLimit(ra.CurrentHopLimit)
+	}
+
+	return ra, dropped, nil
+}
+
+// shadowWrite is a system.ShadowConn hook which logs and counts router
+// advertisements which would have been sent in shadow mode.
+func (a *Advertiser) shadowWrite(m ndp.Message, _ *ipv6.ControlMessage, dst net.IP) {
+	typ := "unicast"
+	if dst.IsMulticast() {
+		typ = "multicast"
+	}
+
+	var options int
+	if ra, ok := m.(*ndp.RouterAdvertisement); ok {
+		options = len(ra.Options)
+	}
+
+	a.cctx.mm.AdvShadowRouterAdvertisementsTotal(1.0, a.cfg.Name, typ)
+	a.logf("shadow mode, not sending %s router advertisement with %d option(s) to %s", typ, options, dst)
+}
+
+// checkPrefixes reports the number of prefixes advertised in ra, and whether
+// any ::/N prefix in plugins failed to match a prefix on the interface, such
+// as when a DHCPv6-PD lease has expired.
+func (a *Advertiser) checkPrefixes(ra *ndp.RouterAdvertisement, plugins []plugin.Plugin) {
+	prefixes := pickPrefixes(ra.Options)
+	a.cctx.mm.AdvPrefixes(float64(len(prefixes)), a.cfg.Name)
+
+	// Explicitly configured prefixes are not counted toward the prefixes
+	// produced by ::/N.
+	var wildcards []netaddr.IPPrefix
+	static := make(map[netaddr.IPPrefix]struct{})
+	for _, p := range plugins {
+		pfx, ok := p.(*plugin.Prefix)
+		if !ok || pfx.RouterAddress {
+			// Router addresses are not advertised as prefix information.
+			continue
+		}
+
+		if pfx.Prefix.IP == netaddr.IPv6Unspecified() {
+			wildcards = append(wildcards, pfx.Prefix)
+		} else {
+			static[pfx.Prefix] = struct{}{}
+		}
+	}
+
+	for _, w := range wildcards {
+		var found bool
+		for _, o := range ra.Options {
+			p, routerAddress, ok := plugin.PrefixInformation(o)
+			if !ok || routerAddress {
+				continue
+			}
+
+			ip, ok := netaddr.FromStdIP(p.Prefix)
+			if !ok || p.PrefixLength != w.Bits {
+				continue
+			}
+
+			if _, ok := static[netaddr.IPPrefix{IP: ip, Bits: p.PrefixLength}]; !ok {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		a.cctx.mm.AdvPrefixesEmptyTotal(1.0, a.cfg.Name, w.String())
+
+		a.emptyMu.Lock()
+		now := a.timeNow()
+		if now.Sub(a.lastEmptyLog) >= a.emptyLogInterval {
+			a.lastEmptyLog = now
+			a.logf("prefix %s matched no prefixes on this interface, no prefixes will be advertised for it", w)
+		}
+		a.emptyMu.Unlock()
+	}
+}
+
+// checkDropped reports any plugins which were dropped from a router
+// advertisement to fit within the size budget in cfg. Logs are only produced
+// when the set of dropped plugins changes.
+func (a *Advertiser) checkDropped(dropped []plugin.Plugin, cfg config.Interface) {
+	names := make([]string, 0, len(dropped))
+	for _, p := range dropped {
+		a.cctx.mm.AdvPluginsDroppedTotal(1.0, a.cfg.Name, p.Name())
+		names = append(names, p.Name())
+	}
+
+	s := strings.Join(names, ", ")
+
+	a.droppedMu.Lock()
+	defer a.droppedMu.Unlock()
+
+	if s == a.lastDropped {
+		return
+	}
+	a.lastDropped = s
+
+	if s == "" {
+		a.logf("router advertisements fit within the %d byte size budget, no plugins are dropped", cfg.MaxSize)
+		return
+	}
+
+	a.logf("dropped plugins to fit router advertisements within the %d byte size budget: %s", cfg.MaxSize, s)
+}
+
+// optionTypes are the NDP option types reported by checkOptions. The set is
+// fixed to bound the cardinality of the options metric.
+var optionTypes = []string{"prefix", "route", "rdnss", "dnssl", "mtu"}
+
+// checkOptions reports which of the optionTypes are present in ra.
+func (a *Advertiser) checkOptions(ra *ndp.RouterAdvertisement) {
+	present := make(map[string]bool, len(optionTypes))
+	for _, o := range ra.Options {
+		if _, _, ok := plugin.PrefixInformation(o); ok {
+			present["prefix"] = true
+			continue
+		}
+
+		switch o.(type) {
+		case *ndp.RouteInformation:
+			present["route"] = true
+		case *ndp.RecursiveDNSServer:
+			present["rdnss"] = true
+		case *ndp.DNSSearchList:
+			present["dnssl"] = true
+		case *ndp.MTU:
+			present["mtu"] = true
+		}
+	}
+
+	for _, t := range optionTypes {
+		a.cctx.mm.AdvOptions(boolFloat(present[t]), a.cfg.Name, t)
+	}
+}
+
+// checkSize reports the size in bytes of ra on the wire, excluding the IPv6
+// header, so that router advertisements which approach the link MTU can be
+// detected before they must be fragmented.
+func (a *Advertiser) checkSize(ra *ndp.RouterAdvertisement) error {
+	b, err := ndp.MarshalMessage(ra)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate router advertisement: %v", err)
+		return fmt.Errorf("failed to marshal router advertisement: %v", err)
+	}
+
+	a.cctx.mm.AdvRouterAdvertisementSize(float64(len(b)), a.cfg.Name)
+	return nil
+}
+
+// debugOptions logs the options of ra, sent to dst, in verbose mode. Logs are
+// produced immediately when the options change, but unchanged options are
+// only logged once per debug log interval.
+func (a *Advertiser) debugOptions(ra *ndp.RouterAdvertisement, dst netaddr.IP, cfg config.Interface) {
+	if !cfg.Verbose {
+		return
+	}
+
+	s := strings.Join(optionStrings(ra.Options), "; ")
+
+	a.debugMu.Lock()
+	defer a.debugMu.Unlock()
+
+	now := a.timeNow()
+	if s == a.lastDebugOptions && now.Sub(a.lastDebugLog) < a.debugLogInterval {
+		return
+	}
+	a.lastDebugLog = now
+	a.lastDebugOptions = s
+
+	a.debugf("sent router advertisement to %s with %d option(s): [%s]", dst, len(ra.Options), s)
+}
+
+// debugDiagnostic logs m, observed from host in diagnostic mode, in verbose
+// mode. Busy links produce many such messages, so only one is logged per debug
+// log interval and the rest are only counted.
+func (a *Advertiser) debugDiagnostic(m ndp.Message, host netaddr.IP) {
+	if !a.cfg.Verbose {
+		return
+	}
+
+	a.debugMu.Lock()
+	defer a.debugMu.Unlock()
+
+	now := a.timeNow()
+	if !a.lastDiagnosticLog.IsZero() && now.Sub(a.lastDiagnosticLog) < a.debugLogInterval {
+		a.diagnosticSuppressed++
+		return
 	}
 
-	return ra, nil
+	n := a.diagnosticSuppressed
+	a.lastDiagnosticLog = now
+	a.diagnosticSuppressed = 0
+
+	a.debugf("diagnostic: observed %s from %s, %d other message(s) observed since last log", m.Type(), host, n)
 }
 
 // shutdown indicates to hosts that this host is no longer a router.
@@ -437,19 +2078,392 @@ func (a *Advertiser) shutdown(conn system.Conn) {
 	cfg := a.cfg
 	cfg.DefaultLifetime = 0
 
-	if err := a.send(conn, netaddr.IPv6LinkLocalAllNodes(), cfg); err != nil {
+	if err := a.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
 		a.logf("failed to send final multicast router advertisement: %v", err)
 	}
 }
 
+// trackConflicts updates the state of inconsistencies with the router at host
+// using the problems from its latest router advertisement. Inconsistencies
+// which persist for the conflict window are reported once, and all recent
+// inconsistencies are published for the debug API.
+func (a *Advertiser) trackConflicts(host netaddr.IP, problems []problem) {
+	now := a.timeNow()
+
+	seen := make(map[conflictKey]bool, len(problems))
+	for _, p := range problems {
+		k := conflictKey{Router: host, Field: p.Field, Details: p.Details}
+		seen[k] = true
+
+		c, ok := a.conflicts[k]
+		if !ok || now.Sub(c.Last) > a.conflictWindow {
+			// New conflict, or the router agreed with us in the meantime.
+			c = &conflict{First: now}
+			a.conflicts[k] = c
+		} else {
+			c.Duplicates++
+		}
+
+		c.Message, c.Want, c.Got = p.Message, p.Want, p.Got
+		c.Last = now
+
+		if c.Persistent || now.Sub(c.First) < a.conflictWindow {
+			continue
+		}
+
+		c.Persistent = true
+		a.logf("persistent inconsistency with router with IP %q for %s: %q: %s",
+			host, a.conflictWindow, p.Field, p.Message)
+		a.event(system.EventConflict, "persistent inconsistency with router with IP %q: %q: %s",
+			host, p.Field, p.Message)
+		a.cctx.mm.AdvPersistentInconsistenciesTotal(1.0, a.cfg.Name, p.Details, p.Field)
+	}
+
+	// Forget any conflicts this router has corrected, and any conflicts with
+	// routers which have not been observed within the window.
+	for k, c := range a.conflicts {
+		if (k.Router == host && !seen[k]) || now.Sub(c.Last) > a.conflictWindow {
+			if c.Persistent {
+				a.logf("resolved persistent inconsistency with router with IP %q: %q", k.Router, k.Field)
+			}
+
+			delete(a.conflicts, k)
+		}
+	}
+
+	// Bound the memory used by a link full of misconfigured routers by
+	// forgetting the least recently observed conflicts.
+	for len(a.conflicts) > maxConflicts {
+		var (
+			oldest conflictKey
+			last   time.Time
+		)
+		for k, c := range a.conflicts {
+			if last.IsZero() || c.Last.Before(last) {
+				oldest, last = k, c.Last
+			}
+		}
+
+		delete(a.conflicts, oldest)
+	}
+
+	cs := make([]system.Conflict, 0, len(a.conflicts))
+	for k, c := range a.conflicts {
+		cs = append(cs, system.Conflict{
+			Router:     k.Router.IPAddr().IP,
+			Field:      k.Field,
+			Details:    k.Details,
+			Message:    c.Message,
+			Ours:       c.Want,
+			Theirs:     c.Got,
+			Persistent: c.Persistent,
+			Duplicates: c.Duplicates,
+			FirstSeen:  c.First,
+			LastSeen:   c.Last,
+		})
+	}
+
+	// Produce stable output for the debug API.
+	sort.Slice(cs, func(i, j int) bool {
+		if !cs[i].Router.Equal(cs[j].Router) {
+			return cs[i].Router.String() < cs[j].Router.String()
+		}
+		if cs[i].Field != cs[j].Field {
+			return cs[i].Field < cs[j].Field
+		}
+
+		return cs[i].Details < cs[j].Details
+	})
+
+	a.cctx.state.SetRecentConflicts(a.cfg.Name, cs)
+}
+
+// mtuClamped reports that an MTU derived from the interface was less than the
+// IPv6 minimum, and that the minimum is advertised instead.
+func (a *Advertiser) mtuClamped(mtu int) {
+	a.logf("interface produces an MTU of %d, which is less than the IPv6 minimum, advertising an MTU of 1280 instead", mtu)
+	a.cctx.mm.AdvMTUClampedTotal(1.0, a.cfg.Name)
+}
+
+// lifetimeClamped reports that lifetime d exceeded the configured maximum
+// lifetime and was clamped. Each lifetime is only logged the first time it is
+// clamped.
+func (a *Advertiser) lifetimeClamped(lifetime string, d time.Duration) {
+	a.cctx.mm.AdvLifetimesClampedTotal(1.0, a.cfg.Name)
+
+	a.clampedMu.Lock()
+	defer a.clampedMu.Unlock()
+
+	if a.clamped[lifetime] {
+		return
+	}
+	a.clamped[lifetime] = true
+
+	a.logf("%s of %s exceeds max lifetime, advertising %s instead",
+		lifetime, plugin.DurationString(d), plugin.DurationString(a.cfg.MaxLifetime))
+}
+
+// checkIPv4 reports any IPv4 addresses in addrs, which belong to an interface
+// configured to be IPv6-only. Hosts on a dual-stack link may also be
+// configured by DHCPv4, which the managed and other configuration flags
+// should be consistent with.
+func (a *Advertiser) checkIPv4(addrs []net.Addr) {
+	var ips []string
+	for _, addr := range addrs {
+		ipn, ok := addr.(*net.IPNet)
+		if !ok || ipn.IP.To4() == nil {
+			continue
+		}
+
+		ips = append(ips, ipn.IP.String())
+	}
+
+	a.cctx.mm.AdvIPv4Addresses(float64(len(ips)), a.cfg.Name)
+	if len(ips) == 0 {
+		return
+	}
+
+	a.logf("WARNING: IPv6-only interface has IPv4 addresses %v, if DHCPv4 is in use verify managed (%t) and other config (%t) flags are consistent with it",
+		ips, a.cfg.Managed, a.cfg.OtherConfig)
+}
+
+// proxyWarnings reports why a router which advertises the neighbor discovery
+// proxy flag may be unable to proxy, given whether its interface is forwarding
+// IPv6 and its proxy state. proxy is nil if the state could not be detected.
+func proxyWarnings(forwarding bool, proxy *system.NDProxyState) []string {
+	var warnings []string
+	if !forwarding {
+		warnings = append(warnings,
+			"proxy flag is set but IPv6 forwarding is disabled, proxied packets will not be forwarded")
+	}
+
+	if proxy != nil && !proxy.ProxyNDP && !proxy.Promiscuous && !proxy.AllMulticast {
+		warnings = append(warnings,
+			"proxy flag is set but neither proxy_ndp nor promiscuous or all-multicast mode is enabled, neighbor discovery may not be proxied")
+	}
+
+	return warnings
+}
+
+// A neighborHopLimit is the hop limit advertised by a neighboring router,
+// which may be adopted until the router's lifetime expires.
+type neighborHopLimit struct {
+	HopLimit uint8
+	Expires  time.Time
+}
+
+// observeHopLimit records the hop limit advertised by the router at host with
+// the specified router lifetime. A router which advertises a router lifetime
+// of zero is not a default router, so its hop limit is forgotten.
+func (a *Advertiser) observeHopLimit(hopLimit uint8, lifetime time.Duration, host netaddr.IP) {
+	a.hopLimitMu.Lock()
+	defer a.hopLimitMu.Unlock()
+
+	if lifetime == 0 {
+		delete(a.hopLimits, host)
+		return
+	}
+
+	a.hopLimits[host] = neighborHopLimit{
+		HopLimit: hopLimit,
+		Expires:  a.timeNow().Add(lifetime),
+	}
+}
+
+// adoptHopLimit returns the hop limit the Advertiser should advertise in
+// place of ours: the largest hop limit advertised by a neighboring router
+// whose router lifetime has not expired, if it is larger than ours. RFC 4861
+// recommends the larger value when routers disagree. Once no neighboring
+// router advertises a larger hop limit, ours is advertised again.
+func (a *Advertiser) adoptHopLimit(ours uint8) uint8 {
+	a.hopLimitMu.Lock()
+	defer a.hopLimitMu.Unlock()
+
+	var (
+		now     = a.timeNow()
+		adopted uint8
+		from    netaddr.IP
+	)
+
+	for host, hl := range a.hopLimits {
+		if !now.Before(hl.Expires) {
+			delete(a.hopLimits, host)
+			continue
+		}
+
+		if hl.HopLimit > ours && hl.HopLimit > adopted {
+			adopted, from = hl.HopLimit, host
+		}
+	}
+
+	if adopted != a.hopLimit {
+		switch adopted {
+		case 0:
+			a.logf("no router advertises a larger hop limit, restoring advertised hop limit %d", ours)
+		default:
+			a.logf("router with IP %q advertises hop limit %d, advertising it instead of %d", from, adopted, ours)
+		}
+
+		a.hopLimit = adopted
+		a.cctx.state.SetAdoptedHopLimit(a.cfg.Name, adopted)
+	}
+
+	if adopted == 0 {
+		return ours
+	}
+
+	return adopted
+}
+
+// maxConflicts is the maximum number of conflicts with other routers tracked
+// by an Advertiser.
+const maxConflicts = 64
+
+// maxNonces is the maximum number of router solicitation nonces tracked by
+// an Advertiser.
+const maxNonces = 16
+
+// nonceEnabled reports whether the experimental nonce plugin is enabled.
+func (a *Advertiser) nonceEnabled() bool {
+	for _, p := range a.cfg.Plugins {
+		if _, ok := p.(*plugin.Nonce); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// observeNonce tracks a nonce from a router solicitation, discarding the
+// oldest nonce once maxNonces is reached.
+func (a *Advertiser) observeNonce(nonce []byte) {
+	if len(a.nonces) == maxNonces {
+		a.nonces = a.nonces[1:]
+	}
+
+	a.nonces = append(a.nonces, nonce)
+}
+
+// knownNonce reports whether nonce matches a recently observed router
+// solicitation nonce.
+func (a *Advertiser) knownNonce(nonce []byte) bool {
+	for _, n := range a.nonces {
+		if bytes.Equal(n, nonce) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // logf prints a formatted log with the Advertiser's interface name.
 func (a *Advertiser) logf(format string, v ...interface{}) {
 	a.cctx.ll.Printf(a.cfg.Name+": "+format, v...)
 }
 
+// event records a formatted event of type typ for the Advertiser's interface
+// in the event log, if configured.
+func (a *Advertiser) event(typ, format string, v ...interface{}) {
+	a.events.Add(typ, a.cfg.Name, format, v...)
+}
+
+// debugf prints a formatted debug log if verbose mode is configured.
+func (a *Advertiser) debugf(format string, v ...interface{}) {
+	if !a.cfg.Verbose {
+		return
+	}
+
+	a.logf("debug: %s", fmt.Sprintf(format, v...))
+}
+
+// optionStrings renders each NDP option as "name: value" using the String
+// method of the equivalent plugin, so that prefixes expanded from ::/N are
+// rendered like statically configured ones. Nonces are rendered without their
+// value so that they do not cause every router advertisement to appear to
+// have changed.
+func optionStrings(options []ndp.Option) []string {
+	ss := make([]string, 0, len(options))
+	for _, o := range options {
+		var p plugin.Plugin
+		switch o := o.(type) {
+		case *ndp.DNSSearchList:
+			p = &plugin.DNSSL{
+				Lifetime:    o.Lifetime,
+				DomainNames: o.DomainNames,
+			}
+		case *ndp.LinkLayerAddress:
+			lla := plugin.LLA(o.Addr)
+			p = &lla
+		case *ndp.MTU:
+			p = plugin.NewMTU(int(*o))
+		case *ndp.PrefixInformation:
+			ip, _ := netaddr.FromStdIP(o.Prefix)
+			p = &plugin.Prefix{
+				Prefix:            netaddr.IPPrefix{IP: ip, Bits: o.PrefixLength},
+				OnLink:            o.OnLink,
+				Autonomous:        o.AutonomousAddressConfiguration,
+				ValidLifetime:     o.ValidLifetime,
+				PreferredLifetime: o.PreferredLifetime,
+			}
+		case *ndp.RawOption:
+			if pi, routerAddress, ok := plugin.PrefixInformation(o); ok {
+				ip, _ := netaddr.FromStdIP(pi.Prefix)
+				p = &plugin.Prefix{
+					Prefix:            netaddr.IPPrefix{IP: ip, Bits: pi.PrefixLength},
+					OnLink:            pi.OnLink,
+					Autonomous:        pi.AutonomousAddressConfiguration,
+					RouterAddress:     routerAddress,
+					ValidLifetime:     pi.ValidLifetime,
+					PreferredLifetime: pi.PreferredLifetime,
+				}
+				break
+			}
+
+			switch o.Type {
+			case plugin.CaptivePortalType:
+				// Trim the NUL padding from the URI.
+				p = &plugin.CaptivePortal{API: strings.TrimRight(string(o.Value), "\x00")}
+			case plugin.NonceType:
+				p = &plugin.Nonce{}
+			default:
+				p = &plugin.Raw{Type: o.Type, Value: o.Value}
+			}
+		case *ndp.RecursiveDNSServer:
+			servers := make([]netaddr.IP, 0, len(o.Servers))
+			for _, s := range o.Servers {
+				ip, _ := netaddr.FromStdIP(s)
+				servers = append(servers, ip)
+			}
+
+			p = &plugin.RDNSS{
+				Lifetime: o.Lifetime,
+				Servers:  servers,
+			}
+		case *ndp.RouteInformation:
+			ip, _ := netaddr.FromStdIP(o.Prefix)
+			p = &plugin.Route{
+				Prefix:     netaddr.IPPrefix{IP: ip, Bits: o.PrefixLength},
+				Preference: o.Preference,
+				Lifetime:   o.RouteLifetime,
+			}
+		}
+
+		if p == nil {
+			// No equivalent plugin, fall back to the option's Go type.
+			ss = append(ss, fmt.Sprintf("unknown: %T", o))
+			continue
+		}
+
+		ss = append(ss, p.Name()+": "+p.String())
+	}
+
+	return ss
+}
+
 // multicastDelay selects an appropriate delay duration for unsolicited
-// multicast RA sending.
-func multicastDelay(r *rand.Rand, i int, min, max time.Duration) time.Duration {
+// multicast RA sending. The delays after the first count advertisements are
+// capped at initial.
+func multicastDelay(r *rand.Rand, i int, min, max, initial time.Duration, count int) time.Duration {
 	// Implements the algorithm described in:
 	// https://tools.ietf.org/html/rfc4861#section-6.2.4.
 
@@ -466,13 +2480,27 @@ func multicastDelay(r *rand.Rand, i int, min, max time.Duration) time.Duration {
 
 	// For first few advertisements, select a shorter wait time so routers
 	// can be discovered quickly, per the RFC.
-	if i < maxInitialAdv && d > maxInitialAdvInterval {
-		d = maxInitialAdvInterval
+	if i < count && d > initial {
+		d = initial
 	}
 
 	return d
 }
 
+// lifetimeRamp computes the router lifetime for the i-th of the first count
+// unsolicited multicast router advertisements, ramping linearly from initial
+// up to lifetime, which is advertised for every router advertisement after
+// the first count. Router lifetimes are advertised with 1 second granularity,
+// so the result is rounded down.
+func lifetimeRamp(i, count int, initial, lifetime time.Duration) time.Duration {
+	if i >= count {
+		return lifetime
+	}
+
+	d := initial + (lifetime-initial)*time.Duration(i)/time.Duration(count)
+	return d.Truncate(time.Second)
+}
+
 func panicf(format string, a ...interface{}) {
 	panic(fmt.Sprintf(format, a...))
 }
@@ -14,7 +14,9 @@
 package corerad
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -24,13 +26,18 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/mdlayher/corerad/internal/config"
 	"github.com/mdlayher/corerad/internal/crtest"
+	"github.com/mdlayher/corerad/internal/netstate"
 	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/metricslite"
@@ -561,557 +568,3014 @@ func TestAdvertiserPrometheusMetrics(t *testing.T) {
 	}
 }
 
-func Test_multicastDelay(t *testing.T) {
-	// Static seed for deterministic output.
-	r := rand.New(rand.NewSource(0))
+func TestAdvertiserTestConn(t *testing.T) {
+	t.Parallel()
 
-	tests := []struct {
-		name            string
-		i               int
-		min, max, delay time.Duration
-	}{
+	// Drive a complete Advertiser lifecycle using an in-memory transport and
+	// verify the exact sequence of router advertisements written.
+	cfg := config.Interface{
+		Name:            "test0",
+		MinInterval:     1 * time.Minute,
+		MaxInterval:     1 * time.Minute,
+		DefaultLifetime: 30 * time.Minute,
+	}
+
+	var (
+		conn = system.NewTestConn(16)
+		ifi  = &net.Interface{
+			Name:         cfg.Name,
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		}
+
+		ts   = system.TestState{Forwarding: true}
+		cctx = NewContext(nil, NewMetrics(metricslite.NewMemory(), ts, nil), ts)
+	)
+
+	ad := NewAdvertiser(
+		cctx,
+		cfg,
+		system.NewTestDialer(conn, ifi, net.IPv6loopback),
+		nil,
+		func() bool { return true },
+	)
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		if err := ad.Run(ctx); err != nil {
+			return fmt.Errorf("failed to advertise: %v", err)
+		}
+
+		return nil
+	})
+
+	var (
+		allNodes = net.IPv6linklocalallnodes
+		host     = mustNetIP("fe80::1")
+	)
+
+	// next returns the next RA written to dst, skipping any others.
+	next := func(dst net.IP) system.TestMessage {
+		for {
+			if m := <-conn.Writes(); m.IP.Equal(dst) {
+				return m
+			}
+		}
+	}
+
+	// Initial multicast RA, a solicited unicast RA, then the final
+	// multicast RA on shutdown.
+	got := []system.TestMessage{next(allNodes)}
+
+	conn.Inject(system.TestMessage{
+		Message: &ndp.RouterSolicitation{},
+		IP:      host,
+	})
+	got = append(got, next(host))
+
+	cancel()
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to stop advertiser: %v", err)
+	}
+
+	// The final RA must be the last one written.
+	var final system.TestMessage
+	for len(conn.Writes()) > 0 {
+		final = <-conn.Writes()
+	}
+	got = append(got, final)
+
+	want := []system.TestMessage{
 		{
-			name:  "static",
-			min:   1 * time.Second,
-			max:   1 * time.Second,
-			delay: 1 * time.Second,
+			Message: &ndp.RouterAdvertisement{RouterLifetime: 30 * time.Minute},
+			IP:      allNodes,
 		},
 		{
-			name:  "random",
-			min:   1 * time.Second,
-			max:   10 * time.Second,
-			delay: 5 * time.Second,
+			Message: &ndp.RouterAdvertisement{RouterLifetime: 30 * time.Minute},
+			IP:      host,
 		},
 		{
-			name: "clamped",
-			// Delay too long for low i value.
-			i:     1,
-			min:   30 * time.Second,
-			max:   60 * time.Second,
-			delay: maxInitialAdvInterval,
+			Message: &ndp.RouterAdvertisement{},
+			IP:      allNodes,
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected router advertisements (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserSourceLLAOverride(t *testing.T) {
+	t.Parallel()
+
+	override := net.HardwareAddr{0x02, 0x00, 0x5e, 0x00, 0x53, 0x01}
+
+	cfg := config.Interface{
+		Name:              "test0",
+		MinInterval:       1 * time.Minute,
+		MaxInterval:       1 * time.Minute,
+		SourceLLAOverride: override,
+		Plugins:           []plugin.Plugin{&plugin.LLA{}},
+	}
+
+	var (
+		conn = system.NewTestConn(16)
+		ifi  = &net.Interface{
+			Name:         cfg.Name,
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		}
+
+		ts   = system.TestState{Forwarding: true}
+		cctx = NewContext(nil, NewMetrics(metricslite.NewMemory(), ts, nil), ts)
+	)
+
+	ad := NewAdvertiser(
+		cctx,
+		cfg,
+		system.NewTestDialer(conn, ifi, net.IPv6loopback),
+		nil,
+		func() bool { return true },
+	)
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		if err := ad.Run(ctx); err != nil {
+			return fmt.Errorf("failed to advertise: %v", err)
+		}
+
+		return nil
+	})
+
+	// The initial multicast RA carries the override rather than the
+	// interface's hardware address.
+	got := (<-conn.Writes()).Message
+
+	cancel()
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to stop advertiser: %v", err)
+	}
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{&ndp.LinkLayerAddress{
+			Direction: ndp.Source,
+			Addr:      override,
+		}},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserMTUClamp(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name:        "test0",
+		MinInterval: 1 * time.Minute,
+		MaxInterval: 1 * time.Minute,
+		Plugins:     []plugin.Plugin{&plugin.TunnelMTU{Overhead: 80}},
+	}
+
+	var (
+		conn = system.NewTestConn(16)
+		// A misbehaving tool shrank the interface MTU.
+		ifi = &net.Interface{Name: cfg.Name, MTU: 1300}
+
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+	)
+
+	ad := NewAdvertiser(
+		NewContext(nil, mm, ts),
+		cfg,
+		system.NewTestDialer(conn, ifi, net.IPv6loopback),
+		nil,
+		func() bool { return true },
+	)
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		if err := ad.Run(ctx); err != nil {
+			return fmt.Errorf("failed to advertise: %v", err)
+		}
+
+		return nil
+	})
+
+	// The IPv6 minimum MTU is advertised instead.
+	got := (<-conn.Writes()).Message
+
+	cancel()
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to stop advertiser: %v", err)
+	}
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{ndp.NewMTU(1280)},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+
+	wantM := metricslite.Series{
+		Name:    advMTUClamped,
+		Samples: map[string]float64{"interface=test0": 1},
+	}
+
+	if diff := cmp.Diff(wantM, findMetric(t, mm, advMTUClamped)); diff != "" {
+		t.Fatalf("unexpected MTU clamped metric (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserSolicitedUnspecified(t *testing.T) {
+	skipShort(t)
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		separate bool
+		check    func(t *testing.T, d time.Duration)
+	}{
+		{
+			name: "shared",
+			check: func(t *testing.T, d time.Duration) {
+				// Allow a bit of variance in the delay time due to timers.
+				if min := testMinDelayBetweenRAs - 10*time.Millisecond; d < min {
+					t.Fatalf("delay too short for shared multicast RA: %s", d)
+				}
+			},
 		},
 		{
-			name: "not clamped",
-			// Delay appropriate for high i value.
-			i:     100,
-			min:   30 * time.Second,
-			max:   60 * time.Second,
-			delay: 54 * time.Second,
+			name:     "separate",
+			separate: true,
+			check: func(t *testing.T, d time.Duration) {
+				if max := testMinDelayBetweenRAs / 2; d > max {
+					t.Fatalf("delay too long for separate multicast RA: %s", d)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Interface{
+				Name:        "test0",
+				MinInterval: 1 * time.Minute,
+				MaxInterval: 1 * time.Minute,
+
+				SeparateSolicitedMulticast: tt.separate,
+			}
+
+			var (
+				conn = system.NewTestConn(16)
+				ifi  = &net.Interface{Name: cfg.Name}
+				ts   = system.TestState{Forwarding: true}
+				cctx = NewContext(nil, NewMetrics(metricslite.NewMemory(), ts, nil), ts)
+			)
+
+			ad := NewAdvertiser(
+				cctx,
+				cfg,
+				system.NewTestDialer(conn, ifi, net.IPv6loopback),
+				nil,
+				func() bool { return true },
+			)
+			ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var eg errgroup.Group
+			eg.Go(func() error {
+				if err := ad.Run(ctx); err != nil {
+					return fmt.Errorf("failed to advertise: %v", err)
+				}
+
+				return nil
+			})
+
+			// Wait for the initial multicast RA, and then solicit from the
+			// unspecified address which must produce a multicast RA.
+			allNodes := net.IPv6linklocalallnodes
+			if m := <-conn.Writes(); !m.IP.Equal(allNodes) {
+				t.Fatalf("unexpected initial RA destination: %s", m.IP)
+			}
+
+			start := time.Now()
+			conn.Inject(system.TestMessage{
+				Message: &ndp.RouterSolicitation{},
+				IP:      net.IPv6unspecified,
+			})
+
+			m := <-conn.Writes()
+			d := time.Since(start)
+			if !m.IP.Equal(allNodes) {
+				t.Fatalf("unexpected solicited RA destination: %s", m.IP)
+			}
+
+			tt.check(t, d)
+
+			cancel()
+			if err := eg.Wait(); err != nil {
+				t.Fatalf("failed to stop advertiser: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdvertiserHandleNonce(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name:    "test0",
+		Plugins: []plugin.Plugin{&plugin.Nonce{}},
+	}
+
+	var (
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+
+		host  = crtest.MustIP("fe80::1")
+		nonce = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	)
+
+	// A router solicitation's nonce must be echoed in the response.
+	req, err := ad.handle(&ndp.RouterSolicitation{
+		Options: []ndp.Option{plugin.NewNonceOption(nonce)},
+	}, host)
+	if err != nil {
+		t.Fatalf("failed to handle RS: %v", err)
+	}
+
+	if diff := cmp.Diff(&request{IP: host, Nonce: nonce, Solicited: true}, req, cmp.Comparer(compareNetaddrIP)); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+
+	// Router advertisements with a known nonce are fine, but an unknown
+	// nonce is reported as a mismatch.
+	for _, n := range [][]byte{nonce, {0xff, 0xff, 0xff, 0xff, 0xff, 0xff}} {
+		_, err := ad.handle(&ndp.RouterAdvertisement{
+			Options: []ndp.Option{plugin.NewNonceOption(n)},
+		}, crtest.MustIP("fe80::2"))
+		if err != nil {
+			t.Fatalf("failed to handle RA: %v", err)
+		}
+	}
+
+	want := metricslite.Series{
+		Name: advNonceMismatches,
+		Samples: map[string]float64{
+			"interface=test0": 1,
+		},
+	}
+
+	if diff := cmp.Diff(want, findMetric(t, mm, advNonceMismatches)); diff != "" {
+		t.Fatalf("unexpected nonce mismatch metric (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserConflicts(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name:     "test0",
+		HopLimit: 64,
+		Plugins:  []plugin.Plugin{plugin.NewMTU(1500)},
+	}
+
+	var (
+		ts = system.TestState{
+			Forwarding: true,
+			Conflicts:  make(map[string][]system.Conflict),
+		}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+
+		host  = crtest.MustIP("fe80::2")
+		epoch = time.Unix(0, 0)
+		now   time.Time
+	)
+
+	ad.conflictWindow = 10 * time.Second
+	ad.timeNow = func() time.Time { return now }
+
+	// Send an RA from another router at the specified offset from epoch,
+	// optionally with an inconsistent MTU.
+	send := func(offset int, inconsistent bool) {
+		t.Helper()
+
+		mtu := 1500
+		if inconsistent {
+			mtu = 1280
+		}
+
+		now = epoch.Add(time.Duration(offset) * time.Second)
+		_, err := ad.handle(&ndp.RouterAdvertisement{
+			CurrentHopLimit: 64,
+			Options:         []ndp.Option{ndp.NewMTU(uint32(mtu))},
+		}, host)
+		if err != nil {
+			t.Fatalf("failed to handle RA: %v", err)
+		}
+	}
+
+	// A momentary inconsistency which is quickly corrected is not persistent,
+	// but is still published as a recent conflict.
+	send(0, true)
+	send(5, true)
+	send(6, false)
+	send(7, true)
+
+	want := []system.Conflict{{
+		Router:    net.ParseIP("fe80::2"),
+		Field:     "mtu",
+		Message:   "want: 1500, got: 1280",
+		Ours:      "1500",
+		Theirs:    "1280",
+		FirstSeen: epoch.Add(7 * time.Second),
+		LastSeen:  epoch.Add(7 * time.Second),
+	}}
+
+	if diff := cmp.Diff(want, ts.Conflicts["test0"]); diff != "" {
+		t.Fatalf("unexpected recent conflicts (-want +got):\n%s", diff)
+	}
+
+	// Once the inconsistency lasts for the window, it is persistent and only
+	// reported once, with further observations counted as duplicates.
+	send(17, true)
+	send(18, true)
+
+	want[0].Persistent = true
+	want[0].Duplicates = 2
+	want[0].LastSeen = epoch.Add(18 * time.Second)
+
+	if diff := cmp.Diff(want, ts.Conflicts["test0"]); diff != "" {
+		t.Fatalf("unexpected persistent conflicts (-want +got):\n%s", diff)
+	}
+
+	wantM := metricslite.Series{
+		Name: advPersistent,
+		Samples: map[string]float64{
+			"interface=test0,details=,field=mtu": 1,
+		},
+	}
+
+	if diff := cmp.Diff(wantM, findMetric(t, mm, advPersistent)); diff != "" {
+		t.Fatalf("unexpected persistent inconsistencies metric (-want +got):\n%s", diff)
+	}
+
+	// The router corrects itself.
+	send(19, false)
+
+	if l := len(ts.Conflicts["test0"]); l != 0 {
+		t.Fatalf("expected no conflicts after correction, but got: %d", l)
+	}
+}
+
+func TestAdvertiserConflictsBounded(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name:     "test0",
+		HopLimit: 64,
+	}
+
+	var (
+		ts = system.TestState{
+			Forwarding: true,
+			Conflicts:  make(map[string][]system.Conflict),
+		}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+
+		epoch = time.Unix(0, 0)
+		now   time.Time
+	)
+
+	ad.timeNow = func() time.Time { return now }
+
+	// Each router sends an inconsistent hop limit. Only the most recently
+	// observed routers are tracked once the limit is reached.
+	for i := 0; i < maxConflicts+2; i++ {
+		now = epoch.Add(time.Duration(i) * time.Millisecond)
+		host := crtest.MustIP(fmt.Sprintf("fe80::%x", i+1))
+
+		if _, err := ad.handle(&ndp.RouterAdvertisement{CurrentHopLimit: 1}, host); err != nil {
+			t.Fatalf("failed to handle RA: %v", err)
+		}
+	}
+
+	cs := ts.Conflicts["test0"]
+	if diff := cmp.Diff(maxConflicts, len(cs)); diff != "" {
+		t.Fatalf("unexpected number of conflicts (-want +got):\n%s", diff)
+	}
+
+	for _, c := range cs {
+		if c.LastSeen.Before(epoch.Add(2 * time.Millisecond)) {
+			t.Fatalf("expected oldest conflicts to be evicted, but found: %+v", c)
+		}
+	}
+}
+
+func TestAdvertiserAdoptNeighborHopLimit(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name:                  "test0",
+		HopLimit:              64,
+		AdoptNeighborHopLimit: true,
+	}
+
+	var (
+		ts = system.TestState{
+			Forwarding: true,
+			HopLimits:  make(map[string]uint8),
+		}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+
+		now = time.Unix(1, 0)
+	)
+
+	ad.timeNow = func() time.Time { return now }
+
+	handle := func(hl uint8, lifetime time.Duration, host string) {
+		t.Helper()
+
+		ra := &ndp.RouterAdvertisement{
+			CurrentHopLimit: hl,
+			RouterLifetime:  lifetime,
+		}
+
+		if _, err := ad.handle(ra, crtest.MustIP(host)); err != nil {
+			t.Fatalf("failed to handle RA: %v", err)
+		}
+	}
+
+	check := func(want uint8) *ndp.RouterAdvertisement {
+		t.Helper()
+
+		ra, _, err := ad.buildRA(cfg, config.UnsolicitedSet)
+		if err != nil {
+			t.Fatalf("failed to build RA: %v", err)
+		}
+
+		if diff := cmp.Diff(want, ra.CurrentHopLimit); diff != "" {
+			t.Fatalf("unexpected hop limit (-want +got):\n%s", diff)
+		}
+
+		// Only an adopted hop limit is published.
+		var published uint8
+		if want != cfg.HopLimit {
+			published = want
+		}
+
+		if diff := cmp.Diff(published, ts.HopLimits["test0"]); diff != "" {
+			t.Fatalf("unexpected published hop limit (-want +got):\n%s", diff)
+		}
+
+		return ra
+	}
+
+	// Only larger hop limits are adopted, and the largest observed wins.
+	handle(32, 30*time.Minute, "fe80::2")
+	handle(128, 10*time.Minute, "fe80::3")
+	handle(96, 30*time.Minute, "fe80::4")
+
+	ra := check(128)
+
+	// Once adopted, the neighbor's advertisements are consistent with ours.
+	want := []problem(nil)
+	if diff := cmp.Diff(want, verifyRAs(ra, &ndp.RouterAdvertisement{CurrentHopLimit: 128})); diff != "" {
+		t.Fatalf("unexpected problems (-want +got):\n%s", diff)
+	}
+
+	// Once the largest hop limit expires with its router's lifetime, the next
+	// largest is adopted.
+	now = now.Add(10 * time.Minute)
+	check(96)
+
+	// A router which is no longer a default router is forgotten, and then our
+	// own hop limit is advertised again.
+	handle(96, 0, "fe80::4")
+	check(64)
+
+	// A hop limit which expires without being replaced also restores our own.
+	handle(128, 1*time.Minute, "fe80::3")
+	check(128)
+
+	now = now.Add(1 * time.Minute)
+	check(64)
+}
+
+func TestAdvertiserHandleDiagnostic(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf bytes.Buffer
+		now = time.Unix(0, 0)
+		ts  = system.TestState{Forwarding: true}
+		mm  = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad  = NewAdvertiser(
+			NewContext(log.New(&buf, "", 0), mm, ts),
+			config.Interface{Name: "test0", Verbose: true},
+			nil, nil, nil,
+		)
+	)
+
+	ad.timeNow = func() time.Time { return now }
+
+	// Diagnostic messages are observed but never produce a response, and
+	// messages from any number of hosts share the same timeseries.
+	for i, m := range []ndp.Message{
+		&ndp.NeighborSolicitation{},
+		&ndp.NeighborAdvertisement{},
+		&ndp.NeighborAdvertisement{},
+		&ndp.NeighborSolicitation{},
+	} {
+		if i == 3 {
+			// The debug log interval elapsed.
+			now = now.Add(debugLogInterval)
+		}
+
+		req, err := ad.handle(m, crtest.MustIP(fmt.Sprintf("fe80::%d", i+1)))
+		if err != nil {
+			t.Fatalf("failed to handle message: %v", err)
+		}
+		if req != nil {
+			t.Fatalf("unexpected request for %T: %#v", m, req)
+		}
+	}
+
+	want := metricslite.Series{
+		Name: advDiagnostic,
+		Samples: map[string]float64{
+			"interface=test0,message=neighbor solicitation":  2,
+			"interface=test0,message=neighbor advertisement": 2,
+		},
+	}
+
+	if diff := cmp.Diff(want, findMetric(t, mm, advDiagnostic)); diff != "" {
+		t.Fatalf("unexpected diagnostic metric (-want +got):\n%s", diff)
+	}
+
+	// Only one message is logged per debug log interval.
+	wantLogs := []string{
+		"test0: debug: diagnostic: observed neighbor solicitation from fe80::1, 0 other message(s) observed since last log",
+		"test0: debug: diagnostic: observed neighbor solicitation from fe80::4, 2 other message(s) observed since last log",
+	}
+
+	if diff := cmp.Diff(wantLogs, strings.Split(strings.TrimSpace(buf.String()), "\n")); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+
+	// No messages should be considered invalid.
+	if l := len(findMetric(t, mm, msgInvalid).Samples); l != 0 {
+		t.Fatalf("diagnostic messages were reported as invalid: %d", l)
+	}
+}
+
+func TestAdvertiserHandleSelfLoop(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name:     "test0",
+		HopLimit: 64,
+	}
+
+	var (
+		ts = system.TestState{
+			Forwarding: true,
+			Conflicts:  make(map[string][]system.Conflict),
+		}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+
+		self   = net.HardwareAddr{0x02, 0x00, 0x5e, 0x00, 0x53, 0x01}
+		remote = net.HardwareAddr{0x02, 0x00, 0x5e, 0x00, 0x53, 0x02}
+	)
+
+	ad.setSelf(net.ParseIP("fe80::1"), self)
+
+	ra := func(mac net.HardwareAddr) *ndp.RouterAdvertisement {
+		// An inconsistent hop limit would be a conflict if the router
+		// advertisement was not our own.
+		return &ndp.RouterAdvertisement{
+			CurrentHopLimit: 1,
+			Options: []ndp.Option{&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      mac,
+			}},
+		}
+	}
+
+	// Our own router advertisement is looped back, identified by its source
+	// address and its source link-layer address, if any.
+	for _, m := range []*ndp.RouterAdvertisement{
+		ra(self),
+		{CurrentHopLimit: 1},
+	} {
+		if _, err := ad.handle(m, crtest.MustIP("fe80::1")); err != nil {
+			t.Fatalf("failed to handle RA: %v", err)
+		}
+	}
+
+	if l := len(ts.Conflicts["test0"]); l != 0 {
+		t.Fatalf("expected no conflicts for looped back RAs, but got: %d", l)
+	}
+
+	want := map[string]float64{"interface=test0": 2}
+	if diff := cmp.Diff(want, findMetric(t, mm, advSelfLoops).Samples); diff != "" {
+		t.Fatalf("unexpected self loops metric (-want +got):\n%s", diff)
+	}
+
+	// Other routers' router advertisements are still checked, including those
+	// which share our source link-layer address, such as a VRRP virtual MAC.
+	for _, m := range []struct {
+		ra   *ndp.RouterAdvertisement
+		host netaddr.IP
+	}{
+		{ra: ra(remote), host: crtest.MustIP("fe80::2")},
+		{ra: ra(self), host: crtest.MustIP("fe80::3")},
+	} {
+		if _, err := ad.handle(m.ra, m.host); err != nil {
+			t.Fatalf("failed to handle RA: %v", err)
+		}
+	}
+
+	if l := len(ts.Conflicts["test0"]); l != 2 {
+		t.Fatalf("expected two conflicts for remote RAs, but got: %d", l)
+	}
+}
+
+func TestAdvertiserSendSolicitedOnlyLLA(t *testing.T) {
+	t.Parallel()
+
+	lla := &ndp.LinkLayerAddress{
+		Direction: ndp.Source,
+		Addr:      net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+	}
+
+	tests := []struct {
+		name          string
+		solicitedOnly bool
+		req           request
+		opts          []ndp.Option
+	}{
+		{
+			name: "unsolicited",
+			req:  request{IP: netaddr.IPv6LinkLocalAllNodes()},
+			opts: []ndp.Option{ndp.NewMTU(1500), lla},
+		},
+		{
+			name:          "unsolicited solicited only",
+			solicitedOnly: true,
+			req:           request{IP: netaddr.IPv6LinkLocalAllNodes()},
+			opts:          []ndp.Option{ndp.NewMTU(1500)},
+		},
+		{
+			name:          "solicited solicited only",
+			solicitedOnly: true,
+			req:           request{IP: crtest.MustIP("fe80::1"), Solicited: true},
+			opts:          []ndp.Option{ndp.NewMTU(1500), lla},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Interface{
+				Name: "test0",
+				Plugins: []plugin.Plugin{
+					plugin.NewMTU(1500),
+					&plugin.LLA{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+				},
+				SolicitedOnlyLLA: tt.solicitedOnly,
+			}
+
+			var (
+				ts   = system.TestState{Forwarding: true}
+				mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+				ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+				conn = system.NewTestConn(1)
+			)
+
+			if err := ad.send(conn, tt.req, cfg); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+
+			ra := (<-conn.Writes()).Message.(*ndp.RouterAdvertisement)
+			if diff := cmp.Diff(tt.opts, ra.Options); diff != "" {
+				t.Fatalf("unexpected options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAdvertiserSendPluginSets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		req  request
+		mtu  int
+	}{
+		{
+			name: "unsolicited",
+			req:  request{IP: netaddr.IPv6LinkLocalAllNodes()},
+			mtu:  1280,
+		},
+		{
+			name: "solicited",
+			req:  request{IP: crtest.MustIP("fe80::1"), Solicited: true},
+			mtu:  1500,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Interface{
+				Name:               "test0",
+				Plugins:            []plugin.Plugin{plugin.NewMTU(9000)},
+				SolicitedPlugins:   []plugin.Plugin{plugin.NewMTU(1500)},
+				UnsolicitedPlugins: []plugin.Plugin{plugin.NewMTU(1280)},
+			}
+
+			var (
+				ts   = system.TestState{Forwarding: true}
+				mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+				ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+				conn = system.NewTestConn(1)
+			)
+
+			if err := ad.send(conn, tt.req, cfg); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+
+			ra := (<-conn.Writes()).Message.(*ndp.RouterAdvertisement)
+			if diff := cmp.Diff([]ndp.Option{ndp.NewMTU(uint32(tt.mtu))}, ra.Options); diff != "" {
+				t.Fatalf("unexpected options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAdvertiserSendEmptyPrefixes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		addrs    []net.Addr
+		prefixes float64
+		empty    map[string]float64
+		logs     int
+	}{
+		{
+			name: "expanded",
+			addrs: []net.Addr{&net.IPNet{
+				IP:   net.ParseIP("2001:db8::1"),
+				Mask: net.CIDRMask(64, 128),
+			}},
+			prefixes: 2,
+		},
+		{
+			name: "empty",
+			addrs: []net.Addr{&net.IPNet{
+				IP:   net.ParseIP("fe80::1"),
+				Mask: net.CIDRMask(64, 128),
+			}},
+			prefixes: 1,
+			empty: map[string]float64{
+				"interface=test0,prefix=::/64": 2,
+			},
+			logs: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Interface{
+				Name: "test0",
+				Plugins: []plugin.Plugin{
+					&plugin.Prefix{
+						Prefix: crtest.MustIPPrefix("::/64"),
+						Addrs:  func() ([]net.Addr, error) { return tt.addrs, nil },
+					},
+					&plugin.Prefix{
+						Prefix: crtest.MustIPPrefix("2001:db8:ffff::/64"),
+					},
+				},
+			}
+
+			var (
+				buf  bytes.Buffer
+				ts   = system.TestState{Forwarding: true}
+				mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+				ad   = NewAdvertiser(NewContext(log.New(&buf, "", 0), mm, ts), cfg, nil, nil, nil)
+				conn = system.NewTestConn(2)
+			)
+
+			// Send twice; the second log is suppressed by rate limiting.
+			for i := 0; i < 2; i++ {
+				if err := ad.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
+					t.Fatalf("failed to send: %v", err)
+				}
+			}
+
+			wantP := metricslite.Series{
+				Name:    advPrefixes,
+				Samples: map[string]float64{"interface=test0": tt.prefixes},
+			}
+
+			if diff := cmp.Diff(wantP, findMetric(t, mm, advPrefixes)); diff != "" {
+				t.Fatalf("unexpected prefixes metric (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.empty, findMetric(t, mm, advPrefixesEmpty).Samples, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatalf("unexpected empty prefixes metric (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.logs, strings.Count(buf.String(), "matched no prefixes")); diff != "" {
+				t.Fatalf("unexpected number of logs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAdvertiserSendOptionsMetric(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Interface{
+		Name: "test0",
+		Plugins: []plugin.Plugin{
+			plugin.NewMTU(1500),
+			&plugin.RDNSS{
+				Lifetime: 10 * time.Second,
+				Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+			},
+		},
+	}
+
+	var (
+		ts   = system.TestState{Forwarding: true}
+		mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(1)
+	)
+
+	if err := ad.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	want := metricslite.Series{
+		Name: advOptions,
+		Samples: map[string]float64{
+			"interface=test0,option=dnssl":  0,
+			"interface=test0,option=mtu":    1,
+			"interface=test0,option=prefix": 0,
+			"interface=test0,option=rdnss":  1,
+			"interface=test0,option=route":  0,
+		},
+	}
+
+	if diff := cmp.Diff(want, findMetric(t, mm, advOptions)); diff != "" {
+		t.Fatalf("unexpected options metric (-want +got):\n%s", diff)
+	}
+
+	// 16 bytes of header, 8 bytes of MTU, and 24 bytes of RDNSS.
+	wantSize := map[string]float64{"interface=test0": 48}
+	if diff := cmp.Diff(wantSize, findMetric(t, mm, advRASize).Samples); diff != "" {
+		t.Fatalf("unexpected size metric (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserSendDebugOptions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		prefix = &plugin.Prefix{
+			Prefix: crtest.MustIPPrefix("::/64"),
+			Addrs: func() ([]net.Addr, error) {
+				return []net.Addr{&net.IPNet{
+					IP:   net.ParseIP("2001:db8::1"),
+					Mask: net.CIDRMask(64, 128),
+				}}, nil
+			},
+			OnLink:            true,
+			ValidLifetime:     10 * time.Minute,
+			PreferredLifetime: 5 * time.Minute,
+		}
+
+		cfg = config.Interface{
+			Name:    "test0",
+			Verbose: true,
+			Plugins: []plugin.Plugin{prefix, plugin.NewMTU(1500)},
+		}
+
+		buf  bytes.Buffer
+		now  = time.Unix(0, 0)
+		ts   = system.TestState{Forwarding: true}
+		ad   = NewAdvertiser(NewContext(log.New(&buf, "", 0), nil, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(5)
+	)
+
+	ad.timeNow = func() time.Time { return now }
+
+	send := func(cfg config.Interface) {
+		t.Helper()
+
+		if err := ad.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	// Logged, then suppressed until either the options change or the debug
+	// log interval elapses.
+	send(cfg)
+	send(cfg)
+
+	// The options changed.
+	changed := cfg
+	changed.Plugins = []plugin.Plugin{prefix}
+	send(changed)
+
+	// The interval elapsed.
+	now = now.Add(debugLogInterval)
+	send(changed)
+
+	// Verbose mode disabled.
+	quiet := changed
+	quiet.Verbose = false
+	now = now.Add(debugLogInterval)
+	send(quiet)
+
+	want := []string{
+		"test0: debug: sent router advertisement to ff02::1 with 2 option(s): " +
+			"[prefix: 2001:db8::/64 [on-link], preferred: 5m0s, valid: 10m0s; mtu: MTU: 1500]",
+		"test0: debug: sent router advertisement to ff02::1 with 1 option(s): " +
+			"[prefix: 2001:db8::/64 [on-link], preferred: 5m0s, valid: 10m0s]",
+		"test0: debug: sent router advertisement to ff02::1 with 1 option(s): " +
+			"[prefix: 2001:db8::/64 [on-link], preferred: 5m0s, valid: 10m0s]",
+	}
+
+	if diff := cmp.Diff(want, strings.Split(strings.TrimSpace(buf.String()), "\n")); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+}
+
+func Test_optionStrings(t *testing.T) {
+	t.Parallel()
+
+	options := []ndp.Option{
+		&ndp.RouteInformation{
+			PrefixLength:  48,
+			Preference:    ndp.High,
+			RouteLifetime: time.Hour,
+			Prefix:        net.ParseIP("2001:db8::"),
+		},
+		&ndp.RecursiveDNSServer{
+			Lifetime: time.Minute,
+			Servers:  []net.IP{net.ParseIP("2001:db8::53")},
+		},
+		&ndp.DNSSearchList{
+			Lifetime:    time.Minute,
+			DomainNames: []string{"lan.example.com"},
+		},
+		plugin.NewNonceOption([]byte{1, 2, 3, 4, 5, 6}),
+		&ndp.LinkLayerAddress{
+			Direction: ndp.Source,
+			Addr:      net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		},
+		plugin.RouterAddressOption(&ndp.PrefixInformation{
+			PrefixLength:                   64,
+			OnLink:                         true,
+			AutonomousAddressConfiguration: true,
+			ValidLifetime:                  ndp.Infinity,
+			PreferredLifetime:              4 * time.Hour,
+			Prefix:                         net.ParseIP("2001:db8::1"),
+		}),
+	}
+
+	want := []string{
+		"route: 2001:db8::/48, preference: High, lifetime: 1h0m0s",
+		"rdnss: servers: [2001:db8::53], lifetime: 1m0s",
+		"dnssl: domain names: [lan.example.com], lifetime: 1m0s",
+		"nonce: random nonce per advertisement",
+		"lla: source link-layer address: de:ad:be:ef:de:ad",
+		"prefix: 2001:db8::1/64 [on-link, autonomous, router address], preferred: 4h0m0s, valid: infinite",
+	}
+
+	if diff := cmp.Diff(want, optionStrings(options)); diff != "" {
+		t.Fatalf("unexpected option strings (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserAdvertise(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ts = system.TestState{Forwarding: true}
+		ad = NewAdvertiser(NewContext(nil, nil, ts), config.Interface{Name: "test0"}, nil, nil, nil)
+	)
+
+	if _, err := ad.Advertise(); err == nil {
+		t.Fatal("expected an error for an advertiser which is not running")
+	}
+
+	// A multicast RA was just sent, so the request must be rate limited.
+	atomic.StoreInt64(ad.lastMulticast, time.Now().UnixNano())
+
+	retry, err := ad.Advertise()
+	if err != nil {
+		t.Fatalf("failed to advertise: %v", err)
+	}
+	if retry <= 0 || retry > ad.minDelayBetweenRAs {
+		t.Fatalf("unexpected retry duration: %s", retry)
+	}
+
+	// Enough time has passed, so the request must be accepted.
+	atomic.StoreInt64(ad.lastMulticast, time.Now().Add(-ad.minDelayBetweenRAs).UnixNano())
+
+	retry, err = ad.Advertise()
+	if err != nil {
+		t.Fatalf("failed to advertise: %v", err)
+	}
+	if retry != 0 {
+		t.Fatalf("expected no retry duration, but got: %s", retry)
+	}
+
+	want := request{IP: netaddr.IPv6LinkLocalAllNodes()}
+	if diff := cmp.Diff(want, <-ad.triggerC, cmp.Comparer(compareNetaddrIP)); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+
+	// Unicast-only advertisers never send multicast RAs.
+	ad = NewAdvertiser(NewContext(nil, nil, ts), config.Interface{Name: "test0", UnicastOnly: true}, nil, nil, nil)
+	if _, err := ad.Advertise(); err == nil {
+		t.Fatal("expected an error for a unicast-only advertiser")
+	}
+}
+
+func TestAdvertiserSendRetry(t *testing.T) {
+	t.Parallel()
+
+	errWrite := errors.New("write failed")
+
+	tests := []struct {
+		name              string
+		retries, failures int
+		ok                bool
+		samples           map[string]float64
+	}{
+		{
+			name:     "no retries",
+			failures: 1,
+			samples: map[string]float64{
+				"interface=test0,error=transmit": 1,
+			},
+		},
+		{
+			name:     "transient",
+			retries:  3,
+			failures: 2,
+			ok:       true,
+			samples: map[string]float64{
+				"interface=test0,error=transmit_retry": 2,
+			},
+		},
+		{
+			name:     "exhausted",
+			retries:  2,
+			failures: 10,
+			samples: map[string]float64{
+				"interface=test0,error=transmit_retry": 2,
+				"interface=test0,error=transmit":       1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Interface{
+				Name:            "test0",
+				TransmitRetries: tt.retries,
+			}
+
+			var (
+				ts   = system.TestState{Forwarding: true}
+				mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+				ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+				conn = &failConn{
+					TestConn: system.NewTestConn(1),
+					failures: tt.failures,
+					err:      errWrite,
+				}
+			)
+
+			err := ad.sendWorker(context.Background(), conn, request{IP: netaddr.IPv6LinkLocalAllNodes()})
+			if tt.ok && err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, errWrite) {
+				t.Fatalf("expected write error, but got: %v", err)
+			}
+
+			if tt.ok {
+				if _, ok := (<-conn.Writes()).Message.(*ndp.RouterAdvertisement); !ok {
+					t.Fatal("expected a router advertisement to be written")
+				}
+			}
+
+			want := metricslite.Series{
+				Name:    "corerad_advertiser_errors_total",
+				Samples: tt.samples,
+			}
+
+			if diff := cmp.Diff(want, findMetric(t, mm, want.Name)); diff != "" {
+				t.Fatalf("unexpected errors metric (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// A failConn is a system.TestConn which returns an error for a fixed number
+// of WriteTo calls before succeeding.
+type failConn struct {
+	*system.TestConn
+
+	mu       sync.Mutex
+	failures int
+	err      error
+}
+
+func (c *failConn) WriteTo(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures > 0 {
+		c.failures--
+		return c.err
+	}
+
+	return c.TestConn.WriteTo(m, cm, dst)
+}
+
+func TestAdvertiserSourceAddressUnavailable(t *testing.T) {
+	t.Parallel()
+
+	// The link-local source address disappears before the initial RA can be
+	// sent, and must be re-resolved rather than halting the advertiser.
+	var (
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+
+		conn = &failConn{
+			TestConn: system.NewTestConn(16),
+			failures: 1,
+			err:      os.NewSyscallError("sendmsg", syscall.EADDRNOTAVAIL),
+		}
+
+		cfg = config.Interface{
+			Name:        "test0",
+			MinInterval: 1 * time.Second,
+			MaxInterval: 1 * time.Second,
+		}
+	)
+
+	ad := NewAdvertiser(
+		NewContext(nil, mm, ts),
+		cfg,
+		system.NewTestDialer(conn, &net.Interface{Name: cfg.Name}, net.IPv6loopback),
+		nil,
+		func() bool { return true },
+	)
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		if err := ad.Run(ctx); err != nil {
+			return fmt.Errorf("failed to advertise: %v", err)
+		}
+
+		return nil
+	})
+
+	// The advertiser must recover and send its initial RA.
+	select {
+	case m := <-conn.Writes():
+		if _, ok := m.Message.(*ndp.RouterAdvertisement); !ok {
+			t.Fatalf("expected a router advertisement, but got: %#v", m.Message)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for router advertisement")
+	}
+
+	want := metricslite.Series{
+		Name:    advSourceResolutions,
+		Samples: map[string]float64{"interface=test0": 1},
+	}
+
+	if diff := cmp.Diff(want, findMetric(t, mm, advSourceResolutions)); diff != "" {
+		t.Fatalf("unexpected source address resolutions metric (-want +got):\n%s", diff)
+	}
+
+	// Drain any further RAs so the advertiser can shut down.
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-conn.Writes():
+			case <-done:
+				return
+			}
+		}
+	}()
+	defer close(done)
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to stop advertiser: %v", err)
+	}
+}
+
+func Test_multicastDelay(t *testing.T) {
+	// Static seed for deterministic output.
+	r := rand.New(rand.NewSource(0))
+
+	tests := []struct {
+		name            string
+		i               int
+		min, max, delay time.Duration
+	}{
+		{
+			name:  "static",
+			min:   1 * time.Second,
+			max:   1 * time.Second,
+			delay: 1 * time.Second,
+		},
+		{
+			name:  "random",
+			min:   1 * time.Second,
+			max:   10 * time.Second,
+			delay: 5 * time.Second,
+		},
+		{
+			name: "clamped",
+			// Delay too long for low i value.
+			i:     1,
+			min:   30 * time.Second,
+			max:   60 * time.Second,
+			delay: maxInitialAdvInterval,
+		},
+		{
+			name: "not clamped",
+			// Delay appropriate for high i value.
+			i:     100,
+			min:   30 * time.Second,
+			max:   60 * time.Second,
+			delay: 54 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := multicastDelay(r, tt.i, tt.min, tt.max, maxInitialAdvInterval, maxInitialAdv)
+			if diff := cmp.Diff(tt.delay, d); diff != "" {
+				t.Fatalf("unexpected delay (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_lifetimeRamp(t *testing.T) {
+	tests := []struct {
+		name              string
+		count             int
+		initial, lifetime time.Duration
+		lifetimes         []time.Duration
+	}{
+		{
+			name:     "RFC defaults",
+			count:    maxInitialAdv,
+			initial:  1 * time.Minute,
+			lifetime: 30 * time.Minute,
+			lifetimes: []time.Duration{
+				1 * time.Minute,
+				640 * time.Second,
+				1220 * time.Second,
+				30 * time.Minute,
+				30 * time.Minute,
+			},
+		},
+		{
+			name:     "truncated",
+			count:    4,
+			initial:  1 * time.Second,
+			lifetime: 10 * time.Second,
+			lifetimes: []time.Duration{
+				1 * time.Second,
+				3 * time.Second,
+				5 * time.Second,
+				7 * time.Second,
+				10 * time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lifetimes []time.Duration
+			for i := range tt.lifetimes {
+				lifetimes = append(lifetimes, lifetimeRamp(i, tt.count, tt.initial, tt.lifetime))
+			}
+
+			if diff := cmp.Diff(tt.lifetimes, lifetimes); diff != "" {
+				t.Fatalf("unexpected lifetimes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_multicastDelayFastStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  time.Duration
+		count    int
+		min, max time.Duration
+		delays   []time.Duration
+	}{
+		{
+			name:    "RFC defaults",
+			initial: maxInitialAdvInterval,
+			count:   maxInitialAdv,
+			min:     1 * time.Minute,
+			max:     1 * time.Minute,
+			delays: []time.Duration{
+				16 * time.Second, 16 * time.Second, 16 * time.Second,
+				1 * time.Minute, 1 * time.Minute, 1 * time.Minute,
+			},
+		},
+		{
+			name:    "faster and longer",
+			initial: 4 * time.Second,
+			count:   5,
+			min:     1 * time.Minute,
+			max:     1 * time.Minute,
+			delays: []time.Duration{
+				4 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second,
+				1 * time.Minute,
+			},
+		},
+		{
+			name:    "slower and shorter",
+			initial: 30 * time.Second,
+			count:   1,
+			min:     1 * time.Minute,
+			max:     1 * time.Minute,
+			delays: []time.Duration{
+				30 * time.Second,
+				1 * time.Minute, 1 * time.Minute, 1 * time.Minute, 1 * time.Minute, 1 * time.Minute,
+			},
+		},
+		{
+			name:    "steady state shorter than initial",
+			initial: 30 * time.Second,
+			count:   3,
+			min:     10 * time.Second,
+			max:     10 * time.Second,
+			delays: []time.Duration{
+				10 * time.Second, 10 * time.Second, 10 * time.Second,
+				10 * time.Second, 10 * time.Second, 10 * time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+
+			delays := make([]time.Duration, 0, len(tt.delays))
+			for i := range tt.delays {
+				delays = append(delays, multicastDelay(r, i, tt.min, tt.max, tt.initial, tt.count))
+			}
+
+			if diff := cmp.Diff(tt.delays, delays); diff != "" {
+				t.Fatalf("unexpected fast start delays (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func testSimulatedAdvertiserClient(
+	t *testing.T,
+	cfg *config.Interface,
+	tcfg *testConfig,
+	fn func(cancel func(), cctx *clientContext),
+) func() {
+	if cfg == nil {
+		cfg = &config.Interface{}
+	}
+
+	if tcfg == nil {
+		tcfg = &testConfig{}
+	}
+	if tcfg.terminate == nil {
+		// Assume a complete termination.
+		tcfg.terminate = func() bool { return true }
+	}
+
+	// Fixed interval for multicast advertisements.
+	cfg.MinInterval = 1 * time.Second
+	cfg.MaxInterval = 1 * time.Second
+	cfg.Name = "test0"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Swap out the underlying connections for a UDP socket pair.
+	sc, cc, cDone := testConnPair(t)
+
+	ts := system.TestState{Forwarding: true}
+	mm := NewMetrics(metricslite.NewMemory(), ts, []config.Interface{*cfg})
+
+	crctx := NewContext(log.New(os.Stderr, "", 0), mm, ts)
+
+	ad := NewAdvertiser(
+		crctx,
+		*cfg,
+		&system.Dialer{
+			DialFunc: func() (*system.DialContext, error) {
+				// The router's addresses differ from the client's, so the
+				// client's router advertisements are not mistaken for the
+				// router's own.
+				return &system.DialContext{
+					Conn: sc,
+					Interface: &net.Interface{
+						Name:         cfg.Name,
+						HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x5e, 0x00, 0x53, 0x01},
+					},
+					IP: net.ParseIP("fe80::1"),
+				}, nil
+			},
+		},
+		nil,
+		tcfg.terminate,
+	)
+
+	// Override RFC parameters to speed up tests.
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	if tcfg.onInconsistentRA != nil {
+		ad.OnInconsistentRA = tcfg.onInconsistentRA
+	}
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		if err := ad.Run(ctx); err != nil {
+			return fmt.Errorf("failed to advertise: %v", err)
+		}
+
+		return nil
+	})
+
+	cctx := &clientContext{
+		c: cc,
+		rs: &ndp.RouterSolicitation{
+			Options: []ndp.Option{&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			}},
+		},
+		router: &net.Interface{Name: cfg.Name},
+		mm:     mm,
+	}
+
+	// Run the advertiser and invoke the client's input function with some
+	// context for the test, while also allowing the client to cancel the
+	// advertiser run loop.
+	fn(cancel, cctx)
+
+	done := func() {
+		cancel()
+		if err := eg.Wait(); err != nil {
+			t.Fatalf("failed to stop advertiser: %v", err)
+		}
+
+		cDone()
+	}
+
+	return done
+}
+
+func testConnPair(t *testing.T) (system.Conn, system.Conn, func()) {
+	sc, err := net.ListenPacket("udp6", ":0")
+	if err != nil {
+		t.Fatalf("failed to create server peer: %v", err)
+	}
+
+	cc, err := net.ListenPacket("udp6", ":0")
+	if err != nil {
+		t.Fatalf("failed to create client peer: %v", err)
+	}
+
+	// Set up a simulated client/server pair.
+
+	server := &udpConn{
+		ControlMessage: &ipv6.ControlMessage{HopLimit: ndp.HopLimit},
+		peer:           cc.LocalAddr(),
+		pc:             sc,
+	}
+
+	client := &udpConn{
+		ControlMessage: &ipv6.ControlMessage{HopLimit: ndp.HopLimit},
+		peer:           sc.LocalAddr(),
+		pc:             cc,
+	}
+
+	return server, client, func() {
+		if err := sc.Close(); err != nil {
+			t.Fatalf("failed to close server: %v", err)
+		}
+		if err := cc.Close(); err != nil {
+			t.Fatalf("failed to close client: %v", err)
+		}
+	}
+}
+
+type udpConn struct {
+	ControlMessage *ipv6.ControlMessage
+
+	peer net.Addr
+	pc   net.PacketConn
+}
+
+var _ system.Conn = &udpConn{}
+
+func (c *udpConn) Close() error { return c.pc.Close() }
+
+func (c *udpConn) ReadFrom() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+	b := make([]byte, 1024)
+	n, addr, err := c.pc.ReadFrom(b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	m, err := ndp.ParseMessage(b[:n])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return m, c.ControlMessage, addr.(*net.UDPAddr).IP, nil
+}
+
+func (c *udpConn) SetReadDeadline(t time.Time) error { return c.pc.SetReadDeadline(t) }
+
+func (c *udpConn) WriteTo(m ndp.Message, _ *ipv6.ControlMessage, _ net.IP) error {
+	b, err := ndp.MarshalMessage(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.pc.WriteTo(b, c.peer)
+	return err
+}
+
+func testAdvertiser(t *testing.T, cfg *config.Interface, tcfg *testConfig) (*Advertiser, *clientContext, func()) {
+	t.Helper()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping, this test only runs on Linux")
+	}
+
+	skipUnprivileged(t)
+
+	if tcfg == nil {
+		tcfg = &testConfig{}
+	}
+	if tcfg.terminate == nil {
+		// Assume a complete termination.
+		tcfg.terminate = func() bool { return true }
+	}
+
+	var (
+		r     = rand.New(rand.NewSource(time.Now().UnixNano()))
+		veth0 = fmt.Sprintf("cradveth%d", r.Intn(65535))
+		veth1 = fmt.Sprintf("cradveth%d", r.Intn(65535))
+	)
+
+	// Set up a temporary veth pair in the appropriate state for use with
+	// the tests.
+	// TODO: use rtnetlink.
+	shell(t, "ip", "link", "add", veth0, "type", "veth", "peer", "name", veth1)
+	mustSysctl(t, veth0, "accept_dad", "0")
+	mustSysctl(t, veth1, "accept_dad", "0")
+	mustSysctl(t, veth0, "forwarding", "1")
+
+	if tcfg.vethConfig != nil {
+		tcfg.vethConfig(t, veth0, veth1)
+	}
+
+	shell(t, "ip", "link", "set", "up", veth0)
+	shell(t, "ip", "link", "set", "up", veth1)
+
+	// Make sure the interfaces are up and ready.
+	waitInterfacesReady(t, veth0, veth1)
+
+	// Allow empty config but always populate the interface name.
+	// TODO: consider building veth pairs within the tests.
+	if cfg == nil {
+		cfg = &config.Interface{}
+	}
+	// Fixed interval for multicast advertisements.
+	cfg.MinInterval = 1 * time.Second
+	cfg.MaxInterval = 1 * time.Second
+	cfg.Name = veth0
+
+	router, err := net.InterfaceByName(veth0)
+	if err != nil {
+		t.Fatalf("failed to look up router veth: %v", err)
+	}
+
+	client, err := net.InterfaceByName(veth1)
+	if err != nil {
+		t.Fatalf("failed to look up client veth: %v", err)
+	}
+
+	ll := log.New(os.Stderr, "", 0)
+	state := system.NewState()
+	mm := NewMetrics(metricslite.NewMemory(), state, []config.Interface{*cfg})
+
+	crctx := NewContext(ll, mm, state)
+
+	ad := NewAdvertiser(
+		crctx,
+		*cfg,
+		system.NewDialer(router.Name, state, system.Advertise, ll),
+		nil,
+		tcfg.terminate,
+	)
+
+	// Override RFC parameters to speed up tests.
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	if tcfg.onInconsistentRA != nil {
+		ad.OnInconsistentRA = tcfg.onInconsistentRA
+	}
+
+	cconn, _, err := ndp.Dial(client, ndp.LinkLocal)
+	if err != nil {
+		t.Fatalf("failed to dial client connection: %v", err)
+	}
+
+	// Only accept RAs.
+	var f ipv6.ICMPFilter
+	f.SetAll(true)
+	f.Accept(ipv6.ICMPTypeRouterAdvertisement)
+
+	if err := cconn.SetICMPFilter(&f); err != nil {
+		t.Fatalf("failed to apply ICMPv6 filter: %v", err)
+	}
+
+	// Enable inspection of IPv6 control messages.
+	flags := ipv6.FlagHopLimit | ipv6.FlagDst
+	if err := cconn.SetControlMessage(flags, true); err != nil {
+		t.Fatalf("failed to apply IPv6 control message flags: %v", err)
+	}
+
+	if err := cconn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatalf("failed to set client read deadline: %v", err)
+	}
+
+	cctx := &clientContext{
+		c: cconn,
+		rs: &ndp.RouterSolicitation{
+			Options: []ndp.Option{&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      client.HardwareAddr,
+			}},
+		},
+		router: router,
+		client: client,
+		mm:     mm,
+	}
+
+	done := func() {
+		if err := cconn.Close(); err != nil {
+			t.Fatalf("failed to close NDP router solicitation connection: %v", err)
+		}
+
+		// Clean up the veth pair.
+		shell(t, "ip", "link", "del", veth0)
+	}
+
+	return ad, cctx, done
+}
+
+// testAdvertiserClient is a wrapper around testAdvertiser which focuses on
+// client interactions rather than server interactions.
+func testAdvertiserClient(
+	t *testing.T,
+	cfg *config.Interface,
+	tcfg *testConfig,
+	fn func(cancel func(), cctx *clientContext),
+) func() {
+	t.Helper()
+
+	ad, cctx, adDone := testAdvertiser(t, cfg, tcfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		if err := ad.Run(ctx); err != nil {
+			return fmt.Errorf("failed to advertise: %v", err)
+		}
+
+		return nil
+	})
+
+	// Run the advertiser and invoke the client's input function with some
+	// context for the test, while also allowing the client to cancel the
+	// advertiser run loop.
+	fn(cancel, cctx)
+
+	done := func() {
+		cancel()
+		if err := eg.Wait(); err != nil {
+			t.Fatalf("failed to stop advertiser: %v", err)
+		}
+
+		adDone()
+	}
+
+	return done
+}
+
+func waitInterfacesReady(t *testing.T, ifi0, ifi1 string) {
+	t.Helper()
+
+	a, err := net.InterfaceByName(ifi0)
+	if err != nil {
+		t.Fatalf("failed to get first interface: %v", err)
+	}
+
+	b, err := net.InterfaceByName(ifi1)
+	if err != nil {
+		t.Fatalf("failed to get second interface: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			time.Sleep(1 * time.Second)
+			t.Log("waiting for interface readiness...")
+		}
+
+		aaddrs, err := a.Addrs()
+		if err != nil {
+			t.Fatalf("failed to get first addresses: %v", err)
+		}
+
+		baddrs, err := b.Addrs()
+		if err != nil {
+			t.Fatalf("failed to get second addresses: %v", err)
+		}
+
+		if len(aaddrs) == 0 || len(baddrs) == 0 {
+			// No addresses yet.
+			continue
+		}
+
+		// Do we have a link-local address assigned to each interface, and
+		// can we bind to that address?
+		if !linkLocalReady(t, aaddrs, ifi0) || !linkLocalReady(t, baddrs, ifi1) {
+			continue
+		}
+
+		return
+	}
+
+	t.Fatal("failed to wait for interface readiness")
+}
+
+func linkLocalReady(t *testing.T, addrs []net.Addr, zone string) bool {
+	t.Helper()
+
+	for _, a := range addrs {
+		ip, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		if ip.IP.To16() == nil || ip.IP.To4() != nil || !ip.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		// We've found a link-local IPv6 address. Try to bind a random socket to
+		// it to verify the address is ready for use.
+		addr := &net.UDPAddr{
+			IP:   ip.IP,
+			Port: 0,
+			Zone: zone,
+		}
+
+		l, err := net.ListenPacket("udp", addr.String())
+		if err != nil {
+			return false
+		}
+		_ = l.Close()
+
+		t.Logf("ready: %s", addr.String())
+
+		return true
+	}
+
+	return false
+}
+
+func skipShort(t *testing.T) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+}
+
+func skipUnprivileged(t *testing.T) {
+	const ifName = "cradprobe0"
+	shell(t, "ip", "tuntap", "add", ifName, "mode", "tun")
+	shell(t, "ip", "link", "del", ifName)
+}
+
+func shell(t *testing.T, name string, arg ...string) {
+	t.Helper()
+
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		t.Fatalf("failed to look up binary path: %v", err)
+	}
+
+	t.Logf("$ %s %v", bin, arg)
+
+	cmd := exec.Command(bin, arg...)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start command %q: %v", name, err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		// Shell operations in these tests require elevated privileges.
+		if cmd.ProcessState.ExitCode() == int(unix.EPERM) {
+			t.Skipf("skipping, permission denied: %v", err)
+		}
+
+		t.Fatalf("failed to wait for command %q: %v", name, err)
+	}
+}
+
+func mustSysctl(t *testing.T, iface, key, value string) {
+	t.Helper()
+
+	file := filepath.Join(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s", iface), key)
+
+	t.Logf("sysctl %q = %q", file, value)
+
+	if err := ioutil.WriteFile(file, []byte(value), 0o644); err != nil {
+		t.Fatalf("failed to write sysctl %s/%s: %v", iface, key, err)
+	}
+}
+
+func mustNetIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		panicf("failed to parse %q as IP address", s)
+	}
+
+	return ip
+}
+
+func findMetric(t *testing.T, mm *Metrics, name string) metricslite.Series {
+	t.Helper()
+
+	series, ok := mm.Series()
+	if !ok {
+		t.Fatalf("metrics node does not support Series output: %T", mm)
+	}
+
+	for sname, ts := range series {
+		// Filter to only return the specified metric.
+		if sname != name {
+			continue
+		}
+
+		// Remove the help string for easier diffing.
+		ts.Help = ""
+		return ts
+	}
+
+	t.Fatalf("no metric with name %q was found", name)
+	panic("unreachable")
+}
+
+func compareNetaddrIP(x, y netaddr.IP) bool { return x == y }
+
+func TestAdvertiserWithdraw(t *testing.T) {
+	t.Parallel()
+
+	var (
+		cfg = config.Interface{
+			Name:            "test0",
+			StartWithdrawn:  true,
+			DefaultLifetime: 30 * time.Minute,
+			Plugins: []plugin.Plugin{
+				&plugin.Prefix{
+					Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+					OnLink:            true,
+					Autonomous:        true,
+					ValidLifetime:     10 * time.Minute,
+					PreferredLifetime: 5 * time.Minute,
+				},
+				plugin.NewMTU(1500),
+			},
+		}
+
+		ts   = system.TestState{Forwarding: true}
+		ad   = NewAdvertiser(NewContext(nil, nil, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(2)
+	)
+
+	send := func() *ndp.RouterAdvertisement {
+		t.Helper()
+
+		if err := ad.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+
+		return (<-conn.Writes()).Message.(*ndp.RouterAdvertisement)
+	}
+
+	// Withdrawn on start: not a default router and no prefixes.
+	if !ad.Withdrawn() {
+		t.Fatal("advertiser did not start withdrawn")
+	}
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{ndp.NewMTU(1500)},
+	}
+
+	if diff := cmp.Diff(want, send()); diff != "" {
+		t.Fatalf("unexpected withdrawn RA (-want +got):\n%s", diff)
+	}
+
+	// Promoted: the configured parameters are advertised. The advertiser is
+	// not running, so no router advertisement is triggered.
+	ad.Withdraw(false)
+	if ad.Withdrawn() {
+		t.Fatal("advertiser was not promoted")
+	}
+
+	want = &ndp.RouterAdvertisement{
+		RouterLifetime: 30 * time.Minute,
+		Options: []ndp.Option{
+			&ndp.PrefixInformation{
+				PrefixLength:                   64,
+				OnLink:                         true,
+				AutonomousAddressConfiguration: true,
+				ValidLifetime:                  10 * time.Minute,
+				PreferredLifetime:              5 * time.Minute,
+				Prefix:                         net.ParseIP("2001:db8::"),
+			},
+			ndp.NewMTU(1500),
+		},
+	}
+
+	if diff := cmp.Diff(want, send()); diff != "" {
+		t.Fatalf("unexpected promoted RA (-want +got):\n%s", diff)
+	}
+
+	select {
+	case req := <-ad.triggerC:
+		t.Fatalf("unexpected triggered request: %+v", req)
+	case <-ad.fastStartC:
+		t.Fatal("unexpected fast start")
+	default:
+	}
+
+	// Withdrawn while running: a router advertisement is triggered, but the
+	// initial advertisements are not restarted.
+	atomic.StoreInt64(ad.lastMulticast, time.Now().UnixNano())
+	ad.Withdraw(true)
+
+	wantReq := request{IP: netaddr.IPv6LinkLocalAllNodes()}
+	if diff := cmp.Diff(wantReq, <-ad.triggerC, cmp.Comparer(compareNetaddrIP)); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+
+	select {
+	case <-ad.fastStartC:
+		t.Fatal("unexpected fast start on withdrawal")
+	default:
+	}
+
+	// Promoted while running: a router advertisement is triggered and the
+	// initial advertisements are restarted.
+	ad.Withdraw(false)
+
+	if diff := cmp.Diff(wantReq, <-ad.triggerC, cmp.Comparer(compareNetaddrIP)); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+
+	select {
+	case <-ad.fastStartC:
+	default:
+		t.Fatal("initial advertisements were not restarted on promotion")
+	}
+}
+
+func TestAdvertiserCordon(t *testing.T) {
+	t.Parallel()
+
+	var (
+		cfg = config.Interface{
+			Name:            "test0",
+			DefaultLifetime: 30 * time.Minute,
+			Plugins: []plugin.Plugin{
+				&plugin.Prefix{
+					Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+					OnLink:            true,
+					Autonomous:        true,
+					ValidLifetime:     10 * time.Minute,
+					PreferredLifetime: 5 * time.Minute,
+				},
+			},
+		}
+
+		ts   = system.TestState{Forwarding: true}
+		mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(1)
+		now  = time.Unix(0, 0)
+	)
+
+	ad.timeNow = func() time.Time { return now }
+	ad.events = system.NewEventLog(8)
+
+	// Cordoned: not a default router, but prefixes are retained.
+	if retry := ad.Cordon(true); retry != 0 {
+		t.Fatalf("unexpected retry for first cordon: %s", retry)
+	}
+	if !ad.Cordoned() {
+		t.Fatal("advertiser was not cordoned")
+	}
+
+	if err := ad.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{
+			&ndp.PrefixInformation{
+				PrefixLength:                   64,
+				OnLink:                         true,
+				AutonomousAddressConfiguration: true,
+				ValidLifetime:                  10 * time.Minute,
+				PreferredLifetime:              5 * time.Minute,
+				Prefix:                         net.ParseIP("2001:db8::"),
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, (<-conn.Writes()).Message); diff != "" {
+		t.Fatalf("unexpected cordoned RA (-want +got):\n%s", diff)
+	}
+
+	// Repeating the current state is not a change, but a quick toggle is
+	// debounced.
+	if retry := ad.Cordon(true); retry != 0 {
+		t.Fatalf("unexpected retry for repeated cordon: %s", retry)
+	}
+
+	now = now.Add(4 * time.Second)
+	if diff := cmp.Diff(minCordonInterval-4*time.Second, ad.Cordon(false)); diff != "" {
+		t.Fatalf("unexpected retry for debounced uncordon (-want +got):\n%s", diff)
+	}
+	if !ad.Cordoned() {
+		t.Fatal("debounced uncordon changed state")
+	}
+
+	now = now.Add(minCordonInterval)
+	if retry := ad.Cordon(false); retry != 0 {
+		t.Fatalf("unexpected retry for uncordon: %s", retry)
+	}
+	if ad.Cordoned() {
+		t.Fatal("advertiser was not uncordoned")
+	}
+
+	wantM := metricslite.Series{
+		Name:    advCordoned,
+		Samples: map[string]float64{"interface=test0": 0},
+	}
+
+	if diff := cmp.Diff(wantM, findMetric(t, mm, advCordoned)); diff != "" {
+		t.Fatalf("unexpected cordoned metric (-want +got):\n%s", diff)
+	}
+
+	// Only actual state changes are recorded as events.
+	var events []string
+	for _, e := range ad.events.Events() {
+		events = append(events, fmt.Sprintf("%s: %s: %s", e.Type, e.Interface, e.Message))
+	}
+
+	wantE := []string{
+		"cordon: test0: cordoned",
+		"cordon: test0: uncordoned",
+	}
+
+	if diff := cmp.Diff(wantE, events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserDebugFlags(t *testing.T) {
+	t.Parallel()
+
+	var (
+		cfg  = config.Interface{Name: "test0", DefaultLifetime: 30 * time.Minute}
+		ts   = system.TestState{Forwarding: true}
+		mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(1)
+	)
+
+	ad.debugFlags = []string{"home_agent", "proxy"}
+
+	if err := ad.send(conn, request{IP: netaddr.IPv6LinkLocalAllNodes()}, cfg); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	want := &ndp.RouterAdvertisement{
+		RouterSelectionPreference: ndp.Medium,
+		RouterLifetime:            30 * time.Minute,
+		MobileIPv6HomeAgent:       true,
+		NeighborDiscoveryProxy:    true,
+	}
+
+	if diff := cmp.Diff(want, (<-conn.Writes()).Message); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+
+	got := findMetric(t, mm, advDebugFlags)
+	if diff := cmp.Diff(map[string]float64{"interface=test0": 1}, got.Samples); diff != "" {
+		t.Fatalf("unexpected debug flags metric (-want +got):\n%s", diff)
+	}
+}
+
+func TestAdvertiserDebugMulticastGroup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		req  request
+		dst  netaddr.IP
+		cm   *ipv6.ControlMessage
+		sent float64
+	}{
+		{
+			name: "multicast",
+			req:  request{IP: netaddr.IPv6LinkLocalAllNodes()},
+			dst:  crtest.MustIP("ff05::1"),
+			cm:   &ipv6.ControlMessage{HopLimit: 8},
+			sent: 1,
+		},
+		{
+			name: "unicast",
+			req:  request{IP: crtest.MustIP("fe80::1"), Solicited: true},
+			dst:  crtest.MustIP("fe80::1"),
 		},
 	}
 
 	for _, tt := range tests {
+		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			d := multicastDelay(r, tt.i, tt.min, tt.max)
-			if diff := cmp.Diff(tt.delay, d); diff != "" {
-				t.Fatalf("unexpected delay (-want +got):\n%s", diff)
-			}
-		})
-	}
-}
+			t.Parallel()
 
-func testSimulatedAdvertiserClient(
-	t *testing.T,
-	cfg *config.Interface,
-	tcfg *testConfig,
-	fn func(cancel func(), cctx *clientContext),
-) func() {
-	if cfg == nil {
-		cfg = &config.Interface{}
-	}
+			var (
+				cfg  = config.Interface{Name: "test0"}
+				ts   = system.TestState{Forwarding: true}
+				mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+				ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+				conn = system.NewTestConn(1)
+			)
 
-	if tcfg == nil {
-		tcfg = &testConfig{}
-	}
-	if tcfg.terminate == nil {
-		// Assume a complete termination.
-		tcfg.terminate = func() bool { return true }
-	}
+			ad.debugGroup, ad.debugHopLimit = crtest.MustIP("ff05::1"), 8
 
-	// Fixed interval for multicast advertisements.
-	cfg.MinInterval = 1 * time.Second
-	cfg.MaxInterval = 1 * time.Second
-	cfg.Name = "test0"
+			if err := ad.send(conn, tt.req, cfg); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+			m := <-conn.Writes()
+			if diff := cmp.Diff(tt.dst.IPAddr().IP, m.IP); diff != "" {
+				t.Fatalf("unexpected destination (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.cm, m.ControlMessage); diff != "" {
+				t.Fatalf("unexpected control message (-want +got):\n%s", diff)
+			}
 
-	// Swap out the underlying connections for a UDP socket pair.
-	sc, cc, cDone := testConnPair(t)
+			got := findMetric(t, mm, advDebugMulticast)
+			var want map[string]float64
+			if tt.sent > 0 {
+				want = map[string]float64{"interface=test0": tt.sent}
+			}
+			if diff := cmp.Diff(want, got.Samples, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatalf("unexpected debug multicast metric (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
 
-	ts := system.TestState{Forwarding: true}
-	mm := NewMetrics(metricslite.NewMemory(), ts, []config.Interface{*cfg})
+func TestAdvertiserRouterLifetimeRamp(t *testing.T) {
+	t.Parallel()
 
-	crctx := NewContext(log.New(os.Stderr, "", 0), mm, ts)
+	var (
+		cfg = config.Interface{
+			Name:                   "test0",
+			InitialCount:           3,
+			DefaultLifetime:        30 * time.Minute,
+			InitialDefaultLifetime: 1 * time.Minute,
+		}
+		ts   = system.TestState{Forwarding: true}
+		ad   = NewAdvertiser(NewContext(nil, nil, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(1)
+	)
 
-	ad := NewAdvertiser(
-		crctx,
-		*cfg,
-		&system.Dialer{
-			DialFunc: func() (*system.DialContext, error) {
-				return &system.DialContext{
-					Conn: sc,
-					Interface: &net.Interface{
-						Name:         cfg.Name,
-						HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
-					},
-					IP: net.IPv6loopback,
-				}, nil
-			},
-		},
-		nil,
-		tcfg.terminate,
+	var (
+		unsolicited = request{IP: netaddr.IPv6LinkLocalAllNodes()}
+		solicited   = request{IP: crtest.MustIP("fe80::1"), Solicited: true}
 	)
 
-	// Override RFC parameters to speed up tests.
-	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+	send := func(req request, want time.Duration) {
+		t.Helper()
 
-	if tcfg.onInconsistentRA != nil {
-		ad.OnInconsistentRA = tcfg.onInconsistentRA
-	}
+		if err := ad.send(conn, req, cfg); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
 
-	var eg errgroup.Group
-	eg.Go(func() error {
-		if err := ad.Run(ctx); err != nil {
-			return fmt.Errorf("failed to advertise: %v", err)
+		ra := (<-conn.Writes()).Message.(*ndp.RouterAdvertisement)
+		if diff := cmp.Diff(want, ra.RouterLifetime); diff != "" {
+			t.Fatalf("unexpected router lifetime (-want +got):\n%s", diff)
 		}
+	}
 
-		return nil
-	})
+	// Solicited router advertisements carry the current router lifetime, but
+	// only unsolicited ones advance the ramp.
+	send(unsolicited, 1*time.Minute)
+	send(solicited, 640*time.Second)
+	send(unsolicited, 640*time.Second)
+	send(unsolicited, 1220*time.Second)
 
-	cctx := &clientContext{
-		c: cc,
-		rs: &ndp.RouterSolicitation{
-			Options: []ndp.Option{&ndp.LinkLayerAddress{
-				Direction: ndp.Source,
-				Addr:      net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
-			}},
-		},
-		router: &net.Interface{Name: cfg.Name},
-		mm:     mm,
+	if lifetime, ramping := ad.RouterLifetime(); lifetime != 30*time.Minute || ramping {
+		t.Fatalf("expected ramp to be complete, but got: %s, %t", lifetime, ramping)
 	}
 
-	// Run the advertiser and invoke the client's input function with some
-	// context for the test, while also allowing the client to cancel the
-	// advertiser run loop.
-	fn(cancel, cctx)
+	send(unsolicited, 30*time.Minute)
+	send(solicited, 30*time.Minute)
 
-	done := func() {
-		cancel()
-		if err := eg.Wait(); err != nil {
-			t.Fatalf("failed to stop advertiser: %v", err)
-		}
+	// Promotion restarts the ramp.
+	ad.Withdraw(true)
+	send(unsolicited, 0)
+	ad.Withdraw(false)
 
-		cDone()
+	if lifetime, ramping := ad.RouterLifetime(); lifetime != 1*time.Minute || !ramping {
+		t.Fatalf("expected ramp to restart, but got: %s, %t", lifetime, ramping)
 	}
 
-	return done
+	send(unsolicited, 1*time.Minute)
 }
 
-func testConnPair(t *testing.T) (system.Conn, system.Conn, func()) {
-	sc, err := net.ListenPacket("udp6", ":0")
-	if err != nil {
-		t.Fatalf("failed to create server peer: %v", err)
-	}
+func TestAdvertiserSettleLink(t *testing.T) {
+	t.Parallel()
 
-	cc, err := net.ListenPacket("udp6", ":0")
-	if err != nil {
-		t.Fatalf("failed to create client peer: %v", err)
-	}
+	var (
+		cfg    = config.Interface{Name: "test0", TrackLinkState: true}
+		ts     = system.TestState{Forwarding: true}
+		mm     = NewMetrics(metricslite.NewMemory(), ts, nil)
+		watchC = make(chan netstate.Change, 1)
+		ad     = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, watchC, nil)
+	)
 
-	// Set up a simulated client/server pair.
+	ad.linkHysteresis = 50 * time.Millisecond
 
-	server := &udpConn{
-		ControlMessage: &ipv6.ControlMessage{HopLimit: ndp.HopLimit},
-		peer:           cc.LocalAddr(),
-		pc:             sc,
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A link down event from before the link came up is stale, so the link
+	// settles.
+	watchC <- netstate.LinkDown
+	if err := ad.settleLink(ctx); err != nil {
+		t.Fatalf("failed to settle link: %v", err)
+	}
+	if diff := cmp.Diff("up", ad.LinkState()); diff != "" {
+		t.Fatalf("unexpected link state (-want +got):\n%s", diff)
 	}
 
-	client := &udpConn{
-		ControlMessage: &ipv6.ControlMessage{HopLimit: ndp.HopLimit},
-		peer:           sc.LocalAddr(),
-		pc:             cc,
+	// The link goes down again before it settles.
+	time.AfterFunc(10*time.Millisecond, func() { watchC <- netstate.LinkDown })
+	ad.linkHysteresis = 5 * time.Second
+	if err := ad.settleLink(ctx); !errors.Is(err, system.ErrLinkChange) {
+		t.Fatalf("expected link change, but got: %v", err)
+	}
+	if diff := cmp.Diff("down", ad.LinkState()); diff != "" {
+		t.Fatalf("unexpected link state (-want +got):\n%s", diff)
 	}
 
-	return server, client, func() {
-		if err := sc.Close(); err != nil {
-			t.Fatalf("failed to close server: %v", err)
-		}
-		if err := cc.Close(); err != nil {
-			t.Fatalf("failed to close client: %v", err)
-		}
+	want := map[string]float64{
+		"interface=test0,state=settling": 2,
+		"interface=test0,state=up":       1,
+		"interface=test0,state=down":     1,
+	}
+
+	got := findMetric(t, mm, advLinkTransitions)
+	if diff := cmp.Diff(want, got.Samples); diff != "" {
+		t.Fatalf("unexpected link transitions metric (-want +got):\n%s", diff)
 	}
 }
 
-type udpConn struct {
-	ControlMessage *ipv6.ControlMessage
+func TestAdvertiserWaiting(t *testing.T) {
+	t.Parallel()
 
-	peer net.Addr
-	pc   net.PacketConn
-}
+	var (
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), config.Interface{Name: "test0"}, nil, nil, nil)
+	)
 
-var _ system.Conn = &udpConn{}
+	check := func(waiting bool) {
+		t.Helper()
 
-func (c *udpConn) Close() error { return c.pc.Close() }
+		if diff := cmp.Diff(waiting, ad.Waiting()); diff != "" {
+			t.Fatalf("unexpected waiting state (-want +got):\n%s", diff)
+		}
 
-func (c *udpConn) ReadFrom() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
-	b := make([]byte, 1024)
-	n, addr, err := c.pc.ReadFrom(b)
-	if err != nil {
-		return nil, nil, nil, err
+		want := metricslite.Series{
+			Name:    advInterfaceWaiting,
+			Samples: map[string]float64{"interface=test0": boolFloat(waiting)},
+		}
+		if diff := cmp.Diff(want, findMetric(t, mm, advInterfaceWaiting)); diff != "" {
+			t.Fatalf("unexpected waiting metric (-want +got):\n%s", diff)
+		}
 	}
 
-	m, err := ndp.ParseMessage(b[:n])
-	if err != nil {
-		return nil, nil, nil, err
+	// The interface does not exist at first, and is created later. The
+	// Advertiser no longer waits, but the server has been notified that it
+	// waited at least once.
+	ad.wait(true)
+	check(true)
+	ad.wait(false)
+	check(false)
+
+	select {
+	case <-ad.waitC:
+	default:
+		t.Fatal("wait channel was not closed")
 	}
-
-	return m, c.ControlMessage, addr.(*net.UDPAddr).IP, nil
 }
 
-func (c *udpConn) SetReadDeadline(t time.Time) error { return c.pc.SetReadDeadline(t) }
+func TestAdvertiserMulticastMinimumDelay(t *testing.T) {
+	t.Parallel()
 
-func (c *udpConn) WriteTo(m ndp.Message, _ *ipv6.ControlMessage, _ net.IP) error {
-	b, err := ndp.MarshalMessage(m)
-	if err != nil {
-		return err
+	// An interval far below the minimum delay between multicast RAs, which
+	// configuration validation would normally reject.
+	cfg := config.Interface{
+		Name:        "test0",
+		MinInterval: 10 * time.Millisecond,
+		MaxInterval: 10 * time.Millisecond,
 	}
 
-	_, err = c.pc.WriteTo(b, c.peer)
-	return err
-}
-
-func testAdvertiser(t *testing.T, cfg *config.Interface, tcfg *testConfig) (*Advertiser, *clientContext, func()) {
-	t.Helper()
+	var (
+		buf  bytes.Buffer
+		ts   = system.TestState{Forwarding: true}
+		ad   = NewAdvertiser(NewContext(log.New(&buf, "", 0), nil, ts), cfg, nil, nil, nil)
+		reqC = make(chan request, 1024)
+	)
 
-	if runtime.GOOS != "linux" {
-		t.Skip("skipping, this test only runs on Linux")
-	}
+	const floor = 100 * time.Millisecond
+	ad.minDelayBetweenRAs = floor
 
-	skipUnprivileged(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*floor+floor/2)
+	defer cancel()
+	ad.multicast(ctx, reqC)
 
-	if tcfg == nil {
-		tcfg = &testConfig{}
+	// One RA is sent immediately and then once per minimum delay, allowing
+	// for some scheduling slack.
+	if n := len(reqC); n < 2 || n > 7 {
+		t.Fatalf("expected send rate to be clamped to one RA per %s, but got %d RAs", floor, n)
 	}
-	if tcfg.terminate == nil {
-		// Assume a complete termination.
-		tcfg.terminate = func() bool { return true }
+
+	if diff := cmp.Diff(1, strings.Count(buf.String(), "below the minimum delay")); diff != "" {
+		t.Fatalf("unexpected number of logs (-want +got):\n%s", diff)
 	}
+}
 
-	var (
-		r     = rand.New(rand.NewSource(time.Now().UnixNano()))
-		veth0 = fmt.Sprintf("cradveth%d", r.Intn(65535))
-		veth1 = fmt.Sprintf("cradveth%d", r.Intn(65535))
-	)
+func TestAdvertiserSolicitedRecently(t *testing.T) {
+	t.Parallel()
 
-	// Set up a temporary veth pair in the appropriate state for use with
-	// the tests.
-	// TODO: use rtnetlink.
-	shell(t, "ip", "link", "add", veth0, "type", "veth", "peer", "name", veth1)
-	mustSysctl(t, veth0, "accept_dad", "0")
-	mustSysctl(t, veth1, "accept_dad", "0")
-	mustSysctl(t, veth0, "forwarding", "1")
+	ts := system.TestState{Forwarding: true}
 
-	if tcfg.vethConfig != nil {
-		tcfg.vethConfig(t, veth0, veth1)
+	// On-demand mode disabled: always advertise.
+	ad := NewAdvertiser(NewContext(nil, nil, ts), config.Interface{Name: "test0"}, nil, nil, nil)
+	if !ad.solicitedRecently(time.Now()) {
+		t.Fatal("advertiser without on-demand mode must always advertise")
 	}
 
-	shell(t, "ip", "link", "set", "up", veth0)
-	shell(t, "ip", "link", "set", "up", veth1)
+	const window = 10 * time.Minute
+	ad = NewAdvertiser(
+		NewContext(nil, nil, ts),
+		config.Interface{Name: "test0", OnDemandWindow: window},
+		nil, nil, nil,
+	)
 
-	// Make sure the interfaces are up and ready.
-	waitInterfacesReady(t, veth0, veth1)
+	if ad.solicitedRecently(time.Now()) {
+		t.Fatal("advertiser must be quiet before any router solicitations")
+	}
 
-	// Allow empty config but always populate the interface name.
-	// TODO: consider building veth pairs within the tests.
-	if cfg == nil {
-		cfg = &config.Interface{}
+	if _, err := ad.handle(&ndp.RouterSolicitation{}, crtest.MustIP("fe80::1")); err != nil {
+		t.Fatalf("failed to handle router solicitation: %v", err)
 	}
-	// Fixed interval for multicast advertisements.
-	cfg.MinInterval = 1 * time.Second
-	cfg.MaxInterval = 1 * time.Second
-	cfg.Name = veth0
 
-	router, err := net.InterfaceByName(veth0)
-	if err != nil {
-		t.Fatalf("failed to look up router veth: %v", err)
+	now := time.Now()
+	if !ad.solicitedRecently(now) {
+		t.Fatal("advertiser must advertise after a router solicitation")
 	}
 
-	client, err := net.InterfaceByName(veth1)
-	if err != nil {
-		t.Fatalf("failed to look up client veth: %v", err)
+	if ad.solicitedRecently(now.Add(window)) {
+		t.Fatal("advertiser must be quiet once the on-demand window elapses")
 	}
+}
 
-	ll := log.New(os.Stderr, "", 0)
-	state := system.NewState()
-	mm := NewMetrics(metricslite.NewMemory(), state, []config.Interface{*cfg})
+func TestAdvertiserSolicitedSends(t *testing.T) {
+	t.Parallel()
 
-	crctx := NewContext(ll, mm, state)
+	tests := []struct {
+		name    string
+		req     request
+		writes  int
+		repeats map[string]float64
+	}{
+		{
+			name:    "unicast",
+			req:     request{IP: crtest.MustIP("fe80::1"), Solicited: true},
+			writes:  3,
+			repeats: map[string]float64{"interface=test0": 2},
+		},
+		{
+			name:   "unsolicited unicast",
+			req:    request{IP: crtest.MustIP("fe80::1")},
+			writes: 1,
+		},
+		{
+			name:   "multicast",
+			req:    request{IP: netaddr.IPv6LinkLocalAllNodes(), Solicited: true},
+			writes: 1,
+		},
+	}
 
-	ad := NewAdvertiser(
-		crctx,
-		*cfg,
-		system.NewDialer(router.Name, state, system.Advertise, ll),
-		nil,
-		tcfg.terminate,
-	)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
 
-	// Override RFC parameters to speed up tests.
-	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+			cfg := config.Interface{
+				Name:                  "test0",
+				SolicitedSends:        3,
+				SolicitedSendInterval: 10 * time.Millisecond,
+			}
+
+			var (
+				ts   = system.TestState{Forwarding: true}
+				mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+				ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+				conn = system.NewTestConn(4)
+				reqC = make(chan request, 1)
+			)
+
+			ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errC := make(chan error, 1)
+			go func() { errC <- ad.schedule(ctx, conn, reqC) }()
+
+			reqC <- tt.req
+			for i := 0; i < tt.writes; i++ {
+				select {
+				case w := <-conn.Writes():
+					ip, _ := netaddr.FromStdIP(w.IP)
+					if diff := cmp.Diff(tt.req.IP, ip, cmp.Comparer(compareNetaddrIP)); diff != "" {
+						t.Fatalf("unexpected destination (-want +got):\n%s", diff)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for write %d", i)
+				}
+			}
+
+			// No further router advertisements are sent.
+			select {
+			case w := <-conn.Writes():
+				t.Fatalf("unexpected write to %s", w.IP)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			cancel()
+			if err := <-errC; err != nil {
+				t.Fatalf("failed to schedule: %v", err)
+			}
 
-	if tcfg.onInconsistentRA != nil {
-		ad.OnInconsistentRA = tcfg.onInconsistentRA
+			if diff := cmp.Diff(tt.repeats, findMetric(t, mm, advSolicitedRepeats).Samples, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatalf("unexpected repeats metric (-want +got):\n%s", diff)
+			}
+		})
 	}
+}
 
-	cconn, _, err := ndp.Dial(client, ndp.LinkLocal)
-	if err != nil {
-		t.Fatalf("failed to dial client connection: %v", err)
-	}
+func TestAdvertiserSolicitedQueueFull(t *testing.T) {
+	t.Parallel()
 
-	// Only accept RAs.
-	var f ipv6.ICMPFilter
-	f.SetAll(true)
-	f.Accept(ipv6.ICMPTypeRouterAdvertisement)
+	var (
+		ts    = system.TestState{Forwarding: true}
+		mm    = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad    = NewAdvertiser(NewContext(nil, mm, ts), config.Interface{Name: "test0"}, nil, nil, nil)
+		sendQ = make(chan request, 1)
+		req   = request{IP: crtest.MustIP("fe80::1"), Solicited: true}
+	)
 
-	if err := cconn.SetICMPFilter(&f); err != nil {
-		t.Fatalf("failed to apply ICMPv6 filter: %v", err)
-	}
+	// With no workers consuming the queue, the second request is dropped.
+	ad.enqueue(sendQ, req)
+	ad.enqueue(sendQ, req)
 
-	// Enable inspection of IPv6 control messages.
-	flags := ipv6.FlagHopLimit | ipv6.FlagDst
-	if err := cconn.SetControlMessage(flags, true); err != nil {
-		t.Fatalf("failed to apply IPv6 control message flags: %v", err)
+	depth := metricslite.Series{
+		Name:    advSolicitedQueue,
+		Samples: map[string]float64{"interface=test0": 1},
 	}
 
-	if err := cconn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
-		t.Fatalf("failed to set client read deadline: %v", err)
+	if diff := cmp.Diff(depth, findMetric(t, mm, advSolicitedQueue)); diff != "" {
+		t.Fatalf("unexpected queue depth metric (-want +got):\n%s", diff)
 	}
 
-	cctx := &clientContext{
-		c: cconn,
-		rs: &ndp.RouterSolicitation{
-			Options: []ndp.Option{&ndp.LinkLayerAddress{
-				Direction: ndp.Source,
-				Addr:      client.HardwareAddr,
-			}},
-		},
-		router: router,
-		client: client,
-		mm:     mm,
+	dropped := metricslite.Series{
+		Name:    advSolicitedDropped,
+		Samples: map[string]float64{"interface=test0": 1},
 	}
 
-	done := func() {
-		if err := cconn.Close(); err != nil {
-			t.Fatalf("failed to close NDP router solicitation connection: %v", err)
-		}
-
-		// Clean up the veth pair.
-		shell(t, "ip", "link", "del", veth0)
+	if diff := cmp.Diff(dropped, findMetric(t, mm, advSolicitedDropped)); diff != "" {
+		t.Fatalf("unexpected dropped metric (-want +got):\n%s", diff)
 	}
-
-	return ad, cctx, done
 }
 
-// testAdvertiserClient is a wrapper around testAdvertiser which focuses on
-// client interactions rather than server interactions.
-func testAdvertiserClient(
-	t *testing.T,
-	cfg *config.Interface,
-	tcfg *testConfig,
-	fn func(cancel func(), cctx *clientContext),
-) func() {
-	t.Helper()
+func BenchmarkAdvertiserSolicited(b *testing.B) {
+	cfg := config.Interface{
+		Name:     "test0",
+		HopLimit: 64,
+		Plugins: []plugin.Plugin{
+			plugin.NewMTU(1500),
+			&plugin.Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				ValidLifetime:     24 * time.Hour,
+				PreferredLifetime: 4 * time.Hour,
+			},
+		},
+	}
 
-	ad, cctx, adDone := testAdvertiser(t, cfg, tcfg)
+	var (
+		ts    = system.TestState{Forwarding: true}
+		ad    = NewAdvertiser(NewContext(nil, nil, ts), cfg, nil, nil, nil)
+		conn  = system.NewTestConn(solicitedQueueSize)
+		sendQ = make(chan request, solicitedQueueSize)
+		errC  = make(chan error, solicitedWorkers)
+		req   = request{IP: crtest.MustIP("fe80::1"), Solicited: true}
+	)
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	var eg errgroup.Group
-	eg.Go(func() error {
-		if err := ad.Run(ctx); err != nil {
-			return fmt.Errorf("failed to advertise: %v", err)
-		}
-
-		return nil
-	})
+	var wg sync.WaitGroup
+	wg.Add(solicitedWorkers)
+	defer wg.Wait()
 
-	// Run the advertiser and invoke the client's input function with some
-	// context for the test, while also allowing the client to cancel the
-	// advertiser run loop.
-	fn(cancel, cctx)
+	for i := 0; i < solicitedWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			ad.solicited(ctx, conn, sendQ, errC)
+		}()
+	}
 
-	done := func() {
-		cancel()
-		if err := eg.Wait(); err != nil {
-			t.Fatalf("failed to stop advertiser: %v", err)
+	// Drain the responses concurrently, as a NIC would.
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		for i := 0; i < b.N; i++ {
+			<-conn.Writes()
 		}
+	}()
 
-		adDone()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sendQ <- req
 	}
 
-	return done
+	<-doneC
+	b.StopTimer()
+	cancel()
+
+	select {
+	case err := <-errC:
+		b.Fatalf("failed to send: %v", err)
+	default:
+	}
 }
 
-func waitInterfacesReady(t *testing.T, ifi0, ifi1 string) {
-	t.Helper()
+func TestAdvertiserCheckDeviation(t *testing.T) {
+	t.Parallel()
 
-	a, err := net.InterfaceByName(ifi0)
-	if err != nil {
-		t.Fatalf("failed to get first interface: %v", err)
-	}
+	var (
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), config.Interface{Name: "test0"}, nil, nil, nil)
+	)
 
-	b, err := net.InterfaceByName(ifi1)
-	if err != nil {
-		t.Fatalf("failed to get second interface: %v", err)
-	}
+	late := map[string]float64{"interface=test0": 1}
 
-	for i := 0; i < 5; i++ {
-		if i > 0 {
-			time.Sleep(1 * time.Second)
-			t.Log("waiting for interface readiness...")
-		}
+	tests := []struct {
+		want, got time.Duration
+		dev       float64
+		late      map[string]float64
+	}{
+		// Early wakeups do not count as negative deviation.
+		{want: 10 * time.Second, got: 9 * time.Second, dev: 0},
+		{want: 10 * time.Second, got: 10*time.Second + 500*time.Millisecond, dev: 0.5},
+		{want: 10 * time.Second, got: 13 * time.Second, dev: 3, late: late},
+		{want: 10 * time.Second, got: 10 * time.Second, dev: 0, late: late},
+	}
 
-		aaddrs, err := a.Addrs()
-		if err != nil {
-			t.Fatalf("failed to get first addresses: %v", err)
-		}
+	for i, tt := range tests {
+		ad.checkDeviation(tt.want, tt.got)
 
-		baddrs, err := b.Addrs()
-		if err != nil {
-			t.Fatalf("failed to get second addresses: %v", err)
+		want := map[string]float64{"interface=test0": tt.dev}
+		if diff := cmp.Diff(want, findMetric(t, mm, advScheduleDeviation).Samples); diff != "" {
+			t.Fatalf("%d: unexpected deviation metric (-want +got):\n%s", i, diff)
 		}
 
-		if len(aaddrs) == 0 || len(baddrs) == 0 {
-			// No addresses yet.
-			continue
+		if diff := cmp.Diff(tt.late, findMetric(t, mm, advScheduleLate).Samples, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("%d: unexpected late metric (-want +got):\n%s", i, diff)
 		}
+	}
+}
 
-		// Do we have a link-local address assigned to each interface, and
-		// can we bind to that address?
-		if !linkLocalReady(t, aaddrs, ifi0) || !linkLocalReady(t, baddrs, ifi1) {
-			continue
-		}
+func TestAdvertiserSendWorkerDeviation(t *testing.T) {
+	t.Parallel()
 
-		return
+	cfg := config.Interface{
+		Name:     "test0",
+		HopLimit: 64,
 	}
 
-	t.Fatal("failed to wait for interface readiness")
-}
+	var (
+		ts   = system.TestState{Forwarding: true}
+		mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad   = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+		conn = system.NewTestConn(3)
 
-func linkLocalReady(t *testing.T, addrs []net.Addr, zone string) bool {
-	t.Helper()
+		late = map[string]float64{"interface=test0": 1}
+	)
 
-	for _, a := range addrs {
-		ip, ok := a.(*net.IPNet)
-		if !ok {
-			continue
-		}
+	send := func(req request, ago time.Duration) {
+		t.Helper()
 
-		if ip.IP.To16() == nil || ip.IP.To4() != nil || !ip.IP.IsLinkLocalUnicast() {
-			continue
+		// Pretend the previous scheduled router advertisement was sent ago.
+		if ago != 0 {
+			atomic.StoreInt64(ad.lastScheduled, time.Now().Add(-ago).UnixNano())
 		}
 
-		// We've found a link-local IPv6 address. Try to bind a random socket to
-		// it to verify the address is ready for use.
-		addr := &net.UDPAddr{
-			IP:   ip.IP,
-			Port: 0,
-			Zone: zone,
+		if err := ad.sendWorker(context.Background(), conn, req); err != nil {
+			t.Fatalf("failed to send: %v", err)
 		}
+	}
 
-		l, err := net.ListenPacket("udp", addr.String())
-		if err != nil {
-			return false
+	checkLate := func(want map[string]float64) {
+		t.Helper()
+
+		if diff := cmp.Diff(want, findMetric(t, mm, advScheduleLate).Samples, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("unexpected late metric (-want +got):\n%s", diff)
 		}
-		_ = l.Close()
+	}
 
-		t.Logf("ready: %s", addr.String())
+	// The first scheduled router advertisement has no interval to compare
+	// against, so it only sets the baseline.
+	send(request{IP: netaddr.IPv6LinkLocalAllNodes(), Scheduled: true}, 0)
+	checkLate(nil)
 
-		return true
+	if atomic.LoadInt64(ad.lastScheduled) == 0 {
+		t.Fatal("scheduled router advertisement was not timestamped")
 	}
 
-	return false
-}
-
-func skipShort(t *testing.T) {
-	t.Helper()
+	// Router advertisements which are not scheduled by the multicast loop are
+	// never compared, even if they are sent much later.
+	send(request{IP: netaddr.IPv6LinkLocalAllNodes(), Interval: 10 * time.Second}, 13*time.Second)
+	checkLate(nil)
 
-	if testing.Short() {
-		t.Skip("skipping in short mode")
-	}
+	// A scheduled router advertisement sent well after its interval since
+	// the previous one is late.
+	send(request{IP: netaddr.IPv6LinkLocalAllNodes(), Scheduled: true, Interval: 10 * time.Second}, 13*time.Second)
+	checkLate(late)
 }
 
-func skipUnprivileged(t *testing.T) {
-	const ifName = "cradprobe0"
-	shell(t, "ip", "tuntap", "add", ifName, "mode", "tun")
-	shell(t, "ip", "link", "del", ifName)
-}
+func TestAdvertiserCheckIPv4(t *testing.T) {
+	t.Parallel()
 
-func shell(t *testing.T, name string, arg ...string) {
-	t.Helper()
+	var (
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+		ad = NewAdvertiser(NewContext(nil, mm, ts), config.Interface{Name: "test0", IPv6Only: true}, nil, nil, nil)
+	)
 
-	bin, err := exec.LookPath(name)
-	if err != nil {
-		t.Fatalf("failed to look up binary path: %v", err)
+	tests := []struct {
+		name  string
+		addrs []net.Addr
+		n     float64
+	}{
+		{
+			name: "IPv6-only",
+			addrs: []net.Addr{
+				&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+				&net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)},
+			},
+		},
+		{
+			name: "dual-stack",
+			addrs: []net.Addr{
+				&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+				&net.IPNet{IP: net.IPv4(192, 0, 2, 1), Mask: net.CIDRMask(24, 32)},
+				&net.IPNet{IP: net.IPv4(198, 51, 100, 1), Mask: net.CIDRMask(24, 32)},
+			},
+			n: 2,
+		},
 	}
 
-	t.Logf("$ %s %v", bin, arg)
+	for _, tt := range tests {
+		ad.checkIPv4(tt.addrs)
 
-	cmd := exec.Command(bin, arg...)
-	if err := cmd.Start(); err != nil {
-		t.Fatalf("failed to start command %q: %v", name, err)
+		want := map[string]float64{"interface=test0": tt.n}
+		if diff := cmp.Diff(want, findMetric(t, mm, advIPv4Addresses).Samples); diff != "" {
+			t.Fatalf("%s: unexpected IPv4 addresses metric (-want +got):\n%s", tt.name, diff)
+		}
 	}
+}
 
-	if err := cmd.Wait(); err != nil {
-		// Shell operations in these tests require elevated privileges.
-		if cmd.ProcessState.ExitCode() == int(unix.EPERM) {
-			t.Skipf("skipping, permission denied: %v", err)
-		}
+func Test_proxyWarnings(t *testing.T) {
+	t.Parallel()
 
-		t.Fatalf("failed to wait for command %q: %v", name, err)
+	const (
+		noForwarding = "proxy flag is set but IPv6 forwarding is disabled, proxied packets will not be forwarded"
+		noProxy      = "proxy flag is set but neither proxy_ndp nor promiscuous or all-multicast mode is enabled, neighbor discovery may not be proxied"
+	)
+
+	tests := []struct {
+		name       string
+		forwarding bool
+		proxy      *system.NDProxyState
+		warnings   []string
+	}{
+		{
+			name:       "kernel proxy",
+			forwarding: true,
+			proxy:      &system.NDProxyState{ProxyNDP: true},
+		},
+		{
+			name:       "promiscuous",
+			forwarding: true,
+			proxy:      &system.NDProxyState{Promiscuous: true},
+		},
+		{
+			name:       "unsupported",
+			forwarding: true,
+		},
+		{
+			name:     "no forwarding",
+			proxy:    &system.NDProxyState{AllMulticast: true},
+			warnings: []string{noForwarding},
+		},
+		{
+			name:     "nothing",
+			proxy:    &system.NDProxyState{},
+			warnings: []string{noForwarding, noProxy},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.warnings, proxyWarnings(tt.forwarding, tt.proxy)); diff != "" {
+				t.Fatalf("unexpected warnings (-want +got):\n%s", diff)
+			}
+		})
 	}
 }
 
-func mustSysctl(t *testing.T, iface, key, value string) {
-	t.Helper()
+func TestAdvertiserLifetimeClamped(t *testing.T) {
+	t.Parallel()
 
-	file := filepath.Join(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s", iface), key)
+	var (
+		ts  = system.TestState{Forwarding: true}
+		mm  = NewMetrics(metricslite.NewMemory(), ts, nil)
+		cfg = config.Interface{Name: "test0", MaxLifetime: 1 * time.Hour, HopLimit: 64}
+		ad  = NewAdvertiser(NewContext(nil, mm, ts), cfg, nil, nil, nil)
+	)
 
-	t.Logf("sysctl %q = %q", file, value)
+	ad.cfg.DefaultLifetime = 2 * time.Hour
+	ad.cfg.Plugins = []plugin.Plugin{&plugin.RDNSS{
+		Lifetime: ndp.Infinity,
+		Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+	}}
 
-	if err := ioutil.WriteFile(file, []byte(value), 0o644); err != nil {
-		t.Fatalf("failed to write sysctl %s/%s: %v", iface, key, err)
+	for i := 0; i < 2; i++ {
+		ra, _, err := ad.cfg.Build(true, config.UnsolicitedSet)
+		if err != nil {
+			t.Fatalf("failed to build router advertisement: %v", err)
+		}
+		if ra.RouterLifetime != 1*time.Hour {
+			t.Fatalf("router lifetime was not clamped: %s", ra.RouterLifetime)
+		}
 	}
-}
 
-func mustNetIP(s string) net.IP {
-	ip := net.ParseIP(s)
-	if ip == nil {
-		panicf("failed to parse %q as IP address", s)
+	want := map[string]float64{"interface=test0": 4}
+	if diff := cmp.Diff(want, findMetric(t, mm, advLifetimesClamped).Samples); diff != "" {
+		t.Fatalf("unexpected clamped lifetimes metric (-want +got):\n%s", diff)
 	}
 
-	return ip
+	if diff := cmp.Diff(map[string]bool{"router lifetime": true, "rdnss lifetime": true}, ad.clamped); diff != "" {
+		t.Fatalf("unexpected logged clamped lifetimes (-want +got):\n%s", diff)
+	}
 }
 
-func findMetric(t *testing.T, mm *Metrics, name string) metricslite.Series {
-	t.Helper()
+func TestAdvertiserDelegatedChange(t *testing.T) {
+	t.Parallel()
 
-	series, ok := mm.Series()
-	if !ok {
-		t.Fatalf("metrics node does not support Series output: %T", mm)
-	}
+	ad := NewAdvertiser(
+		NewContext(nil, nil, system.TestState{Forwarding: true}),
+		config.Interface{Name: "test1"},
+		nil, nil, nil,
+	)
 
-	for sname, ts := range series {
-		// Filter to only return the specified metric.
-		if sname != name {
-			continue
-		}
+	var (
+		changeC = make(chan netstate.Change, 1)
+		reqC    = make(chan request, 1)
+		doneC   = make(chan struct{})
+	)
 
-		// Remove the help string for easier diffing.
-		ts.Help = ""
-		return ts
+	go func() {
+		defer close(doneC)
+		ad.delegated(context.Background(), "test0", changeC, reqC)
+	}()
+
+	// An address change on the upstream interface requests a multicast RA.
+	changeC <- netstate.AddressChange
+	if req := <-reqC; req.IP != netaddr.IPv6LinkLocalAllNodes() {
+		t.Fatalf("unexpected request IP: %s", req.IP)
 	}
 
-	t.Fatalf("no metric with name %q was found", name)
-	panic("unreachable")
+	// Closing the channel halts the watcher.
+	close(changeC)
+	<-doneC
 }
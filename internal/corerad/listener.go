@@ -41,14 +41,37 @@ type listener struct {
 	cctx  *Context
 	iface string
 	c     system.Conn
+
+	// lenient indicates whether messages with an invalid hop limit should be
+	// processed rather than dropped.
+	lenient bool
+
+	// grace optionally configures a window during which temporary errors are
+	// retried indefinitely. Once errors persist beyond grace, onDegraded is
+	// invoked with true, and then with false once a message is received
+	// again. The fixed number of receive retries then applies as usual.
+	grace      time.Duration
+	onDegraded func(degraded bool)
+
+	// If c is a system.DropCounter, its socket's drop count is checked at
+	// most once per dropInterval. drops is the last count observed.
+	dropInterval time.Duration
+	dropsAt      time.Time
+	drops        uint64
+	noDrops      bool
 }
 
-// newListener constructs a listener with optional logger and metrics.
-func newListener(cctx *Context, iface string, conn system.Conn) *listener {
+// newListener constructs a listener with optional logger and metrics. If
+// lenient is true, messages with an invalid IPv6 hop limit are processed
+// rather than dropped.
+func newListener(cctx *Context, iface string, conn system.Conn, lenient bool) *listener {
 	return &listener{
-		cctx:  cctx,
-		iface: iface,
-		c:     conn,
+		cctx:    cctx,
+		iface:   iface,
+		c:       conn,
+		lenient: lenient,
+
+		dropInterval: 1 * time.Second,
 	}
 }
 
@@ -103,12 +126,26 @@ func (l *listener) Listen(ctx context.Context, onMessage func(msg message) error
 }
 
 // receiveRetry will attempt to read an NDP message from conn until ctx is
-// canceled or it exhausts a fixed number of retries.
+// canceled or it exhausts a fixed number of retries. If a grace period is
+// configured, temporary errors are retried indefinitely within the grace
+// period, and the retries only begin once the listener is degraded.
 func (l *listener) receiveRetry(ctx context.Context) (ndp.Message, netaddr.IP, error) {
 	// TODO(mdlayher): consider parameterizing in the future if need be.
-	const retries = 5
+	const (
+		retries  = 5
+		maxDelay = 1 * time.Second
+	)
 
-	for i := 0; i < retries; i++ {
+	// The start of the current run of temporary errors, whether it has
+	// outlasted the grace period, and the number of retries which count
+	// toward the fixed limit.
+	var (
+		since    time.Time
+		degraded bool
+		tries    int
+	)
+
+	for i := 0; tries < retries; i++ {
 		// Enable cancelation before receiving any messages, if necessary.
 		if err := ctx.Err(); err != nil {
 			return nil, netaddr.IP{}, err
@@ -125,10 +162,36 @@ func (l *listener) receiveRetry(ctx context.Context) (ndp.Message, netaddr.IP, e
 			if errors.As(err, &nerr) && nerr.Temporary() {
 				// Temporary error or timeout, either back off and retry or
 				// return if the context is canceled.
+				l.cctx.mm.MessagesReceiveRetriesTotal(1.0, l.iface)
+
+				if l.grace > 0 {
+					if since.IsZero() {
+						since = time.Now()
+					}
+
+					if !degraded && time.Since(since) > l.grace {
+						degraded = true
+						l.logf("receive errors persisted beyond grace period of %s, marking degraded: %v", l.grace, err)
+						l.degrade(true)
+					}
+				}
+
+				// Errors within the grace period don't count toward the
+				// retries, but errors beyond it do, so that a persistently
+				// broken socket is still reinitialized.
+				if l.grace == 0 || degraded {
+					tries++
+				}
+
+				delay := time.Duration(i) * 50 * time.Millisecond
+				if delay > maxDelay {
+					delay = maxDelay
+				}
+
 				select {
 				case <-ctx.Done():
 					return nil, netaddr.IP{}, ctx.Err()
-				case <-time.After(time.Duration(i) * 50 * time.Millisecond):
+				case <-time.After(delay):
 				}
 				continue
 			}
@@ -136,25 +199,80 @@ func (l *listener) receiveRetry(ctx context.Context) (ndp.Message, netaddr.IP, e
 			return nil, netaddr.IP{}, err
 		}
 
+		l.countDrops()
+
 		// Convert to netaddr.IP for use elsewhere.
 		host, ok := netaddr.FromStdIP(from)
 		if !ok {
 			panicf("netaddr: invalid IP address: %q", from)
 		}
 
-		// Ensure this message has a valid hop limit.
+		// Ensure this message has a valid hop limit, per
+		// https://tools.ietf.org/html/rfc4861#section-6.1. Messages with any
+		// other hop limit may have been forwarded by a router and could be
+		// spoofed by an off-link host.
 		if cm.HopLimit != ndp.HopLimit {
-			l.logf("received NDP message with IPv6 hop limit %d from %s, ignoring", cm.HopLimit, host)
-			l.cctx.mm.MessagesReceivedInvalidTotal(1.0, l.iface, m.Type().String())
-			continue
+			l.cctx.mm.MessagesReceivedInvalidHopLimitTotal(1.0, l.iface, m.Type().String())
+
+			if !l.lenient {
+				l.logf("received NDP message with IPv6 hop limit %d from %s, ignoring", cm.HopLimit, host)
+				l.cctx.mm.MessagesReceivedInvalidTotal(1.0, l.iface, m.Type().String())
+				continue
+			}
+
+			l.logf("received NDP message with IPv6 hop limit %d from %s, processing due to lenient hop limit mode", cm.HopLimit, host)
+		}
+
+		if degraded {
+			l.logf("receiving NDP messages again, no longer degraded")
+			l.degrade(false)
 		}
 
 		return m, host, nil
 	}
 
+	l.cctx.mm.MessagesReceiveRetriesExhaustedTotal(1.0, l.iface)
 	return nil, netaddr.IP{}, errRetriesExhausted
 }
 
+// countDrops reports any packets dropped by the socket's receive buffer since
+// it was last checked, if the Conn can count them.
+func (l *listener) countDrops() {
+	dc, ok := l.c.(system.DropCounter)
+	if !ok || l.noDrops {
+		return
+	}
+
+	first := l.dropsAt.IsZero()
+	if !first && time.Since(l.dropsAt) < l.dropInterval {
+		return
+	}
+	l.dropsAt = time.Now()
+
+	n, err := dc.Drops()
+	if err != nil {
+		// The count is unlikely to become available later, so stop checking.
+		l.logf("unable to count socket receive buffer drops: %v", err)
+		l.noDrops = true
+		return
+	}
+
+	// A socket passed by socket activation may have dropped packets before
+	// this listener was created, so the first count is only a baseline.
+	if !first && n > l.drops {
+		l.logf("socket receive buffer dropped %d packet(s), consider increasing receive_buffer", n-l.drops)
+		l.cctx.mm.MessagesReceiveDropsTotal(float64(n-l.drops), l.iface)
+	}
+	l.drops = n
+}
+
+// degrade invokes the onDegraded callback, if set.
+func (l *listener) degrade(degraded bool) {
+	if l.onDegraded != nil {
+		l.onDegraded(degraded)
+	}
+}
+
 // logf prints a formatted log with the listener's interface name.
 func (l *listener) logf(format string, v ...interface{}) {
 	l.cctx.ll.Printf(l.iface+": "+format, v...)
@@ -21,48 +21,96 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/metricslite"
 	"github.com/mdlayher/ndp"
 	"golang.org/x/net/ipv6"
 )
 
-func Test_listenerReceiveRetryMetrics(t *testing.T) {
-	const iface = "test0"
+func Test_listenerReceiveRetryHopLimit(t *testing.T) {
+	t.Parallel()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	const iface = "test0"
 
-	conn := &testConn{
-		readFrom: func() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
-			// A read returns a message with a bad hop limit and immediately
-			// cancels the retry loop since this message would be ignored
-			// and the read would be retried.
-			defer cancel()
-			return &ndp.RouterAdvertisement{}, &ipv6.ControlMessage{HopLimit: 1}, net.IPv6loopback, nil
+	tests := []struct {
+		name     string
+		lenient  bool
+		hopLimit int
+		ok       bool
+		invalid  map[string]float64
+	}{
+		{
+			name:     "strict OK",
+			hopLimit: ndp.HopLimit,
+			ok:       true,
+		},
+		{
+			name:     "strict bad hop limit",
+			hopLimit: 1,
+			invalid: map[string]float64{
+				"interface=test0,message=router advertisement": 1,
+			},
+		},
+		{
+			name:     "lenient bad hop limit",
+			lenient:  true,
+			hopLimit: 254,
+			ok:       true,
 		},
 	}
 
-	mm := NewMetrics(metricslite.NewMemory(), nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
 
-	cctx := NewContext(nil, mm, nil)
+			conn := &testConn{
+				readFrom: func() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+					// A read returns a message with the specified hop limit and
+					// immediately cancels the retry loop, so if this message is
+					// ignored, the read will not be retried.
+					defer cancel()
+					return &ndp.RouterAdvertisement{}, &ipv6.ControlMessage{HopLimit: tt.hopLimit}, net.IPv6loopback, nil
+				},
+			}
 
-	l := newListener(cctx, iface, conn)
-	if _, _, err := l.receiveRetry(ctx); err != nil && !errors.Is(err, context.Canceled) {
-		t.Fatalf("failed to receive: %v", err)
-	}
+			mm := NewMetrics(metricslite.NewMemory(), nil, nil)
 
-	invalid := findMetric(t, mm, msgInvalid)
+			cctx := NewContext(nil, mm, nil)
 
-	want := metricslite.Series{
-		Name: msgInvalid,
-		Samples: map[string]float64{
-			"interface=test0,message=router advertisement": 1,
-		},
-	}
+			l := newListener(cctx, iface, conn, tt.lenient)
+			m, _, err := l.receiveRetry(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Fatalf("failed to receive: %v", err)
+			}
 
-	if diff := cmp.Diff(want, invalid); diff != "" {
-		t.Fatalf("unexpected invalid message metric (-want +got):\n%s", diff)
+			if ok := m != nil; ok != tt.ok {
+				t.Fatalf("unexpected message receipt: want %t, got %t", tt.ok, ok)
+			}
+
+			// The hop limit metric is incremented in both modes, but only
+			// messages which are dropped are considered invalid.
+			var hopLimit map[string]float64
+			if tt.hopLimit != ndp.HopLimit {
+				hopLimit = map[string]float64{
+					"interface=test0,message=router advertisement": 1,
+				}
+			}
+
+			for _, s := range []struct {
+				name    string
+				samples map[string]float64
+			}{
+				{name: msgInvalid, samples: tt.invalid},
+				{name: msgInvalidHopLimit, samples: hopLimit},
+			} {
+				got := findMetric(t, mm, s.name)
+				if diff := cmp.Diff(s.samples, got.Samples, cmpopts.EquateEmpty()); diff != "" {
+					t.Fatalf("unexpected %q metric (-want +got):\n%s", s.name, diff)
+				}
+			}
+		})
 	}
 }
 
@@ -89,11 +137,13 @@ func Test_listenerReceiveRetryErrors(t *testing.T) {
 		}
 	}
 
+	// retries is negative if the number of retries depends on timing.
 	tests := []struct {
-		name  string
-		mkCtx func() (context.Context, func())
-		conn  system.Conn
-		err   error
+		name               string
+		mkCtx              func() (context.Context, func())
+		conn               system.Conn
+		err                error
+		retries, exhausted float64
 	}{
 		{
 			name: "context canceled",
@@ -131,12 +181,15 @@ func Test_listenerReceiveRetryErrors(t *testing.T) {
 					}
 				}(),
 			},
+			retries: 1,
 		},
 		{
-			name:  "backoff failure",
-			mkCtx: noCancel,
-			conn:  &testConn{readFrom: readFromErr(timeoutError{})},
-			err:   errRetriesExhausted,
+			name:      "backoff failure",
+			mkCtx:     noCancel,
+			conn:      &testConn{readFrom: readFromErr(timeoutError{})},
+			err:       errRetriesExhausted,
+			retries:   5,
+			exhausted: 1,
 		},
 		{
 			name: "backoff context deadline exceeded",
@@ -145,8 +198,9 @@ func Test_listenerReceiveRetryErrors(t *testing.T) {
 				// to trigger an alternate select case in receiveRetry.
 				return context.WithTimeout(context.Background(), 25*time.Millisecond)
 			},
-			conn: &testConn{readFrom: readFromErr(timeoutError{})},
-			err:  context.DeadlineExceeded,
+			conn:    &testConn{readFrom: readFromErr(timeoutError{})},
+			err:     context.DeadlineExceeded,
+			retries: -1,
 		},
 	}
 
@@ -155,14 +209,176 @@ func Test_listenerReceiveRetryErrors(t *testing.T) {
 			ctx, cancel := tt.mkCtx()
 			defer cancel()
 
-			l := newListener(nil, "test0", tt.conn)
+			mm := NewMetrics(metricslite.NewMemory(), nil, nil)
+
+			l := newListener(NewContext(nil, mm, nil), "test0", tt.conn, false)
 			if _, _, err := l.receiveRetry(ctx); !errors.Is(err, tt.err) {
 				t.Fatalf("unexpected error: %v", err)
 			}
+
+			for _, s := range []struct {
+				name  string
+				value float64
+			}{
+				{name: msgReceiveRetries, value: tt.retries},
+				{name: msgRetriesExhausted, value: tt.exhausted},
+			} {
+				if s.value < 0 {
+					continue
+				}
+
+				var want map[string]float64
+				if s.value > 0 {
+					want = map[string]float64{"interface=test0": s.value}
+				}
+
+				got := findMetric(t, mm, s.name)
+				if diff := cmp.Diff(want, got.Samples, cmpopts.EquateEmpty()); diff != "" {
+					t.Fatalf("unexpected %q metric (-want +got):\n%s", s.name, diff)
+				}
+			}
+		})
+	}
+}
+
+func Test_listenerReceiveRetryGrace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		degraded []bool
+	}{
+		{
+			name:  "within grace period",
+			grace: 1 * time.Minute,
+		},
+		{
+			name:     "beyond grace period",
+			grace:    100 * time.Millisecond,
+			degraded: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Fail more times than the fixed number of retries, spanning
+			// roughly 750ms of backoff, and then recover.
+			const failures = 6
+
+			var calls int
+			conn := &testConn{
+				readFrom: func() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+					defer func() { calls++ }()
+
+					if calls < failures {
+						return nil, nil, nil, timeoutError{}
+					}
+
+					return &ndp.RouterAdvertisement{}, &ipv6.ControlMessage{HopLimit: ndp.HopLimit}, net.IPv6loopback, nil
+				},
+			}
+
+			mm := NewMetrics(metricslite.NewMemory(), nil, nil)
+
+			var degraded []bool
+			l := newListener(NewContext(nil, mm, nil), "test0", conn, false)
+			l.grace = tt.grace
+			l.onDegraded = func(d bool) { degraded = append(degraded, d) }
+
+			if _, _, err := l.receiveRetry(context.Background()); err != nil {
+				t.Fatalf("failed to receive: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.degraded, degraded); diff != "" {
+				t.Fatalf("unexpected degraded states (-want +got):\n%s", diff)
+			}
+
+			for _, s := range []struct {
+				name    string
+				samples map[string]float64
+			}{
+				{name: msgReceiveRetries, samples: map[string]float64{"interface=test0": failures}},
+				{name: msgRetriesExhausted},
+			} {
+				got := findMetric(t, mm, s.name)
+				if diff := cmp.Diff(s.samples, got.Samples, cmpopts.EquateEmpty()); diff != "" {
+					t.Fatalf("unexpected %q metric (-want +got):\n%s", s.name, diff)
+				}
+			}
 		})
 	}
 }
 
+func Test_listenerReceiveRetryGraceExhausted(t *testing.T) {
+	t.Parallel()
+
+	// Errors which persist beyond the grace period degrade the listener, and
+	// then exhaust the fixed number of retries so the socket is reinitialized.
+	conn := &testConn{
+		readFrom: func() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+			return nil, nil, nil, timeoutError{}
+		},
+	}
+
+	mm := NewMetrics(metricslite.NewMemory(), nil, nil)
+
+	var degraded []bool
+	l := newListener(NewContext(nil, mm, nil), "test0", conn, false)
+	l.grace = 100 * time.Millisecond
+	l.onDegraded = func(d bool) { degraded = append(degraded, d) }
+
+	if _, _, err := l.receiveRetry(context.Background()); !errors.Is(err, errRetriesExhausted) {
+		t.Fatalf("expected retries exhausted error, but got: %v", err)
+	}
+
+	if diff := cmp.Diff([]bool{true}, degraded); diff != "" {
+		t.Fatalf("unexpected degraded states (-want +got):\n%s", diff)
+	}
+
+	got := findMetric(t, mm, msgRetriesExhausted)
+	if diff := cmp.Diff(map[string]float64{"interface=test0": 1}, got.Samples); diff != "" {
+		t.Fatalf("unexpected %q metric (-want +got):\n%s", msgRetriesExhausted, diff)
+	}
+}
+
+func Test_listenerCountDrops(t *testing.T) {
+	t.Parallel()
+
+	// The first count is a baseline, and drops are reported as the count
+	// increases thereafter.
+	counts := []uint64{5, 5, 8, 12}
+
+	var calls int
+	conn := &dropConn{
+		testConn: testConn{
+			readFrom: func() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+				return &ndp.RouterAdvertisement{}, &ipv6.ControlMessage{HopLimit: ndp.HopLimit}, net.IPv6loopback, nil
+			},
+		},
+		drops: func() (uint64, error) {
+			defer func() { calls++ }()
+			return counts[calls], nil
+		},
+	}
+
+	mm := NewMetrics(metricslite.NewMemory(), nil, nil)
+
+	l := newListener(NewContext(nil, mm, nil), "test0", conn, false)
+	l.dropInterval = 0
+
+	for range counts {
+		if _, _, err := l.receiveRetry(context.Background()); err != nil {
+			t.Fatalf("failed to receive: %v", err)
+		}
+	}
+
+	got := findMetric(t, mm, msgReceiveDrops)
+	if diff := cmp.Diff(map[string]float64{"interface=test0": 7}, got.Samples); diff != "" {
+		t.Fatalf("unexpected %q metric (-want +got):\n%s", msgReceiveDrops, diff)
+	}
+}
+
 var _ net.Error = timeoutError{}
 
 type timeoutError struct{}
@@ -182,3 +398,12 @@ func (c *testConn) SetReadDeadline(t time.Time) error
 func (c *testConn) WriteTo(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP) error {
 	return c.writeTo(m, cm, dst)
 }
+
+var _ system.DropCounter = &dropConn{}
+
+type dropConn struct {
+	testConn
+	drops func() (uint64, error)
+}
+
+func (c *dropConn) Drops() (uint64, error) { return c.drops() }
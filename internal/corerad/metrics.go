@@ -30,16 +30,55 @@ import (
 
 // Names of metrics which are referenced here and in tests.
 const (
+	httpBindErrors       = "corerad_http_bind_errors_total"
 	ifiAdvertising       = "corerad_interface_advertising"
 	ifiAutoconfiguration = "corerad_interface_autoconfiguration"
+	ifiBoundToDevice     = "corerad_interface_bound_to_device"
 	ifiForwarding        = "corerad_interface_forwarding"
 	ifiMonitoring        = "corerad_interface_monitoring"
 	msgInvalid           = "corerad_messages_received_invalid_total"
+	msgInvalidHopLimit   = "corerad_messages_received_invalid_hop_limit_total"
+	msgReceiveRetries    = "corerad_messages_receive_retries_total"
+	reloads              = "corerad_reloads_total"
+	msgRetriesExhausted  = "corerad_messages_receive_retries_exhausted_total"
+	msgReceiveDrops      = "corerad_messages_receive_drops_total"
 	advPrefixAutonomous  = "corerad_advertiser_prefix_autonomous"
 	advPrefixOnLink      = "corerad_advertiser_prefix_on_link"
 	advPrefixValid       = "corerad_advertiser_prefix_valid_seconds"
 	advPrefixPreferred   = "corerad_advertiser_prefix_preferred_seconds"
 	advInconsistencies   = "corerad_advertiser_inconsistencies_total"
+	advNonceMismatches   = "corerad_advertiser_nonce_mismatches_total"
+	advUpstreamHealthy   = "corerad_advertiser_upstream_healthy"
+	advVRRPMaster        = "corerad_advertiser_vrrp_master"
+	advDiagnostic        = "corerad_advertiser_diagnostic_messages_received_total"
+	advStalled           = "corerad_advertiser_stalled"
+	advSourceResolutions = "corerad_advertiser_source_address_resolutions_total"
+	advPersistent        = "corerad_advertiser_persistent_inconsistencies_total"
+	advPrefixes          = "corerad_advertiser_prefixes"
+	advPrefixesEmpty     = "corerad_advertiser_prefixes_empty_total"
+	advPluginsDropped    = "corerad_advertiser_plugins_dropped_total"
+	advShadow            = "corerad_advertiser_shadow_router_advertisements_total"
+	advRejected          = "corerad_advertiser_rejected_total"
+	advWithdrawn         = "corerad_advertiser_withdrawn"
+	advCordoned          = "corerad_advertiser_cordoned"
+	advReceiveDegraded   = "corerad_advertiser_receive_degraded"
+	advOptions           = "corerad_advertiser_options"
+	advSolicitedRepeats  = "corerad_advertiser_solicited_repeats_total"
+	advPacingDelay       = "corerad_advertiser_pacing_delay_seconds"
+	advPacingOffset      = "corerad_advertiser_pacing_offset_seconds"
+	advInterfaceWaiting  = "corerad_advertiser_interface_waiting"
+	advDebugFlags        = "corerad_advertiser_debug_flags_router_advertisements_total"
+	advDebugMulticast    = "corerad_advertiser_debug_multicast_router_advertisements_total"
+	advLinkTransitions   = "corerad_advertiser_link_transitions_total"
+	advMTUClamped        = "corerad_advertiser_mtu_clamped_total"
+	advSolicitedQueue    = "corerad_advertiser_solicited_queue_depth"
+	advSolicitedDropped  = "corerad_advertiser_solicited_dropped_total"
+	advScheduleDeviation = "corerad_advertiser_schedule_deviation_seconds"
+	advScheduleLate      = "corerad_advertiser_schedule_late_total"
+	advIPv4Addresses     = "corerad_advertiser_ipv4_addresses"
+	advLifetimesClamped  = "corerad_advertiser_lifetimes_clamped_total"
+	advRASize            = "corerad_advertiser_router_advertisement_size_bytes"
+	advSelfLoops         = "corerad_advertiser_self_loops_total"
 	monReceived          = "corerad_monitor_messages_received_total"
 	monDefaultRoute      = "corerad_monitor_default_route_expiration_timestamp_seconds"
 	monPrefixAutonomous  = "corerad_monitor_prefix_autonomous"
@@ -51,11 +90,18 @@ const (
 // Metrics contains metrics for a CoreRAD instance.
 type Metrics struct {
 	// General server metrics.
-	Info metricslite.Gauge
-	Time metricslite.Gauge
+	Info                metricslite.Gauge
+	Time                metricslite.Gauge
+	HTTPBindErrorsTotal metricslite.Counter
+	ReloadsTotal        metricslite.Counter
 
 	// Shared per-advertiser/monitor metrics.
-	MessagesReceivedInvalidTotal metricslite.Counter
+	MessagesReceivedInvalidTotal         metricslite.Counter
+	MessagesReceivedInvalidHopLimitTotal metricslite.Counter
+	MessagesReceiveRetriesTotal          metricslite.Counter
+	MessagesReceiveRetriesExhaustedTotal metricslite.Counter
+	MessagesReceiveDropsTotal            metricslite.Counter
+	InterfaceBoundToDevice               metricslite.Gauge
 
 	// Per-advertiser metrics.
 	AdvLastMulticastTime                       metricslite.Gauge
@@ -63,6 +109,38 @@ type Metrics struct {
 	AdvRouterAdvertisementInconsistenciesTotal metricslite.Counter
 	AdvRouterAdvertisementsTotal               metricslite.Counter
 	AdvErrorsTotal                             metricslite.Counter
+	AdvNonceMismatchesTotal                    metricslite.Counter
+	AdvUpstreamHealthy                         metricslite.Gauge
+	AdvVRRPMaster                              metricslite.Gauge
+	AdvDiagnosticMessagesReceivedTotal         metricslite.Counter
+	AdvStalled                                 metricslite.Gauge
+	AdvSourceAddressResolutionsTotal           metricslite.Counter
+	AdvPersistentInconsistenciesTotal          metricslite.Counter
+	AdvPrefixes                                metricslite.Gauge
+	AdvPrefixesEmptyTotal                      metricslite.Counter
+	AdvPluginsDroppedTotal                     metricslite.Counter
+	AdvShadowRouterAdvertisementsTotal         metricslite.Counter
+	AdvRejectedTotal                           metricslite.Counter
+	AdvWithdrawn                               metricslite.Gauge
+	AdvCordoned                                metricslite.Gauge
+	AdvReceiveDegraded                         metricslite.Gauge
+	AdvOptions                                 metricslite.Gauge
+	AdvSolicitedRepeatsTotal                   metricslite.Counter
+	AdvPacingDelay                             metricslite.Gauge
+	AdvPacingOffset                            metricslite.Gauge
+	AdvInterfaceWaiting                        metricslite.Gauge
+	AdvDebugFlagsRouterAdvertisementsTotal     metricslite.Counter
+	AdvDebugMulticastRouterAdvertisementsTotal metricslite.Counter
+	AdvLinkTransitionsTotal                    metricslite.Counter
+	AdvMTUClampedTotal                         metricslite.Counter
+	AdvSolicitedQueueDepth                     metricslite.Gauge
+	AdvSolicitedDroppedTotal                   metricslite.Counter
+	AdvScheduleDeviation                       metricslite.Gauge
+	AdvScheduleLateTotal                       metricslite.Counter
+	AdvIPv4Addresses                           metricslite.Gauge
+	AdvLifetimesClampedTotal                   metricslite.Counter
+	AdvRouterAdvertisementSize                 metricslite.Gauge
+	AdvSelfLoopsTotal                          metricslite.Counter
 
 	// Per-monitor metrics.
 	MonMessagesReceivedTotal                 metricslite.Counter
@@ -103,12 +181,53 @@ func NewMetrics(m metricslite.Interface, state system.State, ifis []config.Inter
 			"The UNIX timestamp of when this build of CoreRAD was produced.",
 		),
 
+		HTTPBindErrorsTotal: m.Counter(
+			httpBindErrors,
+			"The total number of times the debug HTTP server failed to bind its listener.",
+		),
+
+		ReloadsTotal: m.Counter(
+			reloads,
+			"The total number of configuration reload requests, partitioned by whether the new configuration was valid.",
+			"result",
+		),
+
 		MessagesReceivedInvalidTotal: m.Counter(
 			msgInvalid,
 			"The total number of invalid NDP messages received on an advertising or monitoring interface.",
 			"interface", "message",
 		),
 
+		MessagesReceivedInvalidHopLimitTotal: m.Counter(
+			msgInvalidHopLimit,
+			"The total number of NDP messages received with an IPv6 hop limit other than 255 on an advertising or monitoring interface.",
+			"interface", "message",
+		),
+
+		MessagesReceiveRetriesTotal: m.Counter(
+			msgReceiveRetries,
+			"The total number of times receiving NDP messages was retried after a temporary error or timeout on an advertising or monitoring interface.",
+			"interface",
+		),
+
+		MessagesReceiveRetriesExhaustedTotal: m.Counter(
+			msgRetriesExhausted,
+			"The total number of times receiving NDP messages failed after exhausting all retries on an advertising or monitoring interface.",
+			"interface",
+		),
+
+		MessagesReceiveDropsTotal: m.Counter(
+			msgReceiveDrops,
+			"The total number of packets dropped by the socket receive buffer on an advertising or monitoring interface, where the operating system reports them.",
+			"interface",
+		),
+
+		InterfaceBoundToDevice: m.Gauge(
+			ifiBoundToDevice,
+			"Indicates whether the NDP socket of an advertising or monitoring interface with bind_to_device set is bound to the interface using SO_BINDTODEVICE.",
+			"interface",
+		),
+
 		AdvLastMulticastTime: m.Gauge(
 			"corerad_advertiser_last_multicast_timestamp_seconds",
 			"The UNIX timestamp of when the last multicast router advertisement was sent from an advertising interface.",
@@ -139,6 +258,198 @@ func NewMetrics(m metricslite.Interface, state system.State, ifis []config.Inter
 			"interface", "error",
 		),
 
+		AdvNonceMismatchesTotal: m.Counter(
+			advNonceMismatches,
+			"The total number of NDP router advertisements received with a nonce which does not match any router solicitation observed by an advertiser.",
+			"interface",
+		),
+
+		AdvUpstreamHealthy: m.Gauge(
+			advUpstreamHealthy,
+			"Indicates whether or not an advertiser's upstream connectivity is healthy, and thus whether or not it advertises itself as a default router.",
+			"interface",
+		),
+
+		AdvVRRPMaster: m.Gauge(
+			advVRRPMaster,
+			"Indicates whether or not an advertiser is the VRRP master, and thus whether or not it advertises itself as a default router.",
+			"interface",
+		),
+
+		AdvDiagnosticMessagesReceivedTotal: m.Counter(
+			advDiagnostic,
+			"The total number of NDP messages observed but not acted upon by an advertiser in diagnostic mode.",
+			"interface", "message",
+		),
+
+		AdvStalled: m.Gauge(
+			advStalled,
+			"Indicates whether or not an advertiser has failed to send router advertisements within a multiple of its maximum interval, and may be stalled.",
+			"interface",
+		),
+
+		AdvSourceAddressResolutionsTotal: m.Counter(
+			advSourceResolutions,
+			"The total number of times an advertiser re-resolved its link-local source address after it became unavailable.",
+			"interface",
+		),
+
+		AdvPersistentInconsistenciesTotal: m.Counter(
+			advPersistent,
+			"The total number of times another router's NDP router advertisements remained inconsistent with this advertiser's configuration for longer than the conflict window, partitioned by the problematic field.",
+			"interface", "details", "field",
+		),
+
+		AdvPrefixes: m.Gauge(
+			advPrefixes,
+			"The number of NDP Prefix Information options in the last router advertisement sent by an advertiser.",
+			"interface",
+		),
+
+		AdvPrefixesEmptyTotal: m.Counter(
+			advPrefixesEmpty,
+			"The total number of router advertisements sent by an advertiser in which a ::/N prefix matched no prefixes on its interface.",
+			"interface", "prefix",
+		),
+
+		AdvPluginsDroppedTotal: m.Counter(
+			advPluginsDropped,
+			"The total number of times a plugin was dropped from a router advertisement sent by an advertiser to fit within its size budget.",
+			"interface", "plugin",
+		),
+
+		AdvShadowRouterAdvertisementsTotal: m.Counter(
+			advShadow,
+			"The total number of NDP router advertisements which an advertiser in shadow mode logged rather than sent.",
+			"interface", "type",
+		),
+
+		AdvRejectedTotal: m.Counter(
+			advRejected,
+			"The total number of times an advertiser was not started because the limit on advertising interfaces was reached.",
+			"interface",
+		),
+
+		AdvWithdrawn: m.Gauge(
+			advWithdrawn,
+			"Indicates whether an advertiser is withdrawn, advertising a router lifetime of zero and no prefixes.",
+			"interface",
+		),
+
+		AdvCordoned: m.Gauge(
+			advCordoned,
+			"Indicates whether an advertiser is cordoned, advertising a router lifetime of zero but retaining its prefixes.",
+			"interface",
+		),
+
+		AdvReceiveDegraded: m.Gauge(
+			advReceiveDegraded,
+			"Indicates whether an advertiser's receive errors have persisted beyond its receive grace period.",
+			"interface",
+		),
+
+		AdvOptions: m.Gauge(
+			advOptions,
+			"Indicates whether or not an NDP option type is present in the last router advertisement built by an advertiser.",
+			"interface", "option",
+		),
+
+		AdvSolicitedRepeatsTotal: m.Counter(
+			advSolicitedRepeats,
+			"The total number of additional router advertisements sent by an advertiser in response to router solicitations, to improve delivery on lossy links.",
+			"interface",
+		),
+
+		AdvPacingDelay: m.Gauge(
+			advPacingDelay,
+			"The delay applied to the last unsolicited multicast router advertisement sent by an advertiser, to pace it with those of other advertisers.",
+			"interface",
+		),
+
+		AdvPacingOffset: m.Gauge(
+			advPacingOffset,
+			"The time within the pacing cycle at which an advertiser last sent an unsolicited multicast router advertisement, describing the distribution of send times across advertisers.",
+			"interface",
+		),
+
+		AdvInterfaceWaiting: m.Gauge(
+			advInterfaceWaiting,
+			"Indicates whether an advertiser is waiting for its interface to be created.",
+			"interface",
+		),
+
+		AdvDebugFlagsRouterAdvertisementsTotal: m.Counter(
+			advDebugFlags,
+			"The total number of router advertisements sent with experimental, non-standard debug flags set for interoperability testing.",
+			"interface",
+		),
+
+		AdvDebugMulticastRouterAdvertisementsTotal: m.Counter(
+			advDebugMulticast,
+			"The total number of multicast router advertisements sent to an experimental, non-standard debug multicast group for testing.",
+			"interface",
+		),
+
+		AdvLinkTransitionsTotal: m.Counter(
+			advLinkTransitions,
+			"The total number of link state transitions observed by an advertiser which tracks the operational state of its interface.",
+			"interface", "state",
+		),
+
+		AdvMTUClampedTotal: m.Counter(
+			advMTUClamped,
+			"The total number of times an MTU derived from an advertiser's interface was less than the IPv6 minimum of 1280 and was clamped to the minimum.",
+			"interface",
+		),
+
+		AdvSolicitedQueueDepth: m.Gauge(
+			advSolicitedQueue,
+			"The number of unicast router advertisements waiting to be sent by an advertiser's solicited response workers.",
+			"interface",
+		),
+
+		AdvSolicitedDroppedTotal: m.Counter(
+			advSolicitedDropped,
+			"The total number of unicast router advertisements dropped by an advertiser because its solicited response queue was full.",
+			"interface",
+		),
+
+		AdvScheduleDeviation: m.Gauge(
+			advScheduleDeviation,
+			"How much later than scheduled an advertiser's most recent unsolicited multicast router advertisement was sent, relative to the previous one.",
+			"interface",
+		),
+
+		AdvScheduleLateTotal: m.Counter(
+			advScheduleLate,
+			"The total number of unsolicited multicast router advertisements which were sent at least one second later than scheduled, indicating an overloaded system.",
+			"interface",
+		),
+
+		AdvIPv4Addresses: m.Gauge(
+			advIPv4Addresses,
+			"The number of IPv4 addresses found on an advertising interface which is configured to be IPv6-only.",
+			"interface",
+		),
+
+		AdvLifetimesClampedTotal: m.Counter(
+			advLifetimesClamped,
+			"The total number of router advertisement lifetimes which exceeded the configured maximum lifetime and were clamped.",
+			"interface",
+		),
+
+		AdvRouterAdvertisementSize: m.Gauge(
+			advRASize,
+			"The size in bytes of the most recent router advertisement sent by an advertiser, excluding the IPv6 header.",
+			"interface",
+		),
+
+		AdvSelfLoopsTotal: m.Counter(
+			advSelfLoops,
+			"The total number of router advertisements sent by an advertiser which were looped back and received by it, and excluded from consistency checks.",
+			"interface",
+		),
+
 		MonMessagesReceivedTotal: m.Counter(
 			monReceived,
 			"The total number of valid NDP messages received on a monitoring interface.",
@@ -334,6 +645,124 @@ func collectMetrics(metrics map[string]func(float64, ...string), mctx metricsCon
 	}
 }
 
+// PartitionMetrics produces a metricslite.Interface which registers all metrics
+// to all, and additionally registers any metrics with an "interface" label to
+// each metricslite.Interface in ifaces, keyed by interface name. Samples for an
+// interface are only reported to that interface's metricslite.Interface, so
+// that each interface's metrics may be exposed separately.
+func PartitionMetrics(all metricslite.Interface, ifaces map[string]metricslite.Interface) metricslite.Interface {
+	return &partition{
+		all:    all,
+		ifaces: ifaces,
+		consts: make(map[string]int),
+	}
+}
+
+var _ metricslite.Interface = &partition{}
+
+// A partition is a metricslite.Interface which partitions metrics by interface.
+type partition struct {
+	all    metricslite.Interface
+	ifaces map[string]metricslite.Interface
+
+	// consts maps const metric names to the index of their interface label.
+	consts map[string]int
+}
+
+// ConstGauge implements metricslite.Interface.
+func (p *partition) ConstGauge(name, help string, labelNames ...string) {
+	p.all.ConstGauge(name, help, labelNames...)
+
+	idx := interfaceLabel(labelNames)
+	if idx == -1 {
+		return
+	}
+
+	p.consts[name] = idx
+	for _, m := range p.ifaces {
+		m.ConstGauge(name, help, labelNames...)
+	}
+}
+
+// Counter implements metricslite.Interface.
+func (p *partition) Counter(name, help string, labelNames ...string) metricslite.Counter {
+	all := p.all.Counter(name, help, labelNames...)
+
+	idx := interfaceLabel(labelNames)
+	if idx == -1 {
+		return all
+	}
+
+	cs := make(map[string]metricslite.Counter, len(p.ifaces))
+	for ifi, m := range p.ifaces {
+		cs[ifi] = m.Counter(name, help, labelNames...)
+	}
+
+	return func(value float64, labels ...string) {
+		all(value, labels...)
+		if c, ok := cs[labels[idx]]; ok {
+			c(value, labels...)
+		}
+	}
+}
+
+// Gauge implements metricslite.Interface.
+func (p *partition) Gauge(name, help string, labelNames ...string) metricslite.Gauge {
+	all := p.all.Gauge(name, help, labelNames...)
+
+	idx := interfaceLabel(labelNames)
+	if idx == -1 {
+		return all
+	}
+
+	gs := make(map[string]metricslite.Gauge, len(p.ifaces))
+	for ifi, m := range p.ifaces {
+		gs[ifi] = m.Gauge(name, help, labelNames...)
+	}
+
+	return func(value float64, labels ...string) {
+		all(value, labels...)
+		if g, ok := gs[labels[idx]]; ok {
+			g(value, labels...)
+		}
+	}
+}
+
+// OnConstScrape implements metricslite.Interface.
+func (p *partition) OnConstScrape(fn metricslite.ScrapeFunc) {
+	p.all.OnConstScrape(fn)
+
+	for ifi, m := range p.ifaces {
+		ifi := ifi
+		m.OnConstScrape(func(metrics map[string]func(float64, ...string)) error {
+			// Only report samples for this interface.
+			filtered := make(map[string]func(float64, ...string), len(metrics))
+			for name, c := range metrics {
+				idx, c := p.consts[name], c
+				filtered[name] = func(value float64, labels ...string) {
+					if labels[idx] == ifi {
+						c(value, labels...)
+					}
+				}
+			}
+
+			return fn(filtered)
+		})
+	}
+}
+
+// interfaceLabel returns the index of the "interface" label in labelNames,
+// or -1 if none is present.
+func interfaceLabel(labelNames []string) int {
+	for i, l := range labelNames {
+		if l == "interface" {
+			return i
+		}
+	}
+
+	return -1
+}
+
 // Series produces a set of output timeseries from the Metrics, assuming the
 // Metrics were initialized with a compatible metricslite.Interface. If not, Series
 // will return nil, false.
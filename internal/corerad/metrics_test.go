@@ -156,24 +156,104 @@ func TestMetrics(t *testing.T) {
 				t.Fatalf("type %T does not support fetching timeseries", mm)
 			}
 
-			// Skip empty timeseries for output comparison, and remove name
-			// (redundant with key) and help text to make fixtures more concise.
-			series := make(map[string]metricslite.Series)
-			for k, v := range raw {
-				if len(v.Samples) > 0 {
-					v.Name = ""
-					v.Help = ""
-					series[k] = v
-				}
+			if diff := cmp.Diff(tt.series, nonEmptySeries(raw)); diff != "" {
+				t.Fatalf("unexpected timeseries (-want +got):\n%s", diff)
 			}
+		})
+	}
+}
 
-			if diff := cmp.Diff(tt.series, series); diff != "" {
+func TestPartitionMetrics(t *testing.T) {
+	var (
+		all  = metricslite.NewMemory()
+		eth0 = metricslite.NewMemory()
+		eth1 = metricslite.NewMemory()
+
+		ifis = []config.Interface{
+			{Name: "eth0", Monitor: true},
+			{Name: "eth1", Advertise: true},
+		}
+	)
+
+	mm := NewMetrics(
+		PartitionMetrics(all, map[string]metricslite.Interface{
+			"eth0": eth0,
+			"eth1": eth1,
+		}),
+		system.TestState{Forwarding: true},
+		ifis,
+	)
+
+	mm.AdvErrorsTotal(1.0, "eth1", "transmit")
+
+	var (
+		wan = map[string]metricslite.Series{
+			ifiAdvertising:       {Samples: map[string]float64{"interface=eth0": 0}},
+			ifiAutoconfiguration: {Samples: map[string]float64{"interface=eth0": 0}},
+			ifiForwarding:        {Samples: map[string]float64{"interface=eth0": 1}},
+			ifiMonitoring:        {Samples: map[string]float64{"interface=eth0": 1}},
+		}
+
+		lan = map[string]metricslite.Series{
+			ifiAdvertising:       {Samples: map[string]float64{"interface=eth1": 1}},
+			ifiAutoconfiguration: {Samples: map[string]float64{"interface=eth1": 0}},
+			ifiForwarding:        {Samples: map[string]float64{"interface=eth1": 1}},
+			ifiMonitoring:        {Samples: map[string]float64{"interface=eth1": 0}},
+			"corerad_advertiser_errors_total": {
+				Samples: map[string]float64{"interface=eth1,error=transmit": 1},
+			},
+		}
+	)
+
+	tests := []struct {
+		name   string
+		m      *metricslite.Memory
+		series map[string]metricslite.Series
+	}{
+		{
+			name: "all",
+			m:    all,
+			series: mergeSeries(wan, lan, map[string]metricslite.Series{
+				"corerad_build_info":              {Samples: map[string]float64{"version=development": 1}},
+				"corerad_build_timestamp_seconds": {Samples: map[string]float64{"": 0}},
+			}),
+		},
+		{
+			name:   "eth0",
+			m:      eth0,
+			series: mergeSeries(wan),
+		},
+		{
+			name:   "eth1",
+			m:      eth1,
+			series: mergeSeries(lan),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.series, nonEmptySeries(tt.m.Series())); diff != "" {
 				t.Fatalf("unexpected timeseries (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
+// nonEmptySeries skips empty timeseries for output comparison, and removes
+// name (redundant with key) and help text to make fixtures more concise.
+func nonEmptySeries(raw map[string]metricslite.Series) map[string]metricslite.Series {
+	series := make(map[string]metricslite.Series)
+	for k, v := range raw {
+		if len(v.Samples) > 0 {
+			v.Name = ""
+			v.Help = ""
+			series[k] = v
+		}
+	}
+
+	return series
+}
+
 // mergeSeries allows merging multiple timeseries maps into a single one.
 func mergeSeries(series ...map[string]metricslite.Series) map[string]metricslite.Series {
 	out := make(map[string]metricslite.Series)
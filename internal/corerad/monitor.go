@@ -36,6 +36,7 @@ type Monitor struct {
 	cctx    *Context
 	iface   string
 	verbose bool
+	lenient bool
 
 	// Socket creation and system state manipulation.
 	dialer *system.Dialer
@@ -50,18 +51,20 @@ type Monitor struct {
 }
 
 // NewMonitor creates a Monitor for the specified interface. If ll is nil, logs
-// are discarded. If mm is nil, metrics are discarded.
+// are discarded. If mm is nil, metrics are discarded. If lenient is true,
+// messages with an invalid IPv6 hop limit are processed rather than dropped.
 func NewMonitor(
 	cctx *Context,
 	iface string,
 	dialer *system.Dialer,
 	watchC <-chan netstate.Change,
-	verbose bool,
+	verbose, lenient bool,
 ) *Monitor {
 	return &Monitor{
 		cctx:    cctx,
 		iface:   iface,
 		verbose: verbose,
+		lenient: lenient,
 		dialer:  dialer,
 		watchC:  watchC,
 		readyC:  make(chan struct{}),
@@ -110,7 +113,7 @@ func (m *Monitor) monitor(ctx context.Context, conn system.Conn) error {
 
 	// Listener which listens for and reports on NDP traffic.
 	eg.Go(func() error {
-		l := newListener(m.cctx, m.iface, conn)
+		l := newListener(m.cctx, m.iface, conn, m.lenient)
 		return l.Listen(ctx, func(msg message) error {
 			m.handle(msg.Message, msg.Host.String())
 
@@ -169,6 +169,7 @@ func testSimulatedMonitorClient(t *testing.T, onMessage func(m ndp.Message)) *cl
 		nil,
 		// Enable verbose logs for better debuggability.
 		true,
+		false,
 	)
 
 	mon.OnMessage = onMessage
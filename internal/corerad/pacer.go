@@ -0,0 +1,104 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package corerad
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mdlayher/corerad/internal/config"
+)
+
+// A pacer spreads the unsolicited multicast router advertisements of several
+// Advertisers over time, so that Advertisers with aligned intervals do not
+// send in bursts.
+type pacer struct {
+	// gap is the minimum time between multicast router advertisements sent by
+	// any Advertiser, and cycle is the time in which every Advertiser may send
+	// once, measured from epoch.
+	gap, cycle time.Duration
+	epoch      time.Time
+
+	// mu guards next, the earliest time that the next multicast router
+	// advertisement may be sent.
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newPacer creates a pacer for the advertising interfaces in ifis which send
+// multicast router advertisements, spreading them evenly over the smallest
+// minimum interval. It returns nil if no interfaces require pacing.
+func newPacer(ifis []config.Interface, now time.Time) *pacer {
+	var (
+		n   int
+		min time.Duration
+	)
+
+	for _, ifi := range ifis {
+		if !ifi.Advertise || ifi.UnicastOnly {
+			continue
+		}
+
+		n++
+		if min == 0 || ifi.MinInterval < min {
+			min = ifi.MinInterval
+		}
+	}
+
+	if n < 2 {
+		// Nothing to coordinate.
+		return nil
+	}
+
+	gap := min / time.Duration(n)
+	return &pacer{
+		gap:   gap,
+		cycle: gap * time.Duration(n),
+		epoch: now,
+	}
+}
+
+// reserve reserves the next send time at or after now and returns the delay
+// until that time. If the delay would exceed limit, no time is reserved and
+// limit is returned so the caller's own schedule takes priority.
+func (p *pacer) reserve(now time.Time, limit time.Duration) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := now
+	if p.next.After(t) {
+		t = p.next
+	}
+
+	delay := t.Sub(now)
+	if delay > limit {
+		if limit < 0 {
+			return 0
+		}
+
+		return limit
+	}
+
+	p.next = t.Add(p.gap)
+	return delay
+}
+
+// offset reports the time within the current cycle at which t occurs.
+func (p *pacer) offset(t time.Time) time.Duration {
+	if p.cycle == 0 {
+		return 0
+	}
+
+	return t.Sub(p.epoch) % p.cycle
+}
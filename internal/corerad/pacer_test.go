@@ -0,0 +1,123 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package corerad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/config"
+)
+
+func Test_newPacer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		ifis       []config.Interface
+		gap, cycle time.Duration
+		ok         bool
+	}{
+		{
+			name: "single",
+			ifis: []config.Interface{
+				{Advertise: true, MinInterval: 200 * time.Second},
+			},
+		},
+		{
+			name: "skipped",
+			ifis: []config.Interface{
+				{Advertise: true, MinInterval: 200 * time.Second},
+				{Advertise: true, UnicastOnly: true, MinInterval: 200 * time.Second},
+				{Monitor: true},
+			},
+		},
+		{
+			name: "OK",
+			ifis: []config.Interface{
+				{Advertise: true, MinInterval: 200 * time.Second},
+				{Advertise: true, MinInterval: 30 * time.Second},
+				{Advertise: true, MinInterval: 200 * time.Second},
+			},
+			gap:   10 * time.Second,
+			cycle: 30 * time.Second,
+			ok:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := newPacer(tt.ifis, time.Unix(0, 0))
+			if !tt.ok {
+				if p != nil {
+					t.Fatalf("expected no pacer, but got: %+v", p)
+				}
+				return
+			}
+
+			if diff := cmp.Diff(tt.gap, p.gap); diff != "" {
+				t.Fatalf("unexpected gap (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.cycle, p.cycle); diff != "" {
+				t.Fatalf("unexpected cycle (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPacerReserve(t *testing.T) {
+	t.Parallel()
+
+	var (
+		epoch = time.Unix(0, 0)
+		p     = newPacer([]config.Interface{
+			{Advertise: true, MinInterval: 30 * time.Second},
+			{Advertise: true, MinInterval: 30 * time.Second},
+			{Advertise: true, MinInterval: 30 * time.Second},
+		}, epoch)
+	)
+
+	// Advertisers which attempt to send at the same time are spread apart,
+	// unless doing so would exceed their limit.
+	tests := []struct {
+		now           time.Duration
+		limit         time.Duration
+		delay, offset time.Duration
+	}{
+		{now: 0, limit: time.Minute, delay: 0, offset: 0},
+		{now: 0, limit: time.Minute, delay: 10 * time.Second, offset: 10 * time.Second},
+		{now: 0, limit: 5 * time.Second, delay: 5 * time.Second, offset: 5 * time.Second},
+		{now: 0, limit: time.Minute, delay: 20 * time.Second, offset: 20 * time.Second},
+		{now: 0, limit: -time.Second, delay: 0, offset: 0},
+		// Once the burst is over, advertisers send immediately.
+		{now: 45 * time.Second, limit: time.Minute, delay: 0, offset: 15 * time.Second},
+	}
+
+	for i, tt := range tests {
+		now := epoch.Add(tt.now)
+
+		delay := p.reserve(now, tt.limit)
+		if diff := cmp.Diff(tt.delay, delay); diff != "" {
+			t.Fatalf("%d: unexpected delay (-want +got):\n%s", i, diff)
+		}
+
+		if diff := cmp.Diff(tt.offset, p.offset(now.Add(delay))); diff != "" {
+			t.Fatalf("%d: unexpected offset (-want +got):\n%s", i, diff)
+		}
+	}
+}
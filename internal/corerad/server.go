@@ -27,9 +27,11 @@ import (
 
 	"github.com/mdlayher/corerad/internal/config"
 	"github.com/mdlayher/corerad/internal/netstate"
+	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/sdnotify"
 	"golang.org/x/sync/errgroup"
+	"inet.af/netaddr"
 )
 
 // A Server coordinates the goroutines that handle various pieces of the
@@ -38,6 +40,32 @@ type Server struct {
 	cctx *Context
 	t    *terminator
 	w    *netstate.Watcher
+
+	// Load, if set, loads and verifies a new configuration so that Reload
+	// may reload the Server. Because Reload shuts down the Server rather than
+	// reloading it in place, Load should only be set if a process supervisor
+	// will restart CoreRAD with the new configuration.
+	Load func() (*config.Config, error)
+
+	// Files, if set, contains sockets passed to the process by systemd socket
+	// activation, keyed by name. See system.ListenFiles for details.
+	Files map[string]*os.File
+
+	// Advertisers by interface name, populated by BuildTasks before serving.
+	advertisers map[string]*Advertiser
+
+	// cfg is the running configuration, populated by BuildTasks. reloadMu
+	// serializes Reload calls, which request a reload using reloadC.
+	cfg      config.Config
+	reloadMu sync.Mutex
+	reloadC  chan struct{}
+
+	// events records notable events for the debug API, populated by
+	// BuildTasks if the debug API is enabled.
+	events *system.EventLog
+
+	// usedFiles tracks which Files are used by BuildTasks.
+	usedFiles map[string]bool
 }
 
 // NewServer creates a Server with the input configuration and logger. If ll
@@ -47,7 +75,166 @@ func NewServer(cctx *Context) *Server {
 		cctx: cctx,
 		t:    &terminator{},
 		w:    netstate.NewWatcher(),
+
+		advertisers: make(map[string]*Advertiser),
+		reloadC:     make(chan struct{}, 1),
+	}
+}
+
+// Reload loads and verifies a new configuration using Load and, if it is
+// valid, shuts down the Server as if SIGHUP were received so that a process
+// supervisor restarts CoreRAD with the new configuration. It returns a summary
+// of the differences from the running configuration. Reloads are serialized,
+// and a reload while another is pending has no further effect.
+//
+// Reload refuses to shut down the Server unless Load is set, since without a
+// process supervisor to restart CoreRAD, a reload would stop advertising
+// entirely. It then returns an error which can be checked using
+// errors.Is(err, os.ErrNotExist).
+func (s *Server) Reload() ([]string, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.Load == nil {
+		return nil, fmt.Errorf("corerad: configuration reloading is not enabled without a process supervisor to restart CoreRAD: %w", os.ErrNotExist)
+	}
+
+	cfg, err := s.Load()
+	if err != nil {
+		s.cctx.mm.ReloadsTotal(1.0, "error")
+		s.cctx.ll.Printf("refusing to reload with invalid configuration: %v", err)
+		s.events.Add(system.EventReload, "", "refusing to reload with invalid configuration: %v", err)
+		return nil, err
+	}
+
+	changes := config.Diff(s.cfg, *cfg)
+
+	select {
+	case s.reloadC <- struct{}{}:
+		s.cctx.ll.Printf("reload requested with %d configuration change(s)", len(changes))
+		s.events.Add(system.EventReload, "", "reload requested with %d configuration change(s)", len(changes))
+	default:
+		// A reload is already pending.
+	}
+
+	s.cctx.mm.ReloadsTotal(1.0, "success")
+	return changes, nil
+}
+
+// Advertise requests that the Advertiser for iface immediately send an
+// unsolicited multicast router advertisement. See Advertiser.Advertise for
+// details. It returns an error which can be checked using
+// errors.Is(err, os.ErrNotExist) if iface is not advertising.
+func (s *Server) Advertise(iface string) (time.Duration, error) {
+	a, err := s.advertiser(iface)
+	if err != nil {
+		return 0, err
+	}
+
+	return a.Advertise()
+}
+
+// Withdraw withdraws the Advertiser for iface if withdraw is true, or promotes
+// it if withdraw is false. See Advertiser.Withdraw for details. It returns an
+// error which can be checked using errors.Is(err, os.ErrNotExist) if iface is
+// not advertising.
+func (s *Server) Withdraw(iface string, withdraw bool) error {
+	a, err := s.advertiser(iface)
+	if err != nil {
+		return err
+	}
+
+	a.Withdraw(withdraw)
+	return nil
+}
+
+// Cordon cordons the Advertiser for iface if cordon is true, or uncordons it
+// if cordon is false. See Advertiser.Cordon for details. It returns an error
+// which can be checked using errors.Is(err, os.ErrNotExist) if iface is not
+// advertising.
+func (s *Server) Cordon(iface string, cordon bool) (time.Duration, error) {
+	a, err := s.advertiser(iface)
+	if err != nil {
+		return 0, err
 	}
+
+	return a.Cordon(cordon), nil
+}
+
+// Status reports whether the Advertiser for iface is withdrawn or cordoned,
+// whether it has been initialized and is ready, whether it is waiting for
+// iface to be created, and the state of its link if link state tracking is
+// enabled. It returns an error which can be checked using
+// errors.Is(err, os.ErrNotExist) if iface is not advertising.
+func (s *Server) Status(iface string) (withdrawn, cordoned, ready, waiting bool, link string, err error) {
+	a, err := s.advertiser(iface)
+	if err != nil {
+		return false, false, false, false, "", err
+	}
+
+	// An Advertiser whose receive errors have outlasted its grace period is
+	// no longer considered ready until it recovers.
+	select {
+	case <-a.Ready():
+		ready = !a.Degraded()
+	default:
+	}
+
+	return a.Withdrawn(), a.Cordoned(), ready, a.Waiting(), a.LinkState(), nil
+}
+
+// RouterLifetime reports the router lifetime currently advertised by the
+// Advertiser for iface, and whether it is still ramping up to its configured
+// default lifetime. See Advertiser.RouterLifetime for details. It returns an
+// error which can be checked using errors.Is(err, os.ErrNotExist) if iface is
+// not advertising.
+func (s *Server) RouterLifetime(iface string) (time.Duration, bool, error) {
+	a, err := s.advertiser(iface)
+	if err != nil {
+		return 0, false, err
+	}
+
+	lifetime, ramping := a.RouterLifetime()
+	return lifetime, ramping, nil
+}
+
+// Events returns the recent events recorded by the Server and its Advertisers,
+// from oldest to newest.
+func (s *Server) Events() []system.Event { return s.events.Events() }
+
+// file fetches the socket activation file with the specified name, or nil if
+// there is no such file.
+func (s *Server) file(name string) *os.File {
+	f, ok := s.Files[name]
+	if !ok {
+		return nil
+	}
+
+	if s.usedFiles == nil {
+		s.usedFiles = make(map[string]bool)
+	}
+	s.usedFiles[name] = true
+
+	s.cctx.ll.Printf("using %q socket passed by socket activation", name)
+	return f
+}
+
+// bound returns a function which reports whether the NDP socket for iface is
+// bound to the interface in metrics.
+func (s *Server) bound(iface string) func(bound bool) {
+	return func(bound bool) {
+		s.cctx.mm.InterfaceBoundToDevice(boolFloat(bound), iface)
+	}
+}
+
+// advertiser fetches the Advertiser for iface.
+func (s *Server) advertiser(iface string) (*Advertiser, error) {
+	a, ok := s.advertisers[iface]
+	if !ok {
+		return nil, fmt.Errorf("corerad: no advertiser for interface %q: %w", iface, os.ErrNotExist)
+	}
+
+	return a, nil
 }
 
 // A Task is a Server-owned task which will run until the input context is
@@ -69,9 +256,36 @@ type Task interface {
 // expect to be terminated and stopped or immediately reloaded by a supervision
 // daemon.
 func (s *Server) BuildTasks(cfg config.Config, debug http.Handler) []Task {
+	s.cfg = cfg
+
+	// Events are only served by the debug API.
+	if cfg.Debug.Address != "" && cfg.Debug.MaxEvents > 0 {
+		s.events = system.NewEventLog(cfg.Debug.MaxEvents)
+	}
+
+	// Non-standard multicast router advertisements are only sent for testing.
+	var debugGroup netaddr.IP
+	if g := cfg.Debug.ExperimentalMulticastGroup; g != "" {
+		ip, err := netaddr.ParseIP(g)
+		if err != nil {
+			panicf("corerad: invalid experimental multicast group, should have been validated: %v", err)
+		}
+
+		debugGroup = ip
+		s.cctx.ll.Printf("WARNING: EXPERIMENTAL: multicast router advertisements will be sent to non-compliant group %s with hop limit %d, which hosts will ignore; never enable this outside of testing",
+			debugGroup, cfg.Debug.ExperimentalMulticastHopLimit)
+	}
+
 	// Serve on each specified interface.
 	var tasks []Task
 	for _, ifi := range cfg.Interfaces {
+		if ifi.Rejected {
+			s.cctx.ll.Printf("%s: refusing to start advertiser, the limit of %d advertising interfaces has been reached",
+				ifi.Name, cfg.MaxAdvertisers)
+			s.cctx.mm.AdvRejectedTotal(1.0, ifi.Name)
+			continue
+		}
+
 		if !ifi.Advertise && !ifi.Monitor {
 			s.cctx.ll.Printf("%s: interface is not advertising or monitoring, skipping initialization", ifi.Name)
 			continue
@@ -91,23 +305,85 @@ func (s *Server) BuildTasks(cfg config.Config, debug http.Handler) []Task {
 		switch {
 		case ifi.Advertise:
 			dialer := system.NewDialer(ifi.Name, s.cctx.state, system.Advertise, s.cctx.ll)
+			dialer.BindToDevice = ifi.BindToDevice
+			dialer.OnBind = s.bound(ifi.Name)
+			dialer.WaitForInterface = ifi.WaitForInterface
+			dialer.WaitForLink = ifi.TrackLinkState
+			dialer.Netns = ifi.Netns
+			dialer.Trunk, dialer.VLAN = ifi.Trunk, ifi.VLAN
+			setSource(dialer, ifi)
+			dialer.Diagnostic = cfg.Debug.NDPDiagnostics
+			dialer.Shadow = ifi.Shadow
+			dialer.File = s.file(system.ActivationNDPPrefix + ifi.Name)
+			dialer.ReceiveBuffer, dialer.SendBuffer = ifi.ReceiveBuffer, ifi.SendBuffer
+
+			if ifi.Shadow {
+				s.cctx.ll.Printf("%s: SHADOW MODE: router advertisements will be logged but never sent", ifi.Name)
+			}
 
-			tasks = append(
-				tasks,
-				NewAdvertiser(s.cctx, ifi, dialer, watchC, s.t.terminate),
-			)
+			for _, w := range ifi.Warnings() {
+				s.cctx.ll.Printf("%s: warning: %s", ifi.Name, w)
+			}
+
+			a := NewAdvertiser(s.cctx, ifi, dialer, watchC, s.t.terminate)
+			a.debugFlags = cfg.Debug.ExperimentalRAFlags
+			a.debugGroup, a.debugHopLimit = debugGroup, uint8(cfg.Debug.ExperimentalMulticastHopLimit)
+			a.events = s.events
+			dialer.OnWait = a.wait
+
+			// Watch for address changes on any upstream interfaces from which
+			// prefixes are derived.
+			if s.w != nil {
+				for _, p := range ifi.AllPlugins() {
+					d, ok := p.(*plugin.DelegatedPrefix)
+					if !ok {
+						continue
+					}
+
+					if _, ok := a.delegatedC[d.Interface]; !ok {
+						a.delegatedC[d.Interface] = s.w.Subscribe(d.Interface, netstate.AddressChange)
+					}
+				}
+			}
+
+			s.advertisers[ifi.Name] = a
+
+			// Supervise each Advertiser so a failure on one interface does
+			// not stop advertising on the others.
+			tasks = append(tasks, newSupervisor(a))
 		case ifi.Monitor:
 			dialer := system.NewDialer(ifi.Name, s.cctx.state, system.Monitor, s.cctx.ll)
+			dialer.BindToDevice = ifi.BindToDevice
+			dialer.OnBind = s.bound(ifi.Name)
+			dialer.WaitForInterface = ifi.WaitForInterface
+			dialer.Netns = ifi.Netns
+			dialer.Trunk, dialer.VLAN = ifi.Trunk, ifi.VLAN
+			setSource(dialer, ifi)
+			dialer.File = s.file(system.ActivationNDPPrefix + ifi.Name)
+			dialer.ReceiveBuffer, dialer.SendBuffer = ifi.ReceiveBuffer, ifi.SendBuffer
 
 			tasks = append(
 				tasks,
-				NewMonitor(s.cctx, ifi.Name, dialer, watchC, ifi.Verbose),
+				NewMonitor(s.cctx, ifi.Name, dialer, watchC, ifi.Verbose, ifi.LenientHopLimit),
 			)
 		default:
 			panicf("corerad: Server interface %q is not advertising or monitoring", ifi.Name)
 		}
 	}
 
+	// Optionally pace unsolicited multicast router advertisements across all
+	// advertisers.
+	if cfg.PaceMulticast {
+		if p := newPacer(cfg.Interfaces, time.Now()); p != nil {
+			s.cctx.ll.Printf("pacing unsolicited multicast router advertisements %s apart across all interfaces", p.gap)
+			for _, a := range s.advertisers {
+				if !a.cfg.UnicastOnly {
+					a.pacer = p
+				}
+			}
+		}
+	}
+
 	// Optionally configure the debug HTTP server task.
 	if d := cfg.Debug; d.Address != "" {
 		s.cctx.ll.Printf("starting HTTP debug listener on %q: prometheus: %t, pprof: %t",
@@ -115,12 +391,24 @@ func (s *Server) BuildTasks(cfg config.Config, debug http.Handler) []Task {
 
 		tasks = append(tasks, &httpTask{
 			addr:   d.Address,
+			file:   s.file(system.ActivationHTTP),
 			h:      debug,
 			ll:     s.cctx.ll,
+			mm:     s.cctx.mm,
+			strict: d.StrictHTTP,
 			readyC: make(chan struct{}),
+			failC:  make(chan struct{}),
 		})
 	}
 
+	// Sockets which were passed to the process but are not used will never
+	// serve any traffic, which likely indicates a misconfiguration.
+	for name := range s.Files {
+		if !s.usedFiles[name] {
+			s.cctx.ll.Printf("warning: ignoring unused socket activation file %q", name)
+		}
+	}
+
 	// Optionally configure the link state watcher task.
 	if s.w != nil {
 		tasks = append(tasks, &watcherTask{
@@ -146,11 +434,12 @@ func (s *Server) Serve(sigC chan os.Signal, n *sdnotify.Notifier, tasks []Task)
 	defer cancel()
 
 	tasks = append(tasks, &signalTask{
-		sigC:   sigC,
-		cancel: cancel,
-		ll:     s.cctx.ll,
-		n:      n,
-		t:      s.t,
+		sigC:    sigC,
+		reloadC: s.reloadC,
+		cancel:  cancel,
+		ll:      s.cctx.ll,
+		n:       n,
+		t:       s.t,
 	})
 
 	var wg sync.WaitGroup
@@ -167,10 +456,25 @@ func (s *Server) Serve(sigC chan os.Signal, n *sdnotify.Notifier, tasks []Task)
 			return nil
 		})
 
+		// An Advertiser which is waiting for its interface to be created, or
+		// a debug HTTP server which is retrying its bind, must not hold up
+		// readiness of the server as a whole.
+		var waitC <-chan struct{}
+		switch t := t.(type) {
+		case *supervisor:
+			waitC = t.a.waitC
+		case *httpTask:
+			waitC = t.failC
+		}
+
 		go func() {
 			defer wg.Done()
-			<-t.Ready()
-			_ = n.Notify(sdnotify.Statusf("started %s", t))
+			select {
+			case <-t.Ready():
+				_ = n.Notify(sdnotify.Statusf("started %s", t))
+			case <-waitC:
+				_ = n.Notify(sdnotify.Statusf("waiting for %s", t))
+			}
 		}()
 	}
 
@@ -190,16 +494,23 @@ func (s *Server) Serve(sigC chan os.Signal, n *sdnotify.Notifier, tasks []Task)
 // An httpTask is a Task which serves a debug HTTP server.
 type httpTask struct {
 	addr   string
+	file   *os.File
 	h      http.Handler
 	ll     *log.Logger
-	readyC chan struct{}
+	mm     *Metrics
+	strict bool
+
+	// readyC is closed when the server is listening, and failC is closed
+	// when a non-strict server first fails to listen.
+	readyC, failC       chan struct{}
+	readyOnce, failOnce sync.Once
 }
 
 // Run implements Task.
 func (t *httpTask) Run(ctx context.Context) error {
-	// Wait 3 seconds between listen attempts.
-	return serve(ctx, t.ll, 3*time.Second, func() error {
-		l, err := net.Listen("tcp", t.addr)
+	// Wait at least 3 seconds between listen attempts.
+	return serve(ctx, t.ll, 3*time.Second, t.strict, t.bindError, func() error {
+		l, err := t.listen()
 		if err != nil {
 			return err
 		}
@@ -220,14 +531,39 @@ func (t *httpTask) Run(ctx context.Context) error {
 		go func() {
 			defer wg.Done()
 			<-ctx.Done()
-			_ = s.Close()
+
+			// Give in-flight requests, such as a reload request which caused
+			// this shutdown, a moment to complete.
+			sctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			if err := s.Shutdown(sctx); err != nil {
+				_ = s.Close()
+			}
 		}()
 
-		close(t.readyC)
+		// The listener may be recreated if serving fails.
+		t.readyOnce.Do(func() { close(t.readyC) })
 		return s.Serve(l)
 	})
 }
 
+// listen creates the debug HTTP server's listener, or uses the listener passed
+// by socket activation if one is available. net.FileListener duplicates the
+// file, so the listener may be recreated if serving fails.
+func (t *httpTask) listen() (net.Listener, error) {
+	if t.file == nil {
+		return net.Listen("tcp", t.addr)
+	}
+
+	l, err := net.FileListener(t.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket activation file %q: %v", t.file.Name(), err)
+	}
+
+	return l, nil
+}
+
 // Ready implements Task.
 func (t *httpTask) Ready() <-chan struct{} { return t.readyC }
 
@@ -236,13 +572,39 @@ func (t *httpTask) String() string {
 	return fmt.Sprintf("debug HTTP server %q", t.addr)
 }
 
+// bindError records a failure to bind the debug HTTP server's listener.
+func (t *httpTask) bindError() {
+	if t.mm != nil {
+		t.mm.HTTPBindErrorsTotal(1.0)
+	}
+
+	if !t.strict && t.failC != nil {
+		t.failOnce.Do(func() { close(t.failC) })
+	}
+}
+
+// maxServeDelay is the maximum delay between listen attempts when serve is
+// not strict.
+const maxServeDelay = 1 * time.Minute
+
 // serve invokes fn with retries until a listener is started, handling certain
-// network listener errors as appropriate.
-func serve(ctx context.Context, ll *log.Logger, delay time.Duration, fn func() error) error {
+// network listener errors as appropriate. If strict is true, listener errors
+// are retried with a fixed delay for a limited number of attempts. Otherwise,
+// they are retried indefinitely with exponential backoff so that the debug
+// HTTP server cannot halt advertising. onError, if set, is invoked on each
+// listener error.
+func serve(
+	ctx context.Context,
+	ll *log.Logger,
+	delay time.Duration,
+	strict bool,
+	onError func(),
+	fn func() error,
+) error {
 	const attempts = 40
 
 	var nerr *net.OpError
-	for i := 0; i < attempts; i++ {
+	for i := 0; !strict || i < attempts; i++ {
 		if ctx.Err() != nil {
 			return nil
 		}
@@ -254,6 +616,13 @@ func serve(ctx context.Context, ll *log.Logger, delay time.Duration, fn func() e
 				return nil
 			case <-time.After(delay):
 			}
+
+			if !strict {
+				delay *= 2
+				if delay > maxServeDelay {
+					delay = maxServeDelay
+				}
+			}
 		}
 
 		err := fn()
@@ -270,8 +639,18 @@ func serve(ctx context.Context, ll *log.Logger, delay time.Duration, fn func() e
 			return err
 		}
 
-		if ll != nil {
+		if onError != nil {
+			onError()
+		}
+
+		if ll == nil {
+			continue
+		}
+
+		if strict {
 			ll.Printf("error starting HTTP debug server, %d attempt(s) remaining: %v", attempts-(i+1), err)
+		} else {
+			ll.Printf("error starting HTTP debug server, continuing without it and retrying: %v", err)
 		}
 	}
 
@@ -310,6 +689,15 @@ func (*watcherTask) Ready() <-chan struct{} {
 // String implements Task.
 func (*watcherTask) String() string { return "link state watcher" }
 
+// setSource configures d to select its link-local source address as specified
+// by ifi.
+func setSource(d *system.Dialer, ifi config.Interface) {
+	d.SourcePolicy = ifi.SourcePolicy
+	if ifi.SourcePolicy == system.SourceExact {
+		d.SourceAddress = ifi.SourceAddress.IPAddr().IP
+	}
+}
+
 // linkStateWatcher returns a function meant for use with errgroup.Group.Go
 // which will watch for cancelation or changes on watchC.
 func linkStateWatcher(ctx context.Context, watchC <-chan netstate.Change) func() error {
@@ -339,26 +727,31 @@ func linkStateWatcher(ctx context.Context, watchC <-chan netstate.Change) func()
 // A watcherTask is a Task which controls Server cancelation when a signal is
 // received.
 type signalTask struct {
-	sigC   chan os.Signal
-	cancel func()
-	ll     *log.Logger
-	n      *sdnotify.Notifier
-	t      *terminator
+	sigC    chan os.Signal
+	reloadC <-chan struct{}
+	cancel  func()
+	ll      *log.Logger
+	n       *sdnotify.Notifier
+	t       *terminator
 }
 
 // Run implements Task.
 func (t *signalTask) Run(ctx context.Context) error {
-	var sig os.Signal
+	var msg string
 	select {
 	case <-ctx.Done():
 		// Another goroutine returned an error.
 		return nil
-	case sig = <-t.sigC:
+	case sig := <-t.sigC:
 		// We received a shutdown signal.
+		t.t.set(isTerminal(sig))
+		msg = fmt.Sprintf("received %s, shutting down", sig)
+	case <-t.reloadC:
+		// Reload as if by SIGHUP.
+		t.t.set(false)
+		msg = "received reload request, shutting down"
 	}
 
-	t.t.set(sig)
-	msg := fmt.Sprintf("received %s, shutting down", sig)
 	t.ll.Print(msg)
 	_ = t.n.Notify(sdnotify.Statusf(msg), sdnotify.Stopping)
 	t.cancel()
@@ -389,12 +782,12 @@ type terminator struct {
 	term bool
 }
 
-// set uses the input signal to determine termination state.
-func (t *terminator) set(s os.Signal) {
+// set sets the termination state.
+func (t *terminator) set(term bool) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	t.term = isTerminal(s)
+	t.term = term
 }
 
 // terminate tells server components whether or not they should completely
@@ -29,6 +29,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/corerad/internal/config"
+	"github.com/mdlayher/corerad/internal/system"
+	"github.com/mdlayher/metricslite"
 )
 
 func TestServerBuildTasks(t *testing.T) {
@@ -64,6 +66,8 @@ func TestServerBuildTasks(t *testing.T) {
 					{Name: "eth1", Advertise: true},
 					// Not configured.
 					{Name: "eth2"},
+					// Exceeds the advertiser limit.
+					{Name: "eth3", Rejected: true},
 				},
 				Debug: config.Debug{Address: ":9430"},
 			},
@@ -193,14 +197,86 @@ func TestServerServeBasicTasks(t *testing.T) {
 	}
 }
 
+func TestServerServeHTTPBindError(t *testing.T) {
+	t.Parallel()
+
+	// Occupy the debug HTTP server's address so that it cannot bind.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	cfg := config.Interface{
+		Name:        "test0",
+		MinInterval: 1 * time.Minute,
+		MaxInterval: 1 * time.Minute,
+	}
+
+	var (
+		conn = system.NewTestConn(16)
+		ts   = system.TestState{Forwarding: true}
+		mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+		cctx = NewContext(nil, mm, ts)
+
+		ad = NewAdvertiser(
+			cctx,
+			cfg,
+			system.NewTestDialer(conn, &net.Interface{Name: cfg.Name}, net.IPv6loopback),
+			nil,
+			func() bool { return true },
+		)
+
+		ht = &httpTask{
+			addr:   l.Addr().String(),
+			h:      http.NotFoundHandler(),
+			mm:     mm,
+			readyC: make(chan struct{}),
+			failC:  make(chan struct{}),
+		}
+	)
+
+	ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+	sigC := make(chan os.Signal, 1)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- NewServer(cctx).Serve(sigC, nil, []Task{ht, ad})
+	}()
+
+	// The Advertiser sends its initial router advertisement even though the
+	// debug HTTP server cannot bind.
+	select {
+	case <-conn.Writes():
+	case err := <-errC:
+		t.Fatalf("server halted: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for router advertisement")
+	}
+
+	<-ht.failC
+
+	sigC <- os.Interrupt
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+
+	// The bind may have been retried in the meantime.
+	if n := findMetric(t, mm, httpBindErrors).Samples[""]; n < 1 {
+		t.Fatalf("expected at least one HTTP bind error, but got: %v", n)
+	}
+}
+
 func Test_serve(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name  string
-		mkCtx func() context.Context
-		fn    func() error
-		ok    bool
+		name   string
+		mkCtx  func() context.Context
+		strict bool
+		fn     func() error
+		errs   int
+		ok     bool
 	}{
 		{
 			name: "context canceled",
@@ -219,8 +295,35 @@ func Test_serve(t *testing.T) {
 				time.AfterFunc(1*time.Second, cancel)
 				return ctx
 			},
-			fn: func() error { return &net.OpError{} },
-			ok: true,
+			strict: true,
+			fn:     func() error { return &net.OpError{} },
+			ok:     true,
+		},
+		{
+			name:   "strict timeout",
+			mkCtx:  context.Background,
+			strict: true,
+			fn:     func() error { return &net.OpError{} },
+			errs:   40,
+		},
+		{
+			name:  "not strict retry",
+			mkCtx: context.Background,
+			fn: func() func() error {
+				// Fail to listen several times before eventually shutting
+				// down as expected.
+				var n int
+				return func() error {
+					n++
+					if n < 4 {
+						return &net.OpError{}
+					}
+
+					return http.ErrServerClosed
+				}
+			}(),
+			errs: 3,
+			ok:   true,
 		},
 		{
 			name:  "fatal error",
@@ -237,7 +340,8 @@ func Test_serve(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := serve(tt.mkCtx(), nil, 5*time.Millisecond, tt.fn)
+			var errs int
+			err := serve(tt.mkCtx(), nil, 5*time.Millisecond, tt.strict, func() { errs++ }, tt.fn)
 			if tt.ok && err != nil {
 				t.Fatalf("failed to serve: %v", err)
 			}
@@ -247,6 +351,12 @@ func Test_serve(t *testing.T) {
 			if err != nil {
 				t.Logf("err: %v", err)
 			}
+
+			if tt.errs != 0 {
+				if diff := cmp.Diff(tt.errs, errs); diff != "" {
+					t.Fatalf("unexpected number of listener errors (-want +got):\n%s", diff)
+				}
+			}
 		})
 	}
 }
@@ -0,0 +1,206 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package corerad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchdogMultiple is the multiple of an Advertiser's maximum interval after
+// which the Advertiser is considered stalled if it has not sent a router
+// advertisement.
+const watchdogMultiple = 3
+
+// Delays between restarts of an Advertiser which failed, and the number of
+// consecutive restarts after which the failure is considered permanent. An
+// Advertiser which runs for longer than maxRestartDelay before failing resets
+// both.
+const (
+	minRestartDelay = 1 * time.Second
+	maxRestartDelay = 1 * time.Minute
+	maxRestarts     = 5
+)
+
+// A supervisor is a Task which runs a single Advertiser in isolation from the
+// Server's other Tasks. If the Advertiser fails, the supervisor restarts it
+// with backoff rather than stopping the Server, so that a transient failure on
+// one interface cannot halt advertising on the others. Permanent failures are
+// returned so that misconfigurations still stop the Server. The supervisor also
+// reports when the Advertiser has not sent a router advertisement within a
+// multiple of its maximum interval, which may indicate a blocked system call.
+type supervisor struct {
+	// Atomics must come first per sync/atomic.
+	//
+	// progress is the UNIX nanosecond timestamp of when the Advertiser last
+	// sent a router advertisement, and sent is the number of router
+	// advertisements it has sent.
+	progress *int64
+	sent     *int64
+
+	a *Advertiser
+
+	// Parameters which have defaults but may be explicitly overridden to
+	// speed up tests.
+	watchdogTimeout time.Duration
+	restartDelay    time.Duration
+}
+
+// newSupervisor creates a supervisor for a.
+func newSupervisor(a *Advertiser) *supervisor {
+	s := &supervisor{
+		progress: new(int64),
+		sent:     new(int64),
+		a:        a,
+
+		watchdogTimeout: watchdogMultiple * a.cfg.MaxInterval,
+		restartDelay:    minRestartDelay,
+	}
+
+	a.onSend = func() {
+		atomic.AddInt64(s.sent, 1)
+		s.markProgress()
+	}
+	return s
+}
+
+// Run implements Task.
+func (s *supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.markProgress()
+
+	// Router advertisements are not sent periodically in unicast-only mode,
+	// so there is nothing to watch.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if !s.a.cfg.UnicastOnly {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchdog(ctx)
+		}()
+	}
+
+	var (
+		delay    = s.restartDelay
+		restarts int
+	)
+
+	for {
+		var (
+			start = time.Now()
+			sent  = atomic.LoadInt64(s.sent)
+		)
+
+		err := s.a.Run(ctx)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+
+		// An Advertiser which fails before sending any router advertisements
+		// could not initialize, likely due to a misconfiguration or missing
+		// permissions which a restart cannot fix.
+		if atomic.LoadInt64(s.sent) == sent || errors.Is(err, os.ErrPermission) {
+			return err
+		}
+
+		if time.Since(start) > maxRestartDelay {
+			// The Advertiser was healthy for some time, start over.
+			delay = s.restartDelay
+			restarts = 0
+		}
+
+		restarts++
+		if restarts > maxRestarts {
+			return fmt.Errorf("advertiser failed after %d restarts: %w", maxRestarts, err)
+		}
+
+		s.a.logf("advertiser failed, restarting in %s: %v", delay, err)
+		s.a.cctx.mm.AdvErrorsTotal(1.0, s.a.cfg.Name, "restart")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+
+		// The restart delay is not a stall.
+		s.markProgress()
+	}
+}
+
+// Ready implements Task.
+func (s *supervisor) Ready() <-chan struct{} { return s.a.Ready() }
+
+// String implements Task.
+func (s *supervisor) String() string { return s.a.String() }
+
+// markProgress notes that the Advertiser has made progress by sending a router
+// advertisement.
+func (s *supervisor) markProgress() {
+	atomic.StoreInt64(s.progress, time.Now().UnixNano())
+}
+
+// watchdog runs a loop until ctx is canceled which reports whether the
+// Advertiser has stalled, likely due to a blocked system call, because it has
+// not sent any router advertisements within its watchdog timeout.
+func (s *supervisor) watchdog(ctx context.Context) {
+	if s.watchdogTimeout <= 0 {
+		// No interval configured, nothing to do.
+		return
+	}
+
+	s.a.cctx.mm.AdvStalled(0, s.a.cfg.Name)
+
+	t := time.NewTicker(s.watchdogTimeout / 4)
+	defer t.Stop()
+
+	var stalled bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if s.a.Waiting() {
+			// Waiting for the interface to be created is not a stall.
+			s.markProgress()
+		}
+
+		since := time.Since(time.Unix(0, atomic.LoadInt64(s.progress)))
+		switch {
+		case since > s.watchdogTimeout && !stalled:
+			stalled = true
+			s.a.logf("no router advertisements sent in %s, advertiser may be stalled", since.Round(time.Millisecond))
+			s.a.cctx.mm.AdvStalled(1, s.a.cfg.Name)
+		case since <= s.watchdogTimeout && stalled:
+			stalled = false
+			s.a.logf("advertiser recovered from stall")
+			s.a.cctx.mm.AdvStalled(0, s.a.cfg.Name)
+		}
+	}
+}
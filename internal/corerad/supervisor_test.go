@@ -0,0 +1,278 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package corerad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/config"
+	"github.com/mdlayher/corerad/internal/system"
+	"github.com/mdlayher/metricslite"
+	"github.com/mdlayher/ndp"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestSupervisorRestart(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ts   = system.TestState{Forwarding: true}
+		mm   = NewMetrics(metricslite.NewMemory(), ts, nil)
+		conn = system.NewTestConn(16)
+		ifi  = &net.Interface{Name: "test0"}
+	)
+
+	// The first Conn sends the initial RA but then fails to receive with an
+	// unrecoverable error, and later dials succeed.
+	var dials int32
+	dialer := system.NewTestDialer(conn, ifi, net.IPv6loopback)
+	dialer.DialFunc = func() (*system.DialContext, error) {
+		var c system.Conn = conn
+		if atomic.AddInt32(&dials, 1) == 1 {
+			c = &testConn{
+				readFrom: func() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+					return nil, nil, nil, errors.New("read failed")
+				},
+				setReadDeadline: func(_ time.Time) error { return nil },
+				writeTo:         conn.WriteTo,
+			}
+		}
+
+		return &system.DialContext{
+			Conn:      c,
+			Interface: ifi,
+			IP:        net.IPv6loopback,
+		}, nil
+	}
+
+	sv := newSupervisor(testSupervisedAdvertiser(mm, ts, dialer))
+	sv.restartDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		return sv.Run(ctx)
+	})
+
+	// Both the failed and the restarted Advertiser must send an initial RA.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-conn.Writes():
+		case <-ctx.Done():
+			t.Fatalf("advertiser was not restarted: %v", ctx.Err())
+		}
+	}
+
+	cancel()
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to stop supervisor: %v", err)
+	}
+
+	want := metricslite.Series{
+		Name: "corerad_advertiser_errors_total",
+		Samples: map[string]float64{
+			"interface=test0,error=restart": 1,
+		},
+	}
+
+	if diff := cmp.Diff(want, findMetric(t, mm, want.Name)); diff != "" {
+		t.Fatalf("unexpected errors metric (-want +got):\n%s", diff)
+	}
+}
+
+func TestSupervisorPermanentError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "permission denied",
+			err:  os.NewSyscallError("socket", syscall.EPERM),
+		},
+		{
+			name: "unrecoverable",
+			err:  errors.New("dial failed"),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				ts = system.TestState{Forwarding: true}
+				mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+			)
+
+			dialer := system.NewTestDialer(nil, &net.Interface{Name: "test0"}, net.IPv6loopback)
+			dialer.DialFunc = func() (*system.DialContext, error) {
+				return nil, tt.err
+			}
+
+			sv := newSupervisor(testSupervisedAdvertiser(mm, ts, dialer))
+			sv.restartDelay = 10 * time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// The Advertiser never initializes, so the error must be returned
+			// rather than restarting the Advertiser indefinitely.
+			if err := sv.Run(ctx); !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, but got: %v", tt.err, err)
+			}
+			if err := ctx.Err(); err != nil {
+				t.Fatalf("supervisor did not return before timeout: %v", err)
+			}
+
+			if s := findMetric(t, mm, "corerad_advertiser_errors_total").Samples["interface=test0,error=restart"]; s != 0 {
+				t.Fatalf("expected no restarts, but got: %v", s)
+			}
+		})
+	}
+}
+
+// testSupervisedAdvertiser creates an Advertiser for use with a supervisor.
+func testSupervisedAdvertiser(mm *Metrics, ts system.State, dialer *system.Dialer) *Advertiser {
+	return NewAdvertiser(
+		NewContext(nil, mm, ts),
+		config.Interface{
+			Name:        "test0",
+			MinInterval: 1 * time.Second,
+			MaxInterval: 1 * time.Second,
+		},
+		dialer,
+		nil,
+		func() bool { return true },
+	)
+}
+
+func TestSupervisorStalledInterface(t *testing.T) {
+	skipShort(t)
+	t.Parallel()
+
+	// Run one healthy and one stalled advertiser side by side, and verify that
+	// the stalled advertiser does not delay the healthy one.
+	var (
+		ts = system.TestState{Forwarding: true}
+		mm = NewMetrics(metricslite.NewMemory(), ts, nil)
+
+		// The stalled Conn only has room for the initial RA, and nothing reads
+		// from it until shutdown so all further writes block.
+		healthy = system.NewTestConn(16)
+		stalled = system.NewTestConn(1)
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var eg errgroup.Group
+	for _, c := range []struct {
+		name string
+		conn *system.TestConn
+	}{
+		{name: "test0", conn: healthy},
+		{name: "test1", conn: stalled},
+	} {
+		cfg := config.Interface{
+			Name:        c.name,
+			MinInterval: 1 * time.Second,
+			MaxInterval: 1 * time.Second,
+		}
+
+		ad := NewAdvertiser(
+			NewContext(nil, mm, ts),
+			cfg,
+			system.NewTestDialer(c.conn, &net.Interface{Name: c.name}, net.IPv6loopback),
+			nil,
+			func() bool { return true },
+		)
+		ad.minDelayBetweenRAs = testMinDelayBetweenRAs
+
+		sv := newSupervisor(ad)
+		sv.watchdogTimeout = 1500 * time.Millisecond
+
+		eg.Go(func() error {
+			if err := sv.Run(ctx); err != nil {
+				return fmt.Errorf("failed to advertise: %v", err)
+			}
+
+			return nil
+		})
+	}
+
+	// The healthy advertiser must keep sending multicast RAs on schedule.
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		<-healthy.Writes()
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("healthy advertiser was delayed: %s", d)
+	}
+
+	// And the stalled advertiser must eventually be reported by the watchdog.
+	want := metricslite.Series{
+		Name: advStalled,
+		Samples: map[string]float64{
+			"interface=test0": 0,
+			"interface=test1": 1,
+		},
+	}
+
+	var diff string
+	for i := 0; i < 50; i++ {
+		if diff = cmp.Diff(want, findMetric(t, mm, advStalled)); diff == "" {
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+	if diff != "" {
+		t.Fatalf("unexpected stalled metric (-want +got):\n%s", diff)
+	}
+
+	// Unblock both Conns so the advertisers can shut down.
+	cancel()
+	done := make(chan struct{})
+	for _, c := range []*system.TestConn{healthy, stalled} {
+		go func(c *system.TestConn) {
+			for {
+				select {
+				case <-c.Writes():
+				case <-done:
+					return
+				}
+			}
+		}(c)
+	}
+	defer close(done)
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to stop advertisers: %v", err)
+	}
+}
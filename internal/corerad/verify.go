@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/ndp"
 )
 
@@ -39,6 +40,10 @@ func (ps *problems) merge(pss problems) {
 // A problem is an inconsistency detected in another router's RA.
 type problem struct {
 	Field, Details, Message string
+
+	// Want and Got are the formatted values of the field in this router's
+	// advertisement and the other router's advertisement.
+	Want, Got string
 }
 
 // newProblem constructs a problem with the input fields.
@@ -58,6 +63,8 @@ func newProblem(field, details string, want, got interface{}) *problem {
 			Field:   field,
 			Details: details,
 			Message: fmt.Sprintf("want: %q, got: %q", ws, gs),
+			Want:    ws,
+			Got:     gs,
 		}
 	}
 
@@ -68,6 +75,8 @@ func newProblem(field, details string, want, got interface{}) *problem {
 			Field:   field,
 			Details: details,
 			Message: fmt.Sprintf("want: %q, got: %q", wStr.String(), gStr.String()),
+			Want:    wStr.String(),
+			Got:     gStr.String(),
 		}
 	}
 
@@ -76,6 +85,8 @@ func newProblem(field, details string, want, got interface{}) *problem {
 		Field:   field,
 		Details: details,
 		Message: fmt.Sprintf("want: %v, got: %v", want, got),
+		Want:    fmt.Sprint(want),
+		Got:     fmt.Sprint(got),
 	}
 }
 
@@ -120,6 +131,17 @@ func checkRAs(a, b *ndp.RouterAdvertisement) problems {
 	return ps
 }
 
+// rangeTimer returns got if it lies within the randomized timer range from min
+// to max, so another router which chooses from the same range is considered
+// consistent, or want otherwise.
+func rangeTimer(want, got, min, max time.Duration) time.Duration {
+	if max > min && got >= min && got <= max {
+		return got
+	}
+
+	return want
+}
+
 // durationsConsistent reports whether two time.Duration values are consistent.
 func durationsConsistent(want, got time.Duration) bool {
 	if want == 0 || got == 0 {
@@ -330,11 +352,12 @@ func pickMTU(options []ndp.Option) (ndp.MTU, bool) {
 	return 0, false
 }
 
-// pickPrefixes selects all ndp.PrefixInformation options from the input options.
+// pickPrefixes selects all ndp.PrefixInformation options from the input options,
+// including prefixes with the router address flag set.
 func pickPrefixes(options []ndp.Option) []*ndp.PrefixInformation {
 	var prefixes []*ndp.PrefixInformation
 	for _, o := range options {
-		if p, ok := o.(*ndp.PrefixInformation); ok {
+		if p, _, ok := plugin.PrefixInformation(o); ok {
 			prefixes = append(prefixes, p)
 		}
 	}
@@ -392,3 +392,36 @@ func Test_verifyRAs(t *testing.T) {
 		})
 	}
 }
+
+func Test_rangeTimer(t *testing.T) {
+	t.Parallel()
+
+	const (
+		want = 30 * time.Second
+		min  = 20 * time.Second
+		max  = 40 * time.Second
+	)
+
+	tests := []struct {
+		name          string
+		got, min, max time.Duration
+		out           time.Duration
+	}{
+		{name: "fixed", got: 25 * time.Second, min: want, out: want},
+		{name: "below", got: 10 * time.Second, min: min, max: max, out: want},
+		{name: "above", got: 50 * time.Second, min: min, max: max, out: want},
+		{name: "within", got: 25 * time.Second, min: min, max: max, out: 25 * time.Second},
+		{name: "maximum", got: max, min: min, max: max, out: max},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.out, rangeTimer(want, tt.got, tt.min, tt.max)); diff != "" {
+				t.Fatalf("unexpected timer (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/mdlayher/corerad/internal/config"
+)
+
+// Expectations are the router advertisements which a configuration is
+// expected to produce, as read from a conformance expectations file.
+type Expectations struct {
+	Interfaces []InterfaceExpectation `json:"interfaces"`
+}
+
+// An InterfaceExpectation describes the expected router advertisement for an
+// individual interface.
+//
+// Advertisement uses the same JSON structure as the debug API's interfaces
+// route, but only the fields which are present are compared. Each expected
+// array element must match some element of the built array, and an empty
+// array requires that the built array is also empty.
+type InterfaceExpectation struct {
+	Interface     string          `json:"interface"`
+	Advertisement json.RawMessage `json:"advertisement"`
+}
+
+// An Assertion is the result of comparing a single expected field of an
+// interface's router advertisement.
+type Assertion struct {
+	Interface string
+	Field     string
+	OK        bool
+
+	// Empty if OK is true.
+	Message string
+}
+
+// String returns the human-readable result of an Assertion.
+func (a Assertion) String() string {
+	if a.OK {
+		return fmt.Sprintf("PASS %s: %s", a.Interface, a.Field)
+	}
+
+	return fmt.Sprintf("FAIL %s: %s: %s", a.Interface, a.Field, a.Message)
+}
+
+// Conform builds the router advertisement for each advertising interface in
+// ifaces and compares it against the expectations read from r. Router
+// advertisements are built as if IPv6 forwarding is enabled, as it is on a
+// correctly configured router. The plugins of each interface must already be
+// prepared.
+func Conform(r io.Reader, ifaces []config.Interface) ([]Assertion, error) {
+	var exp Expectations
+	if err := json.NewDecoder(r).Decode(&exp); err != nil {
+		return nil, fmt.Errorf("failed to decode expectations: %v", err)
+	}
+
+	var as []Assertion
+	for _, ie := range exp.Interfaces {
+		var want map[string]interface{}
+		if err := json.Unmarshal(ie.Advertisement, &want); err != nil {
+			return nil, fmt.Errorf("invalid advertisement expectations for interface %q: %v",
+				ie.Interface, err)
+		}
+
+		got, err := buildExpected(ie.Interface, ifaces)
+		if err != nil {
+			as = append(as, Assertion{
+				Interface: ie.Interface,
+				Field:     "advertisement",
+				Message:   err.Error(),
+			})
+			continue
+		}
+
+		as = append(as, assert(ie.Interface, "", want, got)...)
+	}
+
+	return as, nil
+}
+
+// buildExpected builds and packs the router advertisement for the interface
+// name, and returns it in a generic form suitable for comparison with
+// expectations.
+func buildExpected(name string, ifaces []config.Interface) (map[string]interface{}, error) {
+	for _, iface := range ifaces {
+		if iface.Name != name {
+			continue
+		}
+		if !iface.Advertise {
+			return nil, fmt.Errorf("interface is not configured to advertise")
+		}
+
+		ra, _, err := iface.Build(true, config.UnsolicitedSet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate router advertisement: %v", err)
+		}
+
+		// Round-trip the packed RA through JSON so it can be compared
+		// directly with the decoded expectations.
+		b, err := json.Marshal(packRA(ra))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal router advertisement: %v", err)
+		}
+
+		var out map[string]interface{}
+		if err := json.Unmarshal(b, &out); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal router advertisement: %v", err)
+		}
+
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("interface is not configured")
+}
+
+// assert produces one Assertion for each scalar field or array element in
+// want, descending into nested objects.
+func assert(iface, prefix string, want, got map[string]interface{}) []Assertion {
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var as []Assertion
+	for _, k := range keys {
+		field := k
+		if prefix != "" {
+			field = prefix + "." + k
+		}
+
+		gv, ok := got[k]
+
+		switch wv := want[k].(type) {
+		case map[string]interface{}:
+			if gm, ok := gv.(map[string]interface{}); ok {
+				as = append(as, assert(iface, field, wv, gm)...)
+				continue
+			}
+		case []interface{}:
+			ga, _ := gv.([]interface{})
+			if len(wv) == 0 {
+				as = append(as, result(iface, field, wv, ga, len(ga) == 0))
+				continue
+			}
+
+			for i, we := range wv {
+				as = append(as, result(
+					iface,
+					fmt.Sprintf("%s[%d]", field, i),
+					we, ga, contains(ga, we),
+				))
+			}
+			continue
+		}
+
+		as = append(as, result(iface, field, want[k], gv, ok && match(want[k], gv)))
+	}
+
+	return as
+}
+
+// result produces an Assertion for field, describing want and got if ok is
+// false.
+func result(iface, field string, want, got interface{}, ok bool) Assertion {
+	a := Assertion{
+		Interface: iface,
+		Field:     field,
+		OK:        ok,
+	}
+	if ok {
+		return a
+	}
+
+	wb, _ := json.Marshal(want)
+	gb, _ := json.Marshal(got)
+	a.Message = fmt.Sprintf("want %s, got %s", wb, gb)
+	return a
+}
+
+// match reports whether got contains all of the fields and elements of want.
+func match(want, got interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok || !match(wv, gv) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return false
+		}
+		if len(w) == 0 {
+			return len(g) == 0
+		}
+
+		for _, we := range w {
+			if !contains(g, we) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return reflect.DeepEqual(want, got)
+	}
+}
+
+// contains reports whether any element of got matches want.
+func contains(got []interface{}, want interface{}) bool {
+	for _, ge := range got {
+		if match(want, ge) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/config"
+	"github.com/mdlayher/corerad/internal/plugin"
+)
+
+func TestConform(t *testing.T) {
+	t.Parallel()
+
+	ifaces := []config.Interface{
+		{
+			Name:            "eth0",
+			Advertise:       true,
+			HopLimit:        64,
+			DefaultLifetime: 30 * time.Minute,
+			Plugins: []plugin.Plugin{
+				plugin.NewMTU(1500),
+				&plugin.DNSSL{
+					Lifetime:    1 * time.Hour,
+					DomainNames: []string{"lan.example.com", "example.com"},
+				},
+			},
+		},
+		{
+			Name:    "eth1",
+			Monitor: true,
+		},
+	}
+
+	tests := []struct {
+		name string
+		exp  string
+		as   []Assertion
+		ok   bool
+	}{
+		{
+			name: "bad JSON",
+			exp:  `{`,
+		},
+		{
+			name: "bad advertisement",
+			exp:  `{"interfaces":[{"interface":"eth0","advertisement":[]}]}`,
+		},
+		{
+			name: "not configured",
+			exp: `{"interfaces":[
+				{"interface":"eth1","advertisement":{}},
+				{"interface":"eth2","advertisement":{}}
+			]}`,
+			as: []Assertion{
+				{
+					Interface: "eth1",
+					Field:     "advertisement",
+					Message:   "interface is not configured to advertise",
+				},
+				{
+					Interface: "eth2",
+					Field:     "advertisement",
+					Message:   "interface is not configured",
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK",
+			exp: `{"interfaces":[{"interface":"eth0","advertisement":{
+				"current_hop_limit": 64,
+				"router_lifetime_seconds": 1800,
+				"options": {
+					"mtu": 1500,
+					"dnssl": [{"domain_names": ["example.com"]}],
+					"rdnss": []
+				}
+			}}]}`,
+			as: []Assertion{
+				{Interface: "eth0", Field: "current_hop_limit", OK: true},
+				{Interface: "eth0", Field: "options.dnssl[0]", OK: true},
+				{Interface: "eth0", Field: "options.mtu", OK: true},
+				{Interface: "eth0", Field: "options.rdnss", OK: true},
+				{Interface: "eth0", Field: "router_lifetime_seconds", OK: true},
+			},
+			ok: true,
+		},
+		{
+			name: "mismatch",
+			exp: `{"interfaces":[{"interface":"eth0","advertisement":{
+				"current_hop_limit": 255,
+				"managed_configuration": true,
+				"options": {
+					"dnssl": [
+						{"domain_names": ["lan.example.com"]},
+						{"lifetime_seconds": 60}
+					],
+					"prefixes": [{}],
+					"routes": {}
+				}
+			}}]}`,
+			as: []Assertion{
+				{
+					Interface: "eth0",
+					Field:     "current_hop_limit",
+					Message:   "want 255, got 64",
+				},
+				{
+					Interface: "eth0",
+					Field:     "managed_configuration",
+					Message:   "want true, got false",
+				},
+				{Interface: "eth0", Field: "options.dnssl[0]", OK: true},
+				{
+					Interface: "eth0",
+					Field:     "options.dnssl[1]",
+					Message:   `want {"lifetime_seconds":60}, got [{"domain_names":["lan.example.com","example.com"],"lifetime_seconds":3600}]`,
+				},
+				{
+					Interface: "eth0",
+					Field:     "options.prefixes[0]",
+					Message:   "want {}, got null",
+				},
+				{
+					Interface: "eth0",
+					Field:     "options.routes",
+					Message:   "want {}, got null",
+				},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			as, err := Conform(strings.NewReader(tt.exp), ifaces)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to check conformance: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.as, as); diff != "" {
+				t.Fatalf("unexpected assertions (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/mdlayher/ndp"
+)
+
+// maxDecodeBytes bounds the size of a hex dump accepted by the decode route,
+// which comfortably fits a router advertisement of any realistic MTU.
+const maxDecodeBytes = 64 << 10
+
+// decode decodes a hex dump of an NDP router advertisement in the request
+// body and returns its JSON representation.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxDecodeBytes))
+	if err != nil {
+		decodeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("hex dump must not exceed %d bytes", maxDecodeBytes))
+		return
+	}
+
+	ra, err := decodeRA(string(b))
+	if err != nil {
+		decodeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentJSON)
+	_ = json.NewEncoder(w).Encode(DecodeBody{
+		OK:                  true,
+		RouterAdvertisement: packRA(ra),
+	})
+}
+
+// decodeError writes a DecodeBody with an error and the specified status.
+func decodeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", contentJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(DecodeBody{Error: err.Error()})
+}
+
+// decodeRA parses a hex dump of an NDP router advertisement, beginning with
+// its ICMPv6 header. Whitespace and colon or hyphen separators are ignored.
+func decodeRA(s string) (*ndp.RouterAdvertisement, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == ':' || r == '-' {
+			return -1
+		}
+
+		return r
+	}, s)
+	if s == "" {
+		return nil, errors.New("hex dump is empty")
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex dump: %v", err)
+	}
+
+	m, err := ndp.ParseMessage(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NDP message: %v", err)
+	}
+
+	ra, ok := m.(*ndp.RouterAdvertisement)
+	if !ok {
+		return nil, fmt.Errorf("NDP message is a %s, not a router advertisement", m.Type())
+	}
+
+	// Router advertisements built by CoreRAD always carry valid preferences,
+	// but a captured one may not, and it cannot be represented.
+	if !validPreference(ra.RouterSelectionPreference) {
+		return nil, fmt.Errorf("invalid router selection preference: %d", ra.RouterSelectionPreference)
+	}
+	for _, o := range ra.Options {
+		if ri, ok := o.(*ndp.RouteInformation); ok && !validPreference(ri.Preference) {
+			return nil, fmt.Errorf("invalid route %s/%d preference: %d", ri.Prefix, ri.PrefixLength, ri.Preference)
+		}
+	}
+
+	return ra, nil
+}
+
+// validPreference reports whether p is a valid ndp.Preference.
+func validPreference(p ndp.Preference) bool {
+	switch p {
+	case ndp.Low, ndp.Medium, ndp.High:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipHandler transparently compresses the responses produced by h when the
+// client indicates gzip support via the Accept-Encoding header. Responses which
+// h has already encoded itself are passed through unmodified.
+func gzipHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer func() { _ = gw.close() }()
+
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether r's Accept-Encoding header permits gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		// Ignore any parameters aside from an explicit q=0 rejection.
+		ss := strings.Split(v, ";")
+		if strings.TrimSpace(ss[0]) != "gzip" {
+			continue
+		}
+
+		for _, p := range ss[1:] {
+			if strings.TrimSpace(p) == "q=0" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// A gzipResponseWriter is an http.ResponseWriter which compresses its output
+// with gzip, unless the wrapped handler has already set a Content-Encoding.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	// Only compress bodies which are not already encoded, and for status codes
+	// which permit a body.
+	if w.Header().Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// Sniff the uncompressed content since package http would otherwise
+		// detect the compressed content's type.
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+
+	return w.gz.Write(b)
+}
+
+// close flushes any remaining compressed output.
+func (w *gzipResponseWriter) close() error {
+	if w.gz == nil {
+		return nil
+	}
+
+	return w.gz.Close()
+}
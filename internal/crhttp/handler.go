@@ -14,16 +14,29 @@
 package crhttp
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/http/pprof"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/mdlayher/corerad/internal/build"
 	"github.com/mdlayher/corerad/internal/config"
+	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/corerad/internal/system"
+	"github.com/mdlayher/ndp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Common HTTP content types.
@@ -37,15 +50,80 @@ type Handler struct {
 	ll     *log.Logger
 	state  system.State
 	ifaces []config.Interface
+	max    int
+	prom   map[string]http.Handler
+	ctl    Controller
+	banner string
+	prof   *profiler
 	h      http.Handler
 }
 
-// NewHandler creates a Handler with the specified configuration.
+// A Controller controls the advertiser for each interface. If an interface is
+// not advertising, each method returns an error which can be checked using
+// errors.Is(err, os.ErrNotExist).
+type Controller interface {
+	// Advertise requests that the advertiser immediately send an unsolicited
+	// router advertisement. If the advertiser's rate limit would be violated,
+	// it returns a non-zero duration after which the caller may try again.
+	Advertise(iface string) (time.Duration, error)
+
+	// Withdraw withdraws the advertiser if withdraw is true, so that it
+	// advertises a router lifetime of zero and no prefixes, or promotes it to
+	// full advertising if withdraw is false.
+	Withdraw(iface string, withdraw bool) error
+
+	// Cordon cordons the advertiser if cordon is true, so that it advertises
+	// a router lifetime of zero but retains its prefixes, or uncordons it if
+	// cordon is false. If the state changed too recently, it returns a
+	// non-zero duration after which the caller may try again.
+	Cordon(iface string, cordon bool) (time.Duration, error)
+
+	// Status reports whether the advertiser is withdrawn or cordoned, whether
+	// it has been initialized and is ready, whether it is waiting for its
+	// interface to be created, and the state of its link if link state
+	// tracking is enabled. An advertiser whose receive errors have persisted
+	// beyond its receive grace period is not ready.
+	Status(iface string) (withdrawn, cordoned, ready, waiting bool, link string, err error)
+}
+
+// A Reloader reloads CoreRAD with a new configuration. If a Controller also
+// implements Reloader, it is used to serve reload requests.
+type Reloader interface {
+	// Reload verifies a new configuration and, if it is valid, reloads
+	// CoreRAD with it. It returns a summary of the changes from the running
+	// configuration.
+	Reload() ([]string, error)
+}
+
+// An EventLogger records notable events. If a Controller also implements
+// EventLogger, it is used to serve the recent events.
+type EventLogger interface {
+	// Events returns the recent events, from oldest to newest.
+	Events() []system.Event
+}
+
+// A LifetimeRamper reports the router lifetime of advertisers which ramp up
+// their router lifetime after they are initialized or promoted. If a
+// Controller also implements LifetimeRamper, it is used to report the router
+// lifetime currently advertised while the ramp is in progress.
+type LifetimeRamper interface {
+	// RouterLifetime reports the router lifetime currently advertised on
+	// iface, and whether it is still ramping up to the configured default
+	// lifetime.
+	RouterLifetime(iface string) (time.Duration, bool, error)
+}
+
+// NewHandler creates a Handler with the specified configuration. prom serves
+// metrics for all interfaces, and ifaceProm optionally serves the metrics for
+// individual interfaces, keyed by interface name. If ctl is not nil, it is
+// used to report advertiser status and to serve advertiser control requests.
 func NewHandler(
 	ll *log.Logger,
 	state system.State,
 	cfg config.Config,
 	prom http.Handler,
+	ifaceProm map[string]http.Handler,
+	ctl Controller,
 ) *Handler {
 	mux := http.NewServeMux()
 
@@ -53,15 +131,63 @@ func NewHandler(
 		ll:     ll,
 		state:  state,
 		ifaces: cfg.Interfaces,
+		max:    cfg.MaxAdvertisers,
+		prom:   ifaceProm,
+		ctl:    ctl,
+		banner: cfg.Debug.Banner,
+		prof:   newProfiler(),
 		h:      mux,
 	}
 
 	// Plumb in debugging API handlers.
-	mux.HandleFunc("/api/interfaces", h.interfaces)
+	mux.Handle("/api/interfaces", gzipHandler(http.HandlerFunc(h.interfaces)))
 
-	// Optionally enable Prometheus and pprof support.
+	// The sockets, plugins, config, conflicts, and events routes expose
+	// low-level details of the system, this build, its configuration, and
+	// neighboring routers, the profile route captures runtime profiles, the
+	// decode route parses arbitrary input, and the interface control routes
+	// change what is advertised, so all are only enabled when an
+	// authentication token is configured.
+	if cfg.Debug.Token != "" {
+		mux.Handle("/api/conflicts", authHandler(cfg.Debug.Token,
+			gzipHandler(http.HandlerFunc(h.conflicts))))
+		mux.Handle("/api/sockets", authHandler(cfg.Debug.Token,
+			gzipHandler(http.HandlerFunc(h.sockets))))
+		mux.Handle("/api/plugins", authHandler(cfg.Debug.Token,
+			gzipHandler(http.HandlerFunc(h.plugins))))
+		mux.Handle("/api/config", authHandler(cfg.Debug.Token,
+			gzipHandler(http.HandlerFunc(h.configFile))))
+		mux.Handle("/api/profile", authHandler(cfg.Debug.Token,
+			http.HandlerFunc(h.profile)))
+		mux.Handle("/api/decode", authHandler(cfg.Debug.Token,
+			http.HandlerFunc(h.decode)))
+
+		if ctl != nil {
+			mux.Handle("/api/interfaces/", authHandler(cfg.Debug.Token,
+				http.HandlerFunc(h.control)))
+		}
+
+		if e, ok := ctl.(EventLogger); ok {
+			mux.Handle("/api/events", authHandler(cfg.Debug.Token,
+				gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					h.events(w, req, e)
+				}))))
+		}
+
+		if r, ok := ctl.(Reloader); ok {
+			mux.Handle("/api/reload", authHandler(cfg.Debug.Token,
+				http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					h.reload(w, req, r)
+				})))
+		}
+	}
+
+	// Optionally enable Prometheus and pprof support. Neither is wrapped with
+	// gzipHandler because Prometheus negotiates its own compression and pprof
+	// negotiates its own encoding for profiles.
 	if cfg.Debug.Prometheus {
 		mux.Handle("/metrics", prom)
+		mux.HandleFunc("/metrics/", h.metrics)
 	}
 
 	if cfg.Debug.PProf {
@@ -75,11 +201,29 @@ func NewHandler(
 	return h
 }
 
+// NewMetricsHandler creates an http.Handler which serves the metrics gathered
+// by g for use with NewHandler. If openMetrics is true, metrics are served in
+// the OpenMetrics format to clients which request it using the Accept header.
+// Otherwise, or if a client does not request OpenMetrics, metrics are served
+// in the Prometheus text format.
+func NewMetricsHandler(g prometheus.Gatherer, openMetrics bool) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{
+		EnableOpenMetrics: openMetrics,
+	})
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Matching on "/" would produce an overly broad rule, so check manually
 	// here and indicate that this is the CoreRAD service.
 	if r.URL.Path == "/" {
-		_, _ = io.WriteString(w, build.Banner()+"\n")
+		banner := build.Banner()
+		if h.banner != "" {
+			// Escape the banner so it cannot cause the index to be
+			// interpreted as HTML by a browser.
+			banner += " - " + html.EscapeString(h.banner)
+		}
+
+		_, _ = io.WriteString(w, banner+"\n")
 		return
 	}
 
@@ -89,35 +233,149 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // interfaces returns a JSON representation of the advertising state of each
 // configured interface.
 func (h *Handler) interfaces(w http.ResponseWriter, r *http.Request) {
-	body := interfacesBody{
-		Interfaces: make([]interfaceBody, 0, len(h.ifaces)),
+	body := InterfacesBody{
+		MaxAdvertisers: h.max,
+		Interfaces:     make([]InterfaceBody, 0, len(h.ifaces)),
 	}
 
 	for i, iface := range h.ifaces {
-		body.Interfaces = append(body.Interfaces, interfaceBody{
+		body.Interfaces = append(body.Interfaces, InterfaceBody{
 			Interface:   iface.Name,
 			Advertising: iface.Advertise,
+			Shadow:      iface.Shadow,
+			Rejected:    iface.Rejected,
 		})
 
+		if iface.VLAN != 0 {
+			body.Interfaces[i].VLAN = &VLANBody{
+				Trunk: iface.Trunk,
+				ID:    iface.VLAN,
+			}
+		}
+
 		if !iface.Advertise {
 			// For interfaces which are not advertising, only report basic
 			// information with null RA output.
 			continue
 		}
+		body.Advertisers++
 
-		forwarding, err := h.state.IPv6Forwarding(iface.Name)
-		if err != nil {
-			h.errorf(w, "failed to check interface %q forwarding state: %v", iface.Name, err)
-			return
+		if h.ctl != nil {
+			withdrawn, cordoned, ready, waiting, link, err := h.ctl.Status(iface.Name)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				h.errorf(w, "failed to fetch interface %q status: %v", iface.Name, err)
+				return
+			}
+
+			body.Interfaces[i].Withdrawn = withdrawn
+			body.Interfaces[i].Cordoned = cordoned
+			body.Interfaces[i].Ready = ready
+			body.Interfaces[i].Waiting = waiting
+			body.Interfaces[i].LinkState = link
 		}
 
-		ra, err := iface.RouterAdvertisement(forwarding)
+		// The forwarding state and the plugins refer to the interface, so
+		// they must be consulted within its network namespace, if any.
+		var (
+			ra, sra *ndp.RouterAdvertisement
+			dropped []plugin.Plugin
+		)
+		d := &system.Dialer{Netns: iface.Netns}
+		err := d.InNetns(func() error {
+			forwarding, err := h.state.IPv6Forwarding(iface.Name)
+			if err != nil {
+				return fmt.Errorf("failed to check interface %q forwarding state: %v", iface.Name, err)
+			}
+
+			ra, dropped, err = iface.Build(forwarding, config.UnsolicitedSet)
+			if err != nil {
+				return fmt.Errorf("failed to generate router advertisements: %v", err)
+			}
+
+			if iface.SeparatePluginSets() {
+				sra, _, err = iface.Build(forwarding, config.SolicitedSet)
+				if err != nil {
+					return fmt.Errorf("failed to generate solicited router advertisements: %v", err)
+				}
+			}
+
+			return nil
+		})
 		if err != nil {
-			h.errorf(w, "failed to generate router advertisements: %v", err)
+			h.errorf(w, "%v", err)
 			return
 		}
 
+		if r, ok := h.ctl.(LifetimeRamper); ok && iface.InitialDefaultLifetime != 0 {
+			lifetime, ramping, err := r.RouterLifetime(iface.Name)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				h.errorf(w, "failed to fetch interface %q router lifetime: %v", iface.Name, err)
+				return
+			}
+
+			if ramping {
+				if lifetime < ra.RouterLifetime {
+					ra.RouterLifetime = lifetime
+				}
+				if sra != nil && lifetime < sra.RouterLifetime {
+					sra.RouterLifetime = lifetime
+				}
+
+				seconds := int(lifetime.Seconds())
+				body.Interfaces[i].RampingRouterLifetimeSeconds = &seconds
+			}
+		}
+
+		if iface.AdoptNeighborHopLimit {
+			hl, err := h.state.AdoptedHopLimit(iface.Name)
+			if err != nil {
+				h.errorf(w, "failed to fetch interface %q hop limit: %v", iface.Name, err)
+				return
+			}
+
+			if hl > ra.CurrentHopLimit {
+				ra.CurrentHopLimit = hl
+			}
+			if sra != nil && hl > sra.CurrentHopLimit {
+				sra.CurrentHopLimit = hl
+			}
+
+			effective := int(ra.CurrentHopLimit)
+			body.Interfaces[i].EffectiveHopLimit = &effective
+		}
+
 		body.Interfaces[i].Advertisement = packRA(ra)
+		if sra != nil {
+			body.Interfaces[i].SolicitedAdvertisement = packRA(sra)
+		}
+		body.Interfaces[i].ReachableTimeRange = timerRange(iface.ReachableTime, iface.ReachableTimeMax)
+		body.Interfaces[i].RetransmitTimerRange = timerRange(iface.RetransmitTimer, iface.RetransmitTimerMax)
+		if iface.SourceLLAOverride != nil {
+			body.Interfaces[i].SourceLLAOverride = iface.SourceLLAOverride.String()
+		}
+
+		for _, p := range dropped {
+			body.Interfaces[i].DroppedPlugins = append(body.Interfaces[i].DroppedPlugins, p.Name())
+		}
+
+		for _, p := range iface.Plugins {
+			switch p := p.(type) {
+			case *plugin.Upstream:
+				healthy := p.Healthy()
+				body.Interfaces[i].UpstreamHealthy = &healthy
+			case *plugin.VRRP:
+				body.Interfaces[i].VRRPRole = p.Role()
+			case *plugin.Renumber:
+				body.Interfaces[i].Renumber = append(body.Interfaces[i].Renumber, RenumberBody{
+					OldPrefix: p.Old.Prefix.String(),
+					NewPrefix: p.New.Prefix.String(),
+					Phase:     p.Phase().String(),
+					Start:     p.Start,
+					End:       p.End(),
+					Progress:  p.Progress(),
+				})
+			}
+		}
 	}
 
 	// TODO: factor out JSON serving middleware.
@@ -126,6 +384,309 @@ func (h *Handler) interfaces(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(body)
 }
 
+// conflicts returns a JSON representation of the recent inconsistencies
+// detected between each advertising interface and other routers.
+func (h *Handler) conflicts(w http.ResponseWriter, r *http.Request) {
+	body := ConflictsBody{
+		Conflicts: []ConflictBody{},
+	}
+
+	for _, iface := range h.ifaces {
+		if !iface.Advertise {
+			continue
+		}
+
+		cs, err := h.state.RecentConflicts(iface.Name)
+		if err != nil {
+			h.errorf(w, "failed to fetch interface %q conflicts: %v", iface.Name, err)
+			return
+		}
+
+		for _, c := range cs {
+			body.Conflicts = append(body.Conflicts, ConflictBody{
+				Interface:  iface.Name,
+				Router:     c.Router.String(),
+				Field:      c.Field,
+				Details:    c.Details,
+				Message:    c.Message,
+				Ours:       c.Ours,
+				Theirs:     c.Theirs,
+				Persistent: c.Persistent,
+				Duplicates: c.Duplicates,
+				FirstSeen:  c.FirstSeen,
+				LastSeen:   c.LastSeen,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", contentJSON)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// events returns a JSON representation of the recent events recorded by e.
+func (h *Handler) events(w http.ResponseWriter, r *http.Request, e EventLogger) {
+	es := e.Events()
+	body := EventsBody{
+		Events: make([]EventBody, 0, len(es)),
+	}
+
+	for _, ev := range es {
+		body.Events = append(body.Events, EventBody{
+			Time:      ev.Time,
+			Type:      ev.Type,
+			Interface: ev.Interface,
+			Message:   ev.Message,
+		})
+	}
+
+	w.Header().Set("Content-Type", contentJSON)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// sockets returns a JSON representation of the NDP socket setup of each
+// configured interface.
+func (h *Handler) sockets(w http.ResponseWriter, r *http.Request) {
+	body := SocketsBody{
+		Sockets: make([]SocketBody, 0, len(h.ifaces)),
+	}
+
+	for _, iface := range h.ifaces {
+		sb := SocketBody{
+			Interface:       iface.Name,
+			MulticastGroups: []string{},
+			ICMPFilter:      []string{},
+		}
+
+		s, err := h.state.Socket(iface.Name)
+		if err != nil {
+			h.errorf(w, "failed to fetch interface %q socket state: %v", iface.Name, err)
+			return
+		}
+
+		if s != nil {
+			sb.Address = s.Address.String()
+			for _, g := range s.Groups {
+				sb.MulticastGroups = append(sb.MulticastGroups, g.String())
+			}
+			for _, t := range s.ICMPTypes {
+				sb.ICMPFilter = append(sb.ICMPFilter, t.String())
+			}
+		}
+
+		body.Sockets = append(body.Sockets, sb)
+	}
+
+	w.Header().Set("Content-Type", contentJSON)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// plugins serves the schemas of all plugins supported by this build.
+func (h *Handler) plugins(w http.ResponseWriter, r *http.Request) {
+	schema := config.Schema()
+
+	body := PluginsBody{
+		Plugins: make([]PluginBody, 0, len(schema)),
+	}
+
+	for _, ps := range schema {
+		// Always produce arrays rather than null for stable output.
+		options := ps.Options
+		if options == nil {
+			options = []string{}
+		}
+
+		body.Plugins = append(body.Plugins, PluginBody{
+			Name:    ps.Name,
+			Table:   ps.Table,
+			Array:   ps.Array,
+			Options: options,
+			Fields:  packFields(ps.Fields),
+		})
+	}
+
+	w.Header().Set("Content-Type", contentJSON)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// configFile serves the plugin configuration of each interface in the
+// configuration file format.
+func (h *Handler) configFile(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	for i, ifi := range h.ifaces {
+		b, err := ifi.MarshalConfig()
+		if err != nil {
+			h.errorf(w, "failed to marshal configuration: %v", err)
+			return
+		}
+
+		// Separate each interface's table for readability.
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.Write(b)
+	}
+
+	w.Header().Set("Content-Type", contentText)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// timerRange packs a randomized timer range into a TimerRangeBody, or returns
+// nil if the timer is fixed.
+func timerRange(min, max time.Duration) *TimerRangeBody {
+	if max <= min {
+		return nil
+	}
+
+	return &TimerRangeBody{
+		MinMilliseconds: int(min.Milliseconds()),
+		MaxMilliseconds: int(max.Milliseconds()),
+	}
+}
+
+// packFields packs config.FieldSchemas into FieldBody structures.
+func packFields(fields []config.FieldSchema) []FieldBody {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	fbs := make([]FieldBody, 0, len(fields))
+	for _, f := range fields {
+		fbs = append(fbs, FieldBody{
+			Key:    f.Key,
+			Type:   f.Type,
+			Fields: packFields(f.Fields),
+		})
+	}
+
+	return fbs
+}
+
+// control serves the advertiser control routes for the interface specified in
+// a URL path of the form /api/interfaces/{name}/{action}, where action is one
+// of advertise, withdraw, promote, cordon, or uncordon.
+func (h *Handler) control(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/interfaces/")
+	slash := strings.LastIndexByte(path, '/')
+	if slash == -1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	iface, action := path[:slash], path[slash+1:]
+	switch action {
+	case "advertise", "withdraw", "promote", "cordon", "uncordon":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if !validInterface(iface) {
+		http.Error(w, "invalid interface name", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		retry  time.Duration
+		err    error
+		status = http.StatusNoContent
+	)
+
+	switch action {
+	case "advertise":
+		retry, err = h.ctl.Advertise(iface)
+		// The router advertisement is sent asynchronously.
+		status = http.StatusAccepted
+	case "withdraw", "promote":
+		err = h.ctl.Withdraw(iface, action == "withdraw")
+	case "cordon", "uncordon":
+		retry, err = h.ctl.Cordon(iface, action == "cordon")
+	}
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.NotFound(w, r)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case retry > 0:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		http.Error(w, fmt.Sprintf("rate limited, retry after %s", retry.Round(time.Millisecond)),
+			http.StatusTooManyRequests)
+	default:
+		w.WriteHeader(status)
+	}
+}
+
+// reload serves configuration reload requests using r.
+func (h *Handler) reload(w http.ResponseWriter, req *http.Request, r Reloader) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	changes, err := r.Reload()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.NotFound(w, req)
+		return
+	case err != nil:
+		w.Header().Set("Content-Type", contentJSON)
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ReloadBody{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentJSON)
+	_ = json.NewEncoder(w).Encode(ReloadBody{
+		OK:      true,
+		Changes: changes,
+	})
+}
+
+// metrics serves the metrics for the interface specified in the URL path.
+func (h *Handler) metrics(w http.ResponseWriter, r *http.Request) {
+	iface := strings.TrimPrefix(r.URL.Path, "/metrics/")
+	if !validInterface(iface) {
+		http.Error(w, "invalid interface name", http.StatusBadRequest)
+		return
+	}
+
+	prom, ok := h.prom[iface]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	prom.ServeHTTP(w, r)
+}
+
+// validInterface reports whether s is a valid network interface name.
+func validInterface(s string) bool {
+	// Operating systems limit interface names to IFNAMSIZ (16) bytes,
+	// including a trailing NUL.
+	if s == "" || len(s) > 15 {
+		return false
+	}
+
+	for _, r := range s {
+		if r == '/' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (h *Handler) errorf(w http.ResponseWriter, format string, v ...interface{}) {
 	err := fmt.Errorf(format, v...)
 	h.ll.Printf("HTTP server error: %v", err)
@@ -15,14 +15,19 @@ package crhttp
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,7 +38,7 @@ import (
 	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/ipv6"
 	"inet.af/netaddr"
 )
 
@@ -42,8 +47,16 @@ func TestHandlerRoutes(t *testing.T) {
 		name              string
 		state             system.State
 		ifaces            []config.Interface
+		maxAdvertisers    int
 		prometheus, pprof bool
-		path              string
+		openMetrics       bool
+		gzip              bool
+		token, auth       string
+		accept            string
+		banner            string
+		ctl               Controller
+		method, path      string
+		body              string
 		status            int
 		check             func(t *testing.T, header http.Header, body []byte)
 	}{
@@ -61,6 +74,26 @@ func TestHandlerRoutes(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:   "index operator banner",
+			banner: "site-nyc-edge1 <netops@example.com>",
+			path:   "/",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if diff := cmp.Diff(contentText, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				if !bytes.HasPrefix(body, []byte("CoreRAD")) {
+					t.Fatal("CoreRAD banner was not found")
+				}
+
+				const want = " - site-nyc-edge1 &lt;netops@example.com&gt;\n"
+				if !bytes.HasSuffix(body, []byte(want)) {
+					t.Fatalf("operator banner was not found: %q", body)
+				}
+			},
+		},
 		{
 			name:   "not found",
 			path:   "/foo",
@@ -82,6 +115,123 @@ func TestHandlerRoutes(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:       "prometheus gzip",
+			prometheus: true,
+			gzip:       true,
+			path:       "/metrics",
+			status:     http.StatusOK,
+			check:      checkMetricsGzip,
+		},
+		{
+			name:       "prometheus interface gzip",
+			prometheus: true,
+			gzip:       true,
+			ifaces:     []config.Interface{{Name: "eth0"}},
+			path:       "/metrics/eth0",
+			status:     http.StatusOK,
+			check:      checkMetricsGzip,
+		},
+		{
+			name:        "prometheus OpenMetrics",
+			prometheus:  true,
+			openMetrics: true,
+			accept:      "application/openmetrics-text; version=0.0.1",
+			path:        "/metrics",
+			status:      http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if ct := h.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text;") {
+					t.Fatalf("unexpected Content-Type: %q", ct)
+				}
+
+				if !bytes.HasSuffix(body, []byte("# EOF\n")) {
+					t.Fatal("OpenMetrics EOF trailer was not found")
+				}
+			},
+		},
+		{
+			name:        "prometheus OpenMetrics not accepted",
+			prometheus:  true,
+			openMetrics: true,
+			path:        "/metrics",
+			status:      http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if ct := h.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain;") {
+					t.Fatalf("unexpected Content-Type: %q", ct)
+				}
+
+				if bytes.Contains(body, []byte("# EOF")) {
+					t.Fatal("unexpected OpenMetrics EOF trailer")
+				}
+			},
+		},
+		{
+			name:       "prometheus OpenMetrics disabled",
+			prometheus: true,
+			accept:     "application/openmetrics-text; version=0.0.1",
+			path:       "/metrics",
+			status:     http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if ct := h.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain;") {
+					t.Fatalf("unexpected Content-Type: %q", ct)
+				}
+			},
+		},
+		{
+			name:        "prometheus interface OpenMetrics",
+			prometheus:  true,
+			openMetrics: true,
+			ifaces:      []config.Interface{{Name: "eth0"}},
+			accept:      "application/openmetrics-text; version=0.0.1",
+			path:        "/metrics/eth0",
+			status:      http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if ct := h.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text;") {
+					t.Fatalf("unexpected Content-Type: %q", ct)
+				}
+
+				if !bytes.HasSuffix(body, []byte("# EOF\n")) {
+					t.Fatal("OpenMetrics EOF trailer was not found")
+				}
+			},
+		},
+		{
+			name:   "prometheus interface disabled",
+			ifaces: []config.Interface{{Name: "eth0"}},
+			path:   "/metrics/eth0",
+			status: http.StatusNotFound,
+		},
+		{
+			name:       "prometheus interface",
+			prometheus: true,
+			ifaces:     []config.Interface{{Name: "eth0"}},
+			path:       "/metrics/eth0",
+			status:     http.StatusOK,
+			check: func(t *testing.T, _ http.Header, body []byte) {
+				if !bytes.HasPrefix(body, []byte("# HELP go_")) {
+					t.Fatal("Prometheus Go collector metric was not found")
+				}
+			},
+		},
+		{
+			name:       "prometheus interface not found",
+			prometheus: true,
+			ifaces:     []config.Interface{{Name: "eth0"}},
+			path:       "/metrics/eth1",
+			status:     http.StatusNotFound,
+		},
+		{
+			name:       "prometheus interface invalid",
+			prometheus: true,
+			path:       "/metrics/eth0/foo",
+			status:     http.StatusBadRequest,
+		},
+		{
+			name:       "prometheus interface too long",
+			prometheus: true,
+			path:       "/metrics/abcdefghijklmnop",
+			status:     http.StatusBadRequest,
+		},
 		{
 			name:   "pprof disabled",
 			path:   "/debug/pprof/",
@@ -98,6 +248,22 @@ func TestHandlerRoutes(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:   "pprof gzip not compressed",
+			pprof:  true,
+			gzip:   true,
+			path:   "/debug/pprof/goroutine?debug=1",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if diff := cmp.Diff("", h.Get("Content-Encoding")); diff != "" {
+					t.Fatalf("unexpected Content-Encoding (-want +got):\n%s", diff)
+				}
+
+				if !bytes.HasPrefix(body, []byte("goroutine profile:")) {
+					t.Fatal("goroutine profile was not found")
+				}
+			},
+		},
 		{
 			name: "no interfaces",
 			state: system.TestState{
@@ -126,10 +292,16 @@ func TestHandlerRoutes(t *testing.T) {
 					HopLimit:        64,
 					DefaultLifetime: 30 * time.Minute,
 					ReachableTime:   12345 * time.Millisecond,
+					// The LLA plugin is prepared with the override.
+					SourceLLAOverride: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
 					Plugins: []plugin.Plugin{
 
 						&plugin.LLA{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
 						plugin.NewMTU(1500),
+						&plugin.Nonce{
+							Reader: bytes.NewReader([]byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}),
+						},
+						&plugin.CaptivePortal{API: "https://portal.example.com/api"},
 						&plugin.Prefix{
 							Autonomous:        true,
 							ValidLifetime:     10 * time.Minute,
@@ -169,23 +341,28 @@ func TestHandlerRoutes(t *testing.T) {
 			path:   "/api/interfaces",
 			status: http.StatusOK,
 			check: func(t *testing.T, h http.Header, b []byte) {
-				want := interfacesBody{
-					Interfaces: []interfaceBody{
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{
 						{
 							Interface:   "eth0",
 							Advertising: true,
-							Advertisement: &routerAdvertisement{
+							Advertisement: &RouterAdvertisement{
 								CurrentHopLimit:           64,
 								RouterSelectionPreference: "medium",
 								RouterLifetimeSeconds:     60 * 30,
 								ReachableTimeMilliseconds: 12345,
-								Options: options{
-									DNSSL: []dnssl{{
+								ReachableTime:             "12.345s",
+								RetransmitTimer:           "0s",
+								Options: Options{
+									CaptivePortal: "https://portal.example.com/api",
+									DNSSL: []DNSSL{{
 										LifetimeSeconds: 60 * 60,
 										DomainNames:     []string{"lan.example.com"},
 									}},
-									MTU: 1500,
-									Prefixes: []prefix{
+									MTU:   1500,
+									Nonce: "deadbeef0001",
+									Prefixes: []Prefix{
 										{
 											Prefix:                             "2001:db8::/64",
 											AutonomousAddressAutoconfiguration: true,
@@ -200,11 +377,11 @@ func TestHandlerRoutes(t *testing.T) {
 											PreferredLifetimeSeconds:           60 * 5,
 										},
 									},
-									RDNSS: []rdnss{{
+									RDNSS: []RDNSS{{
 										LifetimeSeconds: 60 * 60,
 										Servers:         []string{"2001:db8::1", "2001:db8::2"},
 									}},
-									Routes: []route{{
+									Routes: []Route{{
 										Prefix:               "2001:db8:ffff::/48",
 										Preference:           "high",
 										RouteLifetimeSeconds: 60 * 10,
@@ -212,6 +389,7 @@ func TestHandlerRoutes(t *testing.T) {
 									SourceLinkLayerAddress: "de:ad:be:ef:de:ad",
 								},
 							},
+							SourceLLAOverride: "de:ad:be:ef:de:ad",
 						},
 						{
 							Interface:   "eth1",
@@ -230,88 +408,1582 @@ func TestHandlerRoutes(t *testing.T) {
 			},
 		},
 		{
-			name: "error fetching forwarding",
+			name: "interfaces gzip",
 			state: system.TestState{
 				Forwarding: true,
-				Error:      os.ErrPermission,
-			},
-			ifaces: []config.Interface{
-				{Name: "eth0", Advertise: true},
 			},
+			ifaces: []config.Interface{{
+				Name:      "eth0",
+				Advertise: false,
+			}},
+			gzip:   true,
 			path:   "/api/interfaces",
-			status: http.StatusInternalServerError,
-			check: func(t *testing.T, _ http.Header, b []byte) {
-				if !bytes.HasPrefix(b, []byte(`failed to check interface "eth0" forwarding`)) {
-					t.Fatalf("unexpected body output: %s", string(b))
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff("gzip", h.Get("Content-Encoding")); diff != "" {
+					t.Fatalf("unexpected Content-Encoding (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff(contentJSON, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				want := InterfacesBody{
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: false,
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
 				}
 			},
 		},
-	}
+		{
+			name: "interfaces RDNSS only",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				// Addressing is provided by DHCPv6, but SLAAC hosts may still
+				// learn DNS configuration via RA per RFC 8106.
+				Name:            "eth0",
+				Advertise:       true,
+				OtherConfig:     true,
+				HopLimit:        64,
+				DefaultLifetime: 30 * time.Minute,
+				Plugins: []plugin.Plugin{
+					&plugin.RDNSS{
+						Lifetime: 1 * time.Hour,
+						Servers:  []netaddr.IP{crtest.MustIP("2001:db8::1")},
+					},
+					&plugin.DNSSL{
+						Lifetime:    1 * time.Hour,
+						DomainNames: []string{"lan.example.com"},
+					},
+				},
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				// Prefixes must be an empty array rather than null.
+				if !bytes.Contains(b, []byte(`"prefixes":[]`)) {
+					t.Fatalf("expected empty prefixes array: %s", string(b))
+				}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Create a Prometheus registry with a known-good set of metrics
-			// that we can check for when the Prometheus functionality is
-			// enabled.
-			reg := prometheus.NewPedanticRegistry()
-			reg.MustRegister(prometheus.NewGoCollector())
+				opts := emptyOptions()
+				opts.DNSSL = []DNSSL{{
+					LifetimeSeconds: 60 * 60,
+					DomainNames:     []string{"lan.example.com"},
+				}}
+				opts.RDNSS = []RDNSS{{
+					LifetimeSeconds: 60 * 60,
+					Servers:         []string{"2001:db8::1"},
+				}}
 
-			srv := httptest.NewServer(
-				NewHandler(
-					log.New(ioutil.Discard, "", 0),
-					tt.state,
-					config.Config{
-						Interfaces: tt.ifaces,
-						Debug: config.Debug{
-							Prometheus: tt.prometheus,
-							PProf:      tt.pprof,
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Advertisement: &RouterAdvertisement{
+							CurrentHopLimit:           64,
+							OtherConfiguration:        true,
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							RouterLifetimeSeconds:     60 * 30,
+							Options:                   opts,
 						},
-					},
-					promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
-				),
-			)
-			defer srv.Close()
+					}},
+				}
 
-			// Use string contenation rather than path.Join because we want to
-			// not escape any raw query parameters provided as part of the path.
-			u, err := url.Parse(srv.URL + tt.path)
-			if err != nil {
-				t.Fatalf("failed to parse URL: %v", err)
-			}
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces adopted hop limit",
+			state: system.TestState{
+				Forwarding: true,
+				HopLimits:  map[string]uint8{"eth0": 128},
+			},
+			ifaces: []config.Interface{{
+				Name:                  "eth0",
+				Advertise:             true,
+				HopLimit:              64,
+				AdoptNeighborHopLimit: true,
+				DefaultLifetime:       30 * time.Minute,
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				effective := 128
 
-			c := &http.Client{Timeout: 2 * time.Second}
-			res, err := c.Get(u.String())
-			if err != nil {
-				t.Fatalf("failed to HTTP GET: %v", err)
-			}
-			defer res.Body.Close()
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Advertisement: &RouterAdvertisement{
+							CurrentHopLimit:           128,
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							RouterLifetimeSeconds:     60 * 30,
+							Options:                   emptyOptions(),
+						},
+						EffectiveHopLimit: &effective,
+					}},
+				}
 
-			if diff := cmp.Diff(tt.status, res.StatusCode); diff != "" {
-				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
-			}
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces ramping router lifetime",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ctl: &testController{lifetime: 90 * time.Second, ramping: true},
+			ifaces: []config.Interface{{
+				Name:                   "eth0",
+				Advertise:              true,
+				HopLimit:               64,
+				DefaultLifetime:        30 * time.Minute,
+				InitialDefaultLifetime: 1 * time.Minute,
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				ramping := 90
 
-			// If set, apply an additional sanity check on the response body.
-			if tt.check == nil {
-				return
-			}
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Advertisement: &RouterAdvertisement{
+							CurrentHopLimit:           64,
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							RouterLifetimeSeconds:     90,
+							Options:                   emptyOptions(),
+						},
+						RampingRouterLifetimeSeconds: &ramping,
+					}},
+				}
 
-			// Don't consume a stream larger than a sane upper bound.
-			const mb = 1 << 20
-			body, err := ioutil.ReadAll(io.LimitReader(res.Body, 2*mb))
-			if err != nil {
-				t.Fatalf("failed to read HTTP body: %v", err)
-			}
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces randomized timers",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				Name:             "eth0",
+				Advertise:        true,
+				HopLimit:         64,
+				ReachableTime:    20 * time.Second,
+				ReachableTimeMax: 40 * time.Second,
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				got := parseJSONBody(b).Interfaces[0]
 
-			tt.check(t, res.Header, body)
-		})
-	}
-}
+				want := &TimerRangeBody{
+					MinMilliseconds: 20000,
+					MaxMilliseconds: 40000,
+				}
 
-func parseJSONBody(b []byte) interfacesBody {
-	var body interfacesBody
-	if err := json.Unmarshal(b, &body); err != nil {
-		panicf("failed to unmarshal JSON: %v", err)
-	}
+				if diff := cmp.Diff(want, got.ReachableTimeRange); diff != "" {
+					t.Fatalf("unexpected reachable time range (-want +got):\n%s", diff)
+				}
+				if got.RetransmitTimerRange != nil {
+					t.Fatalf("expected no retransmit timer range, but got: %+v", got.RetransmitTimerRange)
+				}
 
-	return body
+				if ms := got.Advertisement.ReachableTimeMilliseconds; ms < 20000 || ms > 40000 {
+					t.Fatalf("reachable time %dms is outside of the configured range", ms)
+				}
+			},
+		},
+		{
+			name: "interfaces dropped plugins",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				Name:      "eth0",
+				Advertise: true,
+				// Room for exactly one MTU option.
+				MaxSize: 16 + 8,
+				Plugins: []plugin.Plugin{
+					plugin.NewMTU(1500),
+					&plugin.DNSSL{
+						Lifetime:    1 * time.Hour,
+						DomainNames: []string{"lan.example.com"},
+					},
+				},
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				opts := emptyOptions()
+				opts.MTU = 1500
+
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   opts,
+						},
+						DroppedPlugins: []string{"dnssl"},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces rejected",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{
+				{Name: "eth0", Advertise: true},
+				{Name: "eth1", Rejected: true},
+			},
+			maxAdvertisers: 1,
+			path:           "/api/interfaces",
+			status:         http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers:    1,
+					MaxAdvertisers: 1,
+					Interfaces: []InterfaceBody{
+						{
+							Interface:   "eth0",
+							Advertising: true,
+							Advertisement: &RouterAdvertisement{
+								RouterSelectionPreference: "medium",
+								ReachableTime:             "0s",
+								RetransmitTimer:           "0s",
+								Options:                   emptyOptions(),
+							},
+						},
+						{
+							Interface: "eth1",
+							Rejected:  true,
+						},
+					},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces VLAN",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{
+				{Name: "eth0.10", Trunk: "eth0", VLAN: 10},
+			},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Interfaces: []InterfaceBody{{
+						Interface: "eth0.10",
+						VLAN: &VLANBody{
+							Trunk: "eth0",
+							ID:    10,
+						},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces plugin sets",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				Name:             "eth0",
+				Advertise:        true,
+				Plugins:          []plugin.Plugin{plugin.NewMTU(1280)},
+				SolicitedPlugins: []plugin.Plugin{plugin.NewMTU(1500)},
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				mtu := func(mtu int) *RouterAdvertisement {
+					opts := emptyOptions()
+					opts.MTU = mtu
+
+					return &RouterAdvertisement{
+						RouterSelectionPreference: "medium",
+						ReachableTime:             "0s",
+						RetransmitTimer:           "0s",
+						Options:                   opts,
+					}
+				}
+
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:              "eth0",
+						Advertising:            true,
+						Advertisement:          mtu(1280),
+						SolicitedAdvertisement: mtu(1500),
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces upstream unhealthy",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				Name:            "eth0",
+				Advertise:       true,
+				DefaultLifetime: 30 * time.Minute,
+				Plugins:         []plugin.Plugin{unhealthyUpstream()},
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				healthy := false
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						// No longer a default router.
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   emptyOptions(),
+						},
+						UpstreamHealthy: &healthy,
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces renumber",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				Name:            "eth0",
+				Advertise:       true,
+				DefaultLifetime: 30 * time.Minute,
+				Plugins: []plugin.Plugin{&plugin.Renumber{
+					Old: &plugin.Prefix{
+						Prefix:            crtest.MustIPPrefix("2001:db8:1::/64"),
+						OnLink:            true,
+						ValidLifetime:     10 * time.Minute,
+						PreferredLifetime: 5 * time.Minute,
+					},
+					New: &plugin.Prefix{
+						Prefix:            crtest.MustIPPrefix("2001:db8:2::/64"),
+						OnLink:            true,
+						ValidLifetime:     10 * time.Minute,
+						PreferredLifetime: 5 * time.Minute,
+					},
+					Start:   time.Unix(1000, 0).UTC(),
+					Window:  10 * time.Minute,
+					TimeNow: func() time.Time { return time.Unix(1000, 0).Add(5 * time.Minute) },
+				}},
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							RouterLifetimeSeconds:     60 * 30,
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options: Options{
+								DNSSL: []DNSSL{},
+								Prefixes: []Prefix{
+									{
+										Prefix:                   "2001:db8:2::/64",
+										OnLink:                   true,
+										ValidLifetimeSeconds:     60 * 10,
+										PreferredLifetimeSeconds: 60 * 5,
+									},
+									{
+										// Deprecated halfway through the window.
+										Prefix:               "2001:db8:1::/64",
+										OnLink:               true,
+										ValidLifetimeSeconds: 60 * 5,
+									},
+								},
+								RDNSS:  []RDNSS{},
+								Routes: []Route{},
+							},
+						},
+						Renumber: []RenumberBody{{
+							OldPrefix: "2001:db8:1::/64",
+							NewPrefix: "2001:db8:2::/64",
+							Phase:     "renumbering",
+							Start:     time.Unix(1000, 0).UTC(),
+							End:       time.Unix(1000, 0).Add(10 * time.Minute).UTC(),
+							Progress:  0.5,
+						}},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces VRRP backup",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{
+				Name:            "eth0",
+				Advertise:       true,
+				DefaultLifetime: 30 * time.Minute,
+				Plugins: []plugin.Plugin{&plugin.VRRP{
+					Address: crtest.MustIP("fe80::1"),
+				}},
+			}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						// Not a default router until checked.
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   emptyOptions(),
+						},
+						VRRPRole: "backup",
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "conflicts disabled",
+			path:   "/api/conflicts",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "conflicts unauthorized",
+			token:  "secret",
+			auth:   "Bearer wrong",
+			path:   "/api/conflicts",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "conflicts",
+			state: system.TestState{
+				Conflicts: map[string][]system.Conflict{
+					"eth0": {{
+						Router:     net.ParseIP("fe80::2"),
+						Field:      "mtu",
+						Message:    "want: 1500, got: 1280",
+						Ours:       "1500",
+						Theirs:     "1280",
+						Persistent: true,
+						Duplicates: 3,
+						FirstSeen:  time.Unix(1, 0).UTC(),
+						LastSeen:   time.Unix(2, 0).UTC(),
+					}},
+					// Not advertising, so ignored.
+					"eth1": {{Field: "mtu"}},
+				},
+			},
+			ifaces: []config.Interface{
+				{Name: "eth0", Advertise: true},
+				{Name: "eth1", Monitor: true},
+			},
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/conflicts",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				var got ConflictsBody
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				want := ConflictsBody{
+					Conflicts: []ConflictBody{{
+						Interface:  "eth0",
+						Router:     "fe80::2",
+						Field:      "mtu",
+						Message:    "want: 1500, got: 1280",
+						Ours:       "1500",
+						Theirs:     "1280",
+						Persistent: true,
+						Duplicates: 3,
+						FirstSeen:  time.Unix(1, 0).UTC(),
+						LastSeen:   time.Unix(2, 0).UTC(),
+					}},
+				}
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected ConflictsBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "sockets disabled",
+			path:   "/api/sockets",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "sockets unauthorized",
+			token:  "secret",
+			auth:   "Bearer wrong",
+			path:   "/api/sockets",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "plugins disabled",
+			path:   "/api/plugins",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "plugins unauthorized",
+			token:  "secret",
+			auth:   "Bearer wrong",
+			path:   "/api/plugins",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "config disabled",
+			path:   "/api/config",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "config unauthorized",
+			token:  "secret",
+			auth:   "Bearer wrong",
+			path:   "/api/config",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "advertise disabled",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "advertise unauthorized",
+			token:  "secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "advertise method not allowed",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "advertise invalid interface",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/abcdefghijklmnop/advertise",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "advertise not found",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{err: fmt.Errorf("no advertiser: %w", os.ErrNotExist)},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "advertise not running",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{err: errors.New("advertiser is not running")},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "advertise rate limited",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{retry: 1500 * time.Millisecond},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusTooManyRequests,
+			check: func(t *testing.T, h http.Header, _ []byte) {
+				if diff := cmp.Diff("2", h.Get("Retry-After")); diff != "" {
+					t.Fatalf("unexpected Retry-After (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "advertise",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/advertise",
+			status: http.StatusAccepted,
+		},
+		{
+			name:   "reload disabled",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/reload",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "reload unauthorized",
+			token:  "secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/reload",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "reload method not allowed",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			path:   "/api/reload",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "reload not enabled",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{err: fmt.Errorf("no loader: %w", os.ErrNotExist)},
+			method: http.MethodPost,
+			path:   "/api/reload",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "reload invalid",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{err: errors.New("invalid max interval")},
+			method: http.MethodPost,
+			path:   "/api/reload",
+			status: http.StatusBadRequest,
+			check: func(t *testing.T, _ http.Header, b []byte) {
+				var body ReloadBody
+				if err := json.Unmarshal(b, &body); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				if diff := cmp.Diff(ReloadBody{Error: "invalid max interval"}, body); diff != "" {
+					t.Fatalf("unexpected reload body (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:  "reload",
+			token: "secret",
+			auth:  "Bearer secret",
+			ctl: &testController{
+				changes: []string{`interface "eth1" added`},
+			},
+			method: http.MethodPost,
+			path:   "/api/reload",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff(contentJSON, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				var body ReloadBody
+				if err := json.Unmarshal(b, &body); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				want := ReloadBody{
+					OK:      true,
+					Changes: []string{`interface "eth1" added`},
+				}
+
+				if diff := cmp.Diff(want, body); diff != "" {
+					t.Fatalf("unexpected reload body (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "events disabled",
+			ctl:    &testController{},
+			path:   "/api/events",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "events unauthorized",
+			token:  "secret",
+			auth:   "Bearer wrong",
+			ctl:    &testController{},
+			path:   "/api/events",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "events empty",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			path:   "/api/events",
+			status: http.StatusOK,
+			check: func(t *testing.T, _ http.Header, b []byte) {
+				if diff := cmp.Diff(`{"events":[]}`+"\n", string(b)); diff != "" {
+					t.Fatalf("unexpected events body (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:  "events",
+			token: "secret",
+			auth:  "Bearer secret",
+			ctl: &testController{
+				events: []system.Event{
+					{
+						Time:      time.Unix(1, 0).UTC(),
+						Type:      system.EventInterfaceUp,
+						Interface: "eth0",
+						Message:   "initialized",
+					},
+					{
+						Time:    time.Unix(2, 0).UTC(),
+						Type:    system.EventReload,
+						Message: "reload requested with 1 configuration change(s)",
+					},
+				},
+			},
+			path:   "/api/events",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff(contentJSON, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				var got EventsBody
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				want := EventsBody{
+					Events: []EventBody{
+						{
+							Time:      time.Unix(1, 0).UTC(),
+							Type:      "interface_up",
+							Interface: "eth0",
+							Message:   "initialized",
+						},
+						{
+							Time:    time.Unix(2, 0).UTC(),
+							Type:    "reload",
+							Message: "reload requested with 1 configuration change(s)",
+						},
+					},
+				}
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected EventsBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "decode disabled",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "decode unauthorized",
+			token:  "secret",
+			auth:   "Bearer wrong",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "decode method not allowed",
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/decode",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "decode too large",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			body:   strings.Repeat("0", maxDecodeBytes+1),
+			status: http.StatusRequestEntityTooLarge,
+			check:  checkDecodeError("hex dump must not exceed 65536 bytes"),
+		},
+		{
+			name:   "decode empty",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			body:   " \n",
+			status: http.StatusBadRequest,
+			check:  checkDecodeError("hex dump is empty"),
+		},
+		{
+			name:   "decode invalid hex",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			body:   "86 00 zz",
+			status: http.StatusBadRequest,
+			check:  checkDecodeError("invalid hex dump: encoding/hex: invalid byte: U+007A 'z'"),
+		},
+		{
+			name:   "decode truncated",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			body:   "86 00 00 00 40",
+			status: http.StatusBadRequest,
+			check: func(t *testing.T, _ http.Header, b []byte) {
+				var body DecodeBody
+				if err := json.Unmarshal(b, &body); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				if body.OK || !strings.HasPrefix(body.Error, "failed to parse NDP message: ") {
+					t.Fatalf("unexpected decode body: %+v", body)
+				}
+			},
+		},
+		{
+			name:   "decode not router advertisement",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			// Router solicitation.
+			body:   "85 00 00 00 00 00 00 00",
+			status: http.StatusBadRequest,
+			check:  checkDecodeError("NDP message is a router solicitation, not a router advertisement"),
+		},
+		{
+			name:   "decode",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/decode",
+			body: `
+			86:00:00:00:40:80:07:08 00:00:00:00:00:00:00:00
+			05:01:00:00:00:00:05:dc
+			`,
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff(contentJSON, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				var got DecodeBody
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				want := DecodeBody{
+					OK: true,
+					RouterAdvertisement: packRA(&ndp.RouterAdvertisement{
+						CurrentHopLimit:      64,
+						ManagedConfiguration: true,
+						RouterLifetime:       30 * time.Minute,
+						Options:              []ndp.Option{ndp.NewMTU(1500)},
+					}),
+				}
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected decode body (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "control unknown action",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/foo",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "profile unauthorized",
+			token:  "secret",
+			path:   "/api/profile?type=goroutine",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "profile bad type",
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/profile?type=heap",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "profile bad seconds",
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/profile?seconds=3600",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "profile method not allowed",
+			token:  "secret",
+			auth:   "Bearer secret",
+			method: http.MethodPost,
+			path:   "/api/profile",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "profile goroutine",
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/profile?type=goroutine",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, body []byte) {
+				if diff := cmp.Diff("application/octet-stream", h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+				if !strings.HasPrefix(h.Get("Content-Disposition"), `attachment; filename="corerad-goroutine-`) {
+					t.Fatalf("unexpected Content-Disposition: %q", h.Get("Content-Disposition"))
+				}
+
+				// Profiles are gzip-compressed protocol buffers.
+				if !bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+					t.Fatal("profile is not gzip-compressed")
+				}
+			},
+		},
+		{
+			name:   "withdraw",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/withdraw",
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "withdraw method not allowed",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			path:   "/api/interfaces/eth0/withdraw",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "promote not found",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{err: fmt.Errorf("no advertiser: %w", os.ErrNotExist)},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/promote",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "cordon",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/cordon",
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "uncordon rate limited",
+			token:  "secret",
+			auth:   "Bearer secret",
+			ctl:    &testController{retry: 4 * time.Second},
+			method: http.MethodPost,
+			path:   "/api/interfaces/eth0/uncordon",
+			status: http.StatusTooManyRequests,
+			check: func(t *testing.T, h http.Header, _ []byte) {
+				if diff := cmp.Diff("4", h.Get("Retry-After")); diff != "" {
+					t.Fatalf("unexpected Retry-After (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces cordoned",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{Name: "eth0", Advertise: true}},
+			ctl:    &testController{cordoned: true, ready: true},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Cordoned:    true,
+						Ready:       true,
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   emptyOptions(),
+						},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces proxy",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{Name: "eth0", Advertise: true, Proxy: true}},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Advertisement: &RouterAdvertisement{
+							NeighborDiscoveryProxy:    true,
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   emptyOptions(),
+						},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces withdrawn ready",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{Name: "eth0", Advertise: true}},
+			ctl:    &testController{withdrawn: true, ready: true},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Withdrawn:   true,
+						Ready:       true,
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   emptyOptions(),
+						},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "interfaces waiting link down",
+			state: system.TestState{
+				Forwarding: true,
+			},
+			ifaces: []config.Interface{{Name: "eth0", Advertise: true}},
+			ctl:    &testController{waiting: true, link: "down"},
+			path:   "/api/interfaces",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				want := InterfacesBody{
+					Advertisers: 1,
+					Interfaces: []InterfaceBody{{
+						Interface:   "eth0",
+						Advertising: true,
+						Waiting:     true,
+						LinkState:   "down",
+						Advertisement: &RouterAdvertisement{
+							RouterSelectionPreference: "medium",
+							ReachableTime:             "0s",
+							RetransmitTimer:           "0s",
+							Options:                   emptyOptions(),
+						},
+					}},
+				}
+
+				if diff := cmp.Diff(want, parseJSONBody(b)); diff != "" {
+					t.Fatalf("unexpected raBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "sockets",
+			state: system.TestState{
+				Sockets: map[string]*system.Socket{
+					"eth0": {
+						Address:   net.ParseIP("fe80::1"),
+						Groups:    []net.IP{net.IPv6linklocalallrouters},
+						ICMPTypes: []ipv6.ICMPType{ipv6.ICMPTypeRouterSolicitation},
+					},
+				},
+			},
+			ifaces: []config.Interface{
+				{Name: "eth0", Advertise: true},
+				{Name: "eth1", Monitor: true},
+			},
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/sockets",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff(contentJSON, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				var got SocketsBody
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				want := SocketsBody{
+					Sockets: []SocketBody{
+						{
+							Interface:       "eth0",
+							Address:         "fe80::1",
+							MulticastGroups: []string{"ff02::2"},
+							ICMPFilter:      []string{"router solicitation"},
+						},
+						{
+							// No active socket.
+							Interface:       "eth1",
+							MulticastGroups: []string{},
+							ICMPFilter:      []string{},
+						},
+					},
+				}
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected SocketsBody (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "plugins",
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/plugins",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff(contentJSON, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				var got PluginsBody
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+
+				// Spot check a plugin configured by keys and one configured
+				// by a table, rather than the entire schema.
+				want := map[string]PluginBody{
+					"lla": {
+						Name:    "lla",
+						Options: []string{"source link-layer address"},
+						Fields: []FieldBody{
+							{Key: "source_lla", Type: "boolean"},
+							{Key: "source_lla_unsolicited", Type: "boolean"},
+							{Key: "source_lla_override", Type: "string"},
+						},
+					},
+					"upstream": {
+						Name:    "upstream",
+						Table:   "upstream",
+						Options: []string{},
+						Fields: []FieldBody{
+							{Key: "interval", Type: "string"},
+							{Key: "hysteresis", Type: "integer"},
+						},
+					},
+				}
+
+				for _, p := range got.Plugins {
+					w, ok := want[p.Name]
+					if !ok {
+						continue
+					}
+					delete(want, p.Name)
+
+					if diff := cmp.Diff(w, p); diff != "" {
+						t.Fatalf("unexpected PluginBody (-want +got):\n%s", diff)
+					}
+				}
+
+				if len(want) > 0 {
+					t.Fatalf("missing plugins: %v", want)
+				}
+			},
+		},
+		{
+			name: "config",
+			ifaces: []config.Interface{
+				{
+					Name:    "eth0",
+					Plugins: []plugin.Plugin{plugin.NewMTU(1500), &plugin.LLA{}},
+				},
+				{Name: "eth1"},
+			},
+			token:  "secret",
+			auth:   "Bearer secret",
+			path:   "/api/config",
+			status: http.StatusOK,
+			check: func(t *testing.T, h http.Header, b []byte) {
+				if diff := cmp.Diff(contentText, h.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+
+				c, err := config.Parse(bytes.NewReader(b), time.Time{})
+				if err != nil {
+					t.Fatalf("failed to parse configuration: %v\n%s", err, b)
+				}
+
+				var names []string
+				for _, ifi := range c.Interfaces {
+					names = append(names, ifi.Name)
+				}
+
+				if diff := cmp.Diff([]string{"eth0", "eth1"}, names); diff != "" {
+					t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff(plugin.NewMTU(1500), c.Interfaces[0].Plugins[0]); diff != "" {
+					t.Fatalf("unexpected plugin (-want +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name: "error fetching forwarding",
+			state: system.TestState{
+				Forwarding: true,
+				Error:      os.ErrPermission,
+			},
+			ifaces: []config.Interface{
+				{Name: "eth0", Advertise: true},
+			},
+			path:   "/api/interfaces",
+			status: http.StatusInternalServerError,
+			check: func(t *testing.T, _ http.Header, b []byte) {
+				if !bytes.HasPrefix(b, []byte(`failed to check interface "eth0" forwarding`)) {
+					t.Fatalf("unexpected body output: %s", string(b))
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create a Prometheus registry with a known-good set of metrics
+			// that we can check for when the Prometheus functionality is
+			// enabled.
+			reg := prometheus.NewPedanticRegistry()
+			reg.MustRegister(prometheus.NewGoCollector())
+
+			ifaceProm := make(map[string]http.Handler)
+			for _, ifi := range tt.ifaces {
+				ireg := prometheus.NewPedanticRegistry()
+				ireg.MustRegister(prometheus.NewGoCollector())
+				ifaceProm[ifi.Name] = NewMetricsHandler(ireg, tt.openMetrics)
+			}
+
+			srv := httptest.NewServer(
+				NewHandler(
+					log.New(ioutil.Discard, "", 0),
+					tt.state,
+					config.Config{
+						MaxAdvertisers: tt.maxAdvertisers,
+						Interfaces:     tt.ifaces,
+						Debug: config.Debug{
+							Prometheus:  tt.prometheus,
+							OpenMetrics: tt.openMetrics,
+							PProf:       tt.pprof,
+							Token:       tt.token,
+							Banner:      tt.banner,
+						},
+					},
+					NewMetricsHandler(reg, tt.openMetrics),
+					ifaceProm,
+					tt.ctl,
+				),
+			)
+			defer srv.Close()
+
+			// Use string contenation rather than path.Join because we want to
+			// not escape any raw query parameters provided as part of the path.
+			u, err := url.Parse(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("failed to parse URL: %v", err)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req, err := http.NewRequest(method, u.String(), strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("failed to create HTTP request: %v", err)
+			}
+
+			// Setting Accept-Encoding explicitly disables transparent
+			// decompression by the client so we can inspect the response.
+			if tt.gzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			c := &http.Client{Timeout: 2 * time.Second}
+			res, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("failed to HTTP GET: %v", err)
+			}
+			defer res.Body.Close()
+
+			if diff := cmp.Diff(tt.status, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected HTTP status code (-want +got):\n%s", diff)
+			}
+
+			// If set, apply an additional sanity check on the response body.
+			if tt.check == nil {
+				return
+			}
+
+			var r io.Reader = res.Body
+			if res.Header.Get("Content-Encoding") == "gzip" {
+				zr, err := gzip.NewReader(res.Body)
+				if err != nil {
+					t.Fatalf("failed to create gzip reader: %v", err)
+				}
+				defer zr.Close()
+				r = zr
+			}
+
+			// Don't consume a stream larger than a sane upper bound.
+			const mb = 1 << 20
+			body, err := ioutil.ReadAll(io.LimitReader(r, 2*mb))
+			if err != nil {
+				t.Fatalf("failed to read HTTP body: %v", err)
+			}
+
+			tt.check(t, res.Header, body)
+		})
+	}
+}
+
+// checkMetricsGzip verifies that a Prometheus metrics response body was
+// compressed with gzip exactly once, so that a single decompression produces
+// the plain text metrics.
+func checkMetricsGzip(t *testing.T, h http.Header, body []byte) {
+	if diff := cmp.Diff([]string{"gzip"}, h.Values("Content-Encoding")); diff != "" {
+		t.Fatalf("unexpected Content-Encoding (-want +got):\n%s", diff)
+	}
+
+	if !bytes.HasPrefix(body, []byte("# HELP go_")) {
+		t.Fatal("Prometheus Go collector metric was not found")
+	}
+}
+
+// checkDecodeError produces a check function which verifies that the decode
+// route reported the error message want.
+func checkDecodeError(want string) func(t *testing.T, h http.Header, b []byte) {
+	return func(t *testing.T, _ http.Header, b []byte) {
+		var body DecodeBody
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Fatalf("failed to unmarshal JSON: %v", err)
+		}
+
+		if diff := cmp.Diff(DecodeBody{Error: want}, body); diff != "" {
+			t.Fatalf("unexpected decode body (-want +got):\n%s", diff)
+		}
+	}
+}
+
+// A testController is a Controller which verifies it is invoked for eth0.
+type testController struct {
+	retry                               time.Duration
+	withdrawn, cordoned, ready, waiting bool
+	link                                string
+	lifetime                            time.Duration
+	ramping                             bool
+	changes                             []string
+	events                              []system.Event
+	err                                 error
+}
+
+var (
+	_ Controller     = &testController{}
+	_ Reloader       = &testController{}
+	_ EventLogger    = &testController{}
+	_ LifetimeRamper = &testController{}
+)
+
+func (c *testController) Advertise(iface string) (time.Duration, error) {
+	c.check(iface)
+	return c.retry, c.err
+}
+
+func (c *testController) Withdraw(iface string, withdraw bool) error {
+	c.check(iface)
+	if c.err == nil {
+		c.withdrawn = withdraw
+	}
+
+	return c.err
+}
+
+func (c *testController) Cordon(iface string, cordon bool) (time.Duration, error) {
+	c.check(iface)
+	if c.err == nil && c.retry == 0 {
+		c.cordoned = cordon
+	}
+
+	return c.retry, c.err
+}
+
+func (c *testController) Status(iface string) (bool, bool, bool, bool, string, error) {
+	c.check(iface)
+	return c.withdrawn, c.cordoned, c.ready, c.waiting, c.link, c.err
+}
+
+func (c *testController) RouterLifetime(iface string) (time.Duration, bool, error) {
+	c.check(iface)
+	return c.lifetime, c.ramping, c.err
+}
+
+func (c *testController) Reload() ([]string, error) {
+	return c.changes, c.err
+}
+
+func (c *testController) Events() []system.Event { return c.events }
+
+func (*testController) check(iface string) {
+	if iface != "eth0" {
+		panicf("unexpected interface: %q", iface)
+	}
+}
+
+func parseJSONBody(b []byte) InterfacesBody {
+	var body InterfacesBody
+	if err := json.Unmarshal(b, &body); err != nil {
+		panicf("failed to unmarshal JSON: %v", err)
+	}
+
+	return body
+}
+
+// emptyOptions produces the Options for an RA which carries no list options.
+func emptyOptions() Options {
+	return Options{
+		DNSSL:    []DNSSL{},
+		Prefixes: []Prefix{},
+		RDNSS:    []RDNSS{},
+		Routes:   []Route{},
+	}
+}
+
+// unhealthyUpstream produces a plugin.Upstream which has failed its checks.
+func unhealthyUpstream() *plugin.Upstream {
+	u := &plugin.Upstream{
+		Hysteresis: 1,
+		Check:      func() (bool, error) { return false, nil },
+	}
+
+	if _, err := u.Update(); err != nil {
+		panicf("failed to update upstream: %v", err)
+	}
+
+	return u
 }
@@ -0,0 +1,156 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits for one-shot profiles.
+const (
+	// profileInterval is the minimum time between the start of each profile.
+	profileInterval = 1 * time.Minute
+
+	// defaultProfileSeconds and maxProfileSeconds bound the duration of a
+	// CPU profile.
+	defaultProfileSeconds = 5
+	maxProfileSeconds     = 30
+)
+
+// A profiler captures bounded, one-shot runtime profiles so that CoreRAD can
+// be profiled without permanently enabling the pprof routes. Only one profile
+// may be captured at a time, and profiles are rate limited.
+type profiler struct {
+	mu   sync.Mutex
+	busy bool
+	last time.Time
+
+	// Can be swapped for tests.
+	timeNow func() time.Time
+}
+
+// newProfiler creates a profiler.
+func newProfiler() *profiler {
+	return &profiler{timeNow: time.Now}
+}
+
+// start reserves the profiler, or returns a non-zero duration after which the
+// caller may try again. If start succeeds, done must be called when the
+// profile is complete.
+func (p *profiler) start() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.timeNow()
+	if p.busy {
+		return profileInterval
+	}
+	if !p.last.IsZero() {
+		if next := p.last.Add(profileInterval); now.Before(next) {
+			return next.Sub(now)
+		}
+	}
+
+	p.busy = true
+	p.last = now
+	return 0
+}
+
+// done releases the profiler after a profile.
+func (p *profiler) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy = false
+}
+
+// profile serves a one-shot CPU or goroutine profile in pprof format. Advertiser
+// goroutines are labeled with their interface names, so a profile can be scoped
+// to a single interface using pprof's -tagfocus flag.
+func (h *Handler) profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	typ := query.Get("type")
+	switch typ {
+	case "":
+		typ = "cpu"
+	case "cpu", "goroutine":
+	default:
+		http.Error(w, fmt.Sprintf("unsupported profile type %q", typ), http.StatusBadRequest)
+		return
+	}
+
+	seconds := defaultProfileSeconds
+	if s := query.Get("seconds"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxProfileSeconds {
+			http.Error(w, fmt.Sprintf("profile seconds must be between 1 and %d", maxProfileSeconds),
+				http.StatusBadRequest)
+			return
+		}
+		seconds = n
+	}
+
+	if retry := h.prof.start(); retry > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		http.Error(w, fmt.Sprintf("rate limited, retry after %s", retry.Round(time.Millisecond)),
+			http.StatusTooManyRequests)
+		return
+	}
+	defer h.prof.done()
+
+	h.ll.Printf("HTTP server capturing one-shot %s profile for %s", typ, r.RemoteAddr)
+
+	// Buffer the profile so that any error can still be reported with an
+	// appropriate status.
+	var buf bytes.Buffer
+	switch typ {
+	case "cpu":
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			// CPU profiling may already be enabled by the pprof routes.
+			http.Error(w, fmt.Sprintf("failed to start CPU profile: %v", err), http.StatusConflict)
+			return
+		}
+
+		timer := time.NewTimer(time.Duration(seconds) * time.Second)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+		}
+
+		pprof.StopCPUProfile()
+	case "goroutine":
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+			h.errorf(w, "failed to write goroutine profile: %v", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="corerad-%s-%d.pprof"`,
+		typ, h.prof.timeNow().Unix()))
+	_, _ = w.Write(buf.Bytes())
+}
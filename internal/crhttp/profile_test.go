@@ -0,0 +1,52 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProfilerRateLimit(t *testing.T) {
+	var (
+		now = time.Unix(0, 0)
+		p   = newProfiler()
+	)
+	p.timeNow = func() time.Time { return now }
+
+	if retry := p.start(); retry != 0 {
+		t.Fatalf("first profile was rate limited for %s", retry)
+	}
+
+	// Only one profile may run at a time.
+	now = now.Add(2 * time.Minute)
+	if diff := cmp.Diff(profileInterval, p.start()); diff != "" {
+		t.Fatalf("unexpected retry for concurrent profile (-want +got):\n%s", diff)
+	}
+
+	p.done()
+
+	// Profiles are rate limited from the start of the previous profile.
+	if retry := p.start(); retry != 0 {
+		t.Fatalf("second profile was rate limited for %s", retry)
+	}
+	p.done()
+
+	now = now.Add(45 * time.Second)
+	if diff := cmp.Diff(15*time.Second, p.start()); diff != "" {
+		t.Fatalf("unexpected retry for rate limited profile (-want +got):\n%s", diff)
+	}
+}
@@ -14,44 +14,49 @@
 package crhttp
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math"
 	"net"
+	"strings"
+	"time"
 
+	"github.com/mdlayher/corerad/client"
+	"github.com/mdlayher/corerad/internal/plugin"
 	"github.com/mdlayher/ndp"
 )
 
-// An interfacesBody is the top-level structure returned by the debug API's
-// interfaces route.
-type interfacesBody struct {
-	Interfaces []interfaceBody `json:"interfaces"`
-}
-
-// An interfaceBody represents an individual advertising interface.
-type interfaceBody struct {
-	Interface   string `json:"interface"`
-	Advertising bool   `json:"advertise"`
-
-	// Nil if Advertising is false.
-	Advertisement *routerAdvertisement `json:"advertisement"`
-}
-
-// A routerAdvertisement represents an unpacked NDP router advertisement.
-type routerAdvertisement struct {
-	CurrentHopLimit             int     `json:"current_hop_limit"`
-	ManagedConfiguration        bool    `json:"managed_configuration"`
-	OtherConfiguration          bool    `json:"other_configuration"`
-	MobileIPv6HomeAgent         bool    `json:"mobile_ipv6_home_agent"`
-	RouterSelectionPreference   string  `json:"router_selection_preference"`
-	NeighborDiscoveryProxy      bool    `json:"neighbor_discovery_proxy"`
-	RouterLifetimeSeconds       int     `json:"router_lifetime_seconds"`
-	ReachableTimeMilliseconds   int     `json:"reachable_time_milliseconds"`
-	RetransmitTimerMilliseconds int     `json:"retransmit_timer_milliseconds"`
-	Options                     options `json:"options"`
-}
+// The debug API's response types are defined by package client so that they
+// may be used outside of CoreRAD.
+type (
+	InterfacesBody      = client.InterfacesBody
+	InterfaceBody       = client.InterfaceBody
+	VLANBody            = client.VLANBody
+	TimerRangeBody      = client.TimerRangeBody
+	RenumberBody        = client.RenumberBody
+	ConflictsBody       = client.ConflictsBody
+	ConflictBody        = client.ConflictBody
+	EventsBody          = client.EventsBody
+	EventBody           = client.EventBody
+	ReloadBody          = client.ReloadBody
+	DecodeBody          = client.DecodeBody
+	SocketsBody         = client.SocketsBody
+	SocketBody          = client.SocketBody
+	PluginsBody         = client.PluginsBody
+	PluginBody          = client.PluginBody
+	FieldBody           = client.FieldBody
+	RouterAdvertisement = client.RouterAdvertisement
+	Options             = client.Options
+	RawOption           = client.RawOption
+	DNSSL               = client.DNSSL
+	Prefix              = client.Prefix
+	RDNSS               = client.RDNSS
+	Route               = client.Route
+)
 
-// packRA packs the data from an RA into a routerAdvertisement structure.
-func packRA(ra *ndp.RouterAdvertisement) *routerAdvertisement {
-	return &routerAdvertisement{
+// packRA packs the data from an RA into a RouterAdvertisement structure.
+func packRA(ra *ndp.RouterAdvertisement) *RouterAdvertisement {
+	return &RouterAdvertisement{
 		CurrentHopLimit:             int(ra.CurrentHopLimit),
 		ManagedConfiguration:        ra.ManagedConfiguration,
 		OtherConfiguration:          ra.OtherConfiguration,
@@ -60,7 +65,9 @@ func packRA(ra *ndp.RouterAdvertisement) *routerAdvertisement {
 		NeighborDiscoveryProxy:      ra.NeighborDiscoveryProxy,
 		RouterLifetimeSeconds:       int(ra.RouterLifetime.Seconds()),
 		ReachableTimeMilliseconds:   int(ra.ReachableTime.Milliseconds()),
+		ReachableTime:               plugin.DurationString(ra.ReachableTime),
 		RetransmitTimerMilliseconds: int(ra.RetransmitTimer.Milliseconds()),
+		RetransmitTimer:             plugin.DurationString(ra.RetransmitTimer),
 		Options:                     packOptions(ra.Options),
 	}
 }
@@ -79,51 +86,20 @@ func preference(p ndp.Preference) string {
 	}
 }
 
-// options represents the options unpacked from an NDP router advertisement.
-type options struct {
-	DNSSL                  []dnssl  `json:"dnssl"`
-	MTU                    int      `json:"mtu"`
-	Prefixes               []prefix `json:"prefixes"`
-	RDNSS                  []rdnss  `json:"rdnss"`
-	Routes                 []route  `json:"routes"`
-	SourceLinkLayerAddress string   `json:"source_link_layer_address"`
-}
-
-// A dnssl represents an NDP DNS Search List option.
-type dnssl struct {
-	LifetimeSeconds int      `json:"lifetime_seconds"`
-	DomainNames     []string `json:"domain_names"`
-}
-
-// A prefix represents an NDP Prefix Information option.
-type prefix struct {
-	Prefix                             string `json:"prefix"`
-	OnLink                             bool   `json:"on_link"`
-	AutonomousAddressAutoconfiguration bool   `json:"autonomous_address_autoconfiguration"`
-	ValidLifetimeSeconds               int    `json:"valid_lifetime_seconds"`
-	PreferredLifetimeSeconds           int    `json:"preferred_lifetime_seconds"`
-}
-
-// A RDNSS represents an NDP Recursive DNS Servers option.
-type rdnss struct {
-	LifetimeSeconds int      `json:"lifetime_seconds"`
-	Servers         []string `json:"servers"`
-}
-
-// A route represents an NDP Prefix Information option.
-type route struct {
-	Prefix               string `json:"prefix"`
-	Preference           string `json:"preference"`
-	RouteLifetimeSeconds int    `json:"route_lifetime_seconds"`
-}
-
-// packOptions unpacks individual NDP options to produce an options structure.
-func packOptions(opts []ndp.Option) options {
-	var out options
+// packOptions unpacks individual NDP options to produce an Options structure.
+func packOptions(opts []ndp.Option) Options {
+	// Always produce empty JSON arrays rather than null, so clients can tell
+	// that an RA with no prefixes (e.g. RDNSS-only mode) is intentional.
+	out := Options{
+		DNSSL:    []DNSSL{},
+		Prefixes: []Prefix{},
+		RDNSS:    []RDNSS{},
+		Routes:   []Route{},
+	}
 	for _, o := range opts {
 		switch o := o.(type) {
 		case *ndp.DNSSearchList:
-			out.DNSSL = append(out.DNSSL, dnssl{
+			out.DNSSL = append(out.DNSSL, DNSSL{
 				LifetimeSeconds: int(o.Lifetime.Seconds()),
 				DomainNames:     o.DomainNames,
 			})
@@ -132,25 +108,38 @@ func packOptions(opts []ndp.Option) options {
 		case *ndp.MTU:
 			out.MTU = int(*o)
 		case *ndp.PrefixInformation:
-			out.Prefixes = append(out.Prefixes, prefix{
-				Prefix:                             prefixString(o.Prefix, o.PrefixLength),
-				OnLink:                             o.OnLink,
-				AutonomousAddressAutoconfiguration: o.AutonomousAddressConfiguration,
-				ValidLifetimeSeconds:               int(o.ValidLifetime.Seconds()),
-				PreferredLifetimeSeconds:           int(o.PreferredLifetime.Seconds()),
-			})
+			out.Prefixes = append(out.Prefixes, packPrefix(o, false))
+		case *ndp.RawOption:
+			if pi, routerAddress, ok := plugin.PrefixInformation(o); ok {
+				// Prefixes with the router address flag set.
+				out.Prefixes = append(out.Prefixes, packPrefix(pi, routerAddress))
+				break
+			}
+
+			switch o.Type {
+			case plugin.CaptivePortalType:
+				// Trim the NUL padding from the URI.
+				out.CaptivePortal = strings.TrimRight(string(o.Value), "\x00")
+			case plugin.NonceType:
+				out.Nonce = hex.EncodeToString(o.Value)
+			default:
+				out.RawOptions = append(out.RawOptions, RawOption{
+					Type:  int(o.Type),
+					Value: hex.EncodeToString(o.Value),
+				})
+			}
 		case *ndp.RecursiveDNSServer:
 			servers := make([]string, 0, len(o.Servers))
 			for _, s := range o.Servers {
 				servers = append(servers, s.String())
 			}
 
-			out.RDNSS = append(out.RDNSS, rdnss{
+			out.RDNSS = append(out.RDNSS, RDNSS{
 				LifetimeSeconds: int(o.Lifetime.Seconds()),
 				Servers:         servers,
 			})
 		case *ndp.RouteInformation:
-			out.Routes = append(out.Routes, route{
+			out.Routes = append(out.Routes, Route{
 				// Pack prefix and mask into a combined CIDR notation string.
 				Prefix:               prefixString(o.Prefix, o.PrefixLength),
 				Preference:           preference(o.Preference),
@@ -164,6 +153,217 @@ func packOptions(opts []ndp.Option) options {
 	return out
 }
 
+// packPrefix converts pi into a Prefix.
+func packPrefix(pi *ndp.PrefixInformation, routerAddress bool) Prefix {
+	return Prefix{
+		Prefix:                             prefixString(pi.Prefix, pi.PrefixLength),
+		OnLink:                             pi.OnLink,
+		AutonomousAddressAutoconfiguration: pi.AutonomousAddressConfiguration,
+		RouterAddress:                      routerAddress,
+		ValidLifetimeSeconds:               int(pi.ValidLifetime.Seconds()),
+		PreferredLifetimeSeconds:           int(pi.PreferredLifetime.Seconds()),
+	}
+}
+
+// UnpackRA converts a RouterAdvertisement produced by the debug API back into
+// an NDP router advertisement, so that router advertisements captured from a
+// running CoreRAD instance can be replayed, such as in tests. UnpackRA is the
+// inverse of the packing performed by the debug API, but NDP options are
+// always produced in a fixed order.
+func UnpackRA(ra *RouterAdvertisement) (*ndp.RouterAdvertisement, error) {
+	pref, err := parsePreference(ra.RouterSelectionPreference)
+	if err != nil {
+		return nil, err
+	}
+
+	if ra.CurrentHopLimit < 0 || ra.CurrentHopLimit > 255 {
+		return nil, fmt.Errorf("crhttp: invalid current hop limit: %d", ra.CurrentHopLimit)
+	}
+
+	opts, err := unpackOptions(ra.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ndp.RouterAdvertisement{
+		CurrentHopLimit:           uint8(ra.CurrentHopLimit),
+		ManagedConfiguration:      ra.ManagedConfiguration,
+		OtherConfiguration:        ra.OtherConfiguration,
+		MobileIPv6HomeAgent:       ra.MobileIPv6HomeAgent,
+		RouterSelectionPreference: pref,
+		NeighborDiscoveryProxy:    ra.NeighborDiscoveryProxy,
+		RouterLifetime:            seconds(ra.RouterLifetimeSeconds),
+		ReachableTime:             time.Duration(ra.ReachableTimeMilliseconds) * time.Millisecond,
+		RetransmitTimer:           time.Duration(ra.RetransmitTimerMilliseconds) * time.Millisecond,
+		Options:                   opts,
+	}, nil
+}
+
+// unpackOptions converts Options back into individual NDP options.
+func unpackOptions(o Options) ([]ndp.Option, error) {
+	var opts []ndp.Option
+
+	for _, p := range o.Prefixes {
+		ip, length, err := parsePrefix(p.Prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.RouterAddress {
+			// The full router address must be preserved.
+			ip, _, _ = net.ParseCIDR(p.Prefix)
+		}
+
+		pi := &ndp.PrefixInformation{
+			PrefixLength:                   length,
+			OnLink:                         p.OnLink,
+			AutonomousAddressConfiguration: p.AutonomousAddressAutoconfiguration,
+			ValidLifetime:                  seconds(p.ValidLifetimeSeconds),
+			PreferredLifetime:              seconds(p.PreferredLifetimeSeconds),
+			Prefix:                         ip,
+		}
+
+		if p.RouterAddress {
+			opts = append(opts, plugin.RouterAddressOption(pi))
+			continue
+		}
+
+		opts = append(opts, pi)
+	}
+
+	for _, r := range o.Routes {
+		ip, length, err := parsePrefix(r.Prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		pref, err := parsePreference(r.Preference)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, &ndp.RouteInformation{
+			PrefixLength:  length,
+			Preference:    pref,
+			RouteLifetime: seconds(r.RouteLifetimeSeconds),
+			Prefix:        ip,
+		})
+	}
+
+	for _, r := range o.RDNSS {
+		servers := make([]net.IP, 0, len(r.Servers))
+		for _, s := range r.Servers {
+			ip := net.ParseIP(s)
+			if ip == nil || ip.To4() != nil {
+				return nil, fmt.Errorf("crhttp: invalid RDNSS server: %q", s)
+			}
+
+			servers = append(servers, ip)
+		}
+
+		opts = append(opts, &ndp.RecursiveDNSServer{
+			Lifetime: seconds(r.LifetimeSeconds),
+			Servers:  servers,
+		})
+	}
+
+	for _, d := range o.DNSSL {
+		opts = append(opts, &ndp.DNSSearchList{
+			Lifetime:    seconds(d.LifetimeSeconds),
+			DomainNames: d.DomainNames,
+		})
+	}
+
+	if o.MTU != 0 {
+		if o.MTU < 0 || int64(o.MTU) > math.MaxUint32 {
+			return nil, fmt.Errorf("crhttp: invalid MTU: %d", o.MTU)
+		}
+
+		opts = append(opts, ndp.NewMTU(uint32(o.MTU)))
+	}
+
+	if o.CaptivePortal != "" {
+		cp, err := plugin.NewCaptivePortalOption(o.CaptivePortal)
+		if err != nil {
+			return nil, fmt.Errorf("crhttp: %v", err)
+		}
+
+		opts = append(opts, cp)
+	}
+
+	if o.Nonce != "" {
+		b, err := hex.DecodeString(o.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("crhttp: invalid nonce: %v", err)
+		}
+		if (len(b)+2)%8 != 0 {
+			return nil, fmt.Errorf("crhttp: invalid nonce length: %d", len(b))
+		}
+
+		opts = append(opts, plugin.NewNonceOption(b))
+	}
+
+	for _, r := range o.RawOptions {
+		if r.Type < 0 || r.Type > math.MaxUint8 {
+			return nil, fmt.Errorf("crhttp: invalid raw option type: %d", r.Type)
+		}
+
+		b, err := hex.DecodeString(r.Value)
+		if err != nil {
+			return nil, fmt.Errorf("crhttp: invalid raw option value: %v", err)
+		}
+
+		ro, err := plugin.NewRawOption(uint8(r.Type), b)
+		if err != nil {
+			return nil, fmt.Errorf("crhttp: %v", err)
+		}
+
+		opts = append(opts, ro)
+	}
+
+	if o.SourceLinkLayerAddress != "" {
+		addr, err := net.ParseMAC(o.SourceLinkLayerAddress)
+		if err != nil {
+			return nil, fmt.Errorf("crhttp: invalid source link-layer address: %v", err)
+		}
+
+		opts = append(opts, &ndp.LinkLayerAddress{
+			Direction: ndp.Source,
+			Addr:      addr,
+		})
+	}
+
+	return opts, nil
+}
+
+// parsePreference is the inverse of preference.
+func parsePreference(s string) (ndp.Preference, error) {
+	switch s {
+	case "low":
+		return ndp.Low, nil
+	case "medium":
+		return ndp.Medium, nil
+	case "high":
+		return ndp.High, nil
+	default:
+		return 0, fmt.Errorf("crhttp: invalid preference: %q", s)
+	}
+}
+
+// parsePrefix is the inverse of prefixString.
+func parsePrefix(s string) (net.IP, uint8, error) {
+	ip, ipn, err := net.ParseCIDR(s)
+	if err != nil || ip.To4() != nil {
+		return nil, 0, fmt.Errorf("crhttp: invalid IPv6 prefix: %q", s)
+	}
+
+	ones, _ := ipn.Mask.Size()
+	return ipn.IP, uint8(ones), nil
+}
+
+// seconds converts an integer number of seconds to a time.Duration.
+func seconds(s int) time.Duration { return time.Duration(s) * time.Second }
+
 // prefixString combines prefix and length into a CIDR notation string.
 func prefixString(prefix net.IP, length uint8) string {
 	return (&net.IPNet{
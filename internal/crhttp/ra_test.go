@@ -0,0 +1,195 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crhttp
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/corerad/internal/plugin"
+	"github.com/mdlayher/ndp"
+)
+
+func TestUnpackRARoundTrip(t *testing.T) {
+	cp, err := plugin.NewCaptivePortalOption("https://portal.example.com/api")
+	if err != nil {
+		t.Fatalf("failed to create captive portal option: %v", err)
+	}
+
+	// Options are in the fixed order produced by UnpackRA.
+	want := &ndp.RouterAdvertisement{
+		CurrentHopLimit:           64,
+		ManagedConfiguration:      true,
+		OtherConfiguration:        true,
+		RouterSelectionPreference: ndp.High,
+		RouterLifetime:            30 * time.Minute,
+		ReachableTime:             12345 * time.Millisecond,
+		RetransmitTimer:           1 * time.Second,
+		Options: []ndp.Option{
+			&ndp.PrefixInformation{
+				PrefixLength:                   64,
+				OnLink:                         true,
+				AutonomousAddressConfiguration: true,
+				ValidLifetime:                  ndp.Infinity,
+				PreferredLifetime:              4 * time.Hour,
+				Prefix:                         net.ParseIP("2001:db8::"),
+			},
+			plugin.RouterAddressOption(&ndp.PrefixInformation{
+				PrefixLength:                   64,
+				OnLink:                         true,
+				AutonomousAddressConfiguration: true,
+				ValidLifetime:                  ndp.Infinity,
+				PreferredLifetime:              4 * time.Hour,
+				Prefix:                         net.ParseIP("2001:db8::1"),
+			}),
+			&ndp.RouteInformation{
+				PrefixLength:  48,
+				Preference:    ndp.Low,
+				RouteLifetime: 10 * time.Minute,
+				Prefix:        net.ParseIP("2001:db8:ffff::"),
+			},
+			&ndp.RecursiveDNSServer{
+				Lifetime: 1 * time.Hour,
+				Servers:  []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")},
+			},
+			&ndp.DNSSearchList{
+				Lifetime:    1 * time.Hour,
+				DomainNames: []string{"lan.example.com"},
+			},
+			ndp.NewMTU(1500),
+			cp,
+			plugin.NewNonceOption([]byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}),
+			&ndp.RawOption{
+				Type:   253,
+				Length: 1,
+				Value:  []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+			},
+			&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			},
+		},
+	}
+
+	// Round trip through JSON as a client of the debug API would.
+	b, err := json.Marshal(packRA(want))
+	if err != nil {
+		t.Fatalf("failed to marshal JSON: %v", err)
+	}
+
+	var body RouterAdvertisement
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatalf("failed to unmarshal JSON: %v", err)
+	}
+
+	got, err := UnpackRA(&body)
+	if err != nil {
+		t.Fatalf("failed to unpack RA: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+}
+
+func TestPackRAWithdrawnRDNSS(t *testing.T) {
+	ra := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{&ndp.RecursiveDNSServer{
+			Servers: []net.IP{net.ParseIP("2001:db8::1")},
+		}},
+	}
+
+	b, err := json.Marshal(packRA(ra).Options.RDNSS)
+	if err != nil {
+		t.Fatalf("failed to marshal JSON: %v", err)
+	}
+
+	// The zero lifetime must be present so clients can tell the server is
+	// being withdrawn.
+	want := `[{"lifetime_seconds":0,"servers":["2001:db8::1"]}]`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("unexpected RDNSS JSON (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnpackRAErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ra   *RouterAdvertisement
+	}{
+		{
+			name: "preference",
+			ra:   &RouterAdvertisement{RouterSelectionPreference: "foo"},
+		},
+		{
+			name: "hop limit",
+			ra: &RouterAdvertisement{
+				CurrentHopLimit:           256,
+				RouterSelectionPreference: "medium",
+			},
+		},
+		{
+			name: "prefix",
+			ra: &RouterAdvertisement{
+				RouterSelectionPreference: "medium",
+				Options: Options{
+					Prefixes: []Prefix{{Prefix: "192.0.2.0/24"}},
+				},
+			},
+		},
+		{
+			name: "RDNSS",
+			ra: &RouterAdvertisement{
+				RouterSelectionPreference: "medium",
+				Options: Options{
+					RDNSS: []RDNSS{{Servers: []string{"foo"}}},
+				},
+			},
+		},
+		{
+			name: "nonce",
+			ra: &RouterAdvertisement{
+				RouterSelectionPreference: "medium",
+				Options:                   Options{Nonce: "deadbeef"},
+			},
+		},
+		{
+			name: "raw option",
+			ra: &RouterAdvertisement{
+				RouterSelectionPreference: "medium",
+				Options: Options{
+					RawOptions: []RawOption{{Type: 253, Value: "00"}},
+				},
+			},
+		},
+		{
+			name: "source link-layer address",
+			ra: &RouterAdvertisement{
+				RouterSelectionPreference: "medium",
+				Options:                   Options{SourceLinkLayerAddress: "foo"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnpackRA(tt.ra); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
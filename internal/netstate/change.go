@@ -28,6 +28,10 @@ const (
 	LinkNotPresent
 	LinkLowerLayerDown
 
+	// AddressChange indicates that an IPv6 address was added to or removed
+	// from a network interface.
+	AddressChange
+
 	// LinkAny is a convenience bitmask which indicates interest in all
 	// Link* Changes.
 	LinkAny Change = LinkUp |
@@ -48,6 +52,7 @@ var changeStrings = []string{
 	"link dormant",
 	"link not present",
 	"link lower layer down",
+	"address change",
 }
 
 // String returns the string representation of a Change.
@@ -18,6 +18,7 @@ package netstate
 import (
 	"context"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/jsimonetti/rtnetlink"
@@ -32,7 +33,8 @@ var deadlineNow = time.Unix(0, 1)
 // osWatch is the OS-specific portion of a Watcher's Watch method.
 func osWatch(ctx context.Context, notify func(changeSet)) error {
 	c, err := rtnetlink.Dial(&netlink.Config{
-		Groups: 0x1, // RTMGRP_LINK (TODO: move to x/sys).
+		// RTMGRP_LINK | RTMGRP_IPV6_IFADDR (TODO: move to x/sys).
+		Groups: 0x1 | 0x100,
 	})
 	if err != nil {
 		return fmt.Errorf("netstate: watcher failed to dial route netlink: %w", err)
@@ -63,17 +65,37 @@ func osWatch(ctx context.Context, notify func(changeSet)) error {
 		}
 
 		// Received messages; produce a changeSet and notify subscribers.
-		notify(process(msgs))
+		notify(process(msgs, interfaceName))
 	}
 }
 
+// interfaceName looks up the name of a network interface by index.
+func interfaceName(index int) (string, bool) {
+	ifi, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return "", false
+	}
+
+	return ifi.Name, true
+}
+
 // process handles received route netlink messages and produces a changeSet
-// suitable for use with the Watcher.notify method.
-func process(msgs []rtnetlink.Message) changeSet {
+// suitable for use with the Watcher.notify method. name is used to look up
+// the names of interfaces referenced only by index.
+func process(msgs []rtnetlink.Message, name func(index int) (string, bool)) changeSet {
 	changes := make(changeSet)
 	for _, m := range msgs {
-		// TODO: also inspect other message types for addresses, routes, etc.
+		// TODO: also inspect other message types for routes, etc.
 		switch m := m.(type) {
+		case *rtnetlink.AddressMessage:
+			// The interface may have already been removed, in which case
+			// there is nothing to do.
+			iface, ok := name(int(m.Index))
+			if !ok {
+				continue
+			}
+
+			changes[iface] = append(changes[iface], AddressChange)
 		case *rtnetlink.LinkMessage:
 			// TODO: inspect message header/type?
 
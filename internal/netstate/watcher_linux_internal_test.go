@@ -64,17 +64,43 @@ func Test_process(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "address",
+			msgs: []rtnetlink.Message{
+				&rtnetlink.AddressMessage{Index: 1},
+				&rtnetlink.AddressMessage{Index: 2},
+				&rtnetlink.AddressMessage{Index: 1},
+				// Unknown interface index, no effect on the output.
+				&rtnetlink.AddressMessage{Index: 999},
+			},
+			want: map[string][]Change{
+				"test0": {AddressChange, AddressChange},
+				"test1": {AddressChange},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if diff := cmp.Diff(tt.want, process(tt.msgs)); diff != "" {
+			if diff := cmp.Diff(tt.want, process(tt.msgs, testName)); diff != "" {
 				t.Fatalf("unexpected change set (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
+// testName is an interface name lookup function for tests.
+func testName(index int) (string, bool) {
+	switch index {
+	case 1:
+		return "test0", true
+	case 2:
+		return "test1", true
+	default:
+		return "", false
+	}
+}
+
 func newLink(op rtnetlink.OperationalState) rtnetlink.Message {
 	return &rtnetlink.LinkMessage{
 		Attributes: &rtnetlink.LinkAttributes{
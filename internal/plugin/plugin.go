@@ -14,11 +14,21 @@
 package plugin
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
 	"inet.af/netaddr"
 )
@@ -42,6 +52,12 @@ type Plugin interface {
 type DNSSL struct {
 	Lifetime    time.Duration
 	DomainNames []string
+
+	// MaxDomainNames, if non-zero, is the number of domain names which hosts
+	// are expected to accept. If Truncate is set, only the first
+	// MaxDomainNames domain names are advertised.
+	MaxDomainNames int
+	Truncate       bool
 }
 
 // Name implements Plugin.
@@ -50,7 +66,7 @@ func (d *DNSSL) Name() string { return "dnssl" }
 // String implements Plugin.
 func (d *DNSSL) String() string {
 	return fmt.Sprintf("domain names: [%s], lifetime: %s",
-		strings.Join(d.DomainNames, ", "), durString(d.Lifetime))
+		strings.Join(d.DomainNames, ", "), DurationString(d.Lifetime))
 }
 
 // Prepare implements Plugin.
@@ -58,9 +74,14 @@ func (*DNSSL) Prepare(_ *net.Interface) error { return nil }
 
 // Apply implements Plugin.
 func (d *DNSSL) Apply(ra *ndp.RouterAdvertisement) error {
+	names := d.DomainNames
+	if d.Truncate && d.MaxDomainNames > 0 && len(names) > d.MaxDomainNames {
+		names = names[:d.MaxDomainNames]
+	}
+
 	ra.Options = append(ra.Options, &ndp.DNSSearchList{
 		Lifetime:    d.Lifetime,
-		DomainNames: d.DomainNames,
+		DomainNames: names,
 	})
 
 	return nil
@@ -113,10 +134,355 @@ func (*MTU) Prepare(_ *net.Interface) error { return nil }
 
 // Apply implements Plugin.
 func (m *MTU) Apply(ra *ndp.RouterAdvertisement) error {
+	if *m == 0 {
+		// An MTU of 0 is unspecified, so omit the option entirely rather
+		// than advertising an invalid MTU.
+		return nil
+	}
+
 	ra.Options = append(ra.Options, ndp.NewMTU(uint32(*m)))
 	return nil
 }
 
+// minMTU is the minimum link MTU for IPv6, per
+// https://tools.ietf.org/html/rfc8200#section-5.
+const minMTU = 1280
+
+// A TunnelMTU configures a NDP MTU option derived from the network interface's
+// MTU, less a fixed Overhead for encapsulation. This is useful for tunnel
+// interfaces where the usable MTU is smaller than that of the underlying link.
+type TunnelMTU struct {
+	Overhead int
+
+	// MTU is computed from the network interface during Prepare.
+	MTU int
+
+	// OnClamp is an optional hook which fires when the MTU computed during
+	// Prepare is less than the IPv6 minimum, in which case the minimum is
+	// advertised instead.
+	OnClamp func(mtu int)
+}
+
+// Name implements Plugin.
+func (*TunnelMTU) Name() string { return "mtu" }
+
+// String implements Plugin.
+func (m *TunnelMTU) String() string {
+	if m.MTU == 0 {
+		return fmt.Sprintf("MTU: interface - %d", m.Overhead)
+	}
+
+	return fmt.Sprintf("MTU: %d (interface - %d)", m.MTU, m.Overhead)
+}
+
+// Prepare implements Plugin.
+func (m *TunnelMTU) Prepare(ifi *net.Interface) error {
+	// Re-read the interface MTU each time, as it may have changed since the
+	// last time the plugin was prepared.
+	mtu := ifi.MTU - m.Overhead
+	if mtu < minMTU {
+		// Never break IPv6 for hosts due to a transient bad interface MTU.
+		if m.OnClamp != nil {
+			m.OnClamp(mtu)
+		}
+		mtu = minMTU
+	}
+
+	m.MTU = mtu
+	return nil
+}
+
+// Apply implements Plugin.
+func (m *TunnelMTU) Apply(ra *ndp.RouterAdvertisement) error {
+	if m.MTU < minMTU {
+		return fmt.Errorf("plugin: tunnel MTU %d is less than the IPv6 minimum of %d", m.MTU, minMTU)
+	}
+
+	ra.Options = append(ra.Options, ndp.NewMTU(uint32(m.MTU)))
+	return nil
+}
+
+// SysctlDefaults configures router advertisement parameters using the values
+// of the kernel's own IPv6 stack for the network interface, such as sysctls
+// on Linux, so that advertised values remain consistent with the router. Only
+// the enabled parameters are configured.
+type SysctlDefaults struct {
+	HopLimit, MTU, ReachableTime, RetransmitTimer bool
+
+	// Parameters fetches the kernel's IPv6 parameters for an interface. If
+	// nil, Prepare sets Parameters to fetch them from the operating system.
+	Parameters func(iface string) (*system.IPv6Parameters, error)
+
+	// Values are fetched from the network interface during Prepare, and are
+	// nil if the operating system does not support fetching them.
+	Values *system.IPv6Parameters
+
+	// OnClamp is an optional hook which fires when the MTU fetched during
+	// Prepare is less than the IPv6 minimum, in which case the minimum is
+	// advertised instead.
+	OnClamp func(mtu int)
+}
+
+// Name implements Plugin.
+func (*SysctlDefaults) Name() string { return "sysctl_defaults" }
+
+// String implements Plugin.
+func (s *SysctlDefaults) String() string {
+	var ss []string
+	add := func(enabled bool, name string, value interface{}) {
+		if !enabled {
+			return
+		}
+
+		if s.Values == nil {
+			ss = append(ss, name)
+			return
+		}
+
+		ss = append(ss, fmt.Sprintf("%s: %v", name, value))
+	}
+
+	var v system.IPv6Parameters
+	if s.Values != nil {
+		v = *s.Values
+	}
+
+	add(s.HopLimit, "hop limit", v.HopLimit)
+	add(s.MTU, "MTU", v.MTU)
+	add(s.ReachableTime, "reachable time", v.ReachableTime)
+	add(s.RetransmitTimer, "retransmit timer", v.RetransmitTimer)
+
+	if s.Values == nil {
+		return fmt.Sprintf("unresolved: [%s]", strings.Join(ss, ", "))
+	}
+
+	return strings.Join(ss, ", ")
+}
+
+// Prepare implements Plugin.
+func (s *SysctlDefaults) Prepare(ifi *net.Interface) error {
+	if s.Parameters == nil {
+		s.Parameters = system.InterfaceIPv6Parameters
+	}
+
+	// Re-read the parameters each time, as they may have changed since the
+	// last time the plugin was prepared.
+	v, err := s.Parameters(ifi.Name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Not supported on this operating system, use the configured values.
+		s.Values = nil
+		return nil
+	case err != nil:
+		return fmt.Errorf("plugin: failed to fetch interface %q IPv6 parameters: %v", ifi.Name, err)
+	}
+
+	if s.HopLimit && (v.HopLimit < 0 || v.HopLimit > 255) {
+		return fmt.Errorf("plugin: interface %q hop limit %d is out of range", ifi.Name, v.HopLimit)
+	}
+	if s.MTU && v.MTU < minMTU {
+		// Never break IPv6 for hosts due to a transient bad interface MTU.
+		if s.OnClamp != nil {
+			s.OnClamp(v.MTU)
+		}
+
+		clamped := *v
+		clamped.MTU = minMTU
+		v = &clamped
+	}
+
+	s.Values = v
+	return nil
+}
+
+// Apply implements Plugin.
+func (s *SysctlDefaults) Apply(ra *ndp.RouterAdvertisement) error {
+	v := s.Values
+	if v == nil {
+		// Nothing to do.
+		return nil
+	}
+
+	if s.HopLimit {
+		ra.CurrentHopLimit = uint8(v.HopLimit)
+	}
+	if s.ReachableTime {
+		ra.ReachableTime = v.ReachableTime
+	}
+	if s.RetransmitTimer {
+		ra.RetransmitTimer = v.RetransmitTimer
+	}
+	if s.MTU {
+		ra.Options = append(ra.Options, ndp.NewMTU(uint32(v.MTU)))
+	}
+
+	return nil
+}
+
+// RemovePrefixes removes any prefix information options from ra, such as when
+// a router is withdrawn and hosts must not use its prefixes.
+func RemovePrefixes(ra *ndp.RouterAdvertisement) {
+	opts := ra.Options[:0]
+	for _, o := range ra.Options {
+		if _, _, ok := PrefixInformation(o); ok {
+			continue
+		}
+
+		opts = append(opts, o)
+	}
+
+	ra.Options = opts
+}
+
+// RemoveLLA removes any source link-layer address options from ra, such as for
+// unsolicited router advertisements when the source link-layer address should
+// only be sent to soliciting hosts.
+func RemoveLLA(ra *ndp.RouterAdvertisement) {
+	opts := ra.Options[:0]
+	for _, o := range ra.Options {
+		if lla, ok := o.(*ndp.LinkLayerAddress); ok && lla.Direction == ndp.Source {
+			continue
+		}
+
+		opts = append(opts, o)
+	}
+
+	ra.Options = opts
+}
+
+// NonceType is the NDP option type for a Nonce option, per
+// https://tools.ietf.org/html/rfc3971#section-5.3.2.
+const NonceType = 14
+
+// nonceLen is the minimum length of a nonce, which also fills an option
+// occupying 8 bytes on the wire.
+const nonceLen = 6
+
+// A Nonce configures an experimental NDP Nonce option, per RFC 3971. A new
+// random nonce is generated each time the plugin is applied.
+type Nonce struct {
+	// Reader optionally specifies a source of randomness. If nil, crypto/rand
+	// is used.
+	Reader io.Reader
+}
+
+// Name implements Plugin.
+func (*Nonce) Name() string { return "nonce" }
+
+// String implements Plugin.
+func (*Nonce) String() string { return "random nonce per advertisement" }
+
+// Prepare implements Plugin.
+func (*Nonce) Prepare(_ *net.Interface) error { return nil }
+
+// Apply implements Plugin.
+func (n *Nonce) Apply(ra *ndp.RouterAdvertisement) error {
+	r := n.Reader
+	if r == nil {
+		r = rand.Reader
+	}
+
+	b := make([]byte, nonceLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	ra.Options = append(ra.Options, NewNonceOption(b))
+	return nil
+}
+
+// NewNonceOption packs a nonce into a raw NDP Nonce option. The length of b
+// plus the 2 byte option header must be a multiple of 8 bytes, or
+// NewNonceOption will panic.
+func NewNonceOption(b []byte) *ndp.RawOption {
+	if (len(b)+2)%8 != 0 {
+		panicf("plugin: invalid nonce length: %d", len(b))
+	}
+
+	return &ndp.RawOption{
+		Type:   NonceType,
+		Length: uint8((len(b) + 2) / 8),
+		Value:  b,
+	}
+}
+
+// FindNonce returns the nonce from the first Nonce option in opts, if present.
+func FindNonce(opts []ndp.Option) ([]byte, bool) {
+	for _, o := range opts {
+		if ro, ok := o.(*ndp.RawOption); ok && ro.Type == NonceType {
+			return ro.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// ReplaceNonce replaces the contents of any Nonce options in ra with the input
+// nonce, so that a solicited router advertisement can echo the nonce from a
+// router solicitation. If ra has no Nonce options, ReplaceNonce is a no-op.
+func ReplaceNonce(ra *ndp.RouterAdvertisement, nonce []byte) {
+	for i, o := range ra.Options {
+		if ro, ok := o.(*ndp.RawOption); ok && ro.Type == NonceType {
+			ra.Options[i] = NewNonceOption(nonce)
+		}
+	}
+}
+
+// A ManagedPrefix sets the router advertisement's managed address
+// configuration (M) flag only while the interface has an address within
+// Prefix, and clears the flag otherwise. This is useful when DHCPv6 addressing
+// is only available while a certain prefix is present, such as during WAN
+// transitions.
+type ManagedPrefix struct {
+	Prefix netaddr.IPPrefix
+
+	// Functions which can be swapped for tests.
+	Addrs func() ([]net.Addr, error)
+}
+
+// Name implements Plugin.
+func (*ManagedPrefix) Name() string { return "managed_prefix" }
+
+// String implements Plugin.
+func (m *ManagedPrefix) String() string {
+	return fmt.Sprintf("managed flag while interface has address in %s", m.Prefix)
+}
+
+// Prepare implements Plugin.
+func (m *ManagedPrefix) Prepare(ifi *net.Interface) error {
+	// Fetch addresses from the specified interface whenever invoked.
+	m.Addrs = ifi.Addrs
+	return nil
+}
+
+// Apply implements Plugin.
+func (m *ManagedPrefix) Apply(ra *ndp.RouterAdvertisement) error {
+	addrs, err := m.Addrs()
+	if err != nil {
+		return fmt.Errorf("failed to fetch IP addresses: %v", err)
+	}
+
+	ra.ManagedConfiguration = false
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netaddr.FromStdIP(ipn.IP)
+		if !ok {
+			panicf("corerad: invalid net.IP: %+v", a)
+		}
+
+		if m.Prefix.Contains(ip) {
+			ra.ManagedConfiguration = true
+			break
+		}
+	}
+
+	return nil
+}
+
 // A Prefix configures a NDP Prefix Information option.
 type Prefix struct {
 	// Parameters from configuration.
@@ -126,14 +492,55 @@ type Prefix struct {
 	ValidLifetime     time.Duration
 	PreferredLifetime time.Duration
 
+	// Optional lifetimes for prefixes expanded from ::/N when every interface
+	// address within that prefix is a temporary address. If zero, the normal
+	// lifetimes are used. Detecting temporary addresses requires netlink,
+	// and is only supported on Linux.
+	TemporaryValidLifetime     time.Duration
+	TemporaryPreferredLifetime time.Duration
+
+	// MaxAddrsFailures is the number of consecutive failures to fetch
+	// interface addresses which will be tolerated while expanding ::/N, by
+	// reusing the addresses from the last successful fetch. If zero, any
+	// failure is returned immediately.
+	MaxAddrsFailures int
+
+	// OnAddrsFailure is an optional hook which fires when a failure to fetch
+	// interface addresses is tolerated due to MaxAddrsFailures.
+	OnAddrsFailure func(err error)
+
+	// ExcludePrefixes are prefixes which are never advertised when expanding
+	// ::/N, such as a management prefix. A prefix expanded from ::/N is
+	// excluded if it is contained within any of ExcludePrefixes.
+	ExcludePrefixes []netaddr.IPPrefix
+
+	// OnExclude is an optional hook which fires when a prefix expanded from
+	// ::/N is excluded due to ExcludePrefixes.
+	OnExclude func(prefix netaddr.IPPrefix)
+
 	// Whether or not this prefix will be treated as deprecated when the Prefix
 	// is applied, and the time used to calculate the expiration time.
 	Epoch      time.Time
 	Deprecated bool
 
+	// RouterAddress sets the router address (R) flag for Mobile IPv6 home
+	// agents, per RFC 6275, section 7.2. Rather than the prefix itself, the
+	// full address of this interface within the prefix is advertised, so the
+	// interface's addresses are used even for an exact prefix. The lowest
+	// stable address is chosen, as with LowestStableAddress.
+	RouterAddress bool
+
+	// VerifyEUI64 checks whether combining an autonomous prefix with the
+	// EUI-64 interface identifier of this interface would produce a usable
+	// address when the Prefix is prepared. This is advisory only: problems
+	// are reported to the optional OnVerifyEUI64 hook rather than returned.
+	VerifyEUI64   bool
+	OnVerifyEUI64 func(warning string)
+
 	// Functions which can be swapped for tests.
-	TimeNow func() time.Time
-	Addrs   func() ([]net.Addr, error)
+	TimeNow        func() time.Time
+	Addrs          func() ([]net.Addr, error)
+	TemporaryAddrs func() ([]netaddr.IP, error)
 }
 
 // Name implements Plugin.
@@ -154,30 +561,195 @@ func (p *Prefix) String() string {
 	if p.Autonomous {
 		flags = append(flags, "autonomous")
 	}
+	if p.RouterAddress {
+		flags = append(flags, "router address")
+	}
+	if p.VerifyEUI64 {
+		flags = append(flags, "verify EUI-64")
+	}
 
-	return fmt.Sprintf("%s [%s], preferred: %s, valid: %s",
+	s := fmt.Sprintf("%s [%s], preferred: %s, valid: %s",
 		p.Prefix,
 		strings.Join(flags, ", "),
-		durString(p.PreferredLifetime),
-		durString(p.ValidLifetime),
+		DurationString(p.PreferredLifetime),
+		DurationString(p.ValidLifetime),
 	)
+
+	if p.temporary() {
+		s += fmt.Sprintf(", temporary preferred: %s, temporary valid: %s",
+			DurationString(p.TemporaryPreferredLifetime),
+			DurationString(p.TemporaryValidLifetime),
+		)
+	}
+
+	if len(p.ExcludePrefixes) > 0 {
+		ss := make([]string, 0, len(p.ExcludePrefixes))
+		for _, e := range p.ExcludePrefixes {
+			ss = append(ss, e.String())
+		}
+
+		s += fmt.Sprintf(", exclude: [%s]", strings.Join(ss, ", "))
+	}
+
+	return s
 }
 
 // Prepare implements Plugin.
 func (p *Prefix) Prepare(ifi *net.Interface) error {
+	if err := CheckLifetimes(p.ValidLifetime, p.PreferredLifetime); err != nil {
+		return fmt.Errorf("invalid prefix %s: %v", p.Prefix, err)
+	}
+	if p.temporary() {
+		if err := CheckLifetimes(p.TemporaryValidLifetime, p.TemporaryPreferredLifetime); err != nil {
+			return fmt.Errorf("invalid prefix %s temporary lifetimes: %v", p.Prefix, err)
+		}
+	}
+
 	// Use the real system time.
 	p.TimeNow = time.Now
 
-	// Fetch addresses from the specified interface whenever invoked.
+	// Fetch addresses from the specified interface whenever invoked,
+	// optionally tolerating transient failures.
 	p.Addrs = ifi.Addrs
+	if p.MaxAddrsFailures > 0 {
+		p.Addrs = p.tolerantAddrs(ifi.Addrs)
+	}
+
+	if p.temporary() || p.RouterAddress {
+		// Temporary address detection is also necessary.
+		p.TemporaryAddrs = func() ([]netaddr.IP, error) {
+			return system.TemporaryAddresses(ifi)
+		}
+	}
+
+	if p.VerifyEUI64 && p.Autonomous {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return fmt.Errorf("failed to fetch IP addresses to verify prefix %s: %v", p.Prefix, err)
+		}
+
+		for _, w := range p.verifyEUI64(ifi.HardwareAddr, addrs) {
+			if p.OnVerifyEUI64 != nil {
+				p.OnVerifyEUI64(w)
+			}
+		}
+	}
+
 	return nil
 }
 
+// verifyEUI64 reports any reasons why combining the prefixes advertised by p
+// with the EUI-64 interface identifier formed from mac would not produce a
+// usable address, given the interface's existing addresses.
+func (p *Prefix) verifyEUI64(mac net.HardwareAddr, addrs []net.Addr) []string {
+	if p.Prefix.Bits != 64 {
+		return []string{fmt.Sprintf(
+			"prefix %s cannot be combined with a 64-bit EUI-64 interface identifier", p.Prefix)}
+	}
+
+	id, ok := eui64(mac)
+	if !ok {
+		return []string{fmt.Sprintf(
+			"hardware address %q cannot form an EUI-64 interface identifier for prefix %s", mac, p.Prefix)}
+	}
+
+	// Only consider global IPv6 addresses.
+	var ipps []netaddr.IPPrefix
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ipp, ok := netaddr.FromStdIPNet(ipn)
+		if !ok || ipp.IP.Is4() || ipp.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		ipps = append(ipps, ipp)
+	}
+
+	// An exact prefix is verified directly, while ::/64 is verified for each
+	// of the prefixes it will expand to.
+	var prefixes []netaddr.IPPrefix
+	if p.Prefix.IP != netaddr.IPv6Unspecified() {
+		prefixes = []netaddr.IPPrefix{p.Prefix}
+	} else {
+		seen := make(map[netaddr.IPPrefix]bool)
+		for _, ipp := range ipps {
+			if ipp.Bits != p.Prefix.Bits {
+				continue
+			}
+
+			pfx, err := ipp.IP.Prefix(ipp.Bits)
+			if err != nil {
+				panicf("corerad: failed to produce prefix: %v", err)
+			}
+
+			if !seen[pfx] && !p.excluded(pfx) {
+				seen[pfx] = true
+				prefixes = append(prefixes, pfx)
+			}
+		}
+	}
+
+	var warnings []string
+	for _, pfx := range prefixes {
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, pfx.IP.IPAddr().IP.To16()[:8])
+		copy(ip[8:], id[:])
+
+		addr, ok := netaddr.FromStdIP(ip)
+		if !ok {
+			panicf("corerad: invalid EUI-64 address: %s", ip)
+		}
+
+		// Addresses with the same prefix length are assigned as usual, but a
+		// manually configured address with another length makes the subnet
+		// ambiguous and may already occupy the EUI-64 address.
+		for _, ipp := range ipps {
+			switch {
+			case ipp.Bits == pfx.Bits:
+				continue
+			case ipp.IP == addr:
+				warnings = append(warnings, fmt.Sprintf(
+					"EUI-64 address %s in prefix %s is already configured as %s", addr, pfx, ipp))
+			case ipp.Contains(pfx.IP) || pfx.Contains(ipp.IP):
+				warnings = append(warnings, fmt.Sprintf(
+					"prefix %s overlaps interface address %s which has a different prefix length", pfx, ipp))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// eui64 produces a modified EUI-64 interface identifier from a 48-bit MAC or
+// EUI-64 address, per RFC 4291, appendix A.
+func eui64(mac net.HardwareAddr) ([8]byte, bool) {
+	var id [8]byte
+	switch len(mac) {
+	case 6:
+		copy(id[:3], mac[:3])
+		id[3], id[4] = 0xff, 0xfe
+		copy(id[5:], mac[3:])
+	case 8:
+		copy(id[:], mac)
+	default:
+		return id, false
+	}
+
+	// Invert the universal/local bit.
+	id[0] ^= 0x02
+	return id, true
+}
+
 // Apply implements Plugin.
 func (p *Prefix) Apply(ra *ndp.RouterAdvertisement) error {
-	if p.Prefix.IP != netaddr.IPv6Unspecified() {
+	wildcard := p.Prefix.IP == netaddr.IPv6Unspecified()
+	if !wildcard && !p.RouterAddress {
 		// User specified an exact prefix so apply it directly.
-		p.applyPrefixes([]netaddr.IP{p.Prefix.IP}, ra)
+		p.applyPrefixes([]netaddr.IP{p.Prefix.IP}, nil, ra)
 		return nil
 	}
 
@@ -188,8 +760,28 @@ func (p *Prefix) Apply(ra *ndp.RouterAdvertisement) error {
 		return fmt.Errorf("failed to fetch IP addresses: %v", err)
 	}
 
+	// If configured, note which addresses are temporary so their prefixes
+	// can use different lifetimes, and so they are not advertised as router
+	// addresses.
+	tempAddrs := make(map[netaddr.IP]struct{})
+	if p.temporary() || p.RouterAddress {
+		ips, err := p.TemporaryAddrs()
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !p.temporary():
+			// Temporary addresses cannot be detected on this platform, so
+			// all router addresses are considered stable.
+		case err != nil:
+			return fmt.Errorf("failed to fetch temporary IP addresses: %v", err)
+		}
+
+		for _, ip := range ips {
+			tempAddrs[ip] = struct{}{}
+		}
+	}
+
 	var prefixes []netaddr.IP
-	seen := make(map[netaddr.IPPrefix]struct{})
+	seen := make(map[netaddr.IPPrefix]int)
+	temporary := make(map[netaddr.IP]bool)
 	for _, a := range addrs {
 		ipn, ok := a.(*net.IPNet)
 		if !ok {
@@ -208,47 +800,206 @@ func (p *Prefix) Apply(ra *ndp.RouterAdvertisement) error {
 			continue
 		}
 
+		// An exact prefix only considers the addresses it contains.
+		if !wildcard && !p.Prefix.Contains(ipp.IP) {
+			continue
+		}
+
 		// Found a match, mask and keep the prefix bits of the address.
 		pfx, err := ipp.IP.Prefix(ipp.Bits)
 		if err != nil {
 			panicf("corerad: failed to produce prefix: %v", err)
 		}
 
-		// Only add each prefix once.
-		if _, ok := seen[pfx]; ok {
+		// A prefix is only considered temporary if all of its addresses
+		// are temporary.
+		_, isTemp := tempAddrs[ipp.IP]
+		if v, ok := temporary[pfx.IP]; ok {
+			temporary[pfx.IP] = v && isTemp
+		} else {
+			temporary[pfx.IP] = isTemp
+		}
+
+		if p.RouterAddress && isTemp {
+			// A temporary address is not a stable router address.
+			continue
+		}
+
+		// Only add each prefix once. A router address is the lowest stable
+		// address within its prefix, so that it does not depend on the order
+		// in which the interface's addresses are reported.
+		if i, ok := seen[pfx]; ok {
+			if p.RouterAddress && i >= 0 {
+				prefixes[i] = lowestIP([]netaddr.IP{prefixes[i], ipp.IP})
+			}
+			continue
+		}
+
+		if p.excluded(pfx) {
+			seen[pfx] = -1
+			if p.OnExclude != nil {
+				p.OnExclude(pfx)
+			}
+			continue
+		}
+		seen[pfx] = len(prefixes)
+
+		if p.RouterAddress {
+			// Advertise the full address in place of the prefix.
+			prefixes = append(prefixes, ipp.IP)
 			continue
 		}
-		seen[pfx] = struct{}{}
 
 		prefixes = append(prefixes, pfx.IP)
 	}
 
 	// Produce a PrefixInformation option for each configured prefix.
-	// All prefixes expanded from ::/N have the same configuration.
-	p.applyPrefixes(prefixes, ra)
+	// All prefixes expanded from ::/N have the same configuration, aside from
+	// the lifetimes of prefixes associated with temporary addresses.
+	p.applyPrefixes(prefixes, temporary, ra)
 	return nil
 }
 
-// applyPrefixes unpacks prefixes into ndp.PrefixInformation options within ra.
-func (p *Prefix) applyPrefixes(prefixes []netaddr.IP, ra *ndp.RouterAdvertisement) {
-	// Pre-allocate space for prefixes since we know how many are needed.
-	opts := make([]ndp.Option, 0, len(prefixes))
-	for _, pfx := range prefixes {
-		valid, pref := p.lifetimes()
+// tolerantAddrs wraps addrs so that up to p.MaxAddrsFailures consecutive
+// failures will return the addresses from the last successful call, or no
+// addresses if no call has succeeded yet.
+func (p *Prefix) tolerantAddrs(addrs func() ([]net.Addr, error)) func() ([]net.Addr, error) {
+	var (
+		mu       sync.Mutex
+		last     []net.Addr
+		failures int
+	)
 
-		opts = append(opts, &ndp.PrefixInformation{
-			PrefixLength:                   p.Prefix.Bits,
-			OnLink:                         p.OnLink,
-			AutonomousAddressConfiguration: p.Autonomous,
+	return func() ([]net.Addr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		as, err := addrs()
+		if err == nil {
+			last, failures = as, 0
+			return as, nil
+		}
+
+		failures++
+		if failures > p.MaxAddrsFailures {
+			return nil, fmt.Errorf("exceeded %d consecutive failures: %v", p.MaxAddrsFailures, err)
+		}
+
+		if p.OnAddrsFailure != nil {
+			p.OnAddrsFailure(err)
+		}
+
+		return last, nil
+	}
+}
+
+// applyPrefixes unpacks prefixes into ndp.PrefixInformation options within ra.
+// Any prefixes set to true in temporary use the temporary lifetimes.
+func (p *Prefix) applyPrefixes(prefixes []netaddr.IP, temporary map[netaddr.IP]bool, ra *ndp.RouterAdvertisement) {
+	// Pre-allocate space for prefixes since we know how many are needed.
+	opts := make([]ndp.Option, 0, len(prefixes))
+	for _, pfx := range prefixes {
+		valid, pref := p.lifetimes()
+		if p.temporary() && temporary[pfx] && !p.Deprecated {
+			valid, pref = p.TemporaryValidLifetime, p.TemporaryPreferredLifetime
+		}
+
+		pi := &ndp.PrefixInformation{
+			PrefixLength:                   p.Prefix.Bits,
+			OnLink:                         p.OnLink,
+			AutonomousAddressConfiguration: p.Autonomous,
 			ValidLifetime:                  valid,
 			PreferredLifetime:              pref,
 			Prefix:                         pfx.IPAddr().IP,
-		})
+		}
+
+		if p.RouterAddress {
+			opts = append(opts, RouterAddressOption(pi))
+			continue
+		}
+
+		opts = append(opts, pi)
 	}
 
 	ra.Options = append(ra.Options, opts...)
 }
 
+// prefixInformationType is the NDP option type for Prefix Information.
+const prefixInformationType = 3
+
+// RouterAddressOption packs pi into a raw Prefix Information option with the
+// router address (R) flag set, since package ndp does not support the flag.
+// See: https://tools.ietf.org/html/rfc6275#section-7.2.
+func RouterAddressOption(pi *ndp.PrefixInformation) *ndp.RawOption {
+	b := make([]byte, 30)
+	b[0] = pi.PrefixLength
+
+	// L, A, and R flags, followed by reserved bits.
+	b[1] = 0x20
+	if pi.OnLink {
+		b[1] |= 0x80
+	}
+	if pi.AutonomousAddressConfiguration {
+		b[1] |= 0x40
+	}
+
+	binary.BigEndian.PutUint32(b[2:6], uint32(pi.ValidLifetime/time.Second))
+	binary.BigEndian.PutUint32(b[6:10], uint32(pi.PreferredLifetime/time.Second))
+
+	// 4 reserved bytes, and the full router address.
+	copy(b[14:30], pi.Prefix.To16())
+
+	return &ndp.RawOption{
+		Type:   prefixInformationType,
+		Length: 4,
+		Value:  b,
+	}
+}
+
+// PrefixInformation returns the Prefix Information option carried by o, if
+// any. Prefixes with the router address flag set are packed as raw options by
+// RouterAddressOption, so callers which inspect prefixes should use
+// PrefixInformation rather than matching on *ndp.PrefixInformation, and
+// routerAddress reports whether the flag is set.
+func PrefixInformation(o ndp.Option) (pi *ndp.PrefixInformation, routerAddress, ok bool) {
+	switch o := o.(type) {
+	case *ndp.PrefixInformation:
+		return o, false, true
+	case *ndp.RawOption:
+		if o.Type != prefixInformationType || len(o.Value) != 30 {
+			return nil, false, false
+		}
+
+		b := o.Value
+		return &ndp.PrefixInformation{
+			PrefixLength:                   b[0],
+			OnLink:                         b[1]&0x80 != 0,
+			AutonomousAddressConfiguration: b[1]&0x40 != 0,
+			ValidLifetime:                  time.Duration(binary.BigEndian.Uint32(b[2:6])) * time.Second,
+			PreferredLifetime:              time.Duration(binary.BigEndian.Uint32(b[6:10])) * time.Second,
+			Prefix:                         net.IP(append([]byte(nil), b[14:30]...)),
+		}, b[1]&0x20 != 0, true
+	default:
+		return nil, false, false
+	}
+}
+
+// excluded reports whether pfx is contained within any of p.ExcludePrefixes.
+func (p *Prefix) excluded(pfx netaddr.IPPrefix) bool {
+	for _, e := range p.ExcludePrefixes {
+		if e.Bits <= pfx.Bits && e.Contains(pfx.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// temporary reports whether temporary address lifetimes are configured.
+func (p *Prefix) temporary() bool {
+	return p.TemporaryValidLifetime != 0 && p.TemporaryPreferredLifetime != 0
+}
+
 // lifetimes calculates a Prefix's lifetimes as either fixed values or dynamic
 // ones when a Prefix is deprecated.
 func (p *Prefix) lifetimes() (valid, pref time.Duration) {
@@ -279,10 +1030,363 @@ func (p *Prefix) lifetimes() (valid, pref time.Duration) {
 		pref = prefT.Sub(now)
 	}
 
+	// Lifetimes which count down from different epochs, such as when a
+	// Renumber plan clamps them to its window, must still never advertise a
+	// preferred lifetime which exceeds the valid lifetime.
+	if pref > valid {
+		pref = valid
+	}
+
 	return valid, pref
 }
 
-// A Route configures a NDP Route Information option.
+// CheckLifetimes verifies that the preferred lifetime of a prefix does not
+// exceed its valid lifetime, per RFC 4861, section 4.6.2. An infinite
+// preferred lifetime requires an infinite valid lifetime.
+func CheckLifetimes(valid, preferred time.Duration) error {
+	switch {
+	case preferred == ndp.Infinity && valid != ndp.Infinity:
+		return fmt.Errorf("infinite preferred lifetime requires an infinite valid lifetime, but valid lifetime is %s",
+			DurationString(valid))
+	case valid != ndp.Infinity && preferred > valid:
+		return fmt.Errorf("preferred lifetime of %s exceeds valid lifetime of %s",
+			DurationString(preferred), DurationString(valid))
+	}
+
+	return nil
+}
+
+// CheckAutonomous verifies that an autonomous prefix has a /64 length. Per RFC
+// 4862, section 5.5.3, hosts ignore an autonomous prefix unless its length plus
+// the length of their interface identifiers is 128 bits, and interface
+// identifiers are 64 bits per RFC 4291, section 2.5.1. Prefixes which are only
+// on-link may have any length.
+func CheckAutonomous(prefix netaddr.IPPrefix, autonomous bool) error {
+	if autonomous && prefix.Bits != 64 {
+		return fmt.Errorf("autonomous prefix %s must have a /64 length for hosts to use SLAAC", prefix)
+	}
+
+	return nil
+}
+
+// A DelegatedPrefix configures NDP Prefix Information options for prefixes
+// derived from the global prefixes of an upstream Interface, such as a prefix
+// delegated to a WAN interface using DHCPv6-PD.
+//
+// The Subnet'th sub-prefix with the length of Prefix is carved from each
+// upstream prefix. When an upstream prefix is no longer available, its derived
+// prefix is advertised with zero lifetimes until its valid lifetime would have
+// elapsed, per RFC 7084, section 4.3, L-13.
+type DelegatedPrefix struct {
+	// Prefix is a ::/N template which specifies the length, flags, and
+	// lifetimes of derived prefixes.
+	Prefix    *Prefix
+	Interface string
+	Subnet    int
+
+	// Addrs can be swapped for tests.
+	Addrs func() ([]net.Addr, error)
+
+	// mu guards derived, the prefixes which have been derived from the
+	// upstream Interface and when they were last seen.
+	mu      sync.Mutex
+	derived []derivedPrefix
+}
+
+// A derivedPrefix is a prefix derived by a DelegatedPrefix.
+type derivedPrefix struct {
+	IP       netaddr.IP
+	LastSeen time.Time
+}
+
+// Name implements Plugin.
+func (*DelegatedPrefix) Name() string { return "delegated_prefix" }
+
+// String implements Plugin.
+func (d *DelegatedPrefix) String() string {
+	return fmt.Sprintf("%s, interface: %s, subnet: %d", d.Prefix, d.Interface, d.Subnet)
+}
+
+// Prepare implements Plugin.
+func (d *DelegatedPrefix) Prepare(_ *net.Interface) error {
+	// Use the real system time.
+	d.Prefix.TimeNow = time.Now
+
+	// The upstream interface may not exist yet or may come and go, as is
+	// common with PPP interfaces, so look it up whenever invoked and treat a
+	// missing interface as one with no addresses.
+	d.Addrs = func() ([]net.Addr, error) {
+		ifi, err := net.InterfaceByName(d.Interface)
+		if err != nil {
+			return nil, nil
+		}
+
+		return ifi.Addrs()
+	}
+
+	return nil
+}
+
+// Apply implements Plugin.
+func (d *DelegatedPrefix) Apply(ra *ndp.RouterAdvertisement) error {
+	addrs, err := d.Addrs()
+	if err != nil {
+		return fmt.Errorf("failed to fetch IP addresses for interface %q: %v", d.Interface, err)
+	}
+
+	var prefixes []netaddr.IP
+	seen := make(map[netaddr.IP]struct{})
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ipp, ok := netaddr.FromStdIPNet(ipn)
+		if !ok {
+			panicf("corerad: invalid net.IPNet: %+v", a)
+		}
+
+		// Only derive prefixes from non-link-local IPv6 prefixes which are
+		// large enough to contain a prefix of the configured length.
+		if ipp.IP.Is4() || ipp.IP.IsLinkLocalUnicast() || ipp.Bits > d.Prefix.Prefix.Bits {
+			continue
+		}
+
+		pfx, err := ipp.IP.Prefix(ipp.Bits)
+		if err != nil {
+			panicf("corerad: failed to produce prefix: %v", err)
+		}
+
+		ip, ok := subnet(pfx, d.Prefix.Prefix.Bits, d.Subnet)
+		if !ok {
+			// The upstream prefix is too small for this subnet.
+			continue
+		}
+
+		// Only add each prefix once.
+		if _, ok := seen[ip]; ok {
+			continue
+		}
+		seen[ip] = struct{}{}
+
+		prefixes = append(prefixes, ip)
+	}
+
+	d.Prefix.applyPrefixes(prefixes, nil, ra)
+
+	// Immediately deprecate and invalidate any prefixes derived from upstream
+	// prefixes which are no longer available.
+	for _, ip := range d.withdrawn(prefixes, seen) {
+		ra.Options = append(ra.Options, &ndp.PrefixInformation{
+			PrefixLength:                   d.Prefix.Prefix.Bits,
+			OnLink:                         d.Prefix.OnLink,
+			AutonomousAddressConfiguration: d.Prefix.Autonomous,
+			Prefix:                         ip.IPAddr().IP,
+		})
+	}
+
+	return nil
+}
+
+// withdrawn records the currently derived prefixes and returns any previously
+// derived prefixes which must be withdrawn.
+func (d *DelegatedPrefix) withdrawn(prefixes []netaddr.IP, current map[netaddr.IP]struct{}) []netaddr.IP {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.Prefix.TimeNow()
+
+	var (
+		keep []derivedPrefix
+		out  []netaddr.IP
+	)
+
+	for _, dp := range d.derived {
+		if _, ok := current[dp.IP]; ok {
+			// Still available, its time will be updated below.
+			continue
+		}
+
+		// Stop advertising a withdrawn prefix once hosts would have
+		// invalidated it anyway.
+		if now.Sub(dp.LastSeen) >= d.Prefix.ValidLifetime {
+			continue
+		}
+
+		keep = append(keep, dp)
+		out = append(out, dp.IP)
+	}
+
+	for _, ip := range prefixes {
+		keep = append(keep, derivedPrefix{IP: ip, LastSeen: now})
+	}
+
+	d.derived = keep
+	return out
+}
+
+// subnet carves the n'th sub-prefix with the specified length from pfx,
+// reporting false if pfx cannot contain it.
+func subnet(pfx netaddr.IPPrefix, bits uint8, n int) (netaddr.IP, bool) {
+	free := int(bits) - int(pfx.Bits)
+	if n < 0 || free < 0 || (free < 63 && n >= 1<<uint(free)) {
+		return netaddr.IP{}, false
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, pfx.IP.IPAddr().IP.To16())
+
+	// Set the bits of n immediately before the end of the sub-prefix.
+	for i := 0; i < free && n>>uint(i) != 0; i++ {
+		if n&(1<<uint(i)) == 0 {
+			continue
+		}
+
+		bit := int(bits) - 1 - i
+		ip[bit/8] |= 1 << uint(7-bit%8)
+	}
+
+	out, ok := netaddr.FromStdIP(ip)
+	if !ok {
+		panicf("corerad: invalid IP address: %s", ip)
+	}
+
+	return out, true
+}
+
+// A Renumber configures a renumbering plan which gracefully transitions hosts
+// from an Old prefix to a New prefix over a scheduled window, per RFC 4192.
+//
+// Before Start, only Old is advertised. Once Start is reached, New is
+// advertised and Old is treated as deprecated, so its lifetimes decrease until
+// it is no longer preferred and then no longer valid by the end of Window.
+// After the window, Old continues to be advertised with zero lifetimes.
+type Renumber struct {
+	Old, New *Prefix
+	Start    time.Time
+	Window   time.Duration
+
+	// TimeNow can be swapped for tests.
+	TimeNow func() time.Time
+}
+
+// A RenumberPhase indicates the progress of a Renumber plan.
+type RenumberPhase int
+
+// Possible RenumberPhase values.
+const (
+	RenumberPending RenumberPhase = iota
+	RenumberActive
+	RenumberComplete
+)
+
+// String returns the string representation of a RenumberPhase.
+func (p RenumberPhase) String() string {
+	switch p {
+	case RenumberPending:
+		return "pending"
+	case RenumberActive:
+		return "renumbering"
+	case RenumberComplete:
+		return "complete"
+	default:
+		return fmt.Sprintf("RenumberPhase(%d)", int(p))
+	}
+}
+
+// Name implements Plugin.
+func (*Renumber) Name() string { return "renumber" }
+
+// String implements Plugin.
+func (r *Renumber) String() string {
+	return fmt.Sprintf("%s -> %s, start: %s, window: %s, phase: %s",
+		r.Old.Prefix, r.New.Prefix, r.Start.Format(time.RFC3339),
+		DurationString(r.Window), r.Phase())
+}
+
+// Prepare implements Plugin.
+func (r *Renumber) Prepare(ifi *net.Interface) error {
+	// Use the real system time.
+	r.TimeNow = time.Now
+
+	if err := r.Old.Prepare(ifi); err != nil {
+		return err
+	}
+
+	return r.New.Prepare(ifi)
+}
+
+// Apply implements Plugin.
+func (r *Renumber) Apply(ra *ndp.RouterAdvertisement) error {
+	if r.Phase() == RenumberPending {
+		return r.Old.Apply(ra)
+	}
+
+	if err := r.New.Apply(ra); err != nil {
+		return err
+	}
+
+	// Deprecate a copy of the old prefix as of the start of the window, so
+	// its lifetimes reach zero no later than the end of the window.
+	old := *r.Old
+	old.Deprecated = true
+	old.Epoch = r.Start
+	old.TimeNow = r.now
+
+	if old.ValidLifetime > r.Window {
+		old.ValidLifetime = r.Window
+	}
+	if old.PreferredLifetime > r.Window {
+		old.PreferredLifetime = r.Window
+	}
+
+	return old.Apply(ra)
+}
+
+// End returns the time at which the renumbering window ends.
+func (r *Renumber) End() time.Time { return r.Start.Add(r.Window) }
+
+// Phase returns the current RenumberPhase of the plan.
+func (r *Renumber) Phase() RenumberPhase {
+	now := r.now()
+	switch {
+	case now.Before(r.Start):
+		return RenumberPending
+	case now.Before(r.End()):
+		return RenumberActive
+	default:
+		return RenumberComplete
+	}
+}
+
+// Progress returns the fraction of the renumbering window which has elapsed,
+// between 0 and 1.
+func (r *Renumber) Progress() float64 {
+	switch r.Phase() {
+	case RenumberPending:
+		return 0
+	case RenumberComplete:
+		return 1
+	}
+
+	return float64(r.now().Sub(r.Start)) / float64(r.Window)
+}
+
+// now returns the current time, using the real system time if r has not been
+// prepared.
+func (r *Renumber) now() time.Time {
+	if r.TimeNow == nil {
+		return time.Now()
+	}
+
+	return r.TimeNow()
+}
+
+// A Route configures a NDP Route Information option. A Route for ::/0
+// advertises a default route (RFC 4191, section 3.1) which, for hosts that
+// support Route Information options, overrides the router lifetime and default
+// router preference of the router advertisement.
 type Route struct {
 	Prefix     netaddr.IPPrefix
 	Preference ndp.Preference
@@ -297,7 +1401,7 @@ func (r *Route) String() string {
 	return fmt.Sprintf("%s, preference: %s, lifetime: %s",
 		r.Prefix,
 		r.Preference.String(),
-		durString(r.Lifetime),
+		DurationString(r.Lifetime),
 	)
 }
 
@@ -316,10 +1420,298 @@ func (r *Route) Apply(ra *ndp.RouterAdvertisement) error {
 	return nil
 }
 
+// KernelRoutes configures NDP Route Information options for the routes in the
+// system's IPv6 routing tables which match a filter, so that routes installed
+// by other software, such as a routing daemon, are redistributed to hosts. The
+// routing tables are read whenever a router advertisement is built.
+//
+// When a previously advertised route is no longer present, it is advertised
+// with a zero lifetime until its Lifetime would have elapsed, so that hosts
+// promptly stop using it.
+type KernelRoutes struct {
+	// Table, Protocol, and Metric filter routes by routing table, routing
+	// protocol, and metric. A zero Protocol or Metric matches any route. If
+	// set, Interface filters routes by output interface.
+	Table     uint32
+	Protocol  uint8
+	Metric    uint32
+	Interface string
+
+	Preference ndp.Preference
+	Lifetime   time.Duration
+
+	// Interval specifies how often the routing tables should be checked for
+	// changes which must be advertised promptly.
+	Interval time.Duration
+
+	// Routes and TimeNow can be swapped for tests.
+	Routes  func() ([]system.Route, error)
+	TimeNow func() time.Time
+
+	// mu guards the remaining fields. self is the advertising interface,
+	// learned holds the routes which have been advertised and when they were
+	// last seen, and checked holds the routes found by the last Update.
+	mu      sync.Mutex
+	self    string
+	learned []learnedRoute
+	checked map[netaddr.IPPrefix]struct{}
+}
+
+// A learnedRoute is a route advertised by a KernelRoutes.
+type learnedRoute struct {
+	Prefix   netaddr.IPPrefix
+	LastSeen time.Time
+}
+
+// Name implements Plugin.
+func (*KernelRoutes) Name() string { return "kernel_routes" }
+
+// String implements Plugin.
+func (k *KernelRoutes) String() string {
+	filter := []string{fmt.Sprintf("table: %d", k.Table)}
+	if k.Protocol != 0 {
+		filter = append(filter, fmt.Sprintf("protocol: %d", k.Protocol))
+	}
+	if k.Metric != 0 {
+		filter = append(filter, fmt.Sprintf("metric: %d", k.Metric))
+	}
+	if k.Interface != "" {
+		filter = append(filter, fmt.Sprintf("interface: %s", k.Interface))
+	}
+
+	return fmt.Sprintf("%s, preference: %s, lifetime: %s, check every %s",
+		strings.Join(filter, ", "),
+		k.Preference.String(),
+		DurationString(k.Lifetime),
+		k.Interval,
+	)
+}
+
+// Prepare implements Plugin.
+func (k *KernelRoutes) Prepare(ifi *net.Interface) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Routes via the advertising interface lead to hosts on the same link,
+	// so they are never advertised.
+	k.self = ifi.Name
+
+	if k.Routes == nil {
+		k.Routes = system.Routes
+	}
+	if k.TimeNow == nil {
+		k.TimeNow = time.Now
+	}
+
+	return nil
+}
+
+// Apply implements Plugin.
+func (k *KernelRoutes) Apply(ra *ndp.RouterAdvertisement) error {
+	prefixes, err := k.match()
+	if err != nil {
+		return err
+	}
+
+	option := func(pfx netaddr.IPPrefix, lifetime time.Duration) *ndp.RouteInformation {
+		return &ndp.RouteInformation{
+			PrefixLength:  pfx.Bits,
+			Preference:    k.Preference,
+			RouteLifetime: lifetime,
+			Prefix:        pfx.IP.IPAddr().IP,
+		}
+	}
+
+	for _, pfx := range prefixes {
+		ra.Options = append(ra.Options, option(pfx, k.Lifetime))
+	}
+
+	// Immediately invalidate any routes which are no longer present.
+	for _, pfx := range k.withdrawn(prefixes) {
+		ra.Options = append(ra.Options, option(pfx, 0))
+	}
+
+	return nil
+}
+
+// Update checks the routing tables, reporting whether or not the matching
+// routes have changed since the previous Update. The first Update only
+// records the matching routes.
+func (k *KernelRoutes) Update() (bool, error) {
+	prefixes, err := k.match()
+	if err != nil {
+		return false, err
+	}
+
+	current := make(map[netaddr.IPPrefix]struct{}, len(prefixes))
+	for _, pfx := range prefixes {
+		current[pfx] = struct{}{}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var changed bool
+	if k.checked != nil {
+		changed = len(current) != len(k.checked)
+		for pfx := range current {
+			if _, ok := k.checked[pfx]; !ok {
+				changed = true
+			}
+		}
+	}
+
+	k.checked = current
+	return changed, nil
+}
+
+// match returns the prefixes of the routes which match the filter, in routing
+// table order.
+func (k *KernelRoutes) match() ([]netaddr.IPPrefix, error) {
+	routes, err := k.Routes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch routes: %v", err)
+	}
+
+	k.mu.Lock()
+	self := k.self
+	k.mu.Unlock()
+
+	var prefixes []netaddr.IPPrefix
+	seen := make(map[netaddr.IPPrefix]struct{})
+	for _, r := range routes {
+		if r.Table != k.Table ||
+			(k.Protocol != 0 && r.Protocol != k.Protocol) ||
+			(k.Metric != 0 && r.Metric != k.Metric) ||
+			(k.Interface != "" && r.Interface != k.Interface) ||
+			(self != "" && r.Interface == self) {
+			continue
+		}
+
+		// Link-local and multicast routes are never useful to hosts.
+		if r.Prefix.IP.IsLinkLocalUnicast() || r.Prefix.IP.IsMulticast() {
+			continue
+		}
+
+		// Only add each prefix once, as a destination may have multiple
+		// routes which match.
+		if _, ok := seen[r.Prefix]; ok {
+			continue
+		}
+		seen[r.Prefix] = struct{}{}
+
+		prefixes = append(prefixes, r.Prefix)
+	}
+
+	return prefixes, nil
+}
+
+// withdrawn records the currently matching routes and returns any previously
+// advertised routes which must be withdrawn.
+func (k *KernelRoutes) withdrawn(prefixes []netaddr.IPPrefix) []netaddr.IPPrefix {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.TimeNow()
+
+	current := make(map[netaddr.IPPrefix]struct{}, len(prefixes))
+	for _, pfx := range prefixes {
+		current[pfx] = struct{}{}
+	}
+
+	var (
+		keep []learnedRoute
+		out  []netaddr.IPPrefix
+	)
+
+	for _, lr := range k.learned {
+		if _, ok := current[lr.Prefix]; ok {
+			// Still present, its time will be updated below.
+			continue
+		}
+
+		// Stop advertising a withdrawn route once hosts would have
+		// invalidated it anyway.
+		if now.Sub(lr.LastSeen) >= k.Lifetime {
+			continue
+		}
+
+		keep = append(keep, lr)
+		out = append(out, lr.Prefix)
+	}
+
+	for _, pfx := range prefixes {
+		keep = append(keep, learnedRoute{Prefix: pfx, LastSeen: now})
+	}
+
+	k.learned = keep
+	return out
+}
+
 // RDNSS configures a NDP Recursive DNS Servers option.
 type RDNSS struct {
+	// Lifetime is the time Servers may be used for name resolution. A zero
+	// Lifetime advertises Servers so that hosts stop using them.
 	Lifetime time.Duration
 	Servers  []netaddr.IP
+
+	// MaxServers, if non-zero, is the number of servers which hosts are
+	// expected to accept. If Truncate is set, only the first MaxServers
+	// servers are advertised.
+	MaxServers int
+	Truncate   bool
+
+	// Interface specifies that the global addresses of this interface are
+	// also advertised as servers, ahead of Servers, for a router which runs
+	// its own resolver. The addresses are fetched whenever the plugin is
+	// applied, and link-local and temporary addresses are skipped. If no
+	// servers remain, the option is omitted and OnEmpty is invoked with true,
+	// and later with false once servers are available again.
+	Interface bool
+	OnEmpty   func(empty bool)
+
+	// InterfaceAddresses selects which of the interface's stable addresses
+	// are advertised when Interface is set.
+	InterfaceAddresses AddressPreference
+
+	// Functions which can be swapped for tests.
+	Addrs          func() ([]net.Addr, error)
+	TemporaryAddrs func() ([]netaddr.IP, error)
+
+	mu    sync.Mutex
+	empty bool
+}
+
+// An AddressPreference selects which of an interface's own stable global
+// addresses are advertised. Temporary addresses, such as RFC 4941 privacy
+// addresses, are never advertised: they change over time, and hosts would
+// stop reaching the router at an address once it expires. If temporary
+// addresses cannot be detected on this platform, all global addresses are
+// considered stable.
+type AddressPreference int
+
+// Possible AddressPreference values.
+const (
+	// StableAddresses advertises all stable addresses, in the order they
+	// are reported by the operating system.
+	StableAddresses AddressPreference = iota
+
+	// LowestStableAddress advertises only the numerically lowest stable
+	// address, so that the advertised address is chosen deterministically
+	// and does not change as other addresses are added and removed.
+	LowestStableAddress
+)
+
+// String returns the string representation of an AddressPreference.
+func (p AddressPreference) String() string {
+	switch p {
+	case StableAddresses:
+		return "stable"
+	case LowestStableAddress:
+		return "lowest_stable"
+	default:
+		return fmt.Sprintf("AddressPreference(%d)", int(p))
+	}
 }
 
 // Name implements Plugin.
@@ -327,22 +1719,59 @@ func (r *RDNSS) Name() string { return "rdnss" }
 
 // String implements Plugin.
 func (r *RDNSS) String() string {
-	ips := make([]string, 0, len(r.Servers))
+	ips := make([]string, 0, len(r.Servers)+1)
+	if r.Interface {
+		ips = append(ips, "interface")
+	}
 	for _, s := range r.Servers {
 		ips = append(ips, s.String())
 	}
 
+	if r.Interface && r.InterfaceAddresses != StableAddresses {
+		return fmt.Sprintf("servers: [%s], interface addresses: %s, lifetime: %s",
+			strings.Join(ips, ", "), r.InterfaceAddresses, DurationString(r.Lifetime))
+	}
+
 	return fmt.Sprintf("servers: [%s], lifetime: %s",
-		strings.Join(ips, ", "), durString(r.Lifetime))
+		strings.Join(ips, ", "), DurationString(r.Lifetime))
 }
 
 // Prepare implements Plugin.
-func (*RDNSS) Prepare(_ *net.Interface) error { return nil }
+func (r *RDNSS) Prepare(ifi *net.Interface) error {
+	if !r.Interface {
+		return nil
+	}
+
+	r.Addrs = ifi.Addrs
+	r.TemporaryAddrs = func() ([]netaddr.IP, error) {
+		return system.TemporaryAddresses(ifi)
+	}
+
+	return nil
+}
 
 // Apply implements Plugin.
 func (r *RDNSS) Apply(ra *ndp.RouterAdvertisement) error {
-	ips := make([]net.IP, 0, len(r.Servers))
-	for _, s := range r.Servers {
+	servers := r.Servers
+	if r.Interface {
+		ips, err := r.interfaceServers()
+		if err != nil {
+			return err
+		}
+
+		servers = append(ips, servers...)
+		r.setEmpty(len(servers) == 0)
+		if len(servers) == 0 {
+			return nil
+		}
+	}
+
+	if r.Truncate && r.MaxServers > 0 && len(servers) > r.MaxServers {
+		servers = servers[:r.MaxServers]
+	}
+
+	ips := make([]net.IP, 0, len(servers))
+	for _, s := range servers {
 		ips = append(ips, s.IPAddr().IP)
 	}
 
@@ -354,9 +1783,467 @@ func (r *RDNSS) Apply(ra *ndp.RouterAdvertisement) error {
 	return nil
 }
 
-// durString converts a time.Duration into a string while also recognizing
-// certain CoreRAD sentinel values.
-func durString(d time.Duration) string {
+// interfaceServers fetches the global, non-temporary IPv6 addresses of the
+// interface.
+func (r *RDNSS) interfaceServers() ([]netaddr.IP, error) {
+	addrs, err := r.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch IP addresses: %v", err)
+	}
+
+	temp := make(map[netaddr.IP]struct{})
+	tips, err := r.TemporaryAddrs()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Temporary addresses cannot be detected on this platform.
+	case err != nil:
+		return nil, fmt.Errorf("failed to fetch temporary IP addresses: %v", err)
+	}
+	for _, ip := range tips {
+		temp[ip] = struct{}{}
+	}
+
+	var ips []netaddr.IP
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netaddr.FromStdIP(ipn.IP)
+		if !ok || ip.Is4() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		if _, ok := temp[ip]; ok {
+			continue
+		}
+
+		ips = append(ips, ip)
+	}
+
+	if r.InterfaceAddresses == LowestStableAddress && len(ips) > 1 {
+		ips = []netaddr.IP{lowestIP(ips)}
+	}
+
+	return ips, nil
+}
+
+// lowestIP returns the numerically lowest of the non-empty ips.
+func lowestIP(ips []netaddr.IP) netaddr.IP {
+	lowest := ips[0]
+	for _, ip := range ips[1:] {
+		if bytes.Compare(ip.IPAddr().IP.To16(), lowest.IPAddr().IP.To16()) < 0 {
+			lowest = ip
+		}
+	}
+
+	return lowest
+}
+
+// setEmpty records whether the interface has no servers to advertise,
+// invoking OnEmpty when that changes.
+func (r *RDNSS) setEmpty(empty bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if empty == r.empty {
+		return
+	}
+	r.empty = empty
+
+	if r.OnEmpty != nil {
+		r.OnEmpty(empty)
+	}
+}
+
+// An Upstream configures health checking of a router's upstream connectivity.
+// While the upstream is unhealthy, router advertisements are sent with a
+// router lifetime of zero so that hosts will prefer other default routers,
+// but all other information such as prefixes continues to be advertised.
+type Upstream struct {
+	// Interval specifies how often the upstream should be checked.
+	Interval time.Duration
+
+	// Hysteresis specifies how many consecutive checks must disagree with
+	// the current state before the upstream health state changes.
+	Hysteresis int
+
+	// Check reports whether upstream connectivity is available. If nil,
+	// Prepare sets Check to detect an IPv6 default route.
+	Check func() (bool, error)
+
+	mu        sync.Mutex
+	unhealthy bool
+	streak    int
+}
+
+// Name implements Plugin.
+func (*Upstream) Name() string { return "upstream" }
+
+// String implements Plugin.
+func (u *Upstream) String() string {
+	return fmt.Sprintf("default route check every %s, hysteresis: %d, healthy: %t",
+		u.Interval, u.Hysteresis, u.Healthy())
+}
+
+// Prepare implements Plugin.
+func (u *Upstream) Prepare(_ *net.Interface) error {
+	if u.Check == nil {
+		u.Check = system.HasDefaultRoute
+	}
+
+	return nil
+}
+
+// Apply implements Plugin.
+func (u *Upstream) Apply(ra *ndp.RouterAdvertisement) error {
+	if !u.Healthy() {
+		// No longer a default router, but continue to advertise all other
+		// parameters.
+		ra.RouterLifetime = 0
+	}
+
+	return nil
+}
+
+// Healthy reports whether the upstream is currently considered healthy.
+// Upstreams are assumed to be healthy until checked.
+func (u *Upstream) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return !u.unhealthy
+}
+
+// Update checks the upstream and updates the health state, reporting whether
+// or not the state has changed. The state only changes once Hysteresis
+// consecutive checks disagree with the current state. Check errors are treated
+// as failures, and are also returned to the caller.
+func (u *Upstream) Update() (bool, error) {
+	ok, err := u.Check()
+	if err != nil {
+		ok = false
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if ok != u.unhealthy {
+		// This check agrees with the current state.
+		u.streak = 0
+		return false, err
+	}
+
+	u.streak++
+	if u.streak < u.Hysteresis {
+		return false, err
+	}
+
+	u.unhealthy = !ok
+	u.streak = 0
+	return true, err
+}
+
+// A VRRP configures a VRRP-aware primary and backup mode. While this router is
+// the VRRP backup, router advertisements are sent with a router lifetime of
+// zero so that only the VRRP master is advertised as a default router, but all
+// other information such as prefixes continues to be advertised.
+type VRRP struct {
+	// Interval specifies how often the VRRP state should be checked.
+	Interval time.Duration
+
+	// Hysteresis specifies how many consecutive checks must disagree with
+	// the current role before the role changes.
+	Hysteresis int
+
+	// Address is the VRRP virtual IP address. If set, this router is the
+	// master while Address is assigned to the network interface.
+	Address netaddr.IP
+
+	// StateFile is a file containing the VRRP state, such as one written by a
+	// keepalived notify script. If set, this router is the master while the
+	// file contains "MASTER".
+	StateFile string
+
+	// Check reports whether this router is the VRRP master. If nil, Prepare
+	// sets Check to use Address or StateFile.
+	Check func() (bool, error)
+
+	mu      sync.Mutex
+	checked bool
+	master  bool
+	streak  int
+}
+
+// Name implements Plugin.
+func (*VRRP) Name() string { return "vrrp" }
+
+// String implements Plugin.
+func (v *VRRP) String() string {
+	source := fmt.Sprintf("state file %s", v.StateFile)
+	if v.StateFile == "" {
+		source = fmt.Sprintf("virtual IP %s", v.Address)
+	}
+
+	return fmt.Sprintf("%s check every %s, hysteresis: %d, role: %s",
+		source, v.Interval, v.Hysteresis, v.Role())
+}
+
+// Prepare implements Plugin.
+func (v *VRRP) Prepare(ifi *net.Interface) error {
+	if v.Check != nil {
+		return nil
+	}
+
+	if v.StateFile != "" {
+		v.Check = func() (bool, error) { return vrrpStateMaster(v.StateFile) }
+		return nil
+	}
+
+	// Look up the interface by name on each check so the check continues to
+	// work if the interface is recreated.
+	name := ifi.Name
+	v.Check = func() (bool, error) { return hasAddress(name, v.Address) }
+	return nil
+}
+
+// Apply implements Plugin.
+func (v *VRRP) Apply(ra *ndp.RouterAdvertisement) error {
+	if !v.Master() {
+		// The VRRP master is the default router, but continue to advertise
+		// all other parameters.
+		ra.RouterLifetime = 0
+	}
+
+	return nil
+}
+
+// Master reports whether this router is currently the VRRP master. Routers are
+// assumed to be the backup until checked.
+func (v *VRRP) Master() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.master
+}
+
+// Role returns the current VRRP role as a string, either "master" or "backup".
+func (v *VRRP) Role() string {
+	if v.Master() {
+		return "master"
+	}
+
+	return "backup"
+}
+
+// Update checks the VRRP state and updates the role, reporting whether or not
+// the role has changed. The first check determines the initial role, and
+// afterward the role only changes once Hysteresis consecutive checks disagree
+// with the current role. Check errors are treated as the backup role, and are
+// also returned to the caller.
+func (v *VRRP) Update() (bool, error) {
+	master, err := v.Check()
+	if err != nil {
+		master = false
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.checked {
+		v.checked = true
+		v.master = master
+		return master, err
+	}
+
+	if master == v.master {
+		// This check agrees with the current role.
+		v.streak = 0
+		return false, err
+	}
+
+	v.streak++
+	if v.streak < v.Hysteresis {
+		return false, err
+	}
+
+	v.master = master
+	v.streak = 0
+	return true, err
+}
+
+// vrrpStateMaster reports whether the VRRP state file at path indicates that
+// this router is the master.
+func vrrpStateMaster(path string) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(strings.TrimSpace(string(b)), "MASTER"), nil
+}
+
+// hasAddress reports whether the network interface name has ip assigned.
+func hasAddress(name string, ip netaddr.IP) (bool, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return false, err
+	}
+
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return false, err
+	}
+
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		if aip, ok := netaddr.FromStdIP(n.IP); ok && aip == ip {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CaptivePortalType is the NDP option type for a Captive-Portal option, per
+// https://tools.ietf.org/html/rfc8910#section-2.3.
+const CaptivePortalType = 37
+
+// A CaptivePortal configures a NDP Captive-Portal option, per RFC 8910.
+//
+// RFC 7710 specified that the option carries the URL of the captive portal's
+// user-facing web page. RFC 8910 obsoletes that behavior: the option now
+// carries the URL of the captive portal API (RFC 8908), which clients query
+// for JSON describing the portal's state and the location of the user-facing
+// web page.
+type CaptivePortal struct {
+	// API is the URL of the captive portal API.
+	API string
+
+	// Strict requires that API is an HTTPS URL. Some clients require HTTPS
+	// and will ignore a plaintext captive portal API.
+	Strict bool
+}
+
+// Name implements Plugin.
+func (*CaptivePortal) Name() string { return "captive_portal" }
+
+// String implements Plugin.
+func (c *CaptivePortal) String() string {
+	if c.Strict {
+		return fmt.Sprintf("API: %s (strict)", c.API)
+	}
+
+	return fmt.Sprintf("API: %s", c.API)
+}
+
+// Prepare implements Plugin.
+func (c *CaptivePortal) Prepare(_ *net.Interface) error {
+	u, err := url.Parse(c.API)
+	if err != nil {
+		return fmt.Errorf("invalid captive portal API URL: %v", err)
+	}
+
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("captive portal API URL %q must use HTTP or HTTPS", c.API)
+	case u.Host == "":
+		return fmt.Errorf("captive portal API URL %q must specify a host", c.API)
+	case c.Strict && u.Scheme != "https":
+		return fmt.Errorf("captive portal API URL %q must use HTTPS in strict mode", c.API)
+	}
+
+	return nil
+}
+
+// Apply implements Plugin.
+func (c *CaptivePortal) Apply(ra *ndp.RouterAdvertisement) error {
+	o, err := NewCaptivePortalOption(c.API)
+	if err != nil {
+		return err
+	}
+
+	ra.Options = append(ra.Options, o)
+	return nil
+}
+
+// NewCaptivePortalOption packs uri into a raw NDP Captive-Portal option.
+func NewCaptivePortalOption(uri string) (*ndp.RawOption, error) {
+	// The URI is padded with NUL bytes so the option fills a multiple of
+	// 8 bytes, including the 2 byte option header.
+	l := (len(uri) + 2 + 7) / 8
+	if l > 255 {
+		return nil, fmt.Errorf("captive portal API URL is too long: %d bytes", len(uri))
+	}
+
+	b := make([]byte, l*8-2)
+	copy(b, uri)
+
+	return &ndp.RawOption{
+		Type:   CaptivePortalType,
+		Length: uint8(l),
+		Value:  b,
+	}, nil
+}
+
+// A Raw configures an arbitrary NDP option which is not otherwise modeled by
+// CoreRAD, such as a new or vendor-specific option. The option is advertised
+// as-is, and its contents are not validated.
+type Raw struct {
+	Type  uint8
+	Value []byte
+}
+
+// Name implements Plugin.
+func (*Raw) Name() string { return "raw_option" }
+
+// String implements Plugin.
+func (r *Raw) String() string {
+	return fmt.Sprintf("type: %d, length: %d bytes", r.Type, len(r.Value)+2)
+}
+
+// Prepare implements Plugin.
+func (*Raw) Prepare(_ *net.Interface) error { return nil }
+
+// Apply implements Plugin.
+func (r *Raw) Apply(ra *ndp.RouterAdvertisement) error {
+	o, err := NewRawOption(r.Type, r.Value)
+	if err != nil {
+		return err
+	}
+
+	ra.Options = append(ra.Options, o)
+	return nil
+}
+
+// NewRawOption packs b into a raw NDP option of type typ. b must fill a
+// multiple of 8 bytes, including the 2 byte option header.
+func NewRawOption(typ uint8, b []byte) (*ndp.RawOption, error) {
+	l := len(b) + 2
+	switch {
+	case typ == 0:
+		return nil, errors.New("plugin: raw option type must not be 0")
+	case l%8 != 0:
+		return nil, fmt.Errorf("plugin: raw option value of %d bytes plus the 2 byte option header must be a multiple of 8 bytes", len(b))
+	case l/8 > 255:
+		return nil, fmt.Errorf("plugin: raw option value is too long: %d bytes", len(b))
+	}
+
+	return &ndp.RawOption{
+		Type:   typ,
+		Length: uint8(l / 8),
+		Value:  b,
+	}, nil
+}
+
+// DurationString converts a time.Duration into a human-readable string while
+// also recognizing certain CoreRAD sentinel values, such as "infinite".
+func DurationString(d time.Duration) string {
 	switch d {
 	case ndp.Infinity:
 		return "infinite"
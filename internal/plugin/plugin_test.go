@@ -14,12 +14,18 @@
 package plugin
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/corerad/internal/crtest"
+	"github.com/mdlayher/corerad/internal/system"
 	"github.com/mdlayher/ndp"
 	"inet.af/netaddr"
 )
@@ -48,6 +54,110 @@ func TestPluginString(t *testing.T) {
 			p:    NewMTU(1500),
 			s:    "MTU: 1500",
 		},
+		{
+			name: "TunnelMTU",
+			p:    &TunnelMTU{Overhead: 80, MTU: 1420},
+			s:    "MTU: 1420 (interface - 80)",
+		},
+		{
+			name: "SysctlDefaults unresolved",
+			p:    &SysctlDefaults{HopLimit: true, MTU: true},
+			s:    "unresolved: [hop limit, MTU]",
+		},
+		{
+			name: "SysctlDefaults",
+			p: &SysctlDefaults{
+				HopLimit:      true,
+				ReachableTime: true,
+				Values: &system.IPv6Parameters{
+					HopLimit:      64,
+					MTU:           1500,
+					ReachableTime: 30 * time.Second,
+				},
+			},
+			s: "hop limit: 64, reachable time: 30s",
+		},
+		{
+			name: "Upstream",
+			p:    &Upstream{Interval: 5 * time.Second, Hysteresis: 3},
+			s:    "default route check every 5s, hysteresis: 3, healthy: true",
+		},
+		{
+			name: "Renumber",
+			p: &Renumber{
+				Old:    &Prefix{Prefix: crtest.MustIPPrefix("2001:db8:1::/64")},
+				New:    &Prefix{Prefix: crtest.MustIPPrefix("2001:db8:2::/64")},
+				Start:  time.Unix(0, 0).UTC(),
+				Window: 12 * time.Hour,
+				// Renumbering completed in the past.
+				TimeNow: func() time.Time { return time.Unix(86400, 0) },
+			},
+			s: "2001:db8:1::/64 -> 2001:db8:2::/64, start: 1970-01-01T00:00:00Z, window: 12h0m0s, phase: complete",
+		},
+		{
+			name: "DelegatedPrefix",
+			p: &DelegatedPrefix{
+				Prefix: &Prefix{
+					Prefix:            crtest.MustIPPrefix("::/64"),
+					OnLink:            true,
+					Autonomous:        true,
+					PreferredLifetime: 4 * time.Hour,
+					ValidLifetime:     24 * time.Hour,
+				},
+				Interface: "eth0",
+				Subnet:    1,
+			},
+			s: "::/64 [on-link, autonomous], preferred: 4h0m0s, valid: 24h0m0s, interface: eth0, subnet: 1",
+		},
+		{
+			name: "Prefix router address",
+			p: &Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				OnLink:            true,
+				RouterAddress:     true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+			},
+			s: "2001:db8::/64 [on-link, router address], preferred: 4h0m0s, valid: 24h0m0s",
+		},
+		{
+			name: "VRRP address",
+			p: &VRRP{
+				Interval:   time.Second,
+				Hysteresis: 2,
+				Address:    crtest.MustIP("fe80::1"),
+			},
+			s: "virtual IP fe80::1 check every 1s, hysteresis: 2, role: backup",
+		},
+		{
+			name: "VRRP state file",
+			p: &VRRP{
+				Interval:   time.Second,
+				Hysteresis: 2,
+				StateFile:  "/run/vrrp",
+			},
+			s: "state file /run/vrrp check every 1s, hysteresis: 2, role: backup",
+		},
+		{
+			name: "ManagedPrefix",
+			p:    &ManagedPrefix{Prefix: crtest.MustIPPrefix("2001:db8::/48")},
+			s:    "managed flag while interface has address in 2001:db8::/48",
+		},
+		{
+			name: "CaptivePortal",
+			p:    &CaptivePortal{API: "https://example.com/api", Strict: true},
+			s:    "API: https://example.com/api (strict)",
+		},
+		{
+			name: "Nonce",
+			p:    &Nonce{},
+			s:    "random nonce per advertisement",
+		},
+		{
+			name: "Raw",
+			p:    &Raw{Type: 253, Value: make([]byte, 6)},
+			s:    "type: 253, length: 8 bytes",
+		},
 		{
 			name: "Prefix",
 			p: &Prefix{
@@ -60,6 +170,32 @@ func TestPluginString(t *testing.T) {
 			},
 			s: "::/64 [DEPRECATED, on-link, autonomous], preferred: 15m0s, valid: infinite",
 		},
+		{
+			name: "Prefix temporary",
+			p: &Prefix{
+				Prefix:                     crtest.MustIPPrefix("::/64"),
+				OnLink:                     true,
+				PreferredLifetime:          4 * time.Hour,
+				ValidLifetime:              24 * time.Hour,
+				TemporaryPreferredLifetime: 30 * time.Minute,
+				TemporaryValidLifetime:     1 * time.Hour,
+			},
+			s: "::/64 [on-link], preferred: 4h0m0s, valid: 24h0m0s, temporary preferred: 30m0s, temporary valid: 1h0m0s",
+		},
+		{
+			name: "Prefix exclude",
+			p: &Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				PreferredLifetime: 4 * time.Hour,
+				ValidLifetime:     24 * time.Hour,
+				ExcludePrefixes: []netaddr.IPPrefix{
+					crtest.MustIPPrefix("2001:db8:ffff::/48"),
+					crtest.MustIPPrefix("fd00::/64"),
+				},
+			},
+			s: "::/64 [on-link], preferred: 4h0m0s, valid: 24h0m0s, exclude: [2001:db8:ffff::/48, fd00::/64]",
+		},
 		{
 			name: "Route",
 			p: &Route{
@@ -69,6 +205,18 @@ func TestPluginString(t *testing.T) {
 			},
 			s: "2001:db8::/64, preference: High, lifetime: 15m0s",
 		},
+		{
+			name: "KernelRoutes",
+			p: &KernelRoutes{
+				Table:      254,
+				Protocol:   12,
+				Interface:  "wg0",
+				Preference: ndp.Medium,
+				Lifetime:   30 * time.Minute,
+				Interval:   10 * time.Second,
+			},
+			s: "table: 254, protocol: 12, interface: wg0, preference: Medium, lifetime: 30m0s, check every 10s",
+		},
 		{
 			name: "RDNSS",
 			p: &RDNSS{
@@ -80,6 +228,24 @@ func TestPluginString(t *testing.T) {
 			},
 			s: "servers: [2001:db8::1, 2001:db8::2], lifetime: 30s",
 		},
+		{
+			name: "RDNSS interface",
+			p: &RDNSS{
+				Lifetime:  30 * time.Second,
+				Servers:   []netaddr.IP{crtest.MustIP("2001:db8::1")},
+				Interface: true,
+			},
+			s: "servers: [interface, 2001:db8::1], lifetime: 30s",
+		},
+		{
+			name: "RDNSS interface lowest stable address",
+			p: &RDNSS{
+				Lifetime:           30 * time.Second,
+				Interface:          true,
+				InterfaceAddresses: LowestStableAddress,
+			},
+			s: "servers: [interface], interface addresses: lowest_stable, lifetime: 30s",
+		},
 	}
 
 	for _, tt := range tests {
@@ -119,6 +285,48 @@ func TestBuild(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "DNSSL max domain names",
+			plugin: &DNSSL{
+				Lifetime: 10 * time.Second,
+				DomainNames: []string{
+					"foo.example.com",
+					"bar.example.com",
+				},
+				MaxDomainNames: 1,
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.DNSSearchList{
+						Lifetime: 10 * time.Second,
+						DomainNames: []string{
+							"foo.example.com",
+							"bar.example.com",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "DNSSL truncate",
+			plugin: &DNSSL{
+				Lifetime: 10 * time.Second,
+				DomainNames: []string{
+					"foo.example.com",
+					"bar.example.com",
+				},
+				MaxDomainNames: 1,
+				Truncate:       true,
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.DNSSearchList{
+						Lifetime:    10 * time.Second,
+						DomainNames: []string{"foo.example.com"},
+					},
+				},
+			},
+		},
 		{
 			name:   "LLA",
 			plugin: &LLA{},
@@ -142,181 +350,472 @@ func TestBuild(t *testing.T) {
 			},
 		},
 		{
-			name: "static prefix",
-			plugin: &Prefix{
-				Prefix:            crtest.MustIPPrefix("2001:db8::/32"),
-				OnLink:            true,
-				PreferredLifetime: 10 * time.Second,
-				ValidLifetime:     20 * time.Second,
+			name:   "MTU unspecified",
+			plugin: NewMTU(0),
+			ra:     &ndp.RouterAdvertisement{},
+		},
+		{
+			name: "SysctlDefaults",
+			plugin: &SysctlDefaults{
+				HopLimit:        true,
+				MTU:             true,
+				ReachableTime:   true,
+				RetransmitTimer: true,
+				Parameters: func(_ string) (*system.IPv6Parameters, error) {
+					return &system.IPv6Parameters{
+						HopLimit:        64,
+						MTU:             1500,
+						ReachableTime:   30 * time.Second,
+						RetransmitTimer: 1 * time.Second,
+					}, nil
+				},
+			},
+			ifi: &net.Interface{Name: "eth0"},
+			ra: &ndp.RouterAdvertisement{
+				CurrentHopLimit: 64,
+				ReachableTime:   30 * time.Second,
+				RetransmitTimer: 1 * time.Second,
+				Options:         []ndp.Option{ndp.NewMTU(1500)},
+			},
+		},
+		{
+			name: "SysctlDefaults not supported",
+			plugin: &SysctlDefaults{
+				HopLimit: true,
+				Parameters: func(_ string) (*system.IPv6Parameters, error) {
+					return nil, os.ErrNotExist
+				},
+			},
+			ifi: &net.Interface{Name: "eth0"},
+			ra:  &ndp.RouterAdvertisement{},
+		},
+		{
+			name:   "TunnelMTU",
+			plugin: &TunnelMTU{Overhead: 80},
+			ifi:    &net.Interface{MTU: 1500},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{ndp.NewMTU(1420)},
+			},
+		},
+		{
+			name:   "TunnelMTU clamped",
+			plugin: &TunnelMTU{Overhead: 80},
+			ifi:    &net.Interface{MTU: 1300},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{ndp.NewMTU(1280)},
+			},
+		},
+		{
+			name: "Nonce",
+			plugin: &Nonce{
+				Reader: bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}),
 			},
 			ra: &ndp.RouterAdvertisement{
 				Options: []ndp.Option{
-					&ndp.PrefixInformation{
-						PrefixLength:      32,
-						OnLink:            true,
-						PreferredLifetime: 10 * time.Second,
-						ValidLifetime:     20 * time.Second,
-						Prefix:            mustIP("2001:db8::"),
+					&ndp.RawOption{
+						Type:   NonceType,
+						Length: 1,
+						Value:  []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06},
 					},
 				},
 			},
 		},
 		{
-			name: "automatic prefixes /64",
+			name:   "CaptivePortal",
+			plugin: &CaptivePortal{API: "https://x.io/"},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RawOption{
+						Type:   CaptivePortalType,
+						Length: 2,
+						Value: []byte{
+							'h', 't', 't', 'p', 's', ':', '/', '/',
+							'x', '.', 'i', 'o', '/', 0x00,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:   "Raw",
+			plugin: &Raw{Type: 253, Value: []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RawOption{
+						Type:   253,
+						Length: 1,
+						Value:  []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+					},
+				},
+			},
+		},
+		{
+			name: "router address",
 			plugin: &Prefix{
-				Prefix:            crtest.MustIPPrefix("::/64"),
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
 				OnLink:            true,
 				Autonomous:        true,
+				RouterAddress:     true,
 				PreferredLifetime: 10 * time.Second,
 				ValidLifetime:     20 * time.Second,
 
 				Addrs: func() ([]net.Addr, error) {
 					return []net.Addr{
-						// Populate some addresses that should be ignored.
-						mustCIDR("192.0.2.1/24"),
-						&net.TCPAddr{},
-						mustCIDR("fe80::1/64"),
-						mustCIDR("fdff::1/32"),
-						mustCIDR("2001:db8::1/64"),
-						mustCIDR("2001:db8::2/64"),
-						mustCIDR("fd00::1/64"),
+						mustAddr("fe80::1/64"),
+						// Another prefix, and the lowest stable address in
+						// the matching prefix is used.
+						mustAddr("2001:db8:1::1/64"),
+						mustAddr("2001:db8::3/64"),
+						mustAddr("2001:db8::2/64"),
+						// Temporary.
+						mustAddr("2001:db8::1/64"),
 					}, nil
 				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) {
+					return []netaddr.IP{crtest.MustIP("2001:db8::1")}, nil
+				},
 			},
 			ra: &ndp.RouterAdvertisement{
 				Options: []ndp.Option{
-					&ndp.PrefixInformation{
-						PrefixLength:                   64,
-						OnLink:                         true,
-						AutonomousAddressConfiguration: true,
-						PreferredLifetime:              10 * time.Second,
-						ValidLifetime:                  20 * time.Second,
-						Prefix:                         mustIP("2001:db8::"),
-					},
-					&ndp.PrefixInformation{
+					RouterAddressOption(&ndp.PrefixInformation{
 						PrefixLength:                   64,
 						OnLink:                         true,
 						AutonomousAddressConfiguration: true,
 						PreferredLifetime:              10 * time.Second,
 						ValidLifetime:                  20 * time.Second,
-						Prefix:                         mustIP("fd00::"),
-					},
+						Prefix:                         mustIP("2001:db8::2"),
+					}),
 				},
 			},
 		},
 		{
-			name: "automatic prefixes /32",
+			name: "router address no temporary address detection",
 			plugin: &Prefix{
-				Prefix: crtest.MustIPPrefix("::/32"),
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				OnLink:            true,
+				RouterAddress:     true,
+				PreferredLifetime: 10 * time.Second,
+				ValidLifetime:     20 * time.Second,
+
 				Addrs: func() ([]net.Addr, error) {
 					return []net.Addr{
-						// Specify an IPv4 address that could feasibly be
-						// matched, but must be skipped due to incorrect address
-						// family.
-						mustCIDR("192.0.2.1/32"),
-						mustCIDR("2001:db8::1/32"),
+						mustAddr("2001:db8::2/64"),
+						mustAddr("2001:db8::1/64"),
 					}, nil
 				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) {
+					return nil, os.ErrNotExist
+				},
 			},
 			ra: &ndp.RouterAdvertisement{
 				Options: []ndp.Option{
-					&ndp.PrefixInformation{
-						PrefixLength: 32,
-						Prefix:       mustIP("2001:db8::"),
-					},
+					RouterAddressOption(&ndp.PrefixInformation{
+						PrefixLength:      64,
+						OnLink:            true,
+						PreferredLifetime: 10 * time.Second,
+						ValidLifetime:     20 * time.Second,
+						Prefix:            mustIP("2001:db8::1"),
+					}),
 				},
 			},
 		},
 		{
-			name: "deprecated preferred and valid",
+			name: "off-link autonomous prefix",
 			plugin: &Prefix{
 				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
 				Autonomous:        true,
-				OnLink:            true,
 				PreferredLifetime: 10 * time.Second,
 				ValidLifetime:     20 * time.Second,
-
-				Deprecated: true,
-				Epoch:      time.Unix(1, 0),
-				TimeNow:    func() time.Time { return time.Unix(5, 0) },
 			},
 			ra: &ndp.RouterAdvertisement{
 				Options: []ndp.Option{
 					&ndp.PrefixInformation{
 						PrefixLength:                   64,
 						AutonomousAddressConfiguration: true,
-						OnLink:                         true,
-						PreferredLifetime:              6 * time.Second,
-						ValidLifetime:                  16 * time.Second,
+						PreferredLifetime:              10 * time.Second,
+						ValidLifetime:                  20 * time.Second,
 						Prefix:                         mustIP("2001:db8::"),
 					},
 				},
 			},
 		},
 		{
-			name: "deprecated valid",
+			name: "static prefix",
 			plugin: &Prefix{
-				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
-				Autonomous:        true,
+				Prefix:            crtest.MustIPPrefix("2001:db8::/32"),
 				OnLink:            true,
 				PreferredLifetime: 10 * time.Second,
 				ValidLifetime:     20 * time.Second,
-
-				Deprecated: true,
-				Epoch:      time.Unix(1, 0),
-				TimeNow:    func() time.Time { return time.Unix(11, 0) },
 			},
 			ra: &ndp.RouterAdvertisement{
 				Options: []ndp.Option{
 					&ndp.PrefixInformation{
-						PrefixLength:                   64,
-						AutonomousAddressConfiguration: true,
-						OnLink:                         true,
-						PreferredLifetime:              0 * time.Second,
-						ValidLifetime:                  10 * time.Second,
-						Prefix:                         mustIP("2001:db8::"),
+						PrefixLength:      32,
+						OnLink:            true,
+						PreferredLifetime: 10 * time.Second,
+						ValidLifetime:     20 * time.Second,
+						Prefix:            mustIP("2001:db8::"),
 					},
 				},
 			},
 		},
 		{
-			name: "deprecated invalid",
+			name: "automatic prefixes temporary",
 			plugin: &Prefix{
-				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
-				Autonomous:        true,
-				OnLink:            true,
-				PreferredLifetime: 10 * time.Second,
-				ValidLifetime:     20 * time.Second,
+				Prefix:                     crtest.MustIPPrefix("::/64"),
+				OnLink:                     true,
+				PreferredLifetime:          4 * time.Hour,
+				ValidLifetime:              24 * time.Hour,
+				TemporaryPreferredLifetime: 30 * time.Minute,
+				TemporaryValidLifetime:     1 * time.Hour,
 
-				Deprecated: true,
-				Epoch:      time.Unix(1, 0),
-				TimeNow:    func() time.Time { return time.Unix(21, 0) },
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{
+						// Stable only.
+						mustAddr("2001:db8::1/64"),
+						// Temporary only.
+						mustAddr("2001:db8:1::1/64"),
+						mustAddr("2001:db8:1::2/64"),
+						// Mixed, treated as stable.
+						mustAddr("2001:db8:2::1/64"),
+						mustAddr("2001:db8:2::2/64"),
+					}, nil
+				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) {
+					return []netaddr.IP{
+						crtest.MustIP("2001:db8:1::1"),
+						crtest.MustIP("2001:db8:1::2"),
+						crtest.MustIP("2001:db8:2::2"),
+					}, nil
+				},
 			},
 			ra: &ndp.RouterAdvertisement{
 				Options: []ndp.Option{
 					&ndp.PrefixInformation{
-						PrefixLength:                   64,
-						AutonomousAddressConfiguration: true,
-						OnLink:                         true,
-						PreferredLifetime:              0 * time.Second,
-						ValidLifetime:                  0 * time.Second,
-						Prefix:                         mustIP("2001:db8::"),
+						PrefixLength:      64,
+						OnLink:            true,
+						PreferredLifetime: 4 * time.Hour,
+						ValidLifetime:     24 * time.Hour,
+						Prefix:            mustIP("2001:db8::"),
+					},
+					&ndp.PrefixInformation{
+						PrefixLength:      64,
+						OnLink:            true,
+						PreferredLifetime: 30 * time.Minute,
+						ValidLifetime:     1 * time.Hour,
+						Prefix:            mustIP("2001:db8:1::"),
+					},
+					&ndp.PrefixInformation{
+						PrefixLength:      64,
+						OnLink:            true,
+						PreferredLifetime: 4 * time.Hour,
+						ValidLifetime:     24 * time.Hour,
+						Prefix:            mustIP("2001:db8:2::"),
 					},
 				},
 			},
 		},
 		{
-			name: "route",
-			plugin: &Route{
-				Prefix:     crtest.MustIPPrefix("2001:db8::/32"),
-				Preference: ndp.High,
-				Lifetime:   10 * time.Second,
-			},
-			ra: &ndp.RouterAdvertisement{
-				Options: []ndp.Option{
-					&ndp.RouteInformation{
-						PrefixLength:  32,
-						Preference:    ndp.High,
+			name: "automatic prefixes /64",
+			plugin: &Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 10 * time.Second,
+				ValidLifetime:     20 * time.Second,
+
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{
+						// Populate some addresses that should be ignored.
+						mustCIDR("192.0.2.1/24"),
+						&net.TCPAddr{},
+						mustCIDR("fe80::1/64"),
+						mustCIDR("fdff::1/32"),
+						mustCIDR("2001:db8::1/64"),
+						mustCIDR("2001:db8::2/64"),
+						mustCIDR("fd00::1/64"),
+					}, nil
+				},
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						OnLink:                         true,
+						AutonomousAddressConfiguration: true,
+						PreferredLifetime:              10 * time.Second,
+						ValidLifetime:                  20 * time.Second,
+						Prefix:                         mustIP("2001:db8::"),
+					},
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						OnLink:                         true,
+						AutonomousAddressConfiguration: true,
+						PreferredLifetime:              10 * time.Second,
+						ValidLifetime:                  20 * time.Second,
+						Prefix:                         mustIP("fd00::"),
+					},
+				},
+			},
+		},
+		{
+			name: "automatic prefixes excluded",
+			plugin: &Prefix{
+				Prefix:            crtest.MustIPPrefix("::/64"),
+				OnLink:            true,
+				Autonomous:        true,
+				PreferredLifetime: 10 * time.Second,
+				ValidLifetime:     20 * time.Second,
+				ExcludePrefixes: []netaddr.IPPrefix{
+					// Exclude a management prefix and any prefix within a
+					// larger management supernet.
+					crtest.MustIPPrefix("fd00::/64"),
+					crtest.MustIPPrefix("2001:db8:ffff::/48"),
+				},
+
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{
+						mustCIDR("2001:db8::1/64"),
+						mustCIDR("fd00::1/64"),
+						mustCIDR("2001:db8:ffff:1::1/64"),
+						mustCIDR("2001:db8:fffe::1/64"),
+					}, nil
+				},
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						OnLink:                         true,
+						AutonomousAddressConfiguration: true,
+						PreferredLifetime:              10 * time.Second,
+						ValidLifetime:                  20 * time.Second,
+						Prefix:                         mustIP("2001:db8::"),
+					},
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						OnLink:                         true,
+						AutonomousAddressConfiguration: true,
+						PreferredLifetime:              10 * time.Second,
+						ValidLifetime:                  20 * time.Second,
+						Prefix:                         mustIP("2001:db8:fffe::"),
+					},
+				},
+			},
+		},
+		{
+			name: "automatic prefixes /32",
+			plugin: &Prefix{
+				Prefix: crtest.MustIPPrefix("::/32"),
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{
+						// Specify an IPv4 address that could feasibly be
+						// matched, but must be skipped due to incorrect address
+						// family.
+						mustCIDR("192.0.2.1/32"),
+						mustCIDR("2001:db8::1/32"),
+					}, nil
+				},
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength: 32,
+						Prefix:       mustIP("2001:db8::"),
+					},
+				},
+			},
+		},
+		{
+			name: "deprecated preferred and valid",
+			plugin: &Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				Autonomous:        true,
+				OnLink:            true,
+				PreferredLifetime: 10 * time.Second,
+				ValidLifetime:     20 * time.Second,
+
+				Deprecated: true,
+				Epoch:      time.Unix(1, 0),
+				TimeNow:    func() time.Time { return time.Unix(5, 0) },
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						AutonomousAddressConfiguration: true,
+						OnLink:                         true,
+						PreferredLifetime:              6 * time.Second,
+						ValidLifetime:                  16 * time.Second,
+						Prefix:                         mustIP("2001:db8::"),
+					},
+				},
+			},
+		},
+		{
+			name: "deprecated valid",
+			plugin: &Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				Autonomous:        true,
+				OnLink:            true,
+				PreferredLifetime: 10 * time.Second,
+				ValidLifetime:     20 * time.Second,
+
+				Deprecated: true,
+				Epoch:      time.Unix(1, 0),
+				TimeNow:    func() time.Time { return time.Unix(11, 0) },
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						AutonomousAddressConfiguration: true,
+						OnLink:                         true,
+						PreferredLifetime:              0 * time.Second,
+						ValidLifetime:                  10 * time.Second,
+						Prefix:                         mustIP("2001:db8::"),
+					},
+				},
+			},
+		},
+		{
+			name: "deprecated invalid",
+			plugin: &Prefix{
+				Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+				Autonomous:        true,
+				OnLink:            true,
+				PreferredLifetime: 10 * time.Second,
+				ValidLifetime:     20 * time.Second,
+
+				Deprecated: true,
+				Epoch:      time.Unix(1, 0),
+				TimeNow:    func() time.Time { return time.Unix(21, 0) },
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						AutonomousAddressConfiguration: true,
+						OnLink:                         true,
+						PreferredLifetime:              0 * time.Second,
+						ValidLifetime:                  0 * time.Second,
+						Prefix:                         mustIP("2001:db8::"),
+					},
+				},
+			},
+		},
+		{
+			name: "route",
+			plugin: &Route{
+				Prefix:     crtest.MustIPPrefix("2001:db8::/32"),
+				Preference: ndp.High,
+				Lifetime:   10 * time.Second,
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RouteInformation{
+						PrefixLength:  32,
+						Preference:    ndp.High,
 						RouteLifetime: 10 * time.Second,
 						Prefix:        mustIP("2001:db8::"),
 					},
@@ -324,50 +823,1580 @@ func TestBuild(t *testing.T) {
 			},
 		},
 		{
-			name: "RDNSS",
-			plugin: &RDNSS{
-				Lifetime: 10 * time.Second,
-				Servers: []netaddr.IP{
-					crtest.MustIP("2001:db8::1"),
-					crtest.MustIP("2001:db8::2"),
-				},
+			name: "default route",
+			plugin: &Route{
+				Prefix:     crtest.MustIPPrefix("::/0"),
+				Preference: ndp.Low,
+				Lifetime:   30 * time.Minute,
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RouteInformation{
+						PrefixLength:  0,
+						Preference:    ndp.Low,
+						RouteLifetime: 30 * time.Minute,
+						Prefix:        mustIP("::"),
+					},
+				},
+			},
+		},
+		{
+			name: "RDNSS",
+			plugin: &RDNSS{
+				Lifetime: 10 * time.Second,
+				Servers: []netaddr.IP{
+					crtest.MustIP("2001:db8::1"),
+					crtest.MustIP("2001:db8::2"),
+				},
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RecursiveDNSServer{
+						Lifetime: 10 * time.Second,
+						Servers: []net.IP{
+							mustIP("2001:db8::1"),
+							mustIP("2001:db8::2"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RDNSS truncate",
+			plugin: &RDNSS{
+				Lifetime: 10 * time.Second,
+				Servers: []netaddr.IP{
+					crtest.MustIP("2001:db8::1"),
+					crtest.MustIP("2001:db8::2"),
+					crtest.MustIP("2001:db8::3"),
+				},
+				MaxServers: 2,
+				Truncate:   true,
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RecursiveDNSServer{
+						Lifetime: 10 * time.Second,
+						Servers: []net.IP{
+							mustIP("2001:db8::1"),
+							mustIP("2001:db8::2"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RDNSS interface",
+			plugin: &RDNSS{
+				Lifetime:  10 * time.Second,
+				Servers:   []netaddr.IP{crtest.MustIP("2001:db8::53")},
+				Interface: true,
+
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{
+						mustAddr("192.0.2.1/24"),
+						mustAddr("fe80::1/64"),
+						mustAddr("2001:db8::1/64"),
+						// Temporary.
+						mustAddr("2001:db8::2/64"),
+						mustAddr("fdff:dead:beef::1/64"),
+					}, nil
+				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) {
+					return []netaddr.IP{crtest.MustIP("2001:db8::2")}, nil
+				},
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RecursiveDNSServer{
+						Lifetime: 10 * time.Second,
+						Servers: []net.IP{
+							mustIP("2001:db8::1"),
+							mustIP("fdff:dead:beef::1"),
+							mustIP("2001:db8::53"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RDNSS interface lowest stable address",
+			plugin: &RDNSS{
+				Lifetime:           10 * time.Second,
+				Servers:            []netaddr.IP{crtest.MustIP("2001:db8::53")},
+				Interface:          true,
+				InterfaceAddresses: LowestStableAddress,
+
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{
+						mustAddr("fe80::1/64"),
+						mustAddr("fdff:dead:beef::1/64"),
+						mustAddr("2001:db8::3/64"),
+						mustAddr("2001:db8::2/64"),
+						// Temporary.
+						mustAddr("2001:db8::1/64"),
+					}, nil
+				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) {
+					return []netaddr.IP{crtest.MustIP("2001:db8::1")}, nil
+				},
+			},
+			ra: &ndp.RouterAdvertisement{
+				Options: []ndp.Option{
+					&ndp.RecursiveDNSServer{
+						Lifetime: 10 * time.Second,
+						Servers: []net.IP{
+							mustIP("2001:db8::2"),
+							mustIP("2001:db8::53"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "RDNSS interface no addresses",
+			plugin: &RDNSS{
+				Lifetime:  10 * time.Second,
+				Interface: true,
+
+				Addrs: func() ([]net.Addr, error) {
+					return []net.Addr{mustAddr("fe80::1/64")}, nil
+				},
+				TemporaryAddrs: func() ([]netaddr.IP, error) {
+					return nil, os.ErrNotExist
+				},
+			},
+			ra: &ndp.RouterAdvertisement{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ra := new(ndp.RouterAdvertisement)
+
+			if tt.ifi != nil {
+				if err := tt.plugin.Prepare(tt.ifi); err != nil {
+					t.Fatalf("failed to prepare: %v", err)
+				}
+			}
+
+			if err := tt.plugin.Apply(ra); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.ra, ra); diff != "" {
+				t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+			}
+
+		})
+	}
+}
+
+func TestMTUOnClamp(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Plugin
+		mtu  func(p Plugin) int
+	}{
+		{
+			name: "TunnelMTU",
+			p:    &TunnelMTU{Overhead: 80},
+			mtu:  func(p Plugin) int { return p.(*TunnelMTU).MTU },
+		},
+		{
+			name: "SysctlDefaults",
+			p: &SysctlDefaults{
+				MTU: true,
+				Parameters: func(_ string) (*system.IPv6Parameters, error) {
+					return &system.IPv6Parameters{MTU: 1220}, nil
+				},
+			},
+			mtu: func(p Plugin) int { return p.(*SysctlDefaults).Values.MTU },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Both plugins produce an MTU of 1220 which must be clamped to
+			// the IPv6 minimum rather than being advertised.
+			var clamped int
+			switch p := tt.p.(type) {
+			case *TunnelMTU:
+				p.OnClamp = func(mtu int) { clamped = mtu }
+			case *SysctlDefaults:
+				p.OnClamp = func(mtu int) { clamped = mtu }
+			}
+
+			if err := tt.p.Prepare(&net.Interface{Name: "eth0", MTU: 1300}); err != nil {
+				t.Fatalf("failed to prepare: %v", err)
+			}
+
+			if diff := cmp.Diff(1220, clamped); diff != "" {
+				t.Fatalf("unexpected clamped MTU (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(1280, tt.mtu(tt.p)); diff != "" {
+				t.Fatalf("unexpected advertised MTU (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRDNSSOnEmpty(t *testing.T) {
+	var (
+		addrs []net.Addr
+		empty []bool
+	)
+
+	r := &RDNSS{
+		Interface: true,
+		OnEmpty:   func(e bool) { empty = append(empty, e) },
+
+		Addrs: func() ([]net.Addr, error) { return addrs, nil },
+		TemporaryAddrs: func() ([]netaddr.IP, error) {
+			return nil, nil
+		},
+	}
+
+	// The hook only fires when servers disappear or reappear.
+	for _, as := range [][]net.Addr{
+		{mustAddr("2001:db8::1/64")},
+		nil,
+		nil,
+		{mustAddr("2001:db8::1/64")},
+	} {
+		addrs = as
+		if err := r.Apply(&ndp.RouterAdvertisement{}); err != nil {
+			t.Fatalf("failed to apply: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff([]bool{true, false}, empty); diff != "" {
+		t.Fatalf("unexpected empty notifications (-want +got):\n%s", diff)
+	}
+}
+
+func TestRDNSSWithdrawMarshal(t *testing.T) {
+	r := &RDNSS{
+		Servers: []netaddr.IP{crtest.MustIP("2001:db8::1")},
+	}
+
+	ra := &ndp.RouterAdvertisement{}
+	if err := r.Apply(ra); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	b, err := ndp.MarshalMessage(ra)
+	if err != nil {
+		t.Fatalf("failed to marshal router advertisement: %v", err)
+	}
+
+	// The option follows the ICMPv6 and router advertisement headers. A zero
+	// lifetime is encoded as-is so that hosts withdraw the server.
+	want := []byte{
+		// Type 25, length 3 (24 bytes), reserved.
+		25, 3, 0x00, 0x00,
+		// Lifetime: 0 seconds.
+		0x00, 0x00, 0x00, 0x00,
+		// 2001:db8::1.
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	}
+
+	if diff := cmp.Diff(want, b[16:]); diff != "" {
+		t.Fatalf("unexpected recursive DNS server option (-want +got):\n%s", diff)
+	}
+
+	m, err := ndp.ParseMessage(b)
+	if err != nil {
+		t.Fatalf("failed to parse router advertisement: %v", err)
+	}
+
+	if diff := cmp.Diff(ra, m); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrefixRouterAddressMarshal(t *testing.T) {
+	p := &Prefix{
+		Prefix:            crtest.MustIPPrefix("::/64"),
+		OnLink:            true,
+		Autonomous:        true,
+		RouterAddress:     true,
+		PreferredLifetime: 4 * time.Hour,
+		ValidLifetime:     ndp.Infinity,
+
+		Addrs: func() ([]net.Addr, error) {
+			return []net.Addr{mustAddr("2001:db8::1/64")}, nil
+		},
+		TemporaryAddrs: func() ([]netaddr.IP, error) { return nil, nil },
+	}
+
+	ra := &ndp.RouterAdvertisement{}
+	if err := p.Apply(ra); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	b, err := ndp.MarshalMessage(ra)
+	if err != nil {
+		t.Fatalf("failed to marshal router advertisement: %v", err)
+	}
+
+	// The option follows the ICMPv6 and router advertisement headers.
+	want := []byte{
+		// Type 3, length 4 (32 bytes), prefix length 64, L, A, and R flags.
+		3, 4, 64, 0xe0,
+		// Valid lifetime: infinite.
+		0xff, 0xff, 0xff, 0xff,
+		// Preferred lifetime: 4 hours.
+		0x00, 0x00, 0x38, 0x40,
+		// Reserved.
+		0x00, 0x00, 0x00, 0x00,
+		// 2001:db8::1, the full router address.
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	}
+
+	if diff := cmp.Diff(want, b[16:]); diff != "" {
+		t.Fatalf("unexpected prefix information option (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrefixInformation(t *testing.T) {
+	pi := &ndp.PrefixInformation{
+		PrefixLength:                   64,
+		OnLink:                         true,
+		AutonomousAddressConfiguration: true,
+		ValidLifetime:                  ndp.Infinity,
+		PreferredLifetime:              4 * time.Hour,
+		Prefix:                         crtest.MustIP("2001:db8::1").IPAddr().IP,
+	}
+
+	tests := []struct {
+		name          string
+		o             ndp.Option
+		routerAddress bool
+		ok            bool
+	}{
+		{
+			name: "MTU",
+			o:    ndp.NewMTU(1500),
+		},
+		{
+			name: "raw",
+			o:    &ndp.RawOption{Type: 3, Length: 1, Value: make([]byte, 6)},
+		},
+		{
+			name: "prefix information",
+			o:    pi,
+			ok:   true,
+		},
+		{
+			name:          "router address",
+			o:             RouterAddressOption(pi),
+			routerAddress: true,
+			ok:            true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, routerAddress, ok := PrefixInformation(tt.o)
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+			if !ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.routerAddress, routerAddress); diff != "" {
+				t.Fatalf("unexpected router address flag (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(pi, got); diff != "" {
+				t.Fatalf("unexpected prefix information (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRouteDefaultMarshal(t *testing.T) {
+	r := &Route{
+		Prefix:     crtest.MustIPPrefix("::/0"),
+		Preference: ndp.Low,
+		Lifetime:   30 * time.Minute,
+	}
+
+	ra := &ndp.RouterAdvertisement{}
+	if err := r.Apply(ra); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	b, err := ndp.MarshalMessage(ra)
+	if err != nil {
+		t.Fatalf("failed to marshal router advertisement: %v", err)
+	}
+
+	// The option follows the ICMPv6 and router advertisement headers. A ::/0
+	// route omits its prefix entirely per RFC 4191, section 2.3.
+	want := []byte{
+		// Type 24, length 1 (8 bytes), prefix length 0.
+		24, 1, 0x00,
+		// Low preference.
+		0x18,
+		// Lifetime: 1800 seconds.
+		0x00, 0x00, 0x07, 0x08,
+	}
+
+	if diff := cmp.Diff(want, b[16:]); diff != "" {
+		t.Fatalf("unexpected route information option (-want +got):\n%s", diff)
+	}
+
+	m, err := ndp.ParseMessage(b)
+	if err != nil {
+		t.Fatalf("failed to parse router advertisement: %v", err)
+	}
+
+	if diff := cmp.Diff(ra, m); diff != "" {
+		t.Fatalf("unexpected router advertisement (-want +got):\n%s", diff)
+	}
+}
+
+func TestManagedPrefixApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		addrs   []net.Addr
+		managed bool
+	}{
+		{
+			name: "absent",
+			addrs: []net.Addr{
+				mustCIDR("192.0.2.1/24"),
+				&net.TCPAddr{},
+				mustCIDR("fe80::1/64"),
+				mustCIDR("2001:db8:ffff::1/64"),
+			},
+		},
+		{
+			name: "present",
+			addrs: []net.Addr{
+				mustCIDR("fe80::1/64"),
+				mustCIDR("2001:db8:1::1/64"),
+			},
+			managed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := &ManagedPrefix{
+				Prefix: crtest.MustIPPrefix("2001:db8:1::/48"),
+				Addrs:  func() ([]net.Addr, error) { return tt.addrs, nil },
+			}
+
+			// Any static configuration is overridden.
+			ra := &ndp.RouterAdvertisement{ManagedConfiguration: !tt.managed}
+			if err := mp.Apply(ra); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.managed, ra.ManagedConfiguration); diff != "" {
+				t.Fatalf("unexpected managed flag (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCaptivePortalPrepare(t *testing.T) {
+	tests := []struct {
+		name string
+		cp   *CaptivePortal
+		ok   bool
+	}{
+		{
+			name: "bad URL",
+			cp:   &CaptivePortal{API: "https://[::1"},
+		},
+		{
+			name: "bad scheme",
+			cp:   &CaptivePortal{API: "ftp://example.com"},
+		},
+		{
+			name: "no host",
+			cp:   &CaptivePortal{API: "https:///api"},
+		},
+		{
+			name: "strict HTTP",
+			cp:   &CaptivePortal{API: "http://example.com/api", Strict: true},
+		},
+		{
+			name: "OK HTTP",
+			cp:   &CaptivePortal{API: "http://example.com/api"},
+			ok:   true,
+		},
+		{
+			name: "OK strict HTTPS",
+			cp:   &CaptivePortal{API: "https://example.com/api", Strict: true},
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cp.Prepare(nil)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to prepare: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestCheckLifetimes(t *testing.T) {
+	tests := []struct {
+		name             string
+		valid, preferred time.Duration
+		ok               bool
+	}{
+		{
+			name:      "preferred exceeds valid",
+			valid:     1 * time.Hour,
+			preferred: 1*time.Hour + 1*time.Second,
+		},
+		{
+			name:      "infinite preferred",
+			valid:     24 * time.Hour,
+			preferred: ndp.Infinity,
+		},
+		{
+			name:      "equal",
+			valid:     1 * time.Hour,
+			preferred: 1 * time.Hour,
+			ok:        true,
+		},
+		{
+			name:      "infinite valid",
+			valid:     ndp.Infinity,
+			preferred: 4 * time.Hour,
+			ok:        true,
+		},
+		{
+			name:      "infinite",
+			valid:     ndp.Infinity,
+			preferred: ndp.Infinity,
+			ok:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckLifetimes(tt.valid, tt.preferred)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to check lifetimes: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestCheckAutonomous(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		autonomous bool
+		ok         bool
+	}{
+		{
+			name:       "autonomous /48",
+			prefix:     "2001:db8::/48",
+			autonomous: true,
+		},
+		{
+			name:       "autonomous /80",
+			prefix:     "2001:db8::/80",
+			autonomous: true,
+		},
+		{
+			name:       "autonomous /64",
+			prefix:     "2001:db8::/64",
+			autonomous: true,
+			ok:         true,
+		},
+		{
+			name:       "autonomous ::/64",
+			prefix:     "::/64",
+			autonomous: true,
+			ok:         true,
+		},
+		{
+			name:   "on-link /48",
+			prefix: "2001:db8::/48",
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAutonomous(crtest.MustIPPrefix(tt.prefix), tt.autonomous)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to check autonomous prefix: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestPrefixPrepareLifetimes(t *testing.T) {
+	p := &Prefix{
+		Prefix:            crtest.MustIPPrefix("2001:db8::/64"),
+		PreferredLifetime: ndp.Infinity,
+		ValidLifetime:     24 * time.Hour,
+	}
+
+	if err := p.Prepare(&net.Interface{Name: "eth0"}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestNewRawOption(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  uint8
+		b    []byte
+		ok   bool
+	}{
+		{
+			name: "zero type",
+			b:    make([]byte, 6),
+		},
+		{
+			name: "bad framing",
+			typ:  253,
+			b:    make([]byte, 8),
+		},
+		{
+			name: "too long",
+			typ:  253,
+			b:    make([]byte, (256*8)-2),
+		},
+		{
+			name: "OK",
+			typ:  253,
+			b:    make([]byte, 14),
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRawOption(tt.typ, tt.b)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to create raw option: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestRenumberApply(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	pi := func(prefix string, valid, preferred time.Duration) *ndp.PrefixInformation {
+		return &ndp.PrefixInformation{
+			PrefixLength:                   64,
+			OnLink:                         true,
+			AutonomousAddressConfiguration: true,
+			ValidLifetime:                  valid,
+			PreferredLifetime:              preferred,
+			Prefix:                         mustIP(prefix),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		phase    RenumberPhase
+		progress float64
+		options  []ndp.Option
+	}{
+		{
+			name:  "pending",
+			now:   start.Add(-1 * time.Second),
+			phase: RenumberPending,
+			options: []ndp.Option{
+				pi("2001:db8:1::", 24*time.Hour, 4*time.Hour),
+			},
+		},
+		{
+			name:  "start",
+			now:   start,
+			phase: RenumberActive,
+			options: []ndp.Option{
+				pi("2001:db8:2::", 24*time.Hour, 4*time.Hour),
+				pi("2001:db8:1::", 12*time.Hour, 4*time.Hour),
+			},
+		},
+		{
+			name:     "deprecated",
+			now:      start.Add(6 * time.Hour),
+			phase:    RenumberActive,
+			progress: 0.5,
+			options: []ndp.Option{
+				pi("2001:db8:2::", 24*time.Hour, 4*time.Hour),
+				pi("2001:db8:1::", 6*time.Hour, 0),
+			},
+		},
+		{
+			name:     "complete",
+			now:      start.Add(12 * time.Hour),
+			phase:    RenumberComplete,
+			progress: 1,
+			options: []ndp.Option{
+				pi("2001:db8:2::", 24*time.Hour, 4*time.Hour),
+				pi("2001:db8:1::", 0, 0),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Renumber{
+				Old: &Prefix{
+					Prefix:            crtest.MustIPPrefix("2001:db8:1::/64"),
+					OnLink:            true,
+					Autonomous:        true,
+					ValidLifetime:     24 * time.Hour,
+					PreferredLifetime: 4 * time.Hour,
+				},
+				New: &Prefix{
+					Prefix:            crtest.MustIPPrefix("2001:db8:2::/64"),
+					OnLink:            true,
+					Autonomous:        true,
+					ValidLifetime:     24 * time.Hour,
+					PreferredLifetime: 4 * time.Hour,
+				},
+				Start:   start,
+				Window:  12 * time.Hour,
+				TimeNow: func() time.Time { return tt.now },
+			}
+
+			ra := new(ndp.RouterAdvertisement)
+			if err := r.Apply(ra); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.options, ra.Options); diff != "" {
+				t.Fatalf("unexpected options (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.phase, r.Phase()); diff != "" {
+				t.Fatalf("unexpected phase (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.progress, r.Progress()); diff != "" {
+				t.Fatalf("unexpected progress (-want +got):\n%s", diff)
+			}
+
+			// The configured old prefix must not be modified.
+			if r.Old.Deprecated || r.Old.ValidLifetime != 24*time.Hour {
+				t.Fatalf("old prefix was modified: %+v", r.Old)
+			}
+		})
+	}
+}
+
+func TestDelegatedPrefixApply(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	pi := func(prefix string, valid, preferred time.Duration) *ndp.PrefixInformation {
+		return &ndp.PrefixInformation{
+			PrefixLength:                   64,
+			OnLink:                         true,
+			AutonomousAddressConfiguration: true,
+			ValidLifetime:                  valid,
+			PreferredLifetime:              preferred,
+			Prefix:                         mustIP(prefix),
+		}
+	}
+
+	// Each step is applied in order to the same DelegatedPrefix, so it
+	// remembers prefixes which were derived by previous steps.
+	tests := []struct {
+		name    string
+		now     time.Time
+		addrs   []net.Addr
+		options []ndp.Option
+	}{
+		{
+			name: "no upstream prefix",
+			now:  start,
+			addrs: []net.Addr{
+				mustAddr("192.0.2.1/24"),
+				mustAddr("fe80::1/64"),
+			},
+		},
+		{
+			name: "delegated",
+			now:  start,
+			addrs: []net.Addr{
+				mustAddr("2001:db8:0:ff::1/56"),
+				// Duplicate and too small prefixes have no effect.
+				mustAddr("2001:db8:0:ff::2/56"),
+				mustAddr("2001:db8:ffff:ffff::1/64"),
+			},
+			options: []ndp.Option{
+				pi("2001:db8:0:2::", 24*time.Hour, 4*time.Hour),
+			},
+		},
+		{
+			name: "renumbered",
+			now:  start.Add(1 * time.Hour),
+			addrs: []net.Addr{
+				mustAddr("2001:db8:1::1/48"),
+			},
+			options: []ndp.Option{
+				pi("2001:db8:1:2::", 24*time.Hour, 4*time.Hour),
+				pi("2001:db8:0:2::", 0, 0),
+			},
+		},
+		{
+			name: "withdrawn",
+			now:  start.Add(2 * time.Hour),
+			options: []ndp.Option{
+				pi("2001:db8:0:2::", 0, 0),
+				pi("2001:db8:1:2::", 0, 0),
+			},
+		},
+		{
+			name: "expired",
+			now:  start.Add(24*time.Hour + 30*time.Minute),
+			options: []ndp.Option{
+				pi("2001:db8:1:2::", 0, 0),
+			},
+		},
+		{
+			name: "forgotten",
+			now:  start.Add(26 * time.Hour),
+		},
+	}
+
+	var (
+		now   time.Time
+		addrs []net.Addr
+	)
+
+	d := &DelegatedPrefix{
+		Prefix: &Prefix{
+			Prefix:            crtest.MustIPPrefix("::/64"),
+			OnLink:            true,
+			Autonomous:        true,
+			ValidLifetime:     24 * time.Hour,
+			PreferredLifetime: 4 * time.Hour,
+			TimeNow:           func() time.Time { return now },
+		},
+		Interface: "eth0",
+		Subnet:    2,
+		Addrs:     func() ([]net.Addr, error) { return addrs, nil },
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, addrs = tt.now, tt.addrs
+
+			ra := new(ndp.RouterAdvertisement)
+			if err := d.Apply(ra); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.options, ra.Options); diff != "" {
+				t.Fatalf("unexpected options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKernelRoutesApply(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	ri := func(prefix string, lifetime time.Duration) *ndp.RouteInformation {
+		pfx := crtest.MustIPPrefix(prefix)
+		return &ndp.RouteInformation{
+			PrefixLength:  pfx.Bits,
+			Preference:    ndp.High,
+			RouteLifetime: lifetime,
+			Prefix:        pfx.IP.IPAddr().IP,
+		}
+	}
+
+	route := func(prefix string, protocol uint8, iface string) system.Route {
+		return system.Route{
+			Prefix:    crtest.MustIPPrefix(prefix),
+			Table:     254,
+			Protocol:  protocol,
+			Metric:    1024,
+			Interface: iface,
+		}
+	}
+
+	// Each step is applied in order to the same KernelRoutes, so it remembers
+	// routes which were advertised by previous steps.
+	tests := []struct {
+		name    string
+		now     time.Time
+		routes  []system.Route
+		options []ndp.Option
+	}{
+		{
+			name: "no matching routes",
+			now:  start,
+			routes: []system.Route{
+				// Wrong protocol, output interface, and table.
+				route("2001:db8:1::/48", 2, "wg0"),
+				route("2001:db8:2::/48", 12, "eth1"),
+				{
+					Prefix:    crtest.MustIPPrefix("2001:db8:3::/48"),
+					Table:     100,
+					Protocol:  12,
+					Interface: "wg0",
+				},
+			},
+		},
+		{
+			name: "learned",
+			now:  start,
+			routes: []system.Route{
+				route("2001:db8:1::/48", 12, "wg0"),
+				// Duplicate, link-local, and multicast routes have no effect.
+				route("2001:db8:1::/48", 12, "wg0"),
+				route("fe80::/64", 12, "wg0"),
+				route("ff00::/8", 12, "wg0"),
+				route("2001:db8:2::/48", 12, "wg0"),
 			},
-			ra: &ndp.RouterAdvertisement{
-				Options: []ndp.Option{
-					&ndp.RecursiveDNSServer{
-						Lifetime: 10 * time.Second,
-						Servers: []net.IP{
-							mustIP("2001:db8::1"),
-							mustIP("2001:db8::2"),
-						},
-					},
-				},
+			options: []ndp.Option{
+				ri("2001:db8:1::/48", 30*time.Minute),
+				ri("2001:db8:2::/48", 30*time.Minute),
+			},
+		},
+		{
+			name: "withdrawn",
+			now:  start.Add(10 * time.Minute),
+			routes: []system.Route{
+				route("2001:db8:2::/48", 12, "wg0"),
+			},
+			options: []ndp.Option{
+				ri("2001:db8:2::/48", 30*time.Minute),
+				ri("2001:db8:1::/48", 0),
+			},
+		},
+		{
+			name: "forgotten",
+			now:  start.Add(30 * time.Minute),
+			routes: []system.Route{
+				route("2001:db8:2::/48", 12, "wg0"),
+			},
+			options: []ndp.Option{
+				ri("2001:db8:2::/48", 30*time.Minute),
 			},
 		},
 	}
 
+	var (
+		now    time.Time
+		routes []system.Route
+	)
+
+	k := &KernelRoutes{
+		Table:      254,
+		Protocol:   12,
+		Interface:  "wg0",
+		Preference: ndp.High,
+		Lifetime:   30 * time.Minute,
+		Routes:     func() ([]system.Route, error) { return routes, nil },
+		TimeNow:    func() time.Time { return now },
+	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			now, routes = tt.now, tt.routes
+
 			ra := new(ndp.RouterAdvertisement)
+			if err := k.Apply(ra); err != nil {
+				t.Fatalf("failed to apply: %v", err)
+			}
 
-			if tt.ifi != nil {
-				if err := tt.plugin.Prepare(tt.ifi); err != nil {
-					t.Fatalf("failed to prepare: %v", err)
-				}
+			if diff := cmp.Diff(tt.options, ra.Options); diff != "" {
+				t.Fatalf("unexpected options (-want +got):\n%s", diff)
 			}
+		})
+	}
+}
 
-			if err := tt.plugin.Apply(ra); err != nil {
-				t.Fatalf("failed to apply: %v", err)
+func TestKernelRoutesUpdate(t *testing.T) {
+	route := func(prefix, iface string) system.Route {
+		return system.Route{
+			Prefix:    crtest.MustIPPrefix(prefix),
+			Table:     254,
+			Interface: iface,
+		}
+	}
+
+	// Routes via the advertising interface are ignored.
+	steps := [][]system.Route{
+		{route("2001:db8:1::/48", "wg0")},
+		{route("2001:db8:1::/48", "wg0"), route("2001:db8:2::/48", "eth0")},
+		{route("2001:db8:2::/48", "wg0")},
+		{route("2001:db8:2::/48", "wg0")},
+		nil,
+	}
+
+	var routes []system.Route
+	k := &KernelRoutes{
+		Table:  254,
+		Routes: func() ([]system.Route, error) { return routes, nil },
+	}
+
+	if err := k.Prepare(&net.Interface{Name: "eth0"}); err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	var changed []bool
+	for _, s := range steps {
+		routes = s
+
+		c, err := k.Update()
+		if err != nil {
+			t.Fatalf("failed to update: %v", err)
+		}
+
+		changed = append(changed, c)
+	}
+
+	// The first Update only records the routes.
+	want := []bool{false, false, true, false, true}
+	if diff := cmp.Diff(want, changed); diff != "" {
+		t.Fatalf("unexpected changed states (-want +got):\n%s", diff)
+	}
+
+	k.Routes = func() ([]system.Route, error) { return nil, errors.New("no netlink") }
+	if _, err := k.Update(); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func Test_subnet(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		bits   uint8
+		n      int
+		ip     string
+		ok     bool
+	}{
+		{
+			name:   "zero",
+			prefix: "2001:db8::/56",
+			bits:   64,
+			ip:     "2001:db8::",
+			ok:     true,
+		},
+		{
+			name:   "last",
+			prefix: "2001:db8::/56",
+			bits:   64,
+			n:      255,
+			ip:     "2001:db8:0:ff::",
+			ok:     true,
+		},
+		{
+			name:   "byte boundary",
+			prefix: "2001:db8::/60",
+			bits:   64,
+			n:      0xf,
+			ip:     "2001:db8:0:f::",
+			ok:     true,
+		},
+		{
+			name:   "same length",
+			prefix: "2001:db8::/64",
+			bits:   64,
+			ip:     "2001:db8::",
+			ok:     true,
+		},
+		{
+			name:   "too large",
+			prefix: "2001:db8::/56",
+			bits:   64,
+			n:      256,
+		},
+		{
+			name:   "negative",
+			prefix: "2001:db8::/56",
+			bits:   64,
+			n:      -1,
+		},
+		{
+			name:   "too small",
+			prefix: "2001:db8::/64",
+			bits:   56,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, ok := subnet(crtest.MustIPPrefix(tt.prefix), tt.bits, tt.n)
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+			if !ok {
+				return
 			}
 
-			if diff := cmp.Diff(tt.ra, ra); diff != "" {
-				t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+			if diff := cmp.Diff(tt.ip, ip.String()); diff != "" {
+				t.Fatalf("unexpected IP (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpstreamUpdate(t *testing.T) {
+	// Fail twice, succeed once, fail twice, then succeed twice.
+	var (
+		results = []bool{false, false, true, false, false, true, true}
+		calls   int
+	)
+
+	u := &Upstream{
+		Hysteresis: 2,
+		Check: func() (bool, error) {
+			defer func() { calls++ }()
+			return results[calls], nil
+		},
+	}
+
+	var (
+		changed []bool
+		healthy []bool
+	)
+
+	for range results {
+		c, err := u.Update()
+		if err != nil {
+			t.Fatalf("failed to update: %v", err)
+		}
+
+		changed = append(changed, c)
+		healthy = append(healthy, u.Healthy())
+	}
+
+	// The single success does not restore health; two consecutive are required.
+	wantChanged := []bool{false, true, false, false, false, false, true}
+	if diff := cmp.Diff(wantChanged, changed); diff != "" {
+		t.Fatalf("unexpected changed states (-want +got):\n%s", diff)
+	}
+
+	wantHealthy := []bool{true, false, false, false, false, false, true}
+	if diff := cmp.Diff(wantHealthy, healthy); diff != "" {
+		t.Fatalf("unexpected healthy states (-want +got):\n%s", diff)
+	}
+
+	// While unhealthy, the router lifetime must be cleared.
+	u.Check = func() (bool, error) { return false, errors.New("no route") }
+	for i := 0; i < 2; i++ {
+		if _, err := u.Update(); err == nil {
+			t.Fatal("expected an error, but none occurred")
+		}
+	}
+
+	ra := &ndp.RouterAdvertisement{RouterLifetime: 30 * time.Minute}
+	if err := u.Apply(ra); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	if diff := cmp.Diff(&ndp.RouterAdvertisement{}, ra); diff != "" {
+		t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+	}
+}
+
+func TestVRRPUpdate(t *testing.T) {
+	// Master initially, backup once, then backup twice, then master twice.
+	var (
+		results = []bool{true, false, true, false, false, true, true}
+		calls   int
+	)
+
+	v := &VRRP{
+		Hysteresis: 2,
+		Check: func() (bool, error) {
+			defer func() { calls++ }()
+			return results[calls], nil
+		},
+	}
+
+	// Backup until checked.
+	if v.Master() {
+		t.Fatal("VRRP must be backup until checked")
+	}
+
+	var (
+		changed []bool
+		master  []bool
+	)
+
+	for range results {
+		c, err := v.Update()
+		if err != nil {
+			t.Fatalf("failed to update: %v", err)
+		}
+
+		changed = append(changed, c)
+		master = append(master, v.Master())
+	}
+
+	// The first check sets the role immediately, and a single disagreeing
+	// check does not change it afterward.
+	wantChanged := []bool{true, false, false, false, true, false, true}
+	if diff := cmp.Diff(wantChanged, changed); diff != "" {
+		t.Fatalf("unexpected changed states (-want +got):\n%s", diff)
+	}
+
+	wantMaster := []bool{true, true, true, true, false, false, true}
+	if diff := cmp.Diff(wantMaster, master); diff != "" {
+		t.Fatalf("unexpected master states (-want +got):\n%s", diff)
+	}
+
+	// While backup, the router lifetime must be cleared.
+	v.Check = func() (bool, error) { return false, errors.New("no state") }
+	for i := 0; i < 2; i++ {
+		if _, err := v.Update(); err == nil {
+			t.Fatal("expected an error, but none occurred")
+		}
+	}
+
+	ra := &ndp.RouterAdvertisement{RouterLifetime: 30 * time.Minute}
+	if err := v.Apply(ra); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	if diff := cmp.Diff(&ndp.RouterAdvertisement{}, ra); diff != "" {
+		t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+	}
+}
+
+func TestVRRPStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corerad-vrrp")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "state")
+
+	v := &VRRP{StateFile: file, Hysteresis: 1}
+	if err := v.Prepare(&net.Interface{Name: "eth0"}); err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	tests := []struct {
+		state  string
+		master bool
+	}{
+		{state: "MASTER\n", master: true},
+		{state: "BACKUP\n", master: false},
+		{state: "master", master: true},
+		{state: "FAULT\n", master: false},
+	}
+
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(file, []byte(tt.state), 0o644); err != nil {
+			t.Fatalf("failed to write state file: %v", err)
+		}
+
+		if _, err := v.Update(); err != nil {
+			t.Fatalf("failed to update: %v", err)
+		}
+
+		if diff := cmp.Diff(tt.master, v.Master()); diff != "" {
+			t.Fatalf("unexpected master state for %q (-want +got):\n%s", tt.state, diff)
+		}
+	}
+
+	// A missing state file is treated as backup.
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("failed to remove state file: %v", err)
+	}
+
+	if _, err := v.Update(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist error, but got: %v", err)
+	}
+}
+
+func TestPrefixOnExclude(t *testing.T) {
+	var excluded []netaddr.IPPrefix
+	p := &Prefix{
+		Prefix:          crtest.MustIPPrefix("::/64"),
+		ExcludePrefixes: []netaddr.IPPrefix{crtest.MustIPPrefix("fd00::/48")},
+		OnExclude:       func(pfx netaddr.IPPrefix) { excluded = append(excluded, pfx) },
+		Addrs: func() ([]net.Addr, error) {
+			return []net.Addr{
+				mustAddr("2001:db8::1/64"),
+				mustAddr("fd00::1/64"),
+				mustAddr("fd00::2/64"),
+				mustAddr("fd00:0:0:1::1/64"),
+			}, nil
+		},
+	}
+
+	if err := p.Apply(&ndp.RouterAdvertisement{}); err != nil {
+		t.Fatalf("failed to apply: %v", err)
+	}
+
+	// Each excluded prefix is reported once.
+	want := []netaddr.IPPrefix{
+		crtest.MustIPPrefix("fd00::/64"),
+		crtest.MustIPPrefix("fd00:0:0:1::/64"),
+	}
+
+	if diff := cmp.Diff(want, excluded, cmp.Comparer(func(x, y netaddr.IPPrefix) bool { return x == y })); diff != "" {
+		t.Fatalf("unexpected excluded prefixes (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrefixVerifyEUI64(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	tests := []struct {
+		name     string
+		prefix   string
+		mac      net.HardwareAddr
+		addrs    []net.Addr
+		warnings []string
+	}{
+		{
+			name:   "OK",
+			prefix: "2001:db8:0:1::/64",
+			mac:    mac,
+			addrs: []net.Addr{
+				mustAddr("192.0.2.1/24"),
+				mustAddr("fe80::1/64"),
+				mustAddr("2001:db8:0:1::1/64"),
+				mustAddr("2001:db8:0:2::1/120"),
+			},
+		},
+		{
+			name:   "OK EUI-64 hardware address",
+			prefix: "2001:db8:0:1::/64",
+			mac:    net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77},
+			addrs:  []net.Addr{mustAddr("2001:db8:0:1:211:2233:4455:6677/64")},
+		},
+		{
+			name:     "not /64",
+			prefix:   "2001:db8::/48",
+			mac:      mac,
+			warnings: []string{"prefix 2001:db8::/48 cannot be combined with a 64-bit EUI-64 interface identifier"},
+		},
+		{
+			name:     "no hardware address",
+			prefix:   "2001:db8:0:1::/64",
+			warnings: []string{`hardware address "" cannot form an EUI-64 interface identifier for prefix 2001:db8:0:1::/64`},
+		},
+		{
+			name:   "EUI-64 address configured",
+			prefix: "2001:db8:0:1::/64",
+			mac:    mac,
+			addrs:  []net.Addr{mustAddr("2001:db8:0:1:211:22ff:fe33:4455/128")},
+			warnings: []string{
+				"EUI-64 address 2001:db8:0:1:211:22ff:fe33:4455 in prefix 2001:db8:0:1::/64 is already configured as 2001:db8:0:1:211:22ff:fe33:4455/128",
+			},
+		},
+		{
+			name:   "overlaps shorter",
+			prefix: "2001:db8:0:1::/64",
+			mac:    mac,
+			addrs:  []net.Addr{mustAddr("2001:db8::1/48")},
+			warnings: []string{
+				"prefix 2001:db8:0:1::/64 overlaps interface address 2001:db8::1/48 which has a different prefix length",
+			},
+		},
+		{
+			name:   "wildcard overlaps longer",
+			prefix: "::/64",
+			mac:    mac,
+			addrs: []net.Addr{
+				mustAddr("2001:db8:0:1::1/64"),
+				mustAddr("2001:db8:0:1::100/120"),
+				mustAddr("2001:db8:0:2::1/64"),
+			},
+			warnings: []string{
+				"prefix 2001:db8:0:1::/64 overlaps interface address 2001:db8:0:1::100/120 which has a different prefix length",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Prefix{
+				Prefix:      crtest.MustIPPrefix(tt.prefix),
+				Autonomous:  true,
+				VerifyEUI64: true,
 			}
 
+			if diff := cmp.Diff(tt.warnings, p.verifyEUI64(tt.mac, tt.addrs)); diff != "" {
+				t.Fatalf("unexpected warnings (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
 
+func TestPrefixTolerantAddrs(t *testing.T) {
+	var (
+		errAddrs = errors.New("addresses unavailable")
+		good     = []net.Addr{mustAddr("2001:db8::1/64")}
+	)
+
+	// Fail once, succeed, then fail continuously.
+	var calls int
+	addrs := func() ([]net.Addr, error) {
+		defer func() { calls++ }()
+		if calls == 1 {
+			return good, nil
+		}
+
+		return nil, errAddrs
+	}
+
+	var tolerated int
+	p := &Prefix{
+		MaxAddrsFailures: 2,
+		OnAddrsFailure:   func(_ error) { tolerated++ },
+	}
+	fn := p.tolerantAddrs(addrs)
+
+	tests := []struct {
+		addrs []net.Addr
+		ok    bool
+	}{
+		// No previous addresses, but the failure is tolerated.
+		{ok: true},
+		{addrs: good, ok: true},
+		// Reuse the previous addresses until the threshold is exceeded.
+		{addrs: good, ok: true},
+		{addrs: good, ok: true},
+		{ok: false},
+	}
+
+	for i, tt := range tests {
+		got, err := fn()
+		if tt.ok && err != nil {
+			t.Fatalf("%d: failed to fetch addresses: %v", i, err)
+		}
+		if !tt.ok && err == nil {
+			t.Fatalf("%d: expected an error, but none occurred", i)
+		}
+
+		if diff := cmp.Diff(tt.addrs, got); diff != "" {
+			t.Fatalf("%d: unexpected addresses (-want +got):\n%s", i, diff)
+		}
+	}
+
+	if diff := cmp.Diff(3, tolerated); diff != "" {
+		t.Fatalf("unexpected number of tolerated failures (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoveLLA(t *testing.T) {
+	ra := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{
+			&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			},
+			ndp.NewMTU(1500),
+		},
+	}
+
+	RemoveLLA(ra)
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{ndp.NewMTU(1500)},
+	}
+
+	if diff := cmp.Diff(want, ra); diff != "" {
+		t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemovePrefixes(t *testing.T) {
+	ra := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{
+			&ndp.PrefixInformation{
+				PrefixLength: 64,
+				OnLink:       true,
+				Prefix:       mustIP("2001:db8::"),
+			},
+			ndp.NewMTU(1500),
+			&ndp.PrefixInformation{
+				PrefixLength: 64,
+				Prefix:       mustIP("2001:db8:ffff::"),
+			},
+			RouterAddressOption(&ndp.PrefixInformation{
+				PrefixLength: 64,
+				Prefix:       mustIP("2001:db8::1"),
+			}),
+		},
+	}
+
+	RemovePrefixes(ra)
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{ndp.NewMTU(1500)},
+	}
+
+	if diff := cmp.Diff(want, ra); diff != "" {
+		t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplaceNonce(t *testing.T) {
+	var (
+		ours   = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+		theirs = []byte{0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0xfa, 0xf9, 0xf8, 0xf7, 0xf6, 0xf5, 0xf4, 0xf3, 0xf2}
+	)
+
+	ra := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{
+			ndp.NewMTU(1500),
+			NewNonceOption(ours),
+		},
+	}
+
+	if nonce, ok := FindNonce(ra.Options); !ok || !bytes.Equal(ours, nonce) {
+		t.Fatalf("unexpected nonce: %v, ok: %t", nonce, ok)
+	}
+
+	ReplaceNonce(ra, theirs)
+
+	want := &ndp.RouterAdvertisement{
+		Options: []ndp.Option{
+			ndp.NewMTU(1500),
+			&ndp.RawOption{
+				Type:   NonceType,
+				Length: 2,
+				Value:  theirs,
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, ra); diff != "" {
+		t.Fatalf("unexpected RA (-want +got):\n%s", diff)
+	}
+}
+
 func mustIP(s string) net.IP {
 	ip := net.ParseIP(s)
 	if ip == nil {
@@ -385,3 +2414,15 @@ func mustCIDR(s string) *net.IPNet {
 
 	return ipn
 }
+
+// mustAddr parses a CIDR notation string into a *net.IPNet, keeping the host
+// bits of the IP address as an interface address would.
+func mustAddr(s string) *net.IPNet {
+	ip, ipn, err := net.ParseCIDR(s)
+	if err != nil {
+		panicf("failed to parse CIDR: %v", err)
+	}
+	ipn.IP = ip
+
+	return ipn
+}
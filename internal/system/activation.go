@@ -0,0 +1,342 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/ndp"
+	"golang.org/x/net/ipv6"
+)
+
+// Names of files passed by socket activation which are recognized by CoreRAD.
+const (
+	// ActivationHTTP is the name of the debug HTTP server's TCP listener.
+	ActivationHTTP = "http"
+
+	// ActivationNDPPrefix is prepended to an interface's name to form the
+	// name of its raw ICMPv6 socket, such as "ndp-eth0".
+	ActivationNDPPrefix = "ndp-"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// ListenFiles returns the files passed to this process by systemd socket
+// activation, keyed by name. If the process was not socket activated, it
+// returns nil and no error. The activation environment variables are unset
+// so they are not inherited by any child processes.
+//
+// File names are taken from LISTEN_FDNAMES, as set by FileDescriptorName in a
+// systemd socket unit. If LISTEN_FDNAMES is not set, the first file is named
+// ActivationHTTP and any others are named "unknown".
+func ListenFiles() (map[string]*os.File, error) {
+	fds, err := parseListenFDs(os.Getpid(), os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	if fds == nil {
+		return nil, nil
+	}
+
+	for _, k := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(k)
+	}
+
+	files := make(map[string]*os.File, len(fds))
+	for _, fd := range fds {
+		files[fd.name] = os.NewFile(uintptr(fd.fd), fd.name)
+	}
+
+	return files, nil
+}
+
+// A listenFD is a named file descriptor passed by socket activation.
+type listenFD struct {
+	name string
+	fd   int
+}
+
+// parseListenFDs parses the socket activation environment variables returned
+// by getenv for the process with the specified PID.
+func parseListenFDs(pid int, getenv func(key string) string) ([]listenFD, error) {
+	spid, sfds := getenv("LISTEN_PID"), getenv("LISTEN_FDS")
+	if spid == "" || sfds == "" {
+		// Not socket activated.
+		return nil, nil
+	}
+
+	lpid, err := strconv.Atoi(spid)
+	if err != nil {
+		return nil, fmt.Errorf("system: invalid LISTEN_PID %q: %v", spid, err)
+	}
+	if lpid != pid {
+		// The files were intended for another process.
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(sfds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("system: invalid LISTEN_FDS %q", sfds)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	var names []string
+	if s := getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+		if len(names) != n {
+			return nil, fmt.Errorf("system: LISTEN_FDNAMES has %d name(s) for %d file descriptor(s)",
+				len(names), n)
+		}
+	}
+
+	var (
+		fds  = make([]listenFD, 0, n)
+		seen = make(map[string]bool, n)
+	)
+
+	for i := 0; i < n; i++ {
+		var name string
+		switch {
+		case names != nil:
+			name = names[i]
+		case i == 0:
+			name = ActivationHTTP
+		default:
+			name = "unknown"
+		}
+
+		// Unnamed files are never used, so only named duplicates are ambiguous.
+		if seen[name] && name != "unknown" {
+			return nil, fmt.Errorf("system: duplicate socket activation file name %q", name)
+		}
+		seen[name] = true
+
+		fds = append(fds, listenFD{
+			name: name,
+			fd:   listenFDsStart + i,
+		})
+	}
+
+	return fds, nil
+}
+
+// A fileConn is a Conn for a raw ICMPv6 socket which was created by another
+// process and passed to CoreRAD, or created by CoreRAD itself so its options
+// could be tuned, rather than one created by package ndp.
+type fileConn struct {
+	ipc *net.IPConn
+	pc  *ipv6.PacketConn
+	ifi *net.Interface
+	src net.IP
+
+	// buf is reused by each call to ReadFrom.
+	buf []byte
+
+	// netns is the network namespace containing the socket, if any.
+	netns string
+}
+
+var (
+	_ Conn        = &fileConn{}
+	_ DropCounter = &fileConn{}
+)
+
+// fileNDP creates a Conn from the raw ICMPv6 socket f for use on ifi, which
+// is ready to serve router advertisements like a Conn produced by dialNDP.
+// The socket is duplicated so that f remains open and may be used again if
+// the Conn must be reinitialized. If the socket is not bound to an address,
+// outgoing messages are sent from src.
+func fileNDP(f *os.File, ifi *net.Interface, src net.IP, types []ipv6.ICMPType) (*fileConn, net.IP, error) {
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to use socket activation file %q: %v", f.Name(), err)
+	}
+
+	c, ip, err := newFileConn(pc, ifi, src, types)
+	if err != nil {
+		_ = pc.Close()
+		return nil, nil, err
+	}
+
+	return c, ip, nil
+}
+
+// newFileConn performs the setup for fileNDP using the duplicated socket pc.
+func newFileConn(pc net.PacketConn, ifi *net.Interface, src net.IP, types []ipv6.ICMPType) (*fileConn, net.IP, error) {
+	ipc, ok := pc.(*net.IPConn)
+	if !ok {
+		return nil, nil, fmt.Errorf("socket activation file for %q is %T, not a raw ICMPv6 socket",
+			ifi.Name, pc)
+	}
+
+	// A socket bound to a specific address always sends from that address.
+	ip := src
+	if addr, ok := ipc.LocalAddr().(*net.IPAddr); ok && addr.IP != nil && !addr.IP.IsUnspecified() {
+		if !addr.IP.IsLinkLocalUnicast() {
+			return nil, nil, fmt.Errorf("socket activation file for %q is bound to %s, not a link-local address",
+				ifi.Name, addr.IP)
+		}
+
+		ip, src = addr.IP, nil
+	}
+
+	c := &fileConn{
+		ipc: ipc,
+		pc:  ipv6.NewPacketConn(ipc),
+		ifi: ifi,
+		src: src,
+		buf: make([]byte, ifi.MTU),
+	}
+
+	// Package ndp sets the hop limits required by NDP when it creates a
+	// socket, and the remaining setup is shared with dialNDP. Applying the
+	// ICMPv6 filter also verifies that the socket is an ICMPv6 socket.
+	if err := c.pc.SetHopLimit(ndp.HopLimit); err != nil {
+		return nil, nil, fmt.Errorf("failed to set hop limit: %v", err)
+	}
+	if err := c.pc.SetMulticastHopLimit(ndp.HopLimit); err != nil {
+		return nil, nil, fmt.Errorf("failed to set multicast hop limit: %v", err)
+	}
+
+	if err := setupNDP(c, types); err != nil {
+		return nil, nil, err
+	}
+
+	return c, ip, nil
+}
+
+// ReadFrom implements Conn.
+func (c *fileConn) ReadFrom() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+	n, cm, src, err := c.pc.ReadFrom(c.buf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Parsed messages may retain references to their input, so only the
+	// message itself is copied out of the reused buffer.
+	m, err := ndp.ParseMessage(append([]byte(nil), c.buf[:n]...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	addr, ok := src.(*net.IPAddr)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unexpected source address type %T", src)
+	}
+
+	return m, cm, addr.IP, nil
+}
+
+// SetReadDeadline implements Conn.
+func (c *fileConn) SetReadDeadline(t time.Time) error { return c.pc.SetReadDeadline(t) }
+
+// WriteTo implements Conn.
+func (c *fileConn) WriteTo(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP) error {
+	b, err := ndp.MarshalMessage(m)
+	if err != nil {
+		return err
+	}
+
+	// Pin the source address and interface of an unbound socket unless the
+	// caller has already chosen them.
+	if c.src != nil && (cm == nil || cm.Src == nil) {
+		ncm := ipv6.ControlMessage{}
+		if cm != nil {
+			ncm = *cm
+		}
+		ncm.Src = c.src
+		ncm.IfIndex = c.ifi.Index
+		cm = &ncm
+	}
+
+	_, err = c.pc.WriteTo(b, cm, &net.IPAddr{IP: dst, Zone: c.ifi.Name})
+	return err
+}
+
+// SetICMPFilter applies an ICMPv6 filter to the Conn's socket.
+func (c *fileConn) SetICMPFilter(f *ipv6.ICMPFilter) error { return c.pc.SetICMPFilter(f) }
+
+// SetControlMessage sets the IPv6 control messages received by the Conn.
+func (c *fileConn) SetControlMessage(cf ipv6.ControlFlags, on bool) error {
+	return c.pc.SetControlMessage(cf, on)
+}
+
+// JoinGroup joins the specified multicast group on the Conn's interface.
+func (c *fileConn) JoinGroup(group net.IP) error {
+	return c.pc.JoinGroup(c.ifi, &net.IPAddr{IP: group})
+}
+
+// LeaveGroup leaves the specified multicast group on the Conn's interface.
+func (c *fileConn) LeaveGroup(group net.IP) error {
+	return c.pc.LeaveGroup(c.ifi, &net.IPAddr{IP: group})
+}
+
+// Close closes the Conn's duplicate of the socket.
+func (c *fileConn) Close() error { return c.pc.Close() }
+
+// Drops implements DropCounter.
+func (c *fileConn) Drops() (uint64, error) {
+	rc, err := c.ipc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	return socketDrops(rc, c.netns)
+}
+
+// setBuffers sets the receive and send buffer sizes of the socket. A size of
+// zero leaves the operating system's default in place.
+func (c *fileConn) setBuffers(rcv, snd int) error {
+	if rcv > 0 {
+		if err := c.ipc.SetReadBuffer(rcv); err != nil {
+			return fmt.Errorf("failed to set receive buffer size: %v", err)
+		}
+	}
+
+	if snd > 0 {
+		if err := c.ipc.SetWriteBuffer(snd); err != nil {
+			return fmt.Errorf("failed to set send buffer size: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// bindToDevice binds the socket to the Conn's interface.
+func (c *fileConn) bindToDevice() error {
+	rc, err := c.ipc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	return bindToDevice(rc, c.ifi.Name)
+}
+
+// buffers returns the effective receive and send buffer sizes of the socket.
+func (c *fileConn) buffers() (int, int, error) {
+	rc, err := c.ipc.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return socketBuffers(rc)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseListenFDs(t *testing.T) {
+	const pid = 100
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		fds  []listenFD
+		ok   bool
+	}{
+		{
+			name: "not activated",
+			ok:   true,
+		},
+		{
+			name: "other process",
+			env: map[string]string{
+				"LISTEN_PID": "200",
+				"LISTEN_FDS": "1",
+			},
+			ok: true,
+		},
+		{
+			name: "bad PID",
+			env: map[string]string{
+				"LISTEN_PID": "foo",
+				"LISTEN_FDS": "1",
+			},
+		},
+		{
+			name: "bad FDs",
+			env: map[string]string{
+				"LISTEN_PID": "100",
+				"LISTEN_FDS": "-1",
+			},
+		},
+		{
+			name: "names mismatch",
+			env: map[string]string{
+				"LISTEN_PID":     "100",
+				"LISTEN_FDS":     "2",
+				"LISTEN_FDNAMES": "http",
+			},
+		},
+		{
+			name: "duplicate names",
+			env: map[string]string{
+				"LISTEN_PID":     "100",
+				"LISTEN_FDS":     "2",
+				"LISTEN_FDNAMES": "ndp-eth0:ndp-eth0",
+			},
+		},
+		{
+			name: "OK ordered",
+			env: map[string]string{
+				"LISTEN_PID": "100",
+				"LISTEN_FDS": "3",
+			},
+			fds: []listenFD{
+				{name: "http", fd: 3},
+				{name: "unknown", fd: 4},
+				{name: "unknown", fd: 5},
+			},
+			ok: true,
+		},
+		{
+			name: "OK named",
+			env: map[string]string{
+				"LISTEN_PID":     "100",
+				"LISTEN_FDS":     "3",
+				"LISTEN_FDNAMES": "ndp-eth0:http:ndp-eth1",
+			},
+			fds: []listenFD{
+				{name: "ndp-eth0", fd: 3},
+				{name: "http", fd: 4},
+				{name: "ndp-eth1", fd: 5},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fds, err := parseListenFDs(pid, func(key string) string { return tt.env[key] })
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.fds, fds, cmp.AllowUnexported(listenFD{})); diff != "" {
+				t.Fatalf("unexpected file descriptors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
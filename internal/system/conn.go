@@ -17,10 +17,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/mdlayher/ndp"
 	"golang.org/x/net/ipv6"
+	"inet.af/netaddr"
 )
 
 // A Conn abstracts IPv6 NDP socket operations for purposes of testing.
@@ -32,18 +34,190 @@ type Conn interface {
 
 var _ Conn = &ndp.Conn{}
 
+// A DropCounter is implemented by a Conn which can report the number of
+// incoming packets dropped by its socket, such as when its receive buffer
+// overflows. Conns only implement DropCounter where the operating system
+// exposes such a counter.
+type DropCounter interface {
+	Drops() (uint64, error)
+}
+
+// A TestConn is an in-memory Conn which is primarily useful in tests. Messages
+// written to a TestConn are delivered to the channel returned by Writes, and
+// messages passed to Inject are returned to callers of ReadFrom.
+type TestConn struct {
+	readC, writeC chan TestMessage
+
+	mu       sync.Mutex
+	deadline time.Time
+	wakeC    chan struct{}
+}
+
+// A TestMessage is an NDP message and metadata read from or written to
+// a TestConn.
+type TestMessage struct {
+	Message        ndp.Message
+	ControlMessage *ipv6.ControlMessage
+	IP             net.IP
+}
+
+var _ Conn = &TestConn{}
+
+// NewTestConn creates a TestConn. Up to n messages may be buffered in each
+// direction before Inject or WriteTo will block.
+func NewTestConn(n int) *TestConn {
+	return &TestConn{
+		readC:  make(chan TestMessage, n),
+		writeC: make(chan TestMessage, n),
+		wakeC:  make(chan struct{}),
+	}
+}
+
+// Inject delivers m to the next caller of ReadFrom. If m.ControlMessage is
+// nil, a control message with a valid NDP hop limit is used.
+func (c *TestConn) Inject(m TestMessage) {
+	if m.ControlMessage == nil {
+		m.ControlMessage = &ipv6.ControlMessage{HopLimit: ndp.HopLimit}
+	}
+
+	c.readC <- m
+}
+
+// Writes returns a channel of all messages written to the TestConn in the
+// order in which they were written.
+func (c *TestConn) Writes() <-chan TestMessage { return c.writeC }
+
+// ReadFrom implements Conn.
+func (c *TestConn) ReadFrom() (ndp.Message, *ipv6.ControlMessage, net.IP, error) {
+	for {
+		c.mu.Lock()
+		deadline, wakeC := c.deadline, c.wakeC
+		c.mu.Unlock()
+
+		m, ok, err := c.read(deadline, wakeC)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !ok {
+			// Deadline changed, check it again.
+			continue
+		}
+
+		return m.Message, m.ControlMessage, m.IP, nil
+	}
+}
+
+// read blocks until a message arrives, the deadline expires, or wakeC is
+// closed due to a deadline change, in which case it returns false.
+func (c *TestConn) read(deadline time.Time, wakeC <-chan struct{}) (TestMessage, bool, error) {
+	var timeC <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return TestMessage{}, false, &timeoutError{}
+		}
+
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeC = t.C
+	}
+
+	select {
+	case m := <-c.readC:
+		return m, true, nil
+	case <-timeC:
+		return TestMessage{}, false, &timeoutError{}
+	case <-wakeC:
+		return TestMessage{}, false, nil
+	}
+}
+
+// SetReadDeadline implements Conn.
+func (c *TestConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Wake any pending readers so they can observe the new deadline.
+	c.deadline = t
+	close(c.wakeC)
+	c.wakeC = make(chan struct{})
+
+	return nil
+}
+
+// WriteTo implements Conn.
+func (c *TestConn) WriteTo(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP) error {
+	c.writeC <- TestMessage{
+		Message:        m,
+		ControlMessage: cm,
+		IP:             dst,
+	}
+
+	return nil
+}
+
+// A ShadowConn is a Conn which reads messages from an underlying Conn, but
+// never writes messages to it. Instead, each message which would have been
+// written is passed to the optional OnWrite hook.
+type ShadowConn struct {
+	Conn
+	OnWrite func(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP)
+}
+
+var _ Conn = &ShadowConn{}
+
+// WriteTo implements Conn.
+func (c *ShadowConn) WriteTo(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP) error {
+	if c.OnWrite != nil {
+		c.OnWrite(m, cm, dst)
+	}
+
+	return nil
+}
+
+// A timeoutError is a net.Error which indicates a TestConn read deadline
+// was exceeded.
+type timeoutError struct{}
+
+var _ net.Error = &timeoutError{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Temporary() bool { return true }
+func (*timeoutError) Timeout() bool   { return true }
+
 // ErrLinkNotReady is a sentinel which indicates an interface is not ready
 // for use with a Dialer listener.
 var ErrLinkNotReady = errors.New("link not ready")
 
-// lookupInterface looks up an interface by name, but also returns ErrLinkNotReady
-// if the interface doesn't exist.
+// Errors which classify why an interface cannot be used with a Dialer
+// listener. Conditions which may resolve themselves, such as a link which is
+// not yet up, also match ErrLinkNotReady.
+var (
+	ErrNoLink      error = &linkError{s: "link does not exist", notReady: true}
+	ErrLinkDown    error = &linkError{s: "link is down", notReady: true}
+	ErrNoLinkLocal error = &linkError{s: "no IPv6 link-local address", notReady: true}
+	ErrNoMulticast error = &linkError{s: "link does not support multicast"}
+)
+
+// A linkError is an error which classifies a link's readiness.
+type linkError struct {
+	s        string
+	notReady bool
+}
+
+func (e *linkError) Error() string { return e.s }
+
+// Is implements errors.Is for ErrLinkNotReady.
+func (e *linkError) Is(target error) bool { return e.notReady && target == ErrLinkNotReady }
+
+// lookupInterface looks up an interface by name, but also returns ErrNoLink,
+// which matches ErrLinkNotReady, if the interface doesn't exist.
 func lookupInterface(iface string) (*net.Interface, error) {
 	ifi, err := net.InterfaceByName(iface)
 	if err != nil {
 		if isNoSuchInterface(err) {
 			// Allow retry if the interface may not exist yet.
-			return nil, fmt.Errorf("interface %q does not exist: %w", iface, ErrLinkNotReady)
+			return nil, fmt.Errorf("interface %q: %w", iface, ErrNoLink)
 		}
 
 		return nil, fmt.Errorf("failed to get interface %q: %v", iface, err)
@@ -60,9 +234,14 @@ func checkInterface(ifi *net.Interface, addrFunc func() ([]net.Addr, error)) err
 	}
 
 	// Link must be up.
-	// TODO: check point-to-point and multicast flags and configure accordingly.
+	// TODO: check point-to-point flag and configure accordingly.
 	if ifi.Flags&net.FlagUp == 0 {
-		return fmt.Errorf("interface %q is not up: %w", ifi.Name, ErrLinkNotReady)
+		return fmt.Errorf("interface %q: %w", ifi.Name, ErrLinkDown)
+	}
+
+	// Link must support multicast because NDP relies on multicast groups.
+	if ifi.Flags&net.FlagMulticast == 0 {
+		return fmt.Errorf("interface %q: %w, which is required for NDP", ifi.Name, ErrNoMulticast)
 	}
 
 	// Link must have an IPv6 link-local unicast address.
@@ -81,12 +260,94 @@ func checkInterface(ifi *net.Interface, addrFunc func() ([]net.Addr, error)) err
 		}
 	}
 	if !foundLL {
-		return fmt.Errorf("interface %q has no IPv6 link-local address: %w", ifi.Name, ErrLinkNotReady)
+		return fmt.Errorf("interface %q: %w, IPv6 may be disabled", ifi.Name, ErrNoLinkLocal)
 	}
 
 	return nil
 }
 
+// TemporaryAddresses returns the IPv6 temporary addresses, such as RFC 4941
+// privacy addresses, configured on ifi.
+//
+// If TemporaryAddresses is not supported on the current operating system, it
+// will return an error which can be checked using errors.Is(err, os.ErrNotExist).
+func TemporaryAddresses(ifi *net.Interface) ([]netaddr.IP, error) {
+	return temporaryAddresses(ifi)
+}
+
+// HasDefaultRoute reports whether an IPv6 default route is present in the
+// system's main routing table.
+//
+// If HasDefaultRoute is not supported on the current operating system, it will
+// return an error which can be checked using errors.Is(err, os.ErrNotExist).
+func HasDefaultRoute() (bool, error) {
+	return hasDefaultRoute()
+}
+
+// A Route is a unicast route in one of the system's IPv6 routing tables.
+type Route struct {
+	Prefix netaddr.IPPrefix
+
+	// Table is the routing table which contains the route, Protocol is the
+	// routing protocol or daemon which installed it, and Metric is its
+	// priority relative to other routes to the same destination.
+	Table    uint32
+	Protocol uint8
+	Metric   uint32
+
+	// Interface is the name of the route's output interface, or empty if the
+	// route does not have a single output interface.
+	Interface string
+}
+
+// Routes returns the unicast routes in all of the system's IPv6 routing
+// tables.
+//
+// If Routes is not supported on the current operating system, it will return
+// an error which can be checked using errors.Is(err, os.ErrNotExist).
+func Routes() ([]Route, error) {
+	return routes()
+}
+
+// NDProxyState is the state of the facilities which a router uses to proxy
+// neighbor discovery for an interface, per RFC 4389.
+type NDProxyState struct {
+	// ProxyNDP reports whether the kernel proxies neighbor discovery for the
+	// interface, such as using the net.ipv6.conf proxy_ndp sysctl on Linux.
+	ProxyNDP bool
+
+	// Promiscuous and AllMulticast report whether the interface receives
+	// traffic which is not addressed to it, as required by a neighbor
+	// discovery proxy daemon which receives solicitations for proxied hosts.
+	Promiscuous, AllMulticast bool
+}
+
+// InterfaceNDProxy fetches the NDProxyState of ifi.
+//
+// If InterfaceNDProxy is not supported on the current operating system, it
+// will return an error which can be checked using errors.Is(err, os.ErrNotExist).
+func InterfaceNDProxy(ifi *net.Interface) (*NDProxyState, error) {
+	return interfaceNDProxy(ifi)
+}
+
+// IPv6Parameters are the IPv6 parameters used by the kernel's own IPv6 stack
+// for a network interface.
+type IPv6Parameters struct {
+	HopLimit, MTU                  int
+	ReachableTime, RetransmitTimer time.Duration
+}
+
+// InterfaceIPv6Parameters fetches the IPv6 parameters used by the kernel for
+// the interface iface, such as from the net.ipv6.conf and net.ipv6.neigh
+// sysctls on Linux.
+//
+// If InterfaceIPv6Parameters is not supported on the current operating system,
+// it will return an error which can be checked using
+// errors.Is(err, os.ErrNotExist).
+func InterfaceIPv6Parameters(iface string) (*IPv6Parameters, error) {
+	return interfaceIPv6Parameters(iface)
+}
+
 // isNoSuchInterface determines if an error matches package net's "no such
 // interface" error.
 func isNoSuchInterface(err error) bool {
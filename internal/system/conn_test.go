@@ -17,8 +17,11 @@ import (
 	"errors"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/ndp"
+	"golang.org/x/net/ipv6"
 	"golang.org/x/net/nettest"
 )
 
@@ -75,6 +78,7 @@ func Test_checkInterface(t *testing.T) {
 		ifi         *net.Interface
 		addrFunc    func() ([]net.Addr, error)
 		ok, tempErr bool
+		err         error
 	}{
 		{
 			name: "no MAC",
@@ -89,14 +93,24 @@ func Test_checkInterface(t *testing.T) {
 				HardwareAddr: mac,
 			},
 			tempErr: true,
+			err:     ErrLinkDown,
 		},
 		{
-			name: "failed to get addresses",
+			name: "no multicast",
 			ifi: &net.Interface{
 				Name:         "test0",
 				HardwareAddr: mac,
 				Flags:        net.FlagUp,
 			},
+			err: ErrNoMulticast,
+		},
+		{
+			name: "failed to get addresses",
+			ifi: &net.Interface{
+				Name:         "test0",
+				HardwareAddr: mac,
+				Flags:        net.FlagUp | net.FlagMulticast,
+			},
 			addrFunc: func() ([]net.Addr, error) {
 				return nil, errors.New("some error")
 			},
@@ -106,7 +120,7 @@ func Test_checkInterface(t *testing.T) {
 			ifi: &net.Interface{
 				Name:         "test0",
 				HardwareAddr: mac,
-				Flags:        net.FlagUp,
+				Flags:        net.FlagUp | net.FlagMulticast,
 			},
 			addrFunc: func() ([]net.Addr, error) {
 				return []net.Addr{
@@ -116,13 +130,14 @@ func Test_checkInterface(t *testing.T) {
 				}, nil
 			},
 			tempErr: true,
+			err:     ErrNoLinkLocal,
 		},
 		{
 			name: "OK",
 			ifi: &net.Interface{
 				Name:         "test0",
 				HardwareAddr: mac,
-				Flags:        net.FlagUp,
+				Flags:        net.FlagUp | net.FlagMulticast,
 			},
 			addrFunc: func() ([]net.Addr, error) {
 				return []net.Addr{&net.IPNet{
@@ -150,6 +165,92 @@ func Test_checkInterface(t *testing.T) {
 			if !tt.tempErr && notReady {
 				t.Fatalf("error does not match link not ready: %v", err)
 			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("error should be %v, but got: %v", tt.err, err)
+			}
 		})
 	}
 }
+
+func TestTestConn(t *testing.T) {
+	t.Parallel()
+
+	c := NewTestConn(1)
+
+	// Injected messages are returned by ReadFrom with a default control
+	// message.
+	rs := &ndp.RouterSolicitation{}
+	c.Inject(TestMessage{Message: rs, IP: net.IPv6loopback})
+
+	m, cm, ip, err := c.ReadFrom()
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	want := TestMessage{
+		Message:        rs,
+		ControlMessage: &ipv6.ControlMessage{HopLimit: ndp.HopLimit},
+		IP:             net.IPv6loopback,
+	}
+
+	if diff := cmp.Diff(want, TestMessage{Message: m, ControlMessage: cm, IP: ip}); diff != "" {
+		t.Fatalf("unexpected read message (-want +got):\n%s", diff)
+	}
+
+	// Written messages are delivered in order.
+	ra := &ndp.RouterAdvertisement{CurrentHopLimit: 64}
+	if err := c.WriteTo(ra, nil, net.IPv6linklocalallnodes); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	want = TestMessage{Message: ra, IP: net.IPv6linklocalallnodes}
+	if diff := cmp.Diff(want, <-c.Writes()); diff != "" {
+		t.Fatalf("unexpected written message (-want +got):\n%s", diff)
+	}
+
+	// A blocked read is interrupted by a deadline change.
+	errC := make(chan error)
+	go func() {
+		_, _, _, err := c.ReadFrom()
+		errC <- err
+	}()
+
+	if err := c.SetReadDeadline(time.Unix(1, 0)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	var nerr net.Error
+	if err := <-errC; !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("expected timeout net.Error, but got: %v", err)
+	}
+}
+
+func TestShadowConn(t *testing.T) {
+	t.Parallel()
+
+	var got []TestMessage
+	tc := NewTestConn(1)
+	c := &ShadowConn{
+		Conn: tc,
+		OnWrite: func(m ndp.Message, cm *ipv6.ControlMessage, dst net.IP) {
+			got = append(got, TestMessage{Message: m, ControlMessage: cm, IP: dst})
+		},
+	}
+
+	ra := &ndp.RouterAdvertisement{CurrentHopLimit: 64}
+	if err := c.WriteTo(ra, nil, net.IPv6linklocalallnodes); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	want := []TestMessage{{Message: ra, IP: net.IPv6linklocalallnodes}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected shadowed messages (-want +got):\n%s", diff)
+	}
+
+	// Nothing may reach the underlying Conn.
+	select {
+	case m := <-tc.Writes():
+		t.Fatalf("unexpected write to underlying conn: %+v", m)
+	default:
+	}
+}
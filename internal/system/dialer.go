@@ -14,6 +14,7 @@
 package system
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/mdlayher/ndp"
@@ -34,6 +36,64 @@ type Dialer struct {
 	// set in tests.
 	DialFunc func() (*DialContext, error)
 
+	// BindToDevice specifies whether each Conn's socket should be bound to
+	// its network interface using SO_BINDTODEVICE, where supported. If OnBind
+	// is not nil, it is invoked with whether the socket was bound each time a
+	// Conn is created with BindToDevice set.
+	BindToDevice bool
+	OnBind       func(bound bool)
+
+	// WaitForInterface specifies whether the Dialer should wait indefinitely
+	// for its interface to be created if it does not exist, rather than
+	// eventually giving up. If OnWait is not nil, it is invoked with true
+	// when the Dialer begins waiting and false when the interface appears or
+	// waiting is canceled.
+	WaitForInterface bool
+	OnWait           func(waiting bool)
+
+	// WaitForLink specifies whether the Dialer should wait indefinitely for
+	// its interface's link to come up if it is down, rather than eventually
+	// giving up.
+	WaitForLink bool
+
+	// Diagnostic specifies whether each Conn should also accept NDP messages
+	// which are only useful for observation and troubleshooting.
+	Diagnostic bool
+
+	// Shadow specifies that the caller will not send router advertisements
+	// on each Conn, so the interface's state should not be modified.
+	Shadow bool
+
+	// SourcePolicy specifies how the Dialer selects the link-local source
+	// address of each Conn when the interface has several. SourceAddress is
+	// the address used by SourceExact.
+	SourcePolicy  SourcePolicy
+	SourceAddress net.IP
+
+	// Netns specifies the path to a network namespace, such as one in
+	// /var/run/netns, which contains the interface. If set, the interface is
+	// looked up and each Conn is created within that namespace. Network
+	// namespaces are only supported on Linux.
+	Netns string
+
+	// Trunk and VLAN specify that the interface is expected to be a VLAN
+	// sub-interface of the Trunk interface with the VLAN ID, which is verified
+	// each time the interface is dialed. VLANs are only verified on Linux.
+	Trunk string
+	VLAN  int
+
+	// File specifies a raw ICMPv6 socket which was passed to this process,
+	// such as by systemd socket activation, and should be used instead of
+	// creating a socket for each Conn. File is never closed by the Dialer.
+	File *os.File
+
+	// ReceiveBuffer and SendBuffer specify the sizes in bytes of each Conn's
+	// socket receive and send buffers. Zero leaves the operating system's
+	// default in place. If either is set, the Dialer creates its own raw
+	// ICMPv6 sockets rather than using package ndp, which does not expose its
+	// socket, but prepares them using the same setup as package ndp sockets.
+	ReceiveBuffer, SendBuffer int
+
 	iface string
 	state State
 	mode  DialerMode
@@ -50,6 +110,39 @@ const (
 	Monitor
 )
 
+// A SourcePolicy specifies how a Dialer selects a link-local source address.
+type SourcePolicy int
+
+// Possible SourcePolicy values.
+const (
+	// SourceAuto uses the first link-local address chosen by package ndp.
+	SourceAuto SourcePolicy = iota
+
+	// SourceLowest and SourceHighest use the numerically lowest or highest
+	// link-local address.
+	SourceLowest
+	SourceHighest
+
+	// SourceExact uses a specific link-local address.
+	SourceExact
+)
+
+// String returns the string representation of a SourcePolicy.
+func (p SourcePolicy) String() string {
+	switch p {
+	case SourceAuto:
+		return "auto"
+	case SourceLowest:
+		return "lowest"
+	case SourceHighest:
+		return "highest"
+	case SourceExact:
+		return "exact"
+	default:
+		return fmt.Sprintf("SourcePolicy(%d)", int(p))
+	}
+}
+
 // NewDialer creates a Dialer using the specified logger and network interface.
 func NewDialer(iface string, state State, mode DialerMode, ll *log.Logger) *Dialer {
 	if ll == nil {
@@ -73,6 +166,26 @@ func NewDialer(iface string, state State, mode DialerMode, ll *log.Logger) *Dial
 	return d
 }
 
+// NewTestDialer creates a Dialer which always produces a DialContext using
+// the input Conn, network interface, and IP address rather than dialing a
+// real socket. NewTestDialer is primarily useful in tests.
+func NewTestDialer(conn Conn, ifi *net.Interface, ip net.IP) *Dialer {
+	return &Dialer{
+		DialFunc: func() (*DialContext, error) {
+			return &DialContext{
+				Conn:      conn,
+				Interface: ifi,
+				IP:        ip,
+			}, nil
+		},
+
+		iface: ifi.Name,
+		state: TestState{},
+		mode:  Advertise,
+		ll:    log.New(ioutil.Discard, "", 0),
+	}
+}
+
 // A DialContext stores data used in the context of a Dialer.Dial closure.
 type DialContext struct {
 	Conn      Conn
@@ -139,6 +252,11 @@ func (d *Dialer) init(ctx context.Context, err error) (*DialContext, error) {
 	// Check for conditions which are recoverable.
 	var serr *os.SyscallError
 	switch {
+	case errors.Is(err, syscall.EADDRNOTAVAIL):
+		// The link-local source address was removed, possibly due to DAD or
+		// interface churn. Dialing again resolves the current link-local
+		// address, waiting for one to become available if necessary.
+		d.logf("link-local source address unavailable, reinitializing: %v", err)
 	case errors.As(err, &serr):
 		if errors.Is(serr, os.ErrPermission) {
 			// Permission denied means this will never work, so exit immediately.
@@ -148,7 +266,7 @@ func (d *Dialer) init(ctx context.Context, err error) (*DialContext, error) {
 		// For other syscall errors, try again.
 		d.logf("error listening, reinitializing: %v", err)
 	case errors.Is(err, ErrLinkNotReady):
-		d.logf("interface not ready, reinitializing")
+		d.logf("interface not ready, reinitializing: %v", err)
 	case errors.Is(err, ErrLinkChange):
 		d.logf("interface state changed, reinitializing")
 	case err == nil:
@@ -165,6 +283,15 @@ func (d *Dialer) init(ctx context.Context, err error) (*DialContext, error) {
 		maxDelay = 3 * time.Second
 	)
 
+	// Optionally wait indefinitely for the interface to be created or its
+	// link to come up. Other errors fall back to the ordinary retries.
+	for d.waitable(err) {
+		dctx, err = d.wait(ctx, maxDelay, err)
+		if err == nil || ctx.Err() != nil {
+			return dctx, err
+		}
+	}
+
 	var delay time.Duration
 	for i := 0; i < attempts; i++ {
 		select {
@@ -179,6 +306,14 @@ func (d *Dialer) init(ctx context.Context, err error) (*DialContext, error) {
 		}
 
 		dctx, err := d.DialFunc()
+		for d.waitable(err) {
+			// The condition may also occur after another error, such as a
+			// link which goes down after a link state change.
+			dctx, err = d.wait(ctx, maxDelay, err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
 		if err != nil {
 			d.logf("retrying initialization in %s, %d attempt(s) remaining: %v", delay, attempts-(i+1), err)
 			continue
@@ -190,9 +325,94 @@ func (d *Dialer) init(ctx context.Context, err error) (*DialContext, error) {
 	return nil, fmt.Errorf("timed out trying to initialize after error: %v", err)
 }
 
+// waitable reports whether the Dialer should wait indefinitely for the
+// condition indicated by err to resolve itself.
+func (d *Dialer) waitable(err error) bool {
+	return (d.WaitForInterface && errors.Is(err, ErrNoLink)) ||
+		(d.WaitForLink && errors.Is(err, ErrLinkDown))
+}
+
+// wait dials the Dialer's interface every interval until the condition
+// indicated by cause, either ErrNoLink or ErrLinkDown, no longer applies, and
+// returns the result of the first dial which does not fail with cause.
+func (d *Dialer) wait(ctx context.Context, interval time.Duration, cause error) (*DialContext, error) {
+	target := ErrLinkDown
+	if errors.Is(cause, ErrNoLink) {
+		target = ErrNoLink
+
+		d.logf("interface does not exist, waiting for it to be created")
+		if d.OnWait != nil {
+			d.OnWait(true)
+			defer d.OnWait(false)
+		}
+	} else {
+		d.logf("link is down, waiting for it to come up")
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+
+		dctx, err := d.DialFunc()
+		if errors.Is(err, target) {
+			continue
+		}
+		if err == nil {
+			d.logf("interface ready, initializing")
+		}
+
+		return dctx, err
+	}
+}
+
+// CheckNetns verifies that path refers to a network namespace which can be
+// used as a Dialer's Netns.
+func CheckNetns(path string) error { return checkNetns(path) }
+
+// InNetns invokes fn within the Dialer's network namespace, or directly if
+// Netns is not set. Any operations which inspect the Dialer's interface or
+// its IPv6 parameters should be performed using InNetns.
+func (d *Dialer) InNetns(fn func() error) error {
+	if d == nil || d.Netns == "" {
+		return fn()
+	}
+
+	return withNetns(d.Netns, fn)
+}
+
 // dial produces a DialContext after preparing an interface to handle IPv6
-// NDP traffic.
+// NDP traffic, within the Dialer's network namespace if one is set.
 func (d *Dialer) dial() (*DialContext, error) {
+	if d.Netns == "" {
+		return d.dialInterface()
+	}
+
+	var dctx *DialContext
+	err := withNetns(d.Netns, func() error {
+		var err error
+		dctx, err = d.dialInterface()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The interface's state must also be restored within the namespace.
+	done := dctx.done
+	dctx.done = func() error { return withNetns(d.Netns, done) }
+
+	return dctx, nil
+}
+
+// dialInterface produces a DialContext for the Dialer's interface in the
+// current network namespace.
+func (d *Dialer) dialInterface() (*DialContext, error) {
 	ifi, err := lookupInterface(d.iface)
 	if err != nil {
 		return nil, err
@@ -202,16 +422,39 @@ func (d *Dialer) dial() (*DialContext, error) {
 		return nil, err
 	}
 
-	conn, ip, err := dialNDP(ifi)
+	if d.VLAN != 0 {
+		err := checkVLAN(ifi.Name, d.Trunk, d.VLAN)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			d.logf("unable to verify VLAN sub-interface: %v", err)
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface %q addresses: %w", ifi.Name, err)
+	}
+
+	candidates := linkLocals(addrs)
+	types := d.icmpTypes()
+	conn, ip, err := d.dialConn(ifi, candidates, types)
 	if err != nil {
 		return nil, err
 	}
 
+	// Make the choice of source address visible when it is not obvious.
+	if len(candidates) > 1 || d.SourcePolicy != SourceAuto {
+		d.logf("selected link-local source address %s from %d candidate(s) %v using policy %q",
+			ip, len(candidates), candidates, d.SourcePolicy)
+	}
+
 	// For Advertise mode only, we must temporarily disable IPv6 autoconfiguration.
 	// When the Dialer closes a Conn, restore will be invoked to restore the
 	// previous state of the interface.
 	var restore func() error
-	if d.mode == Advertise {
+	if d.mode == Advertise && !d.Shadow {
 		restore, err = d.setAutoconf()
 		if err != nil {
 			return nil, err
@@ -224,6 +467,8 @@ func (d *Dialer) dial() (*DialContext, error) {
 		// In general, many of these actions are best-effort and should not halt
 		// shutdown on failure.
 
+		d.state.SetSocket(d.iface, nil)
+
 		if err := conn.LeaveGroup(net.IPv6linklocalallrouters); err != nil {
 			d.logf("failed to leave IPv6 link-local all routers multicast group: %v", err)
 		}
@@ -239,6 +484,13 @@ func (d *Dialer) dial() (*DialContext, error) {
 		return nil
 	}
 
+	// Publish the socket's setup so it can be inspected for debugging.
+	d.state.SetSocket(d.iface, &Socket{
+		Address:   ip,
+		Groups:    []net.IP{net.IPv6linklocalallrouters},
+		ICMPTypes: types,
+	})
+
 	return &DialContext{
 		Conn:      conn,
 		Interface: ifi,
@@ -247,6 +499,119 @@ func (d *Dialer) dial() (*DialContext, error) {
 	}, nil
 }
 
+// An ndpConn is a Conn which can also leave multicast groups and be closed.
+type ndpConn interface {
+	Conn
+	LeaveGroup(group net.IP) error
+	Close() error
+}
+
+// dialConn creates an ndpConn for ifi using the Dialer's File if set, or a new
+// socket otherwise.
+func (d *Dialer) dialConn(ifi *net.Interface, candidates []net.IP, types []ipv6.ICMPType) (ndpConn, net.IP, error) {
+	// Package ndp does not expose its socket, so the Dialer must create its
+	// own socket to apply any socket options.
+	tune := d.ReceiveBuffer > 0 || d.SendBuffer > 0
+	if d.File == nil && !tune && !d.BindToDevice {
+		addr, err := d.sourceAddr(candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		c, ip, err := dialNDP(ifi, addr, types)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return c, ip, nil
+	}
+
+	// There is no package ndp to choose a source address for SourceAuto, so
+	// use the first link-local address as package ndp would.
+	var (
+		src net.IP
+		err error
+	)
+	if d.SourcePolicy == SourceAuto {
+		if len(candidates) == 0 {
+			return nil, nil, ErrNoLinkLocal
+		}
+		src = candidates[0]
+	} else {
+		src, err = selectSource(candidates, d.SourcePolicy, d.SourceAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		c  *fileConn
+		ip net.IP
+	)
+	if d.File != nil {
+		c, ip, err = fileNDP(d.File, ifi, src, types)
+	} else {
+		c, ip, err = listenNDP(ifi, src, types)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	c.netns = d.Netns
+
+	if tune {
+		if err := d.tuneBuffers(c); err != nil {
+			_ = c.Close()
+			return nil, nil, err
+		}
+	}
+
+	if d.BindToDevice {
+		if err := d.bindToDevice(c); err != nil {
+			_ = c.Close()
+			return nil, nil, err
+		}
+	}
+
+	return c, ip, nil
+}
+
+// tuneBuffers applies the Dialer's socket buffer sizes to c and logs the
+// effective sizes chosen by the operating system.
+func (d *Dialer) tuneBuffers(c *fileConn) error {
+	// The kernel silently caps the buffer sizes at its limits, so make it
+	// obvious when the configuration asks for more.
+	rmax, wmax, err := bufferLimits()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.logf("unable to verify socket buffer size limits: %v", err)
+	case err != nil:
+		return fmt.Errorf("failed to get socket buffer size limits: %v", err)
+	default:
+		if d.ReceiveBuffer > rmax {
+			d.logf("receive buffer size %d exceeds the platform limit of %d bytes and will be capped", d.ReceiveBuffer, rmax)
+		}
+		if d.SendBuffer > wmax {
+			d.logf("send buffer size %d exceeds the platform limit of %d bytes and will be capped", d.SendBuffer, wmax)
+		}
+	}
+
+	if err := c.setBuffers(d.ReceiveBuffer, d.SendBuffer); err != nil {
+		return err
+	}
+
+	rcv, snd, err := c.buffers()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.logf("unable to verify socket buffer sizes: %v", err)
+	case err != nil:
+		return fmt.Errorf("failed to get socket buffer sizes: %v", err)
+	default:
+		d.logf("effective socket buffer sizes: receive %d bytes, send %d bytes", rcv, snd)
+	}
+
+	return nil
+}
+
 // setAutoconf disable IPv6 autoconfiguration for the Dialer's interface and
 // returns a function which restores the previous configuration when invoked.
 func (d *Dialer) setAutoconf() (func() error, error) {
@@ -290,37 +655,179 @@ func (d *Dialer) setAutoconf() (func() error, error) {
 	return restore, nil
 }
 
+// bindToDevice binds c to its network interface using SO_BINDTODEVICE. If
+// SO_BINDTODEVICE is not supported, c's traffic is only scoped to the
+// interface by its link-local source address, which is logged.
+func (d *Dialer) bindToDevice(c *fileConn) error {
+	err := c.bindToDevice()
+	if d.OnBind != nil {
+		d.OnBind(err == nil)
+	}
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.logf("unable to bind NDP socket to interface, relying on the link-local address scope: %v", err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to bind NDP socket to interface %q: %w", c.ifi.Name, err)
+	}
+
+	d.logf("NDP socket bound to interface using SO_BINDTODEVICE")
+	return nil
+}
+
+// sourceAddr selects the source address for an ndp.Conn from the link-local
+// candidates on an interface, using the Dialer's SourcePolicy.
+func (d *Dialer) sourceAddr(candidates []net.IP) (ndp.Addr, error) {
+	if d.SourcePolicy == SourceAuto {
+		return ndp.LinkLocal, nil
+	}
+
+	ip, err := selectSource(candidates, d.SourcePolicy, d.SourceAddress)
+	if err != nil {
+		return "", err
+	}
+
+	// Package ndp accepts a literal IPv6 address in place of an address type.
+	return ndp.Addr(ip.String()), nil
+}
+
+// selectSource selects a link-local source address from candidates using the
+// specified SourcePolicy, which must not be SourceAuto. want is the address
+// used by SourceExact.
+func selectSource(candidates []net.IP, policy SourcePolicy, want net.IP) (net.IP, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoLinkLocal
+	}
+
+	switch policy {
+	case SourceLowest, SourceHighest:
+		ip := candidates[0]
+		for _, c := range candidates[1:] {
+			cmp := bytes.Compare(c.To16(), ip.To16())
+			if (policy == SourceLowest && cmp < 0) || (policy == SourceHighest && cmp > 0) {
+				ip = c
+			}
+		}
+
+		return ip, nil
+	case SourceExact:
+		for _, c := range candidates {
+			if c.Equal(want) {
+				return c, nil
+			}
+		}
+
+		// The address may still be undergoing DAD, or may be added later.
+		return nil, fmt.Errorf("link-local source address %s is not assigned: %w", want, ErrLinkNotReady)
+	default:
+		panicf("system: invalid SourcePolicy for selection: %s", policy)
+		return nil, nil
+	}
+}
+
+// linkLocals returns the IPv6 link-local unicast addresses in addrs.
+func linkLocals(addrs []net.Addr) []net.IP {
+	var ips []net.IP
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if ok && isIPv6(ipn.IP) && ipn.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipn.IP)
+		}
+	}
+
+	return ips
+}
+
 // logf prints a formatted log with the Dialer's interface name.
 func (d *Dialer) logf(format string, v ...interface{}) {
 	d.ll.Println(d.iface + ": " + fmt.Sprintf(format, v...))
 }
 
-// dialNDP creates an ndp.Conn which is ready to serve router advertisements.
-func dialNDP(ifi *net.Interface) (*ndp.Conn, net.IP, error) {
-	c, ip, err := ndp.Dial(ifi, ndp.LinkLocal)
+// icmpTypes returns the ICMPv6 message types which a Conn will accept.
+func (d *Dialer) icmpTypes() []ipv6.ICMPType {
+	// Accept router solicitations to generate advertisements and other routers'
+	// advertisements to verify them against our own.
+	types := []ipv6.ICMPType{
+		ipv6.ICMPTypeRouterSolicitation,
+		ipv6.ICMPTypeRouterAdvertisement,
+	}
+
+	if d.Diagnostic {
+		// Observe neighbor discovery traffic for troubleshooting. Redirects are
+		// not accepted because package ndp cannot parse them, and a parsing
+		// failure would force the Conn to be reinitialized.
+		types = append(types,
+			ipv6.ICMPTypeNeighborSolicitation,
+			ipv6.ICMPTypeNeighborAdvertisement,
+		)
+	}
+
+	return types
+}
+
+// dialNDP creates an ndp.Conn bound to addr which is ready to serve router
+// advertisements, accepting only the specified ICMPv6 message types.
+func dialNDP(ifi *net.Interface, addr ndp.Addr, types []ipv6.ICMPType) (*ndp.Conn, net.IP, error) {
+	c, ip, err := ndp.Dial(ifi, addr)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Accept router solicitations to generate advertisements and other routers'
-	// advertisements to verify them against our own.
+	if err := setupNDP(c, types); err != nil {
+		_ = c.Close()
+		return nil, nil, err
+	}
+
+	return c, ip, nil
+}
+
+// A setupConn is a socket which can be prepared by setupNDP.
+type setupConn interface {
+	SetICMPFilter(f *ipv6.ICMPFilter) error
+	SetControlMessage(cf ipv6.ControlFlags, on bool) error
+	JoinGroup(group net.IP) error
+}
+
+// setupNDP prepares c to serve router advertisements, accepting only the
+// specified ICMPv6 message types. All Conns produced by a Dialer are prepared
+// by setupNDP, whether they were created by package ndp or not.
+func setupNDP(c setupConn, types []ipv6.ICMPType) error {
 	var f ipv6.ICMPFilter
 	f.SetAll(true)
-	f.Accept(ipv6.ICMPTypeRouterSolicitation)
-	f.Accept(ipv6.ICMPTypeRouterAdvertisement)
+	for _, t := range types {
+		f.Accept(t)
+	}
 
 	if err := c.SetICMPFilter(&f); err != nil {
-		return nil, nil, fmt.Errorf("failed to apply ICMPv6 filter: %v", err)
+		return fmt.Errorf("failed to apply ICMPv6 filter: %v", err)
 	}
 
 	// Enable inspection of IPv6 control messages.
 	if err := c.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
-		return nil, nil, fmt.Errorf("failed to apply IPv6 control message flags: %v", err)
+		return fmt.Errorf("failed to apply IPv6 control message flags: %v", err)
 	}
 
 	// We are now a router or want to examine messages as one would.
 	if err := c.JoinGroup(net.IPv6linklocalallrouters); err != nil {
-		return nil, nil, fmt.Errorf("failed to join IPv6 link-local all routers multicast group: %v", err)
+		return fmt.Errorf("failed to join IPv6 link-local all routers multicast group: %v", err)
+	}
+
+	return nil
+}
+
+// listenNDP creates a Conn bound to src like dialNDP, but using a raw ICMPv6
+// socket created by CoreRAD so that its options may be tuned.
+func listenNDP(ifi *net.Interface, src net.IP, types []ipv6.ICMPType) (*fileConn, net.IP, error) {
+	ipc, err := net.ListenIP("ip6:ipv6-icmp", &net.IPAddr{IP: src, Zone: ifi.Name})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, ip, err := newFileConn(ipc, ifi, src, types)
+	if err != nil {
+		_ = ipc.Close()
+		return nil, nil, err
 	}
 
 	return c, ip, nil
@@ -14,11 +14,134 @@
 package system
 
 import (
+	"errors"
 	"log"
+	"net"
 	"os"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/ndp"
+	"golang.org/x/net/ipv6"
 )
 
+func TestDialer_icmpTypes(t *testing.T) {
+	tests := []struct {
+		name       string
+		diagnostic bool
+		types      []ipv6.ICMPType
+	}{
+		{
+			name: "default",
+			types: []ipv6.ICMPType{
+				ipv6.ICMPTypeRouterSolicitation,
+				ipv6.ICMPTypeRouterAdvertisement,
+			},
+		},
+		{
+			name:       "diagnostic",
+			diagnostic: true,
+			types: []ipv6.ICMPType{
+				ipv6.ICMPTypeRouterSolicitation,
+				ipv6.ICMPTypeRouterAdvertisement,
+				ipv6.ICMPTypeNeighborSolicitation,
+				ipv6.ICMPTypeNeighborAdvertisement,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dialer{Diagnostic: tt.diagnostic}
+
+			if diff := cmp.Diff(tt.types, d.icmpTypes()); diff != "" {
+				t.Fatalf("unexpected ICMPv6 types (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDialer_sourceAddr(t *testing.T) {
+	// A fake interface with several link-local addresses, such as a manually
+	// added address alongside the EUI-64 address.
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.IPv4(192, 0, 2, 1), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("fe80::2"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("fe80::ff"), Mask: net.CIDRMask(64, 128)},
+	}
+
+	tests := []struct {
+		name   string
+		addrs  []net.Addr
+		policy SourcePolicy
+		want   net.IP
+		addr   ndp.Addr
+		err    error
+	}{
+		{
+			name:   "auto",
+			addrs:  addrs,
+			policy: SourceAuto,
+			addr:   ndp.LinkLocal,
+		},
+		{
+			name:   "lowest",
+			addrs:  addrs,
+			policy: SourceLowest,
+			addr:   "fe80::1",
+		},
+		{
+			name:   "highest",
+			addrs:  addrs,
+			policy: SourceHighest,
+			addr:   "fe80::ff",
+		},
+		{
+			name:   "exact",
+			addrs:  addrs,
+			policy: SourceExact,
+			want:   net.ParseIP("fe80::2"),
+			addr:   "fe80::2",
+		},
+		{
+			name:   "exact not assigned",
+			addrs:  addrs,
+			policy: SourceExact,
+			want:   net.ParseIP("fe80::3"),
+			err:    ErrLinkNotReady,
+		},
+		{
+			name:   "no link-local",
+			addrs:  addrs[:2],
+			policy: SourceLowest,
+			err:    ErrNoLinkLocal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dialer{
+				SourcePolicy:  tt.policy,
+				SourceAddress: tt.want,
+			}
+
+			addr, err := d.sourceAddr(linkLocals(tt.addrs))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.addr, addr); diff != "" {
+				t.Fatalf("unexpected address (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestDialer_setAutoconf(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -114,6 +237,20 @@ func (as *autoconfState) IPv6Autoconf(_ string) (bool, error) { return true, as.
 func (*autoconfState) IPv6Forwarding(_ string) (bool, error) {
 	panic("should not call IPv6Forwarding")
 }
+func (*autoconfState) Socket(_ string) (*Socket, error) { panic("should not call Socket") }
+func (*autoconfState) SetSocket(_ string, _ *Socket)    { panic("should not call SetSocket") }
+func (*autoconfState) RecentConflicts(_ string) ([]Conflict, error) {
+	panic("should not call RecentConflicts")
+}
+func (*autoconfState) SetRecentConflicts(_ string, _ []Conflict) {
+	panic("should not call SetRecentConflicts")
+}
+func (*autoconfState) AdoptedHopLimit(_ string) (uint8, error) {
+	panic("should not call AdoptedHopLimit")
+}
+func (*autoconfState) SetAdoptedHopLimit(_ string, _ uint8) {
+	panic("should not call SetAdoptedHopLimit")
+}
 func (as *autoconfState) SetIPv6Autoconf(_ string, _ bool) error {
 	defer func() { as.calls++ }()
 
@@ -21,9 +21,11 @@ import (
 	"net"
 	"os"
 	"os/user"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/corerad/internal/system"
 	"inet.af/netaddr"
 )
@@ -98,6 +100,34 @@ func TestDialerDialPrivilegedFatalError(t *testing.T) {
 	}
 }
 
+func TestDialerDialSourceAddressUnavailable(t *testing.T) {
+	t.Parallel()
+
+	d := system.NewTestDialer(system.NewTestConn(1), &net.Interface{Name: "test0"}, net.IPv6loopback)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The source address is unavailable on the first attempt, which must be
+	// treated as recoverable.
+	var calls int
+	err := d.Dial(ctx, func(_ context.Context, _ *system.DialContext) error {
+		defer func() { calls++ }()
+		if calls == 0 {
+			return fmt.Errorf("failed to send: %w", os.NewSyscallError("sendmsg", syscall.EADDRNOTAVAIL))
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, but got: %d", calls)
+	}
+}
+
 func TestDialerDialRetryContextCanceled(t *testing.T) {
 	t.Parallel()
 
@@ -135,6 +165,76 @@ func TestDialerDialRetryContextCanceled(t *testing.T) {
 	}
 }
 
+func TestDialerDialWait(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		link    bool
+		err     error
+		waiting []bool
+	}{
+		{
+			// The interface does not exist on the first attempt, so the
+			// Dialer waits for it to be created and reports that it is
+			// waiting.
+			name:    "interface",
+			err:     system.ErrNoLink,
+			waiting: []bool{true, false},
+		},
+		{
+			// The link is down on the first attempt, so the Dialer waits
+			// for it to come up.
+			name: "link",
+			link: true,
+			err:  system.ErrLinkDown,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var (
+				calls   int
+				waiting []bool
+			)
+
+			d := system.NewDialer("test0", nil, system.Advertise, nil)
+			d.WaitForInterface = !tt.link
+			d.WaitForLink = tt.link
+			d.OnWait = func(w bool) { waiting = append(waiting, w) }
+			d.DialFunc = func() (*system.DialContext, error) {
+				defer func() { calls++ }()
+				if calls == 0 {
+					return nil, fmt.Errorf("interface %q: %w", "test0", tt.err)
+				}
+
+				return &system.DialContext{}, nil
+			}
+
+			err := d.Dial(ctx, func(_ context.Context, _ *system.DialContext) error {
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+
+			if calls != 2 {
+				t.Fatalf("expected 2 calls, but got: %d", calls)
+			}
+
+			if diff := cmp.Diff(tt.waiting, waiting); diff != "" {
+				t.Fatalf("unexpected waiting states (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func testDialer(t *testing.T, privileged bool) *system.Dialer {
 	curr, err := user.Current()
 	if err != nil {
@@ -0,0 +1,107 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Possible Event types.
+const (
+	EventInterfaceUp   = "interface_up"
+	EventInterfaceDown = "interface_down"
+	EventReload        = "reload"
+	EventConflict      = "conflict"
+	EventSendError     = "send_error"
+	EventWithdraw      = "withdraw"
+	EventCordon        = "cordon"
+)
+
+// An Event is a notable occurrence recorded by an EventLog.
+type Event struct {
+	// Time is the time the Event was recorded.
+	Time time.Time
+
+	// Type is one of the Event* constants, and Interface is the name of the
+	// interface the Event applies to, or empty if none.
+	Type, Interface string
+
+	// Message describes the Event.
+	Message string
+}
+
+// An EventLog is a bounded log of recent Events. Once the log is full, the
+// oldest Event is discarded to make room for each new one. A nil *EventLog
+// discards all Events. EventLog is safe for concurrent use.
+type EventLog struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewEventLog creates an EventLog which retains up to max Events. It panics
+// if max is not positive.
+func NewEventLog(max int) *EventLog {
+	if max <= 0 {
+		panicf("system: EventLog max must be positive: %d", max)
+	}
+
+	return &EventLog{events: make([]Event, max)}
+}
+
+// Add records an Event of type typ for interface iface, with a message
+// formatted using format and v.
+func (l *EventLog) Add(typ, iface, format string, v ...interface{}) {
+	if l == nil {
+		return
+	}
+
+	e := Event{
+		Time:      time.Now(),
+		Type:      typ,
+		Interface: iface,
+		Message:   fmt.Sprintf(format, v...),
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events[l.next] = e
+	l.next++
+	if l.next == len(l.events) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// Events returns a copy of the recorded Events, from oldest to newest.
+func (l *EventLog) Events() []Event {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]Event(nil), l.events[:l.next]...)
+	}
+
+	es := make([]Event, 0, len(l.events))
+	es = append(es, l.events[l.next:]...)
+	return append(es, l.events[:l.next]...)
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mdlayher/corerad/internal/system"
+)
+
+func TestEventLog(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		add  int
+		want []string
+	}{
+		{
+			name: "empty",
+			max:  3,
+		},
+		{
+			name: "partial",
+			max:  3,
+			add:  2,
+			want: []string{"event 0", "event 1"},
+		},
+		{
+			name: "full",
+			max:  3,
+			add:  3,
+			want: []string{"event 0", "event 1", "event 2"},
+		},
+		{
+			name: "wrapped",
+			max:  3,
+			add:  7,
+			want: []string{"event 4", "event 5", "event 6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := system.NewEventLog(tt.max)
+			for i := 0; i < tt.add; i++ {
+				l.Add(system.EventReload, "eth0", "event %d", i)
+			}
+
+			var want []system.Event
+			for _, m := range tt.want {
+				want = append(want, system.Event{
+					Type:      system.EventReload,
+					Interface: "eth0",
+					Message:   m,
+				})
+			}
+
+			got := l.Events()
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(system.Event{}, "Time")); diff != "" {
+				t.Fatalf("unexpected events (-want +got):\n%s", diff)
+			}
+
+			for _, e := range got {
+				if e.Time.IsZero() {
+					t.Fatal("event time was not set")
+				}
+			}
+		})
+	}
+}
+
+func TestEventLogNil(t *testing.T) {
+	var l *system.EventLog
+	l.Add(system.EventReload, "", "ignored")
+
+	if es := l.Events(); es != nil {
+		t.Fatalf("expected no events, but got: %v", es)
+	}
+}
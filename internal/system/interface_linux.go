@@ -17,9 +17,21 @@ package system
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jsimonetti/rtnetlink"
+	"golang.org/x/sys/unix"
+	"inet.af/netaddr"
 )
 
 // setIPv6Autoconf enables or disables IPv6 autoconfiguration for the
@@ -40,6 +52,456 @@ func getIPv6Forwarding(iface string) (bool, error) {
 	return sysctlBool(sysctl(iface, "forwarding"))
 }
 
+// interfaceIPv6Parameters fetches the IPv6 parameters for the given interface
+// from sysctls on Linux systems.
+func interfaceIPv6Parameters(iface string) (*IPv6Parameters, error) {
+	hopLimit, err := sysctlInt(sysctl(iface, "hop_limit"))
+	if err != nil {
+		return nil, err
+	}
+
+	mtu, err := sysctlInt(sysctl(iface, "mtu"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Neighbor discovery timers are found in a separate sysctl tree.
+	neigh := filepath.Join("/proc/sys/net/ipv6/neigh", iface)
+
+	reachable, err := sysctlInt(filepath.Join(neigh, "base_reachable_time_ms"))
+	if err != nil {
+		return nil, err
+	}
+
+	retrans, err := sysctlInt(filepath.Join(neigh, "retrans_time_ms"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPv6Parameters{
+		HopLimit:        hopLimit,
+		MTU:             mtu,
+		ReachableTime:   time.Duration(reachable) * time.Millisecond,
+		RetransmitTimer: time.Duration(retrans) * time.Millisecond,
+	}, nil
+}
+
+// temporaryAddresses fetches the IPv6 temporary addresses for the given
+// interface using route netlink on Linux systems.
+func temporaryAddresses(ifi *net.Interface) ([]netaddr.IP, error) {
+	c, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial route netlink: %w", err)
+	}
+	defer c.Close()
+
+	msgs, err := c.Address.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %w", err)
+	}
+
+	var ips []netaddr.IP
+	for _, m := range msgs {
+		if m.Family != unix.AF_INET6 || int(m.Index) != ifi.Index {
+			continue
+		}
+
+		// The flags may be set in either the message header or the extended
+		// flags attribute.
+		if uint32(m.Flags)&unix.IFA_F_TEMPORARY == 0 && m.Attributes.Flags&unix.IFA_F_TEMPORARY == 0 {
+			continue
+		}
+
+		ip, ok := netaddr.FromStdIP(m.Attributes.Address)
+		if !ok {
+			return nil, fmt.Errorf("invalid IP address in route netlink message: %q", m.Attributes.Address)
+		}
+
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// hasDefaultRoute reports whether an IPv6 default route exists in the main
+// routing table using route netlink on Linux systems.
+func hasDefaultRoute() (bool, error) {
+	c, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to dial route netlink: %w", err)
+	}
+	defer c.Close()
+
+	msgs, err := c.Route.List()
+	if err != nil {
+		return false, fmt.Errorf("failed to list routes: %w", err)
+	}
+
+	for _, m := range msgs {
+		// Only consider usable unicast ::/0 routes in the main table, so that
+		// unreachable or blackhole default routes are not treated as upstream
+		// connectivity.
+		if m.Family != unix.AF_INET6 || m.DstLength != 0 || m.Type != unix.RTN_UNICAST {
+			continue
+		}
+
+		table := uint32(m.Table)
+		if m.Attributes.Table != 0 {
+			table = m.Attributes.Table
+		}
+		if table != unix.RT_TABLE_MAIN {
+			continue
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// routes fetches the unicast routes in all IPv6 routing tables using route
+// netlink on Linux systems.
+func routes() ([]Route, error) {
+	c, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial route netlink: %w", err)
+	}
+	defer c.Close()
+
+	msgs, err := c.Route.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+
+	var rs []Route
+	for _, m := range msgs {
+		// Only consider unicast routes, and not the kernel's cached clones of
+		// them.
+		if m.Family != unix.AF_INET6 || m.Type != unix.RTN_UNICAST || m.Flags&unix.RTM_F_CLONED != 0 {
+			continue
+		}
+
+		// The default route has no destination attribute.
+		dst := net.IPv6unspecified
+		if m.Attributes.Dst != nil {
+			dst = m.Attributes.Dst
+		}
+
+		ip, ok := netaddr.FromStdIP(dst)
+		if !ok {
+			return nil, fmt.Errorf("invalid IP address in route netlink message: %q", dst)
+		}
+
+		prefix, err := ip.Prefix(m.DstLength)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix in route netlink message: %v", err)
+		}
+
+		table := uint32(m.Table)
+		if m.Attributes.Table != 0 {
+			table = m.Attributes.Table
+		}
+
+		// The output interface may have been removed since the route was
+		// listed, in which case it is treated as unknown.
+		var iface string
+		if m.Attributes.OutIface != 0 {
+			if ifi, err := net.InterfaceByIndex(int(m.Attributes.OutIface)); err == nil {
+				iface = ifi.Name
+			}
+		}
+
+		rs = append(rs, Route{
+			Prefix:    prefix,
+			Table:     table,
+			Protocol:  m.Protocol,
+			Metric:    m.Attributes.Priority,
+			Interface: iface,
+		})
+	}
+
+	return rs, nil
+}
+
+// interfaceNDProxy fetches the neighbor discovery proxy state for ifi using
+// sysctls and route netlink on Linux systems.
+func interfaceNDProxy(ifi *net.Interface) (*NDProxyState, error) {
+	proxy, err := sysctlInt(sysctl(ifi.Name, "proxy_ndp"))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial route netlink: %w", err)
+	}
+	defer c.Close()
+
+	m, err := c.Link.Get(uint32(ifi.Index))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+
+	return &NDProxyState{
+		ProxyNDP:     proxy != 0,
+		Promiscuous:  m.Flags&unix.IFF_PROMISC != 0,
+		AllMulticast: m.Flags&unix.IFF_ALLMULTI != 0,
+	}, nil
+}
+
+// checkVLAN verifies that iface is a VLAN sub-interface of trunk with the VLAN
+// ID vlan on Linux systems.
+func checkVLAN(iface, trunk string, vlan int) error {
+	// The interface is looked up in the calling thread's network namespace.
+	b, err := ioutil.ReadFile(filepath.Join("/proc/thread-self/net/vlan", iface))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("interface %q is not a VLAN sub-interface", iface)
+		}
+
+		return fmt.Errorf("failed to check interface %q VLAN: %v", iface, err)
+	}
+
+	gotTrunk, gotVLAN, err := parseProcVLAN(b)
+	if err != nil {
+		return fmt.Errorf("failed to check interface %q VLAN: %v", iface, err)
+	}
+
+	if gotTrunk != trunk || gotVLAN != vlan {
+		return fmt.Errorf("interface %q is VLAN %d on interface %q, but expected VLAN %d on interface %q",
+			iface, gotVLAN, gotTrunk, vlan, trunk)
+	}
+
+	return nil
+}
+
+// parseProcVLAN parses the trunk interface and VLAN ID of a VLAN sub-interface
+// from its /proc/net/vlan file.
+func parseProcVLAN(b []byte) (string, int, error) {
+	var (
+		trunk string
+		vlan  int
+	)
+
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		fs := strings.Fields(string(line))
+		switch {
+		case len(fs) >= 3 && fs[1] == "VID:":
+			v, err := strconv.Atoi(fs[2])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid VLAN ID: %v", err)
+			}
+			vlan = v
+		case len(fs) >= 2 && fs[0] == "Device:":
+			trunk = fs[1]
+		}
+	}
+
+	if trunk == "" || vlan == 0 {
+		return "", 0, errors.New("missing VLAN ID or device")
+	}
+
+	return trunk, vlan, nil
+}
+
+// bufferLimits returns the maximum receive and send buffer sizes which may be
+// requested for a socket on Linux systems.
+func bufferLimits() (int, int, error) {
+	rmax, err := sysctlInt("/proc/sys/net/core/rmem_max")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	wmax, err := sysctlInt("/proc/sys/net/core/wmem_max")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rmax, wmax, nil
+}
+
+// socketBuffers returns the effective receive and send buffer sizes of the
+// socket c on Linux systems. Note that the kernel doubles the requested sizes
+// to allow for its own bookkeeping overhead.
+func socketBuffers(c syscall.RawConn) (int, int, error) {
+	var (
+		rcv, snd int
+		serr     error
+	)
+
+	err := c.Control(func(fd uintptr) {
+		rcv, serr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+		if serr != nil {
+			return
+		}
+
+		snd, serr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if serr != nil {
+		return 0, 0, os.NewSyscallError("getsockopt", serr)
+	}
+
+	return rcv, snd, nil
+}
+
+// bindToDevice binds the socket c to the network interface iface using
+// SO_BINDTODEVICE, and verifies the binding, on Linux systems.
+func bindToDevice(c syscall.RawConn, iface string) error {
+	var (
+		bound string
+		serr  error
+	)
+
+	err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, iface)
+		if serr != nil {
+			serr = os.NewSyscallError("setsockopt", serr)
+			return
+		}
+
+		bound, serr = unix.GetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE)
+		if serr != nil {
+			serr = os.NewSyscallError("getsockopt", serr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return serr
+	}
+
+	if bound = strings.TrimRight(bound, "\x00"); bound != iface {
+		return fmt.Errorf("socket is bound to interface %q, not %q", bound, iface)
+	}
+
+	return nil
+}
+
+// socketDrops returns the number of packets dropped by the receive queue of
+// the raw IPv6 socket c on Linux systems. If netns is set, the socket is
+// looked up within that network namespace.
+func socketDrops(c syscall.RawConn, netns string) (uint64, error) {
+	var (
+		st   unix.Stat_t
+		serr error
+	)
+
+	err := c.Control(func(fd uintptr) {
+		serr = unix.Fstat(int(fd), &st)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if serr != nil {
+		return 0, os.NewSyscallError("fstat", serr)
+	}
+
+	// The sockets are listed in the calling thread's network namespace.
+	var b []byte
+	read := func() error {
+		var err error
+		b, err = ioutil.ReadFile("/proc/thread-self/net/raw6")
+		return err
+	}
+
+	if netns == "" {
+		err = read()
+	} else {
+		err = withNetns(netns, read)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read raw IPv6 sockets: %v", err)
+	}
+
+	return parseProcRaw6Drops(b, uint64(st.Ino))
+}
+
+// parseProcRaw6Drops parses the number of dropped packets for the socket with
+// the specified inode from the contents of /proc/net/raw6.
+func parseProcRaw6Drops(b []byte, inode uint64) (uint64, error) {
+	// The inode is the tenth field and the drop count is the last.
+	const inodeField = 9
+
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		fs := strings.Fields(string(line))
+		if len(fs) <= inodeField || fs[inodeField] != strconv.FormatUint(inode, 10) {
+			continue
+		}
+
+		drops, err := strconv.ParseUint(fs[len(fs)-1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid socket drop count: %v", err)
+		}
+
+		return drops, nil
+	}
+
+	return 0, fmt.Errorf("socket with inode %d not found: %w", inode, os.ErrNotExist)
+}
+
+// checkNetns verifies that path refers to a namespace file on Linux systems.
+func checkNetns(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(int(f.Fd()), &st); err != nil {
+		return fmt.Errorf("failed to check network namespace %q: %v", path, err)
+	}
+
+	if int64(st.Type) != unix.NSFS_MAGIC {
+		return fmt.Errorf("system: %q is not a network namespace", path)
+	}
+
+	return nil
+}
+
+// withNetns invokes fn on an OS thread which has entered the network namespace
+// at path on Linux systems, restoring the thread's original network namespace
+// once fn returns.
+func withNetns(path string, fn func() error) error {
+	// Namespaces apply to individual threads, so the goroutine must not be
+	// rescheduled elsewhere until the original namespace is restored.
+	runtime.LockOSThread()
+
+	orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to open current network namespace: %v", err)
+	}
+	defer orig.Close()
+
+	ns, err := os.Open(path)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to open network namespace: %v", err)
+	}
+	defer ns.Close()
+
+	if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to enter network namespace %q: %v", path, err)
+	}
+
+	defer func() {
+		// If the original namespace cannot be restored, leave the thread
+		// locked so that it is discarded when the goroutine exits, rather
+		// than being reused in the wrong namespace.
+		if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+
+	return fn()
+}
+
 // sysctlBool reads a 0/1 boolean value from a file.
 func sysctlBool(file string) (bool, error) {
 	out, err := ioutil.ReadFile(file)
@@ -50,6 +512,21 @@ func sysctlBool(file string) (bool, error) {
 	return bytes.Equal(out, []byte("1\n")), nil
 }
 
+// sysctlInt reads an integer value from a file.
+func sysctlInt(file string) (int, error) {
+	out, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.Atoi(string(bytes.TrimSpace(out)))
+	if err != nil {
+		return 0, fmt.Errorf("system: invalid integer sysctl %q: %v", file, err)
+	}
+
+	return v, nil
+}
+
 // sysctl builds an IPv6 sysctl path for an interface and given key.
 func sysctl(iface, key string) string {
 	return filepath.Join(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s", iface), key)
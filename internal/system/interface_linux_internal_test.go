@@ -0,0 +1,155 @@
+// Copyright 2020 Matt Layher
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package system
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_bindToDevice(t *testing.T) {
+	ifi, err := net.InterfaceByIndex(1)
+	if err != nil {
+		t.Skipf("skipping, failed to get loopback interface: %v", err)
+	}
+
+	// Any socket can be bound to a device, so use UDP to avoid the need for
+	// privileges to create a raw socket.
+	c, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("skipping, failed to listen: %v", err)
+	}
+	defer c.Close()
+
+	rc, err := c.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+
+	if err := bindToDevice(rc, ifi.Name); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("skipping, permission denied: %v", err)
+		}
+
+		t.Fatalf("failed to bind to device: %v", err)
+	}
+}
+
+func Test_parseProcVLAN(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		trunk string
+		vlan  int
+		ok    bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "bad VLAN ID",
+			s:    "eth0.10  VID: foo\t REORDER_HDR: 1  dev->priv_flags: 1001\nDevice: eth0\n",
+		},
+		{
+			name: "missing device",
+			s:    "eth0.10  VID: 10\t REORDER_HDR: 1  dev->priv_flags: 1001\n",
+		},
+		{
+			name: "OK",
+			s: "eth0.10  VID: 10\t REORDER_HDR: 1  dev->priv_flags: 1001\n" +
+				"         total frames received            0\n" +
+				"          total bytes received            0\n" +
+				"Device: eth0\n" +
+				"INGRESS priority mappings: 0:0  1:0  2:0  3:0  4:0  5:0  6:0 7:0\n",
+			trunk: "eth0",
+			vlan:  10,
+			ok:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trunk, vlan, err := parseProcVLAN([]byte(tt.s))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse VLAN: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.trunk, trunk); diff != "" {
+				t.Fatalf("unexpected trunk (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.vlan, vlan); diff != "" {
+				t.Fatalf("unexpected VLAN (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_parseProcRaw6Drops(t *testing.T) {
+	const s = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n" +
+		"   58: FE800000000000000000000000000001:003A 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 12345 2 0000000000000000 42\n" +
+		"   58: 00000000000000000000000000000000:003A 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 67890 2 0000000000000000 bad\n"
+
+	tests := []struct {
+		name  string
+		inode uint64
+		drops uint64
+		ok    bool
+	}{
+		{
+			name:  "not found",
+			inode: 1,
+		},
+		{
+			name:  "bad drops",
+			inode: 67890,
+		},
+		{
+			name:  "OK",
+			inode: 12345,
+			drops: 42,
+			ok:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drops, err := parseProcRaw6Drops([]byte(s), tt.inode)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse drops: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(tt.drops, drops); diff != "" {
+				t.Fatalf("unexpected drops (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -15,6 +15,16 @@
 
 package system
 
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"inet.af/netaddr"
+)
+
 // These functions are no-op on non-Linux platforms.
 
 func setIPv6Autoconf(_ string, _ bool) error { return nil }
@@ -25,3 +35,63 @@ func getIPv6Forwarding(_ string) (bool, error) {
 	// Assume that an interface running CoreRAD is forwarding packets.
 	return true, nil
 }
+
+func checkNetns(_ string) error {
+	return fmt.Errorf("system: network namespaces not supported on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func withNetns(_ string, _ func() error) error {
+	return fmt.Errorf("system: network namespaces not supported on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func hasDefaultRoute() (bool, error) {
+	return false, fmt.Errorf("system: default route detection not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func routes() ([]Route, error) {
+	return nil, fmt.Errorf("system: route listing not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func interfaceIPv6Parameters(_ string) (*IPv6Parameters, error) {
+	return nil, fmt.Errorf("system: IPv6 parameter detection not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func interfaceNDProxy(_ *net.Interface) (*NDProxyState, error) {
+	return nil, fmt.Errorf("system: ND proxy detection not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func checkVLAN(_, _ string, _ int) error {
+	return fmt.Errorf("system: VLAN detection not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func temporaryAddresses(_ *net.Interface) ([]netaddr.IP, error) {
+	return nil, fmt.Errorf("system: temporary address detection not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func bufferLimits() (int, int, error) {
+	return 0, 0, fmt.Errorf("system: socket buffer limits not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func socketBuffers(_ syscall.RawConn) (int, int, error) {
+	return 0, 0, fmt.Errorf("system: socket buffer sizes not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func bindToDevice(_ syscall.RawConn, _ string) error {
+	return fmt.Errorf("system: SO_BINDTODEVICE not supported on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
+
+func socketDrops(_ syscall.RawConn, _ string) (uint64, error) {
+	return 0, fmt.Errorf("system: socket drop counting not implemented on %q: %w",
+		runtime.GOOS, os.ErrNotExist)
+}
@@ -13,28 +13,159 @@
 
 package system
 
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv6"
+)
+
 // State is a type which can manipulate the low-level IPv6 parameters of
 // a system.
 type State interface {
 	IPv6Autoconf(iface string) (bool, error)
 	IPv6Forwarding(iface string) (bool, error)
 	SetIPv6Autoconf(iface string, enable bool) error
+
+	// Socket and SetSocket fetch and publish the setup of the NDP socket for
+	// an interface, for debugging purposes. Socket returns nil if no socket
+	// has been published for iface, and a nil Socket clears any previous one.
+	Socket(iface string) (*Socket, error)
+	SetSocket(iface string, s *Socket)
+
+	// RecentConflicts and SetRecentConflicts fetch and publish the recent
+	// router advertisement conflicts detected on an interface.
+	RecentConflicts(iface string) ([]Conflict, error)
+	SetRecentConflicts(iface string, cs []Conflict)
+
+	// AdoptedHopLimit and SetAdoptedHopLimit fetch and publish the hop limit
+	// an interface adopted from other routers, or 0 if none was adopted.
+	AdoptedHopLimit(iface string) (uint8, error)
+	SetAdoptedHopLimit(iface string, hopLimit uint8)
+}
+
+// A Conflict is a recent disagreement between the router advertisements sent
+// by this router and those sent by another router on the same link.
+type Conflict struct {
+	// Router is the address of the conflicting router.
+	Router net.IP
+
+	// Field and Details identify the conflicting router advertisement field,
+	// and Message describes how the values differ.
+	Field, Details, Message string
+
+	// Ours and Theirs are the values of the field advertised by this router
+	// and the conflicting router.
+	Ours, Theirs string
+
+	// Persistent reports whether the conflict has lasted for the conflict
+	// window and has been reported.
+	Persistent bool
+
+	// Duplicates is the number of times the conflict was observed again
+	// after it was first detected, without being reported again.
+	Duplicates int
+
+	// FirstSeen and LastSeen are the times the conflict was first and most
+	// recently observed.
+	FirstSeen, LastSeen time.Time
+}
+
+// A Socket describes the setup of an NDP socket created by a Dialer.
+type Socket struct {
+	// Address is the link-local source address the socket is bound to.
+	Address net.IP
+
+	// Groups are the multicast groups the socket has joined.
+	Groups []net.IP
+
+	// ICMPTypes are the ICMPv6 message types accepted by the socket's filter.
+	ICMPTypes []ipv6.ICMPType
 }
 
 // NewState creates State which directly manipulates the operating system.
-func NewState() State { return systemState{} }
+func NewState() State {
+	return &systemState{
+		sockets:   make(map[string]*Socket),
+		conflicts: make(map[string][]Conflict),
+		hopLimits: make(map[string]uint8),
+	}
+}
 
 // A systemState directly manipulates the operating system's state.
-type systemState struct{}
+type systemState struct {
+	mu        sync.RWMutex
+	sockets   map[string]*Socket
+	conflicts map[string][]Conflict
+	hopLimits map[string]uint8
+}
 
-var _ State = systemState{}
+var _ State = &systemState{}
 
-func (systemState) IPv6Autoconf(iface string) (bool, error)   { return getIPv6Autoconf(iface) }
-func (systemState) IPv6Forwarding(iface string) (bool, error) { return getIPv6Forwarding(iface) }
-func (systemState) SetIPv6Autoconf(iface string, enable bool) error {
+func (*systemState) IPv6Autoconf(iface string) (bool, error)   { return getIPv6Autoconf(iface) }
+func (*systemState) IPv6Forwarding(iface string) (bool, error) { return getIPv6Forwarding(iface) }
+func (*systemState) SetIPv6Autoconf(iface string, enable bool) error {
 	return setIPv6Autoconf(iface, enable)
 }
 
+func (s *systemState) Socket(iface string) (*Socket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sockets[iface], nil
+}
+
+func (s *systemState) SetSocket(iface string, sock *Socket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sock == nil {
+		delete(s.sockets, iface)
+		return
+	}
+
+	s.sockets[iface] = sock
+}
+
+func (s *systemState) RecentConflicts(iface string) ([]Conflict, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.conflicts[iface], nil
+}
+
+func (s *systemState) SetRecentConflicts(iface string, cs []Conflict) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(cs) == 0 {
+		delete(s.conflicts, iface)
+		return
+	}
+
+	s.conflicts[iface] = cs
+}
+
+func (s *systemState) AdoptedHopLimit(iface string) (uint8, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.hopLimits[iface], nil
+}
+
+func (s *systemState) SetAdoptedHopLimit(iface string, hopLimit uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hopLimit == 0 {
+		delete(s.hopLimits, iface)
+		return
+	}
+
+	s.hopLimits[iface] = hopLimit
+}
+
 // A TestState is a State which is primarily useful in tests.
 type TestState struct {
 	// Global settings for any interface name.
@@ -45,6 +176,18 @@ type TestState struct {
 	// per-interface basis. Note that these configurations will override any
 	// global configurations set above.
 	Interfaces map[string]TestStateInterface
+
+	// Sockets optionally stores published Sockets by interface name. If nil,
+	// published Sockets are discarded.
+	Sockets map[string]*Socket
+
+	// Conflicts optionally stores published Conflicts by interface name. If
+	// nil, published Conflicts are discarded.
+	Conflicts map[string][]Conflict
+
+	// HopLimits optionally stores published adopted hop limits by interface
+	// name. If nil, published hop limits are discarded.
+	HopLimits map[string]uint8
 }
 
 // A TestStateInterface sets the State configuration for a simulated network interface.
@@ -80,3 +223,60 @@ func (ts TestState) IPv6Forwarding(iface string) (bool, error) {
 func (ts TestState) SetIPv6Autoconf(iface string, _ bool) error {
 	return ts.Error
 }
+
+// Socket implements State.
+func (ts TestState) Socket(iface string) (*Socket, error) {
+	return ts.Sockets[iface], ts.Error
+}
+
+// SetSocket implements State.
+func (ts TestState) SetSocket(iface string, s *Socket) {
+	if ts.Sockets == nil {
+		return
+	}
+
+	if s == nil {
+		delete(ts.Sockets, iface)
+		return
+	}
+
+	ts.Sockets[iface] = s
+}
+
+// RecentConflicts implements State.
+func (ts TestState) RecentConflicts(iface string) ([]Conflict, error) {
+	return ts.Conflicts[iface], ts.Error
+}
+
+// SetRecentConflicts implements State.
+func (ts TestState) SetRecentConflicts(iface string, cs []Conflict) {
+	if ts.Conflicts == nil {
+		return
+	}
+
+	if len(cs) == 0 {
+		delete(ts.Conflicts, iface)
+		return
+	}
+
+	ts.Conflicts[iface] = cs
+}
+
+// AdoptedHopLimit implements State.
+func (ts TestState) AdoptedHopLimit(iface string) (uint8, error) {
+	return ts.HopLimits[iface], ts.Error
+}
+
+// SetAdoptedHopLimit implements State.
+func (ts TestState) SetAdoptedHopLimit(iface string, hopLimit uint8) {
+	if ts.HopLimits == nil {
+		return
+	}
+
+	if hopLimit == 0 {
+		delete(ts.HopLimits, iface)
+		return
+	}
+
+	ts.HopLimits[iface] = hopLimit
+}